@@ -0,0 +1,110 @@
+package gokyu
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// newAddressingPublisher wraps a publisher of client so that messages with
+// Message.To set are sent to that destination. The returned publisher
+// implements ScheduledPublisher if pub does.
+func newAddressingPublisher(pub Publisher, client *Client) Publisher {
+	p := &addressingPublisher{
+		Publisher:   pub,
+		client:      client,
+		destination: firstNonEmpty(client.config.Queue, client.config.Topic),
+	}
+	if sp, ok := pub.(ScheduledPublisher); ok {
+		return &addressingScheduledPublisher{addressingPublisher: p, scheduled: sp}
+	}
+	return p
+}
+
+// addressingPublisher sends addressed messages through a relay publisher,
+// created on first use, and other messages through the wrapped publisher.
+type addressingPublisher struct {
+	Publisher
+	client      *Client
+	destination string
+
+	mu    sync.Mutex
+	relay RelayPublisher
+}
+
+func (p *addressingPublisher) Publish(ctx context.Context, msg *Message) error {
+	if !p.addressed(msg) {
+		return p.Publisher.Publish(ctx, msg)
+	}
+	relay, err := p.link(ctx)
+	if err != nil {
+		return err
+	}
+	return relay.PublishTo(ctx, msg.To, msg)
+}
+
+func (p *addressingPublisher) BrokerProperties() map[string]interface{} {
+	return brokerProperties(p.Publisher)
+}
+
+// addressed reports whether msg is addressed to another destination than
+// the configured one.
+func (p *addressingPublisher) addressed(msg *Message) bool {
+	return msg.To != "" && prefixEntity(p.client.config.EntityPrefix, msg.To) != p.destination
+}
+
+// link returns the relay publisher, creating it if needed.
+func (p *addressingPublisher) link(ctx context.Context) (RelayPublisher, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.relay == nil {
+		relay, err := p.client.newRelay(ctx)
+		if err != nil {
+			return nil, err
+		}
+		p.relay = relay
+	}
+	return p.relay, nil
+}
+
+func (p *addressingPublisher) Close(ctx context.Context) error {
+	p.mu.Lock()
+	relay := p.relay
+	p.relay = nil
+	p.mu.Unlock()
+
+	var errs []error
+	if relay != nil {
+		errs = append(errs, relay.Close(ctx))
+	}
+	errs = append(errs, p.Publisher.Close(ctx))
+	return errors.Join(errs...)
+}
+
+// addressingScheduledPublisher is an addressingPublisher whose wrapped
+// publisher can schedule messages.
+type addressingScheduledPublisher struct {
+	*addressingPublisher
+	scheduled ScheduledPublisher
+}
+
+func (p *addressingScheduledPublisher) Schedule(ctx context.Context, msg *Message, at time.Time) (string, error) {
+	if p.addressed(msg) {
+		return "", WrapError(ErrPublishFailed, errors.New("scheduled messages cannot be addressed with Message.To"))
+	}
+	return p.scheduled.Schedule(ctx, msg, at)
+}
+
+func (p *addressingScheduledPublisher) ScheduleBatch(ctx context.Context, msgs []*Message, at time.Time) ([]string, error) {
+	for _, msg := range msgs {
+		if p.addressed(msg) {
+			return nil, WrapError(ErrPublishFailed, errors.New("scheduled messages cannot be addressed with Message.To"))
+		}
+	}
+	return ScheduleBatch(ctx, p.scheduled, msgs, at)
+}
+
+func (p *addressingScheduledPublisher) CancelScheduled(ctx context.Context, token string) error {
+	return p.scheduled.CancelScheduled(ctx, token)
+}
@@ -0,0 +1,65 @@
+package gokyu
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestClient_PublishMessageTo(t *testing.T) {
+	client, factory := newRelayClient(t, "test-addressing-provider", Config{})
+	if got := client.Capabilities().Addressing; got != Native {
+		t.Errorf("Capabilities().Addressing = %v, want native", got)
+	}
+
+	ctx := context.Background()
+	pub, err := client.NewPublisher(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub.Publish(ctx, NewMessage([]byte("a")))
+	if factory.relays != 0 {
+		t.Errorf("expected no relay before a message is addressed, got %d", factory.relays)
+	}
+
+	for _, to := range []string{"replies", "default", "replies"} {
+		msg := NewMessage([]byte(to))
+		msg.To = to
+		if err := pub.Publish(ctx, msg); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+	if factory.relays != 1 || len(factory.published["replies"]) != 2 || len(factory.published["default"]) != 2 {
+		t.Errorf("relays = %d, published = %v", factory.relays, factory.published)
+	}
+
+	if err := pub.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if factory.closed != 1 {
+		t.Errorf("expected the relay to be closed with the publisher, closed = %d", factory.closed)
+	}
+
+	relay, _ := client.NewRelayPublisher(ctx)
+	msg := NewMessage(nil)
+	msg.To = "audit"
+	relay.Publish(ctx, msg)
+	if len(factory.published["audit"]) != 1 {
+		t.Errorf("expected the relay publisher to honour Message.To, published = %v", factory.published)
+	}
+}
+
+func TestClient_PublishMessageTo_Unsupported(t *testing.T) {
+	RegisterProvider("test-no-addressing-provider", &mockFactory{})
+	client, _ := NewClient(&Config{Provider: "test-no-addressing-provider", ConnectionString: "amqps://test", Topic: "t"})
+	if got := client.Capabilities().Addressing; got != Unsupported {
+		t.Errorf("Capabilities().Addressing = %v, want unsupported", got)
+	}
+
+	pub, _ := client.NewPublisher(context.Background())
+	msg := NewMessage(nil)
+	msg.To = "replies"
+	if err := pub.Publish(context.Background(), msg); !errors.Is(err, ErrUnsupportedProvider) {
+		t.Errorf("Publish() error = %v, want ErrUnsupportedProvider", err)
+	}
+}
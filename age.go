@@ -0,0 +1,74 @@
+package gokyu
+
+import (
+	"context"
+	"time"
+)
+
+// MetricMessageAge is the histogram of message age in seconds at the time a
+// message is received, i.e. how long it waited in the queue.
+const MetricMessageAge = "gokyu_message_age_seconds"
+
+// AgeOptions configures an age-reporting subscriber.
+type AgeOptions struct {
+	// Metrics records MetricMessageAge for every received message.
+	Metrics Metrics
+
+	// Subscription is reported in the "subscription" label so ages can be
+	// broken down per consumer. When empty, the label is left to Metrics
+	// (see Client.Metrics).
+	Subscription string
+
+	// SLO is the maximum acceptable message age. Zero disables OnBreach.
+	SLO time.Duration
+
+	// OnBreach is called for every message older than SLO.
+	OnBreach func(msg *Message, age time.Duration)
+
+	// Clock is the time source (default: SystemClock).
+	Clock Clock
+}
+
+// NewAgeSubscriber wraps a subscriber to report the age of every received
+// message (now minus Message.EnqueuedTime), so consumer lag can be alerted
+// on uniformly across providers. Messages without an enqueued time are
+// passed through unmeasured.
+func NewAgeSubscriber(sub Subscriber, opts AgeOptions) Subscriber {
+	if opts.Metrics == nil {
+		opts.Metrics = NopMetrics{}
+	}
+	if opts.Clock == nil {
+		opts.Clock = SystemClock
+	}
+	s := &ageSubscriber{Subscriber: sub, opts: opts}
+	if opts.Subscription != "" {
+		s.labels = map[string]string{LabelSubscription: opts.Subscription}
+	}
+	return s
+}
+
+// ageSubscriber measures message age on Receive.
+type ageSubscriber struct {
+	Subscriber
+	opts   AgeOptions
+	labels map[string]string
+}
+
+func (s *ageSubscriber) Receive(ctx context.Context) (*Message, error) {
+	msg, err := s.Subscriber.Receive(ctx)
+	if err != nil || msg.EnqueuedTime.IsZero() {
+		return msg, err
+	}
+
+	age := s.opts.Clock.Now().Sub(msg.EnqueuedTime)
+	if age < 0 {
+		// Clock skew between broker and client
+		age = 0
+	}
+	s.opts.Metrics.ObserveHistogram(MetricMessageAge, s.labels, age.Seconds())
+
+	if s.opts.SLO > 0 && age > s.opts.SLO && s.opts.OnBreach != nil {
+		s.opts.OnBreach(msg, age)
+	}
+	return msg, nil
+}
@@ -0,0 +1,44 @@
+package gokyu
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAgeSubscriber_Receive(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	fresh := NewMessage([]byte("fresh"))
+	fresh.EnqueuedTime = now.Add(-2 * time.Second)
+	stale := NewMessage([]byte("stale"))
+	stale.EnqueuedTime = now.Add(-time.Minute)
+	unknown := NewMessage([]byte("unknown"))
+
+	metrics := newCountingMetrics()
+	var breaches []time.Duration
+	sub := NewAgeSubscriber(&stubSubscriber{msgs: []*Message{fresh, stale, unknown}}, AgeOptions{
+		Metrics:      metrics,
+		Subscription: "billing",
+		SLO:          10 * time.Second,
+		OnBreach:     func(msg *Message, age time.Duration) { breaches = append(breaches, age) },
+		Clock:        NewFakeClock(now),
+	})
+
+	for i := 0; i < 3; i++ {
+		if _, err := sub.Receive(context.Background()); err != nil {
+			t.Fatalf("Receive() error = %v", err)
+		}
+	}
+
+	ages := metrics.histograms[MetricMessageAge]
+	if len(ages) != 2 || ages[0] != 2 || ages[1] != 60 {
+		t.Errorf("expected ages [2 60], got %v", ages)
+	}
+	if got := metrics.labels[MetricMessageAge]["subscription"]; got != "billing" {
+		t.Errorf("expected subscription label billing, got %q", got)
+	}
+	if len(breaches) != 1 || breaches[0] != time.Minute {
+		t.Errorf("expected one SLO breach of 1m, got %v", breaches)
+	}
+}
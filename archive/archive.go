@@ -0,0 +1,382 @@
+// Package archive tees consumed messages to object storage for replay and
+// analytics, and replays them into any provider.
+//
+// An Archiver buffers a sample of consumed messages in memory and writes
+// them in batches from its own goroutine, so a slow or failing store never
+// delays message handling: when the buffer is full, messages are dropped
+// from the archive (and counted) rather than blocking the consumer.
+//
+// # Layout
+//
+// Batches are written as JSON Lines objects, one Record per line, under keys
+// partitioned by provider, topic and UTC day:
+//
+//	<provider>/<topic>/<yyyy>/<mm>/<dd>/<yyyymmddThhmmss.nnnnnnnnnZ>-<seq>.jsonl
+//
+// Keys sort in archive order, so a day or a whole topic can be read back in
+// sequence with Store.List.
+//
+// # Replay
+//
+// Replay republishes archived messages through any publisher in archive
+// order, optionally with fresh IDs, original timestamps as properties, and
+// a rate limit:
+//
+//	n, err := archive.Replay(ctx, store, publisher, archive.ReplayOptions{
+//	    Prefix: archive.Prefix("azure", "orders", day),
+//	    NewIDs: true,
+//	    Rate:   100,
+//	})
+//
+// A Reader instead hands the messages of a time window to a handler, e.g. to
+// reprocess a day of events for an audit without touching live subscriptions:
+//
+//	err := archive.NewReader(store, "azure", "orders").ConsumeRange(ctx, from, to, handler)
+//
+// # Usage
+//
+//	archiver, err := archive.New(archive.DirStore("/var/lib/archive"), &archive.Config{
+//	    Provider:   "azure",
+//	    Topic:      "orders",
+//	    SampleRate: 0.1,
+//	})
+//	go archiver.Run(ctx)
+//	sub = archiver.Subscriber(sub) // archives messages once they are acked
+package archive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+)
+
+// Metric names recorded by an Archiver.
+const (
+	// MetricArchived counts messages written to the store.
+	MetricArchived = "gokyu_archive_messages_total"
+
+	// MetricDropped counts sampled messages that were not archived because
+	// the buffer was full or the store write failed.
+	MetricDropped = "gokyu_archive_dropped_total"
+)
+
+// Store is an object store holding archived batches. Implement it for S3,
+// Azure Blob Storage, GCS or another object store.
+type Store interface {
+	// Put writes an object, replacing any object with the same key.
+	Put(ctx context.Context, key string, data []byte) error
+
+	// Get reads an object.
+	Get(ctx context.Context, key string) ([]byte, error)
+
+	// List returns the keys of all objects starting with prefix, sorted.
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// DirStore is a Store keeping objects as files below a local directory,
+// for development and tests.
+type DirStore string
+
+// Put writes key as a file, creating parent directories as needed.
+func (d DirStore) Put(ctx context.Context, key string, data []byte) error {
+	name := filepath.Join(string(d), filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(name, data, 0o644)
+}
+
+// Get reads the file of key.
+func (d DirStore) Get(ctx context.Context, key string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(string(d), filepath.FromSlash(key)))
+}
+
+// List walks the directory for files whose key starts with prefix.
+func (d DirStore) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	err := filepath.WalkDir(string(d), func(name string, entry os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && name == string(d) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(string(d), name)
+		if err != nil {
+			return err
+		}
+		if key := filepath.ToSlash(rel); strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	sort.Strings(keys)
+	return keys, err
+}
+
+// Record is the archived representation of a message.
+type Record struct {
+	gokyu.ExportRecord
+
+	// EnqueuedTime is the broker enqueue time of the message, if known.
+	EnqueuedTime time.Time `json:"enqueued_time,omitempty"`
+
+	// ArchivedAt is when the message was handed to the archiver.
+	ArchivedAt time.Time `json:"archived_at"`
+}
+
+// Prefix returns the key prefix of the partition holding the messages of a
+// topic archived on the UTC day of t. With a zero t, it returns the prefix
+// of the whole topic.
+func Prefix(provider, topic string, t time.Time) string {
+	if t.IsZero() {
+		return path.Join(provider, topic) + "/"
+	}
+	return path.Join(provider, topic, t.UTC().Format("2006/01/02")) + "/"
+}
+
+// Config holds the configuration of an archiver.
+type Config struct {
+	// Provider and Topic name the partition messages are archived under.
+	// Topic may also be a queue name.
+	Provider string
+	Topic    string
+
+	// SampleRate is the fraction of messages archived, between 0 and 1
+	// (default: 1, every message).
+	SampleRate float64
+
+	// BatchSize is the maximum number of messages per object (default: 1000).
+	BatchSize int
+
+	// FlushInterval is the maximum time a message is buffered before its
+	// batch is written (default: 1m).
+	FlushInterval time.Duration
+
+	// BufferSize is the number of messages buffered for writing. Messages
+	// beyond it are dropped from the archive (default: 10000).
+	BufferSize int
+
+	// OnError is called when a batch cannot be written. Errors are
+	// otherwise ignored.
+	OnError func(err error)
+
+	// Metrics records MetricArchived and MetricDropped.
+	Metrics gokyu.Metrics
+
+	// Events receives gokyu.EventBufferFull when the buffer fills up and
+	// messages start being dropped, usually the bus of the client whose
+	// messages are archived (see gokyu.Config.Events).
+	Events *gokyu.EventBus
+
+	// Clock is the time source (default: gokyu.SystemClock).
+	Clock gokyu.Clock
+}
+
+// Archiver writes sampled messages to a Store in the background.
+type Archiver struct {
+	store  Store
+	cfg    Config
+	labels map[string]string
+	queue  chan *Record
+
+	mu  sync.Mutex
+	seq uint64
+
+	full atomic.Bool // the last message was dropped for a full buffer
+}
+
+// New creates an archiver writing to store. Call Run to start writing.
+func New(store Store, cfg *Config) (*Archiver, error) {
+	if cfg.Provider == "" || cfg.Topic == "" {
+		return nil, gokyu.ErrInvalidConfig("archive provider and topic are required")
+	}
+
+	c := *cfg
+	if c.SampleRate <= 0 {
+		c.SampleRate = 1
+	}
+	if c.BatchSize <= 0 {
+		c.BatchSize = 1000
+	}
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = time.Minute
+	}
+	if c.BufferSize <= 0 {
+		c.BufferSize = 10000
+	}
+	if c.Metrics == nil {
+		c.Metrics = gokyu.NopMetrics{}
+	}
+	if c.Clock == nil {
+		c.Clock = gokyu.SystemClock
+	}
+
+	return &Archiver{
+		store:  store,
+		cfg:    c,
+		labels: map[string]string{gokyu.LabelProvider: c.Provider, gokyu.LabelTopic: c.Topic},
+		queue:  make(chan *Record, c.BufferSize),
+	}, nil
+}
+
+// Archive queues msg for archiving if it is in the sample. It never blocks
+// and reports whether the message was queued.
+func (a *Archiver) Archive(msg *gokyu.Message) bool {
+	if a.cfg.SampleRate < 1 && rand.Float64() >= a.cfg.SampleRate {
+		return false
+	}
+
+	record, err := gokyu.NewExportRecord(msg)
+	if err != nil {
+		a.drop(1, fmt.Errorf("archive: message %s: %w", msg.ID, err))
+		return false
+	}
+
+	select {
+	case a.queue <- &Record{ExportRecord: *record, EnqueuedTime: msg.EnqueuedTime, ArchivedAt: a.cfg.Clock.Now()}:
+		a.full.Store(false)
+		return true
+	default:
+		a.drop(1, nil)
+		if !a.full.Swap(true) {
+			a.cfg.Events.Emit(gokyu.Event{
+				Type:     gokyu.EventBufferFull,
+				Provider: gokyu.Provider(a.cfg.Provider),
+				Topic:    a.cfg.Topic,
+				Message:  msg,
+				Detail:   "archive",
+			})
+		}
+		return false
+	}
+}
+
+// Subscriber wraps sub so that messages are archived once acknowledged.
+func (a *Archiver) Subscriber(sub gokyu.Subscriber) gokyu.Subscriber {
+	return &archivingSubscriber{Subscriber: sub, archiver: a}
+}
+
+// archivingSubscriber archives acknowledged messages.
+type archivingSubscriber struct {
+	gokyu.Subscriber
+	archiver *Archiver
+}
+
+func (s *archivingSubscriber) Ack(ctx context.Context, msg *gokyu.Message) error {
+	if err := s.Subscriber.Ack(ctx, msg); err != nil {
+		return err
+	}
+	s.archiver.Archive(msg)
+	return nil
+}
+
+// Run writes queued messages until the context is cancelled, then writes
+// what is still buffered and returns nil.
+func (a *Archiver) Run(ctx context.Context) error {
+	var err error
+	pprof.Do(ctx, pprof.Labels("gokyu", "archiver"), func(ctx context.Context) {
+		err = a.run(ctx)
+	})
+	return err
+}
+
+// run is the batching loop.
+func (a *Archiver) run(ctx context.Context) error {
+	var batch []*Record
+	flush := func(ctx context.Context) {
+		a.write(ctx, batch)
+		batch = nil
+	}
+
+	for {
+		timer := a.cfg.Clock.NewTimer(a.cfg.FlushInterval)
+		full := false
+		for !full {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				for {
+					select {
+					case record := <-a.queue:
+						batch = append(batch, record)
+						if len(batch) >= a.cfg.BatchSize {
+							flush(context.Background())
+						}
+					default:
+						flush(context.Background())
+						return nil
+					}
+				}
+			case record := <-a.queue:
+				batch = append(batch, record)
+				full = len(batch) >= a.cfg.BatchSize
+			case <-timer.C():
+				full = true
+			}
+		}
+		timer.Stop()
+		flush(ctx)
+	}
+}
+
+// write stores a batch, one object per day partition.
+func (a *Archiver) write(ctx context.Context, batch []*Record) {
+	for len(batch) > 0 {
+		prefix := Prefix(a.cfg.Provider, a.cfg.Topic, batch[0].ArchivedAt)
+		n := 1
+		for n < len(batch) && Prefix(a.cfg.Provider, a.cfg.Topic, batch[n].ArchivedAt) == prefix {
+			n++
+		}
+		a.writeObject(ctx, prefix, batch[:n])
+		batch = batch[n:]
+	}
+}
+
+// writeObject stores records as a single JSON Lines object.
+func (a *Archiver) writeObject(ctx context.Context, prefix string, records []*Record) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, record := range records {
+		if err := enc.Encode(record); err != nil {
+			a.drop(len(records), fmt.Errorf("archive: encode: %w", err))
+			return
+		}
+	}
+
+	a.mu.Lock()
+	a.seq++
+	seq := a.seq
+	a.mu.Unlock()
+
+	key := fmt.Sprintf("%s%s-%06d.jsonl", prefix, records[0].ArchivedAt.UTC().Format("20060102T150405.000000000Z"), seq)
+	if err := a.store.Put(ctx, key, buf.Bytes()); err != nil {
+		a.drop(len(records), fmt.Errorf("archive: write %s: %w", key, err))
+		return
+	}
+	a.cfg.Metrics.IncCounter(MetricArchived, a.labels, float64(len(records)))
+}
+
+// drop counts messages that were not archived and reports err, if any.
+func (a *Archiver) drop(n int, err error) {
+	a.cfg.Metrics.IncCounter(MetricDropped, a.labels, float64(n))
+	if err != nil && a.cfg.OnError != nil {
+		a.cfg.OnError(err)
+	}
+}
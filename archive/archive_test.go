@@ -0,0 +1,194 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+)
+
+// archivedRecords reads all records stored below prefix.
+func archivedRecords(t *testing.T, store Store, prefix string) ([]string, []Record) {
+	t.Helper()
+	ctx := context.Background()
+	keys, err := store.List(ctx, prefix)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	var records []Record
+	for _, key := range keys {
+		data, err := store.Get(ctx, key)
+		if err != nil {
+			t.Fatalf("Get(%s) error = %v", key, err)
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			var record Record
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				t.Fatalf("invalid record in %s: %v", key, err)
+			}
+			records = append(records, record)
+		}
+	}
+	return keys, records
+}
+
+func TestArchiver_WritesPartitionedBatches(t *testing.T) {
+	store := DirStore(t.TempDir())
+	clock := gokyu.NewFakeClock(time.Date(2024, 3, 1, 23, 59, 0, 0, time.UTC))
+	archiver, err := New(store, &Config{Provider: "azure", Topic: "orders", BatchSize: 2, Clock: clock})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	msg := gokyu.NewMessage([]byte("first"))
+	msg.ID = "m1"
+	msg.Properties["n"] = int64(1)
+	archiver.Archive(msg)
+	archiver.Archive(gokyu.NewMessage([]byte("second")))
+	clock.Advance(2 * time.Minute) // next day
+	archiver.Archive(gokyu.NewMessage([]byte("third")))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := archiver.Run(ctx); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	keys, records := archivedRecords(t, store, "azure/orders/")
+	if len(keys) != 2 || !strings.HasPrefix(keys[0], "azure/orders/2024/03/01/") || !strings.HasPrefix(keys[1], "azure/orders/2024/03/02/") {
+		t.Errorf("expected one object per day, got %v", keys)
+	}
+	if len(records) != 3 {
+		t.Fatalf("expected 3 records, got %d", len(records))
+	}
+	got, err := records[0].Message()
+	if err != nil {
+		t.Fatalf("Message() error = %v", err)
+	}
+	if got.ID != "m1" || string(got.Body) != "first" || got.Properties["n"] != int64(1) {
+		t.Errorf("unexpected archived message %+v", got)
+	}
+}
+
+func TestArchiver_FlushInterval(t *testing.T) {
+	store := DirStore(t.TempDir())
+	clock := gokyu.NewFakeClock(time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC))
+	archiver, _ := New(store, &Config{Provider: "azure", Topic: "orders", FlushInterval: time.Minute, Clock: clock})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- archiver.Run(ctx) }()
+
+	archiver.Archive(gokyu.NewMessage([]byte("a")))
+	for clock.Timers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(time.Minute)
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if keys, _ := store.List(context.Background(), ""); len(keys) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected batch written after the flush interval")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	<-done
+}
+
+func TestArchiver_SubscriberArchivesAcked(t *testing.T) {
+	store := DirStore(t.TempDir())
+	archiver, _ := New(store, &Config{Provider: "amazonmq", Topic: "jobs"})
+	sub := archiver.Subscriber(&stubSubscriber{})
+	ctx := context.Background()
+
+	sub.Ack(ctx, gokyu.NewMessage([]byte("done")))
+	sub.Nack(ctx, gokyu.NewMessage([]byte("retry")))
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	archiver.Run(cancelled)
+
+	_, records := archivedRecords(t, store, Prefix("amazonmq", "jobs", time.Time{}))
+	if len(records) != 1 || string(records[0].Body) != "done" {
+		t.Errorf("expected only the acked message archived, got %+v", records)
+	}
+}
+
+func TestArchiver_DropsWhenBufferFull(t *testing.T) {
+	var errs []error
+	archiver, _ := New(failingStore{}, &Config{
+		Provider:   "azure",
+		Topic:      "orders",
+		BufferSize: 1,
+		OnError:    func(err error) { errs = append(errs, err) },
+	})
+
+	if !archiver.Archive(gokyu.NewMessage(nil)) {
+		t.Error("expected first message queued")
+	}
+	if archiver.Archive(gokyu.NewMessage(nil)) {
+		t.Error("expected message dropped when the buffer is full")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	archiver.Run(ctx)
+	if len(errs) != 1 {
+		t.Errorf("expected write error reported, got %v", errs)
+	}
+}
+
+func TestArchiver_BufferFullEvent(t *testing.T) {
+	bus := gokyu.NewEventBus()
+	events := bus.Subscribe(0)
+	archiver, _ := New(failingStore{}, &Config{
+		Provider:   "azure",
+		Topic:      "orders",
+		BufferSize: 1,
+		Events:     bus,
+	})
+
+	archiver.Archive(gokyu.NewMessage(nil))
+	dropped := gokyu.NewMessage(nil)
+	archiver.Archive(dropped)
+	archiver.Archive(gokyu.NewMessage(nil))
+
+	select {
+	case ev := <-events:
+		if ev.Type != gokyu.EventBufferFull || ev.Message != dropped || ev.Topic != "orders" || ev.Detail != "archive" {
+			t.Errorf("event = %+v", ev)
+		}
+	default:
+		t.Fatal("expected buffer-full event")
+	}
+	select {
+	case ev := <-events:
+		t.Errorf("expected one event while the buffer stays full, got %+v", ev)
+	default:
+	}
+}
+
+type stubSubscriber struct{}
+
+func (s *stubSubscriber) Receive(ctx context.Context) (*gokyu.Message, error) { return nil, nil }
+func (s *stubSubscriber) Ack(ctx context.Context, msg *gokyu.Message) error   { return nil }
+func (s *stubSubscriber) Nack(ctx context.Context, msg *gokyu.Message) error  { return nil }
+func (s *stubSubscriber) Close(ctx context.Context) error                     { return nil }
+
+type failingStore struct{ DirStore }
+
+func (failingStore) Put(ctx context.Context, key string, data []byte) error {
+	return errors.New("store unavailable")
+}
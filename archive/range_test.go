@@ -0,0 +1,47 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+)
+
+var _ gokyu.RangeConsumer = (*Reader)(nil)
+
+func TestReader_ConsumeRange(t *testing.T) {
+	store := DirStore(t.TempDir())
+	// Archived a minute apart across midnight
+	start := time.Date(2024, 3, 1, 23, 58, 0, 0, time.UTC)
+	archiveMessages(t, store, start, "a", "b", "c", "d", "e")
+
+	var ids []string
+	reader := NewReader(store, "azure", "orders")
+	err := reader.ConsumeRange(context.Background(), start.Add(time.Minute), start.Add(4*time.Minute), func(ctx context.Context, msg *gokyu.Message) error {
+		ids = append(ids, msg.ID)
+		if _, ok := msg.Properties[PropertyArchivedAt]; !ok || msg.EnqueuedTime.IsZero() {
+			t.Errorf("message %s lacks its timestamps", msg.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ConsumeRange() error = %v", err)
+	}
+	if len(ids) != 3 || ids[0] != "b" || ids[1] != "c" || ids[2] != "d" {
+		t.Errorf("consumed %v, want [b c d]", ids)
+	}
+
+	failed := errors.New("audit failed")
+	err = reader.ConsumeRange(context.Background(), start, start.Add(time.Hour), func(ctx context.Context, msg *gokyu.Message) error {
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Errorf("ConsumeRange() error = %v, want the handler error", err)
+	}
+
+	if err := reader.ConsumeRange(context.Background(), start, start, nil); err == nil {
+		t.Error("expected an empty range to be rejected")
+	}
+}
@@ -0,0 +1,157 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+)
+
+// Properties set on replayed messages.
+const (
+	// PropertyOriginalID holds the archived message ID when ReplayOptions.NewIDs is set.
+	PropertyOriginalID = "gokyu-original-id"
+
+	// PropertyOriginalEnqueuedTime holds the broker enqueue time of the
+	// archived message when ReplayOptions.KeepTimestamps is set.
+	PropertyOriginalEnqueuedTime = "gokyu-original-enqueued-time"
+
+	// PropertyArchivedAt holds the archive time of the message when
+	// ReplayOptions.KeepTimestamps is set.
+	PropertyArchivedAt = "gokyu-archived-at"
+)
+
+// ReplayOptions configures Replay.
+type ReplayOptions struct {
+	// Prefix selects the objects to replay, usually a result of Prefix.
+	Prefix string
+
+	// From and To restrict the replay to messages archived in [From, To).
+	// Zero values leave the range open.
+	From, To time.Time
+
+	// NewIDs assigns fresh message IDs (see gokyu.NewUUIDv7) and keeps the
+	// archived ID in PropertyOriginalID, so broker duplicate detection does
+	// not discard the replay.
+	NewIDs bool
+
+	// KeepTimestamps records the original enqueue and archive times in
+	// PropertyOriginalEnqueuedTime and PropertyArchivedAt.
+	KeepTimestamps bool
+
+	// Rewrite is called for every message before it is published, after
+	// NewIDs and KeepTimestamps are applied. Returning false skips the
+	// message.
+	Rewrite func(msg *gokyu.Message, record *Record) bool
+
+	// Rate limits the replay to this many messages per second. Zero means
+	// no limit.
+	Rate float64
+
+	// Clock is the time source for rate limiting (default: gokyu.SystemClock).
+	Clock gokyu.Clock
+}
+
+// Replay republishes archived messages through pub, in archive order, and
+// returns the number of messages published. Replays of the same objects and
+// options publish the same messages in the same order.
+func Replay(ctx context.Context, store Store, pub gokyu.Publisher, opts ReplayOptions) (int, error) {
+	if opts.Rate > 0 {
+		pub = gokyu.NewQuotaPublisher(pub, gokyu.Quota{
+			MaxMessagesPerSecond: opts.Rate,
+			Wait:                 true,
+			Clock:                opts.Clock,
+		})
+	}
+
+	n := 0
+	err := scanRecords(ctx, store, opts.Prefix, opts.From, opts.To, func(key string, line int, record *Record) error {
+		msg, err := replayMessage(record, opts)
+		if err != nil {
+			return fmt.Errorf("archive: record %s:%d: %w", key, line, err)
+		}
+		if msg == nil {
+			return nil
+		}
+		if err := pub.Publish(ctx, msg); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	return n, err
+}
+
+// scanRecords calls fn, in archive order, for the records below prefix that
+// were archived in [from, to). Zero times leave the range open. Errors of fn
+// stop the scan and are returned as they are.
+func scanRecords(ctx context.Context, store Store, prefix string, from, to time.Time, fn func(key string, line int, record *Record) error) error {
+	keys, err := store.List(ctx, prefix)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		data, err := store.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 64*1024), 256*1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			if len(scanner.Bytes()) == 0 {
+				continue
+			}
+
+			var record Record
+			if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+				return fmt.Errorf("archive: invalid record %s:%d: %w", key, line, err)
+			}
+			if !from.IsZero() && record.ArchivedAt.Before(from) {
+				continue
+			}
+			if !to.IsZero() && !record.ArchivedAt.Before(to) {
+				continue
+			}
+			if err := fn(key, line, &record); err != nil {
+				return err
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("archive: read %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// replayMessage converts a record into the message to republish, or nil if
+// Rewrite skips it.
+func replayMessage(record *Record, opts ReplayOptions) (*gokyu.Message, error) {
+	msg, err := record.Message()
+	if err != nil {
+		return nil, err
+	}
+	msg.EnqueuedTime = record.EnqueuedTime
+
+	if opts.NewIDs {
+		if msg.ID != "" {
+			msg.Properties[PropertyOriginalID] = msg.ID
+		}
+		msg.ID = gokyu.NewUUIDv7()
+	}
+	if opts.KeepTimestamps {
+		if !record.EnqueuedTime.IsZero() {
+			msg.Properties[PropertyOriginalEnqueuedTime] = record.EnqueuedTime
+		}
+		msg.Properties[PropertyArchivedAt] = record.ArchivedAt
+	}
+	if opts.Rewrite != nil && !opts.Rewrite(msg, record) {
+		return nil, nil
+	}
+	return msg, nil
+}
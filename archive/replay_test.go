@@ -0,0 +1,115 @@
+package archive
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+)
+
+// recordingPublisher records published messages.
+type recordingPublisher struct {
+	published []*gokyu.Message
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, msg *gokyu.Message) error {
+	p.published = append(p.published, msg)
+	return nil
+}
+
+func (p *recordingPublisher) Close(ctx context.Context) error { return nil }
+
+// archiveMessages archives one message per body, a minute apart.
+func archiveMessages(t *testing.T, store Store, start time.Time, bodies ...string) {
+	t.Helper()
+	clock := gokyu.NewFakeClock(start)
+	archiver, err := New(store, &Config{Provider: "azure", Topic: "orders", Clock: clock})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	for i, body := range bodies {
+		msg := gokyu.NewMessage([]byte(body))
+		msg.ID = body
+		msg.EnqueuedTime = clock.Now().Add(-time.Second)
+		archiver.Archive(msg)
+		if i < len(bodies)-1 {
+			clock.Advance(time.Minute)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	archiver.Run(ctx)
+}
+
+func TestReplay(t *testing.T) {
+	store := DirStore(t.TempDir())
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	archiveMessages(t, store, start, "a", "b", "c", "d")
+
+	pub := &recordingPublisher{}
+	n, err := Replay(context.Background(), store, pub, ReplayOptions{
+		Prefix: Prefix("azure", "orders", start),
+		From:   start.Add(time.Minute),
+		Rewrite: func(msg *gokyu.Message, record *Record) bool {
+			return record.ID != "d"
+		},
+	})
+	if err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if n != 2 || len(pub.published) != 2 {
+		t.Fatalf("expected 2 messages replayed, got %d", n)
+	}
+	if pub.published[0].ID != "b" || pub.published[1].ID != "c" {
+		t.Errorf("expected b, c in archive order, got %s, %s", pub.published[0].ID, pub.published[1].ID)
+	}
+}
+
+func TestReplay_NewIDsAndTimestamps(t *testing.T) {
+	store := DirStore(t.TempDir())
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	archiveMessages(t, store, start, "a")
+
+	pub := &recordingPublisher{}
+	if _, err := Replay(context.Background(), store, pub, ReplayOptions{NewIDs: true, KeepTimestamps: true}); err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+
+	msg := pub.published[0]
+	if msg.ID == "a" || msg.Properties[PropertyOriginalID] != "a" {
+		t.Errorf("expected new ID with original kept, got %q, %v", msg.ID, msg.Properties[PropertyOriginalID])
+	}
+	if got, _ := msg.Properties[PropertyArchivedAt].(time.Time); !got.Equal(start) {
+		t.Errorf("expected archive time %v, got %v", start, msg.Properties[PropertyArchivedAt])
+	}
+	if got, _ := msg.Properties[PropertyOriginalEnqueuedTime].(time.Time); !got.Equal(start.Add(-time.Second)) {
+		t.Errorf("expected original enqueued time, got %v", msg.Properties[PropertyOriginalEnqueuedTime])
+	}
+}
+
+func TestReplay_Rate(t *testing.T) {
+	store := DirStore(t.TempDir())
+	archiveMessages(t, store, time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC), "a", "b", "c")
+
+	clock := gokyu.NewFakeClock(time.Now())
+	pub := &recordingPublisher{}
+	done := make(chan error, 1)
+	go func() {
+		_, err := Replay(context.Background(), store, pub, ReplayOptions{Rate: 1, Clock: clock})
+		done <- err
+	}()
+
+	for i := 0; i < 2; i++ {
+		for clock.Timers() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		clock.Advance(time.Second)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Replay() error = %v", err)
+	}
+	if len(pub.published) != 3 {
+		t.Errorf("expected 3 messages replayed, got %d", len(pub.published))
+	}
+}
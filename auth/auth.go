@@ -0,0 +1,179 @@
+// Package auth authorizes requests to gokyu's HTTP surfaces: the sidecar,
+// its web UI and the httpingest handler. Exposing these on a network
+// otherwise hands the broker to anyone who can reach them.
+//
+// An Authorizer checks one kind of credential:
+//   - APIKeys accepts static keys sent as bearer tokens or in the
+//     Gokyu-Api-Key header.
+//   - ClientCert accepts verified TLS client certificates (mTLS),
+//     optionally restricted to a set of names.
+//   - OIDC accepts JWTs issued by an OpenID Connect provider.
+//
+// Any combines authorizers and Middleware protects an http.Handler.
+//
+// # Usage
+//
+//	keys, err := auth.LoadAPIKeys("/etc/gokyu/api-keys")
+//	oidc, err := auth.NewOIDC(auth.OIDCConfig{
+//	    Issuer:   "https://login.example.com",
+//	    Audience: "gokyu",
+//	})
+//	authorizer := auth.Any(keys, oidc)
+//
+//	http.Handle("/", auth.Middleware(authorizer, sidecar.NewServer(pub, sub)))
+//	http.Handle("/events", httpingest.NewHandler(pub, &httpingest.Config{
+//	    Authenticate: authorizer.Authorize,
+//	}))
+package auth
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// HeaderAPIKey carries an API key as an alternative to a bearer token.
+const HeaderAPIKey = "Gokyu-Api-Key"
+
+var (
+	// ErrUnauthorized indicates a request carries no valid credentials.
+	// HTTP surfaces respond with 401 Unauthorized.
+	ErrUnauthorized = errors.New("auth: unauthorized")
+
+	// ErrForbidden indicates valid credentials that are not allowed.
+	// HTTP surfaces respond with 403 Forbidden.
+	ErrForbidden = errors.New("auth: forbidden")
+)
+
+// Authorizer decides whether a request may proceed.
+type Authorizer interface {
+	// Authorize returns nil to allow the request, an error wrapping
+	// ErrUnauthorized if it carries no valid credentials, or any other error
+	// to forbid it.
+	Authorize(r *http.Request) error
+}
+
+// AuthorizerFunc adapts a function to the Authorizer interface.
+type AuthorizerFunc func(r *http.Request) error
+
+// Authorize calls f(r).
+func (f AuthorizerFunc) Authorize(r *http.Request) error {
+	return f(r)
+}
+
+// Middleware rejects requests denied by a with 401 or 403 and a JSON error
+// body, and passes the others to next.
+func Middleware(a Authorizer, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := a.Authorize(r); err != nil {
+			status := http.StatusForbidden
+			if errors.Is(err, ErrUnauthorized) {
+				status = http.StatusUnauthorized
+				w.Header().Set("WWW-Authenticate", "Bearer")
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Any allows requests allowed by any of the authorizers. If all deny, it
+// returns the first error that does not wrap ErrUnauthorized, so a request
+// with valid but insufficient credentials is forbidden rather than
+// unauthorized.
+func Any(authorizers ...Authorizer) Authorizer {
+	return AuthorizerFunc(func(r *http.Request) error {
+		err := ErrUnauthorized
+		for _, a := range authorizers {
+			e := a.Authorize(r)
+			if e == nil {
+				return nil
+			}
+			if errors.Is(err, ErrUnauthorized) && !errors.Is(e, ErrUnauthorized) {
+				err = e
+			}
+		}
+		return err
+	})
+}
+
+// bearerToken returns the token of an "Authorization: Bearer" header.
+func bearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// apiKeys holds the SHA-256 digests of the accepted keys.
+type apiKeys [][sha256.Size]byte
+
+// APIKeys returns an authorizer that accepts requests carrying one of the
+// keys as a bearer token or in the Gokyu-Api-Key header.
+func APIKeys(keys ...string) Authorizer {
+	digests := make(apiKeys, 0, len(keys))
+	for _, key := range keys {
+		if key != "" {
+			digests = append(digests, sha256.Sum256([]byte(key)))
+		}
+	}
+	return digests
+}
+
+// LoadAPIKeys reads API keys from a file with one key per line. Blank lines
+// and lines starting with # are ignored.
+func LoadAPIKeys(path string) (Authorizer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var keys []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			keys = append(keys, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("auth: no API keys in %s", path)
+	}
+	return APIKeys(keys...), nil
+}
+
+// Authorize implements Authorizer.
+func (k apiKeys) Authorize(r *http.Request) error {
+	key := r.Header.Get(HeaderAPIKey)
+	if key == "" {
+		key = bearerToken(r)
+	}
+	if key == "" {
+		return fmt.Errorf("%w: missing API key", ErrUnauthorized)
+	}
+
+	// Compare against every key so timing does not reveal which matched
+	digest := sha256.Sum256([]byte(key))
+	match := 0
+	for i := range k {
+		match |= subtle.ConstantTimeCompare(digest[:], k[i][:])
+	}
+	if match == 0 {
+		return fmt.Errorf("%w: invalid API key", ErrUnauthorized)
+	}
+	return nil
+}
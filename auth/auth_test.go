@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAPIKeys(t *testing.T) {
+	a := APIKeys("k1", "k2")
+
+	tests := []struct {
+		name    string
+		header  string
+		value   string
+		wantErr error
+	}{
+		{name: "bearer", header: "Authorization", value: "Bearer k2"},
+		{name: "api key header", header: HeaderAPIKey, value: "k1"},
+		{name: "wrong key", header: "Authorization", value: "Bearer k3", wantErr: ErrUnauthorized},
+		{name: "basic auth", header: "Authorization", value: "Basic azE6", wantErr: ErrUnauthorized},
+		{name: "missing", wantErr: ErrUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				r.Header.Set(tt.header, tt.value)
+			}
+			err := a.Authorize(r)
+			if tt.wantErr == nil && err != nil || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Authorize() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadAPIKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys")
+	os.WriteFile(path, []byte("# partners\nk1\n\n  k2  \n"), 0o600)
+
+	a, err := LoadAPIKeys(path)
+	if err != nil {
+		t.Fatalf("LoadAPIKeys() error = %v", err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(HeaderAPIKey, "k2")
+	if err := a.Authorize(r); err != nil {
+		t.Errorf("Authorize() error = %v", err)
+	}
+
+	os.WriteFile(path, []byte("# none\n"), 0o600)
+	if _, err := LoadAPIKeys(path); err == nil {
+		t.Error("expected an error for a file without keys")
+	}
+}
+
+func TestClientCert(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://example.org/billing")
+	cert := &x509.Certificate{
+		Subject:  pkix.Name{CommonName: "orders"},
+		DNSNames: []string{"orders.internal"},
+		URIs:     []*url.URL{spiffe},
+	}
+	verified := &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+
+	tests := []struct {
+		name    string
+		names   []string
+		state   *tls.ConnectionState
+		wantErr error
+	}{
+		{name: "any verified certificate", state: verified},
+		{name: "common name", names: []string{"orders"}, state: verified},
+		{name: "dns name", names: []string{"orders.internal"}, state: verified},
+		{name: "uri", names: []string{"spiffe://example.org/billing"}, state: verified},
+		{name: "not allowed", names: []string{"payments"}, state: verified, wantErr: ErrForbidden},
+		{name: "no certificate", state: &tls.ConnectionState{}, wantErr: ErrUnauthorized},
+		{name: "plain http", wantErr: ErrUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.TLS = tt.state
+			err := ClientCert(tt.names...).Authorize(r)
+			if tt.wantErr == nil && err != nil || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Authorize() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAny(t *testing.T) {
+	forbid := AuthorizerFunc(func(r *http.Request) error { return ErrForbidden })
+	a := Any(APIKeys("k1"), ClientCert())
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set(HeaderAPIKey, "k1")
+	if err := a.Authorize(r); err != nil {
+		t.Errorf("expected the API key to be accepted, got %v", err)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	if err := a.Authorize(r); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("expected ErrUnauthorized, got %v", err)
+	}
+	if err := Any(APIKeys("k1"), forbid).Authorize(r); !errors.Is(err, ErrForbidden) {
+		t.Errorf("expected ErrForbidden to take precedence, got %v", err)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	h := Middleware(Any(APIKeys("k1"), AuthorizerFunc(func(r *http.Request) error {
+		if r.Header.Get(HeaderAPIKey) == "k2" {
+			return ErrForbidden
+		}
+		return ErrUnauthorized
+	})), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		key        string
+		wantStatus int
+	}{
+		{key: "k1", wantStatus: http.StatusNoContent},
+		{key: "k2", wantStatus: http.StatusForbidden},
+		{key: "", wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(HeaderAPIKey, tt.key)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if rec.Code != tt.wantStatus {
+			t.Errorf("key %q: expected status %d, got %d", tt.key, tt.wantStatus, rec.Code)
+		}
+		if tt.wantStatus == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+			t.Error("expected a WWW-Authenticate challenge")
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// ClientCert returns an authorizer that accepts requests over TLS with a
+// client certificate verified by the server, i.e. a tls.Config with
+// ClientAuth set to tls.VerifyClientCertIfGiven or stricter (see
+// ServerTLSConfig).
+//
+// If names are given, the certificate's common name, a DNS name or a URI
+// (e.g. a SPIFFE ID) must be one of them.
+func ClientCert(names ...string) Authorizer {
+	allowed := make(map[string]bool, len(names))
+	for _, name := range names {
+		allowed[name] = true
+	}
+
+	return AuthorizerFunc(func(r *http.Request) error {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+			return fmt.Errorf("%w: missing client certificate", ErrUnauthorized)
+		}
+		if len(allowed) == 0 {
+			return nil
+		}
+
+		cert := r.TLS.VerifiedChains[0][0]
+		if allowed[cert.Subject.CommonName] {
+			return nil
+		}
+		for _, name := range cert.DNSNames {
+			if allowed[name] {
+				return nil
+			}
+		}
+		for _, uri := range cert.URIs {
+			if allowed[uri.String()] {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: client certificate %q is not allowed", ErrForbidden, cert.Subject.CommonName)
+	})
+}
+
+// ServerTLSConfig loads a server certificate and, if clientCAFile is set,
+// verifies client certificates against the CAs in it. Clients without a
+// certificate can still connect so that other authorizers may accept them;
+// use ClientCert to require one.
+func ServerTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if clientCAFile != "" {
+		pem, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("auth: no certificates in %s", clientCAFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return cfg, nil
+}
@@ -0,0 +1,408 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256" // Register hashes used by JWT algorithms
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+)
+
+// minKeyRefresh limits how often an unknown key ID triggers a key set fetch.
+const minKeyRefresh = time.Minute
+
+// OIDCConfig configures an OIDC authorizer.
+type OIDCConfig struct {
+	// Issuer is the issuer URL of the provider. Tokens must carry it in
+	// their iss claim.
+	Issuer string
+
+	// Audience must be one of the token's aud claims, typically the client
+	// ID registered for gokyu.
+	Audience string
+
+	// JWKSURL is the URL of the provider's signing keys (default: the
+	// jwks_uri of the issuer's /.well-known/openid-configuration).
+	JWKSURL string
+
+	// Authorize is called with the claims of every valid token, e.g. to
+	// check scopes or groups. Returning an error forbids the request.
+	Authorize func(claims map[string]interface{}) error
+
+	// Leeway tolerates clock skew when checking exp and nbf (default: 1m).
+	Leeway time.Duration
+
+	// HTTPClient fetches the provider's keys (default: a client with a 10s timeout).
+	HTTPClient *http.Client
+
+	// Clock is the time source (default: gokyu.SystemClock).
+	Clock gokyu.Clock
+}
+
+// OIDC authorizes requests carrying a JWT issued by an OpenID Connect
+// provider as a bearer token. RS256, RS384, RS512, ES256, ES384 and ES512
+// signatures are supported. Keys are fetched on first use and again when a
+// token is signed with an unknown key, at most once per minute whether or
+// not the fetch succeeds.
+type OIDC struct {
+	cfg OIDCConfig
+
+	mu       sync.Mutex
+	keys     map[string]crypto.PublicKey
+	fetched  time.Time     // last completed fetch
+	fetchErr error         // error of the last completed fetch
+	fetching chan struct{} // closed when the fetch in flight completes
+}
+
+// NewOIDC creates an OIDC authorizer.
+func NewOIDC(cfg OIDCConfig) (*OIDC, error) {
+	if cfg.Issuer == "" {
+		return nil, gokyu.ErrInvalidConfig("oidc issuer is required")
+	}
+	if cfg.Audience == "" {
+		return nil, gokyu.ErrInvalidConfig("oidc audience is required")
+	}
+	if cfg.Leeway <= 0 {
+		cfg.Leeway = time.Minute
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = gokyu.SystemClock
+	}
+	return &OIDC{cfg: cfg}, nil
+}
+
+// Authorize implements Authorizer.
+func (o *OIDC) Authorize(r *http.Request) error {
+	token := bearerToken(r)
+	if token == "" {
+		return fmt.Errorf("%w: missing bearer token", ErrUnauthorized)
+	}
+	claims, err := o.Verify(r.Context(), token)
+	if err != nil {
+		return err
+	}
+	if o.cfg.Authorize != nil {
+		if err := o.cfg.Authorize(claims); err != nil {
+			return fmt.Errorf("%w: %v", ErrForbidden, err)
+		}
+	}
+	return nil
+}
+
+// Verify checks the signature, issuer, audience and lifetime of a token
+// and returns its claims. Invalid tokens result in an error wrapping
+// ErrUnauthorized.
+func (o *OIDC) Verify(ctx context.Context, token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrUnauthorized)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: malformed token header", ErrUnauthorized)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed token signature", ErrUnauthorized)
+	}
+
+	key, err := o.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnauthorized, err)
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed token claims", ErrUnauthorized)
+	}
+	if err := o.checkClaims(claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnauthorized, err)
+	}
+	return claims, nil
+}
+
+// checkClaims checks the registered claims of a token.
+func (o *OIDC) checkClaims(claims map[string]interface{}) error {
+	if iss, _ := claims["iss"].(string); strings.TrimSuffix(iss, "/") != strings.TrimSuffix(o.cfg.Issuer, "/") {
+		return fmt.Errorf("unexpected issuer %q", iss)
+	}
+
+	audienceOK := false
+	switch aud := claims["aud"].(type) {
+	case string:
+		audienceOK = aud == o.cfg.Audience
+	case []interface{}:
+		for _, a := range aud {
+			if a == o.cfg.Audience {
+				audienceOK = true
+			}
+		}
+	}
+	if !audienceOK {
+		return errors.New("token is not intended for this audience")
+	}
+
+	now := o.cfg.Clock.Now()
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return errors.New("token has no expiry")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(o.cfg.Leeway)) {
+		return errors.New("token has expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(o.cfg.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return errors.New("token is not valid yet")
+	}
+	return nil
+}
+
+// key returns the signing key with the given ID, fetching the key set if it
+// is unknown. Concurrent requests share one fetch, made without holding
+// o.mu so that requests for known keys are not held up.
+func (o *OIDC) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	for {
+		o.mu.Lock()
+		if key, ok := o.lookup(kid); ok {
+			o.mu.Unlock()
+			return key, nil
+		}
+		if fetching := o.fetching; fetching != nil {
+			o.mu.Unlock()
+			select {
+			case <-fetching:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		if !o.fetched.IsZero() && o.cfg.Clock.Now().Sub(o.fetched) < minKeyRefresh {
+			err := o.fetchErr
+			o.mu.Unlock()
+			if err != nil {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%w: unknown signing key %q", ErrUnauthorized, kid)
+		}
+		fetching := make(chan struct{})
+		o.fetching = fetching
+		o.mu.Unlock()
+
+		keys, err := o.fetchKeys(ctx)
+
+		o.mu.Lock()
+		o.fetching = nil
+		close(fetching)
+		// A fetch abandoned by its caller says nothing about the provider
+		if ctx.Err() == nil {
+			o.fetched, o.fetchErr = o.cfg.Clock.Now(), err
+			if err == nil {
+				o.keys = keys
+			}
+		}
+		o.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// lookup finds a cached key. Tokens without a key ID are accepted if the
+// key set has a single key.
+func (o *OIDC) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(o.keys) == 1 {
+		for _, key := range o.keys {
+			return key, true
+		}
+	}
+	key, ok := o.keys[kid]
+	return key, ok
+}
+
+// fetchKeys downloads the provider's key set.
+func (o *OIDC) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	jwksURL := o.cfg.JWKSURL
+	if jwksURL == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := o.getJSON(ctx, strings.TrimSuffix(o.cfg.Issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+			return nil, err
+		}
+		if discovery.JWKSURI == "" {
+			return nil, errors.New("auth: oidc discovery document has no jwks_uri")
+		}
+		jwksURL = discovery.JWKSURI
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := o.getJSON(ctx, jwksURL, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		// Skip keys of unsupported types rather than failing the whole set
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+// getJSON fetches and decodes a JSON document.
+func (o *OIDC) getJSON(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := o.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("auth: fetch %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("auth: fetch %s: %s", url, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("auth: decode %s: %w", url, err)
+	}
+	return nil
+}
+
+// jsonWebKey is a public key in a JSON Web Key Set.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey converts an RSA or EC key.
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// verifySignature verifies a JWS signature.
+func verifySignature(alg string, key crypto.PublicKey, signed, signature []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "ES512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if alg[0] != 'R' {
+			return fmt.Errorf("algorithm %s does not match an RSA key", alg)
+		}
+		if err := rsa.VerifyPKCS1v15(key, hash, digest, signature); err != nil {
+			return errors.New("invalid signature")
+		}
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if alg[0] != 'E' || len(signature) != 2*size {
+			return fmt.Errorf("algorithm %s does not match an EC key", alg)
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return errors.New("invalid signature")
+		}
+	default:
+		return errors.New("unsupported key")
+	}
+	return nil
+}
+
+// decodeSegment decodes a base64url-encoded JSON token segment.
+func decodeSegment(s string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// decodeInt decodes a base64url-encoded big-endian integer.
+func decodeInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(data) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,268 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+)
+
+// testProvider is an OIDC provider serving discovery and a key set.
+type testProvider struct {
+	server  *httptest.Server
+	rsaKey  *rsa.PrivateKey
+	ecKey   *ecdsa.PrivateKey
+	fetches atomic.Int32
+
+	// failing makes key set requests fail; hold makes them wait for
+	// release to be closed.
+	failing atomic.Bool
+	hold    atomic.Bool
+	release chan struct{}
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	t.Helper()
+	p := &testProvider{release: make(chan struct{})}
+	p.rsaKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+	p.ecKey, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"jwks_uri": p.server.URL + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		p.fetches.Add(1)
+		if p.hold.Load() {
+			<-p.release
+		}
+		if p.failing.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa", "use": "sig", "n": b64(p.rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(p.rsaKey.E)).Bytes())},
+			{"kty": "EC", "kid": "ec", "crv": "P-256", "x": b64(p.ecKey.X.FillBytes(make([]byte, 32))), "y": b64(p.ecKey.Y.FillBytes(make([]byte, 32)))},
+			{"kty": "oct", "kid": "hmac", "k": "c2VjcmV0"},
+		}})
+	})
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+// sign creates a token signed with the RSA key, or the EC key if kid is "ec".
+func (p *testProvider) sign(t *testing.T, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	alg := "RS256"
+	if kid == "ec" {
+		alg = "ES256"
+	}
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	if kid == "ec" {
+		r, s, err := ecdsa.Sign(rand.Reader, p.ecKey, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	} else {
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, p.rsaKey, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestOIDC_Authorize(t *testing.T) {
+	p := newTestProvider(t)
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	clock := gokyu.NewFakeClock(now)
+
+	o, err := NewOIDC(OIDCConfig{
+		Issuer:   p.server.URL,
+		Audience: "gokyu",
+		Clock:    clock,
+		Authorize: func(claims map[string]interface{}) error {
+			if claims["scope"] != "queues" {
+				return errors.New("missing scope")
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":   p.server.URL,
+			"aud":   "gokyu",
+			"exp":   now.Add(time.Hour).Unix(),
+			"scope": "queues",
+		}
+	}
+	with := func(k string, v interface{}) map[string]interface{} {
+		c := valid()
+		if v == nil {
+			delete(c, k)
+		} else {
+			c[k] = v
+		}
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{name: "rs256", token: p.sign(t, "rsa", valid())},
+		{name: "es256", token: p.sign(t, "ec", valid())},
+		{name: "audience list", token: p.sign(t, "rsa", with("aud", []string{"other", "gokyu"}))},
+		{name: "wrong audience", token: p.sign(t, "rsa", with("aud", "other")), wantErr: ErrUnauthorized},
+		{name: "wrong issuer", token: p.sign(t, "rsa", with("iss", "https://evil.example.com")), wantErr: ErrUnauthorized},
+		{name: "expired", token: p.sign(t, "rsa", with("exp", now.Add(-2*time.Minute).Unix())), wantErr: ErrUnauthorized},
+		{name: "within leeway", token: p.sign(t, "rsa", with("exp", now.Add(-30*time.Second).Unix()))},
+		{name: "no expiry", token: p.sign(t, "rsa", with("exp", nil)), wantErr: ErrUnauthorized},
+		{name: "not yet valid", token: p.sign(t, "rsa", with("nbf", now.Add(time.Hour).Unix())), wantErr: ErrUnauthorized},
+		{name: "forbidden", token: p.sign(t, "rsa", with("scope", "other")), wantErr: ErrForbidden},
+		{name: "tampered", token: p.sign(t, "rsa", valid()) + "x", wantErr: ErrUnauthorized},
+		{name: "malformed", token: "not-a-jwt", wantErr: ErrUnauthorized},
+		{name: "missing", wantErr: ErrUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			err := o.Authorize(r)
+			if tt.wantErr == nil && err != nil || tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("Authorize() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if n := p.fetches.Load(); n != 1 {
+		t.Errorf("expected the key set to be fetched once, got %d", n)
+	}
+}
+
+func TestOIDC_UnknownKeyRefresh(t *testing.T) {
+	p := newTestProvider(t)
+	now := time.Now()
+	clock := gokyu.NewFakeClock(now)
+	o, _ := NewOIDC(OIDCConfig{Issuer: p.server.URL, Audience: "gokyu", JWKSURL: p.server.URL + "/keys", Clock: clock})
+
+	token := p.sign(t, "rotated", map[string]interface{}{"iss": p.server.URL, "aud": "gokyu", "exp": now.Add(time.Hour).Unix()})
+	for i := 0; i < 3; i++ {
+		if _, err := o.Verify(context.Background(), token); !errors.Is(err, ErrUnauthorized) {
+			t.Fatalf("expected ErrUnauthorized for an unknown key, got %v", err)
+		}
+	}
+	if n := p.fetches.Load(); n != 1 {
+		t.Errorf("expected unknown keys to refresh at most once a minute, got %d fetches", n)
+	}
+
+	clock.Advance(2 * time.Minute)
+	o.Verify(context.Background(), token)
+	if n := p.fetches.Load(); n != 2 {
+		t.Errorf("expected a refresh after a minute, got %d fetches", n)
+	}
+}
+
+func TestOIDC_FailedFetchBackoff(t *testing.T) {
+	p := newTestProvider(t)
+	p.failing.Store(true)
+	now := time.Now()
+	clock := gokyu.NewFakeClock(now)
+	o, _ := NewOIDC(OIDCConfig{Issuer: p.server.URL, Audience: "gokyu", JWKSURL: p.server.URL + "/keys", Clock: clock})
+
+	token := p.sign(t, "rsa", map[string]interface{}{"iss": p.server.URL, "aud": "gokyu", "exp": now.Add(time.Hour).Unix()})
+	for i := 0; i < 3; i++ {
+		if _, err := o.Verify(context.Background(), token); err == nil {
+			t.Fatal("Verify() succeeded without a key set")
+		}
+	}
+	if n := p.fetches.Load(); n != 1 {
+		t.Errorf("expected failed fetches to be retried at most once a minute, got %d fetches", n)
+	}
+
+	p.failing.Store(false)
+	clock.Advance(2 * time.Minute)
+	if _, err := o.Verify(context.Background(), token); err != nil {
+		t.Errorf("Verify() after the provider recovered error = %v", err)
+	}
+}
+
+func TestOIDC_ConcurrentFetch(t *testing.T) {
+	p := newTestProvider(t)
+	now := time.Now()
+	clock := gokyu.NewFakeClock(now)
+	o, _ := NewOIDC(OIDCConfig{Issuer: p.server.URL, Audience: "gokyu", JWKSURL: p.server.URL + "/keys", Clock: clock})
+	claims := map[string]interface{}{"iss": p.server.URL, "aud": "gokyu", "exp": now.Add(time.Hour).Unix()}
+	known, rotated := p.sign(t, "rsa", claims), p.sign(t, "rotated", claims)
+	if _, err := o.Verify(context.Background(), known); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+
+	// Tokens with an unknown key wait for one fetch together
+	p.hold.Store(true)
+	clock.Advance(2 * time.Minute)
+	errs := make(chan error, 4)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			_, err := o.Verify(context.Background(), rotated)
+			errs <- err
+		}()
+	}
+	for p.fetches.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Known keys are not held up by the fetch
+	if _, err := o.Verify(context.Background(), known); err != nil {
+		t.Errorf("Verify() during a fetch error = %v", err)
+	}
+
+	close(p.release)
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; !errors.Is(err, ErrUnauthorized) {
+			t.Errorf("Verify() with an unknown key error = %v, want ErrUnauthorized", err)
+		}
+	}
+	if n := p.fetches.Load(); n != 2 {
+		t.Errorf("expected one fetch for concurrent requests, got %d fetches", n-1)
+	}
+}
+
+func TestNewOIDC_Validation(t *testing.T) {
+	if _, err := NewOIDC(OIDCConfig{Audience: "gokyu"}); err == nil {
+		t.Error("expected an error without an issuer")
+	}
+	if _, err := NewOIDC(OIDCConfig{Issuer: "https://login.example.com"}); err == nil {
+		t.Error("expected an error without an audience")
+	}
+}
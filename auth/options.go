@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"crypto/tls"
+	"errors"
+	"flag"
+	"strings"
+)
+
+// Options configures TLS and the authorizers of a server, typically from
+// command-line flags (see RegisterFlags).
+type Options struct {
+	// TLSCert and TLSKey are the server certificate and key files. The
+	// server speaks plain HTTP if they are empty.
+	TLSCert string
+	TLSKey  string
+
+	// ClientCA is a file of CA certificates. If set, clients may
+	// authenticate with a certificate signed by one of them.
+	ClientCA string
+
+	// ClientNames restricts client certificates to these names (see ClientCert).
+	ClientNames []string
+
+	// APIKeysFile is a file of accepted API keys (see LoadAPIKeys).
+	APIKeysFile string
+
+	// OIDCIssuer and OIDCAudience accept tokens from an OIDC provider.
+	OIDCIssuer   string
+	OIDCAudience string
+}
+
+// RegisterFlags adds flags for the options to a flag set.
+func (o *Options) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.TLSCert, "tls-cert", "", "TLS certificate file")
+	fs.StringVar(&o.TLSKey, "tls-key", "", "TLS key file")
+	fs.StringVar(&o.ClientCA, "client-ca", "", "accept client certificates signed by the CAs in this file (mTLS)")
+	fs.Func("client-names", "comma-separated client certificate names to accept (default: any)", func(s string) error {
+		o.ClientNames = strings.Split(s, ",")
+		return nil
+	})
+	fs.StringVar(&o.APIKeysFile, "api-keys", "", "accept the API keys in this file, one per line")
+	fs.StringVar(&o.OIDCIssuer, "oidc-issuer", "", "accept bearer tokens from this OIDC issuer")
+	fs.StringVar(&o.OIDCAudience, "oidc-audience", "", "required audience of OIDC tokens")
+}
+
+// TLSConfig returns the server TLS configuration, or nil if no certificate
+// is configured.
+func (o *Options) TLSConfig() (*tls.Config, error) {
+	if o.TLSCert == "" && o.TLSKey == "" {
+		if o.ClientCA != "" {
+			return nil, errors.New("auth: client certificates require a TLS certificate")
+		}
+		return nil, nil
+	}
+	return ServerTLSConfig(o.TLSCert, o.TLSKey, o.ClientCA)
+}
+
+// Authorizer returns an authorizer that accepts any of the configured
+// credentials, or nil if none is configured.
+func (o *Options) Authorizer() (Authorizer, error) {
+	var authorizers []Authorizer
+	if o.ClientCA != "" {
+		authorizers = append(authorizers, ClientCert(o.ClientNames...))
+	}
+	if o.APIKeysFile != "" {
+		keys, err := LoadAPIKeys(o.APIKeysFile)
+		if err != nil {
+			return nil, err
+		}
+		authorizers = append(authorizers, keys)
+	}
+	if o.OIDCIssuer != "" {
+		oidc, err := NewOIDC(OIDCConfig{Issuer: o.OIDCIssuer, Audience: o.OIDCAudience})
+		if err != nil {
+			return nil, err
+		}
+		authorizers = append(authorizers, oidc)
+	}
+
+	switch len(authorizers) {
+	case 0:
+		return nil, nil
+	case 1:
+		return authorizers[0], nil
+	}
+	return Any(authorizers...), nil
+}
@@ -0,0 +1,416 @@
+package gokyu
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ContentTypeBatch is the content type of batch envelopes: a JSON object
+// whose "messages" array holds the logical messages with their ID, content
+// type, properties and base64 body.
+const ContentTypeBatch = "application/vnd.gokyu.batch+json"
+
+// PropertyBatchSize is set on batch envelopes to the number of messages
+// they contain.
+const PropertyBatchSize = "gokyu-batch-size"
+
+// Metric names recorded by a BatchingPublisher.
+const (
+	// MetricPublishBufferMessages is the histogram of messages waiting in
+	// the publish buffer, sampled on every Publish.
+	MetricPublishBufferMessages = "gokyu_publish_buffer_messages"
+
+	// MetricPublishBufferWait is the histogram of how long the oldest
+	// message of each batch waited until the batch was published, in
+	// seconds.
+	MetricPublishBufferWait = "gokyu_publish_buffer_wait_seconds"
+
+	// MetricPublishBufferFlushes counts published batches, labeled with
+	// LabelResult.
+	MetricPublishBufferFlushes = "gokyu_publish_buffer_flushes_total"
+)
+
+// LabelResult is the label holding the outcome of an operation, "success"
+// or "failure".
+const LabelResult = "result"
+
+// batchEnvelope is the JSON form of a batch envelope.
+type batchEnvelope struct {
+	Messages []json.RawMessage `json:"messages"`
+}
+
+// batchEntry is the JSON form of a message in a batch envelope.
+type batchEntry struct {
+	ID           string                 `json:"id,omitempty"`
+	ContentType  string                 `json:"content_type,omitempty"`
+	PartitionKey string                 `json:"partition_key,omitempty"`
+	Priority     uint8                  `json:"priority,omitempty"`
+	Properties   map[string]interface{} `json:"properties,omitempty"`
+	Body         []byte                 `json:"body"`
+}
+
+// encodeBatchEntry encodes a message for a batch envelope.
+func encodeBatchEntry(msg *Message) (json.RawMessage, error) {
+	if msg.BodyValue != nil {
+		return nil, fmt.Errorf("gokyu: BodyValue cannot be batched")
+	}
+	return json.Marshal(batchEntry{
+		ID:           msg.ID,
+		ContentType:  msg.ContentType,
+		PartitionKey: msg.PartitionKey,
+		Priority:     msg.Priority,
+		Properties:   msg.Properties,
+		Body:         append([]byte{}, msg.Body...),
+	})
+}
+
+// EncodeBatch returns a batch envelope containing msgs.
+func EncodeBatch(msgs []*Message) (*Message, error) {
+	entries := make([]json.RawMessage, len(msgs))
+	for i, msg := range msgs {
+		entry, err := encodeBatchEntry(msg)
+		if err != nil {
+			return nil, err
+		}
+		entries[i] = entry
+	}
+	return newBatchMessage(entries)
+}
+
+func newBatchMessage(entries []json.RawMessage) (*Message, error) {
+	body, err := json.Marshal(batchEnvelope{Messages: entries})
+	if err != nil {
+		return nil, err
+	}
+	msg := NewMessage(body)
+	msg.ContentType = ContentTypeBatch
+	msg.Properties[PropertyBatchSize] = int64(len(entries))
+	return msg, nil
+}
+
+// DecodeBatch returns the messages of a batch envelope. They carry the
+// envelope's EnqueuedTime.
+func DecodeBatch(msg *Message) ([]*Message, error) {
+	if msg.ContentType != ContentTypeBatch {
+		return nil, fmt.Errorf("gokyu: content type %q is not a batch envelope", msg.ContentType)
+	}
+	var env batchEnvelope
+	if err := json.Unmarshal(msg.Body, &env); err != nil {
+		return nil, fmt.Errorf("gokyu: decode batch envelope: %w", err)
+	}
+
+	msgs := make([]*Message, len(env.Messages))
+	for i, raw := range env.Messages {
+		var entry batchEntry
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		if err := dec.Decode(&entry); err != nil {
+			return nil, fmt.Errorf("gokyu: decode batch message %d: %w", i, err)
+		}
+		part := NewMessage(entry.Body)
+		part.ID = entry.ID
+		part.ContentType = entry.ContentType
+		part.PartitionKey = entry.PartitionKey
+		part.Priority = entry.Priority
+		part.EnqueuedTime = msg.EnqueuedTime
+		part.Receiver = msg.Receiver
+		for k, v := range entry.Properties {
+			// Restore integers, which JSON would otherwise turn into float64
+			if n, ok := v.(json.Number); ok {
+				if i, err := n.Int64(); err == nil {
+					v = i
+				} else if f, err := n.Float64(); err == nil {
+					v = f
+				}
+			}
+			part.Properties[k] = v
+		}
+		msgs[i] = part
+	}
+	return msgs, nil
+}
+
+// BatchOptions configures a BatchingPublisher.
+type BatchOptions struct {
+	// MaxMessages is the number of messages that fills a batch (default: 100).
+	MaxMessages int
+
+	// MaxBytes is the encoded size that fills a batch (default: 256 KiB, the
+	// Service Bus standard tier limit, less headroom for headers).
+	MaxBytes int
+
+	// MaxDelay is how long the first message of a batch waits for others
+	// before the batch is published anyway (default: 50ms).
+	MaxDelay time.Duration
+
+	// Metrics records MetricPublishBufferMessages, MetricPublishBufferWait
+	// and MetricPublishBufferFlushes.
+	Metrics Metrics
+
+	// Clock is the time source for MaxDelay (default: SystemClock).
+	Clock Clock
+}
+
+// WithDefaults returns the options with defaults applied.
+func (o BatchOptions) WithDefaults() BatchOptions {
+	if o.MaxMessages <= 0 {
+		o.MaxMessages = 100
+	}
+	if o.MaxBytes <= 0 {
+		o.MaxBytes = 240 * 1024
+	}
+	if o.MaxDelay <= 0 {
+		o.MaxDelay = 50 * time.Millisecond
+	}
+	if o.Metrics == nil {
+		o.Metrics = NopMetrics{}
+	}
+	if o.Clock == nil {
+		o.Clock = SystemClock
+	}
+	return o
+}
+
+// PublishBufferStats describes the messages waiting in a BatchingPublisher,
+// including batches being published.
+type PublishBufferStats struct {
+	Messages int
+	Bytes    int
+	Batches  int
+
+	// OldestAge is how long the oldest waiting message has waited.
+	OldestAge time.Duration
+}
+
+// BatchingPublisher coalesces messages published concurrently into batch
+// envelopes, trading up to MaxDelay of latency for far fewer broker
+// messages on brokers that bill or throttle per message:
+//
+//	batcher := gokyu.NewBatchingPublisher(pub, gokyu.BatchOptions{MaxDelay: 20 * time.Millisecond})
+//	defer batcher.Close(ctx)
+//
+// Publish returns once the envelope holding the message has been published,
+// with the envelope's error, so every caller learns whether its message was
+// committed. Consumers unpack envelopes with NewBatchSplitter.
+//
+// While the broker is unavailable, batches wait in memory. Stats and the
+// publish buffer metrics show how full the buffer is before it becomes a
+// problem.
+type BatchingPublisher struct {
+	pub  Publisher
+	opts BatchOptions
+
+	unregister func()
+
+	mu      sync.Mutex
+	batch   *pendingBatch
+	last    *pendingBatch   // most recently started batch
+	waiting []*pendingBatch // unpublished batches, oldest first
+	closed  bool
+}
+
+// pendingBatch is a batch being filled or published.
+type pendingBatch struct {
+	entries []json.RawMessage
+	size    int
+	started time.Time
+	full    chan struct{} // closed when the batch is sealed
+	done    chan struct{} // closed when the batch is published
+	err     error
+
+	// prev is published first, so batches keep their order
+	prev *pendingBatch
+}
+
+// NewBatchingPublisher wraps pub to publish batch envelopes.
+func NewBatchingPublisher(pub Publisher, opts BatchOptions) *BatchingPublisher {
+	p := &BatchingPublisher{pub: pub, opts: opts.WithDefaults()}
+	p.unregister = RegisterDiagnostics("batching-publisher", p.diagnostics)
+	return p
+}
+
+// Stats returns the current occupancy of the publish buffer.
+func (p *BatchingPublisher) Stats() PublishBufferStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.stats()
+}
+
+// stats computes the buffer stats. The caller holds p.mu.
+func (p *BatchingPublisher) stats() PublishBufferStats {
+	stats := PublishBufferStats{Batches: len(p.waiting)}
+	for _, b := range p.waiting {
+		stats.Messages += len(b.entries)
+		stats.Bytes += b.size
+	}
+	if len(p.waiting) > 0 {
+		stats.OldestAge = p.opts.Clock.Now().Sub(p.waiting[0].started)
+	}
+	return stats
+}
+
+func (p *BatchingPublisher) diagnostics() map[string]interface{} {
+	stats := p.Stats()
+	return map[string]interface{}{
+		"messages":           stats.Messages,
+		"bytes":              stats.Bytes,
+		"batches":            stats.Batches,
+		"oldest_age_seconds": stats.OldestAge.Seconds(),
+	}
+}
+
+// Publish adds msg to the current batch and waits until the batch is
+// published. If ctx ends first, Publish returns its error but the message
+// may still be published with the batch.
+func (p *BatchingPublisher) Publish(ctx context.Context, msg *Message) error {
+	entry, err := encodeBatchEntry(msg)
+	if err != nil {
+		return WrapError(ErrPublishFailed, err)
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrClosed
+	}
+	if p.batch != nil && p.batch.size+len(entry) > p.opts.MaxBytes {
+		p.seal()
+	}
+	if p.batch == nil {
+		p.batch = &pendingBatch{started: p.opts.Clock.Now(), full: make(chan struct{}), done: make(chan struct{}), prev: p.last}
+		p.last = p.batch
+		p.waiting = append(p.waiting, p.batch)
+		go p.flushAfter(p.batch, p.opts.Clock.NewTimer(p.opts.MaxDelay))
+	}
+	b := p.batch
+	b.entries = append(b.entries, entry)
+	b.size += len(entry)
+	if len(b.entries) >= p.opts.MaxMessages {
+		p.seal()
+	}
+	buffered := p.stats().Messages
+	p.mu.Unlock()
+	p.opts.Metrics.ObserveHistogram(MetricPublishBufferMessages, nil, float64(buffered))
+
+	select {
+	case <-b.done:
+		return b.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// seal ends the current batch so the next message starts a new one. The
+// caller holds p.mu.
+func (p *BatchingPublisher) seal() {
+	close(p.batch.full)
+	p.batch = nil
+}
+
+// flushAfter publishes b when it is sealed or MaxDelay has passed.
+func (p *BatchingPublisher) flushAfter(b *pendingBatch, timer Timer) {
+	select {
+	case <-b.full:
+		timer.Stop()
+	case <-timer.C():
+		p.mu.Lock()
+		if p.batch == b {
+			p.seal()
+		}
+		p.mu.Unlock()
+	}
+	p.flush(b)
+}
+
+// flush publishes a sealed batch.
+func (p *BatchingPublisher) flush(b *pendingBatch) {
+	defer close(b.done)
+	if b.prev != nil {
+		<-b.prev.done
+		b.prev = nil
+	}
+	defer p.flushed(b)
+
+	msg, err := newBatchMessage(b.entries)
+	if err != nil {
+		b.err = WrapError(ErrPublishFailed, err)
+		return
+	}
+	// Publishing outlives the callers' contexts, which only bound waiting
+	b.err = p.pub.Publish(context.Background(), msg)
+}
+
+// flushed removes a batch from the buffer once it is published or failed,
+// and records the publish buffer metrics.
+func (p *BatchingPublisher) flushed(b *pendingBatch) {
+	p.mu.Lock()
+	for i, w := range p.waiting {
+		if w == b {
+			p.waiting = append(p.waiting[:i], p.waiting[i+1:]...)
+			break
+		}
+	}
+	p.mu.Unlock()
+
+	result := "success"
+	if b.err != nil {
+		result = "failure"
+	}
+	p.opts.Metrics.IncCounter(MetricPublishBufferFlushes, map[string]string{LabelResult: result}, 1)
+	p.opts.Metrics.ObserveHistogram(MetricPublishBufferWait, nil, p.opts.Clock.Now().Sub(b.started).Seconds())
+}
+
+// Flush publishes the current batch without waiting for it to fill.
+func (p *BatchingPublisher) Flush(ctx context.Context) error {
+	p.mu.Lock()
+	b := p.batch
+	if b != nil {
+		p.seal()
+	}
+	p.mu.Unlock()
+	if b == nil {
+		return nil
+	}
+
+	select {
+	case <-b.done:
+		return b.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close publishes the current batch and closes the wrapped publisher.
+func (p *BatchingPublisher) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	if p.batch != nil {
+		p.seal()
+	}
+	last := p.last
+	p.mu.Unlock()
+	p.unregister()
+
+	// Batches are published in order, so the last one finishes last
+	var err error
+	if last != nil {
+		select {
+		case <-last.done:
+			err = last.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if closeErr := p.pub.Close(ctx); err == nil {
+		err = closeErr
+	}
+	return err
+}
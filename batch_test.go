@@ -0,0 +1,238 @@
+package gokyu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// envelopePublisher records published envelopes.
+type envelopePublisher struct {
+	mu        sync.Mutex
+	envelopes []*Message
+	err       error
+	closed    bool
+}
+
+func (p *envelopePublisher) Publish(ctx context.Context, msg *Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.envelopes = append(p.envelopes, msg)
+	return p.err
+}
+
+func (p *envelopePublisher) Close(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	return nil
+}
+
+func (p *envelopePublisher) published() []*Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*Message(nil), p.envelopes...)
+}
+
+// waitForPending waits until the current batch holds n messages.
+func waitForPending(t *testing.T, p *BatchingPublisher, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		p.mu.Lock()
+		pending := 0
+		if p.batch != nil {
+			pending = len(p.batch.entries)
+		}
+		p.mu.Unlock()
+		if pending == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d pending messages, got %d", n, pending)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// batchingDiagnostics returns the states of the registered batching
+// publishers, oldest first.
+func batchingDiagnostics() []map[string]interface{} {
+	var states []map[string]interface{}
+	for _, c := range Snapshot().Components {
+		if c.Kind == "batching-publisher" {
+			states = append(states, c.State)
+		}
+	}
+	return states
+}
+
+func TestBatch_RoundTrip(t *testing.T) {
+	a := NewMessage([]byte("a"))
+	a.ID = "m1"
+	a.ContentType = ContentTypeJSON
+	a.PartitionKey = "acme"
+	a.Properties["attempt"] = int64(3)
+	b := NewMessage(nil)
+
+	envelope, err := EncodeBatch([]*Message{a, b})
+	if err != nil {
+		t.Fatalf("EncodeBatch() error = %v", err)
+	}
+	if envelope.ContentType != ContentTypeBatch || envelope.Properties[PropertyBatchSize] != int64(2) {
+		t.Errorf("envelope = %s %v", envelope.ContentType, envelope.Properties)
+	}
+
+	envelope.EnqueuedTime = time.Unix(1000, 0)
+	parts, err := DecodeBatch(envelope)
+	if err != nil {
+		t.Fatalf("DecodeBatch() error = %v", err)
+	}
+	if len(parts) != 2 {
+		t.Fatalf("expected 2 parts, got %d", len(parts))
+	}
+	got := parts[0]
+	if got.ID != "m1" || string(got.Body) != "a" || got.ContentType != ContentTypeJSON || got.PartitionKey != "acme" {
+		t.Errorf("unexpected part: %+v", got)
+	}
+	if got.Properties["attempt"] != int64(3) || !got.EnqueuedTime.Equal(envelope.EnqueuedTime) {
+		t.Errorf("unexpected part metadata: %v %v", got.Properties, got.EnqueuedTime)
+	}
+	if len(parts[1].Body) != 0 {
+		t.Errorf("expected empty body, got %q", parts[1].Body)
+	}
+
+	if _, err := DecodeBatch(NewMessage([]byte("{}"))); err == nil {
+		t.Error("expected an error decoding a message without the batch content type")
+	}
+}
+
+func TestBatchingPublisher_MaxMessages(t *testing.T) {
+	pub := &envelopePublisher{}
+	batcher := NewBatchingPublisher(pub, BatchOptions{MaxMessages: 3, MaxDelay: time.Hour})
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := batcher.Publish(ctx, NewMessage([]byte(fmt.Sprint(i)))); err != nil {
+				t.Errorf("Publish() error = %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	envelopes := pub.published()
+	if len(envelopes) != 2 {
+		t.Fatalf("expected 2 envelopes, got %d", len(envelopes))
+	}
+	for _, env := range envelopes {
+		if env.Properties[PropertyBatchSize] != int64(3) {
+			t.Errorf("expected 3 messages per envelope, got %v", env.Properties[PropertyBatchSize])
+		}
+	}
+}
+
+func TestBatchingPublisher_MaxDelay(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	pub := &envelopePublisher{err: errors.New("broker down")}
+	batcher := NewBatchingPublisher(pub, BatchOptions{MaxDelay: 20 * time.Millisecond, Clock: clock})
+
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() { errs <- batcher.Publish(context.Background(), NewMessage([]byte("x"))) }()
+	}
+	waitForPending(t, batcher, 2)
+	clock.Advance(20 * time.Millisecond)
+
+	// Every caller sees the error of the shared envelope
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err == nil || err.Error() != "broker down" {
+			t.Errorf("Publish() error = %v, want the envelope error", err)
+		}
+	}
+	if n := len(pub.published()); n != 1 {
+		t.Errorf("expected 1 envelope, got %d", n)
+	}
+}
+
+func TestBatchingPublisher_Stats(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	pub := &envelopePublisher{err: errors.New("broker down")}
+	metrics := newCountingMetrics()
+	batcher := NewBatchingPublisher(pub, BatchOptions{MaxDelay: time.Minute, Metrics: metrics, Clock: clock})
+
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() { errs <- batcher.Publish(context.Background(), NewMessage([]byte("x"))) }()
+	}
+	waitForPending(t, batcher, 2)
+	clock.Advance(30 * time.Second)
+
+	stats := batcher.Stats()
+	if stats.Messages != 2 || stats.Batches != 1 || stats.Bytes == 0 || stats.OldestAge != 30*time.Second {
+		t.Errorf("Stats() = %+v", stats)
+	}
+	registered := batchingDiagnostics()
+	if len(registered) == 0 || registered[len(registered)-1]["messages"] != 2 {
+		t.Errorf("diagnostics = %v", registered)
+	}
+
+	clock.Advance(30 * time.Second)
+	<-errs
+	<-errs
+	batcher.Close(context.Background())
+	if stats := batcher.Stats(); stats != (PublishBufferStats{}) {
+		t.Errorf("Stats() after flush = %+v", stats)
+	}
+	if n := len(batchingDiagnostics()); n != len(registered)-1 {
+		t.Errorf("expected the diagnostics to be unregistered on Close, %d registered", n)
+	}
+
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	if metrics.counters[MetricPublishBufferFlushes] != 1 || metrics.labels[MetricPublishBufferFlushes][LabelResult] != "failure" {
+		t.Errorf("flushes = %v %v", metrics.counters[MetricPublishBufferFlushes], metrics.labels[MetricPublishBufferFlushes])
+	}
+	if got := metrics.histograms[MetricPublishBufferWait]; len(got) != 1 || got[0] != 60 {
+		t.Errorf("wait = %v, want [60]", got)
+	}
+	if got := metrics.histograms[MetricPublishBufferMessages]; len(got) != 2 {
+		t.Errorf("occupancy samples = %v", got)
+	}
+}
+
+func TestBatchingPublisher_MaxBytes(t *testing.T) {
+	pub := &envelopePublisher{}
+	batcher := NewBatchingPublisher(pub, BatchOptions{MaxBytes: 100, MaxDelay: time.Hour})
+	ctx := context.Background()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		batcher.Publish(ctx, NewMessage(make([]byte, 60)))
+	}()
+	waitForPending(t, batcher, 1)
+
+	// The second message does not fit, so the first batch is sealed
+	go batcher.Publish(ctx, NewMessage(make([]byte, 60)))
+	<-done
+
+	if err := batcher.Close(ctx); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if n := len(pub.published()); n != 2 {
+		t.Errorf("expected 2 envelopes, got %d", n)
+	}
+	if !pub.closed {
+		t.Error("expected the wrapped publisher to be closed")
+	}
+	if err := batcher.Publish(ctx, NewMessage(nil)); !errors.Is(err, ErrClosed) {
+		t.Errorf("Publish() after Close error = %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package gokyu
+
+import (
+	"context"
+	"fmt"
+)
+
+// Browser reads the messages of an entity without locking or settling
+// them, so that other consumers and the delivery count of the messages are
+// not affected.
+type Browser interface {
+	// Browse returns the next message, waiting until one arrives or ctx is
+	// done. Browsed messages cannot be settled.
+	Browse(ctx context.Context) (*Message, error)
+
+	// Close releases the browser's resources.
+	Close(ctx context.Context) error
+}
+
+// BrowseProvider is implemented by provider factories that can read
+// messages without consuming them.
+type BrowseProvider interface {
+	// NewBrowser creates a browser for the configured queue or subscription.
+	NewBrowser(ctx context.Context, cfg *Config) (Browser, error)
+}
+
+// NewBrowser creates a browser for the configured queue or subscription.
+// Providers without browse support return ErrUnsupportedProvider; on those,
+// read from a dedicated subscription instead, since releasing a message
+// counts as a failed delivery.
+func (c *Client) NewBrowser(ctx context.Context) (Browser, error) {
+	bp, ok := c.factory.(BrowseProvider)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s has no browse support", ErrUnsupportedProvider, c.config.Provider)
+	}
+	return bp.NewBrowser(ctx, c.config)
+}
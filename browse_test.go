@@ -0,0 +1,54 @@
+package gokyu
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// browseFactory is a mockFactory that supports browsing.
+type browseFactory struct {
+	mockFactory
+	cfg *Config
+}
+
+func (f *browseFactory) NewBrowser(ctx context.Context, cfg *Config) (Browser, error) {
+	f.cfg = cfg
+	return nil, nil
+}
+
+func TestClient_NewBrowser(t *testing.T) {
+	t.Run("supported", func(t *testing.T) {
+		factory := &browseFactory{}
+		RegisterProvider("browse-provider", factory)
+		client, err := NewClient(&Config{
+			Provider:         "browse-provider",
+			ConnectionString: "amqps://test@host",
+			Queue:            "orders",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := client.NewBrowser(context.Background()); err != nil {
+			t.Fatalf("NewBrowser() error = %v", err)
+		}
+		if factory.cfg == nil || factory.cfg.Queue != "orders" {
+			t.Errorf("factory got config %+v", factory.cfg)
+		}
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		RegisterProvider("no-browse-provider", &mockFactory{})
+		client, _ := NewClient(&Config{
+			Provider:         "no-browse-provider",
+			ConnectionString: "amqps://test@host",
+			Queue:            "orders",
+		})
+
+		_, err := client.NewBrowser(context.Background())
+		if !errors.Is(err, ErrUnsupportedProvider) {
+			t.Errorf("NewBrowser() error = %v, want ErrUnsupportedProvider", err)
+		}
+	})
+}
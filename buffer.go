@@ -0,0 +1,170 @@
+package gokyu
+
+import (
+	"context"
+	"runtime/pprof"
+	"sync"
+)
+
+// DefaultBufferSize is the number of messages a buffered subscriber keeps
+// ready when BufferOptions.Size is not set.
+const DefaultBufferSize = 16
+
+// BufferOptions configures NewBufferedSubscriber.
+type BufferOptions struct {
+	// Size is the maximum number of messages held in the buffer
+	// (default: DefaultBufferSize).
+	Size int
+
+	// MaxBytes bounds the total body size of buffered messages. A single
+	// message larger than MaxBytes is still buffered on its own. Zero means
+	// no byte limit.
+	MaxBytes int64
+}
+
+// NewBufferedSubscriber wraps a subscriber with a background receive loop
+// that keeps up to opts.Size messages ready, so handlers calling Receive do
+// not wait on the network. Buffered messages still count against the
+// broker's lock duration; Close releases any that were never handed out.
+func NewBufferedSubscriber(sub Subscriber, opts BufferOptions) Subscriber {
+	if opts.Size <= 0 {
+		opts.Size = DefaultBufferSize
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &bufferedSubscriber{
+		Subscriber: sub,
+		opts:       opts,
+		results:    make(chan bufferedResult, opts.Size),
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	s.unregister = RegisterDiagnostics("buffered-subscriber", s.diagnostics)
+
+	go pprof.Do(ctx, pprof.Labels("gokyu", "buffered-subscriber"), s.fill)
+	return s
+}
+
+// bufferedSubscriber receives ahead of the caller into a bounded channel.
+type bufferedSubscriber struct {
+	Subscriber
+	opts    BufferOptions
+	results chan bufferedResult
+	cancel  context.CancelFunc
+	done    chan struct{}
+
+	unregister func()
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	bytes  int64
+	closed bool
+}
+
+type bufferedResult struct {
+	msg *Message
+	err error
+}
+
+// fill receives messages until the subscriber is closed.
+func (s *bufferedSubscriber) fill(ctx context.Context) {
+	defer close(s.done)
+
+	for {
+		msg, err := s.Subscriber.Receive(ctx)
+		if ctx.Err() != nil {
+			if msg != nil {
+				s.Subscriber.Nack(context.Background(), msg)
+			}
+			return
+		}
+
+		if msg != nil && !s.reserve(int64(len(msg.Body))) {
+			s.Subscriber.Nack(context.Background(), msg)
+			return
+		}
+
+		select {
+		case s.results <- bufferedResult{msg: msg, err: err}:
+		case <-ctx.Done():
+			if msg != nil {
+				s.Subscriber.Nack(context.Background(), msg)
+			}
+			return
+		}
+	}
+}
+
+// reserve waits until n bytes fit within MaxBytes. It returns false if the
+// subscriber was closed while waiting.
+func (s *bufferedSubscriber) reserve(n int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for !s.closed && s.opts.MaxBytes > 0 && s.bytes > 0 && s.bytes+n > s.opts.MaxBytes {
+		s.cond.Wait()
+	}
+	if s.closed {
+		return false
+	}
+	s.bytes += n
+	return true
+}
+
+// release returns n bytes to the budget.
+func (s *bufferedSubscriber) release(n int64) {
+	s.mu.Lock()
+	s.bytes -= n
+	s.mu.Unlock()
+	s.cond.Broadcast()
+}
+
+// diagnostics reports the buffer fill level.
+func (s *bufferedSubscriber) diagnostics() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return map[string]interface{}{
+		"buffered":  len(s.results),
+		"capacity":  cap(s.results),
+		"bytes":     s.bytes,
+		"max_bytes": s.opts.MaxBytes,
+	}
+}
+
+func (s *bufferedSubscriber) Receive(ctx context.Context) (*Message, error) {
+	select {
+	case r := <-s.results:
+		if r.msg != nil {
+			s.release(int64(len(r.msg.Body)))
+		}
+		return r.msg, r.err
+	case <-s.done:
+		return nil, ErrClosed
+	case <-ctx.Done():
+		return nil, WrapError(ErrReceiveFailed, ctx.Err())
+	}
+}
+
+// Close stops the receive loop, releases buffered messages for redelivery
+// and closes the underlying subscriber.
+func (s *bufferedSubscriber) Close(ctx context.Context) error {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.cond.Broadcast()
+	s.cancel()
+	<-s.done
+	s.unregister()
+
+	for {
+		select {
+		case r := <-s.results:
+			if r.msg != nil {
+				s.Subscriber.Nack(ctx, r.msg)
+			}
+		default:
+			return s.Subscriber.Close(ctx)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package gokyu
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// waitBuffered waits until the buffered subscriber holds n messages.
+func waitBuffered(t *testing.T, s *bufferedSubscriber, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for len(s.results) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d buffered messages, got %d", n, len(s.results))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBufferedSubscriber_Receive(t *testing.T) {
+	sub := &drainingSubscriber{stubSubscriber{msgs: []*Message{
+		NewMessage([]byte("one")), NewMessage([]byte("two")), NewMessage([]byte("three")),
+	}}}
+	buffered := NewBufferedSubscriber(sub, BufferOptions{Size: 2})
+	defer buffered.Close(context.Background())
+
+	for _, want := range []string{"one", "two", "three"} {
+		msg, err := buffered.Receive(context.Background())
+		if err != nil {
+			t.Fatalf("Receive() error = %v", err)
+		}
+		if string(msg.Body) != want {
+			t.Errorf("expected %q, got %q", want, msg.Body)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := buffered.Receive(ctx); err == nil {
+		t.Error("expected error once the buffer is drained")
+	}
+}
+
+func TestBufferedSubscriber_MaxBytes(t *testing.T) {
+	sub := &drainingSubscriber{stubSubscriber{msgs: []*Message{
+		NewMessage([]byte("0123456789")), NewMessage([]byte("0123456789")), NewMessage([]byte("0123456789")),
+	}}}
+	buffered := NewBufferedSubscriber(sub, BufferOptions{Size: 10, MaxBytes: 15}).(*bufferedSubscriber)
+	defer buffered.Close(context.Background())
+
+	waitBuffered(t, buffered, 1)
+	time.Sleep(10 * time.Millisecond)
+	if n := len(buffered.results); n != 1 {
+		t.Fatalf("expected byte limit to hold 1 message, got %d", n)
+	}
+
+	if _, err := buffered.Receive(context.Background()); err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	waitBuffered(t, buffered, 1)
+}
+
+func TestBufferedSubscriber_CloseReleasesBuffered(t *testing.T) {
+	sub := &drainingSubscriber{stubSubscriber{msgs: []*Message{
+		NewMessage([]byte("one")), NewMessage([]byte("two")),
+	}}}
+	buffered := NewBufferedSubscriber(sub, BufferOptions{Size: 2}).(*bufferedSubscriber)
+
+	waitBuffered(t, buffered, 2)
+	if err := buffered.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if len(sub.nacked) != 2 {
+		t.Errorf("expected 2 buffered messages released, got %d", len(sub.nacked))
+	}
+	if _, err := buffered.Receive(context.Background()); err != ErrClosed {
+		t.Errorf("expected ErrClosed after Close, got %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package gokyu
+
+// Support describes how a client offers an optional feature.
+type Support int
+
+const (
+	// Unsupported means the feature is not available.
+	Unsupported Support = iota
+
+	// Native means the broker implements the feature.
+	Native
+
+	// Emulated means gokyu implements the feature on top of the broker.
+	Emulated
+)
+
+// String returns "unsupported", "native" or "emulated".
+func (s Support) String() string {
+	switch s {
+	case Native:
+		return "native"
+	case Emulated:
+		return "emulated"
+	default:
+		return "unsupported"
+	}
+}
+
+// MarshalText encodes the support level as its String, e.g. in JSON.
+func (s Support) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Capabilities reports how optional features are offered.
+type Capabilities struct {
+	// Scheduling is delayed delivery through ScheduledPublisher. Providers
+	// without it can use NewDelayPublisher.
+	Scheduling Support `json:"scheduling"`
+
+	// Priority is delivery ordered by Message.Priority.
+	Priority Support `json:"priority"`
+
+	// Addressing is publishing to the destination named by Message.To,
+	// through the provider's relay publisher.
+	Addressing Support `json:"addressing"`
+}
+
+// CapabilityReporter is implemented by provider factories to report the
+// features their broker supports natively.
+type CapabilityReporter interface {
+	Capabilities() Capabilities
+}
+
+// ConfigCapabilityReporter is implemented by provider factories whose
+// native features depend on the configuration. It takes precedence over
+// CapabilityReporter.
+type ConfigCapabilityReporter interface {
+	ConfigCapabilities(cfg *Config) Capabilities
+}
+
+// Capabilities reports the features offered by the client's publishers and
+// subscribers, natively by the provider or emulated according to the
+// configuration.
+func (c *Client) Capabilities() Capabilities {
+	var caps Capabilities
+	if r, ok := c.factory.(ConfigCapabilityReporter); ok {
+		caps = r.ConfigCapabilities(c.config)
+	} else if r, ok := c.factory.(CapabilityReporter); ok {
+		caps = r.Capabilities()
+	}
+	if caps.Priority == Unsupported && c.config.PriorityLevels > 1 {
+		caps.Priority = Emulated
+	}
+	if _, ok := c.factory.(RelayProvider); ok {
+		caps.Addressing = Native
+	}
+	return caps
+}
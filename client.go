@@ -9,6 +9,8 @@ import (
 type Client struct {
 	config  *Config
 	factory ProviderFactory
+	limited Metrics
+	metrics Metrics
 }
 
 // registry holds registered provider factories.
@@ -38,18 +40,45 @@ func getFactory(provider Provider) (ProviderFactory, error) {
 
 // NewClient creates a new client with the given configuration.
 func NewClient(cfg *Config) (*Client, error) {
+	if cfg.Environment != "" {
+		preset := cfg.WithEnvironment()
+		cfg = &preset
+	}
+	if cfg.EntityPrefix != "" {
+		prefixed := cfg.WithEntityPrefix()
+		cfg = &prefixed
+	}
 	if err := cfg.Validate(); err != nil {
 		return nil, err
 	}
+	if err := cfg.checkDestinations(); err != nil {
+		return nil, err
+	}
+	if cfg.Events == nil {
+		withEvents := *cfg
+		withEvents.Events = NewEventBus()
+		cfg = &withEvents
+	}
 
 	factory, err := getFactory(cfg.Provider)
 	if err != nil {
 		return nil, err
 	}
 
+	metrics := cfg.Metrics
+	if metrics == nil {
+		metrics = NopMetrics{}
+	}
+	// Clients derived from another client (e.g. by Router) share its limiter
+	if _, ok := metrics.(*limitedMetrics); !ok {
+		metrics = NewCardinalityLimitedMetrics(metrics, cfg.MaxMetricLabelValues)
+	}
+
 	return &Client{
 		config:  cfg,
 		factory: factory,
+		limited: metrics,
+		metrics: NewLabeledMetrics(metrics, EntityLabels(cfg)),
 	}, nil
 }
 
@@ -64,12 +93,90 @@ func NewClientFromEnv() (*Client, error) {
 
 // NewPublisher creates a new publisher using the configured provider.
 func (c *Client) NewPublisher(ctx context.Context) (Publisher, error) {
+	pub, err := c.trackPublisher(ctx, c.openPublisher)
+	if err != nil {
+		return nil, err
+	}
+	return c.decoratePublisher(pub), nil
+}
+
+// openPublisher creates a provider publisher, emulating priority if
+// configured.
+func (c *Client) openPublisher(ctx context.Context) (Publisher, error) {
+	if c.Capabilities().Priority == Emulated {
+		return newPriorityPublisher(ctx, c.factory, c.config)
+	}
 	return c.factory.NewPublisher(ctx, c.config)
 }
 
+// decoratePublisher applies addressing, the quota and client-level message
+// settings to a provider publisher.
+func (c *Client) decoratePublisher(pub Publisher) Publisher {
+	pub = newAddressingPublisher(pub, c)
+	if c.config.Quota != nil {
+		quota := *c.config.Quota
+		if quota.Metrics == nil {
+			quota.Metrics = c.metrics
+		}
+		pub = NewQuotaPublisher(pub, quota)
+	}
+	return wrapPublisher(pub, c.prepareMessage)
+}
+
+// messageIDStrategy returns the configured MessageIDStrategy, or one
+// calling the configured MessageIDGenerator.
+func (c *Client) messageIDStrategy() MessageIDStrategy {
+	if strategy := c.config.MessageIDStrategy; strategy != nil {
+		return strategy
+	}
+	generate := c.config.MessageIDGenerator
+	if generate == nil {
+		generate = NewUUIDv7
+	}
+	return MessageIDFunc(func(*Message) (string, error) { return generate(), nil })
+}
+
+// prepareMessage applies client-level settings to an outgoing message.
+func (c *Client) prepareMessage(ctx context.Context, msg *Message) error {
+	if c.config.AutoMessageID && msg.ID == "" {
+		id, err := c.messageIDStrategy().MessageID(msg)
+		if err != nil {
+			return WrapError(ErrPublishFailed, err)
+		}
+		msg.ID = id
+	}
+	for _, hook := range c.config.PublishHooks {
+		if err := hook(ctx, msg); err != nil {
+			return err
+		}
+	}
+	return NormalizeProperties(msg.Properties, c.config.PropertyConverter)
+}
+
 // NewSubscriber creates a new subscriber using the configured provider.
 func (c *Client) NewSubscriber(ctx context.Context) (Subscriber, error) {
-	return c.factory.NewSubscriber(ctx, c.config)
+	var sub Subscriber
+	var err error
+	if c.Capabilities().Priority == Emulated {
+		sub, err = newPrioritySubscriber(ctx, c.factory, c.config)
+	} else {
+		sub, err = c.factory.NewSubscriber(ctx, c.config)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if c.config.ReceivePipeline != nil {
+		sub = NewPipelineSubscriber(sub, c.config.ReceivePipeline)
+	}
+	return sub, nil
+}
+
+// Metrics returns the configured Metrics with entity labels (see
+// EntityLabels) added to every metric and label cardinality limited. Pass it
+// to components such as NewFilteringSubscriber or NewAgeSubscriber so that
+// dashboards can break traffic down per entity.
+func (c *Client) Metrics() Metrics {
+	return c.metrics
 }
 
 // Config returns a copy of the client's configuration.
@@ -3,7 +3,9 @@ package gokyu
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
+	"time"
 )
 
 // mockFactory is a test factory for verifying client behavior.
@@ -173,3 +175,181 @@ func TestClient_Config(t *testing.T) {
 		t.Errorf("expected Subscription 'my-sub', got '%s'", returnedCfg.Subscription)
 	}
 }
+
+// recordingFactory creates publishers that record published messages.
+type recordingFactory struct {
+	mockFactory
+	published []*Message
+}
+
+func (f *recordingFactory) NewPublisher(ctx context.Context, cfg *Config) (Publisher, error) {
+	return &recordingPublisher{factory: f}, nil
+}
+
+type recordingPublisher struct {
+	mockPublisher
+	factory *recordingFactory
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, msg *Message) error {
+	p.factory.published = append(p.factory.published, msg)
+	return nil
+}
+
+func TestClient_AutoMessageID(t *testing.T) {
+	tests := []struct {
+		name      string
+		auto      bool
+		generator func() string
+		msgID     string
+		want      string
+	}{
+		{name: "disabled", auto: false, want: ""},
+		{name: "custom generator", auto: true, generator: func() string { return "generated" }, want: "generated"},
+		{name: "keeps existing ID", auto: true, generator: func() string { return "generated" }, msgID: "mine", want: "mine"},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := Provider(fmt.Sprintf("test-autoid-provider-%d", i))
+			factory := &recordingFactory{}
+			RegisterProvider(provider, factory)
+
+			client, _ := NewClient(&Config{
+				Provider:           provider,
+				ConnectionString:   "amqps://test",
+				Topic:              "topic",
+				AutoMessageID:      tt.auto,
+				MessageIDGenerator: tt.generator,
+			})
+			pub, _ := client.NewPublisher(context.Background())
+
+			msg := NewMessage([]byte("body"))
+			msg.ID = tt.msgID
+			if err := pub.Publish(context.Background(), msg); err != nil {
+				t.Fatalf("Publish() error = %v", err)
+			}
+			if got := factory.published[0].ID; got != tt.want {
+				t.Errorf("expected ID %q, got %q", tt.want, got)
+			}
+		})
+	}
+
+	t.Run("default generator", func(t *testing.T) {
+		provider := Provider("test-autoid-provider-default")
+		factory := &recordingFactory{}
+		RegisterProvider(provider, factory)
+
+		client, _ := NewClient(&Config{
+			Provider:         provider,
+			ConnectionString: "amqps://test",
+			Topic:            "topic",
+			AutoMessageID:    true,
+		})
+		pub, _ := client.NewPublisher(context.Background())
+		pub.Publish(context.Background(), NewMessage(nil))
+
+		if len(factory.published[0].ID) != 36 {
+			t.Errorf("expected UUID message ID, got %q", factory.published[0].ID)
+		}
+	})
+	t.Run("strategy", func(t *testing.T) {
+		provider := Provider("test-autoid-provider-strategy")
+		factory := &recordingFactory{}
+		RegisterProvider(provider, factory)
+
+		client, _ := NewClient(&Config{
+			Provider:           provider,
+			ConnectionString:   "amqps://test",
+			Topic:              "topic",
+			AutoMessageID:      true,
+			MessageIDGenerator: func() string { return "generated" },
+			MessageIDStrategy:  PropertyHashMessageID("order"),
+		})
+		pub, _ := client.NewPublisher(context.Background())
+
+		for i := 0; i < 2; i++ {
+			msg := NewMessage([]byte(fmt.Sprintf("attempt %d", i)))
+			msg.Properties["order"] = "o-1"
+			if err := pub.Publish(context.Background(), msg); err != nil {
+				t.Fatalf("Publish() error = %v", err)
+			}
+		}
+		if first, second := factory.published[0].ID, factory.published[1].ID; first == "generated" || first != second {
+			t.Errorf("expected the same derived ID for both publishes, got %q and %q", first, second)
+		}
+
+		err := pub.Publish(context.Background(), NewMessage(nil))
+		if !errors.Is(err, ErrPublishFailed) || len(factory.published) != 2 {
+			t.Errorf("expected publish without the property to fail, got %v", err)
+		}
+	})
+}
+
+// infoFactory creates publishers and subscribers that report broker
+// properties.
+type infoFactory struct{ mockFactory }
+
+type infoPublisher struct{ mockPublisher }
+
+func (p *infoPublisher) BrokerProperties() map[string]interface{} {
+	return map[string]interface{}{"product": "test-broker"}
+}
+
+type infoSubscriber struct{ mockSubscriber }
+
+func (s *infoSubscriber) BrokerProperties() map[string]interface{} {
+	return map[string]interface{}{"product": "test-broker"}
+}
+
+func (f *infoFactory) NewPublisher(ctx context.Context, cfg *Config) (Publisher, error) {
+	return &infoPublisher{}, nil
+}
+
+func (f *infoFactory) NewSubscriber(ctx context.Context, cfg *Config) (Subscriber, error) {
+	return &infoSubscriber{}, nil
+}
+
+func TestClient_BrokerInfo(t *testing.T) {
+	provider := Provider("test-info-provider")
+	RegisterProvider(provider, &infoFactory{})
+	client, err := NewClient(&Config{
+		Provider:         provider,
+		ConnectionString: "amqps://test",
+		Queue:            "orders",
+		ShareConnections: true,
+		Quota:            &Quota{MaxMessagesPerSecond: 100},
+		ReceivePipeline:  NewPipeline(),
+	})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	ctx := context.Background()
+
+	pub, err := client.NewPublisher(ctx)
+	if err != nil {
+		t.Fatalf("NewPublisher() error = %v", err)
+	}
+	defer pub.Close(ctx)
+	hedged, err := client.NewHedgedPublisher(ctx, HedgeOptions{After: time.Second})
+	if err != nil {
+		t.Fatalf("NewHedgedPublisher() error = %v", err)
+	}
+	defer hedged.Close(ctx)
+	sub, err := client.NewSubscriber(ctx)
+	if err != nil {
+		t.Fatalf("NewSubscriber() error = %v", err)
+	}
+	defer sub.Close(ctx)
+
+	for name, v := range map[string]interface{}{"publisher": pub, "hedged publisher": hedged, "subscriber": sub} {
+		info, ok := v.(BrokerInfo)
+		if !ok {
+			t.Errorf("%s does not implement BrokerInfo", name)
+			continue
+		}
+		if product := info.BrokerProperties()["product"]; product != "test-broker" {
+			t.Errorf("%s BrokerProperties()[product] = %v", name, product)
+		}
+	}
+}
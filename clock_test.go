@@ -0,0 +1,48 @@
+package gokyu
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+
+	short := clock.NewTimer(time.Second)
+	long := clock.NewTimer(time.Minute)
+	stopped := clock.NewTimer(time.Second)
+
+	if !stopped.Stop() {
+		t.Error("expected Stop() on a pending timer to return true")
+	}
+	if clock.Timers() != 2 {
+		t.Fatalf("expected 2 pending timers, got %d", clock.Timers())
+	}
+
+	clock.Advance(2 * time.Second)
+
+	select {
+	case fired := <-short.C():
+		if !fired.Equal(start.Add(2 * time.Second)) {
+			t.Errorf("expected fire time %v, got %v", start.Add(2*time.Second), fired)
+		}
+	default:
+		t.Error("expected short timer to fire")
+	}
+
+	select {
+	case <-long.C():
+		t.Error("expected long timer not to fire yet")
+	case <-stopped.C():
+		t.Error("expected stopped timer not to fire")
+	default:
+	}
+
+	if short.Stop() {
+		t.Error("expected Stop() on a fired timer to return false")
+	}
+	if got := clock.Now(); !got.Equal(start.Add(2 * time.Second)) {
+		t.Errorf("expected Now() %v, got %v", start.Add(2*time.Second), got)
+	}
+}
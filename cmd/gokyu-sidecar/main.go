@@ -0,0 +1,142 @@
+// Command gokyu-sidecar exposes a gokyu publisher and subscriber over HTTP on
+// a local socket so that services written in any language can use gokyu.
+//
+// The broker is configured with the standard GOKYU_* environment variables.
+//
+// Usage:
+//
+//	gokyu-sidecar -socket /var/run/gokyu.sock
+//	gokyu-sidecar -addr 127.0.0.1:8089
+//	gokyu-sidecar -addr 127.0.0.1:8089 -ui
+//	gokyu-sidecar -addr :8443 -tls-cert cert.pem -tls-key key.pem -api-keys keys.txt
+//
+// Requests over TCP can be authorized with API keys, client certificates or
+// OIDC tokens; see the auth package for the flags.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+	"github.com/venderneutral/gokyu/auth"
+	_ "github.com/venderneutral/gokyu/providers" // Register all providers
+	"github.com/venderneutral/gokyu/sidecar"
+)
+
+func main() {
+	socket := flag.String("socket", "/tmp/gokyu.sock", "unix socket to listen on")
+	addr := flag.String("addr", "", "TCP address to listen on instead of a unix socket")
+	ui := flag.Bool("ui", false, "serve the web admin UI under /ui/")
+	lockDuration := flag.Duration("lock-duration", sidecar.DefaultLockDuration, "how long a received message may go unsettled before it is nacked")
+	var authOpts auth.Options
+	authOpts.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	logger := log.New(os.Stdout, "[gokyu-sidecar] ", log.LstdFlags)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	tlsConfig, err := authOpts.TLSConfig()
+	if err != nil {
+		logger.Fatalf("Failed to configure TLS: %v", err)
+	}
+	authorizer, err := authOpts.Authorizer()
+	if err != nil {
+		logger.Fatalf("Failed to configure authorization: %v", err)
+	}
+	if authorizer == nil && *addr != "" && !isLoopback(*addr) {
+		logger.Printf("Warning: serving %s without authorization", *addr)
+	}
+
+	client, err := gokyu.NewClientFromEnv()
+	if err != nil {
+		logger.Fatalf("Failed to create client: %v", err)
+	}
+
+	publisher, err := client.NewPublisher(ctx)
+	if err != nil {
+		logger.Fatalf("Failed to create publisher: %v", err)
+	}
+	defer publisher.Close(context.Background())
+
+	// Subscribing requires a queue or a topic subscription
+	var subscriber gokyu.Subscriber
+	if cfg := client.Config(); cfg.Queue != "" || cfg.Subscription != "" {
+		subscriber, err = client.NewSubscriber(ctx)
+		if err != nil {
+			logger.Fatalf("Failed to create subscriber: %v", err)
+		}
+		defer subscriber.Close(context.Background())
+	}
+
+	var listener net.Listener
+	if *addr != "" {
+		listener, err = net.Listen("tcp", *addr)
+	} else {
+		os.Remove(*socket)
+		listener, err = net.Listen("unix", *socket)
+	}
+	if err != nil {
+		logger.Fatalf("Failed to listen: %v", err)
+	}
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+
+	server := sidecar.NewServer(publisher, subscriber)
+	server.LockDuration = *lockDuration
+	mux := http.NewServeMux()
+	mux.Handle("/", server)
+	if *ui {
+		mux.Handle("/ui/", sidecar.NewUI(client, sidecar.UIOptions{}))
+	}
+	var handler http.Handler = mux
+	if authorizer != nil {
+		handler = auth.Middleware(authorizer, mux)
+	}
+	httpServer := &http.Server{Handler: handler}
+
+	// Serve returns as soon as Shutdown starts; wait for the shutdown to
+	// finish before the deferred closes run
+	shutdown := make(chan struct{})
+	go func() {
+		defer close(shutdown)
+		<-ctx.Done()
+		logger.Println("Shutdown signal received")
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+		if subscriber != nil {
+			server.Close(shutdownCtx)
+		}
+	}()
+
+	logger.Printf("Listening on %s", listener.Addr())
+	if err := httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Fatalf("Server error: %v", err)
+	}
+	<-shutdown
+	logger.Println("Gracefully shut down")
+}
+
+// isLoopback reports whether a listen address only accepts local connections.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return host == "localhost" || ip != nil && ip.IsLoopback()
+}
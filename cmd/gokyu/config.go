@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/venderneutral/gokyu"
+)
+
+// destinationFlags holds the destination flags shared by all commands.
+// Defaults come from the GOKYU_* environment variables.
+type destinationFlags struct {
+	queue        string
+	topic        string
+	subscription string
+}
+
+// register adds the destination flags to a flag set.
+func (d *destinationFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&d.queue, "queue", os.Getenv(gokyu.EnvQueue), "queue name")
+	fs.StringVar(&d.topic, "topic", os.Getenv(gokyu.EnvTopic), "topic name")
+	fs.StringVar(&d.subscription, "subscription", os.Getenv(gokyu.EnvSubscription), "subscription name")
+}
+
+// newClient creates a client from the environment with the destination
+// replaced by the flag values.
+func (d *destinationFlags) newClient() (*gokyu.Client, error) {
+	// Destination flags take precedence, so validate only after applying them
+	os.Setenv(gokyu.EnvQueue, d.queue)
+	os.Setenv(gokyu.EnvTopic, d.topic)
+	os.Setenv(gokyu.EnvSubscription, d.subscription)
+	return gokyu.NewClientFromEnv()
+}
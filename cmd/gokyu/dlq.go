@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+)
+
+// dlqActions are the dlq subcommands.
+var dlqActions = map[string]string{
+	"ls":      "list dead-lettered messages",
+	"show":    "print dead-lettered messages in full",
+	"requeue": "publish dead-lettered messages back to the queue or topic and remove them",
+	"purge":   "remove dead-lettered messages",
+}
+
+func runDLQ(ctx context.Context, args []string) error {
+	if len(args) == 0 || dlqActions[args[0]] == "" {
+		fmt.Fprintln(os.Stderr, "Usage: gokyu dlq <action> [flags]")
+		fmt.Fprintln(os.Stderr)
+		for _, action := range []string{"ls", "show", "requeue", "purge"} {
+			fmt.Fprintf(os.Stderr, "  %-8s %s\n", action, dlqActions[action])
+		}
+		return errors.New("missing or unknown action")
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("dlq "+action, flag.ContinueOnError)
+	var dest destinationFlags
+	dest.register(fs)
+	var sel selector
+	sel.register(fs)
+	address := fs.String("dlq", "", "dead-letter queue address (default: the provider's convention)")
+	idle := fs.Duration("idle", 5*time.Second, "stop when no message arrives for this long")
+	yes := fs.Bool("yes", false, "confirm requeue and purge")
+	noColor := fs.Bool("no-color", false, "disable colorized output")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if err := sel.compile(); err != nil {
+		return err
+	}
+	if (action == "requeue" || action == "purge") && !*yes {
+		return fmt.Errorf("%s removes messages from the dead-letter queue; pass -yes to confirm", action)
+	}
+
+	client, err := dest.newClient()
+	if err != nil {
+		return err
+	}
+	if *address != "" {
+		cfg := client.Config()
+		cfg.DeadLetterQueue = *address
+		if client, err = gokyu.NewClient(&cfg); err != nil {
+			return err
+		}
+	}
+	subscriber, err := client.NewDeadLetterSubscriber(ctx)
+	if err != nil {
+		return err
+	}
+	defer subscriber.Close(context.Background())
+
+	var handle func(msg *gokyu.Message) (bool, error)
+	switch action {
+	case "ls":
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		defer w.Flush()
+		fmt.Fprintln(w, "ID\tENQUEUED\tREASON")
+		handle = func(msg *gokyu.Message) (bool, error) {
+			enqueued := "-"
+			if !msg.EnqueuedTime.IsZero() {
+				enqueued = msg.EnqueuedTime.UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", msg.ID, enqueued, oneLine(gokyu.DeadLetterReason(msg)))
+			return false, nil
+		}
+	case "show":
+		p := &printer{w: os.Stdout, color: !*noColor && isTerminal(os.Stdout)}
+		handle = func(msg *gokyu.Message) (bool, error) {
+			p.print(msg, decodeBody(msg, false))
+			return false, nil
+		}
+	case "requeue":
+		publisher, err := client.NewPublisher(ctx)
+		if err != nil {
+			return err
+		}
+		defer publisher.Close(context.Background())
+		handle = func(msg *gokyu.Message) (bool, error) {
+			return true, publisher.Publish(ctx, gokyu.NewRequeueMessage(msg))
+		}
+	case "purge":
+		handle = func(msg *gokyu.Message) (bool, error) {
+			return true, nil
+		}
+	}
+
+	n, err := scanDeadLetters(ctx, subscriber, &sel, *idle, handle)
+	if action != "ls" && action != "show" {
+		fmt.Fprintf(os.Stderr, "%sd %d messages\n", action, n)
+	}
+	return err
+}
+
+// scanDeadLetters passes every selected message of the backlog to handle,
+// which reports whether to remove it. Other messages are released. It returns
+// the number of messages handled.
+func scanDeadLetters(ctx context.Context, sub gokyu.Subscriber, sel *selector, idle time.Duration, handle func(*gokyu.Message) (bool, error)) (int, error) {
+	seen := make(map[string]bool)
+	n := 0
+	for sel.limit == 0 || n < sel.limit {
+		recvCtx, cancel := context.WithTimeout(ctx, idle)
+		msg, err := sub.Receive(recvCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() == nil && errors.Is(recvCtx.Err(), context.DeadlineExceeded) {
+				return n, nil
+			}
+			return n, err
+		}
+
+		// Released messages come around again once the backlog wraps
+		if msg.ID != "" && seen[msg.ID] {
+			return n, sub.Nack(ctx, msg)
+		}
+		seen[msg.ID] = true
+
+		if !sel.match(msg) {
+			if err := sub.Nack(ctx, msg); err != nil {
+				return n, err
+			}
+			continue
+		}
+
+		remove, err := handle(msg)
+		if err != nil {
+			sub.Nack(ctx, msg)
+			return n, err
+		}
+		if remove {
+			err = sub.Ack(ctx, msg)
+		} else {
+			err = sub.Nack(ctx, msg)
+		}
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// selector selects dead-lettered messages by time range, reason and filter.
+type selector struct {
+	since  string
+	until  string
+	reason string
+	filter string
+	limit  int
+
+	from, to time.Time
+	expr     *expr
+}
+
+// register adds the selection flags to a flag set.
+func (s *selector) register(fs *flag.FlagSet) {
+	fs.StringVar(&s.since, "since", "", "only messages enqueued at or after this RFC 3339 time or duration ago, e.g. 2h")
+	fs.StringVar(&s.until, "until", "", "only messages enqueued before this RFC 3339 time or duration ago")
+	fs.StringVar(&s.reason, "reason", "", "only messages whose dead-letter reason contains this text")
+	fs.StringVar(&s.filter, "filter", "", `jq-style filter, e.g. '.properties.tenant == "acme"'`)
+	fs.IntVar(&s.limit, "n", 0, "stop after n selected messages (0 means unlimited)")
+}
+
+// compile parses the flag values.
+func (s *selector) compile() error {
+	now := time.Now()
+	var err error
+	if s.from, err = parseTime(s.since, now); err != nil {
+		return fmt.Errorf("-since: %w", err)
+	}
+	if s.to, err = parseTime(s.until, now); err != nil {
+		return fmt.Errorf("-until: %w", err)
+	}
+	if s.filter != "" {
+		if s.expr, err = parseExpr(s.filter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// match reports whether a message is selected.
+func (s *selector) match(msg *gokyu.Message) bool {
+	if !s.from.IsZero() && msg.EnqueuedTime.Before(s.from) {
+		return false
+	}
+	if !s.to.IsZero() && !msg.EnqueuedTime.Before(s.to) {
+		return false
+	}
+	if s.reason != "" && !strings.Contains(strings.ToLower(gokyu.DeadLetterReason(msg)), strings.ToLower(s.reason)) {
+		return false
+	}
+	return s.expr == nil || s.expr.match(envelope(msg, false))
+}
+
+// parseTime parses an RFC 3339 time or a duration before now. The empty
+// string yields the zero time.
+func parseTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither an RFC 3339 time nor a duration", s)
+	}
+	return t, nil
+}
+
+// oneLine collapses whitespace so a reason fits in a table cell.
+func oneLine(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+)
+
+// backlogSubscriber redelivers released messages at the end of its backlog,
+// like a broker queue.
+type backlogSubscriber struct {
+	backlog []*gokyu.Message
+	acked   []string
+}
+
+func (s *backlogSubscriber) Receive(ctx context.Context) (*gokyu.Message, error) {
+	if len(s.backlog) == 0 {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	msg := s.backlog[0]
+	s.backlog = s.backlog[1:]
+	return msg, nil
+}
+
+func (s *backlogSubscriber) Ack(ctx context.Context, msg *gokyu.Message) error {
+	s.acked = append(s.acked, msg.ID)
+	return nil
+}
+
+func (s *backlogSubscriber) Nack(ctx context.Context, msg *gokyu.Message) error {
+	s.backlog = append(s.backlog, msg)
+	return nil
+}
+
+func (s *backlogSubscriber) Close(ctx context.Context) error { return nil }
+
+func deadLetter(id string, enqueued time.Time, reason string, props map[string]interface{}) *gokyu.Message {
+	msg := gokyu.NewMessage([]byte(`{"id":"` + id + `"}`))
+	msg.ID = id
+	msg.EnqueuedTime = enqueued
+	msg.Properties[gokyu.PropertyDeadLetterReason] = reason
+	for k, v := range props {
+		msg.Properties[k] = v
+	}
+	return msg
+}
+
+func TestScanDeadLetters(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	newBacklog := func() *backlogSubscriber {
+		return &backlogSubscriber{backlog: []*gokyu.Message{
+			deadLetter("m1", now.Add(-3*time.Hour), "MaxDeliveryCountExceeded", map[string]interface{}{"tenant": "acme"}),
+			deadLetter("m2", now.Add(-time.Hour), "TTLExpiredException", map[string]interface{}{"tenant": "acme"}),
+			deadLetter("m3", now.Add(-time.Hour), "MaxDeliveryCountExceeded", map[string]interface{}{"tenant": "globex"}),
+		}}
+	}
+
+	tests := []struct {
+		name string
+		sel  selector
+		want []string
+	}{
+		{name: "all", want: []string{"m1", "m2", "m3"}},
+		{name: "since", sel: selector{from: now.Add(-2 * time.Hour)}, want: []string{"m2", "m3"}},
+		{name: "until", sel: selector{to: now.Add(-2 * time.Hour)}, want: []string{"m1"}},
+		{name: "reason", sel: selector{reason: "maxdelivery"}, want: []string{"m1", "m3"}},
+		{name: "filter", sel: selector{filter: `.properties.tenant == "acme"`}, want: []string{"m1", "m2"}},
+		{name: "limit", sel: selector{limit: 2}, want: []string{"m1", "m2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.sel.filter != "" {
+				if err := tt.sel.compile(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			sub := newBacklog()
+			var handled []string
+			n, err := scanDeadLetters(context.Background(), sub, &tt.sel, 50*time.Millisecond, func(msg *gokyu.Message) (bool, error) {
+				handled = append(handled, msg.ID)
+				return true, nil
+			})
+			if err != nil {
+				t.Fatalf("scanDeadLetters() error = %v", err)
+			}
+			if n != len(tt.want) || len(handled) != len(tt.want) {
+				t.Fatalf("handled %v (n = %d), want %v", handled, n, tt.want)
+			}
+			for i := range tt.want {
+				if handled[i] != tt.want[i] || sub.acked[i] != tt.want[i] {
+					t.Errorf("handled %v, acked %v, want %v", handled, sub.acked, tt.want)
+				}
+			}
+			if len(sub.backlog) != 3-len(tt.want) {
+				t.Errorf("%d messages left, want %d", len(sub.backlog), 3-len(tt.want))
+			}
+		})
+	}
+}
+
+func TestScanDeadLetters_StopsAfterOnePass(t *testing.T) {
+	now := time.Now()
+	sub := &backlogSubscriber{backlog: []*gokyu.Message{
+		deadLetter("m1", now, "a", nil),
+		deadLetter("m2", now, "b", nil),
+	}}
+
+	n, err := scanDeadLetters(context.Background(), sub, &selector{}, time.Minute, func(msg *gokyu.Message) (bool, error) {
+		return false, nil
+	})
+	if err != nil {
+		t.Fatalf("scanDeadLetters() error = %v", err)
+	}
+	if n != 2 || len(sub.acked) != 0 || len(sub.backlog) != 2 {
+		t.Errorf("n = %d, acked %v, %d left; want 2 listed and none removed", n, sub.acked, len(sub.backlog))
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	if got, _ := parseTime("", now); !got.IsZero() {
+		t.Errorf("parseTime(\"\") = %v, want zero", got)
+	}
+	if got, _ := parseTime("90m", now); !got.Equal(now.Add(-90 * time.Minute)) {
+		t.Errorf("parseTime(90m) = %v", got)
+	}
+	if got, _ := parseTime("2024-02-29T08:00:00Z", now); !got.Equal(time.Date(2024, 2, 29, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("parseTime(RFC 3339) = %v", got)
+	}
+	if _, err := parseTime("yesterday", now); err == nil {
+		t.Error("parseTime(yesterday) should fail")
+	}
+}
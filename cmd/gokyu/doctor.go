@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+)
+
+// doctorHints suggest what to look at when a check fails.
+var doctorHints = map[string]string{
+	gokyu.CheckConfig:    "check the GOKYU_* environment variables",
+	gokyu.CheckDNS:       "check the host name in the connection string and the DNS settings of this machine",
+	gokyu.CheckTCP:       "check that the broker is running and that firewalls and security groups allow the port",
+	gokyu.CheckTLS:       "check the system CA certificates, GOKYU_TLS_SERVER_NAME, and for TLS-intercepting proxies",
+	gokyu.CheckAuth:      "check the credentials and that the user or key may access the broker",
+	gokyu.CheckPublish:   "check that the queue or topic exists and that the credentials may send to it",
+	gokyu.CheckReceive:   "check that the queue or subscription exists and that the credentials may receive from it",
+	gokyu.CheckRoundTrip: "check for other consumers taking the probe and for subscription filters",
+}
+
+func runDoctor(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	var dest destinationFlags
+	dest.register(fs)
+	roundTrip := fs.Bool("round-trip", false, "publish a probe message and wait for it to be received")
+	timeout := fs.Duration("timeout", 10*time.Second, "how long to wait for the probe message")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	client, err := dest.newClient()
+	if err != nil {
+		return err
+	}
+
+	opts := gokyu.DiagnoseOptions{RoundTrip: *roundTrip, Timeout: *timeout}
+	if !*asJSON {
+		fmt.Printf("Diagnosing %s\n\n", client.Config().Provider)
+		opts.Progress = func(check gokyu.CheckResult) { printCheck(os.Stdout, check) }
+	}
+	report := client.Diagnose(ctx, opts)
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	}
+
+	failed := 0
+	for _, check := range report.Checks {
+		if check.Status == gokyu.CheckFailed {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(report.Checks))
+	}
+	return nil
+}
+
+// printCheck prints one check result, with a hint if it failed.
+func printCheck(w io.Writer, check gokyu.CheckResult) {
+	duration := ""
+	if check.Status != gokyu.CheckSkipped {
+		duration = check.Duration.Round(time.Millisecond).String()
+	}
+	line := fmt.Sprintf("%-12s %-4s %7s  %s", check.Name, check.Status, duration, check.Detail)
+	fmt.Fprintln(w, strings.TrimRight(line, " "))
+	if hint, ok := doctorHints[check.Name]; ok && check.Status == gokyu.CheckFailed {
+		fmt.Fprintf(w, "%27s→ %s\n", "", hint)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+)
+
+func runExport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	var dest destinationFlags
+	dest.register(fs)
+	output := fs.String("o", "-", "output file ('-' for stdout)")
+	limit := fs.Int("n", 0, "export at most n messages (0 means the whole backlog)")
+	idle := fs.Duration("idle", 5*time.Second, "stop when no message arrives for this long")
+	ack := fs.Bool("ack", false, "consume exported messages instead of releasing them")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	client, err := dest.newClient()
+	if err != nil {
+		return err
+	}
+	subscriber, err := client.NewSubscriber(ctx)
+	if err != nil {
+		return err
+	}
+	defer subscriber.Close(context.Background())
+
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	n, err := gokyu.Export(ctx, subscriber, w, gokyu.ExportOptions{
+		Limit:       *limit,
+		IdleTimeout: *idle,
+		Ack:         *ack,
+	})
+	fmt.Fprintf(os.Stderr, "exported %d messages\n", n)
+	return err
+}
+
+func runImport(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	var dest destinationFlags
+	dest.register(fs)
+	input := fs.String("i", "-", "input file ('-' for stdin)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	client, err := dest.newClient()
+	if err != nil {
+		return err
+	}
+	publisher, err := client.NewPublisher(ctx)
+	if err != nil {
+		return err
+	}
+	defer publisher.Close(context.Background())
+
+	var r io.Reader = os.Stdin
+	if *input != "-" {
+		f, err := os.Open(*input)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	n, err := gokyu.Import(ctx, publisher, r)
+	fmt.Fprintf(os.Stderr, "imported %d messages\n", n)
+	return err
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// expr is a jq-style filter expression of the form "path [op literal]",
+// for example:
+//
+//	.body.status == "paid"
+//	.properties.tenant != "internal"
+//	.body.items[0].price >= 100
+//	.body.priority
+//
+// Paths start with "." and select object keys with ".name" or ["name"] and
+// array elements with [index]. Without a comparison, the expression matches
+// when the path exists and is neither null nor false.
+type expr struct {
+	path    []interface{} // string keys and int indexes
+	op      string
+	operand interface{}
+}
+
+var comparisonOps = []string{"==", "!=", ">=", "<=", ">", "<"}
+
+// parseExpr parses a filter expression.
+func parseExpr(s string) (*expr, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, ".") {
+		return nil, fmt.Errorf("expression must start with '.': %q", s)
+	}
+
+	e := &expr{}
+	rest, err := e.parsePath(s)
+	if err != nil {
+		return nil, err
+	}
+
+	rest = strings.TrimSpace(rest)
+	if rest == "" {
+		return e, nil
+	}
+
+	for _, op := range comparisonOps {
+		if literal, ok := strings.CutPrefix(rest, op); ok {
+			e.op = op
+			if err := json.Unmarshal([]byte(strings.TrimSpace(literal)), &e.operand); err != nil {
+				return nil, fmt.Errorf("invalid literal %q: %v", strings.TrimSpace(literal), err)
+			}
+			return e, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected %q in expression", rest)
+}
+
+// parsePath consumes the path at the start of s and returns the remainder.
+func (e *expr) parsePath(s string) (string, error) {
+	i := 0
+	for i < len(s) {
+		switch s[i] {
+		case '.':
+			i++
+			start := i
+			for i < len(s) && (isIdentChar(s[i])) {
+				i++
+			}
+			if i > start {
+				e.path = append(e.path, s[start:i])
+			}
+		case '[':
+			end := strings.IndexByte(s[i:], ']')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated '[' in %q", s)
+			}
+			inner := strings.TrimSpace(s[i+1 : i+end])
+			if unquoted, err := strconv.Unquote(inner); err == nil {
+				e.path = append(e.path, unquoted)
+			} else if n, err := strconv.Atoi(inner); err == nil {
+				e.path = append(e.path, n)
+			} else {
+				return "", fmt.Errorf("invalid index %q", inner)
+			}
+			i += end + 1
+		default:
+			return s[i:], nil
+		}
+	}
+	return "", nil
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '-' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// match evaluates the expression against a decoded JSON document.
+func (e *expr) match(doc interface{}) bool {
+	v, ok := e.lookup(doc)
+	if e.op == "" {
+		return ok && v != nil && v != false
+	}
+	if !ok {
+		return e.op == "!="
+	}
+
+	switch e.op {
+	case "==":
+		return equal(v, e.operand)
+	case "!=":
+		return !equal(v, e.operand)
+	}
+
+	a, aok := v.(float64)
+	b, bok := e.operand.(float64)
+	if !aok || !bok {
+		as, asok := v.(string)
+		bs, bsok := e.operand.(string)
+		if !asok || !bsok {
+			return false
+		}
+		return compare(strings.Compare(as, bs), e.op)
+	}
+	switch {
+	case a < b:
+		return compare(-1, e.op)
+	case a > b:
+		return compare(1, e.op)
+	default:
+		return compare(0, e.op)
+	}
+}
+
+// lookup follows the path through doc.
+func (e *expr) lookup(doc interface{}) (interface{}, bool) {
+	v := doc
+	for _, step := range e.path {
+		switch key := step.(type) {
+		case string:
+			m, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			if v, ok = m[key]; !ok {
+				return nil, false
+			}
+		case int:
+			a, ok := v.([]interface{})
+			if !ok || key < 0 || key >= len(a) {
+				return nil, false
+			}
+			v = a[key]
+		}
+	}
+	return v, true
+}
+
+// equal compares two decoded JSON values.
+func equal(a, b interface{}) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return string(ja) == string(jb)
+}
+
+// compare applies an ordering operator to the result of a comparison.
+func compare(cmp int, op string) bool {
+	switch op {
+	case ">":
+		return cmp > 0
+	case "<":
+		return cmp < 0
+	case ">=":
+		return cmp >= 0
+	case "<=":
+		return cmp <= 0
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestExpr_Match(t *testing.T) {
+	var doc interface{}
+	json.Unmarshal([]byte(`{
+		"id": "m1",
+		"properties": {"tenant": "acme", "retry": false},
+		"body": {"status": "paid", "total": 120.5, "items": [{"sku": "a-1"}, {"sku": "b-2"}]}
+	}`), &doc)
+
+	tests := []struct {
+		expr string
+		want bool
+	}{
+		{expr: `.body.status == "paid"`, want: true},
+		{expr: `.body.status != "paid"`, want: false},
+		{expr: `.properties.tenant == "other"`, want: false},
+		{expr: `.body.total > 100`, want: true},
+		{expr: `.body.total <= 100`, want: false},
+		{expr: `.body.items[1].sku == "b-2"`, want: true},
+		{expr: `.body["items"][0]["sku"] == "a-1"`, want: true},
+		{expr: `.body.items[5].sku == "a-1"`, want: false},
+		{expr: `.body.missing != 1`, want: true},
+		{expr: `.body.status`, want: true},
+		{expr: `.properties.retry`, want: false},
+		{expr: `.body.missing`, want: false},
+		{expr: `.`, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			e, err := parseExpr(tt.expr)
+			if err != nil {
+				t.Fatalf("parseExpr() error = %v", err)
+			}
+			if got := e.match(doc); got != tt.want {
+				t.Errorf("match() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseExpr_Invalid(t *testing.T) {
+	for _, s := range []string{"body.status", `.body[`, `.body.status = 1`, `.body.status == paid`} {
+		if _, err := parseExpr(s); err == nil {
+			t.Errorf("parseExpr(%q) expected error", s)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/venderneutral/gokyu"
+)
+
+func runInfo(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("info", flag.ContinueOnError)
+	provider := fs.String("provider", os.Getenv(gokyu.EnvProvider), "provider to describe (default: all)")
+	asJSON := fs.Bool("json", false, "print JSON instead of a table")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var infos []gokyu.ProviderInfo
+	for _, info := range gokyu.Providers() {
+		if *provider == "" || info.Provider == gokyu.Provider(*provider) {
+			infos = append(infos, info)
+		}
+	}
+	if len(infos) == 0 {
+		return fmt.Errorf("%w: %s", gokyu.ErrUnsupportedProvider, *provider)
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(infos)
+	}
+	return printInfo(os.Stdout, infos)
+}
+
+// printInfo prints the capabilities and guarantees of providers, one block
+// per provider.
+func printInfo(w io.Writer, infos []gokyu.ProviderInfo) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for i, info := range infos {
+		if i > 0 {
+			fmt.Fprintln(tw)
+		}
+		g := info.Guarantees
+		maxSize := "no fixed limit"
+		if g.MaxMessageSize > 0 {
+			maxSize = formatBytes(g.MaxMessageSize)
+		}
+		fmt.Fprintf(tw, "%s\n", info.Provider)
+		fmt.Fprintf(tw, "  delivery\t%s\n", g.Delivery)
+		fmt.Fprintf(tw, "  ordering\t%s\n", g.Ordering)
+		fmt.Fprintf(tw, "  deduplication\t%s\n", g.Deduplication)
+		fmt.Fprintf(tw, "  max message size\t%s\n", maxSize)
+		fmt.Fprintf(tw, "  scheduling\t%s\n", info.Capabilities.Scheduling)
+		fmt.Fprintf(tw, "  priority\t%s\n", info.Capabilities.Priority)
+		fmt.Fprintf(tw, "  addressing\t%s\n", info.Capabilities.Addressing)
+		for _, note := range g.Notes {
+			fmt.Fprintf(tw, "  note\t%s\n", note)
+		}
+	}
+	return tw.Flush()
+}
+
+// formatBytes formats n in the largest binary unit that divides it.
+func formatBytes(n int64) string {
+	for _, unit := range []struct {
+		size int64
+		name string
+	}{{1 << 30, "GiB"}, {1 << 20, "MiB"}, {1 << 10, "KiB"}} {
+		if n%unit.size == 0 {
+			return fmt.Sprintf("%d %s", n/unit.size, unit.name)
+		}
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
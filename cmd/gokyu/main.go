@@ -0,0 +1,82 @@
+// Command gokyu is a command-line tool for working with message queues through
+// any gokyu provider.
+//
+// The broker is configured with the standard GOKYU_* environment variables;
+// the destination can be overridden with flags on each command.
+//
+// Usage:
+//
+//	gokyu <command> [flags]
+//
+// Commands:
+//
+//	tail    stream messages with decoded bodies
+//	export  write a queue or subscription backlog to a file
+//	import  publish messages from an export file
+//	dlq     browse and manage dead-lettered messages
+//	serve   serve the sidecar HTTP API and, with -ui, the web admin UI
+//	info    describe the delivery guarantees and capabilities of providers
+//	doctor  diagnose the connection to the broker step by step
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	_ "github.com/venderneutral/gokyu/providers" // Register all providers
+)
+
+// command is a gokyu subcommand.
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, args []string) error
+}
+
+var commands = []command{
+	{name: "tail", summary: "stream messages with decoded bodies", run: runTail},
+	{name: "export", summary: "write a queue or subscription backlog to a file", run: runExport},
+	{name: "import", summary: "publish messages from an export file", run: runImport},
+	{name: "dlq", summary: "browse and manage dead-lettered messages", run: runDLQ},
+	{name: "serve", summary: "serve the sidecar HTTP API and, with -ui, the web admin UI", run: runServe},
+	{name: "info", summary: "describe the delivery guarantees and capabilities of providers", run: runInfo},
+	{name: "doctor", summary: "diagnose the connection to the broker step by step", run: runDoctor},
+}
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] == "-h" || os.Args[1] == "help" {
+		usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	for _, cmd := range commands {
+		if cmd.name == os.Args[1] {
+			if err := cmd.run(ctx, os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "gokyu %s: %v\n", cmd.name, err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "gokyu: unknown command %q\n\n", os.Args[1])
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: gokyu <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "The broker is configured with GOKYU_* environment variables.")
+}
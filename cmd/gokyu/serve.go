@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+	"github.com/venderneutral/gokyu/auth"
+	"github.com/venderneutral/gokyu/sidecar"
+)
+
+func runServe(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	var dest destinationFlags
+	dest.register(fs)
+	addr := fs.String("addr", "127.0.0.1:8089", "TCP address to listen on")
+	ui := fs.Bool("ui", false, "serve the web admin UI under /ui/")
+	lockDuration := fs.Duration("lock-duration", sidecar.DefaultLockDuration, "how long a received message may go unsettled before it is nacked")
+	var authOpts auth.Options
+	authOpts.RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	tlsConfig, err := authOpts.TLSConfig()
+	if err != nil {
+		return err
+	}
+	authorizer, err := authOpts.Authorizer()
+	if err != nil {
+		return err
+	}
+	if authorizer == nil && !isLoopback(*addr) {
+		fmt.Fprintf(os.Stderr, "Warning: serving %s without authorization\n", *addr)
+	}
+
+	client, err := dest.newClient()
+	if err != nil {
+		return err
+	}
+	publisher, err := client.NewPublisher(ctx)
+	if err != nil {
+		return err
+	}
+	defer publisher.Close(context.Background())
+
+	var subscriber gokyu.Subscriber
+	if cfg := client.Config(); cfg.Queue != "" || cfg.Subscription != "" {
+		if subscriber, err = client.NewSubscriber(ctx); err != nil {
+			return err
+		}
+		defer subscriber.Close(context.Background())
+	}
+
+	server := sidecar.NewServer(publisher, subscriber)
+	server.LockDuration = *lockDuration
+	mux := http.NewServeMux()
+	mux.Handle("/", server)
+	if *ui {
+		mux.Handle("/ui/", sidecar.NewUI(client, sidecar.UIOptions{}))
+	}
+
+	var handler http.Handler = mux
+	if authorizer != nil {
+		handler = auth.Middleware(authorizer, mux)
+	}
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return err
+	}
+	scheme := "http"
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+		scheme = "https"
+	}
+	httpServer := &http.Server{Handler: handler}
+	// Serve returns as soon as Shutdown starts; wait for the shutdown to
+	// finish before the deferred closes run
+	shutdown := make(chan struct{})
+	go func() {
+		defer close(shutdown)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+		if subscriber != nil {
+			server.Close(shutdownCtx)
+		}
+	}()
+
+	if *ui {
+		fmt.Fprintf(os.Stderr, "Serving the UI on %s://%s/ui/\n", scheme, listener.Addr())
+	} else {
+		fmt.Fprintf(os.Stderr, "Listening on %s\n", listener.Addr())
+	}
+	if err := httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	<-shutdown
+	return nil
+}
+
+// isLoopback reports whether a listen address only accepts local connections.
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return host == "localhost" || ip != nil && ip.IsLoopback()
+}
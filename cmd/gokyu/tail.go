@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/venderneutral/gokyu"
+)
+
+// ANSI escape sequences used for colorized output.
+const (
+	colorReset  = "\x1b[0m"
+	colorDim    = "\x1b[2m"
+	colorBold   = "\x1b[1m"
+	colorCyan   = "\x1b[36m"
+	colorBlue   = "\x1b[34m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorPurple = "\x1b[35m"
+)
+
+func runTail(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ContinueOnError)
+	var dest destinationFlags
+	dest.register(fs)
+	filter := fs.String("filter", "", `jq-style filter, e.g. '.body.status == "paid"' or '.properties.tenant'`)
+	count := fs.Int("n", 0, "stop after printing n messages (0 means unlimited)")
+	sample := fs.Float64("sample", 1, "fraction of messages to inspect (0 to 1)")
+	ack := fs.Bool("ack", false, "receive and acknowledge (consume) messages instead of browsing them")
+	noColor := fs.Bool("no-color", false, "disable colorized output")
+	raw := fs.Bool("raw", false, "print bodies as-is without decoding")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var match *expr
+	if *filter != "" {
+		var err error
+		if match, err = parseExpr(*filter); err != nil {
+			return err
+		}
+	}
+
+	client, err := dest.newClient()
+	if err != nil {
+		return err
+	}
+
+	next, closeSource, err := tailSource(ctx, client, *ack)
+	if err != nil {
+		return err
+	}
+	defer closeSource()
+
+	p := &printer{w: os.Stdout, color: !*noColor && isTerminal(os.Stdout), raw: *raw}
+
+	printed := 0
+	for *count == 0 || printed < *count {
+		msg, err := next(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if *sample < 1 && rand.Float64() >= *sample {
+			continue
+		}
+
+		doc := envelope(msg, *raw)
+		if match == nil || match.match(doc) {
+			p.print(msg, doc["body"])
+			printed++
+		}
+	}
+	return nil
+}
+
+// tailSource returns a function reading the next message to print. Without
+// consume it browses, since releasing received messages would count as
+// failed deliveries; with it, it receives and acknowledges them.
+func tailSource(ctx context.Context, client *gokyu.Client, consume bool) (func(context.Context) (*gokyu.Message, error), func(), error) {
+	if !consume {
+		browser, err := client.NewBrowser(ctx)
+		if errors.Is(err, gokyu.ErrUnsupportedProvider) {
+			return nil, nil, fmt.Errorf("%w; tail a dedicated subscription with -ack instead", err)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		return browser.Browse, func() { browser.Close(context.Background()) }, nil
+	}
+
+	subscriber, err := client.NewSubscriber(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	next := func(ctx context.Context) (*gokyu.Message, error) {
+		msg, err := subscriber.Receive(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return msg, subscriber.Ack(ctx, msg)
+	}
+	return next, func() { subscriber.Close(context.Background()) }, nil
+}
+
+// envelope builds the document filters are evaluated against.
+func envelope(msg *gokyu.Message, raw bool) map[string]interface{} {
+	properties := make(map[string]interface{}, len(msg.Properties))
+	for k, v := range msg.Properties {
+		properties[k] = normalize(v)
+	}
+
+	return map[string]interface{}{
+		"id":           msg.ID,
+		"content_type": msg.ContentType,
+		"properties":   properties,
+		"body":         decodeBody(msg, raw),
+	}
+}
+
+// decodeBody decodes JSON bodies and falls back to text for everything else.
+func decodeBody(msg *gokyu.Message, raw bool) interface{} {
+	if !raw && (msg.ContentType == "" || strings.Contains(msg.ContentType, "json")) {
+		var v interface{}
+		if err := gokyu.Decode(msg, &v); err == nil {
+			return v
+		}
+	}
+	if utf8.Valid(msg.Body) {
+		return string(msg.Body)
+	}
+	return fmt.Sprintf("<%d bytes of binary data>", len(msg.Body))
+}
+
+// normalize converts a property value into its JSON representation so that
+// filters compare properties and bodies consistently.
+func normalize(v interface{}) interface{} {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	var out interface{}
+	json.Unmarshal(b, &out)
+	return out
+}
+
+// printer writes messages in a human-friendly format.
+type printer struct {
+	w     io.Writer
+	color bool
+	raw   bool
+}
+
+func (p *printer) paint(color, s string) string {
+	if !p.color {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// print writes a message header, its properties, and its body.
+func (p *printer) print(msg *gokyu.Message, body interface{}) {
+	header := []string{p.paint(colorBold, time.Now().Format(time.RFC3339))}
+	if msg.ID != "" {
+		header = append(header, p.paint(colorDim, "id=")+msg.ID)
+	}
+	if msg.ContentType != "" {
+		header = append(header, p.paint(colorDim, "content-type=")+msg.ContentType)
+	}
+	fmt.Fprintln(p.w, strings.Join(header, "  "))
+
+	keys := make([]string, 0, len(msg.Properties))
+	for k := range msg.Properties {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(p.w, "  %s %v\n", p.paint(colorCyan, k+":"), msg.Properties[k])
+	}
+
+	if s, ok := body.(string); ok {
+		fmt.Fprintln(p.w, s)
+	} else {
+		p.writeJSON(body, "")
+		fmt.Fprintln(p.w)
+	}
+	fmt.Fprintln(p.w)
+}
+
+// writeJSON pretty-prints a decoded JSON value with syntax highlighting.
+func (p *printer) writeJSON(v interface{}, indent string) {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if len(val) == 0 {
+			fmt.Fprint(p.w, "{}")
+			return
+		}
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		fmt.Fprintln(p.w, "{")
+		for i, k := range keys {
+			fmt.Fprintf(p.w, "%s  %s: ", indent, p.paint(colorBlue, strconv.Quote(k)))
+			p.writeJSON(val[k], indent+"  ")
+			if i < len(keys)-1 {
+				fmt.Fprint(p.w, ",")
+			}
+			fmt.Fprintln(p.w)
+		}
+		fmt.Fprintf(p.w, "%s}", indent)
+	case []interface{}:
+		if len(val) == 0 {
+			fmt.Fprint(p.w, "[]")
+			return
+		}
+		fmt.Fprintln(p.w, "[")
+		for i, item := range val {
+			fmt.Fprintf(p.w, "%s  ", indent)
+			p.writeJSON(item, indent+"  ")
+			if i < len(val)-1 {
+				fmt.Fprint(p.w, ",")
+			}
+			fmt.Fprintln(p.w)
+		}
+		fmt.Fprintf(p.w, "%s]", indent)
+	case string:
+		fmt.Fprint(p.w, p.paint(colorGreen, strconv.Quote(val)))
+	case float64:
+		fmt.Fprint(p.w, p.paint(colorPurple, strconv.FormatFloat(val, 'f', -1, 64)))
+	case bool:
+		fmt.Fprint(p.w, p.paint(colorYellow, strconv.FormatBool(val)))
+	case nil:
+		fmt.Fprint(p.w, p.paint(colorDim, "null"))
+	default:
+		b, _ := json.Marshal(val)
+		fmt.Fprint(p.w, string(b))
+	}
+}
+
+// isTerminal reports whether f is attached to a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
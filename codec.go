@@ -0,0 +1,141 @@
+package gokyu
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"strings"
+	"sync"
+)
+
+// ContentTypeJSON is the content type of JSON encoded message bodies.
+const ContentTypeJSON = "application/json"
+
+// Codec encodes and decodes message bodies for a single content type.
+type Codec interface {
+	// ContentType returns the MIME type handled by the codec.
+	ContentType() string
+
+	// Marshal encodes v into a message body.
+	Marshal(v interface{}) ([]byte, error)
+
+	// Unmarshal decodes a message body into v.
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// codecs holds registered codecs keyed by normalized content type.
+var (
+	codecsMu      sync.RWMutex
+	codecs              = map[string]Codec{ContentTypeJSON: JSONCodec{}}
+	fallbackCodec Codec = JSONCodec{}
+	defaultCodec  Codec
+)
+
+// RegisterCodec registers a codec for its content type, replacing any codec
+// previously registered for the same type.
+func RegisterCodec(c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[normalizeContentType(c.ContentType())] = c
+}
+
+// SetFallbackCodec sets the codec used for messages without a content type.
+// Passing nil makes such messages fail to decode. The default is JSON.
+func SetFallbackCodec(c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	fallbackCodec = c
+}
+
+// SetDefaultCodec sets the codec used to decode messages whose content type
+// has no registered codec, e.g. to keep consuming a topic while producers
+// migrate to a new format. Passing nil, the default, makes such messages
+// fail with ErrUnsupportedContentType. Encode does not use it.
+func SetDefaultCodec(c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	defaultCodec = c
+}
+
+// CodecFor returns the codec registered for the given content type. An empty
+// content type resolves to the fallback codec, and one without a registered
+// codec to the default codec, if set.
+func CodecFor(contentType string) (Codec, error) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+
+	c, err := registeredCodec(contentType)
+	if err != nil && contentType != "" && defaultCodec != nil {
+		return defaultCodec, nil
+	}
+	return c, err
+}
+
+// registeredCodec returns the codec registered for the given content type,
+// or the fallback codec for an empty one. The caller holds codecsMu.
+func registeredCodec(contentType string) (Codec, error) {
+	if contentType == "" {
+		if fallbackCodec == nil {
+			return nil, ErrUnsupportedContentType
+		}
+		return fallbackCodec, nil
+	}
+
+	c, ok := codecs[normalizeContentType(contentType)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedContentType, contentType)
+	}
+	return c, nil
+}
+
+// Decode decodes the message body into v using the codec selected by the
+// message's ContentType.
+func Decode(msg *Message, v interface{}) error {
+	c, err := CodecFor(msg.ContentType)
+	if err != nil {
+		return err
+	}
+	if err := c.Unmarshal(msg.Body, v); err != nil {
+		return WrapError(ErrDecodeFailed, err)
+	}
+	return nil
+}
+
+// Encode creates a new message whose body is v encoded with the codec
+// registered for contentType.
+func Encode(contentType string, v interface{}) (*Message, error) {
+	codecsMu.RLock()
+	c, err := registeredCodec(contentType)
+	codecsMu.RUnlock()
+	if err != nil {
+		return nil, err
+	}
+	body, err := c.Marshal(v)
+	if err != nil {
+		return nil, WrapError(ErrEncodeFailed, err)
+	}
+	msg := NewMessage(body)
+	msg.ContentType = c.ContentType()
+	return msg, nil
+}
+
+// normalizeContentType lowercases a content type and strips any parameters
+// such as charset.
+func normalizeContentType(contentType string) string {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mediaType
+	}
+	return strings.ToLower(strings.TrimSpace(contentType))
+}
+
+// JSONCodec encodes message bodies as JSON.
+type JSONCodec struct{}
+
+// ContentType returns "application/json".
+func (JSONCodec) ContentType() string { return ContentTypeJSON }
+
+// Marshal encodes v as JSON.
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+// Unmarshal decodes JSON data into v.
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
@@ -0,0 +1,39 @@
+// Package cbor provides a CBOR (RFC 8949) codec for gokyu.
+//
+// CBOR is a compact binary encoding commonly used by constrained IoT devices.
+//
+// # Usage
+//
+// Import this package to register the codec for "application/cbor":
+//
+//	import _ "github.com/venderneutral/gokyu/codec/cbor"
+//
+// Then encode and decode messages through the gokyu codec registry:
+//
+//	msg, err := gokyu.Encode(cbor.ContentType, reading)
+//	err = gokyu.Decode(msg, &reading)
+package cbor
+
+import (
+	"github.com/fxamacker/cbor/v2"
+	"github.com/venderneutral/gokyu"
+)
+
+// ContentType is the MIME type handled by this codec.
+const ContentType = "application/cbor"
+
+func init() {
+	gokyu.RegisterCodec(Codec{})
+}
+
+// Codec encodes message bodies as CBOR.
+type Codec struct{}
+
+// ContentType returns "application/cbor".
+func (Codec) ContentType() string { return ContentType }
+
+// Marshal encodes v as CBOR.
+func (Codec) Marshal(v interface{}) ([]byte, error) { return cbor.Marshal(v) }
+
+// Unmarshal decodes CBOR data into v.
+func (Codec) Unmarshal(data []byte, v interface{}) error { return cbor.Unmarshal(data, v) }
@@ -0,0 +1,51 @@
+package cbor
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/venderneutral/gokyu"
+)
+
+type reading struct {
+	Sensor string
+	Value  float64
+	Raw    []byte
+}
+
+func TestCodec_RoundTrip(t *testing.T) {
+	in := reading{Sensor: "t-1", Value: 21.5, Raw: []byte{0x01, 0x02}}
+	msg, err := gokyu.Encode(ContentType, in)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	if msg.ContentType != ContentType {
+		t.Errorf("ContentType = %q, want %q", msg.ContentType, ContentType)
+	}
+
+	var out reading
+	if err := gokyu.Decode(msg, &out); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if out.Sensor != in.Sensor || out.Value != in.Value || !bytes.Equal(out.Raw, in.Raw) {
+		t.Errorf("Decode() = %+v, want %+v", out, in)
+	}
+}
+
+func TestCodec_ContentTypes(t *testing.T) {
+	// {"Sensor": "t-2"} as sent by a device
+	body := []byte{0xa1, 0x66, 'S', 'e', 'n', 's', 'o', 'r', 0x63, 't', '-', '2'}
+	msg := gokyu.NewMessage(body)
+	msg.ContentType = "Application/CBOR; charset=binary"
+	var out reading
+	if err := gokyu.Decode(msg, &out); err != nil || out.Sensor != "t-2" {
+		t.Errorf("Decode() = %+v, %v", out, err)
+	}
+
+	bad := gokyu.NewMessage([]byte{0xa1}) // a map missing its entry
+	bad.ContentType = ContentType
+	if err := gokyu.Decode(bad, &out); !errors.Is(err, gokyu.ErrDecodeFailed) {
+		t.Errorf("Decode() of invalid data error = %v, want ErrDecodeFailed", err)
+	}
+}
@@ -0,0 +1,51 @@
+// Package msgpack provides a MessagePack codec for gokyu.
+//
+// MessagePack is a compact binary encoding suited to bandwidth-constrained
+// links where JSON is too verbose.
+//
+// # Usage
+//
+// Import this package to register the codec for "application/msgpack" and
+// its common alias "application/x-msgpack":
+//
+//	import _ "github.com/venderneutral/gokyu/codec/msgpack"
+//
+// Then encode and decode messages through the gokyu codec registry:
+//
+//	msg, err := gokyu.Encode(msgpack.ContentType, reading)
+//	err = gokyu.Decode(msg, &reading)
+package msgpack
+
+import (
+	"github.com/venderneutral/gokyu"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// ContentType is the MIME type handled by this codec.
+const ContentType = "application/msgpack"
+
+// LegacyContentType is the unregistered MIME type that many MessagePack
+// libraries still send, decoded by the same codec.
+const LegacyContentType = "application/x-msgpack"
+
+func init() {
+	gokyu.RegisterCodec(Codec{})
+	gokyu.RegisterCodec(legacyCodec{})
+}
+
+// Codec encodes message bodies as MessagePack.
+type Codec struct{}
+
+// ContentType returns "application/msgpack".
+func (Codec) ContentType() string { return ContentType }
+
+// Marshal encodes v as MessagePack.
+func (Codec) Marshal(v interface{}) ([]byte, error) { return msgpack.Marshal(v) }
+
+// Unmarshal decodes MessagePack data into v.
+func (Codec) Unmarshal(data []byte, v interface{}) error { return msgpack.Unmarshal(data, v) }
+
+// legacyCodec is the codec registered for LegacyContentType.
+type legacyCodec struct{ Codec }
+
+func (legacyCodec) ContentType() string { return LegacyContentType }
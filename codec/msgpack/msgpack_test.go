@@ -0,0 +1,57 @@
+package msgpack
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/venderneutral/gokyu"
+)
+
+type reading struct {
+	Sensor string
+	Value  float64
+	Tags   []string
+}
+
+func TestCodec_RoundTrip(t *testing.T) {
+	in := reading{Sensor: "t-1", Value: 21.5, Tags: []string{"indoor"}}
+	msg, err := gokyu.Encode(ContentType, in)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	if msg.ContentType != ContentType {
+		t.Errorf("ContentType = %q, want %q", msg.ContentType, ContentType)
+	}
+
+	var out reading
+	if err := gokyu.Decode(msg, &out); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if out.Sensor != in.Sensor || out.Value != in.Value || len(out.Tags) != 1 || out.Tags[0] != "indoor" {
+		t.Errorf("Decode() = %+v, want %+v", out, in)
+	}
+}
+
+func TestCodec_ContentTypes(t *testing.T) {
+	body, _ := Codec{}.Marshal(reading{Sensor: "t-2"})
+	for _, contentType := range []string{ContentType, LegacyContentType, "Application/MsgPack; charset=binary"} {
+		msg := gokyu.NewMessage(body)
+		msg.ContentType = contentType
+		var out reading
+		if err := gokyu.Decode(msg, &out); err != nil || out.Sensor != "t-2" {
+			t.Errorf("Decode() with content type %q = %+v, %v", contentType, out, err)
+		}
+	}
+
+	msg, err := gokyu.Encode(LegacyContentType, reading{})
+	if err != nil || msg.ContentType != LegacyContentType {
+		t.Errorf("Encode() with the legacy content type = %v, %v", msg, err)
+	}
+
+	bad := gokyu.NewMessage([]byte{0xc1}) // never used in MessagePack
+	bad.ContentType = ContentType
+	var out reading
+	if err := gokyu.Decode(bad, &out); !errors.Is(err, gokyu.ErrDecodeFailed) {
+		t.Errorf("Decode() of invalid data error = %v, want ErrDecodeFailed", err)
+	}
+}
@@ -0,0 +1,226 @@
+// Package protoany publishes Protocol Buffers events wrapped in
+// google.protobuf.Any, so consumers in any language can tell the concrete
+// event type from the message alone.
+//
+// The body of a message is a serialized Any holding the type URL and the
+// encoded event, and the type URL is also set in the PropertyTypeURL
+// property so routers and filters need not decode the body. On receive,
+// Decode returns a new value of the registered type named by the type URL.
+//
+// The package does not import a protobuf runtime. Types generated with
+// gogo/protobuf (or wrapped to provide Marshal and Unmarshal methods) work
+// as they are; for google.golang.org/protobuf, set Registry.Marshal and
+// Registry.Unmarshal:
+//
+//	events := &protoany.Registry{
+//	    Marshal:   func(v interface{}) ([]byte, error) { return proto.Marshal(v.(proto.Message)) },
+//	    Unmarshal: func(b []byte, v interface{}) error { return proto.Unmarshal(b, v.(proto.Message)) },
+//	}
+//	events.Register("acme.orders.v1.OrderCreated", func() interface{} { return new(ordersv1.OrderCreated) })
+//
+//	msg, err := events.Encode("acme.orders.v1.OrderCreated", created)
+//	// ...
+//	event, err := events.Decode(received)
+//	switch e := event.(type) {
+//	case *ordersv1.OrderCreated:
+//	}
+package protoany
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/venderneutral/gokyu"
+)
+
+// ContentType is the content type of messages holding an Any.
+const ContentType = "application/x-protobuf"
+
+// PropertyTypeURL carries the type URL of the event in an Any message.
+const PropertyTypeURL = "gokyu-type-url"
+
+// TypeURLPrefix is the type URL prefix used by the protobuf runtimes.
+const TypeURLPrefix = "type.googleapis.com/"
+
+// TypeURL returns the type URL of a fully qualified message name.
+func TypeURL(fullName string) string {
+	return TypeURLPrefix + fullName
+}
+
+// typeName returns the message name of a type URL: the part after the last
+// slash.
+func typeName(typeURL string) string {
+	return typeURL[strings.LastIndexByte(typeURL, '/')+1:]
+}
+
+// Marshaler is implemented by messages that encode themselves.
+type Marshaler interface {
+	Marshal() ([]byte, error)
+}
+
+// Unmarshaler is implemented by messages that decode themselves.
+type Unmarshaler interface {
+	Unmarshal(data []byte) error
+}
+
+// Registry maps message names to Go types. The zero value is ready to use.
+type Registry struct {
+	// Marshal encodes messages that do not implement Marshaler.
+	Marshal func(v interface{}) ([]byte, error)
+
+	// Unmarshal decodes into messages that do not implement Unmarshaler.
+	Unmarshal func(data []byte, v interface{}) error
+
+	mu    sync.RWMutex
+	types map[string]func() interface{}
+}
+
+// Register associates a fully qualified message name with a constructor of
+// the Go type to decode it into. Registering a name twice replaces the
+// previous constructor.
+func (r *Registry) Register(fullName string, newMessage func() interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.types == nil {
+		r.types = make(map[string]func() interface{})
+	}
+	r.types[fullName] = newMessage
+}
+
+// Encode returns a message whose body is an Any holding v as the message
+// type fullName.
+func (r *Registry) Encode(fullName string, v interface{}) (*gokyu.Message, error) {
+	var value []byte
+	var err error
+	switch m := v.(type) {
+	case Marshaler:
+		value, err = m.Marshal()
+	default:
+		if r.Marshal == nil {
+			return nil, gokyu.WrapError(gokyu.ErrEncodeFailed, fmt.Errorf("protoany: %T has no Marshal method and Registry.Marshal is not set", v))
+		}
+		value, err = r.Marshal(v)
+	}
+	if err != nil {
+		return nil, gokyu.WrapError(gokyu.ErrEncodeFailed, err)
+	}
+
+	typeURL := TypeURL(fullName)
+	msg := gokyu.NewMessage(MarshalAny(typeURL, value))
+	msg.ContentType = ContentType
+	msg.Properties[PropertyTypeURL] = typeURL
+	return msg, nil
+}
+
+// Decode returns the event in an Any message as a new value of its
+// registered type. Messages of unregistered types fail with
+// gokyu.ErrDecodeFailed.
+func (r *Registry) Decode(msg *gokyu.Message) (interface{}, error) {
+	typeURL, value, err := UnmarshalAny(msg.Body)
+	if err != nil {
+		return nil, gokyu.WrapError(gokyu.ErrDecodeFailed, err)
+	}
+
+	r.mu.RLock()
+	newMessage, ok := r.types[typeName(typeURL)]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, gokyu.WrapError(gokyu.ErrDecodeFailed, fmt.Errorf("protoany: unregistered type %q", typeURL))
+	}
+
+	v := newMessage()
+	switch m := v.(type) {
+	case Unmarshaler:
+		err = m.Unmarshal(value)
+	default:
+		if r.Unmarshal == nil {
+			return nil, gokyu.WrapError(gokyu.ErrDecodeFailed, fmt.Errorf("protoany: %T has no Unmarshal method and Registry.Unmarshal is not set", v))
+		}
+		err = r.Unmarshal(value, v)
+	}
+	if err != nil {
+		return nil, gokyu.WrapError(gokyu.ErrDecodeFailed, err)
+	}
+	return v, nil
+}
+
+// Field numbers and wire types of google.protobuf.Any.
+const (
+	anyTypeURLTag = 1<<3 | wireBytes
+	anyValueTag   = 2<<3 | wireBytes
+
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// MarshalAny returns the protobuf encoding of an Any.
+func MarshalAny(typeURL string, value []byte) []byte {
+	b := make([]byte, 0, len(typeURL)+len(value)+2*binary.MaxVarintLen64)
+	if typeURL != "" {
+		b = append(b, anyTypeURLTag)
+		b = binary.AppendUvarint(b, uint64(len(typeURL)))
+		b = append(b, typeURL...)
+	}
+	if len(value) > 0 {
+		b = append(b, anyValueTag)
+		b = binary.AppendUvarint(b, uint64(len(value)))
+		b = append(b, value...)
+	}
+	return b
+}
+
+// errTruncated reports a malformed Any.
+var errTruncated = errors.New("protoany: truncated Any")
+
+// UnmarshalAny decodes the protobuf encoding of an Any. Unknown fields are
+// skipped.
+func UnmarshalAny(data []byte) (typeURL string, value []byte, err error) {
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return "", nil, errTruncated
+		}
+		data = data[n:]
+
+		switch key & 7 {
+		case wireVarint:
+			if _, n = binary.Uvarint(data); n <= 0 {
+				return "", nil, errTruncated
+			}
+			data = data[n:]
+		case wireFixed64, wireFixed32:
+			size := 8
+			if key&7 == wireFixed32 {
+				size = 4
+			}
+			if len(data) < size {
+				return "", nil, errTruncated
+			}
+			data = data[size:]
+		case wireBytes:
+			length, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < length {
+				return "", nil, errTruncated
+			}
+			field := data[n : n+int(length)]
+			data = data[n+int(length):]
+			switch key {
+			case anyTypeURLTag:
+				typeURL = string(field)
+			case anyValueTag:
+				value = field
+			}
+		default:
+			return "", nil, fmt.Errorf("protoany: unsupported wire type %d", key&7)
+		}
+	}
+	if typeURL == "" {
+		return "", nil, errors.New("protoany: Any has no type URL")
+	}
+	return typeURL, value, nil
+}
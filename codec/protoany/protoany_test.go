@@ -0,0 +1,76 @@
+package protoany
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/venderneutral/gokyu"
+)
+
+// stringValue is a google.protobuf.StringValue with hand-written methods.
+type stringValue struct {
+	Value string
+}
+
+func (s *stringValue) Marshal() ([]byte, error) {
+	return append([]byte{0x0a, byte(len(s.Value))}, s.Value...), nil
+}
+
+func (s *stringValue) Unmarshal(data []byte) error {
+	if len(data) < 2 || data[0] != 0x0a {
+		return errors.New("not a StringValue")
+	}
+	s.Value = string(data[2:])
+	return nil
+}
+
+func TestMarshalAny_Wire(t *testing.T) {
+	// Any{type_url: "t/x", value: "hi"} as encoded by the protobuf runtimes
+	want := []byte{0x0a, 0x03, 't', '/', 'x', 0x12, 0x02, 'h', 'i'}
+	if got := MarshalAny("t/x", []byte("hi")); !bytes.Equal(got, want) {
+		t.Errorf("MarshalAny() = %x, want %x", got, want)
+	}
+
+	// Unknown varint and fixed32 fields are skipped
+	data := append([]byte{0x18, 0x96, 0x01, 0x25, 1, 2, 3, 4}, want...)
+	typeURL, value, err := UnmarshalAny(data)
+	if err != nil || typeURL != "t/x" || string(value) != "hi" {
+		t.Errorf("UnmarshalAny() = %q, %q, %v", typeURL, value, err)
+	}
+
+	for _, bad := range [][]byte{want[:4], {0x12, 0x01, 'x'}, {0x0b}} {
+		if _, _, err := UnmarshalAny(bad); err == nil {
+			t.Errorf("UnmarshalAny(%x) expected an error", bad)
+		}
+	}
+}
+
+func TestRegistry_RoundTrip(t *testing.T) {
+	var r Registry
+	r.Register("google.protobuf.StringValue", func() interface{} { return new(stringValue) })
+
+	msg, err := r.Encode("google.protobuf.StringValue", &stringValue{Value: "hello"})
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	if msg.ContentType != ContentType || msg.Properties[PropertyTypeURL] != "type.googleapis.com/google.protobuf.StringValue" {
+		t.Errorf("unexpected message: %s %v", msg.ContentType, msg.Properties)
+	}
+
+	event, err := r.Decode(msg)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if s, ok := event.(*stringValue); !ok || s.Value != "hello" {
+		t.Errorf("Decode() = %#v", event)
+	}
+
+	unknown := gokyu.NewMessage(MarshalAny(TypeURL("acme.Unknown"), nil))
+	if _, err := r.Decode(unknown); !errors.Is(err, gokyu.ErrDecodeFailed) {
+		t.Errorf("Decode() of an unregistered type error = %v", err)
+	}
+	if _, err := r.Encode("acme.Plain", struct{}{}); !errors.Is(err, gokyu.ErrEncodeFailed) {
+		t.Errorf("Encode() without a marshaler error = %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+// Package protobuf provides a Protocol Buffers codec for gokyu.
+//
+// Unlike codec/protoany, message bodies are the encoded event itself, as
+// published by most protobuf producers, so the consumer must know the type
+// to decode into.
+//
+// # Usage
+//
+// Import this package to register the codec for "application/protobuf":
+//
+//	import _ "github.com/venderneutral/gokyu/codec/protobuf"
+//
+// The registered codec works with types that encode themselves, such as
+// those generated by gogo/protobuf. The package does not import a protobuf
+// runtime; for google.golang.org/protobuf, register a codec with
+// MarshalFunc and UnmarshalFunc set:
+//
+//	gokyu.RegisterCodec(protobuf.Codec{
+//	    MarshalFunc:   func(v interface{}) ([]byte, error) { return proto.Marshal(v.(proto.Message)) },
+//	    UnmarshalFunc: func(b []byte, v interface{}) error { return proto.Unmarshal(b, v.(proto.Message)) },
+//	})
+//
+// Messages published as "application/x-protobuf" are left to codec/protoany,
+// which uses that type for google.protobuf.Any bodies.
+package protobuf
+
+import (
+	"fmt"
+
+	"github.com/venderneutral/gokyu"
+)
+
+// ContentType is the MIME type handled by this codec.
+const ContentType = "application/protobuf"
+
+func init() {
+	gokyu.RegisterCodec(Codec{})
+}
+
+// Marshaler is implemented by messages that encode themselves.
+type Marshaler interface {
+	Marshal() ([]byte, error)
+}
+
+// Unmarshaler is implemented by messages that decode themselves.
+type Unmarshaler interface {
+	Unmarshal(data []byte) error
+}
+
+// Codec encodes message bodies as Protocol Buffers. The zero value handles
+// messages implementing Marshaler and Unmarshaler.
+type Codec struct {
+	// MarshalFunc encodes messages that do not implement Marshaler.
+	MarshalFunc func(v interface{}) ([]byte, error)
+
+	// UnmarshalFunc decodes into messages that do not implement Unmarshaler.
+	UnmarshalFunc func(data []byte, v interface{}) error
+}
+
+// ContentType returns "application/protobuf".
+func (Codec) ContentType() string { return ContentType }
+
+// Marshal encodes v with its Marshal method or Codec.MarshalFunc.
+func (c Codec) Marshal(v interface{}) ([]byte, error) {
+	if m, ok := v.(Marshaler); ok {
+		return m.Marshal()
+	}
+	if c.MarshalFunc == nil {
+		return nil, fmt.Errorf("protobuf: %T has no Marshal method and Codec.MarshalFunc is not set", v)
+	}
+	return c.MarshalFunc(v)
+}
+
+// Unmarshal decodes data into v with its Unmarshal method or
+// Codec.UnmarshalFunc.
+func (c Codec) Unmarshal(data []byte, v interface{}) error {
+	if m, ok := v.(Unmarshaler); ok {
+		return m.Unmarshal(data)
+	}
+	if c.UnmarshalFunc == nil {
+		return fmt.Errorf("protobuf: %T has no Unmarshal method and Codec.UnmarshalFunc is not set", v)
+	}
+	return c.UnmarshalFunc(data, v)
+}
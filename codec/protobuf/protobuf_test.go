@@ -0,0 +1,69 @@
+package protobuf
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/venderneutral/gokyu"
+)
+
+// stringValue is a google.protobuf.StringValue with hand-written methods.
+type stringValue struct {
+	Value string
+}
+
+func (s *stringValue) Marshal() ([]byte, error) {
+	return append([]byte{0x0a, byte(len(s.Value))}, s.Value...), nil
+}
+
+func (s *stringValue) Unmarshal(data []byte) error {
+	if len(data) < 2 || data[0] != 0x0a {
+		return errors.New("not a StringValue")
+	}
+	s.Value = string(data[2:])
+	return nil
+}
+
+func TestCodec_RoundTrip(t *testing.T) {
+	msg, err := gokyu.Encode(ContentType, &stringValue{Value: "hi"})
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	if msg.ContentType != ContentType || string(msg.Body) != "\x0a\x02hi" {
+		t.Errorf("Encode() = %q with content type %q", msg.Body, msg.ContentType)
+	}
+
+	var out stringValue
+	if err := gokyu.Decode(msg, &out); err != nil || out.Value != "hi" {
+		t.Errorf("Decode() = %+v, %v", out, err)
+	}
+
+	bad := gokyu.NewMessage([]byte{0x12})
+	bad.ContentType = ContentType
+	if err := gokyu.Decode(bad, &out); !errors.Is(err, gokyu.ErrDecodeFailed) {
+		t.Errorf("Decode() of invalid data error = %v, want ErrDecodeFailed", err)
+	}
+}
+
+func TestCodec_Funcs(t *testing.T) {
+	type plain struct{ Value string }
+	if _, err := (Codec{}).Marshal(plain{}); err == nil {
+		t.Error("Marshal() of a type without methods succeeded, want error")
+	}
+
+	c := Codec{
+		MarshalFunc: func(v interface{}) ([]byte, error) { return []byte(v.(plain).Value), nil },
+		UnmarshalFunc: func(data []byte, v interface{}) error {
+			v.(*plain).Value = string(data)
+			return nil
+		},
+	}
+	data, err := c.Marshal(plain{Value: "x"})
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	var out plain
+	if err := c.Unmarshal(data, &out); err != nil || out.Value != "x" {
+		t.Errorf("Unmarshal() = %+v, %v", out, err)
+	}
+}
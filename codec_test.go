@@ -0,0 +1,105 @@
+package gokyu
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// upperCodec is a test codec that stores strings upper-cased.
+type upperCodec struct{}
+
+func (upperCodec) ContentType() string { return "text/x-upper" }
+
+func (upperCodec) Marshal(v interface{}) ([]byte, error) {
+	return bytes.ToUpper([]byte(v.(string))), nil
+}
+
+func (upperCodec) Unmarshal(data []byte, v interface{}) error {
+	*(v.(*string)) = string(data)
+	return nil
+}
+
+func TestCodecFor(t *testing.T) {
+	RegisterCodec(upperCodec{})
+
+	tests := []struct {
+		name        string
+		contentType string
+		want        string
+		wantErr     bool
+	}{
+		{name: "json", contentType: "application/json", want: ContentTypeJSON},
+		{name: "parameters and case ignored", contentType: "Application/JSON; charset=utf-8", want: ContentTypeJSON},
+		{name: "registered codec", contentType: "text/x-upper", want: "text/x-upper"},
+		{name: "empty uses fallback", contentType: "", want: ContentTypeJSON},
+		{name: "unknown content type", contentType: "application/x-unknown", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := CodecFor(tt.contentType)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CodecFor() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnsupportedContentType) {
+					t.Errorf("expected ErrUnsupportedContentType, got %v", err)
+				}
+				return
+			}
+			if c.ContentType() != tt.want {
+				t.Errorf("expected codec %q, got %q", tt.want, c.ContentType())
+			}
+		})
+	}
+}
+
+func TestSetDefaultCodec(t *testing.T) {
+	SetDefaultCodec(JSONCodec{})
+	defer SetDefaultCodec(nil)
+
+	// A topic mid-migration: producers still label JSON with an old type
+	msg := &Message{Body: []byte(`{"id":7}`), ContentType: "application/vnd.acme.order+json"}
+	var got struct {
+		ID int `json:"id"`
+	}
+	if err := Decode(msg, &got); err != nil || got.ID != 7 {
+		t.Errorf("Decode() = %+v, %v", got, err)
+	}
+
+	// Registered codecs still win, and Encode does not fall back
+	if c, err := CodecFor("text/x-upper"); err == nil && c.ContentType() == ContentTypeJSON {
+		t.Error("CodecFor() returned the default codec for a registered content type")
+	}
+	if _, err := Encode("application/x-unknown", 1); !errors.Is(err, ErrUnsupportedContentType) {
+		t.Errorf("Encode() with an unknown content type error = %v, want ErrUnsupportedContentType", err)
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	type order struct {
+		ID int `json:"id"`
+	}
+
+	msg, err := Encode(ContentTypeJSON, order{ID: 42})
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	if msg.ContentType != ContentTypeJSON {
+		t.Errorf("expected content type %q, got %q", ContentTypeJSON, msg.ContentType)
+	}
+
+	var got order
+	if err := Decode(msg, &got); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if got.ID != 42 {
+		t.Errorf("expected ID 42, got %d", got.ID)
+	}
+
+	bad := &Message{Body: []byte("not json"), ContentType: ContentTypeJSON}
+	if err := Decode(bad, &got); !errors.Is(err, ErrDecodeFailed) {
+		t.Errorf("expected ErrDecodeFailed, got %v", err)
+	}
+}
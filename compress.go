@@ -0,0 +1,161 @@
+package gokyu
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// PropertyContentEncoding names the compression applied to a message body,
+// e.g. "gzip". Consumers decompress messages that carry it and pass others
+// through, so compressed and uncompressed messages can share a queue.
+const PropertyContentEncoding = "gokyu-content-encoding"
+
+// EncodingGzip is the gzip content encoding.
+const EncodingGzip = "gzip"
+
+// DefaultMaxDecompressedSize bounds the size of decompressed bodies.
+const DefaultMaxDecompressedSize = 64 << 20
+
+// CompressionRule decides whether messages of some content types are
+// compressed.
+type CompressionRule struct {
+	// ContentTypes are the content types the rule applies to: exact types,
+	// "type/*", or "*" for any. Parameters such as charset are ignored.
+	ContentTypes []string
+
+	// Never leaves matching messages uncompressed, e.g. for content types
+	// that are already compressed.
+	Never bool
+
+	// MinSize is the body size from which matching messages are compressed.
+	MinSize int
+}
+
+// matches reports whether the rule applies to a normalized content type.
+func (r CompressionRule) matches(contentType string) bool {
+	for _, pattern := range r.ContentTypes {
+		pattern = normalizeContentType(pattern)
+		switch {
+		case pattern == "*" || pattern == "*/*":
+			return true
+		case strings.HasSuffix(pattern, "/*"):
+			if strings.HasPrefix(contentType, strings.TrimSuffix(pattern, "*")) {
+				return true
+			}
+		case pattern == contentType:
+			return true
+		}
+	}
+	return false
+}
+
+// CompressionPolicy chooses which messages are compressed. The first rule
+// matching a message's content type applies; messages matching no rule are
+// not compressed.
+type CompressionPolicy struct {
+	Rules []CompressionRule
+}
+
+// DefaultCompressionPolicy never compresses content types that are already
+// compressed, and compresses JSON, XML and text bodies from 32 KiB.
+func DefaultCompressionPolicy() CompressionPolicy {
+	return CompressionPolicy{Rules: []CompressionRule{
+		{
+			ContentTypes: []string{"image/*", "audio/*", "video/*", "application/gzip", "application/zip", "application/zstd", "application/x-7z-compressed"},
+			Never:        true,
+		},
+		{
+			ContentTypes: []string{ContentTypeJSON, "application/xml", "text/*"},
+			MinSize:      32 << 10,
+		},
+	}}
+}
+
+// shouldCompress reports whether the policy compresses msg.
+func (p CompressionPolicy) shouldCompress(msg *Message) bool {
+	contentType := normalizeContentType(msg.ContentType)
+	for _, rule := range p.Rules {
+		if rule.matches(contentType) {
+			return !rule.Never && len(msg.Body) >= rule.MinSize
+		}
+	}
+	return false
+}
+
+// CompressHook returns a publish hook that gzips message bodies according to
+// the policy and sets PropertyContentEncoding:
+//
+//	cfg.PublishHooks = append(cfg.PublishHooks, gokyu.CompressHook(gokyu.DefaultCompressionPolicy()))
+//
+// Messages that are already encoded, carry a BodyValue, or would not
+// shrink are left unchanged.
+func CompressHook(policy CompressionPolicy) PublishHook {
+	return func(ctx context.Context, msg *Message) error {
+		if msg.BodyValue != nil || msg.Properties[PropertyContentEncoding] != nil || !policy.shouldCompress(msg) {
+			return nil
+		}
+
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(msg.Body); err != nil {
+			return WrapError(ErrEncodeFailed, err)
+		}
+		if err := zw.Close(); err != nil {
+			return WrapError(ErrEncodeFailed, err)
+		}
+		if buf.Len() >= len(msg.Body) {
+			return nil
+		}
+
+		msg.Body = buf.Bytes()
+		if msg.Properties == nil {
+			msg.Properties = make(map[string]interface{})
+		}
+		msg.Properties[PropertyContentEncoding] = EncodingGzip
+		return nil
+	}
+}
+
+// DecompressHook returns a receive hook that restores the bodies of messages
+// compressed by CompressHook and removes PropertyContentEncoding. Register it
+// at StageDecompress:
+//
+//	pipeline.Register(gokyu.StageDecompress, "gzip", gokyu.DecompressHook(0))
+//
+// Bodies that decompress to more than maxSize bytes
+// (DefaultMaxDecompressedSize if zero) and unknown encodings are rejected
+// with ErrDecodeFailed.
+func DecompressHook(maxSize int) ReceiveHook {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxDecompressedSize
+	}
+	return func(ctx context.Context, msg *Message) error {
+		encoding, ok := msg.Properties[PropertyContentEncoding]
+		if !ok {
+			return nil
+		}
+		if encoding != EncodingGzip {
+			return WrapError(ErrDecodeFailed, fmt.Errorf("unsupported content encoding %v", encoding))
+		}
+
+		zr, err := gzip.NewReader(bytes.NewReader(msg.Body))
+		if err != nil {
+			return WrapError(ErrDecodeFailed, err)
+		}
+		body, err := io.ReadAll(io.LimitReader(zr, int64(maxSize)+1))
+		if err != nil {
+			return WrapError(ErrDecodeFailed, err)
+		}
+		if len(body) > maxSize {
+			return WrapError(ErrDecodeFailed, fmt.Errorf("decompressed body exceeds %d bytes", maxSize))
+		}
+
+		msg.Body = body
+		delete(msg.Properties, PropertyContentEncoding)
+		return nil
+	}
+}
@@ -0,0 +1,96 @@
+package gokyu
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestCompressionPolicy(t *testing.T) {
+	policy := DefaultCompressionPolicy()
+	large := bytes.Repeat([]byte("a"), 32<<10)
+
+	tests := []struct {
+		contentType string
+		body        []byte
+		want        bool
+	}{
+		{ContentTypeJSON, large, true},
+		{"text/plain; charset=utf-8", large, true},
+		{ContentTypeJSON, large[:1024], false},
+		{"application/gzip", large, false},
+		{"image/png", large, false},
+		{"application/octet-stream", large, false}, // no rule
+	}
+	for _, tt := range tests {
+		msg := NewMessage(tt.body)
+		msg.ContentType = tt.contentType
+		if got := policy.shouldCompress(msg); got != tt.want {
+			t.Errorf("shouldCompress(%s, %d bytes) = %v, want %v", tt.contentType, len(tt.body), got, tt.want)
+		}
+	}
+
+	wildcard := CompressionPolicy{Rules: []CompressionRule{{ContentTypes: []string{"*"}}}}
+	if !wildcard.shouldCompress(NewMessage(nil)) {
+		t.Error("expected a wildcard rule to match messages without a content type")
+	}
+}
+
+func TestCompress_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	compress := CompressHook(CompressionPolicy{Rules: []CompressionRule{{ContentTypes: []string{"*"}}}})
+	body := bytes.Repeat([]byte(`{"sku":"A-1"},`), 1000)
+
+	msg := NewMessage(append([]byte(nil), body...))
+	if err := compress(ctx, msg); err != nil {
+		t.Fatalf("compress error = %v", err)
+	}
+	if msg.Properties[PropertyContentEncoding] != EncodingGzip || len(msg.Body) >= len(body) {
+		t.Fatalf("expected a smaller gzip body, got %d bytes %v", len(msg.Body), msg.Properties)
+	}
+
+	// Already encoded messages are not compressed twice
+	compressed := msg.Body
+	if err := compress(ctx, msg); err != nil || !bytes.Equal(msg.Body, compressed) {
+		t.Errorf("expected the encoded message to be unchanged, err = %v", err)
+	}
+
+	if err := DecompressHook(0)(ctx, msg); err != nil {
+		t.Fatalf("decompress error = %v", err)
+	}
+	if !bytes.Equal(msg.Body, body) {
+		t.Error("decompressed body differs from the original")
+	}
+	if _, ok := msg.Properties[PropertyContentEncoding]; ok {
+		t.Error("expected the content encoding property to be removed")
+	}
+
+	// Incompressible bodies are sent as they are
+	small := NewMessage([]byte("x"))
+	if err := compress(ctx, small); err != nil || small.Properties[PropertyContentEncoding] != nil {
+		t.Errorf("expected a one-byte body to stay uncompressed, err = %v", err)
+	}
+}
+
+func TestDecompressHook_Limits(t *testing.T) {
+	ctx := context.Background()
+	msg := NewMessage(bytes.Repeat([]byte("a"), 4096))
+	if err := CompressHook(CompressionPolicy{Rules: []CompressionRule{{ContentTypes: []string{"*"}}}})(ctx, msg); err != nil {
+		t.Fatalf("compress error = %v", err)
+	}
+	if err := DecompressHook(1024)(ctx, msg); !errors.Is(err, ErrDecodeFailed) {
+		t.Errorf("expected the size limit to reject the body, got %v", err)
+	}
+
+	unknown := NewMessage([]byte("data"))
+	unknown.Properties[PropertyContentEncoding] = "br"
+	if err := DecompressHook(0)(ctx, unknown); !errors.Is(err, ErrDecodeFailed) {
+		t.Errorf("expected an unsupported encoding error, got %v", err)
+	}
+
+	plain := NewMessage([]byte("plain"))
+	if err := DecompressHook(0)(ctx, plain); err != nil || string(plain.Body) != "plain" {
+		t.Errorf("expected uncompressed messages to pass through, err = %v", err)
+	}
+}
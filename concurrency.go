@@ -0,0 +1,57 @@
+package gokyu
+
+import "context"
+
+// ConcurrencyLimitedPublisher bounds the number of concurrent Publish calls
+// and reports how many more can start, so upstream producers can shed load
+// instead of queueing behind slow publishes:
+//
+//	pub := gokyu.NewConcurrencyLimitedPublisher(publisher, 64)
+//	if pub.Available() == 0 {
+//	    return errOverloaded // reject the request instead of queueing it
+//	}
+//	err := pub.Publish(ctx, msg)
+//
+// It only counts the publishes of this process. It does not see the broker's
+// flow control or the link credit granted to the sender, which the AMQP
+// providers do not expose, but publishes held up by either stay in flight
+// and so use up the limit.
+type ConcurrencyLimitedPublisher struct {
+	Publisher
+	slots chan struct{}
+}
+
+// NewConcurrencyLimitedPublisher wraps pub so that at most maxInFlight
+// publishes are in progress at once. Further Publish calls wait for a free
+// slot or for their context to be cancelled.
+func NewConcurrencyLimitedPublisher(pub Publisher, maxInFlight int) *ConcurrencyLimitedPublisher {
+	if maxInFlight <= 0 {
+		maxInFlight = 1
+	}
+	return &ConcurrencyLimitedPublisher{
+		Publisher: pub,
+		slots:     make(chan struct{}, maxInFlight),
+	}
+}
+
+// Publish sends a message once an in-flight slot is available.
+func (p *ConcurrencyLimitedPublisher) Publish(ctx context.Context, msg *Message) error {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return WrapError(ErrPublishFailed, ctx.Err())
+	}
+	defer func() { <-p.slots }()
+
+	return p.Publisher.Publish(ctx, msg)
+}
+
+// Available returns the number of publishes that can start without waiting.
+func (p *ConcurrencyLimitedPublisher) Available() int {
+	return cap(p.slots) - len(p.slots)
+}
+
+// InFlight returns the number of publishes in progress.
+func (p *ConcurrencyLimitedPublisher) InFlight() int {
+	return len(p.slots)
+}
@@ -0,0 +1,59 @@
+package gokyu
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// blockingPublisher blocks every Publish until released.
+type blockingPublisher struct {
+	mockPublisher
+	started chan struct{}
+	release chan struct{}
+}
+
+func (p *blockingPublisher) Publish(ctx context.Context, msg *Message) error {
+	p.started <- struct{}{}
+	<-p.release
+	return nil
+}
+
+func TestConcurrencyLimitedPublisher(t *testing.T) {
+	inner := &blockingPublisher{started: make(chan struct{}, 2), release: make(chan struct{})}
+	pub := NewConcurrencyLimitedPublisher(inner, 2)
+
+	if got := pub.Available(); got != 2 {
+		t.Fatalf("expected 2 available slots, got %d", got)
+	}
+
+	done := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() { done <- pub.Publish(context.Background(), NewMessage(nil)) }()
+		<-inner.started
+	}
+
+	if got := pub.Available(); got != 0 {
+		t.Errorf("expected 0 available slots, got %d", got)
+	}
+	if got := pub.InFlight(); got != 2 {
+		t.Errorf("expected 2 in-flight publishes, got %d", got)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := pub.Publish(ctx, NewMessage(nil)); !errors.Is(err, ErrPublishFailed) {
+		t.Errorf("expected saturated publish to fail with ErrPublishFailed, got %v", err)
+	}
+
+	close(inner.release)
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Errorf("Publish() error = %v", err)
+		}
+	}
+	if got := pub.Available(); got != 2 {
+		t.Errorf("expected slots to be released, got %d available", got)
+	}
+}
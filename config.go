@@ -2,8 +2,14 @@ package gokyu
 
 import (
 	"fmt"
+	"net"
 	"net/url"
 	"os"
+	"path"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
 )
 
 // Config holds the configuration for connecting to a message queue.
@@ -11,6 +17,11 @@ type Config struct {
 	// Provider specifies which cloud provider to use.
 	Provider Provider
 
+	// Environment selects presets for where the broker runs. Empty means no
+	// presets; EnvironmentLocal targets a local emulator (see
+	// Config.WithEnvironment).
+	Environment string
+
 	// ConnectionString is the full AMQP connection string.
 	// If provided, it takes precedence over individual connection parameters.
 	ConnectionString string
@@ -27,9 +38,52 @@ type Config struct {
 	// Password for authentication (used if ConnectionString is not provided).
 	Password string
 
+	// Credentials supplies the username and password of every connection in
+	// place of Username, Password and those of ConnectionString, e.g. from
+	// Vault (see the secrets package).
+	Credentials CredentialsProvider
+
 	// UseTLS enables TLS/SSL connection (default: true for cloud providers).
 	UseTLS bool
 
+	// TLSServerName is the name the broker certificate is verified against
+	// (default: the host connected to), for brokers reached through an
+	// address their certificate does not name, such as a tunnel.
+	TLSServerName string
+
+	// TLSInsecureSkipVerify disables verification of the broker
+	// certificate, for test brokers with self-signed certificates. A warning
+	// is logged on every connection; never enable it in production.
+	TLSInsecureSkipVerify bool
+
+	// WebSocket tunnels AMQP over a WebSocket connection to port 443 (80
+	// without TLS) instead of connecting to the AMQP port, for networks that
+	// block 5671. Port overrides the WebSocket port (see Config.WebSocketURL).
+	WebSocket bool
+
+	// Dialer controls how connections are made to hosts that resolve to
+	// several addresses (default: a Dialer with default timeouts).
+	Dialer *Dialer
+
+	// Endpoints resolves the broker URLs to connect to in place of Host and
+	// ConnectionString, e.g. amazonmq.Discovery for active/standby brokers.
+	// Username and Password still authenticate.
+	Endpoints EndpointResolver
+
+	// EntityPrefix is prepended to the names of queues, topics and
+	// dead-letter queues, e.g. "staging-", so that several environments can
+	// share one broker namespace. Names are prefixed exactly once, whether
+	// or not they already start with the prefix (see Config.WithEntityPrefix).
+	EntityPrefix string
+
+	// AllowedDestinations restricts the queues and topics the client may
+	// use to names matching one of these patterns (see path.Match), e.g.
+	// "tenant-a.*", so that shared code cannot cross tenant boundaries.
+	// Names include EntityPrefix. Clients for other entities fail to be
+	// created, and messages relayed elsewhere fail to publish, with a
+	// *DestinationError. Empty allows all.
+	AllowedDestinations []string
+
 	// Queue is the name of the queue for point-to-point messaging.
 	Queue string
 
@@ -38,6 +92,165 @@ type Config struct {
 
 	// Subscription is the name of the subscription (required for receiving from topics).
 	Subscription string
+
+	// AddressTemplate overrides the provider's source address for
+	// subscribers. It is a text/template expanded with the Config, e.g.
+	// "Consumer.{{.Subscription}}.VirtualTopic.{{.Topic}}".
+	AddressTemplate string
+
+	// PublishAddressTemplate overrides the provider's destination address
+	// for publishers, in the same form as AddressTemplate.
+	PublishAddressTemplate string
+
+	// DeadLetterQueue overrides the address of the dead-letter queue read by
+	// Client.NewDeadLetterSubscriber (default: the provider's convention,
+	// "<entity>/$deadletterqueue" on Azure and "ActiveMQ.DLQ" on Amazon MQ).
+	DeadLetterQueue string
+
+	// Redelivery delays and limits the redelivery of nacked messages on
+	// providers that support it (see RedeliveryPolicy).
+	Redelivery *RedeliveryPolicy
+
+	// OnDeadLetter is called whenever a provider dead-letters a message
+	// itself, e.g. after the redelivery limit, so alerts need not poll the
+	// dead-letter queue depth. It must not block. Messages dead-lettered by
+	// the broker, such as on exceeding the Service Bus max delivery count,
+	// are not reported.
+	OnDeadLetter func(DeadLetterEvent)
+
+	// Events receives the events of clients created from the config and of
+	// providers and components given it (see Client.Events). NewClient
+	// creates a bus if it is nil; set it to share one bus between clients.
+	Events *EventBus
+
+	// AnonymousRelay makes Router and TenantPublisher send to all of their
+	// destinations through one relay publisher (see Client.NewRelayPublisher)
+	// instead of one publisher per destination. The provider must support
+	// relay publishers.
+	AnonymousRelay bool
+
+	// ShareConnections makes Client.NewPublisher return handles of one
+	// publisher, and so one connection, for all clients with the same
+	// connection settings and destination, closed when the last handle is.
+	// Connection settings include the password, the TLS settings, the
+	// connection tuning (MaxFrameSize, IdleTimeout, ChannelMax, WriteTimeout,
+	// ConnectionProperties and ConnectionHostname), JMSInterop, QueueType,
+	// MaxPriority and the Credentials, Endpoints and Dialer, compared by identity: clients with
+	// Credentials of a func type never share.
+	// Without it, a second publisher for the same configuration emits
+	// EventDuplicatePublisher as a likely mistake.
+	ShareConnections bool
+
+	// AutoMessageID assigns an ID to every published message that has none.
+	AutoMessageID bool
+
+	// MessageIDGenerator generates IDs when AutoMessageID is enabled (default: NewUUIDv7).
+	MessageIDGenerator func() string
+
+	// MessageIDStrategy derives IDs when AutoMessageID is enabled, e.g.
+	// from the body with BodyHashMessageID so that retried publishes are
+	// deduplicated by the broker. It takes precedence over
+	// MessageIDGenerator.
+	MessageIDStrategy MessageIDStrategy
+
+	// PublishHooks are applied in order to every outgoing message, e.g. to
+	// enrich messages with standard properties (see StaticProperties).
+	PublishHooks []PublishHook
+
+	// PropertyConverter converts published property values that
+	// NormalizeProperties does not support, e.g. JSONPropertyConverter.
+	// Without it such values fail to publish with ErrInvalidProperty.
+	PropertyConverter PropertyConverter
+
+	// RequiredCapabilities are the optional features the application relies
+	// on, checked by Client.Verify: Native requires native support, Emulated
+	// accepts native or emulated support.
+	RequiredCapabilities Capabilities
+
+	// ReceivePipeline runs its hooks on every message received through the
+	// client's subscribers (see NewPipelineSubscriber). Nil means none.
+	ReceivePipeline *Pipeline
+
+	// Quota limits the publish rate and daily volume of every publisher
+	// created by the client (see NewQuotaPublisher). Nil means no limits.
+	Quota *Quota
+
+	// PrefetchCount is the number of messages the broker may deliver ahead
+	// of Receive (default: 1). With AdaptivePrefetch it is the upper bound.
+	PrefetchCount int
+
+	// AdaptivePrefetch adjusts link credit between 1 and PrefetchCount based
+	// on handler latency and in-flight count (see PrefetchController).
+	AdaptivePrefetch bool
+
+	// PrefetchLatencyTarget is the Receive-to-settle latency above which
+	// adaptive prefetch shrinks the window (default: DefaultPrefetchLatencyTarget).
+	PrefetchLatencyTarget time.Duration
+
+	// MaxFrameSize is the largest AMQP frame the connection accepts
+	// (default: 65536, minimum 512). Larger frames cut per-frame round trips
+	// for big messages on high-latency links.
+	MaxFrameSize uint32
+
+	// IdleTimeout is how long the connection may go without receiving a
+	// frame from the broker before it is considered dead (default: 1m; less
+	// than zero disables it). The broker sends heartbeats at half this
+	// interval, so raise it on links with latency spikes.
+	IdleTimeout time.Duration
+
+	// ChannelMax is the highest number of sessions (AMQP channels) on the
+	// connection (default: 65535).
+	ChannelMax uint16
+
+	// WriteTimeout limits each frame write when the context has no
+	// deadline (default: 30s; less than zero disables it).
+	WriteTimeout time.Duration
+
+	// ConnectionProperties are sent to the broker on connection open in
+	// addition to the defaults (see ConnectionProperties), e.g. a service name
+	// or tags such as team and cost center for chargeback on shared brokers.
+	ConnectionProperties map[string]string
+
+	// ConnectionHostname overrides the hostname sent to the broker on
+	// connection open, e.g. with a stable instance name where container
+	// hostnames are random.
+	ConnectionHostname string
+
+	// ConsumerID identifies this consumer instance in Message.Receiver
+	// (default: the hostname, see ConnectionHostname, and process ID).
+	ConsumerID string
+
+	// JMSInterop maps JMS conventions (TextMessage bodies and the JMSType,
+	// JMSCorrelationID and JMSReplyTo headers) to and from gokyu messages,
+	// for interoperation with Java ActiveMQ clients. Amazon MQ only.
+	JMSInterop bool
+
+	// QueueType is the x-queue-type of declared queues, e.g. "quorum" for
+	// a delivery limit (default: the broker's, usually "classic").
+	// RabbitMQ only.
+	QueueType string
+
+	// MaxPriority declares queues with x-max-priority, so that
+	// Message.Priority takes effect natively. Zero declares queues without
+	// priorities. RabbitMQ only.
+	MaxPriority uint8
+
+	// PriorityLevels emulates Message.Priority on providers without native
+	// priority: messages are spread over this many queues or topics (see
+	// PriorityDestination) and subscribers receive from all of them, each
+	// level weighted twice the one below it. Zero or one disables emulation.
+	PriorityLevels int
+
+	// Metrics receives metrics from components created with Client.Metrics,
+	// labelled with the provider, queue, topic and subscription.
+	Metrics Metrics
+
+	// MaxMetricLabelValues caps the distinct values per metric label
+	// (default: DefaultMaxLabelValues).
+	MaxMetricLabelValues int
+
+	// prefixed records the names EntityPrefix was applied to
+	prefixed prefixedNames
 }
 
 // Validate checks that the configuration has all required fields.
@@ -46,12 +259,16 @@ func (c *Config) Validate() error {
 		return ErrInvalidConfig("provider is required")
 	}
 
+	if c.Environment != "" && c.Environment != EnvironmentLocal {
+		return ErrInvalidConfig(fmt.Sprintf("unknown environment %q", c.Environment))
+	}
+
 	if c.ConnectionString == "" {
-		if c.Host == "" {
+		if c.Host == "" && c.Endpoints == nil {
 			return ErrInvalidConfig("host or connection_string is required")
 		}
-		if c.Username == "" || c.Password == "" {
-			return ErrInvalidConfig("username and password are required when connection_string is not provided")
+		if c.Credentials == nil && (c.Username == "" || c.Password == "") {
+			return ErrInvalidConfig("username and password or credentials are required when connection_string is not provided")
 		}
 	}
 
@@ -59,9 +276,48 @@ func (c *Config) Validate() error {
 		return ErrInvalidConfig("either queue or topic must be specified")
 	}
 
+	if c.MaxFrameSize != 0 && c.MaxFrameSize < 512 {
+		return ErrInvalidConfig("max frame size must be at least 512")
+	}
+
+	if c.PriorityLevels < 0 || c.PriorityLevels > MaxPriority+1 {
+		return ErrInvalidConfig("priority levels must be between 0 and 10")
+	}
+
+	for _, pattern := range c.AllowedDestinations {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return ErrInvalidConfig(fmt.Sprintf("invalid allowed destination %q", pattern))
+		}
+	}
+
+	for _, tmpl := range []string{c.AddressTemplate, c.PublishAddressTemplate} {
+		if _, err := c.ExpandAddress(tmpl, ""); err != nil {
+			return ErrInvalidConfig(err.Error())
+		}
+	}
+
 	return nil
 }
 
+// ExpandAddress expands an address template (see AddressTemplate) with the
+// configuration. It returns def if tmpl is empty, so providers can pass
+// their default address.
+func (c *Config) ExpandAddress(tmpl, def string) (string, error) {
+	if tmpl == "" {
+		return def, nil
+	}
+
+	t, err := template.New("address").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("invalid address template: %w", err)
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, c); err != nil {
+		return "", fmt.Errorf("invalid address template: %w", err)
+	}
+	return b.String(), nil
+}
+
 // BuildConnectionString constructs an AMQP connection string from individual parameters.
 func (c *Config) BuildConnectionString() string {
 	if c.ConnectionString != "" {
@@ -82,13 +338,17 @@ func (c *Config) BuildConnectionString() string {
 		}
 	}
 
+	if c.Username == "" && c.Password == "" {
+		return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(strings.Trim(c.Host, "[]"), strconv.Itoa(port)))
+	}
 	encodedPassword := url.QueryEscape(c.Password)
-	return fmt.Sprintf("%s://%s:%s@%s:%d", scheme, c.Username, encodedPassword, c.Host, port)
+	return fmt.Sprintf("%s://%s:%s@%s", scheme, c.Username, encodedPassword, net.JoinHostPort(strings.Trim(c.Host, "[]"), strconv.Itoa(port)))
 }
 
 // Environment variable names for configuration.
 const (
 	EnvProvider         = "GOKYU_PROVIDER"
+	EnvEnvironment      = "GOKYU_ENVIRONMENT"
 	EnvConnectionString = "GOKYU_CONNECTION_STRING"
 	EnvHost             = "GOKYU_HOST"
 	EnvPort             = "GOKYU_PORT"
@@ -97,20 +357,38 @@ const (
 	EnvQueue            = "GOKYU_QUEUE"
 	EnvTopic            = "GOKYU_TOPIC"
 	EnvSubscription     = "GOKYU_SUBSCRIPTION"
+	EnvAutoMessageID    = "GOKYU_AUTO_MESSAGE_ID"
+	EnvPrefetchCount    = "GOKYU_PREFETCH_COUNT"
+	EnvAdaptivePrefetch = "GOKYU_ADAPTIVE_PREFETCH"
+	EnvWebSocket        = "GOKYU_WEBSOCKET"
+	EnvTLSServerName    = "GOKYU_TLS_SERVER_NAME"
+	EnvTLSInsecure      = "GOKYU_TLS_INSECURE_SKIP_VERIFY"
+	EnvPriorityLevels   = "GOKYU_PRIORITY_LEVELS"
+	EnvEntityPrefix     = "GOKYU_ENTITY_PREFIX"
+
+	EnvConnectionProperties = "GOKYU_CONNECTION_PROPERTIES"
+	EnvConnectionHostname   = "GOKYU_CONNECTION_HOSTNAME"
+	EnvConsumerID           = "GOKYU_CONSUMER_ID"
 )
 
 // LoadConfigFromEnv creates a Config from environment variables.
 func LoadConfigFromEnv() (*Config, error) {
 	cfg := &Config{
 		Provider:         Provider(os.Getenv(EnvProvider)),
+		Environment:      os.Getenv(EnvEnvironment),
 		ConnectionString: os.Getenv(EnvConnectionString),
 		Host:             os.Getenv(EnvHost),
 		Username:         os.Getenv(EnvUsername),
 		Password:         os.Getenv(EnvPassword),
+		EntityPrefix:     os.Getenv(EnvEntityPrefix),
 		Queue:            os.Getenv(EnvQueue),
 		Topic:            os.Getenv(EnvTopic),
 		Subscription:     os.Getenv(EnvSubscription),
+		TLSServerName:    os.Getenv(EnvTLSServerName),
 		UseTLS:           true,
+
+		ConnectionHostname: os.Getenv(EnvConnectionHostname),
+		ConsumerID:         os.Getenv(EnvConsumerID),
 	}
 
 	if portStr := os.Getenv(EnvPort); portStr != "" {
@@ -121,6 +399,63 @@ func LoadConfigFromEnv() (*Config, error) {
 		cfg.Port = port
 	}
 
+	if autoID := os.Getenv(EnvAutoMessageID); autoID != "" {
+		enabled, err := strconv.ParseBool(autoID)
+		if err != nil {
+			return nil, ErrInvalidConfig("invalid auto message id flag")
+		}
+		cfg.AutoMessageID = enabled
+	}
+
+	if prefetch := os.Getenv(EnvPrefetchCount); prefetch != "" {
+		n, err := strconv.Atoi(prefetch)
+		if err != nil || n < 0 {
+			return nil, ErrInvalidConfig("invalid prefetch count")
+		}
+		cfg.PrefetchCount = n
+	}
+
+	if adaptive := os.Getenv(EnvAdaptivePrefetch); adaptive != "" {
+		enabled, err := strconv.ParseBool(adaptive)
+		if err != nil {
+			return nil, ErrInvalidConfig("invalid adaptive prefetch flag")
+		}
+		cfg.AdaptivePrefetch = enabled
+	}
+
+	if websocket := os.Getenv(EnvWebSocket); websocket != "" {
+		enabled, err := strconv.ParseBool(websocket)
+		if err != nil {
+			return nil, ErrInvalidConfig("invalid websocket flag")
+		}
+		cfg.WebSocket = enabled
+	}
+
+	if insecure := os.Getenv(EnvTLSInsecure); insecure != "" {
+		enabled, err := strconv.ParseBool(insecure)
+		if err != nil {
+			return nil, ErrInvalidConfig("invalid TLS insecure skip verify flag")
+		}
+		cfg.TLSInsecureSkipVerify = enabled
+	}
+
+	if levels := os.Getenv(EnvPriorityLevels); levels != "" {
+		n, err := strconv.Atoi(levels)
+		if err != nil {
+			return nil, ErrInvalidConfig("invalid priority levels")
+		}
+		cfg.PriorityLevels = n
+	}
+
+	if props := os.Getenv(EnvConnectionProperties); props != "" {
+		parsed, err := ParseConnectionProperties(props)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ConnectionProperties = parsed
+	}
+
+	*cfg = cfg.WithEnvironment()
 	if err := cfg.Validate(); err != nil {
 		return nil, err
 	}
@@ -0,0 +1,271 @@
+// Package conformance is a test suite that any gokyu.ProviderFactory can run
+// against a live broker to verify that it implements the semantics the rest
+// of gokyu relies on: publish/receive round trips, Ack, Nack redelivery,
+// context cancellation and Close.
+//
+// The suite needs a dedicated, otherwise idle queue (or topic and
+// subscription). Messages left over from earlier runs are drained first.
+//
+// # Usage
+//
+//	func TestConformance(t *testing.T) {
+//	    if os.Getenv("GOKYU_CONNECTION_STRING") == "" {
+//	        t.Skip("no broker configured")
+//	    }
+//	    cfg, err := gokyu.LoadConfigFromEnv()
+//	    if err != nil {
+//	        t.Fatal(err)
+//	    }
+//	    conformance.Run(t, &myprovider.Factory{}, cfg, nil)
+//	}
+package conformance
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+)
+
+// Options tunes the suite for slow brokers.
+type Options struct {
+	// ReceiveTimeout bounds how long the suite waits for an expected message
+	// (default: 30s).
+	ReceiveTimeout time.Duration
+
+	// QuietPeriod is how long the suite waits to confirm that no message
+	// arrives, e.g. after an Ack (default: 2s).
+	QuietPeriod time.Duration
+}
+
+// Run runs the conformance suite as subtests of t.
+func Run(t *testing.T, factory gokyu.ProviderFactory, cfg *gokyu.Config, opts *Options) {
+	s := &suite{factory: factory, cfg: cfg}
+	if opts != nil {
+		s.opts = *opts
+	}
+	if s.opts.ReceiveTimeout <= 0 {
+		s.opts.ReceiveTimeout = 30 * time.Second
+	}
+	if s.opts.QuietPeriod <= 0 {
+		s.opts.QuietPeriod = 2 * time.Second
+	}
+
+	t.Run("Drain", s.testDrain)
+	t.Run("PublishReceive", s.testPublishReceive)
+	t.Run("AckRemovesMessage", s.testAck)
+	t.Run("NackRedelivers", s.testNack)
+	t.Run("ReceiveHonorsContext", s.testReceiveContext)
+	t.Run("CloseSubscriber", s.testCloseSubscriber)
+	t.Run("ClosePublisher", s.testClosePublisher)
+}
+
+type suite struct {
+	factory gokyu.ProviderFactory
+	cfg     *gokyu.Config
+	opts    Options
+}
+
+// connect creates a publisher and subscriber that are closed with the test.
+func (s *suite) connect(t *testing.T) (gokyu.Publisher, gokyu.Subscriber) {
+	t.Helper()
+	ctx := context.Background()
+
+	sub, err := s.factory.NewSubscriber(ctx, s.cfg)
+	if err != nil {
+		t.Fatalf("NewSubscriber() error = %v", err)
+	}
+	t.Cleanup(func() { sub.Close(context.Background()) })
+
+	pub, err := s.factory.NewPublisher(ctx, s.cfg)
+	if err != nil {
+		t.Fatalf("NewPublisher() error = %v", err)
+	}
+	t.Cleanup(func() { pub.Close(context.Background()) })
+
+	return pub, sub
+}
+
+// publish sends a message with a unique ID.
+func (s *suite) publish(t *testing.T, pub gokyu.Publisher, body string) *gokyu.Message {
+	t.Helper()
+	msg := gokyu.NewMessage([]byte(body))
+	msg.ID = uniqueID()
+	if err := pub.Publish(context.Background(), msg); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	return msg
+}
+
+// receive waits for the message with the given ID, acking any stray
+// messages from other runs.
+func (s *suite) receive(t *testing.T, sub gokyu.Subscriber, id string) *gokyu.Message {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), s.opts.ReceiveTimeout)
+	defer cancel()
+
+	for {
+		msg, err := sub.Receive(ctx)
+		if err != nil {
+			t.Fatalf("Receive() waiting for %s: %v", id, err)
+		}
+		if msg.ID == id {
+			return msg
+		}
+		sub.Ack(ctx, msg)
+	}
+}
+
+// expectNone fails if the message with the given ID arrives within the quiet period.
+func (s *suite) expectNone(t *testing.T, sub gokyu.Subscriber, id string) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), s.opts.QuietPeriod)
+	defer cancel()
+
+	for {
+		msg, err := sub.Receive(ctx)
+		if err != nil {
+			return
+		}
+		sub.Ack(context.Background(), msg)
+		if msg.ID == id {
+			t.Fatalf("message %s was redelivered after Ack", id)
+		}
+	}
+}
+
+func (s *suite) testDrain(t *testing.T) {
+	_, sub := s.connect(t)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), s.opts.QuietPeriod)
+		msg, err := sub.Receive(ctx)
+		cancel()
+		if err != nil {
+			return
+		}
+		if err := sub.Ack(context.Background(), msg); err != nil {
+			t.Fatalf("Ack() error = %v", err)
+		}
+	}
+}
+
+func (s *suite) testPublishReceive(t *testing.T) {
+	pub, sub := s.connect(t)
+
+	msg := gokyu.NewMessage([]byte(`{"conformance":true}`))
+	msg.ID = uniqueID()
+	msg.ContentType = gokyu.ContentTypeJSON
+	msg.Properties["string"] = "value"
+	msg.Properties["int64"] = int64(42)
+	msg.Properties["bool"] = true
+	if err := pub.Publish(context.Background(), msg); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	got := s.receive(t, sub, msg.ID)
+	defer sub.Ack(context.Background(), got)
+
+	if !bytes.Equal(got.Body, msg.Body) {
+		t.Errorf("Body = %q, want %q", got.Body, msg.Body)
+	}
+	if got.ContentType != msg.ContentType {
+		t.Errorf("ContentType = %q, want %q", got.ContentType, msg.ContentType)
+	}
+	for k, want := range msg.Properties {
+		if v := got.Properties[k]; v != want {
+			t.Errorf("Properties[%q] = %v (%T), want %v (%T)", k, v, v, want, want)
+		}
+	}
+	if got.Raw() == nil {
+		t.Error("Raw() = nil, want provider message for settlement")
+	}
+}
+
+func (s *suite) testAck(t *testing.T) {
+	pub, sub := s.connect(t)
+	msg := s.publish(t, pub, "ack")
+
+	got := s.receive(t, sub, msg.ID)
+	if err := sub.Ack(context.Background(), got); err != nil {
+		t.Fatalf("Ack() error = %v", err)
+	}
+	s.expectNone(t, sub, msg.ID)
+}
+
+func (s *suite) testNack(t *testing.T) {
+	pub, sub := s.connect(t)
+	msg := s.publish(t, pub, "nack")
+
+	got := s.receive(t, sub, msg.ID)
+	if err := sub.Nack(context.Background(), got); err != nil {
+		t.Fatalf("Nack() error = %v", err)
+	}
+
+	again := s.receive(t, sub, msg.ID)
+	if !bytes.Equal(again.Body, msg.Body) {
+		t.Errorf("redelivered Body = %q, want %q", again.Body, msg.Body)
+	}
+	if err := sub.Ack(context.Background(), again); err != nil {
+		t.Fatalf("Ack() after redelivery error = %v", err)
+	}
+}
+
+func (s *suite) testReceiveContext(t *testing.T) {
+	_, sub := s.connect(t)
+
+	const timeout = 100 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	msg, err := sub.Receive(ctx)
+	if err == nil {
+		sub.Nack(context.Background(), msg)
+		t.Fatal("Receive() on an empty queue returned a message")
+	}
+	if elapsed := time.Since(start); elapsed > timeout+s.opts.QuietPeriod {
+		t.Errorf("Receive() returned %v after context expiry, want promptly", elapsed)
+	}
+}
+
+func (s *suite) testCloseSubscriber(t *testing.T) {
+	sub, err := s.factory.NewSubscriber(context.Background(), s.cfg)
+	if err != nil {
+		t.Fatalf("NewSubscriber() error = %v", err)
+	}
+	if err := sub.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.opts.QuietPeriod)
+	defer cancel()
+	if _, err := sub.Receive(ctx); err == nil {
+		t.Error("Receive() after Close succeeded, want error")
+	} else if ctx.Err() != nil {
+		t.Error("Receive() after Close blocked until the context expired, want immediate error")
+	}
+}
+
+func (s *suite) testClosePublisher(t *testing.T) {
+	pub, err := s.factory.NewPublisher(context.Background(), s.cfg)
+	if err != nil {
+		t.Fatalf("NewPublisher() error = %v", err)
+	}
+	if err := pub.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err := pub.Publish(context.Background(), gokyu.NewMessage([]byte("closed"))); err == nil {
+		t.Error("Publish() after Close succeeded, want error")
+	}
+}
+
+// uniqueID returns a random message ID so runs do not see each other's messages.
+func uniqueID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return "conformance-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,91 @@
+package conformance
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+)
+
+// memoryFactory is a minimal in-memory provider used to check the suite itself.
+type memoryFactory struct {
+	queue chan *gokyu.Message
+}
+
+func (f *memoryFactory) NewPublisher(ctx context.Context, cfg *gokyu.Config) (gokyu.Publisher, error) {
+	return &memoryPublisher{queue: f.queue}, nil
+}
+
+func (f *memoryFactory) NewSubscriber(ctx context.Context, cfg *gokyu.Config) (gokyu.Subscriber, error) {
+	return &memorySubscriber{queue: f.queue, closed: make(chan struct{})}, nil
+}
+
+type memoryPublisher struct {
+	queue  chan *gokyu.Message
+	mu     sync.Mutex
+	closed bool
+}
+
+func (p *memoryPublisher) Publish(ctx context.Context, msg *gokyu.Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return gokyu.ErrClosed
+	}
+	p.queue <- msg
+	return nil
+}
+
+func (p *memoryPublisher) Close(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	return nil
+}
+
+type memorySubscriber struct {
+	queue  chan *gokyu.Message
+	closed chan struct{}
+	once   sync.Once
+}
+
+func (s *memorySubscriber) Receive(ctx context.Context) (*gokyu.Message, error) {
+	select {
+	case <-s.closed:
+		return nil, gokyu.ErrClosed
+	default:
+	}
+	select {
+	case msg := <-s.queue:
+		msg.SetRaw(msg)
+		return msg, nil
+	case <-s.closed:
+		return nil, gokyu.ErrClosed
+	case <-ctx.Done():
+		return nil, gokyu.WrapError(gokyu.ErrReceiveFailed, ctx.Err())
+	}
+}
+
+func (s *memorySubscriber) Ack(ctx context.Context, msg *gokyu.Message) error { return nil }
+
+func (s *memorySubscriber) Nack(ctx context.Context, msg *gokyu.Message) error {
+	s.queue <- msg
+	return nil
+}
+
+func (s *memorySubscriber) Close(ctx context.Context) error {
+	s.once.Do(func() { close(s.closed) })
+	return nil
+}
+
+func TestRun_MemoryProvider(t *testing.T) {
+	factory := &memoryFactory{queue: make(chan *gokyu.Message, 16)}
+	factory.queue <- gokyu.NewMessage([]byte("left over"))
+
+	Run(t, factory, &gokyu.Config{}, &Options{
+		ReceiveTimeout: time.Second,
+		QuietPeriod:    20 * time.Millisecond,
+	})
+}
@@ -0,0 +1,105 @@
+package gokyu
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// modulePath is the import path of this module, used to find its version in
+// the build info.
+const modulePath = "github.com/venderneutral/gokyu"
+
+// Connection property names sent to the broker when a connection is opened.
+const (
+	ConnPropertyProduct  = "product"
+	ConnPropertyVersion  = "version"
+	ConnPropertyPlatform = "platform"
+	ConnPropertyHostname = "hostname"
+	ConnPropertyPID      = "pid"
+)
+
+// BrokerInfo is implemented by provider publishers and subscribers that can
+// report the properties the broker sent when the connection was opened
+// (product, version, capabilities). Publishers and subscribers created by a
+// Client forward it, returning nil if the provider does not report them;
+// other decorators such as NewFilteringSubscriber do not, so check for it
+// before wrapping.
+type BrokerInfo interface {
+	BrokerProperties() map[string]interface{}
+}
+
+// brokerProperties returns the broker properties of v, a publisher or
+// subscriber, or nil if it does not implement BrokerInfo.
+func brokerProperties(v interface{}) map[string]interface{} {
+	if info, ok := v.(BrokerInfo); ok {
+		return info.BrokerProperties()
+	}
+	return nil
+}
+
+// ConnectionProperties returns the properties providers send to the broker
+// on connection open, so that broker consoles can identify which service owns
+// a connection. Entries from cfg.ConnectionProperties are added last and may
+// override the defaults.
+func ConnectionProperties(cfg *Config) map[string]interface{} {
+	props := map[string]interface{}{
+		ConnPropertyProduct:  "gokyu",
+		ConnPropertyVersion:  moduleVersion(),
+		ConnPropertyPlatform: runtime.Version() + " " + runtime.GOOS + "/" + runtime.GOARCH,
+		ConnPropertyPID:      int64(os.Getpid()),
+	}
+	if cfg.ConnectionHostname != "" {
+		props[ConnPropertyHostname] = cfg.ConnectionHostname
+	} else if hostname, err := os.Hostname(); err == nil {
+		props[ConnPropertyHostname] = hostname
+	}
+	for k, v := range cfg.ConnectionProperties {
+		props[k] = v
+	}
+	return props
+}
+
+// ParseConnectionProperties parses connection properties from a
+// comma-separated list of key=value pairs, as in GOKYU_CONNECTION_PROPERTIES:
+//
+//	team=payments,cost-center=cc-4711,service=billing-worker
+func ParseConnectionProperties(s string) (map[string]string, error) {
+	props := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, ErrInvalidConfig(fmt.Sprintf("invalid connection property %q, want key=value", pair))
+		}
+		props[key] = strings.TrimSpace(value)
+	}
+	return props, nil
+}
+
+// moduleVersion returns the version of this module from the build info, or
+// "devel" if it is not known.
+func moduleVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "devel"
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == modulePath {
+			if dep.Replace != nil && dep.Replace.Version != "" {
+				return dep.Replace.Version
+			}
+			return dep.Version
+		}
+	}
+	if info.Main.Path == modulePath && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "devel"
+}
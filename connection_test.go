@@ -0,0 +1,57 @@
+package gokyu
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestConnectionProperties(t *testing.T) {
+	props := ConnectionProperties(&Config{
+		ConnectionProperties: map[string]string{"service": "billing", ConnPropertyProduct: "billing-worker"},
+	})
+
+	if props[ConnPropertyProduct] != "billing-worker" {
+		t.Errorf("expected configured product to override default, got %v", props[ConnPropertyProduct])
+	}
+	if props["service"] != "billing" {
+		t.Errorf("expected service property, got %v", props["service"])
+	}
+	if props[ConnPropertyPID] != int64(os.Getpid()) {
+		t.Errorf("expected pid %d, got %v", os.Getpid(), props[ConnPropertyPID])
+	}
+	if props[ConnPropertyVersion] == "" {
+		t.Error("expected a version")
+	}
+	if hostname, _ := os.Hostname(); props[ConnPropertyHostname] != hostname {
+		t.Errorf("expected hostname %q, got %v", hostname, props[ConnPropertyHostname])
+	}
+}
+
+func TestConnectionProperties_Tags(t *testing.T) {
+	t.Setenv(EnvProvider, string(ProviderAmazonMQ))
+	t.Setenv(EnvConnectionString, "amqps://broker")
+	t.Setenv(EnvQueue, "jobs")
+	t.Setenv(EnvConnectionProperties, "team=payments, cost-center=cc-4711,")
+	t.Setenv(EnvConnectionHostname, "billing-worker-1")
+
+	cfg, err := LoadConfigFromEnv()
+	if err != nil {
+		t.Fatalf("LoadConfigFromEnv() error = %v", err)
+	}
+	want := map[string]string{"team": "payments", "cost-center": "cc-4711"}
+	if !reflect.DeepEqual(cfg.ConnectionProperties, want) {
+		t.Errorf("ConnectionProperties = %v, want %v", cfg.ConnectionProperties, want)
+	}
+
+	props := ConnectionProperties(cfg)
+	if props["team"] != "payments" || props[ConnPropertyHostname] != "billing-worker-1" {
+		t.Errorf("ConnectionProperties() = %v", props)
+	}
+
+	var cfgErr *ConfigError
+	if _, err := ParseConnectionProperties("team"); !errors.As(err, &cfgErr) {
+		t.Errorf("ParseConnectionProperties() error = %v, want a ConfigError", err)
+	}
+}
@@ -0,0 +1,132 @@
+package gokyu
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// ConsumerOptions configures a Consumer.
+type ConsumerOptions struct {
+	// Concurrency is the number of messages handled at once (default: 1).
+	// Set Config.PrefetchCount at least as high.
+	Concurrency int
+
+	// OnError is called when the handler of a message fails, when a
+	// message is received with an error (see Consumer), and when the
+	// message cannot be acked or nacked.
+	OnError func(msg *Message, err error)
+}
+
+// WithDefaults returns a copy of the options with defaults applied.
+func (o ConsumerOptions) WithDefaults() ConsumerOptions {
+	if o.Concurrency < 1 {
+		o.Concurrency = 1
+	}
+	return o
+}
+
+// Consumer runs the receive loop of a subscriber, passing every message to a
+// handler and acking it if the handler returns nil or nacking it otherwise:
+//
+//	consumer := gokyu.NewConsumer(sub, handle, gokyu.ConsumerOptions{Concurrency: 8})
+//	err := gokyu.RunUntilSignal(ctx, consumer)
+//
+// A handler that panics fails its message. Decorators such as
+// NewPipelineSubscriber return a message together with the error when they
+// cannot prepare it; the consumer reports the error, nacks the message
+// without handling it, and keeps receiving. It implements Runner.
+type Consumer struct {
+	sub     Subscriber
+	handler Handler
+	opts    ConsumerOptions
+}
+
+// NewConsumer creates a consumer of sub's messages.
+func NewConsumer(sub Subscriber, handler Handler, opts ConsumerOptions) *Consumer {
+	return &Consumer{sub: sub, handler: handler, opts: opts.WithDefaults()}
+}
+
+// Subscribe passes the messages of sub to handler until ctx is done, with
+// the default ConsumerOptions (see Consumer).
+func Subscribe(ctx context.Context, sub Subscriber, handler Handler) error {
+	return NewConsumer(sub, handler, ConsumerOptions{}).Run(ctx)
+}
+
+// Run receives and handles messages until ctx is done or Receive fails, and
+// returns once the messages being handled are settled. Handlers see ctx, so
+// they can stop early; their messages are settled regardless. It returns
+// ctx's error after cancellation, or the Receive error.
+func (c *Consumer) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	slots := make(chan struct{}, c.opts.Concurrency)
+	for {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		msg, err := c.sub.Receive(ctx)
+		if msg != nil && err != nil {
+			c.reject(ctx, msg, err)
+			<-slots
+			continue
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			c.handle(ctx, msg)
+		}()
+	}
+}
+
+// handle passes msg to the handler and settles it.
+func (c *Consumer) handle(ctx context.Context, msg *Message) {
+	err := c.call(ctx, msg)
+
+	settleCtx := context.WithoutCancel(ctx)
+	if err == nil {
+		if ackErr := c.sub.Ack(settleCtx, msg); ackErr != nil {
+			c.report(msg, ackErr)
+		}
+		return
+	}
+
+	c.reject(settleCtx, msg, err)
+}
+
+// reject reports err and nacks msg.
+func (c *Consumer) reject(ctx context.Context, msg *Message, err error) {
+	c.report(msg, err)
+	if nackErr := c.sub.Nack(context.WithoutCancel(ctx), msg); nackErr != nil {
+		c.report(msg, fmt.Errorf("%w (after handler error: %v)", nackErr, err))
+	}
+}
+
+// call calls the handler, turning a panic into an error.
+func (c *Consumer) call(ctx context.Context, msg *Message) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("gokyu: handler panic: %v", r)
+		}
+	}()
+	return c.handler(ctx, msg)
+}
+
+// report passes err to OnError, if set.
+func (c *Consumer) report(msg *Message, err error) {
+	if c.opts.OnError != nil {
+		c.opts.OnError(msg, err)
+	}
+}
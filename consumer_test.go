@@ -0,0 +1,100 @@
+package gokyu
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestConsumer_Run(t *testing.T) {
+	ok, failed, panicked := NewMessage([]byte("ok")), NewMessage([]byte("fail")), NewMessage([]byte("panic"))
+	stub := &stubSubscriber{msgs: []*Message{ok, failed, panicked}}
+
+	var (
+		mu      sync.Mutex
+		errs    []error
+		failure = errors.New("card declined")
+	)
+	consumer := NewConsumer(stub, func(ctx context.Context, msg *Message) error {
+		switch string(msg.Body) {
+		case "fail":
+			return failure
+		case "panic":
+			panic("nil map")
+		}
+		return nil
+	}, ConsumerOptions{OnError: func(msg *Message, err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	}})
+
+	// The stub fails once it runs out of messages
+	if err := consumer.Run(context.Background()); !errors.Is(err, ErrReceiveFailed) {
+		t.Errorf("Run() error = %v", err)
+	}
+	if len(stub.acked) != 1 || stub.acked[0] != ok {
+		t.Errorf("acked %v", stub.acked)
+	}
+	if len(stub.nacked) != 2 {
+		t.Errorf("nacked %v", stub.nacked)
+	}
+	if len(errs) != 2 || !errors.Is(errs[0], failure) || !strings.Contains(errs[1].Error(), "handler panic: nil map") {
+		t.Errorf("reported errors %v", errs)
+	}
+}
+
+func TestSubscribe_Cancel(t *testing.T) {
+	msg := NewMessage([]byte("last"))
+	stub := &stubSubscriber{msgs: []*Message{msg}}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	err := Subscribe(ctx, stub, func(ctx context.Context, msg *Message) error {
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Subscribe() error = %v", err)
+	}
+	if len(stub.acked) != 1 {
+		t.Errorf("message handled during cancellation not acked: %v", stub.acked)
+	}
+}
+
+func TestConsumer_RunRejectsUnpreparedMessages(t *testing.T) {
+	bad, good := NewMessage([]byte("bad")), NewMessage([]byte("good"))
+	stub := &stubSubscriber{msgs: []*Message{bad, good}}
+	pipeline := NewPipeline()
+	malformed := errors.New("malformed body")
+	pipeline.Register(StageValidate, "schema", func(ctx context.Context, msg *Message) error {
+		if string(msg.Body) == "bad" {
+			return malformed
+		}
+		return nil
+	})
+
+	var handled []*Message
+	var errs []error
+	consumer := NewConsumer(NewPipelineSubscriber(stub, pipeline), func(ctx context.Context, msg *Message) error {
+		handled = append(handled, msg)
+		return nil
+	}, ConsumerOptions{OnError: func(msg *Message, err error) {
+		errs = append(errs, err)
+	}})
+
+	if err := consumer.Run(context.Background()); !errors.Is(err, ErrReceiveFailed) {
+		t.Errorf("Run() error = %v", err)
+	}
+	if len(stub.nacked) != 1 || stub.nacked[0] != bad {
+		t.Errorf("nacked %v, want the message the pipeline rejected", stub.nacked)
+	}
+	if len(handled) != 1 || handled[0] != good || len(stub.acked) != 1 {
+		t.Errorf("handled %v and acked %v, want the next message", handled, stub.acked)
+	}
+	var stageErr *StageError
+	if len(errs) != 1 || !errors.As(errs[0], &stageErr) || !errors.Is(errs[0], malformed) {
+		t.Errorf("reported errors %v", errs)
+	}
+}
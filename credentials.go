@@ -0,0 +1,48 @@
+package gokyu
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// Credentials authenticate a connection to the broker.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// CredentialsProvider supplies the credentials of broker connections, e.g.
+// from a secret store, so that they need not be in the configuration or the
+// environment. It is called whenever a connection is established, including
+// reconnects, so implementations should cache credentials and renew them in
+// the background; see the secrets package.
+type CredentialsProvider interface {
+	Credentials(ctx context.Context) (Credentials, error)
+}
+
+// CredentialsFunc adapts a function to CredentialsProvider.
+type CredentialsFunc func(ctx context.Context) (Credentials, error)
+
+// Credentials calls f(ctx).
+func (f CredentialsFunc) Credentials(ctx context.Context) (Credentials, error) {
+	return f(ctx)
+}
+
+// ResolveCredentials returns the credentials providers authenticate a
+// connection to u with: those of Config.Credentials if set, or else the
+// user info of u. It returns nil if there are none.
+func ResolveCredentials(ctx context.Context, cfg *Config, u *url.URL) (*Credentials, error) {
+	if cfg.Credentials != nil {
+		creds, err := cfg.Credentials.Credentials(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("gokyu: credentials: %w", err)
+		}
+		return &creds, nil
+	}
+	if u.User == nil {
+		return nil, nil
+	}
+	password, _ := u.User.Password()
+	return &Credentials{Username: u.User.Username(), Password: password}, nil
+}
@@ -0,0 +1,203 @@
+package gokyu
+
+import (
+	"context"
+	"hash/fnv"
+	"math"
+	"sync"
+	"time"
+)
+
+// MetricDuplicatesDropped counts received messages acknowledged without
+// being returned because they were already processed.
+const MetricDuplicatesDropped = "gokyu_duplicates_dropped_total"
+
+// DedupOptions configures a deduplicating subscriber.
+type DedupOptions struct {
+	// Window is how long processed messages are remembered. A message is
+	// recognized as a duplicate for at least Window and at most twice
+	// Window after it was acknowledged (default: 10m).
+	Window time.Duration
+
+	// Capacity is the expected number of distinct messages per Window. The
+	// false-positive rate rises above FalsePositiveRate when exceeded
+	// (default: 1000000).
+	Capacity int
+
+	// FalsePositiveRate is the probability that a new message is mistaken
+	// for a duplicate and dropped (default: 0.0001).
+	FalsePositiveRate float64
+
+	// Key returns the deduplication key of a message (default: its ID).
+	// Messages with an empty key are never deduplicated.
+	Key func(msg *Message) string
+
+	// Metrics records MetricDuplicatesDropped.
+	Metrics Metrics
+
+	// Clock is the time source (default: SystemClock).
+	Clock Clock
+}
+
+// NewDedupSubscriber wraps a subscriber to drop messages that were already
+// acknowledged within the dedup window. Processed keys are held in two
+// rotating Bloom filters rather than an external store, so checking a message
+// costs a few hashes instead of a network round trip, and memory is fixed at
+// about 5 bytes per expected message at the default false-positive rate.
+//
+// Duplicates are acknowledged and counted in MetricDuplicatesDropped. The
+// filter is local to the process: consumers on other instances, or after a
+// restart, do not share it. Because Bloom filters have false positives, a
+// small fraction of new messages (FalsePositiveRate) is dropped too; use it
+// only where that is acceptable.
+func NewDedupSubscriber(sub Subscriber, opts DedupOptions) Subscriber {
+	if opts.Window <= 0 {
+		opts.Window = 10 * time.Minute
+	}
+	if opts.Capacity <= 0 {
+		opts.Capacity = 1000000
+	}
+	if opts.FalsePositiveRate <= 0 || opts.FalsePositiveRate >= 1 {
+		opts.FalsePositiveRate = 0.0001
+	}
+	if opts.Key == nil {
+		opts.Key = func(msg *Message) string { return msg.ID }
+	}
+	if opts.Metrics == nil {
+		opts.Metrics = NopMetrics{}
+	}
+	if opts.Clock == nil {
+		opts.Clock = SystemClock
+	}
+
+	return &dedupSubscriber{
+		Subscriber: sub,
+		opts:       opts,
+		current:    newBloomFilter(opts.Capacity, opts.FalsePositiveRate),
+		previous:   newBloomFilter(opts.Capacity, opts.FalsePositiveRate),
+		rotated:    opts.Clock.Now(),
+	}
+}
+
+// dedupSubscriber drops messages whose key is in the Bloom filters.
+type dedupSubscriber struct {
+	Subscriber
+	opts DedupOptions
+
+	mu       sync.Mutex
+	current  *bloomFilter
+	previous *bloomFilter
+	rotated  time.Time
+}
+
+func (s *dedupSubscriber) Receive(ctx context.Context) (*Message, error) {
+	for {
+		msg, err := s.Subscriber.Receive(ctx)
+		if err != nil {
+			return msg, err
+		}
+
+		key := s.opts.Key(msg)
+		if key == "" || !s.seen(key) {
+			return msg, nil
+		}
+
+		if err := s.Subscriber.Ack(ctx, msg); err != nil {
+			return nil, err
+		}
+		s.opts.Metrics.IncCounter(MetricDuplicatesDropped, nil, 1)
+	}
+}
+
+// Ack records the message as processed once the acknowledgment succeeds, so
+// released messages are redelivered normally.
+func (s *dedupSubscriber) Ack(ctx context.Context, msg *Message) error {
+	if err := s.Subscriber.Ack(ctx, msg); err != nil {
+		return err
+	}
+	if key := s.opts.Key(msg); key != "" {
+		s.mu.Lock()
+		s.rotate()
+		s.current.add(key)
+		s.mu.Unlock()
+	}
+	return nil
+}
+
+// seen reports whether key is in either filter.
+func (s *dedupSubscriber) seen(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rotate()
+	return s.current.contains(key) || s.previous.contains(key)
+}
+
+// rotate discards the previous filter once per Window. It must be called
+// with s.mu held.
+func (s *dedupSubscriber) rotate() {
+	now := s.opts.Clock.Now()
+	elapsed := now.Sub(s.rotated)
+	if elapsed < s.opts.Window {
+		return
+	}
+	if elapsed >= 2*s.opts.Window {
+		// Both filters have expired
+		s.current.reset()
+	}
+	s.previous.reset()
+	s.current, s.previous = s.previous, s.current
+	s.rotated = now
+}
+
+// bloomFilter is a fixed-size Bloom filter using double hashing.
+type bloomFilter struct {
+	bits   []uint64
+	m      uint64
+	hashes uint64
+}
+
+// newBloomFilter sizes a filter for n keys at false-positive rate p.
+func newBloomFilter(n int, p float64) *bloomFilter {
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	if m < 64 {
+		m = 64
+	}
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	return &bloomFilter{bits: make([]uint64, (m+63)/64), m: m, hashes: k}
+}
+
+// locations returns the two base hashes of key.
+func (f *bloomFilter) locations(key string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	return sum, sum>>33 | 1
+}
+
+func (f *bloomFilter) add(key string) {
+	h1, h2 := f.locations(key)
+	for i := uint64(0); i < f.hashes; i++ {
+		bit := (h1 + i*h2) % f.m
+		f.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+func (f *bloomFilter) contains(key string) bool {
+	h1, h2 := f.locations(key)
+	for i := uint64(0); i < f.hashes; i++ {
+		bit := (h1 + i*h2) % f.m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *bloomFilter) reset() {
+	for i := range f.bits {
+		f.bits[i] = 0
+	}
+}
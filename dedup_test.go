@@ -0,0 +1,100 @@
+package gokyu
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func idMessage(id string) *Message {
+	msg := NewMessage(nil)
+	msg.ID = id
+	return msg
+}
+
+func TestDedupSubscriber_DropsAckedDuplicates(t *testing.T) {
+	stub := &stubSubscriber{msgs: []*Message{idMessage("a"), idMessage("b"), idMessage("a"), idMessage("c")}}
+	metrics := newCountingMetrics()
+	sub := NewDedupSubscriber(stub, DedupOptions{Metrics: metrics})
+	ctx := context.Background()
+
+	var got []string
+	for i := 0; i < 3; i++ {
+		msg, err := sub.Receive(ctx)
+		if err != nil {
+			t.Fatalf("Receive() error = %v", err)
+		}
+		got = append(got, msg.ID)
+		sub.Ack(ctx, msg)
+	}
+
+	if fmt.Sprint(got) != "[a b c]" {
+		t.Errorf("expected duplicate dropped, got %v", got)
+	}
+	if metrics.counters[MetricDuplicatesDropped] != 1 {
+		t.Errorf("expected 1 duplicate counted, got %v", metrics.counters[MetricDuplicatesDropped])
+	}
+	if len(stub.acked) != 4 {
+		t.Errorf("expected duplicate acknowledged, got %d acks", len(stub.acked))
+	}
+}
+
+func TestDedupSubscriber_RedeliversReleased(t *testing.T) {
+	stub := &stubSubscriber{msgs: []*Message{idMessage("a"), idMessage("a")}}
+	sub := NewDedupSubscriber(stub, DedupOptions{})
+	ctx := context.Background()
+
+	msg, _ := sub.Receive(ctx)
+	sub.Nack(ctx, msg)
+
+	msg, err := sub.Receive(ctx)
+	if err != nil || msg.ID != "a" {
+		t.Errorf("expected released message redelivered, got %v, %v", msg, err)
+	}
+}
+
+func TestDedupSubscriber_WindowExpires(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	stub := &stubSubscriber{msgs: []*Message{idMessage("a"), idMessage("a"), idMessage("a")}}
+	sub := NewDedupSubscriber(stub, DedupOptions{Window: time.Minute, Clock: clock})
+	ctx := context.Background()
+
+	msg, _ := sub.Receive(ctx)
+	sub.Ack(ctx, msg)
+
+	// Still remembered after one rotation
+	clock.Advance(90 * time.Second)
+	if _, err := sub.Receive(ctx); err == nil {
+		t.Fatal("expected duplicate within the window dropped")
+	}
+
+	stub.msgs = []*Message{idMessage("a")}
+	clock.Advance(2 * time.Minute)
+	if msg, err := sub.Receive(ctx); err != nil || msg.ID != "a" {
+		t.Errorf("expected message accepted after the window, got %v, %v", msg, err)
+	}
+}
+
+func TestBloomFilter_FalsePositiveRate(t *testing.T) {
+	const n = 10000
+	f := newBloomFilter(n, 0.01)
+	for i := 0; i < n; i++ {
+		f.add(fmt.Sprintf("key-%d", i))
+	}
+	for i := 0; i < n; i++ {
+		if !f.contains(fmt.Sprintf("key-%d", i)) {
+			t.Fatalf("expected added key-%d to be found", i)
+		}
+	}
+
+	falsePositives := 0
+	for i := 0; i < n; i++ {
+		if f.contains(fmt.Sprintf("other-%d", i)) {
+			falsePositives++
+		}
+	}
+	if rate := float64(falsePositives) / n; rate > 0.02 {
+		t.Errorf("expected false-positive rate near 1%%, got %.2f%%", rate*100)
+	}
+}
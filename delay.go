@@ -0,0 +1,420 @@
+package gokyu
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// PropertyDeliverAt carries the delivery time, in RFC 3339 format, of a
+// message waiting in a delay queue.
+const PropertyDeliverAt = "gokyu-deliver-at"
+
+// DelayOptions configures NewDelayPublisher.
+type DelayOptions struct {
+	// DelayQueue, if set, holds scheduled messages in a broker queue instead
+	// of in memory, so they survive restarts. Run a DelayRelay to move them to
+	// the destination when they are due.
+	DelayQueue Publisher
+
+	// RetryInterval is how long a message held in memory waits before
+	// publishing is retried after a failure (default: 5s).
+	RetryInterval time.Duration
+
+	// OnError, if set, is called when publishing a message held in memory
+	// fails. The message is retried after RetryInterval.
+	OnError func(msg *Message, err error)
+
+	// Clock is the time source for delivery times (default: SystemClock).
+	Clock Clock
+}
+
+// WithDefaults returns the options with defaults applied.
+func (o DelayOptions) WithDefaults() DelayOptions {
+	if o.RetryInterval <= 0 {
+		o.RetryInterval = 5 * time.Second
+	}
+	if o.Clock == nil {
+		o.Clock = SystemClock
+	}
+	return o
+}
+
+// NewDelayPublisher returns pub as a ScheduledPublisher, so code that
+// schedules messages runs unchanged on every provider:
+//
+//	sp := gokyu.NewDelayPublisher(pub, gokyu.DelayOptions{})
+//	token, err := sp.Schedule(ctx, reminder, time.Now().Add(time.Hour))
+//
+// Publishers with native scheduling are returned unchanged. For others,
+// scheduling is emulated: messages are held in memory and published when
+// due, or, if opts.DelayQueue is set, published to the delay queue with
+// PropertyDeliverAt for a DelayRelay to forward. Messages held in memory are
+// lost when the publisher is closed or the process exits.
+//
+// CancelScheduled removes a message held in memory. Messages in a delay
+// queue are cancelled with a tombstone published to the destination, so
+// consumers must wrap their subscriber with NewTombstoneSubscriber, which
+// cancels on a best-effort basis only.
+func NewDelayPublisher(pub Publisher, opts DelayOptions) ScheduledPublisher {
+	if sp, ok := pub.(ScheduledPublisher); ok {
+		return sp
+	}
+	opts = opts.WithDefaults()
+	if opts.DelayQueue != nil {
+		return &queueDelayPublisher{Publisher: pub, opts: opts}
+	}
+	p := &memoryDelayPublisher{
+		Publisher: pub,
+		opts:      opts,
+		tokens:    make(map[string]*delayedMessage),
+		wake:      make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// copyMessage returns a copy of msg with its own properties.
+func copyMessage(msg *Message) *Message {
+	out := *msg
+	out.raw = nil
+	out.Properties = make(map[string]interface{}, len(msg.Properties)+2)
+	for k, v := range msg.Properties {
+		out.Properties[k] = v
+	}
+	return &out
+}
+
+// delayedMessage is a message held in memory until it is due.
+type delayedMessage struct {
+	msg   *Message
+	token string
+	at    time.Time
+	index int // position in the heap
+}
+
+// delayHeap orders held messages by delivery time.
+type delayHeap []*delayedMessage
+
+func (h delayHeap) Len() int           { return len(h) }
+func (h delayHeap) Less(i, j int) bool { return h[i].at.Before(h[j].at) }
+
+func (h delayHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *delayHeap) Push(x interface{}) {
+	d := x.(*delayedMessage)
+	d.index = len(*h)
+	*h = append(*h, d)
+}
+
+func (h *delayHeap) Pop() interface{} {
+	old := *h
+	d := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return d
+}
+
+// memoryDelayPublisher holds scheduled messages in memory.
+type memoryDelayPublisher struct {
+	Publisher
+	opts DelayOptions
+
+	mu      sync.Mutex
+	queue   delayHeap
+	tokens  map[string]*delayedMessage
+	closed  bool
+	wake    chan struct{} // signalled when the earliest message changes
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+func (p *memoryDelayPublisher) Schedule(ctx context.Context, msg *Message, at time.Time) (string, error) {
+	d := &delayedMessage{msg: copyMessage(msg), token: NewUUIDv7(), at: at}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return "", ErrClosed
+	}
+	p.tokens[d.token] = d
+	heap.Push(&p.queue, d)
+	earliest := p.queue[0] == d
+	p.mu.Unlock()
+
+	if earliest {
+		p.signal()
+	}
+	return d.token, nil
+}
+
+func (p *memoryDelayPublisher) CancelScheduled(ctx context.Context, token string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	d, ok := p.tokens[token]
+	if !ok {
+		return WrapError(ErrCancelFailed, fmt.Errorf("no message scheduled with token %q", token))
+	}
+	delete(p.tokens, token)
+	heap.Remove(&p.queue, d.index)
+	return nil
+}
+
+// pending returns the number of messages waiting to be published.
+func (p *memoryDelayPublisher) pending() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.queue)
+}
+
+// signal wakes the delivery loop to recompute its timer.
+func (p *memoryDelayPublisher) signal() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run publishes held messages as they come due.
+func (p *memoryDelayPublisher) run() {
+	defer close(p.stopped)
+	for {
+		p.mu.Lock()
+		now := p.opts.Clock.Now()
+		var due []*delayedMessage
+		for len(p.queue) > 0 && !p.queue[0].at.After(now) {
+			d := heap.Pop(&p.queue).(*delayedMessage)
+			delete(p.tokens, d.token)
+			due = append(due, d)
+		}
+		var timer Timer
+		if len(due) == 0 && len(p.queue) > 0 {
+			timer = p.opts.Clock.NewTimer(p.queue[0].at.Sub(now))
+		}
+		p.mu.Unlock()
+
+		if len(due) > 0 {
+			for _, d := range due {
+				p.deliver(d)
+			}
+			continue
+		}
+
+		var fired <-chan time.Time
+		if timer != nil {
+			fired = timer.C()
+		}
+		select {
+		case <-fired:
+		case <-p.wake:
+			if timer != nil {
+				timer.Stop()
+			}
+		case <-p.done:
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		}
+	}
+}
+
+// deliver publishes a due message, holding it for another attempt if
+// publishing fails.
+func (p *memoryDelayPublisher) deliver(d *delayedMessage) {
+	err := p.Publisher.Publish(context.Background(), d.msg)
+	if err == nil {
+		return
+	}
+	if p.opts.OnError != nil {
+		p.opts.OnError(d.msg, err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	d.at = p.opts.Clock.Now().Add(p.opts.RetryInterval)
+	p.tokens[d.token] = d
+	heap.Push(&p.queue, d)
+}
+
+// Close stops delivery, dropping messages that are not yet due, and closes
+// the wrapped publisher.
+func (p *memoryDelayPublisher) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.mu.Unlock()
+
+	close(p.done)
+	select {
+	case <-p.stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return p.Publisher.Close(ctx)
+}
+
+// queueDelayPublisher holds scheduled messages in a delay queue.
+type queueDelayPublisher struct {
+	Publisher
+	opts DelayOptions
+}
+
+func (p *queueDelayPublisher) Schedule(ctx context.Context, msg *Message, at time.Time) (string, error) {
+	token := NewUUIDv7()
+	delayed := copyMessage(msg)
+	delayed.Properties[PropertyDeliverAt] = at.UTC().Format(time.RFC3339Nano)
+	delayed.Properties[PropertyScheduleToken] = token
+	if err := p.opts.DelayQueue.Publish(ctx, delayed); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// CancelScheduled publishes a tombstone for the scheduled message to the
+// destination, where NewTombstoneSubscriber drops the message when the relay
+// delivers it.
+func (p *queueDelayPublisher) CancelScheduled(ctx context.Context, token string) error {
+	tombstone := NewMessage(nil)
+	tombstone.Properties[PropertyTombstone] = token
+
+	if err := p.Publish(ctx, tombstone); err != nil {
+		return WrapError(ErrCancelFailed, err)
+	}
+	return nil
+}
+
+// Close closes the destination and delay queue publishers.
+func (p *queueDelayPublisher) Close(ctx context.Context) error {
+	err := p.Publisher.Close(ctx)
+	if closeErr := p.opts.DelayQueue.Close(ctx); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// DelayRelay forwards messages from a delay queue to their destination when
+// they are due:
+//
+//	relay := &gokyu.DelayRelay{
+//	    Source:      delaySubscriber,
+//	    Requeue:     delayPublisher,
+//	    Destination: ordersPublisher,
+//	}
+//	err := relay.Run(ctx)
+//
+// Each message is held unacknowledged until it is due, but for at most
+// MaxHold; messages due later are published back to the delay queue and
+// checked again when they next come round. MaxHold must be shorter than the
+// broker's lock duration. Messages without PropertyDeliverAt are forwarded
+// immediately.
+type DelayRelay struct {
+	// Source receives from the delay queue.
+	Source Subscriber
+
+	// Requeue publishes to the delay queue.
+	Requeue Publisher
+
+	// Destination publishes due messages.
+	Destination Publisher
+
+	// MaxHold is the longest a message is held before it is requeued
+	// (default: 30s).
+	MaxHold time.Duration
+
+	// OnError, if set, is called when a message cannot be forwarded or
+	// requeued. The message is nacked so the broker redelivers it.
+	OnError func(msg *Message, err error)
+
+	// Clock is the time source for delivery times (default: SystemClock).
+	Clock Clock
+}
+
+// Run forwards messages until ctx is cancelled or receiving fails. Messages
+// being held are nacked when it returns.
+func (r *DelayRelay) Run(ctx context.Context) error {
+	if r.Source == nil || r.Requeue == nil || r.Destination == nil {
+		return ErrInvalidConfig("delay relay requires a source, requeue and destination")
+	}
+	maxHold := r.MaxHold
+	if maxHold <= 0 {
+		maxHold = 30 * time.Second
+	}
+	clock := r.Clock
+	if clock == nil {
+		clock = SystemClock
+	}
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		msg, err := r.Source.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.relay(ctx, msg, maxHold, clock)
+		}()
+	}
+}
+
+// relay holds one message until it is due or maxHold has passed, then
+// forwards or requeues it.
+func (r *DelayRelay) relay(ctx context.Context, msg *Message, maxHold time.Duration, clock Clock) {
+	wait := time.Duration(0)
+	if s, ok := msg.Properties[PropertyDeliverAt].(string); ok {
+		if at, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			wait = at.Sub(clock.Now())
+		}
+	}
+	hold := wait
+	if hold > maxHold {
+		hold = maxHold
+	}
+	if hold > 0 {
+		timer := clock.NewTimer(hold)
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			timer.Stop()
+			r.Source.Nack(context.Background(), msg)
+			return
+		}
+	}
+
+	out := copyMessage(msg)
+	target := r.Requeue
+	if wait <= maxHold {
+		delete(out.Properties, PropertyDeliverAt)
+		target = r.Destination
+	}
+	if err := target.Publish(ctx, out); err != nil {
+		if r.OnError != nil {
+			r.OnError(msg, err)
+		}
+		r.Source.Nack(context.Background(), msg)
+		return
+	}
+	if err := r.Source.Ack(ctx, msg); err != nil && r.OnError != nil {
+		r.OnError(msg, err)
+	}
+}
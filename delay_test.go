@@ -0,0 +1,199 @@
+package gokyu
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitForPublished waits until pub has recorded n messages.
+func waitForPublished(t *testing.T, pub *envelopePublisher, n int) []*Message {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		msgs := pub.published()
+		if len(msgs) >= n {
+			return msgs
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d published messages, got %d", n, len(msgs))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// delayQueuePublisher publishes to a channel read by a chanSubscriber.
+type delayQueuePublisher struct {
+	msgs chan *Message
+}
+
+func (p *delayQueuePublisher) Publish(ctx context.Context, msg *Message) error {
+	p.msgs <- msg
+	return nil
+}
+
+func (p *delayQueuePublisher) Close(ctx context.Context) error { return nil }
+
+// nativeScheduler is a publisher with native scheduling.
+type nativeScheduler struct {
+	envelopePublisher
+}
+
+func (p *nativeScheduler) Schedule(ctx context.Context, msg *Message, at time.Time) (string, error) {
+	return "native", nil
+}
+
+func (p *nativeScheduler) CancelScheduled(ctx context.Context, token string) error { return nil }
+
+func TestDelayPublisher_Native(t *testing.T) {
+	native := &nativeScheduler{}
+	if sp := NewDelayPublisher(native, DelayOptions{}); sp != native {
+		t.Errorf("expected the native scheduled publisher, got %T", sp)
+	}
+}
+
+func TestDelayPublisher_Memory(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	pub := &envelopePublisher{}
+	sp := NewDelayPublisher(pub, DelayOptions{Clock: clock})
+	ctx := context.Background()
+	start := clock.Now()
+
+	schedule := func(body string, after time.Duration) string {
+		t.Helper()
+		token, err := sp.Schedule(ctx, NewMessage([]byte(body)), start.Add(after))
+		if err != nil {
+			t.Fatalf("Schedule() error = %v", err)
+		}
+		return token
+	}
+	schedule("a", time.Minute)
+	cancelled := schedule("c", 90*time.Second)
+	schedule("b", 30*time.Second)
+
+	if err := sp.CancelScheduled(ctx, cancelled); err != nil {
+		t.Fatalf("CancelScheduled() error = %v", err)
+	}
+	if err := sp.CancelScheduled(ctx, cancelled); !errors.Is(err, ErrCancelFailed) {
+		t.Errorf("second CancelScheduled() error = %v", err)
+	}
+
+	clock.Advance(30 * time.Second)
+	if msgs := waitForPublished(t, pub, 1); string(msgs[0].Body) != "b" {
+		t.Errorf("expected b first, got %q", msgs[0].Body)
+	}
+	clock.Advance(30 * time.Second)
+	if msgs := waitForPublished(t, pub, 2); string(msgs[1].Body) != "a" {
+		t.Errorf("expected a second, got %q", msgs[1].Body)
+	}
+
+	clock.Advance(time.Minute)
+	if err := sp.Close(ctx); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if n := len(pub.published()); n != 2 {
+		t.Errorf("expected the cancelled message not to be published, got %d messages", n)
+	}
+	if !pub.closed {
+		t.Error("expected the wrapped publisher to be closed")
+	}
+	if _, err := sp.Schedule(ctx, NewMessage(nil), start); !errors.Is(err, ErrClosed) {
+		t.Errorf("Schedule() after Close error = %v", err)
+	}
+}
+
+func TestDelayPublisher_MemoryRetry(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	pub := &envelopePublisher{err: errors.New("broker down")}
+	failures := make(chan error, 1)
+	sp := NewDelayPublisher(pub, DelayOptions{
+		RetryInterval: 10 * time.Second,
+		OnError:       func(msg *Message, err error) { failures <- err },
+		Clock:         clock,
+	})
+	defer sp.Close(context.Background())
+
+	if _, err := sp.Schedule(context.Background(), NewMessage([]byte("x")), clock.Now()); err != nil {
+		t.Fatalf("Schedule() error = %v", err)
+	}
+	if err := <-failures; err.Error() != "broker down" {
+		t.Errorf("OnError() error = %v", err)
+	}
+	waitForTimers(t, clock, 1)
+	if n := sp.(*memoryDelayPublisher).pending(); n != 1 {
+		t.Fatalf("expected the message to be held for a retry, got %d pending", n)
+	}
+
+	pub.mu.Lock()
+	pub.err = nil
+	pub.mu.Unlock()
+	clock.Advance(10 * time.Second)
+	waitForPublished(t, pub, 2)
+}
+
+func TestDelayPublisher_QueueAndRelay(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	delayed := make(chan *Message, 4)
+	dest := &envelopePublisher{}
+	sp := NewDelayPublisher(dest, DelayOptions{DelayQueue: &delayQueuePublisher{msgs: delayed}, Clock: clock})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	relay := &DelayRelay{
+		Source:      newChanSubscriber(delayed),
+		Requeue:     &delayQueuePublisher{msgs: delayed},
+		Destination: dest,
+		MaxHold:     10 * time.Second,
+		Clock:       clock,
+	}
+	var wg sync.WaitGroup
+	var runErr error
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		runErr = relay.Run(ctx)
+	}()
+
+	token, err := sp.Schedule(ctx, NewMessage([]byte("x")), clock.Now().Add(15*time.Second))
+	if err != nil {
+		t.Fatalf("Schedule() error = %v", err)
+	}
+
+	// Held for MaxHold, then requeued and held for the rest
+	waitForTimers(t, clock, 1)
+	clock.Advance(10 * time.Second)
+	waitForTimers(t, clock, 1)
+	if n := len(dest.published()); n != 0 {
+		t.Fatalf("expected nothing delivered before it is due, got %d", n)
+	}
+	clock.Advance(5 * time.Second)
+
+	msg := waitForPublished(t, dest, 1)[0]
+	if string(msg.Body) != "x" || msg.Properties[PropertyScheduleToken] != token {
+		t.Errorf("unexpected delivered message: %q %v", msg.Body, msg.Properties)
+	}
+	if _, ok := msg.Properties[PropertyDeliverAt]; ok {
+		t.Error("expected the delivery time to be removed")
+	}
+
+	if err := sp.CancelScheduled(ctx, token); err != nil {
+		t.Fatalf("CancelScheduled() error = %v", err)
+	}
+	if tombstone := waitForPublished(t, dest, 2)[1]; tombstone.Properties[PropertyTombstone] != token {
+		t.Errorf("expected a tombstone, got %v", tombstone.Properties)
+	}
+
+	cancel()
+	wg.Wait()
+	if !errors.Is(runErr, context.Canceled) {
+		t.Errorf("Run() error = %v", runErr)
+	}
+}
+
+func TestDelayRelay_InvalidConfig(t *testing.T) {
+	var cfgErr *ConfigError
+	if err := (&DelayRelay{}).Run(context.Background()); !errors.As(err, &cfgErr) {
+		t.Errorf("Run() error = %v, want a config error", err)
+	}
+}
@@ -0,0 +1,307 @@
+package gokyu
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Names of the checks run by Client.Diagnose, in addition to those of
+// Client.Verify.
+const (
+	CheckDNS       = "dns"
+	CheckTCP       = "tcp"
+	CheckTLS       = "tls"
+	CheckAuth      = "auth"
+	CheckRoundTrip = "round-trip"
+)
+
+// PropertyProbe marks the messages published by the round-trip check of
+// Client.Diagnose.
+const PropertyProbe = "gokyu-probe"
+
+// DiagnoseOptions configures Client.Diagnose.
+type DiagnoseOptions struct {
+	// RoundTrip publishes a probe message and waits for it to be received.
+	// The probe goes to the configured queue or topic, so enable it on
+	// entities whose consumers tolerate a message they cannot handle, or
+	// with the service stopped.
+	RoundTrip bool
+
+	// Timeout limits how long the round trip waits for the probe
+	// (default: 10s).
+	Timeout time.Duration
+
+	// Progress is called with the result of each check as soon as it
+	// completes, for printing a diagnostic step by step.
+	Progress func(CheckResult)
+}
+
+// WithDefaults returns the options with defaults applied.
+func (o DiagnoseOptions) WithDefaults() DiagnoseOptions {
+	if o.Timeout <= 0 {
+		o.Timeout = 10 * time.Second
+	}
+	return o
+}
+
+// Diagnose troubleshoots the connection to the broker one layer at a time,
+// so that a failure points at its cause:
+//
+//   - config: the configuration is valid
+//   - dns: the broker host name resolves
+//   - tcp: a TCP connection to the broker port can be opened
+//   - tls: the TLS handshake succeeds and the certificate is trusted, for
+//     amqps and wss connections
+//   - auth: the broker accepts the credentials, on providers implementing
+//     Pinger
+//   - publish, receive: as in Verify, the configured entities can be
+//     attached to
+//   - round-trip: a probe message published to Queue or Topic is received
+//     from Queue or Subscription, if DiagnoseOptions.RoundTrip is set
+//
+// The network checks use the first endpoint of Config.Endpoints, if set,
+// and are skipped for providers whose connection string names no host, such
+// as the file provider. Checks that depend on a failed check are skipped.
+func (c *Client) Diagnose(ctx context.Context, opts DiagnoseOptions) *VerifyReport {
+	opts = opts.WithDefaults()
+	report := &VerifyReport{Provider: c.config.Provider, progress: opts.Progress}
+
+	ok := report.run(CheckConfig, func() (CheckStatus, string, error) {
+		return CheckPassed, "", c.config.Validate()
+	})
+	if ok {
+		ok = c.diagnoseNetwork(ctx, report)
+	} else {
+		for _, name := range []string{CheckDNS, CheckTCP, CheckTLS} {
+			report.skip(name, "invalid configuration")
+		}
+	}
+
+	if ok {
+		ok = report.run(CheckAuth, func() (CheckStatus, string, error) {
+			pinger, ok := c.factory.(Pinger)
+			if !ok {
+				return CheckSkipped, "not supported by the provider", nil
+			}
+			return CheckPassed, "", pinger.Ping(ctx, c.config)
+		})
+	} else {
+		report.skip(CheckAuth, "connection failed")
+	}
+
+	c.attach(ctx, report, ok)
+
+	switch {
+	case !opts.RoundTrip:
+		report.skip(CheckRoundTrip, "not requested")
+	case !report.passed(CheckPublish, CheckReceive):
+		report.skip(CheckRoundTrip, "attach failed")
+	case firstNonEmpty(c.config.Queue, c.config.Topic) == "" || firstNonEmpty(c.config.Queue, c.config.Subscription) == "":
+		report.skip(CheckRoundTrip, "no entity configured")
+	default:
+		report.run(CheckRoundTrip, func() (CheckStatus, string, error) {
+			return c.roundTrip(ctx, opts.Timeout)
+		})
+	}
+	return report
+}
+
+// passed reports whether the checks of the names passed, rather than
+// failing or being skipped.
+func (r *VerifyReport) passed(names ...string) bool {
+	for _, check := range r.Checks {
+		for _, name := range names {
+			if check.Name == name && check.Status != CheckPassed {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// diagnoseNetwork runs the dns, tcp and tls checks against the broker
+// endpoint. It reports whether none failed.
+func (c *Client) diagnoseNetwork(ctx context.Context, report *VerifyReport) bool {
+	host, port, useTLS, err := c.diagnoseEndpoint(ctx)
+	if err != nil {
+		report.run(CheckDNS, func() (CheckStatus, string, error) { return CheckFailed, "", err })
+		report.skip(CheckTCP, "no endpoint")
+		report.skip(CheckTLS, "no endpoint")
+		return false
+	}
+	if host == "" {
+		for _, name := range []string{CheckDNS, CheckTCP, CheckTLS} {
+			report.skip(name, "no network endpoint")
+		}
+		return true
+	}
+
+	var dialer Dialer
+	if c.config.Dialer != nil {
+		dialer = *c.config.Dialer
+	}
+	dialer = dialer.WithDefaults()
+
+	ok := report.run(CheckDNS, func() (CheckStatus, string, error) {
+		if net.ParseIP(host) != nil {
+			return CheckSkipped, host + " is an IP address", nil
+		}
+		ips, err := dialer.LookupIPAddr(ctx, host)
+		if err != nil {
+			return CheckFailed, "", err
+		}
+		addrs := make([]string, len(ips))
+		for i, ip := range ips {
+			addrs[i] = ip.String()
+		}
+		return CheckPassed, host + " → " + strings.Join(addrs, ", "), nil
+	})
+	if !ok {
+		report.skip(CheckTCP, "name resolution failed")
+		report.skip(CheckTLS, "name resolution failed")
+		return false
+	}
+
+	var conn net.Conn
+	ok = report.run(CheckTCP, func() (CheckStatus, string, error) {
+		var err error
+		conn, err = dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+		if err != nil {
+			return CheckFailed, "", err
+		}
+		return CheckPassed, conn.RemoteAddr().String(), nil
+	})
+	if !ok {
+		report.skip(CheckTLS, "connection failed")
+		return false
+	}
+	defer conn.Close()
+
+	if !useTLS {
+		report.skip(CheckTLS, "plain connection")
+		return true
+	}
+	return report.run(CheckTLS, func() (CheckStatus, string, error) {
+		tlsConn := tls.Client(conn, c.config.tlsConfig(host))
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return CheckFailed, "", err
+		}
+		state := tlsConn.ConnectionState()
+		detail := tls.VersionName(state.Version)
+		if len(state.PeerCertificates) > 0 {
+			cert := state.PeerCertificates[0]
+			detail += fmt.Sprintf(", %s, expires %s", cert.Subject.CommonName, cert.NotAfter.Format("2006-01-02"))
+		}
+		return CheckPassed, detail, nil
+	})
+}
+
+// diagnoseEndpoint returns the host and port the client connects to and
+// whether the connection uses TLS. The host is empty if the connection
+// string names none or its scheme has no known port.
+func (c *Client) diagnoseEndpoint(ctx context.Context) (host, port string, useTLS bool, err error) {
+	rawURL := c.config.BuildConnectionString()
+	if c.config.Endpoints != nil {
+		endpoints, err := c.config.Endpoints.Endpoints(ctx)
+		if err != nil {
+			return "", "", false, fmt.Errorf("resolve endpoints: %w", err)
+		}
+		if len(endpoints) == 0 {
+			return "", "", false, errors.New("resolve endpoints: no endpoints")
+		}
+		rawURL = endpoints[0]
+	}
+	if c.config.WebSocket {
+		if rawURL, err = c.config.webSocketURL(rawURL, ""); err != nil {
+			return "", "", false, err
+		}
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", false, fmt.Errorf("invalid connection string: %w", err)
+	}
+	defaults := map[string]struct {
+		port string
+		tls  bool
+	}{
+		"amqp":       {"5672", false},
+		"amqps":      {"5671", true},
+		"amqp+ssl":   {"5671", true},
+		"ws":         {"80", false},
+		"wss":        {"443", true},
+		"beanstalk":  {"11300", false},
+		"beanstalkd": {"11300", false},
+	}
+	d, known := defaults[u.Scheme]
+	if u.Scheme == "" {
+		d, known = defaults["amqp"]
+	}
+	port = u.Port()
+	if port == "" {
+		port = d.port
+	}
+	if u.Hostname() == "" || port == "" || (!known && u.Port() == "") {
+		return "", "", false, nil
+	}
+	return u.Hostname(), port, d.tls, nil
+}
+
+// roundTrip publishes a probe message and receives until it arrives. Other
+// messages received meanwhile are released, and probes left behind by
+// earlier runs are acknowledged.
+func (c *Client) roundTrip(ctx context.Context, timeout time.Duration) (CheckStatus, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	sub, err := c.NewSubscriber(ctx)
+	if err != nil {
+		return CheckFailed, "", err
+	}
+	defer sub.Close(context.WithoutCancel(ctx))
+
+	pub, err := c.NewPublisher(ctx)
+	if err != nil {
+		return CheckFailed, "", err
+	}
+	defer pub.Close(context.WithoutCancel(ctx))
+
+	probe := &Message{
+		ID:          NewUUIDv7(),
+		Body:        []byte("gokyu diagnostic probe"),
+		ContentType: "text/plain",
+		Properties:  map[string]interface{}{PropertyProbe: true},
+	}
+	start := time.Now()
+	if err := pub.Publish(ctx, probe); err != nil {
+		return CheckFailed, "", fmt.Errorf("publish probe: %w", err)
+	}
+
+	for {
+		msg, err := sub.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return CheckFailed, "", fmt.Errorf("probe %s not received within %s", probe.ID, timeout)
+			}
+			return CheckFailed, "", fmt.Errorf("receive probe: %w", err)
+		}
+		if _, ok := msg.Properties[PropertyProbe]; !ok {
+			if err := sub.Nack(ctx, msg); err != nil {
+				return CheckFailed, "", fmt.Errorf("release message: %w", err)
+			}
+			continue
+		}
+		if err := sub.Ack(ctx, msg); err != nil {
+			return CheckFailed, "", fmt.Errorf("ack probe: %w", err)
+		}
+		if msg.ID == probe.ID {
+			return CheckPassed, fmt.Sprintf("probe received after %s", time.Since(start).Round(time.Millisecond)), nil
+		}
+	}
+}
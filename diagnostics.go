@@ -0,0 +1,100 @@
+package gokyu
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// DiagnosticsFunc reports the live state of a component, e.g. link
+// addresses or buffer sizes. It must be safe to call concurrently.
+type DiagnosticsFunc func() map[string]interface{}
+
+// ComponentState is the state of one registered component.
+type ComponentState struct {
+	ID    uint64                 `json:"id"`
+	Kind  string                 `json:"kind"`
+	State map[string]interface{} `json:"state"`
+}
+
+// Diagnostics is a snapshot of the library's internal state.
+type Diagnostics struct {
+	Goroutines int              `json:"goroutines"`
+	Components []ComponentState `json:"components"`
+}
+
+var (
+	diagnosticsMu     sync.Mutex
+	diagnosticsNextID uint64
+	diagnostics       = make(map[uint64]registeredDiagnostics)
+	expvarOnce        sync.Once
+)
+
+type registeredDiagnostics struct {
+	kind string
+	fn   DiagnosticsFunc
+}
+
+// RegisterDiagnostics registers a component whose state is included in
+// Snapshot, DebugHandler and the expvar variable. Call the returned function
+// when the component is closed.
+func RegisterDiagnostics(kind string, fn DiagnosticsFunc) (unregister func()) {
+	diagnosticsMu.Lock()
+	defer diagnosticsMu.Unlock()
+
+	diagnosticsNextID++
+	id := diagnosticsNextID
+	diagnostics[id] = registeredDiagnostics{kind: kind, fn: fn}
+
+	return func() {
+		diagnosticsMu.Lock()
+		defer diagnosticsMu.Unlock()
+		delete(diagnostics, id)
+	}
+}
+
+// Snapshot returns the current state of all registered components.
+func Snapshot() Diagnostics {
+	diagnosticsMu.Lock()
+	registered := make(map[uint64]registeredDiagnostics, len(diagnostics))
+	for id, d := range diagnostics {
+		registered[id] = d
+	}
+	diagnosticsMu.Unlock()
+
+	snapshot := Diagnostics{
+		Goroutines: runtime.NumGoroutine(),
+		Components: make([]ComponentState, 0, len(registered)),
+	}
+	for id, d := range registered {
+		snapshot.Components = append(snapshot.Components, ComponentState{ID: id, Kind: d.kind, State: d.fn()})
+	}
+	sort.Slice(snapshot.Components, func(i, j int) bool {
+		return snapshot.Components[i].ID < snapshot.Components[j].ID
+	})
+	return snapshot
+}
+
+// DebugHandler returns an HTTP handler serving Snapshot as JSON. Mount it on
+// an internal-only listener, e.g. next to net/http/pprof:
+//
+//	http.Handle("/debug/gokyu", gokyu.DebugHandler())
+func DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(Snapshot())
+	})
+}
+
+// PublishExpvar publishes Snapshot as the expvar variable "gokyu", so it is
+// served by /debug/vars. Calling it more than once has no further effect.
+func PublishExpvar() {
+	expvarOnce.Do(func() {
+		expvar.Publish("gokyu", expvar.Func(func() interface{} { return Snapshot() }))
+	})
+}
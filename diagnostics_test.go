@@ -0,0 +1,46 @@
+package gokyu
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestDiagnostics(t *testing.T) {
+	unregister := RegisterDiagnostics("test-component", func() map[string]interface{} {
+		return map[string]interface{}{"links": 2}
+	})
+
+	buffered := NewBufferedSubscriber(&drainingSubscriber{}, BufferOptions{Size: 4})
+
+	rec := httptest.NewRecorder()
+	DebugHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/debug/gokyu", nil))
+
+	var snapshot Diagnostics
+	if err := json.Unmarshal(rec.Body.Bytes(), &snapshot); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if snapshot.Goroutines == 0 {
+		t.Error("expected goroutine count")
+	}
+
+	kinds := make(map[string]map[string]interface{})
+	for _, c := range snapshot.Components {
+		kinds[c.Kind] = c.State
+	}
+	if kinds["test-component"]["links"] != float64(2) {
+		t.Errorf("expected test-component state, got %v", kinds["test-component"])
+	}
+	if kinds["buffered-subscriber"]["capacity"] != float64(4) {
+		t.Errorf("expected buffered-subscriber state, got %v", kinds["buffered-subscriber"])
+	}
+
+	unregister()
+	buffered.Close(context.Background())
+	for _, c := range Snapshot().Components {
+		if c.Kind == "test-component" || c.Kind == "buffered-subscriber" {
+			t.Errorf("expected %s to be unregistered", c.Kind)
+		}
+	}
+}
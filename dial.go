@@ -0,0 +1,266 @@
+package gokyu
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"time"
+)
+
+// Dialer connects to brokers whose host name resolves to several addresses,
+// such as dual-stack or multi-node endpoints. It races connection attempts
+// in the style of Happy Eyeballs (RFC 8305): addresses are tried in resolver
+// order with IPv6 and IPv4 interleaved, the next address is tried as soon as
+// an attempt fails or has not connected within FallbackDelay, and every
+// attempt is abandoned after Timeout. The first connection established wins.
+// It is set with Config.Dialer and used by both providers.
+type Dialer struct {
+	// Timeout limits each connection attempt to a single address (default: 10s).
+	Timeout time.Duration
+
+	// FallbackDelay is how long an attempt may run before the next address
+	// is tried in parallel (default: 250ms).
+	FallbackDelay time.Duration
+
+	// LookupIPAddr resolves host names (default: net.DefaultResolver.LookupIPAddr).
+	LookupIPAddr func(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// WithDefaults returns the dialer with defaults applied.
+func (d Dialer) WithDefaults() Dialer {
+	if d.Timeout <= 0 {
+		d.Timeout = 10 * time.Second
+	}
+	if d.FallbackDelay <= 0 {
+		d.FallbackDelay = 250 * time.Millisecond
+	}
+	if d.LookupIPAddr == nil {
+		d.LookupIPAddr = net.DefaultResolver.LookupIPAddr
+	}
+	return d
+}
+
+// DialContext connects to address ("host:port") on the named network,
+// trying every address the host resolves to. If all attempts fail, the
+// error joins the error of each attempt.
+func (d Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	d = d.WithDefaults()
+
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	var ips []net.IPAddr
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IPAddr{{IP: ip}}
+	} else if ips, err = d.LookupIPAddr(ctx, host); err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("gokyu: no addresses for %s", host)
+	}
+	addrs := interleaveAddrs(ips)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	results := make(chan result, len(addrs))
+	next, pending := 0, 0
+	start := func() {
+		addr := net.JoinHostPort(addrs[next].String(), port)
+		next++
+		pending++
+		go func() {
+			attemptCtx, cancel := context.WithTimeout(ctx, d.Timeout)
+			defer cancel()
+			var dialer net.Dialer
+			conn, err := dialer.DialContext(attemptCtx, network, addr)
+			results <- result{conn, err}
+		}()
+	}
+
+	fallback := time.NewTimer(d.FallbackDelay)
+	defer fallback.Stop()
+	restart := func() {
+		if !fallback.Stop() {
+			select {
+			case <-fallback.C:
+			default:
+			}
+		}
+		fallback.Reset(d.FallbackDelay)
+	}
+
+	var errs []error
+	start()
+	for pending > 0 {
+		var fallbackC <-chan time.Time
+		if next < len(addrs) {
+			fallbackC = fallback.C
+		}
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				// Abandon the other attempts and close any that still connect
+				cancel()
+				go func(n int) {
+					for i := 0; i < n; i++ {
+						if r := <-results; r.conn != nil {
+							r.conn.Close()
+						}
+					}
+				}(pending)
+				return r.conn, nil
+			}
+			errs = append(errs, r.err)
+			if next < len(addrs) && ctx.Err() == nil {
+				start()
+				restart()
+			}
+		case <-fallbackC:
+			start()
+			restart()
+		}
+	}
+	return nil, fmt.Errorf("gokyu: dial %s: %w", address, errors.Join(errs...))
+}
+
+// tlsConfig returns the TLS configuration for connecting to host. Disabling
+// verification is logged on every connection, so it cannot go unnoticed.
+func (c *Config) tlsConfig(host string) *tls.Config {
+	cfg := &tls.Config{ServerName: host}
+	if c.TLSServerName != "" {
+		cfg.ServerName = c.TLSServerName
+	}
+	if c.TLSInsecureSkipVerify {
+		log.Printf("gokyu: WARNING: TLS certificate verification is disabled for %s; connections can be intercepted. Do not set TLSInsecureSkipVerify in production.", host)
+		cfg.InsecureSkipVerify = true
+	}
+	return cfg
+}
+
+// interleaveAddrs orders addresses alternating between IPv6 and IPv4,
+// starting with the family of the first address and otherwise keeping the
+// resolver's order.
+func interleaveAddrs(ips []net.IPAddr) []net.IPAddr {
+	var first, second []net.IPAddr
+	firstIsV4 := ips[0].IP.To4() != nil
+	for _, ip := range ips {
+		if (ip.IP.To4() != nil) == firstIsV4 {
+			first = append(first, ip)
+		} else {
+			second = append(second, ip)
+		}
+	}
+
+	out := make([]net.IPAddr, 0, len(ips))
+	for i := 0; i < len(first) || i < len(second); i++ {
+		if i < len(first) {
+			out = append(out, first[i])
+		}
+		if i < len(second) {
+			out = append(out, second[i])
+		}
+	}
+	return out
+}
+
+// EndpointResolver supplies the broker URLs to connect to, for brokers
+// whose reachable address changes, such as Amazon MQ active/standby pairs
+// (see amazonmq.Discovery). It is set with Config.Endpoints.
+type EndpointResolver interface {
+	// Endpoints returns broker URLs ("amqps://host:port") in the order they
+	// should be tried.
+	Endpoints(ctx context.Context) ([]string, error)
+}
+
+// DialBroker opens the network connection providers run AMQP over: TCP to
+// the host and port of the connection string, with TLS for amqps, or a
+// WebSocket to webSocketPath if cfg.WebSocket is set. Connections are made
+// with cfg.Dialer. If cfg.Endpoints is set, its endpoints are tried in order
+// instead of the connection string and the first that connects is used.
+func DialBroker(ctx context.Context, cfg *Config, webSocketPath string) (net.Conn, error) {
+	var dialer Dialer
+	if cfg.Dialer != nil {
+		dialer = *cfg.Dialer
+	}
+	dialer = dialer.WithDefaults()
+
+	if cfg.Endpoints == nil {
+		return dialEndpoint(ctx, cfg, dialer, cfg.BuildConnectionString(), webSocketPath)
+	}
+
+	endpoints, err := cfg.Endpoints.Endpoints(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("gokyu: resolve endpoints: %w", err)
+	}
+	if len(endpoints) == 0 {
+		return nil, errors.New("gokyu: resolve endpoints: no endpoints")
+	}
+	var errs []error
+	for _, endpoint := range endpoints {
+		conn, err := dialEndpoint(ctx, cfg, dialer, endpoint, webSocketPath)
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+// dialEndpoint connects to the broker at rawURL.
+func dialEndpoint(ctx context.Context, cfg *Config, dialer Dialer, rawURL, webSocketPath string) (net.Conn, error) {
+	if cfg.WebSocket {
+		wsURL, err := cfg.webSocketURL(rawURL, webSocketPath)
+		if err != nil {
+			return nil, err
+		}
+		var tlsConfig *tls.Config
+		if u, err := url.Parse(wsURL); err == nil && u.Scheme == "wss" {
+			tlsConfig = cfg.tlsConfig(u.Hostname())
+		}
+		return dialWebSocket(ctx, dialer, wsURL, tlsConfig)
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid connection string: %w", err)
+	}
+	host, port := u.Hostname(), u.Port()
+
+	switch u.Scheme {
+	case "amqp", "":
+		if port == "" {
+			port = "5672"
+		}
+		return dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+	case "amqps", "amqp+ssl":
+		if port == "" {
+			port = "5671"
+		}
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, port))
+		if err != nil {
+			return nil, err
+		}
+		tlsConn := tls.Client(conn, cfg.tlsConfig(host))
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return tlsConn, nil
+	default:
+		return nil, fmt.Errorf("gokyu: unsupported scheme %q", u.Scheme)
+	}
+}
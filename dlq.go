@@ -0,0 +1,70 @@
+package gokyu
+
+import (
+	"context"
+	"fmt"
+)
+
+// Application properties brokers set on dead-lettered messages.
+const (
+	// PropertyDeadLetterReason is set by Azure Service Bus.
+	PropertyDeadLetterReason = "DeadLetterReason"
+
+	// PropertyDeadLetterDescription is set by Azure Service Bus.
+	PropertyDeadLetterDescription = "DeadLetterErrorDescription"
+
+	// PropertyDLQDeliveryFailureCause is set by ActiveMQ.
+	PropertyDLQDeliveryFailureCause = "dlqDeliveryFailureCause"
+)
+
+// DeadLetterProvider is implemented by provider factories that can receive
+// from the dead-letter queue of an entity.
+type DeadLetterProvider interface {
+	// NewDeadLetterSubscriber creates a subscriber for the dead-letter queue
+	// of the configured queue or subscription.
+	NewDeadLetterSubscriber(ctx context.Context, cfg *Config) (Subscriber, error)
+}
+
+// NewDeadLetterSubscriber creates a subscriber for the dead-letter queue of
+// the configured queue or subscription (see Config.DeadLetterQueue).
+func (c *Client) NewDeadLetterSubscriber(ctx context.Context) (Subscriber, error) {
+	dl, ok := c.factory.(DeadLetterProvider)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s has no dead-letter queue support", ErrUnsupportedProvider, c.config.Provider)
+	}
+	return dl.NewDeadLetterSubscriber(ctx, c.config)
+}
+
+// DeadLetterReason returns why a message was dead-lettered: the reason of
+// its FailureRecord, or the reason recorded by the broker.
+func DeadLetterReason(msg *Message) string {
+	if record, ok, err := ReadFailureRecord(msg); ok && err == nil {
+		return record.Reason
+	}
+	for _, key := range []string{PropertyDeadLetterReason, PropertyDLQDeliveryFailureCause} {
+		if reason, ok := msg.Properties[key].(string); ok && reason != "" {
+			if desc, ok := msg.Properties[PropertyDeadLetterDescription].(string); ok && desc != "" && key == PropertyDeadLetterReason {
+				return reason + ": " + desc
+			}
+			return reason
+		}
+	}
+	return ""
+}
+
+// NewRequeueMessage returns a copy of a dead-lettered message for publishing
+// back to its queue or topic, without the FailureRecord and the broker's
+// dead-letter properties.
+func NewRequeueMessage(msg *Message) *Message {
+	out := NewMessage(msg.Body)
+	out.ID = msg.ID
+	out.ContentType = msg.ContentType
+	out.BodyValue = msg.BodyValue
+	for k, v := range msg.Properties {
+		out.Properties[k] = v
+	}
+	for _, k := range []string{PropertyFailure, PropertyDeadLetterReason, PropertyDeadLetterDescription, PropertyDLQDeliveryFailureCause} {
+		delete(out.Properties, k)
+	}
+	return out
+}
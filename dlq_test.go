@@ -0,0 +1,122 @@
+package gokyu
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// deadLetterFactory is a mockFactory that supports dead-letter queues.
+type deadLetterFactory struct {
+	mockFactory
+	cfg *Config
+}
+
+func (f *deadLetterFactory) NewDeadLetterSubscriber(ctx context.Context, cfg *Config) (Subscriber, error) {
+	f.cfg = cfg
+	return &mockSubscriber{}, nil
+}
+
+func TestClient_NewDeadLetterSubscriber(t *testing.T) {
+	t.Run("supported", func(t *testing.T) {
+		factory := &deadLetterFactory{}
+		RegisterProvider("dlq-provider", factory)
+		client, err := NewClient(&Config{
+			Provider:         "dlq-provider",
+			ConnectionString: "amqps://test@host",
+			Queue:            "orders",
+			DeadLetterQueue:  "orders-dlq",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := client.NewDeadLetterSubscriber(context.Background()); err != nil {
+			t.Fatalf("NewDeadLetterSubscriber() error = %v", err)
+		}
+		if factory.cfg == nil || factory.cfg.DeadLetterQueue != "orders-dlq" {
+			t.Errorf("factory got config %+v", factory.cfg)
+		}
+	})
+
+	t.Run("unsupported", func(t *testing.T) {
+		RegisterProvider("no-dlq-provider", &mockFactory{})
+		client, _ := NewClient(&Config{
+			Provider:         "no-dlq-provider",
+			ConnectionString: "amqps://test@host",
+			Queue:            "orders",
+		})
+
+		_, err := client.NewDeadLetterSubscriber(context.Background())
+		if !errors.Is(err, ErrUnsupportedProvider) {
+			t.Errorf("NewDeadLetterSubscriber() error = %v, want ErrUnsupportedProvider", err)
+		}
+	})
+}
+
+func TestDeadLetterReason(t *testing.T) {
+	failed, err := NewDeadLetterMessage(&Message{ID: "m1", Body: []byte("x")},
+		NewFailureRecord(&Message{ID: "m1"}, errors.New("boom"), "orders", 3, time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		msg  *Message
+		want string
+	}{
+		{name: "failure record", msg: failed, want: "boom"},
+		{
+			name: "azure",
+			msg: &Message{Properties: map[string]interface{}{
+				PropertyDeadLetterReason:      "MaxDeliveryCountExceeded",
+				PropertyDeadLetterDescription: "Message could not be consumed after 10 delivery attempts.",
+			}},
+			want: "MaxDeliveryCountExceeded: Message could not be consumed after 10 delivery attempts.",
+		},
+		{
+			name: "activemq",
+			msg: &Message{Properties: map[string]interface{}{
+				PropertyDLQDeliveryFailureCause: "java.lang.Throwable: Delivery[7] exceeds redelivery policy limit",
+			}},
+			want: "java.lang.Throwable: Delivery[7] exceeds redelivery policy limit",
+		},
+		{name: "unknown", msg: &Message{}, want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DeadLetterReason(tt.msg); got != tt.want {
+				t.Errorf("DeadLetterReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRequeueMessage(t *testing.T) {
+	msg := NewMessage([]byte("body"))
+	msg.ID = "m1"
+	msg.ContentType = "text/plain"
+	msg.Properties["tenant"] = "acme"
+	msg.Properties[PropertyFailure] = `{"reason":"boom"}`
+	msg.Properties[PropertyDeadLetterReason] = "MaxDeliveryCountExceeded"
+	msg.Properties[PropertyDLQDeliveryFailureCause] = "cause"
+
+	out := NewRequeueMessage(msg)
+	if out.ID != "m1" || string(out.Body) != "body" || out.ContentType != "text/plain" {
+		t.Errorf("NewRequeueMessage() = %+v", out)
+	}
+	if out.Properties["tenant"] != "acme" {
+		t.Error("application properties should be kept")
+	}
+	for _, k := range []string{PropertyFailure, PropertyDeadLetterReason, PropertyDLQDeliveryFailureCause} {
+		if _, ok := out.Properties[k]; ok {
+			t.Errorf("property %s should be removed", k)
+		}
+	}
+	if _, ok := msg.Properties[PropertyFailure]; !ok {
+		t.Error("original message should be unchanged")
+	}
+}
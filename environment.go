@@ -0,0 +1,51 @@
+package gokyu
+
+// EnvironmentLocal is the Config.Environment of brokers running on the
+// developer's machine: the Azure Service Bus emulator or an ActiveMQ
+// container.
+const EnvironmentLocal = "local"
+
+// Default credentials of the local brokers.
+const (
+	// localServiceBusKeyName and localServiceBusKey are the shared access
+	// key of the Azure Service Bus emulator.
+	localServiceBusKeyName = "RootManageSharedAccessKey"
+	localServiceBusKey     = "SAS_KEY_VALUE"
+
+	// localActiveMQUser is the user name and password of the ActiveMQ
+	// container images.
+	localActiveMQUser = "admin"
+)
+
+// WithEnvironment returns the configuration with the presets of its
+// Environment applied. For EnvironmentLocal, it connects to localhost on
+// the plain AMQP port without TLS, with the default credentials of the
+// Service Bus emulator or ActiveMQ, and disables WebSockets, which neither
+// emulator serves. Settings made explicitly are kept, except TLS and
+// WebSockets. NewClient and LoadConfigFromEnv apply it automatically.
+func (c Config) WithEnvironment() Config {
+	if c.Environment != EnvironmentLocal {
+		return c
+	}
+
+	c.UseTLS = false
+	c.WebSocket = false
+	if c.ConnectionString != "" || c.Endpoints != nil {
+		return c
+	}
+	if c.Host == "" {
+		c.Host = "localhost"
+	}
+	if c.Port == 0 {
+		c.Port = 5672
+	}
+	if c.Username == "" && c.Password == "" {
+		switch c.Provider {
+		case ProviderAzure:
+			c.Username, c.Password = localServiceBusKeyName, localServiceBusKey
+		case ProviderAmazonMQ:
+			c.Username, c.Password = localActiveMQUser, localActiveMQUser
+		}
+	}
+	return c
+}
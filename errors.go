@@ -19,11 +19,35 @@ var (
 	// ErrAckFailed indicates a message acknowledgment failed.
 	ErrAckFailed = errors.New("gokyu: acknowledgment failed")
 
+	// ErrCancelFailed indicates a scheduled message could not be cancelled.
+	ErrCancelFailed = errors.New("gokyu: cancel scheduled failed")
+
 	// ErrClosed indicates an operation was attempted on a closed connection.
 	ErrClosed = errors.New("gokyu: connection closed")
 
 	// ErrUnsupportedProvider indicates the specified provider is not supported.
 	ErrUnsupportedProvider = errors.New("gokyu: unsupported provider")
+
+	// ErrUnsupportedContentType indicates no codec is registered for a message's content type.
+	ErrUnsupportedContentType = errors.New("gokyu: unsupported content type")
+
+	// ErrEncodeFailed indicates a value could not be encoded into a message body.
+	ErrEncodeFailed = errors.New("gokyu: encode failed")
+
+	// ErrDecodeFailed indicates a message body could not be decoded.
+	ErrDecodeFailed = errors.New("gokyu: decode failed")
+
+	// ErrNoRoute indicates no destination is routed for a published type.
+	ErrNoRoute = errors.New("gokyu: no route for type")
+
+	// ErrUpcastFailed indicates a message could not be upcast to the current schema version.
+	ErrUpcastFailed = errors.New("gokyu: upcast failed")
+
+	// ErrQuotaExceeded indicates a publish was rejected by a publisher quota.
+	ErrQuotaExceeded = errors.New("gokyu: quota exceeded")
+
+	// ErrInvalidProperty indicates a message property value has a type that no provider can encode.
+	ErrInvalidProperty = errors.New("gokyu: invalid property")
 )
 
 // ConfigError represents a configuration validation error.
@@ -0,0 +1,160 @@
+package gokyu
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventType identifies the kind of an Event.
+type EventType string
+
+// Event types.
+const (
+	// EventConnected is emitted when a provider has opened a connection to
+	// the broker. Detail is the address connected to.
+	EventConnected EventType = "connected"
+
+	// EventDisconnected is emitted when a connection to the broker is
+	// closed. Detail is the address, and Err is set if the connection was
+	// lost or did not shut down cleanly.
+	EventDisconnected EventType = "disconnected"
+
+	// EventMessageDeadLettered is emitted when a provider dead-letters a
+	// message itself (see Config.OnDeadLetter). Message and Failure are set.
+	EventMessageDeadLettered EventType = "message-dead-lettered"
+
+	// EventRetryExhausted is emitted when a nacked message has reached the
+	// delivery limit enforced by the provider, such as that of
+	// Config.Redelivery, and was dead-lettered instead of redelivered.
+	// Message and Err are set.
+	EventRetryExhausted EventType = "retry-exhausted"
+
+	// EventBufferFull is emitted when a bounded buffer, such as that of
+	// archive.Archiver, fills up and messages start being dropped. It is
+	// emitted again only after the buffer accepted a message. Message is
+	// the first message dropped and Detail names the buffer.
+	EventBufferFull EventType = "buffer-full"
+
+	// EventDuplicatePublisher is emitted when a client opens a second
+	// publisher with the configuration of one still open, each with its own
+	// connection, unless Config.ShareConnections is set. It is emitted once
+	// per configuration. Detail says how many publishers are open.
+	EventDuplicatePublisher EventType = "duplicate-publisher"
+)
+
+// DefaultEventBufferSize is the number of events a channel returned by
+// EventBus.Subscribe holds before further events are dropped.
+const DefaultEventBufferSize = 64
+
+// Event is something that happened inside the library, for applications to
+// react to without implementing every callback (see Client.Events).
+type Event struct {
+	Type EventType
+	Time time.Time
+
+	// Provider, Queue, Topic and Subscription identify the entity the event
+	// relates to, if any.
+	Provider     Provider
+	Queue        string
+	Topic        string
+	Subscription string
+
+	// Message is the message the event relates to, if any.
+	Message *Message
+
+	// Failure describes why a message was dead-lettered.
+	Failure *FailureRecord
+
+	// Err is the error that caused the event, if any.
+	Err error
+
+	// Detail is additional information depending on Type.
+	Detail string
+}
+
+// EventBus distributes events to subscribers. Emit never blocks: events
+// for a subscriber whose channel is full are dropped and counted. A nil
+// *EventBus discards all events.
+type EventBus struct {
+	mu      sync.RWMutex
+	subs    []chan Event
+	dropped atomic.Int64
+}
+
+// NewEventBus creates an event bus without subscribers.
+func NewEventBus() *EventBus {
+	return &EventBus{}
+}
+
+// Subscribe returns a channel receiving every event emitted from now on,
+// buffering up to size events (default: DefaultEventBufferSize).
+func (b *EventBus) Subscribe(size int) <-chan Event {
+	if size <= 0 {
+		size = DefaultEventBufferSize
+	}
+	ch := make(chan Event, size)
+	b.mu.Lock()
+	b.subs = append(b.subs, ch)
+	b.mu.Unlock()
+	return ch
+}
+
+// Emit sends ev to all subscribers, setting ev.Time if it is zero.
+func (b *EventBus) Emit(ev Event) {
+	if b == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, ch := range b.subs {
+		select {
+		case ch <- ev:
+		default:
+			b.dropped.Add(1)
+		}
+	}
+}
+
+// Dropped returns the number of events dropped because a subscriber's
+// channel was full.
+func (b *EventBus) Dropped() int64 {
+	if b == nil {
+		return 0
+	}
+	return b.dropped.Load()
+}
+
+// EmitEvent emits ev on cfg.Events with the entity of cfg. Providers and
+// components call it for the events listed under EventType.
+func EmitEvent(cfg *Config, ev Event) {
+	if cfg == nil || cfg.Events == nil {
+		return
+	}
+	ev.Provider = cfg.Provider
+	ev.Queue = cfg.Queue
+	ev.Topic = cfg.Topic
+	ev.Subscription = cfg.Subscription
+	cfg.Events.Emit(ev)
+}
+
+// Events returns a channel receiving the events of the client's provider
+// and of the components given its configuration, from now on. Every call
+// returns a new channel; read it continuously, since events are dropped
+// when it is full rather than slowing down message processing:
+//
+//	events := client.Events()
+//	go func() {
+//	    for ev := range events {
+//	        if ev.Type == gokyu.EventDisconnected && ev.Err != nil {
+//	            alert(ev.Err)
+//	        }
+//	    }
+//	}()
+func (c *Client) Events() <-chan Event {
+	return c.config.Events.Subscribe(DefaultEventBufferSize)
+}
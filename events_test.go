@@ -0,0 +1,64 @@
+package gokyu
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEventBus(t *testing.T) {
+	bus := NewEventBus()
+	first := bus.Subscribe(1)
+	second := bus.Subscribe(2)
+
+	bus.Emit(Event{Type: EventConnected, Detail: "broker:5671"})
+	bus.Emit(Event{Type: EventDisconnected, Err: errors.New("connection reset")})
+
+	ev := <-first
+	if ev.Type != EventConnected || ev.Time.IsZero() {
+		t.Errorf("first event = %+v", ev)
+	}
+	if got := bus.Dropped(); got != 1 {
+		t.Errorf("dropped = %d, want 1 for the full channel", got)
+	}
+	for _, want := range []EventType{EventConnected, EventDisconnected} {
+		if ev := <-second; ev.Type != want {
+			t.Errorf("second subscriber got %s, want %s", ev.Type, want)
+		}
+	}
+
+	var nilBus *EventBus
+	nilBus.Emit(Event{Type: EventConnected})
+	if nilBus.Dropped() != 0 {
+		t.Error("nil bus reported drops")
+	}
+}
+
+func TestClient_Events(t *testing.T) {
+	RegisterProvider("test-events-provider", &mockFactory{})
+	cfg := &Config{Provider: "test-events-provider", ConnectionString: "amqps://test", Queue: "orders"}
+	client, err := NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Events != nil {
+		t.Error("NewClient modified the caller's config")
+	}
+
+	events := client.Events()
+	config := client.Config()
+	msg := NewMessage([]byte("poison"))
+	ReportDeadLetter(&config, msg, NewFailureRecord(msg, errors.New("boom"), "orders", 3, time.Unix(1000, 0)))
+
+	select {
+	case ev := <-events:
+		if ev.Type != EventMessageDeadLettered || ev.Message != msg || ev.Queue != "orders" || ev.Provider != "test-events-provider" {
+			t.Errorf("event = %+v", ev)
+		}
+		if ev.Failure == nil || ev.Failure.Reason != "boom" {
+			t.Errorf("failure = %+v", ev.Failure)
+		}
+	default:
+		t.Fatal("expected dead-letter event")
+	}
+}
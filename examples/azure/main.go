@@ -5,8 +5,6 @@ import (
 	"context"
 	"log"
 	"os"
-	"os/signal"
-	"syscall"
 	"time"
 
 	"github.com/venderneutral/gokyu"
@@ -36,30 +34,29 @@ func main() {
 	if err != nil {
 		logger.Fatalf("Failed to create publisher: %v", err)
 	}
-	defer publisher.Close(ctx)
 
-	// Create subscriber
-	subscriber, err := client.NewSubscriber(ctx)
-	if err != nil {
-		logger.Fatalf("Failed to create subscriber: %v", err)
-	}
-	defer subscriber.Close(ctx)
+	// Run the subscriber under a supervisor: receive failures restart it
+	// with backoff instead of retrying in a hot loop
+	consumer := gokyu.RunnerFunc(func(ctx context.Context) error {
+		return gokyu.Supervise(ctx, gokyu.RestartPolicy{
+			MaxRestarts: 10,
+			OnRestart: func(restart int, err error, delay time.Duration) {
+				logger.Printf("Subscriber failed (%v), restarting in %v", err, delay)
+			},
+			OnFatal: func(err error) {
+				logger.Printf("Subscriber gave up: %v", err)
+			},
+		}, func(ctx context.Context) error {
+			subscriber, err := client.NewSubscriber(ctx)
+			if err != nil {
+				return err
+			}
+			defer subscriber.Close(context.Background())
 
-	// Start subscriber in background
-	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				logger.Println("Subscriber shutting down...")
-				return
-			default:
+			for {
 				msg, err := subscriber.Receive(ctx)
 				if err != nil {
-					if ctx.Err() != nil {
-						return
-					}
-					logger.Printf("Receive error: %v", err)
-					continue
+					return err
 				}
 
 				logger.Printf("Received message: %s", string(msg.Body))
@@ -68,26 +65,28 @@ func main() {
 					logger.Printf("Ack error: %v", err)
 				}
 			}
+		})
+	})
+
+	// Publish a test message once the subscriber is ready
+	go func() {
+		time.Sleep(time.Second)
+
+		msg := gokyu.NewMessage([]byte("Hello from goqueue!"))
+		if err := publisher.Publish(ctx, msg); err != nil {
+			logger.Printf("Publish error: %v", err)
+		} else {
+			logger.Println("Published message: Hello from goqueue!")
 		}
 	}()
 
-	// Publish a test message
-	time.Sleep(time.Second) // Wait for subscriber to be ready
-
-	msg := gokyu.NewMessage([]byte("Hello from goqueue!"))
-	if err := publisher.Publish(ctx, msg); err != nil {
-		logger.Printf("Publish error: %v", err)
-	} else {
-		logger.Println("Published message: Hello from goqueue!")
+	// Run until SIGINT or SIGTERM, then let the subscriber finish the
+	// message in hand before closing the publisher
+	shutdown := gokyu.NewShutdown()
+	shutdown.RegisterCloser("publisher", publisher)
+	err = gokyu.RunOptions{GracePeriod: 10 * time.Second, Shutdown: shutdown}.RunUntilSignal(ctx, consumer)
+	if err != nil {
+		logger.Printf("Shutdown error: %v", err)
 	}
-
-	// Wait for shutdown signal
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
-
-	logger.Println("Shutdown signal received")
-	cancel()
-	time.Sleep(time.Second)
 	logger.Println("Gracefully shut down")
 }
@@ -0,0 +1,281 @@
+package gokyu
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ExportOptions configures Export.
+type ExportOptions struct {
+	// Limit stops the export after this many messages (0 means no limit).
+	Limit int
+
+	// IdleTimeout ends the export when no message arrives for this long,
+	// which is how the end of the backlog is detected (default: 5s).
+	IdleTimeout time.Duration
+
+	// Ack consumes exported messages. By default messages are released so the
+	// backlog is left in place; since released messages are redelivered, the
+	// export then also stops when a message ID is seen a second time.
+	Ack bool
+}
+
+// ExportRecord is the JSON Lines representation of an exported message.
+type ExportRecord struct {
+	ID          string                   `json:"id,omitempty"`
+	ContentType string                   `json:"content_type,omitempty"`
+	Properties  map[string]TypedProperty `json:"properties,omitempty"`
+	Body        []byte                   `json:"body"`
+}
+
+// TypedProperty is a property value tagged with its Go type so that exports
+// round-trip property types that JSON cannot represent (such as int64 or
+// time.Time).
+type TypedProperty struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Export writes the backlog of a subscriber to w as JSON Lines, one
+// ExportRecord per message, and returns the number of messages exported.
+func Export(ctx context.Context, sub Subscriber, w io.Writer, opts ExportOptions) (int, error) {
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = 5 * time.Second
+	}
+
+	enc := json.NewEncoder(w)
+	seen := make(map[string]bool)
+	n := 0
+
+	for opts.Limit == 0 || n < opts.Limit {
+		recvCtx, cancel := context.WithTimeout(ctx, opts.IdleTimeout)
+		msg, err := sub.Receive(recvCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() == nil && errors.Is(recvCtx.Err(), context.DeadlineExceeded) {
+				return n, nil
+			}
+			return n, err
+		}
+
+		if !opts.Ack && msg.ID != "" && seen[msg.ID] {
+			// The backlog has wrapped around
+			return n, sub.Nack(ctx, msg)
+		}
+		seen[msg.ID] = true
+
+		record, err := NewExportRecord(msg)
+		if err != nil {
+			sub.Nack(ctx, msg)
+			return n, err
+		}
+		if err := enc.Encode(record); err != nil {
+			sub.Nack(ctx, msg)
+			return n, err
+		}
+
+		if opts.Ack {
+			err = sub.Ack(ctx, msg)
+		} else {
+			err = sub.Nack(ctx, msg)
+		}
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// Import publishes every message read from r, in the format written by
+// Export, and returns the number of messages published.
+func Import(ctx context.Context, pub Publisher, r io.Reader) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 256*1024*1024)
+
+	n := 0
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var record ExportRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return n, fmt.Errorf("gokyu: invalid export record %d: %w", n+1, err)
+		}
+		msg, err := record.Message()
+		if err != nil {
+			return n, err
+		}
+		if err := pub.Publish(ctx, msg); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, scanner.Err()
+}
+
+// NewExportRecord converts a message into its export representation.
+func NewExportRecord(msg *Message) (*ExportRecord, error) {
+	record := &ExportRecord{
+		ID:          msg.ID,
+		ContentType: msg.ContentType,
+		Body:        msg.Body,
+	}
+	if len(msg.Properties) > 0 {
+		record.Properties = make(map[string]TypedProperty, len(msg.Properties))
+	}
+	for k, v := range msg.Properties {
+		p, err := newTypedProperty(v)
+		if err != nil {
+			return nil, fmt.Errorf("gokyu: property %q: %w", k, err)
+		}
+		record.Properties[k] = p
+	}
+	return record, nil
+}
+
+// Message converts the record back into a message.
+func (r *ExportRecord) Message() (*Message, error) {
+	msg := NewMessage(r.Body)
+	msg.ID = r.ID
+	msg.ContentType = r.ContentType
+	for k, p := range r.Properties {
+		v, err := p.value()
+		if err != nil {
+			return nil, fmt.Errorf("gokyu: property %q: %w", k, err)
+		}
+		msg.Properties[k] = v
+	}
+	return msg, nil
+}
+
+// newTypedProperty encodes a property value with its type.
+func newTypedProperty(v interface{}) (TypedProperty, error) {
+	var typ string
+	switch val := v.(type) {
+	case nil:
+		typ = "null"
+	case string:
+		typ = "string"
+	case bool:
+		typ = "bool"
+	case int:
+		typ, v = "int64", int64(val)
+	case int8:
+		typ = "int8"
+	case int16:
+		typ = "int16"
+	case int32:
+		typ = "int32"
+	case int64:
+		typ = "int64"
+	case uint:
+		typ, v = "uint64", uint64(val)
+	case uint8:
+		typ = "uint8"
+	case uint16:
+		typ = "uint16"
+	case uint32:
+		typ = "uint32"
+	case uint64:
+		typ = "uint64"
+	case float32:
+		typ = "float32"
+	case float64:
+		typ = "float64"
+	case []byte:
+		typ, v = "binary", base64.StdEncoding.EncodeToString(val)
+	case time.Time:
+		typ, v = "timestamp", val.UTC().Format(time.RFC3339Nano)
+	default:
+		typ = "json"
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return TypedProperty{}, err
+	}
+	return TypedProperty{Type: typ, Value: raw}, nil
+}
+
+// value decodes the property value into its original type.
+func (p TypedProperty) value() (interface{}, error) {
+	var err error
+	switch p.Type {
+	case "null":
+		return nil, nil
+	case "string":
+		var v string
+		err = json.Unmarshal(p.Value, &v)
+		return v, err
+	case "bool":
+		var v bool
+		err = json.Unmarshal(p.Value, &v)
+		return v, err
+	case "int8":
+		var v int8
+		err = json.Unmarshal(p.Value, &v)
+		return v, err
+	case "int16":
+		var v int16
+		err = json.Unmarshal(p.Value, &v)
+		return v, err
+	case "int32":
+		var v int32
+		err = json.Unmarshal(p.Value, &v)
+		return v, err
+	case "int64":
+		var v int64
+		err = json.Unmarshal(p.Value, &v)
+		return v, err
+	case "uint8":
+		var v uint8
+		err = json.Unmarshal(p.Value, &v)
+		return v, err
+	case "uint16":
+		var v uint16
+		err = json.Unmarshal(p.Value, &v)
+		return v, err
+	case "uint32":
+		var v uint32
+		err = json.Unmarshal(p.Value, &v)
+		return v, err
+	case "uint64":
+		var v uint64
+		err = json.Unmarshal(p.Value, &v)
+		return v, err
+	case "float32":
+		var v float32
+		err = json.Unmarshal(p.Value, &v)
+		return v, err
+	case "float64":
+		var v float64
+		err = json.Unmarshal(p.Value, &v)
+		return v, err
+	case "binary":
+		var s string
+		if err := json.Unmarshal(p.Value, &s); err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.DecodeString(s)
+	case "timestamp":
+		var s string
+		if err := json.Unmarshal(p.Value, &s); err != nil {
+			return nil, err
+		}
+		return time.Parse(time.RFC3339Nano, s)
+	case "json":
+		var v interface{}
+		err = json.Unmarshal(p.Value, &v)
+		return v, err
+	default:
+		return nil, fmt.Errorf("unknown property type %q", p.Type)
+	}
+}
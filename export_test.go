@@ -0,0 +1,86 @@
+package gokyu
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// drainingSubscriber returns queued messages and blocks once drained.
+type drainingSubscriber struct {
+	stubSubscriber
+}
+
+func (s *drainingSubscriber) Receive(ctx context.Context) (*Message, error) {
+	if len(s.msgs) == 0 {
+		<-ctx.Done()
+		return nil, WrapError(ErrReceiveFailed, ctx.Err())
+	}
+	return s.stubSubscriber.Receive(ctx)
+}
+
+func TestExportImport_RoundTrip(t *testing.T) {
+	ts := time.Date(2024, 1, 10, 10, 30, 0, 0, time.UTC)
+
+	msg := NewMessage([]byte(`{"order":1}`))
+	msg.ID = "m1"
+	msg.ContentType = ContentTypeJSON
+	msg.Properties["string"] = "value"
+	msg.Properties["int64"] = int64(42)
+	msg.Properties["int32"] = int32(7)
+	msg.Properties["bool"] = true
+	msg.Properties["binary"] = []byte{0x01, 0x02}
+	msg.Properties["timestamp"] = ts
+
+	sub := &drainingSubscriber{stubSubscriber{msgs: []*Message{msg, NewMessage([]byte("second"))}}}
+
+	var buf bytes.Buffer
+	n, err := Export(context.Background(), sub, &buf, ExportOptions{IdleTimeout: 10 * time.Millisecond, Ack: true})
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if n != 2 || len(sub.acked) != 2 {
+		t.Fatalf("expected 2 exported and acked messages, got %d and %d", n, len(sub.acked))
+	}
+
+	pub := &recordingPublisher{factory: &recordingFactory{}}
+	n, err = Import(context.Background(), pub, &buf)
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 imported messages, got %d", n)
+	}
+
+	got := pub.factory.published[0]
+	if got.ID != msg.ID || got.ContentType != msg.ContentType || !bytes.Equal(got.Body, msg.Body) {
+		t.Errorf("unexpected imported message: %+v", got)
+	}
+	if !reflect.DeepEqual(got.Properties, msg.Properties) {
+		t.Errorf("expected properties %#v, got %#v", msg.Properties, got.Properties)
+	}
+}
+
+func TestExport_ReleasesAndStopsOnWrapAround(t *testing.T) {
+	first := NewMessage([]byte("a"))
+	first.ID = "a"
+	second := NewMessage([]byte("b"))
+	second.ID = "b"
+
+	// Released messages come back around
+	sub := &drainingSubscriber{stubSubscriber{msgs: []*Message{first, second, first, second}}}
+
+	var buf bytes.Buffer
+	n, err := Export(context.Background(), sub, &buf, ExportOptions{IdleTimeout: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 exported messages, got %d", n)
+	}
+	if len(sub.acked) != 0 {
+		t.Errorf("expected no acks, got %d", len(sub.acked))
+	}
+}
@@ -0,0 +1,161 @@
+package gokyu
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// PropertyFailure is the message property holding a JSON FailureRecord on
+// messages dead-lettered or quarantined by gokyu components.
+const PropertyFailure = "gokyu-failure"
+
+// MetricDeadLettered counts messages dead-lettered by providers and gokyu
+// components, labeled with the entity labels and LabelHandler.
+const MetricDeadLettered = "gokyu_dead_lettered_total"
+
+// LabelHandler is the label naming the component that dead-lettered a
+// message (FailureRecord.Handler).
+const LabelHandler = "handler"
+
+// FailureRecord describes why a message was dead-lettered, so triage
+// tooling can group and inspect failures without guessing.
+type FailureRecord struct {
+	// Reason is the error message of the final failure.
+	Reason string `json:"reason"`
+
+	// Errors is the error chain, outermost first.
+	Errors []string `json:"errors,omitempty"`
+
+	// Handler names the component or handler that gave up on the message.
+	Handler string `json:"handler,omitempty"`
+
+	// Attempts is the number of processing attempts made.
+	Attempts int `json:"attempts"`
+
+	// Host is the hostname of the instance that dead-lettered the message.
+	Host string `json:"host,omitempty"`
+
+	// EnqueuedTime is when the message was originally enqueued, if known.
+	EnqueuedTime time.Time `json:"enqueued_time,omitempty"`
+
+	// FailedAt is when the message was dead-lettered.
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// NewFailureRecord creates a failure record for msg failing with err in
+// handler after the given number of attempts.
+func NewFailureRecord(msg *Message, err error, handler string, attempts int, now time.Time) FailureRecord {
+	record := FailureRecord{
+		Errors:       errorChain(err),
+		Handler:      handler,
+		Attempts:     attempts,
+		EnqueuedTime: msg.EnqueuedTime,
+		FailedAt:     now.UTC(),
+	}
+	if err != nil {
+		record.Reason = err.Error()
+	}
+	if host, err := os.Hostname(); err == nil {
+		record.Host = host
+	}
+	return record
+}
+
+// errorChain returns the messages of err and the errors it wraps, outermost
+// first. Errors joined with errors.Join are flattened in order.
+func errorChain(err error) []string {
+	var chain []string
+	var walk func(err error)
+	walk = func(err error) {
+		for err != nil {
+			chain = append(chain, err.Error())
+			if joined, ok := err.(interface{ Unwrap() []error }); ok {
+				for _, e := range joined.Unwrap() {
+					walk(e)
+				}
+				return
+			}
+			err = errors.Unwrap(err)
+		}
+	}
+	walk(err)
+	return chain
+}
+
+// NewDeadLetterMessage returns a copy of msg for publishing to a dead-letter
+// destination, with record stored in PropertyFailure.
+func NewDeadLetterMessage(msg *Message, record FailureRecord) (*Message, error) {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return nil, fmt.Errorf("gokyu: encode failure record: %w", err)
+	}
+
+	dead := NewMessage(msg.Body)
+	dead.ID = msg.ID
+	dead.ContentType = msg.ContentType
+	dead.BodyValue = msg.BodyValue
+	for k, v := range msg.Properties {
+		dead.Properties[k] = v
+	}
+	dead.Properties[PropertyFailure] = string(data)
+	return dead, nil
+}
+
+// DeadLetterEvent describes a message that was dead-lettered.
+type DeadLetterEvent struct {
+	// Message is the message as it was received.
+	Message *Message
+
+	// Record describes the failure, as stored in PropertyFailure.
+	Record FailureRecord
+
+	// Provider, Queue, Topic and Subscription identify the entity the
+	// message was received from.
+	Provider     Provider
+	Queue        string
+	Topic        string
+	Subscription string
+}
+
+// ReportDeadLetter calls cfg.OnDeadLetter, counts MetricDeadLettered on
+// cfg.Metrics and emits EventMessageDeadLettered for a message that was
+// dead-lettered. Providers and components that dead-letter messages call it
+// once the message is stored in the dead-letter destination.
+func ReportDeadLetter(cfg *Config, msg *Message, record FailureRecord) {
+	if cfg == nil {
+		return
+	}
+	if cfg.Metrics != nil {
+		labels := EntityLabels(cfg)
+		labels[LabelHandler] = record.Handler
+		cfg.Metrics.IncCounter(MetricDeadLettered, labels, 1)
+	}
+	if cfg.OnDeadLetter != nil {
+		cfg.OnDeadLetter(DeadLetterEvent{
+			Message:      msg,
+			Record:       record,
+			Provider:     cfg.Provider,
+			Queue:        cfg.Queue,
+			Topic:        cfg.Topic,
+			Subscription: cfg.Subscription,
+		})
+	}
+	EmitEvent(cfg, Event{Type: EventMessageDeadLettered, Message: msg, Failure: &record})
+}
+
+// ReadFailureRecord returns the failure record of a dead-lettered message.
+// It reports false if the message has none.
+func ReadFailureRecord(msg *Message) (*FailureRecord, bool, error) {
+	data, ok := msg.Properties[PropertyFailure].(string)
+	if !ok {
+		return nil, false, nil
+	}
+	var record FailureRecord
+	if err := json.Unmarshal([]byte(data), &record); err != nil {
+		return nil, true, fmt.Errorf("gokyu: decode failure record: %w", err)
+	}
+	return &record, true, nil
+}
@@ -0,0 +1,71 @@
+package gokyu
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestFailureRecord_RoundTrip(t *testing.T) {
+	msg := NewMessage([]byte("order"))
+	msg.ID = "m1"
+	msg.Properties["region"] = "eu"
+	msg.EnqueuedTime = time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC)
+
+	cause := errors.New("connection refused")
+	err := fmt.Errorf("charge payment: %w", errors.Join(cause, errors.New("rollback failed")))
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	dead, encErr := NewDeadLetterMessage(msg, NewFailureRecord(msg, err, "billing", 3, now))
+	if encErr != nil {
+		t.Fatalf("NewDeadLetterMessage() error = %v", encErr)
+	}
+	if dead.ID != "m1" || dead.Properties["region"] != "eu" {
+		t.Errorf("expected message copied, got %+v", dead)
+	}
+	if _, ok := msg.Properties[PropertyFailure]; ok {
+		t.Error("expected original message unchanged")
+	}
+
+	record, ok, readErr := ReadFailureRecord(dead)
+	if !ok || readErr != nil {
+		t.Fatalf("ReadFailureRecord() = %v, %v", ok, readErr)
+	}
+	want := []string{err.Error(), "connection refused\nrollback failed", "connection refused", "rollback failed"}
+	if fmt.Sprintf("%q", record.Errors) != fmt.Sprintf("%q", want) {
+		t.Errorf("expected error chain %q, got %q", want, record.Errors)
+	}
+	if record.Handler != "billing" || record.Attempts != 3 || !record.FailedAt.Equal(now) || !record.EnqueuedTime.Equal(msg.EnqueuedTime) {
+		t.Errorf("unexpected record %+v", record)
+	}
+}
+
+func TestReadFailureRecord_Missing(t *testing.T) {
+	if _, ok, err := ReadFailureRecord(NewMessage(nil)); ok || err != nil {
+		t.Errorf("expected no record, got %v, %v", ok, err)
+	}
+}
+
+func TestReportDeadLetter(t *testing.T) {
+	metrics := newCountingMetrics()
+	var events []DeadLetterEvent
+	cfg := &Config{
+		Provider:     ProviderFile,
+		Queue:        "orders",
+		Metrics:      metrics,
+		OnDeadLetter: func(e DeadLetterEvent) { events = append(events, e) },
+	}
+
+	msg := NewMessage([]byte("poison"))
+	record := NewFailureRecord(msg, errors.New("boom"), "file", 5, time.Now())
+	ReportDeadLetter(cfg, msg, record)
+	ReportDeadLetter(nil, msg, record)
+
+	if len(events) != 1 || events[0].Message != msg || events[0].Queue != "orders" || events[0].Record.Reason != "boom" {
+		t.Errorf("unexpected events: %+v", events)
+	}
+	if metrics.counters[MetricDeadLettered] != 1 || metrics.labels[MetricDeadLettered][LabelHandler] != "file" {
+		t.Errorf("unexpected metrics: %v %v", metrics.counters, metrics.labels)
+	}
+}
@@ -0,0 +1,74 @@
+package gokyu
+
+import "context"
+
+// SkipAction determines how a filtering subscriber settles skipped messages.
+type SkipAction int
+
+const (
+	// SkipAck acknowledges skipped messages so they are removed from the queue.
+	SkipAck SkipAction = iota
+
+	// SkipRelease releases skipped messages so other consumers can receive
+	// them. A release counts as a failed delivery (see NewSamplingSubscriber).
+	SkipRelease
+)
+
+// String returns the action name used in metric labels.
+func (a SkipAction) String() string {
+	if a == SkipRelease {
+		return "release"
+	}
+	return "ack"
+}
+
+// FilterOptions configures a filtering subscriber.
+type FilterOptions struct {
+	// Filter reports whether a message should be returned to the caller.
+	Filter func(msg *Message) bool
+
+	// Skip determines how non-matching messages are settled (default: SkipAck).
+	Skip SkipAction
+
+	// Metrics records MetricMessagesFiltered for every skipped message.
+	Metrics Metrics
+}
+
+// NewFilteringSubscriber wraps a subscriber so that Receive only returns
+// messages accepted by the filter. Rejected messages are settled according
+// to opts.Skip, which emulates server-side filters on providers without them.
+func NewFilteringSubscriber(sub Subscriber, opts FilterOptions) Subscriber {
+	if opts.Metrics == nil {
+		opts.Metrics = NopMetrics{}
+	}
+	return &filteringSubscriber{Subscriber: sub, opts: opts}
+}
+
+// filteringSubscriber skips messages rejected by a filter.
+type filteringSubscriber struct {
+	Subscriber
+	opts FilterOptions
+}
+
+func (s *filteringSubscriber) Receive(ctx context.Context) (*Message, error) {
+	for {
+		msg, err := s.Subscriber.Receive(ctx)
+		if err != nil {
+			// A message returned with an error is left for the caller to settle
+			return msg, err
+		}
+		if s.opts.Filter == nil || s.opts.Filter(msg) {
+			return msg, nil
+		}
+
+		if s.opts.Skip == SkipRelease {
+			err = s.Subscriber.Nack(ctx, msg)
+		} else {
+			err = s.Subscriber.Ack(ctx, msg)
+		}
+		if err != nil {
+			return nil, err
+		}
+		s.opts.Metrics.IncCounter(MetricMessagesFiltered, map[string]string{"action": s.opts.Skip.String()}, 1)
+	}
+}
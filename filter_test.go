@@ -0,0 +1,104 @@
+package gokyu
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// countingMetrics records counter totals by name.
+type countingMetrics struct {
+	mu         sync.Mutex
+	counters   map[string]float64
+	histograms map[string][]float64
+	labels     map[string]map[string]string
+}
+
+func newCountingMetrics() *countingMetrics {
+	return &countingMetrics{
+		counters:   make(map[string]float64),
+		histograms: make(map[string][]float64),
+		labels:     make(map[string]map[string]string),
+	}
+}
+
+func (m *countingMetrics) IncCounter(name string, labels map[string]string, delta float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[name] += delta
+	m.labels[name] = labels
+}
+
+func (m *countingMetrics) ObserveHistogram(name string, labels map[string]string, value float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.histograms[name] = append(m.histograms[name], value)
+	m.labels[name] = labels
+}
+
+func TestFilteringSubscriber_Receive(t *testing.T) {
+	orders := func(msg *Message) bool { return msg.Properties["type"] == "order" }
+
+	tests := []struct {
+		name       string
+		skip       SkipAction
+		wantAcked  int
+		wantNacked int
+	}{
+		{name: "ack skipped", skip: SkipAck, wantAcked: 2, wantNacked: 0},
+		{name: "release skipped", skip: SkipRelease, wantAcked: 0, wantNacked: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ping1 := NewMessage(nil)
+			ping1.Properties["type"] = "ping"
+			ping2 := NewMessage(nil)
+			ping2.Properties["type"] = "ping"
+			order := NewMessage(nil)
+			order.Properties["type"] = "order"
+
+			stub := &stubSubscriber{msgs: []*Message{ping1, ping2, order}}
+			metrics := newCountingMetrics()
+			sub := NewFilteringSubscriber(stub, FilterOptions{Filter: orders, Skip: tt.skip, Metrics: metrics})
+
+			got, err := sub.Receive(context.Background())
+			if err != nil {
+				t.Fatalf("Receive() error = %v", err)
+			}
+			if got != order {
+				t.Error("expected the matching message to be returned")
+			}
+			if len(stub.acked) != tt.wantAcked || len(stub.nacked) != tt.wantNacked {
+				t.Errorf("expected %d acks and %d nacks, got %d and %d",
+					tt.wantAcked, tt.wantNacked, len(stub.acked), len(stub.nacked))
+			}
+			if metrics.counters[MetricMessagesFiltered] != 2 {
+				t.Errorf("expected 2 filtered messages, got %v", metrics.counters[MetricMessagesFiltered])
+			}
+			if metrics.labels[MetricMessagesFiltered]["action"] != tt.skip.String() {
+				t.Errorf("expected action label %q", tt.skip.String())
+			}
+		})
+	}
+}
+
+func TestFilteringSubscriber_ReturnsFailedMessages(t *testing.T) {
+	u := NewUpcasters("version")
+	u.Register(1, func(msg *Message) error { return errors.New("bad payload") })
+
+	msg := NewMessage([]byte("body"))
+	stub := &stubSubscriber{msgs: []*Message{msg}}
+	sub := NewFilteringSubscriber(NewUpcastingSubscriber(stub, u), FilterOptions{
+		Filter: func(*Message) bool { return false },
+	})
+
+	got, err := sub.Receive(context.Background())
+	if !errors.Is(err, ErrUpcastFailed) || got != msg {
+		t.Errorf("Receive() = %v, %v, want the message that failed to upcast so it can be settled", got, err)
+	}
+	if len(stub.acked) != 0 || len(stub.nacked) != 0 {
+		t.Errorf("acked %v and nacked %v, want the message left to the caller", stub.acked, stub.nacked)
+	}
+}
@@ -2,4 +2,14 @@ module github.com/venderneutral/gokyu
 
 go 1.21
 
-require github.com/Azure/go-amqp v1.5.1
+require (
+	github.com/Azure/go-amqp v1.5.1
+	github.com/fxamacker/cbor/v2 v2.7.0
+	github.com/rabbitmq/amqp091-go v1.15.0
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+)
+
+require (
+	github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
+)
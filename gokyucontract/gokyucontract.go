@@ -0,0 +1,285 @@
+// Package gokyucontract checks that producers and consumers of messages
+// agree on their shape, without running both in one test.
+//
+// A producer records a Contract holding example messages for each event type
+// it publishes and commits the file. Consumers copy or fetch the file and
+// verify it against their Expectations in CI, so a producer change that
+// drops a property or a field a consumer relies on fails the consumer's
+// build rather than production.
+//
+// # Producer
+//
+//	func TestOrdersContract(t *testing.T) {
+//	    c := gokyucontract.New("orders-service")
+//	    c.Add("order.created", newOrderCreatedMessage())
+//	    if err := c.WriteFile("contracts/orders-service.json"); err != nil {
+//	        t.Fatal(err)
+//	    }
+//	}
+//
+// # Consumer
+//
+//	func TestOrdersContract(t *testing.T) {
+//	    gokyucontract.VerifyFile(t, "testdata/orders-service.json", gokyucontract.Expectation{
+//	        Event:              "order.created",
+//	        ContentType:        gokyu.ContentTypeJSON,
+//	        RequiredProperties: []string{"tenant"},
+//	        Schema: &gokyucontract.Schema{
+//	            Required: []string{"id", "customer.email"},
+//	            Types:    map[string]string{"id": "string", "total": "number"},
+//	        },
+//	    })
+//	}
+package gokyucontract
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/venderneutral/gokyu"
+)
+
+// Example is a recorded example message of an event type.
+type Example struct {
+	Event string `json:"event"`
+	gokyu.ExportRecord
+}
+
+// Contract holds the example messages a producer publishes.
+type Contract struct {
+	Producer string    `json:"producer"`
+	Examples []Example `json:"examples"`
+}
+
+// New creates an empty contract for a producer.
+func New(producer string) *Contract {
+	return &Contract{Producer: producer}
+}
+
+// Add records msg as an example of an event type. Declare one example per
+// variant a consumer may see, e.g. with and without optional fields.
+func (c *Contract) Add(event string, msg *gokyu.Message) error {
+	record, err := gokyu.NewExportRecord(msg)
+	if err != nil {
+		return err
+	}
+	// IDs differ on every run and would make the file churn
+	record.ID = ""
+	c.Examples = append(c.Examples, Example{Event: event, ExportRecord: *record})
+	return nil
+}
+
+// Events returns the event types with examples, sorted.
+func (c *Contract) Events() []string {
+	seen := make(map[string]bool)
+	var events []string
+	for _, ex := range c.Examples {
+		if !seen[ex.Event] {
+			seen[ex.Event] = true
+			events = append(events, ex.Event)
+		}
+	}
+	sort.Strings(events)
+	return events
+}
+
+// Write writes the contract to w as indented JSON.
+func (c *Contract) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(c)
+}
+
+// WriteFile writes the contract to a file.
+func (c *Contract) WriteFile(path string) error {
+	var buf bytes.Buffer
+	if err := c.Write(&buf); err != nil {
+		return err
+	}
+	return os.WriteFile(path, buf.Bytes(), 0o644)
+}
+
+// Read reads a contract written by Write.
+func Read(r io.Reader) (*Contract, error) {
+	var c Contract
+	if err := json.NewDecoder(r).Decode(&c); err != nil {
+		return nil, fmt.Errorf("gokyucontract: invalid contract: %w", err)
+	}
+	return &c, nil
+}
+
+// ReadFile reads a contract file written by WriteFile.
+func ReadFile(path string) (*Contract, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+// Schema describes the JSON body a consumer relies on. Fields are dotted
+// paths into nested objects, e.g. "customer.email".
+type Schema struct {
+	// Required lists the fields that must be present.
+	Required []string
+
+	// Types maps fields to their JSON type: "string", "number", "boolean",
+	// "object", "array" or "null". Fields absent from an example are not
+	// checked unless they are also required.
+	Types map[string]string
+}
+
+// Expectation is what a consumer relies on in the messages of an event type.
+type Expectation struct {
+	// Event is the event type the expectation applies to. The contract must
+	// hold at least one example of it.
+	Event string
+
+	// ContentType, if set, must match the examples' content type.
+	ContentType string
+
+	// RequiredProperties must be set on every example.
+	RequiredProperties []string
+
+	// Schema, if set, is checked against the JSON body of every example.
+	Schema *Schema
+}
+
+// Violation is an example that does not meet an expectation.
+type Violation struct {
+	Event string
+
+	// Example is the index of the example in Contract.Examples, or -1 if
+	// the contract has no example of the event.
+	Example int
+
+	Problem string
+}
+
+// String formats the violation for test output.
+func (v Violation) String() string {
+	if v.Example < 0 {
+		return fmt.Sprintf("%s: %s", v.Event, v.Problem)
+	}
+	return fmt.Sprintf("%s (example %d): %s", v.Event, v.Example, v.Problem)
+}
+
+// Verify checks every example of the contract against the expectations of
+// its event type and returns the violations found.
+func Verify(c *Contract, expectations ...Expectation) []Violation {
+	var violations []Violation
+	for _, exp := range expectations {
+		found := false
+		for i, ex := range c.Examples {
+			if ex.Event != exp.Event {
+				continue
+			}
+			found = true
+			for _, problem := range check(&ex, exp) {
+				violations = append(violations, Violation{Event: exp.Event, Example: i, Problem: problem})
+			}
+		}
+		if !found {
+			violations = append(violations, Violation{
+				Event:   exp.Event,
+				Example: -1,
+				Problem: fmt.Sprintf("producer %q declares no example", c.Producer),
+			})
+		}
+	}
+	return violations
+}
+
+// VerifyFile reads a contract file and reports every violation of the
+// expectations as a test error.
+func VerifyFile(t testing.TB, path string, expectations ...Expectation) {
+	t.Helper()
+	c, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("gokyucontract: %v", err)
+	}
+	for _, v := range Verify(c, expectations...) {
+		t.Errorf("gokyucontract: %s: %s", c.Producer, v)
+	}
+}
+
+// check returns the problems of one example.
+func check(ex *Example, exp Expectation) []string {
+	var problems []string
+	if exp.ContentType != "" && ex.ContentType != exp.ContentType {
+		problems = append(problems, fmt.Sprintf("content type is %q, want %q", ex.ContentType, exp.ContentType))
+	}
+	for _, name := range exp.RequiredProperties {
+		if _, ok := ex.Properties[name]; !ok {
+			problems = append(problems, fmt.Sprintf("missing property %q", name))
+		}
+	}
+	if exp.Schema == nil {
+		return problems
+	}
+
+	var body interface{}
+	if err := json.Unmarshal(ex.Body, &body); err != nil {
+		return append(problems, fmt.Sprintf("body is not JSON: %v", err))
+	}
+	for _, field := range exp.Schema.Required {
+		if _, ok := lookup(body, field); !ok {
+			problems = append(problems, fmt.Sprintf("missing field %q", field))
+		}
+	}
+
+	fields := make([]string, 0, len(exp.Schema.Types))
+	for field := range exp.Schema.Types {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		v, ok := lookup(body, field)
+		if !ok {
+			continue
+		}
+		if got, want := jsonType(v), exp.Schema.Types[field]; got != want {
+			problems = append(problems, fmt.Sprintf("field %q is %s, want %s", field, got, want))
+		}
+	}
+	return problems
+}
+
+// lookup returns the value at a dotted path in a decoded JSON value.
+func lookup(v interface{}, path string) (interface{}, bool) {
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = obj[key]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// jsonType names the JSON type of a decoded value.
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
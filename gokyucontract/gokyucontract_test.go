@@ -0,0 +1,78 @@
+package gokyucontract
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/venderneutral/gokyu"
+)
+
+func newOrderCreated(body string) *gokyu.Message {
+	msg := gokyu.NewMessage([]byte(body))
+	msg.ID = "generated"
+	msg.ContentType = gokyu.ContentTypeJSON
+	msg.Properties["tenant"] = "acme"
+	msg.Properties["version"] = int64(2)
+	return msg
+}
+
+func TestContract_RoundTrip(t *testing.T) {
+	c := New("orders-service")
+	c.Add("order.created", newOrderCreated(`{"id":"o-1"}`))
+	c.Add("order.shipped", gokyu.NewMessage([]byte(`{}`)))
+
+	path := filepath.Join(t.TempDir(), "orders.json")
+	if err := c.WriteFile(path); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	read, err := ReadFile(path)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+
+	if got := read.Events(); !reflect.DeepEqual(got, []string{"order.created", "order.shipped"}) {
+		t.Errorf("Events() = %v", got)
+	}
+	msg, err := read.Examples[0].Message()
+	if err != nil {
+		t.Fatalf("Message() error = %v", err)
+	}
+	if msg.ID != "" || msg.Properties["version"] != int64(2) {
+		t.Errorf("unexpected example: id %q, properties %v", msg.ID, msg.Properties)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	c := New("orders-service")
+	c.Add("order.created", newOrderCreated(`{"id":"o-1","total":12.5,"customer":{"email":"a@example.com"}}`))
+	c.Add("order.created", newOrderCreated(`{"id":7,"total":3}`))
+
+	violations := Verify(c,
+		Expectation{
+			Event:              "order.created",
+			ContentType:        gokyu.ContentTypeJSON,
+			RequiredProperties: []string{"tenant", "region"},
+			Schema: &Schema{
+				Required: []string{"id", "customer.email"},
+				Types:    map[string]string{"id": "string", "total": "number"},
+			},
+		},
+		Expectation{Event: "order.cancelled"},
+	)
+
+	var got []string
+	for _, v := range violations {
+		got = append(got, v.String())
+	}
+	want := []string{
+		`order.created (example 0): missing property "region"`,
+		`order.created (example 1): missing property "region"`,
+		`order.created (example 1): missing field "customer.email"`,
+		`order.created (example 1): field "id" is number, want string`,
+		`order.cancelled: producer "orders-service" declares no example`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Verify() =\n%q\nwant\n%q", got, want)
+	}
+}
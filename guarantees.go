@@ -0,0 +1,99 @@
+package gokyu
+
+import "sort"
+
+// Delivery is a message delivery guarantee.
+type Delivery string
+
+// Delivery guarantees.
+const (
+	// DeliveryUnknown means the provider does not describe its guarantees.
+	DeliveryUnknown Delivery = "unknown"
+
+	// AtMostOnce means a message may be lost but is never delivered twice.
+	AtMostOnce Delivery = "at-most-once"
+
+	// AtLeastOnce means a message is redelivered until it is acked, so
+	// handlers must tolerate duplicates.
+	AtLeastOnce Delivery = "at-least-once"
+)
+
+// OrderingScope is the scope within which messages are delivered in publish
+// order.
+type OrderingScope string
+
+// Ordering scopes.
+const (
+	// OrderingNone means messages may be delivered in any order.
+	OrderingNone OrderingScope = "none"
+
+	// OrderingPartition means messages with the same Message.PartitionKey
+	// are delivered in order.
+	OrderingPartition OrderingScope = "partition"
+
+	// OrderingQueue means all messages of a queue or subscription are
+	// delivered in order, as long as none is redelivered.
+	OrderingQueue OrderingScope = "queue"
+)
+
+// Guarantees describes the delivery semantics of a provider, for capability
+// discovery and documentation (see gokyu info).
+type Guarantees struct {
+	// Delivery is the delivery guarantee.
+	Delivery Delivery `json:"delivery"`
+
+	// Ordering is the scope of ordered delivery.
+	Ordering OrderingScope `json:"ordering"`
+
+	// Deduplication is whether the broker discards messages published
+	// twice with the same Message.ID.
+	Deduplication Support `json:"deduplication"`
+
+	// MaxMessageSize is the largest message the broker accepts in bytes,
+	// or zero if it has no fixed limit.
+	MaxMessageSize int64 `json:"max_message_size"`
+
+	// Notes qualify the guarantees, e.g. broker settings they depend on.
+	Notes []string `json:"notes,omitempty"`
+}
+
+// GuaranteeReporter is implemented by provider factories to describe their
+// delivery guarantees.
+type GuaranteeReporter interface {
+	Guarantees() Guarantees
+}
+
+// Guarantees describes the delivery guarantees of the client's provider.
+// Providers that do not describe them report DeliveryUnknown.
+func (c *Client) Guarantees() Guarantees {
+	if r, ok := c.factory.(GuaranteeReporter); ok {
+		return r.Guarantees()
+	}
+	return Guarantees{Delivery: DeliveryUnknown, Ordering: OrderingNone}
+}
+
+// ProviderInfo describes a registered provider.
+type ProviderInfo struct {
+	Provider     Provider     `json:"provider"`
+	Capabilities Capabilities `json:"capabilities"`
+	Guarantees   Guarantees   `json:"guarantees"`
+}
+
+// Providers describes the registered providers, sorted by name, with the
+// features they support natively.
+func Providers() []ProviderInfo {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	infos := make([]ProviderInfo, 0, len(registry))
+	for name, factory := range registry {
+		client := &Client{config: &Config{Provider: name}, factory: factory}
+		infos = append(infos, ProviderInfo{
+			Provider:     name,
+			Capabilities: client.Capabilities(),
+			Guarantees:   client.Guarantees(),
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Provider < infos[j].Provider })
+	return infos
+}
@@ -0,0 +1,70 @@
+package gokyu
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// guaranteeFactory is a mockFactory that also implements GuaranteeReporter.
+type guaranteeFactory struct {
+	mockFactory
+}
+
+func (f *guaranteeFactory) Guarantees() Guarantees {
+	return Guarantees{
+		Delivery:       AtLeastOnce,
+		Ordering:       OrderingQueue,
+		Deduplication:  Native,
+		MaxMessageSize: 1024,
+	}
+}
+
+func TestClient_Guarantees(t *testing.T) {
+	RegisterProvider("test-guarantees-provider", &guaranteeFactory{})
+	RegisterProvider("test-guarantees-unknown", &mockFactory{})
+
+	client, err := NewClient(&Config{Provider: "test-guarantees-provider", ConnectionString: "amqps://test", Queue: "orders"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g := client.Guarantees(); g.Delivery != AtLeastOnce || g.Ordering != OrderingQueue || g.MaxMessageSize != 1024 {
+		t.Errorf("guarantees = %+v", g)
+	}
+
+	client, err = NewClient(&Config{Provider: "test-guarantees-unknown", ConnectionString: "amqps://test", Queue: "orders"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g := client.Guarantees(); g.Delivery != DeliveryUnknown || g.Ordering != OrderingNone {
+		t.Errorf("guarantees = %+v, want unknown", g)
+	}
+}
+
+func TestProviders(t *testing.T) {
+	RegisterProvider("test-guarantees-provider", &guaranteeFactory{})
+
+	infos := Providers()
+	var found *ProviderInfo
+	for i := range infos {
+		if i > 0 && infos[i-1].Provider >= infos[i].Provider {
+			t.Errorf("providers not sorted: %s before %s", infos[i-1].Provider, infos[i].Provider)
+		}
+		if infos[i].Provider == "test-guarantees-provider" {
+			found = &infos[i]
+		}
+	}
+	if found == nil {
+		t.Fatal("registered provider not listed")
+	}
+
+	data, err := json.Marshal(found)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`"delivery":"at-least-once"`, `"ordering":"queue"`, `"deduplication":"native"`, `"scheduling":"unsupported"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("JSON %s does not contain %s", data, want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package gokyu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// ErrDestinationNotAllowed indicates a queue or topic outside
+// Config.AllowedDestinations. It is wrapped by DestinationError.
+var ErrDestinationNotAllowed = errors.New("gokyu: destination not allowed")
+
+// DestinationError reports a queue or topic that matches none of the
+// patterns of Config.AllowedDestinations.
+type DestinationError struct {
+	// Destination is the entity name, including Config.EntityPrefix.
+	Destination string
+
+	// Allowed is Config.AllowedDestinations.
+	Allowed []string
+}
+
+func (e *DestinationError) Error() string {
+	return fmt.Sprintf("%v: %q matches none of %s", ErrDestinationNotAllowed, e.Destination, strings.Join(e.Allowed, ", "))
+}
+
+// Unwrap returns ErrDestinationNotAllowed.
+func (e *DestinationError) Unwrap() error {
+	return ErrDestinationNotAllowed
+}
+
+// CheckDestination returns a *DestinationError if Config.AllowedDestinations
+// is set and name matches none of its patterns.
+func (c *Config) CheckDestination(name string) error {
+	if len(c.AllowedDestinations) == 0 {
+		return nil
+	}
+	for _, pattern := range c.AllowedDestinations {
+		if ok, _ := path.Match(pattern, name); ok {
+			return nil
+		}
+	}
+	return &DestinationError{Destination: name, Allowed: c.AllowedDestinations}
+}
+
+// checkDestinations checks the entities of the configuration against
+// Config.AllowedDestinations.
+func (c *Config) checkDestinations() error {
+	for _, name := range []string{c.Queue, c.Topic, c.DeadLetterQueue} {
+		if name == "" {
+			continue
+		}
+		if err := c.CheckDestination(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// guardedRelayPublisher rejects destinations outside
+// Config.AllowedDestinations.
+type guardedRelayPublisher struct {
+	RelayPublisher
+	config *Config
+}
+
+func (p *guardedRelayPublisher) PublishTo(ctx context.Context, destination string, msg *Message) error {
+	if err := p.config.CheckDestination(prefixEntity(p.config.EntityPrefix, destination)); err != nil {
+		return err
+	}
+	return p.RelayPublisher.PublishTo(ctx, destination, msg)
+}
@@ -0,0 +1,55 @@
+package gokyu
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestAllowedDestinations(t *testing.T) {
+	client, factory := newRelayClient(t, "test-guard-provider", Config{
+		AnonymousRelay:      true,
+		AllowedDestinations: []string{"default", "tenant-a.*"},
+	})
+	ctx := context.Background()
+
+	pub, err := client.NewPublisher(ctx)
+	if err != nil {
+		t.Fatalf("NewPublisher() error = %v", err)
+	}
+	allowed := NewMessage([]byte("a"))
+	allowed.To = "tenant-a.orders"
+	if err := pub.Publish(ctx, allowed); err != nil {
+		t.Errorf("Publish() to tenant-a.orders error = %v", err)
+	}
+
+	crossing := NewMessage([]byte("b"))
+	crossing.To = "tenant-b.orders"
+	err = pub.Publish(ctx, crossing)
+	var destErr *DestinationError
+	if !errors.As(err, &destErr) || !errors.Is(err, ErrDestinationNotAllowed) || destErr.Destination != "tenant-b.orders" {
+		t.Errorf("Publish() to tenant-b.orders error = %v", err)
+	}
+	if len(factory.published["tenant-b.orders"]) != 0 {
+		t.Error("message crossed the tenant boundary")
+	}
+
+	relay, _ := client.NewRelayPublisher(ctx)
+	if err := relay.PublishTo(ctx, "tenant-b.invoices", NewMessage(nil)); !errors.Is(err, ErrDestinationNotAllowed) {
+		t.Errorf("PublishTo() error = %v", err)
+	}
+
+	// Clients for other entities, e.g. created by shared code, fail
+	cfg := client.Config()
+	cfg.Topic = "tenant-b.events"
+	if _, err := NewClient(&cfg); !errors.As(err, &destErr) {
+		t.Errorf("NewClient() error = %v", err)
+	}
+
+	cfg.Topic = "tenant-a.events"
+	cfg.AllowedDestinations = []string{"tenant-a.[", "tenant-a.*"}
+	var cfgErr *ConfigError
+	if _, err := NewClient(&cfg); !errors.As(err, &cfgErr) {
+		t.Errorf("NewClient() with a malformed pattern error = %v", err)
+	}
+}
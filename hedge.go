@@ -0,0 +1,288 @@
+package gokyu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Metrics recorded by hedged publishers.
+const (
+	// MetricPublishHedges counts publishes sent again because an earlier
+	// attempt had not settled within HedgeOptions.After, or had failed.
+	MetricPublishHedges = "gokyu_publish_hedges_total"
+
+	// MetricPublishHedgeWins counts publishes settled first by a hedge
+	// rather than by the original attempt.
+	MetricPublishHedgeWins = "gokyu_publish_hedge_wins_total"
+)
+
+// ErrMessageIDRequired is returned by a hedged publisher for a message
+// without an ID when HedgeOptions.MessageID is not set: without one, the
+// copies of a hedged message cannot be recognised as duplicates.
+var ErrMessageIDRequired = errors.New("gokyu: hedged publish requires a message ID")
+
+// HedgeOptions configures a hedged publisher.
+type HedgeOptions struct {
+	// After is how long an attempt may go unsettled before the message is
+	// sent again, e.g. the p95 publish latency. Required.
+	After time.Duration
+
+	// MaxAttempts is the number of times a message may be sent, including
+	// the original (default: 2).
+	MaxAttempts int
+
+	// AttemptTimeout limits each attempt (default: 30s). Attempts run
+	// detached from the context passed to Publish, which bounds only how
+	// long Publish waits for them.
+	AttemptTimeout time.Duration
+
+	// MessageID assigns the ID of messages that have none, once, before the
+	// first attempt. If nil, such messages fail with ErrMessageIDRequired.
+	// Client.NewHedgedPublisher sets it from Config.MessageIDStrategy or
+	// Config.MessageIDGenerator.
+	MessageID MessageIDStrategy
+
+	// Metrics records MetricPublishHedges and MetricPublishHedgeWins.
+	Metrics Metrics
+
+	// Clock is the time source (default: SystemClock).
+	Clock Clock
+}
+
+// WithDefaults returns a copy of the options with defaults applied.
+func (o HedgeOptions) WithDefaults() HedgeOptions {
+	if o.MaxAttempts < 1 {
+		o.MaxAttempts = 2
+	}
+	if o.AttemptTimeout <= 0 {
+		o.AttemptTimeout = 30 * time.Second
+	}
+	if o.Metrics == nil {
+		o.Metrics = NopMetrics{}
+	}
+	if o.Clock == nil {
+		o.Clock = SystemClock
+	}
+	return o
+}
+
+// NewHedgedPublisher returns a publisher that sends a message again when
+// the broker has not settled it within opts.After, cutting tail latency on
+// flaky networks. Publish returns as soon as any attempt succeeds, or with
+// the errors of all attempts. An attempt that fails before then is hedged
+// at once.
+//
+// Attempts go to pubs in turn, so pass publishers with connections of their
+// own: providers serialize publishes on a connection, and a hedge queued
+// behind a stalled attempt gains nothing. Every attempt carries the same
+// Message.ID, which must be set or assigned by opts.MessageID. Unless the
+// broker discards duplicates (see Guarantees.Deduplication), consumers
+// receive the copies that got through and should deduplicate, e.g. with
+// NewDedupSubscriber.
+//
+// Attempts are not cancelled when Publish returns or its context is done,
+// since cancelling a send in flight tears down the link on some providers.
+// They run under context.WithoutCancel of the context passed to Publish,
+// limited by opts.AttemptTimeout, and Close waits for them before closing
+// pubs. An attempt may therefore still succeed after Publish has returned
+// the error of its context.
+func NewHedgedPublisher(pubs []Publisher, opts HedgeOptions) (Publisher, error) {
+	if len(pubs) == 0 {
+		return nil, ErrInvalidConfig("hedged publisher needs at least one publisher")
+	}
+	if opts.After <= 0 {
+		return nil, ErrInvalidConfig("hedge delay must be positive")
+	}
+	return &hedgedPublisher{pubs: pubs, opts: opts.WithDefaults()}, nil
+}
+
+// hedgedPublisher implements NewHedgedPublisher.
+type hedgedPublisher struct {
+	pubs []Publisher
+	opts HedgeOptions
+
+	mu     sync.Mutex
+	next   int // publisher of the next original attempt
+	closed bool
+	wg     sync.WaitGroup // attempts in flight
+}
+
+// hedgeResult is the outcome of one attempt.
+type hedgeResult struct {
+	attempt int
+	err     error
+}
+
+func (p *hedgedPublisher) Publish(ctx context.Context, msg *Message) error {
+	if msg.ID == "" {
+		if p.opts.MessageID == nil {
+			return fmt.Errorf("%w: %w", ErrPublishFailed, ErrMessageIDRequired)
+		}
+		id, err := p.opts.MessageID.MessageID(msg)
+		if err != nil {
+			return WrapError(ErrPublishFailed, err)
+		}
+		msg.ID = id
+	}
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrClosed
+	}
+	first := p.next
+	p.next = (p.next + 1) % len(p.pubs)
+	p.mu.Unlock()
+
+	// Buffered for every attempt, so that losers never block
+	results := make(chan hedgeResult, p.opts.MaxAttempts)
+	sent, pending := 0, 0
+	send := func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.closed {
+			return false
+		}
+		attempt, pub := sent, p.pubs[(first+sent)%len(p.pubs)]
+		// Each attempt gets a copy, since providers and hooks may modify
+		// the message
+		cp := copyMessage(msg)
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			attemptCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), p.opts.AttemptTimeout)
+			defer cancel()
+			results <- hedgeResult{attempt: attempt, err: pub.Publish(attemptCtx, cp)}
+		}()
+		sent++
+		pending++
+		if attempt > 0 {
+			p.opts.Metrics.IncCounter(MetricPublishHedges, nil, 1)
+		}
+		return true
+	}
+	if !send() {
+		return ErrClosed
+	}
+
+	timer := p.opts.Clock.NewTimer(p.opts.After)
+	defer func() { timer.Stop() }()
+
+	var errs []error
+	for {
+		var hedge <-chan time.Time
+		if sent < p.opts.MaxAttempts {
+			hedge = timer.C()
+		}
+
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				if r.attempt > 0 {
+					p.opts.Metrics.IncCounter(MetricPublishHedgeWins, nil, 1)
+				}
+				return nil
+			}
+			errs = append(errs, r.err)
+			if pending > 0 {
+				continue
+			}
+			if sent == p.opts.MaxAttempts || ctx.Err() != nil || !send() {
+				return errors.Join(errs...)
+			}
+		case <-hedge:
+			if !send() {
+				continue
+			}
+		case <-ctx.Done():
+			return WrapError(ErrPublishFailed, ctx.Err())
+		}
+
+		// Wait After from the latest attempt before the next
+		timer.Stop()
+		timer = p.opts.Clock.NewTimer(p.opts.After)
+	}
+}
+
+// BrokerProperties returns the broker properties of the first publisher.
+func (p *hedgedPublisher) BrokerProperties() map[string]interface{} {
+	return brokerProperties(p.pubs[0])
+}
+
+// Close waits for attempts in flight and closes the publishers.
+func (p *hedgedPublisher) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil
+	}
+	p.closed = true
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+
+	var errs []error
+	for _, pub := range p.pubs {
+		if err := pub.Close(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// NewHedgedPublisher creates a hedged publisher (see NewHedgedPublisher)
+// with a connection per attempt, so that a hedge does not queue behind the
+// attempt it hedges. Messages without an ID are given one before the first
+// attempt, by Config.MessageIDStrategy or Config.MessageIDGenerator, even
+// without Config.AutoMessageID; set a deterministic strategy so that
+// retries of a failed Publish carry the same ID as well. Hooks and the
+// quota apply once per Publish. Messages addressed with Message.To are not
+// hedged, and the publisher does not implement ScheduledPublisher.
+func (c *Client) NewHedgedPublisher(ctx context.Context, opts HedgeOptions) (Publisher, error) {
+	if opts.After <= 0 {
+		return nil, ErrInvalidConfig("hedge delay must be positive")
+	}
+	if opts.MessageID == nil {
+		opts.MessageID = c.messageIDStrategy()
+	}
+	if opts.Metrics == nil {
+		opts.Metrics = c.metrics
+	}
+	opts = opts.WithDefaults()
+
+	first, err := c.trackPublisher(ctx, c.openPublisher)
+	if err != nil {
+		return nil, err
+	}
+	pubs := []Publisher{first}
+	for len(pubs) < opts.MaxAttempts {
+		// Not tracked, so that the extra connections are not reported as
+		// duplicate publishers
+		pub, err := c.openPublisher(ctx)
+		if err != nil {
+			for _, pub := range pubs {
+				pub.Close(ctx)
+			}
+			return nil, err
+		}
+		pubs = append(pubs, pub)
+	}
+
+	hedged, err := NewHedgedPublisher(pubs, opts)
+	if err != nil {
+		return nil, err
+	}
+	return c.decoratePublisher(hedged), nil
+}
@@ -0,0 +1,283 @@
+package gokyu
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gatedPublisher records published messages and holds each Publish until a
+// result is released to it.
+type gatedPublisher struct {
+	mu        sync.Mutex
+	published []*Message
+	results   chan error
+	closed    bool
+}
+
+func newGatedPublisher() *gatedPublisher {
+	return &gatedPublisher{results: make(chan error, 8)}
+}
+
+func (p *gatedPublisher) Publish(ctx context.Context, msg *Message) error {
+	p.mu.Lock()
+	p.published = append(p.published, msg)
+	p.mu.Unlock()
+	select {
+	case err := <-p.results:
+		return err
+	case <-ctx.Done():
+		return WrapError(ErrPublishFailed, ctx.Err())
+	}
+}
+
+func (p *gatedPublisher) Close(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	return nil
+}
+
+// waitForPublishes waits until n messages were published to p.
+func (p *gatedPublisher) waitForPublishes(t *testing.T, n int) []*Message {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		p.mu.Lock()
+		published := append([]*Message(nil), p.published...)
+		p.mu.Unlock()
+		if len(published) >= n {
+			return published
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d publishes, got %d", n, len(published))
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestHedgedPublisher_HedgeWins(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	metrics := newCountingMetrics()
+	slow, fast := newGatedPublisher(), newGatedPublisher()
+	pub, err := NewHedgedPublisher([]Publisher{slow, fast}, HedgeOptions{After: 50 * time.Millisecond, Metrics: metrics, Clock: clock})
+	if err != nil {
+		t.Fatalf("NewHedgedPublisher() error = %v", err)
+	}
+
+	msg := NewMessage([]byte("order"))
+	msg.ID = "m-1"
+	msg.Properties["tenant"] = "acme"
+	done := make(chan error, 1)
+	go func() { done <- pub.Publish(context.Background(), msg) }()
+
+	slow.waitForPublishes(t, 1)
+	waitForTimers(t, clock, 1)
+	clock.Advance(50 * time.Millisecond)
+	hedge := fast.waitForPublishes(t, 1)[0]
+	fast.results <- nil
+
+	if err := <-done; err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	original := slow.waitForPublishes(t, 1)[0]
+	if original.ID != "m-1" || hedge.ID != "m-1" || hedge.Properties["tenant"] != "acme" {
+		t.Errorf("attempts = %+v and %+v, want copies with ID m-1", original, hedge)
+	}
+	if original == hedge || original == msg {
+		t.Error("attempts share a message, want a copy each")
+	}
+	if metrics.counters[MetricPublishHedges] != 1 || metrics.counters[MetricPublishHedgeWins] != 1 {
+		t.Errorf("metrics = %v, want one hedge that won", metrics.counters)
+	}
+
+	// Close waits for the losing attempt
+	closed := make(chan error, 1)
+	go func() { closed <- pub.Close(context.Background()) }()
+	select {
+	case <-closed:
+		t.Fatal("Close() returned with an attempt in flight")
+	case <-time.After(20 * time.Millisecond):
+	}
+	slow.results <- nil
+	if err := <-closed; err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if !slow.closed || !fast.closed {
+		t.Error("Close() did not close the publishers")
+	}
+	if err := pub.Publish(context.Background(), msg); !errors.Is(err, ErrClosed) {
+		t.Errorf("Publish() after Close error = %v, want ErrClosed", err)
+	}
+}
+
+func TestHedgedPublisher_CancelDoesNotAbortAttempts(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	gated := newGatedPublisher()
+	pub, _ := NewHedgedPublisher([]Publisher{gated}, HedgeOptions{After: 50 * time.Millisecond, Clock: clock})
+
+	msg := NewMessage([]byte("order"))
+	msg.ID = "m-1"
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- pub.Publish(ctx, msg) }()
+	gated.waitForPublishes(t, 1)
+
+	cancel()
+	if err := <-done; !errors.Is(err, ErrPublishFailed) || !strings.Contains(err.Error(), context.Canceled.Error()) {
+		t.Errorf("Publish() after cancel error = %v", err)
+	}
+
+	// The attempt is still in flight and completes on its own
+	closed := make(chan error, 1)
+	go func() { closed <- pub.Close(context.Background()) }()
+	select {
+	case <-closed:
+		t.Fatal("Close() returned with an attempt in flight")
+	case <-time.After(20 * time.Millisecond):
+	}
+	gated.results <- nil
+	if err := <-closed; err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+}
+
+func TestHedgedPublisher_NoHedgeWhenFast(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	first, second := newGatedPublisher(), newGatedPublisher()
+	pub, _ := NewHedgedPublisher([]Publisher{first, second}, HedgeOptions{After: time.Second, Clock: clock})
+
+	first.results <- nil
+	msg := NewMessage(nil)
+	msg.ID = "m-1"
+	if err := pub.Publish(context.Background(), msg); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if n := len(second.published); n != 0 {
+		t.Errorf("hedge publisher got %d messages, want 0", n)
+	}
+	if n := clock.Timers(); n != 0 {
+		t.Errorf("%d timers left pending", n)
+	}
+
+	// Originals alternate between the publishers
+	second.results <- nil
+	msg.ID = "m-2"
+	pub.Publish(context.Background(), msg)
+	if n := len(second.published); n != 1 {
+		t.Errorf("second publisher got %d messages, want 1", n)
+	}
+}
+
+func TestHedgedPublisher_FailureHedgesAtOnce(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	first, second := newGatedPublisher(), newGatedPublisher()
+	pub, _ := NewHedgedPublisher([]Publisher{first, second}, HedgeOptions{After: time.Minute, Clock: clock})
+
+	first.results <- WrapError(ErrPublishFailed, errors.New("connection reset"))
+	second.results <- WrapError(ErrPublishFailed, errors.New("broker busy"))
+	msg := NewMessage(nil)
+	msg.ID = "m-1"
+	err := pub.Publish(context.Background(), msg)
+	if !errors.Is(err, ErrPublishFailed) {
+		t.Fatalf("Publish() error = %v, want ErrPublishFailed", err)
+	}
+	for _, want := range []string{"connection reset", "broker busy"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Publish() error = %v, want it to include %q", err, want)
+		}
+	}
+}
+
+func TestHedgedPublisher_MessageID(t *testing.T) {
+	first, second := newGatedPublisher(), newGatedPublisher()
+	pub, _ := NewHedgedPublisher([]Publisher{first, second}, HedgeOptions{After: time.Second})
+	if err := pub.Publish(context.Background(), NewMessage(nil)); !errors.Is(err, ErrMessageIDRequired) {
+		t.Errorf("Publish() without ID error = %v, want ErrMessageIDRequired", err)
+	}
+
+	calls := 0
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	pub, _ = NewHedgedPublisher([]Publisher{first, second}, HedgeOptions{
+		After: time.Second,
+		Clock: clock,
+		MessageID: MessageIDFunc(func(*Message) (string, error) {
+			calls++
+			return "assigned", nil
+		}),
+	})
+	first.results <- WrapError(ErrPublishFailed, errors.New("timeout"))
+	second.results <- nil
+	msg := NewMessage(nil)
+	if err := pub.Publish(context.Background(), msg); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if calls != 1 || msg.ID != "assigned" {
+		t.Errorf("strategy called %d times, ID = %q; want once, assigned", calls, msg.ID)
+	}
+	if id := second.waitForPublishes(t, 1)[0].ID; id != "assigned" {
+		t.Errorf("hedge ID = %q, want the ID of the original", id)
+	}
+
+	if _, err := NewHedgedPublisher([]Publisher{first}, HedgeOptions{}); err == nil {
+		t.Error("NewHedgedPublisher() without After succeeded, want error")
+	}
+}
+
+// countingFactory creates gated publishers and counts them.
+type countingFactory struct {
+	mockFactory
+	mu   sync.Mutex
+	pubs []*gatedPublisher
+}
+
+func (f *countingFactory) NewPublisher(ctx context.Context, cfg *Config) (Publisher, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	pub := newGatedPublisher()
+	pub.results <- nil
+	f.pubs = append(f.pubs, pub)
+	return pub, nil
+}
+
+func TestClient_NewHedgedPublisher(t *testing.T) {
+	provider := Provider("test-hedge-provider")
+	factory := &countingFactory{}
+	RegisterProvider(provider, factory)
+
+	hooks := 0
+	client, _ := NewClient(&Config{
+		Provider:          provider,
+		ConnectionString:  "amqps://test",
+		Queue:             "orders",
+		MessageIDStrategy: PropertyHashMessageID("order"),
+		PublishHooks: []PublishHook{func(ctx context.Context, msg *Message) error {
+			hooks++
+			return nil
+		}},
+	})
+	pub, err := client.NewHedgedPublisher(context.Background(), HedgeOptions{After: time.Second, MaxAttempts: 3})
+	if err != nil {
+		t.Fatalf("NewHedgedPublisher() error = %v", err)
+	}
+	defer pub.Close(context.Background())
+	if n := len(factory.pubs); n != 3 {
+		t.Fatalf("opened %d provider publishers, want one per attempt", n)
+	}
+
+	msg := NewMessage(nil)
+	msg.Properties["order"] = "o-42"
+	if err := pub.Publish(context.Background(), msg); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	want, _ := PropertyHashMessageID("order").MessageID(msg)
+	if got := factory.pubs[0].waitForPublishes(t, 1)[0].ID; got == "" || got != want {
+		t.Errorf("published ID = %q, want the strategy's %q without AutoMessageID", got, want)
+	}
+	if hooks != 1 {
+		t.Errorf("publish hooks ran %d times, want 1", hooks)
+	}
+}
@@ -0,0 +1,25 @@
+package gokyu
+
+import "context"
+
+// PublishHook is called for every message published through a client's
+// publishers, before the message is handed to the provider. Returning an
+// error aborts the publish.
+type PublishHook func(ctx context.Context, msg *Message) error
+
+// StaticProperties returns a publish hook that adds the given properties to
+// every outgoing message, such as service name, environment, or build
+// version. Properties already set on a message are left unchanged.
+func StaticProperties(props map[string]interface{}) PublishHook {
+	return func(ctx context.Context, msg *Message) error {
+		if msg.Properties == nil {
+			msg.Properties = make(map[string]interface{}, len(props))
+		}
+		for k, v := range props {
+			if _, ok := msg.Properties[k]; !ok {
+				msg.Properties[k] = v
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,56 @@
+package gokyu
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestClient_PublishHooks(t *testing.T) {
+	provider := Provider("test-hooks-provider")
+	factory := &recordingFactory{}
+	RegisterProvider(provider, factory)
+
+	errRejected := errors.New("rejected")
+	client, _ := NewClient(&Config{
+		Provider:         provider,
+		ConnectionString: "amqps://test",
+		Topic:            "topic",
+		PublishHooks: []PublishHook{
+			StaticProperties(map[string]interface{}{
+				"service":     "billing",
+				"environment": "staging",
+			}),
+			func(ctx context.Context, msg *Message) error {
+				if msg.Properties["reject"] == true {
+					return errRejected
+				}
+				return nil
+			},
+		},
+	})
+	pub, _ := client.NewPublisher(context.Background())
+
+	msg := NewMessage([]byte("body"))
+	msg.Properties["environment"] = "override"
+	if err := pub.Publish(context.Background(), msg); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	got := factory.published[0].Properties
+	if got["service"] != "billing" {
+		t.Errorf("expected service property to be added, got %v", got["service"])
+	}
+	if got["environment"] != "override" {
+		t.Errorf("expected existing property to be kept, got %v", got["environment"])
+	}
+
+	rejected := NewMessage(nil)
+	rejected.Properties["reject"] = true
+	if err := pub.Publish(context.Background(), rejected); !errors.Is(err, errRejected) {
+		t.Errorf("expected hook error, got %v", err)
+	}
+	if len(factory.published) != 1 {
+		t.Errorf("expected rejected message not to be published")
+	}
+}
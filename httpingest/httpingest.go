@@ -0,0 +1,246 @@
+// Package httpingest provides an HTTP handler that publishes POSTed payloads
+// through a gokyu publisher, so external partners can inject events without
+// broker credentials.
+//
+// # Plain Requests
+//
+// The request body becomes the message body and the Content-Type header its
+// content type. The message ID is taken from the Gokyu-Message-Id header and
+// Gokyu-Property-<name> headers are copied to message properties.
+//
+// # CloudEvents
+//
+// CloudEvents are accepted in both HTTP content modes:
+//   - Binary mode: ce-* headers carry the attributes and the body is the data.
+//   - Structured mode: Content-Type application/cloudevents+json with the
+//     event serialized as JSON.
+//
+// The event id becomes the message ID, datacontenttype the content type, and
+// the remaining attributes are stored as "cloudEvents:<name>" properties
+// following the CloudEvents AMQP binding.
+//
+// # Usage
+//
+//	http.Handle("/events", httpingest.NewHandler(publisher, &httpingest.Config{
+//	    Authenticate: func(r *http.Request) error {
+//	        if r.Header.Get("Authorization") != "Bearer "+token {
+//	            return httpingest.ErrUnauthorized
+//	        }
+//	        return nil
+//	    },
+//	}))
+//
+// Authenticate also accepts any authorizer from the auth package, e.g.
+// API keys, client certificates or OIDC tokens:
+//
+//	httpingest.NewHandler(publisher, &httpingest.Config{
+//	    Authenticate: auth.Any(keys, oidc).Authorize,
+//	})
+package httpingest
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/venderneutral/gokyu"
+	"github.com/venderneutral/gokyu/auth"
+)
+
+// DefaultMaxBodySize is the request body limit used when none is configured.
+const DefaultMaxBodySize = 1 << 20
+
+// Request headers for plain (non-CloudEvents) requests.
+const (
+	HeaderMessageID  = "Gokyu-Message-Id"
+	HeaderProperties = "Gokyu-Property-"
+)
+
+// CloudEventsPropertyPrefix prefixes CloudEvents attributes stored as message properties.
+const CloudEventsPropertyPrefix = "cloudEvents:"
+
+// contentTypeCloudEvents is the media type of structured-mode CloudEvents.
+const contentTypeCloudEvents = "application/cloudevents+json"
+
+// ErrUnauthorized can be returned by an Authenticate hook to reject a request
+// with 401 Unauthorized, as can auth.ErrUnauthorized. Any other error results
+// in 403 Forbidden.
+var ErrUnauthorized = errors.New("httpingest: unauthorized")
+
+// Config holds the configuration of an ingestion handler.
+type Config struct {
+	// Authenticate is called before a request is processed. Returning a
+	// non-nil error rejects the request.
+	Authenticate func(r *http.Request) error
+
+	// MaxBodySize limits the size of request bodies in bytes (default: 1 MiB).
+	MaxBodySize int64
+}
+
+// Handler publishes HTTP request payloads as messages.
+type Handler struct {
+	publisher gokyu.Publisher
+	cfg       Config
+}
+
+// NewHandler creates a handler that publishes through pub.
+func NewHandler(pub gokyu.Publisher, cfg *Config) *Handler {
+	h := &Handler{publisher: pub}
+	if cfg != nil {
+		h.cfg = *cfg
+	}
+	if h.cfg.MaxBodySize <= 0 {
+		h.cfg.MaxBodySize = DefaultMaxBodySize
+	}
+	return h
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	if h.cfg.Authenticate != nil {
+		if err := h.cfg.Authenticate(r); err != nil {
+			status := http.StatusForbidden
+			if errors.Is(err, ErrUnauthorized) || errors.Is(err, auth.ErrUnauthorized) {
+				status = http.StatusUnauthorized
+			}
+			writeError(w, status, err.Error())
+			return
+		}
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, h.cfg.MaxBodySize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, http.StatusRequestEntityTooLarge, "request body too large")
+			return
+		}
+		writeError(w, http.StatusBadRequest, "failed to read request body")
+		return
+	}
+
+	var msg *gokyu.Message
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch {
+	case mediaType == contentTypeCloudEvents:
+		msg, err = structuredEvent(body)
+	case r.Header.Get("Ce-Specversion") != "":
+		msg = binaryEvent(r.Header, body)
+	default:
+		msg = plainMessage(r.Header, body)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := h.publisher.Publish(r.Context(), msg); err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// plainMessage builds a message from a non-CloudEvents request.
+func plainMessage(header http.Header, body []byte) *gokyu.Message {
+	msg := gokyu.NewMessage(body)
+	msg.ID = header.Get(HeaderMessageID)
+	msg.ContentType = header.Get("Content-Type")
+	for k, v := range header {
+		if name, ok := strings.CutPrefix(k, HeaderProperties); ok && len(v) > 0 {
+			msg.Properties[strings.ToLower(name)] = v[0]
+		}
+	}
+	return msg
+}
+
+// binaryEvent builds a message from a binary-mode CloudEvent.
+func binaryEvent(header http.Header, body []byte) *gokyu.Message {
+	msg := gokyu.NewMessage(body)
+	msg.ContentType = header.Get("Content-Type")
+	for k, v := range header {
+		name, ok := strings.CutPrefix(k, "Ce-")
+		if !ok || len(v) == 0 {
+			continue
+		}
+		name = strings.ToLower(name)
+		if name == "id" {
+			msg.ID = v[0]
+		}
+		msg.Properties[CloudEventsPropertyPrefix+name] = v[0]
+	}
+	return msg
+}
+
+// structuredEvent builds a message from a structured-mode CloudEvent.
+func structuredEvent(body []byte) (*gokyu.Message, error) {
+	var event map[string]json.RawMessage
+	if err := json.Unmarshal(body, &event); err != nil {
+		return nil, errors.New("invalid cloudevent: " + err.Error())
+	}
+	if _, ok := event["specversion"]; !ok {
+		return nil, errors.New("invalid cloudevent: specversion is required")
+	}
+
+	msg := gokyu.NewMessage(nil)
+	for name, raw := range event {
+		switch name {
+		case "data":
+			msg.Body = []byte(raw)
+		case "data_base64":
+			var encoded string
+			if err := json.Unmarshal(raw, &encoded); err != nil {
+				return nil, errors.New("invalid cloudevent: data_base64 must be a string")
+			}
+			data, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return nil, errors.New("invalid cloudevent: data_base64 is not valid base64")
+			}
+			msg.Body = data
+		default:
+			var value interface{}
+			if err := json.Unmarshal(raw, &value); err != nil {
+				return nil, errors.New("invalid cloudevent: " + err.Error())
+			}
+			if s, ok := value.(string); ok {
+				switch name {
+				case "id":
+					msg.ID = s
+				case "datacontenttype":
+					msg.ContentType = s
+				}
+			}
+			msg.Properties[CloudEventsPropertyPrefix+name] = value
+		}
+	}
+
+	if raw, ok := event["data"]; ok {
+		switch {
+		case msg.ContentType == "":
+			msg.ContentType = gokyu.ContentTypeJSON
+		case !strings.HasSuffix(msg.ContentType, "json") && len(raw) > 0 && raw[0] == '"':
+			// Non-JSON data is carried as a JSON string
+			var text string
+			if err := json.Unmarshal(raw, &text); err == nil {
+				msg.Body = []byte(text)
+			}
+		}
+	}
+	return msg, nil
+}
+
+// writeError writes a JSON error response.
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
@@ -0,0 +1,169 @@
+package httpingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/venderneutral/gokyu"
+	"github.com/venderneutral/gokyu/auth"
+)
+
+type recordingPublisher struct {
+	published []*gokyu.Message
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, msg *gokyu.Message) error {
+	p.published = append(p.published, msg)
+	return nil
+}
+
+func (p *recordingPublisher) Close(ctx context.Context) error { return nil }
+
+func TestHandler_PlainRequest(t *testing.T) {
+	pub := &recordingPublisher{}
+	h := NewHandler(pub, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"order":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderMessageID, "m1")
+	req.Header.Set(HeaderProperties+"tenant", "acme")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d: %s", rec.Code, rec.Body)
+	}
+	msg := pub.published[0]
+	if msg.ID != "m1" || msg.ContentType != "application/json" || string(msg.Body) != `{"order":1}` {
+		t.Errorf("unexpected message: %+v", msg)
+	}
+	if msg.Properties["tenant"] != "acme" {
+		t.Errorf("expected tenant property, got %v", msg.Properties)
+	}
+}
+
+func TestHandler_BinaryCloudEvent(t *testing.T) {
+	pub := &recordingPublisher{}
+	h := NewHandler(pub, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("payload"))
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("ce-specversion", "1.0")
+	req.Header.Set("ce-id", "evt-1")
+	req.Header.Set("ce-type", "com.example.created")
+	req.Header.Set("ce-source", "/partners/acme")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d: %s", rec.Code, rec.Body)
+	}
+	msg := pub.published[0]
+	if msg.ID != "evt-1" || string(msg.Body) != "payload" {
+		t.Errorf("unexpected message: %+v", msg)
+	}
+	if msg.Properties["cloudEvents:type"] != "com.example.created" {
+		t.Errorf("expected type attribute, got %v", msg.Properties)
+	}
+}
+
+func TestHandler_StructuredCloudEvent(t *testing.T) {
+	tests := []struct {
+		name     string
+		event    string
+		wantBody string
+		wantType string
+	}{
+		{
+			name:     "json data",
+			event:    `{"specversion":"1.0","id":"evt-1","type":"t","source":"s","data":{"a":1}}`,
+			wantBody: `{"a":1}`,
+			wantType: gokyu.ContentTypeJSON,
+		},
+		{
+			name:     "text data",
+			event:    `{"specversion":"1.0","id":"evt-1","type":"t","source":"s","datacontenttype":"text/plain","data":"hi"}`,
+			wantBody: "hi",
+			wantType: "text/plain",
+		},
+		{
+			name:     "base64 data",
+			event:    `{"specversion":"1.0","id":"evt-1","type":"t","source":"s","datacontenttype":"application/octet-stream","data_base64":"aGk="}`,
+			wantBody: "hi",
+			wantType: "application/octet-stream",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub := &recordingPublisher{}
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.event))
+			req.Header.Set("Content-Type", "application/cloudevents+json; charset=utf-8")
+			rec := httptest.NewRecorder()
+			NewHandler(pub, nil).ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusAccepted {
+				t.Fatalf("expected status 202, got %d: %s", rec.Code, rec.Body)
+			}
+			msg := pub.published[0]
+			if msg.ID != "evt-1" || string(msg.Body) != tt.wantBody || msg.ContentType != tt.wantType {
+				t.Errorf("unexpected message: id=%q body=%q type=%q", msg.ID, msg.Body, msg.ContentType)
+			}
+		})
+	}
+}
+
+func TestHandler_Rejections(t *testing.T) {
+	authenticate := func(r *http.Request) error {
+		switch r.Header.Get("Authorization") {
+		case "":
+			return ErrUnauthorized
+		case "Bearer good":
+			return nil
+		case "Bearer expired":
+			return fmt.Errorf("%w: token has expired", auth.ErrUnauthorized)
+		default:
+			return errors.New("forbidden")
+		}
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		auth       string
+		body       string
+		wantStatus int
+	}{
+		{name: "wrong method", method: http.MethodGet, auth: "Bearer good", wantStatus: http.StatusMethodNotAllowed},
+		{name: "missing credentials", method: http.MethodPost, wantStatus: http.StatusUnauthorized},
+		{name: "bad credentials", method: http.MethodPost, auth: "Bearer bad", wantStatus: http.StatusForbidden},
+		{name: "authorizer credentials", method: http.MethodPost, auth: "Bearer expired", wantStatus: http.StatusUnauthorized},
+		{name: "body too large", method: http.MethodPost, auth: "Bearer good", body: strings.Repeat("x", 20), wantStatus: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub := &recordingPublisher{}
+			h := NewHandler(pub, &Config{Authenticate: authenticate, MaxBodySize: 10})
+
+			req := httptest.NewRequest(tt.method, "/", strings.NewReader(tt.body))
+			if tt.auth != "" {
+				req.Header.Set("Authorization", tt.auth)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+			if len(pub.published) != 0 {
+				t.Error("expected no message to be published")
+			}
+		})
+	}
+}
@@ -0,0 +1,896 @@
+// Package amqptest provides an in-memory AMQP 1.0 broker for testing the
+// AMQP providers without a real one.
+//
+// The broker implements what go-amqp needs to open connections, sessions and
+// links, to transfer messages in both directions and to settle them. Every
+// address is a queue, unless a handler answers the messages sent to it like
+// a request/response node. It does not implement SASL, so connection strings must
+// not carry credentials, nor transactions, message annotations added by the
+// broker, or session flow control.
+package amqptest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+)
+
+// Performative and section descriptors.
+const (
+	descOpen        = 0x10
+	descBegin       = 0x11
+	descAttach      = 0x12
+	descFlow        = 0x13
+	descTransfer    = 0x14
+	descDisposition = 0x15
+	descDetach      = 0x16
+	descEnd         = 0x17
+	descClose       = 0x18
+	descError       = 0x1d
+	descAccepted    = 0x24
+	descReleased    = 0x26
+	descModified    = 0x27
+	descSource      = 0x28
+	descTarget      = 0x29
+)
+
+// protocolHeader is the AMQP protocol header without SASL.
+var protocolHeader = []byte{'A', 'M', 'Q', 'P', 0, 1, 0, 0}
+
+// senderCredit is the credit granted to client senders, enough for any test.
+const senderCredit = 1 << 20
+
+// Server is an in-memory AMQP 1.0 broker listening on a local port.
+type Server struct {
+	listener net.Listener
+
+	// dispatchMu orders deliveries, so that transfers are written in the
+	// order of their delivery IDs
+	dispatchMu sync.Mutex
+
+	mu        sync.Mutex
+	queues    map[string][][]byte
+	handlers  map[string]func(payload []byte) [][]byte
+	links     []*link // links on which the broker sends
+	attached  []*link // all attached links
+	attaches  map[string]int
+	closed    bool
+	connGroup sync.WaitGroup
+	conns     map[*conn]bool
+}
+
+// NewServer starts a broker that is closed when the test ends.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("amqptest: listen: %v", err)
+	}
+	s := &Server{
+		listener: listener,
+		queues:   make(map[string][][]byte),
+		handlers: make(map[string]func([]byte) [][]byte),
+		attaches: make(map[string]int),
+		conns:    make(map[*conn]bool),
+	}
+	go s.accept()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// URL returns the connection string of the broker.
+func (s *Server) URL() string {
+	return "amqp://" + s.listener.Addr().String()
+}
+
+// Attaches returns how many links were attached to address, by senders and
+// receivers together.
+func (s *Server) Attaches(address string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.attaches[address]
+}
+
+// Depth returns the number of messages queued at address, not counting
+// those delivered but not yet settled.
+func (s *Server) Depth(address string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queues[address])
+}
+
+// Handle answers the messages sent to address with handler instead of
+// queueing them. The encoded messages handler returns are queued at address
+// for its receivers, as replies of a request/response node such as the
+// $management node of Service Bus.
+func (s *Server) Handle(address string, handler func(payload []byte) [][]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[address] = handler
+}
+
+// Detach detaches every link attached to address with the
+// amqp:link:detach-forced error, as brokers do with idle links. Messages
+// delivered on them but not settled are queued again.
+func (s *Server) Detach(address string) {
+	s.mu.Lock()
+	var detached []*link
+	for _, l := range s.attached {
+		if l.address == address && !l.detached {
+			l.detached = true
+			detached = append(detached, l)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, l := range detached {
+		s.removeLink(l)
+		l.session.conn.writePerformative(l.session.channel, descDetach, []interface{}{
+			l.handle, true, described{code: descError, value: []interface{}{symbol("amqp:link:detach-forced"), "detached by amqptest"}},
+		})
+	}
+}
+
+// Close stops the broker and closes all connections.
+func (s *Server) Close() {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	for c := range s.conns {
+		c.nc.Close()
+	}
+	s.mu.Unlock()
+
+	s.listener.Close()
+	s.connGroup.Wait()
+}
+
+func (s *Server) accept() {
+	for {
+		nc, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		c := &conn{server: s, nc: nc, sessions: make(map[uint16]*session)}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			nc.Close()
+			return
+		}
+		s.conns[c] = true
+		s.connGroup.Add(1)
+		s.mu.Unlock()
+		go c.serve()
+	}
+}
+
+// enqueue queues payload at address and delivers what it can.
+func (s *Server) enqueue(address string, payload []byte, front bool) {
+	s.mu.Lock()
+	if front {
+		s.queues[address] = append([][]byte{payload}, s.queues[address]...)
+	} else {
+		s.queues[address] = append(s.queues[address], payload)
+	}
+	s.mu.Unlock()
+	s.dispatch()
+}
+
+// dispatch sends queued messages to receiving links with credit.
+func (s *Server) dispatch() {
+	s.dispatchMu.Lock()
+	defer s.dispatchMu.Unlock()
+	for {
+		s.mu.Lock()
+		var (
+			target  *link
+			id      uint32
+			payload []byte
+		)
+		for _, l := range s.links {
+			if l.credit > 0 && len(s.queues[l.address]) > 0 {
+				target = l
+				payload = s.queues[l.address][0]
+				s.queues[l.address] = s.queues[l.address][1:]
+				l.credit--
+				l.deliveryCount++
+				id = l.session.nextDeliveryID
+				l.session.nextDeliveryID++
+				l.unsettled[id] = payload
+				break
+			}
+		}
+		s.mu.Unlock()
+		if target == nil {
+			return
+		}
+		target.deliver(id, payload)
+	}
+}
+
+// removeLink stops delivering to l and requeues its unsettled messages.
+func (s *Server) removeLink(l *link) {
+	s.mu.Lock()
+	for i, other := range s.links {
+		if other == l {
+			s.links = append(s.links[:i], s.links[i+1:]...)
+			break
+		}
+	}
+	for i, other := range s.attached {
+		if other == l {
+			s.attached = append(s.attached[:i], s.attached[i+1:]...)
+			break
+		}
+	}
+	var requeue [][]byte
+	for _, payload := range l.unsettled {
+		requeue = append(requeue, payload)
+	}
+	l.unsettled = nil
+	s.mu.Unlock()
+
+	for _, payload := range requeue {
+		s.enqueue(l.address, payload, true)
+	}
+}
+
+// conn is a client connection.
+type conn struct {
+	server *Server
+	nc     net.Conn
+
+	writeMu  sync.Mutex
+	sessions map[uint16]*session // by channel, read by the serving goroutine only
+}
+
+// session is a session of a connection. The broker uses the client's channel
+// number as its own.
+type session struct {
+	conn           *conn
+	channel        uint16
+	nextDeliveryID uint32           // guarded by Server.mu
+	links          map[uint32]*link // by client handle
+	nextHandle     uint32
+}
+
+// link is an attached link.
+type link struct {
+	session *session
+	name    string
+	handle  uint32 // the broker's handle
+	sending bool   // the broker sends on the link
+	address string
+
+	// Guarded by Server.mu
+	credit        uint32
+	deliveryCount uint32
+	unsettled     map[uint32][]byte // by delivery ID
+
+	// detached is set once the broker detached the link, guarded by
+	// Server.mu
+	detached bool
+
+	// Partial transfer from the client, read by the serving goroutine only
+	partial   []byte
+	partialID uint32
+	settled   bool
+}
+
+func (c *conn) serve() {
+	defer c.server.connGroup.Done()
+	defer c.close()
+
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(c.nc, header); err != nil || !bytes.Equal(header, protocolHeader) {
+		c.nc.Write(protocolHeader)
+		return
+	}
+	if _, err := c.nc.Write(protocolHeader); err != nil {
+		return
+	}
+
+	for {
+		channel, body, err := c.readFrame()
+		if err != nil {
+			return
+		}
+		if len(body) == 0 {
+			continue // heartbeat
+		}
+		perf, payload, err := decodeValue(body)
+		if err != nil {
+			return
+		}
+		d, ok := perf.(described)
+		if !ok {
+			return
+		}
+		fields, _ := d.value.([]interface{})
+		if !c.handle(channel, d.code, list(fields), payload) {
+			return
+		}
+	}
+}
+
+// close detaches all links of the connection.
+func (c *conn) close() {
+	c.nc.Close()
+	for _, sess := range c.sessions {
+		for _, l := range sess.links {
+			c.server.removeLink(l)
+		}
+	}
+	c.server.mu.Lock()
+	delete(c.server.conns, c)
+	c.server.mu.Unlock()
+}
+
+// handle handles a performative, returning false once the connection closes.
+func (c *conn) handle(channel uint16, code uint64, fields list, payload []byte) bool {
+	switch code {
+	case descOpen:
+		c.writePerformative(0, descOpen, []interface{}{"amqptest", nil, uint32(65536), uint16(255)})
+
+	case descBegin:
+		sess := &session{conn: c, channel: channel, links: make(map[uint32]*link)}
+		c.sessions[channel] = sess
+		c.writePerformative(channel, descBegin, []interface{}{channel, uint32(0), uint32(1 << 20), uint32(1 << 20), uint32(1024)})
+
+	case descAttach:
+		c.attach(c.sessions[channel], fields)
+
+	case descFlow:
+		sess := c.sessions[channel]
+		if sess == nil || fields.get(4) == nil {
+			return true // session flow
+		}
+		if l := sess.links[fields.uint(4)]; l != nil && l.sending {
+			c.flow(l, fields)
+		}
+
+	case descTransfer:
+		sess := c.sessions[channel]
+		if sess == nil {
+			return false
+		}
+		if l := sess.links[fields.uint(0)]; l != nil && !l.sending {
+			c.transfer(l, fields, payload)
+		}
+
+	case descDisposition:
+		c.disposition(c.sessions[channel], fields)
+
+	case descDetach:
+		sess := c.sessions[channel]
+		if sess == nil {
+			return false
+		}
+		handle := fields.uint(0)
+		if l := sess.links[handle]; l != nil {
+			delete(sess.links, handle)
+			c.server.removeLink(l)
+			c.server.mu.Lock()
+			answered := l.detached
+			c.server.mu.Unlock()
+			if !answered {
+				c.writePerformative(channel, descDetach, []interface{}{l.handle, true})
+			}
+		}
+
+	case descEnd:
+		if sess := c.sessions[channel]; sess != nil {
+			for handle, l := range sess.links {
+				delete(sess.links, handle)
+				c.server.removeLink(l)
+			}
+			delete(c.sessions, channel)
+		}
+		c.writePerformative(channel, descEnd, nil)
+
+	case descClose:
+		c.writePerformative(0, descClose, nil)
+		return false
+	}
+	return true
+}
+
+// attach answers the attach of a client link. A client receiver makes the
+// broker the sender, and vice versa.
+func (c *conn) attach(sess *session, fields list) {
+	if sess == nil {
+		return
+	}
+	name, _ := fields.get(0).(string)
+	clientHandle := fields.uint(1)
+	clientReceives, _ := fields.get(2).(bool)
+
+	// The address is that of the source for receivers, of the target for
+	// senders
+	terminus := fields.get(5)
+	if !clientReceives {
+		terminus = fields.get(6)
+	}
+	var address string
+	if d, ok := terminus.(described); ok {
+		if tf, ok := d.value.([]interface{}); ok {
+			address, _ = list(tf).get(0).(string)
+		}
+	}
+
+	l := &link{
+		session:   sess,
+		name:      name,
+		handle:    sess.nextHandle,
+		sending:   clientReceives,
+		address:   address,
+		unsettled: make(map[uint32][]byte),
+	}
+	sess.nextHandle++
+	sess.links[clientHandle] = l
+
+	terminusList := []interface{}{address}
+	source := described{code: descSource, value: terminusList}
+	target := described{code: descTarget, value: terminusList}
+	reply := []interface{}{name, l.handle, !clientReceives, nil, nil, source, target, nil, nil}
+	if l.sending {
+		reply = append(reply, uint32(0)) // initial-delivery-count
+	}
+	c.writePerformative(sess.channel, descAttach, reply)
+
+	c.server.mu.Lock()
+	c.server.attaches[address]++
+	c.server.attached = append(c.server.attached, l)
+	if l.sending {
+		c.server.links = append(c.server.links, l)
+	}
+	c.server.mu.Unlock()
+
+	if !l.sending {
+		c.writePerformative(sess.channel, descFlow, []interface{}{
+			uint32(0), uint32(1 << 20), uint32(0), uint32(1 << 20),
+			l.handle, uint32(0), uint32(senderCredit),
+		})
+	}
+}
+
+// flow updates the credit of a link the broker sends on.
+func (c *conn) flow(l *link, fields list) {
+	c.server.mu.Lock()
+	deliveryCount := l.deliveryCount
+	if fields.get(5) != nil {
+		deliveryCount = fields.uint(5)
+	}
+	credit := deliveryCount + fields.uint(6) - l.deliveryCount
+	l.credit = credit
+	drain, _ := fields.get(8).(bool)
+	c.server.mu.Unlock()
+
+	c.server.dispatch()
+
+	if drain {
+		// Use up the credit that could not be used for messages
+		c.server.mu.Lock()
+		l.deliveryCount += l.credit
+		l.credit = 0
+		count := l.deliveryCount
+		c.server.mu.Unlock()
+		c.writePerformative(l.session.channel, descFlow, []interface{}{
+			uint32(0), uint32(1 << 20), uint32(0), uint32(1 << 20),
+			l.handle, count, uint32(0), nil, true,
+		})
+	}
+}
+
+// transfer receives (part of) a message from a client sender.
+func (c *conn) transfer(l *link, fields list, payload []byte) {
+	if l.partial == nil {
+		l.partialID = fields.uint(1)
+		l.settled, _ = fields.get(4).(bool)
+	}
+	l.partial = append(l.partial, payload...)
+	if more, _ := fields.get(5).(bool); more {
+		return
+	}
+	msg := l.partial
+	l.partial = nil
+
+	// Messages crossing a forced detach are lost
+	c.server.mu.Lock()
+	handler := c.server.handlers[l.address]
+	detached := l.detached
+	c.server.mu.Unlock()
+	if detached {
+		return
+	}
+	if handler == nil {
+		c.server.enqueue(l.address, msg, false)
+	} else {
+		for _, reply := range handler(msg) {
+			c.server.enqueue(l.address, reply, false)
+		}
+	}
+	if !l.settled {
+		c.writePerformative(l.session.channel, descDisposition, []interface{}{
+			true, l.partialID, l.partialID, true, described{code: descAccepted, value: []interface{}{}},
+		})
+	}
+}
+
+// disposition settles messages delivered to the client. Released and
+// modified messages are queued again.
+func (c *conn) disposition(sess *session, fields list) {
+	if sess == nil {
+		return
+	}
+	first := fields.uint(1)
+	last := first
+	if fields.get(2) != nil {
+		last = fields.uint(2)
+	}
+	var code uint64
+	if d, ok := fields.get(4).(described); ok {
+		code = d.code
+	}
+
+	for id := first; id <= last; id++ {
+		for _, l := range sess.links {
+			if !l.sending {
+				continue
+			}
+			c.server.mu.Lock()
+			payload, ok := l.unsettled[id]
+			delete(l.unsettled, id)
+			c.server.mu.Unlock()
+			if ok && (code == descReleased || code == descModified) {
+				c.server.enqueue(l.address, payload, true)
+			}
+		}
+	}
+}
+
+// deliver sends payload to the client on l as delivery id.
+func (l *link) deliver(id uint32, payload []byte) {
+	sess := l.session
+	tag := make([]byte, 4)
+	binary.BigEndian.PutUint32(tag, id)
+	sess.conn.writeFrame(sess.channel, descTransfer, []interface{}{l.handle, id, tag, uint32(0), false, false}, payload)
+}
+
+// readFrame reads a frame, returning its channel and body.
+func (c *conn) readFrame() (uint16, []byte, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(c.nc, header); err != nil {
+		return 0, nil, err
+	}
+	size := binary.BigEndian.Uint32(header)
+	doff := int(header[4]) * 4
+	if size < 8 || doff < 8 || int(size) < doff {
+		return 0, nil, errors.New("amqptest: malformed frame")
+	}
+	rest := make([]byte, size-8)
+	if _, err := io.ReadFull(c.nc, rest); err != nil {
+		return 0, nil, err
+	}
+	return binary.BigEndian.Uint16(header[6:]), rest[doff-8:], nil
+}
+
+// writePerformative writes a frame without payload.
+func (c *conn) writePerformative(channel uint16, code uint64, fields []interface{}) {
+	c.writeFrame(channel, code, fields, nil)
+}
+
+// writeFrame writes a performative and its payload as one frame.
+func (c *conn) writeFrame(channel uint16, code uint64, fields []interface{}, payload []byte) {
+	var body bytes.Buffer
+	encodeValue(&body, described{code: code, value: fields})
+	body.Write(payload)
+
+	frame := make([]byte, 8, 8+body.Len())
+	binary.BigEndian.PutUint32(frame, uint32(8+body.Len()))
+	frame[4] = 2 // data offset in 4-byte words
+	binary.BigEndian.PutUint16(frame[6:], channel)
+	frame = append(frame, body.Bytes()...)
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.nc.Write(frame)
+}
+
+// described is a described value.
+type described struct {
+	code  uint64
+	value interface{}
+}
+
+// symbol is an AMQP symbol.
+type symbol string
+
+// list is the fields of a performative; missing trailing fields are nil.
+type list []interface{}
+
+func (l list) get(i int) interface{} {
+	if i < len(l) {
+		return l[i]
+	}
+	return nil
+}
+
+// uint returns field i as a uint32, or 0.
+func (l list) uint(i int) uint32 {
+	switch v := l.get(i).(type) {
+	case uint8:
+		return uint32(v)
+	case uint16:
+		return uint32(v)
+	case uint32:
+		return v
+	case uint64:
+		return uint32(v)
+	}
+	return 0
+}
+
+// encodeValue appends the encoding of v to buf.
+func encodeValue(buf *bytes.Buffer, v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(0x40)
+	case bool:
+		if v {
+			buf.WriteByte(0x41)
+		} else {
+			buf.WriteByte(0x42)
+		}
+	case uint8:
+		buf.Write([]byte{0x50, v})
+	case uint16:
+		buf.WriteByte(0x60)
+		binary.Write(buf, binary.BigEndian, v)
+	case uint32:
+		buf.WriteByte(0x70)
+		binary.Write(buf, binary.BigEndian, v)
+	case uint64:
+		buf.WriteByte(0x80)
+		binary.Write(buf, binary.BigEndian, v)
+	case string:
+		buf.WriteByte(0xb1)
+		binary.Write(buf, binary.BigEndian, uint32(len(v)))
+		buf.WriteString(v)
+	case symbol:
+		buf.WriteByte(0xb3)
+		binary.Write(buf, binary.BigEndian, uint32(len(v)))
+		buf.WriteString(string(v))
+	case []byte:
+		buf.WriteByte(0xb0)
+		binary.Write(buf, binary.BigEndian, uint32(len(v)))
+		buf.Write(v)
+	case []interface{}:
+		var items bytes.Buffer
+		for _, item := range v {
+			encodeValue(&items, item)
+		}
+		buf.WriteByte(0xd0)
+		binary.Write(buf, binary.BigEndian, uint32(4+items.Len()))
+		binary.Write(buf, binary.BigEndian, uint32(len(v)))
+		buf.Write(items.Bytes())
+	case described:
+		// go-amqp only accepts descriptors encoded as smallulong
+		buf.Write([]byte{0x00, 0x53, byte(v.code)})
+		encodeValue(buf, v.value)
+	default:
+		panic(fmt.Sprintf("amqptest: cannot encode %T", v))
+	}
+}
+
+// decodeValue decodes the value at the start of b and returns the rest.
+// Compound values decode to []interface{}, maps to map[interface{}]interface{}
+// and arrays to []interface{}.
+func decodeValue(b []byte) (interface{}, []byte, error) {
+	if len(b) == 0 {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+	code, b := b[0], b[1:]
+	if code == 0x00 {
+		descriptor, rest, err := decodeValue(b)
+		if err != nil {
+			return nil, nil, err
+		}
+		value, rest, err := decodeValue(rest)
+		if err != nil {
+			return nil, nil, err
+		}
+		var d described
+		switch descriptor := descriptor.(type) {
+		case uint64:
+			d.code = descriptor
+		case symbol:
+			// Symbolic descriptors are not used by go-amqp; keep the value
+		}
+		d.value = value
+		return d, rest, nil
+	}
+	return decodeConstructor(code, b)
+}
+
+// decodeConstructor decodes a value of the given format code.
+func decodeConstructor(code byte, b []byte) (interface{}, []byte, error) {
+	fixed := func(n int) ([]byte, []byte, error) {
+		if len(b) < n {
+			return nil, nil, io.ErrUnexpectedEOF
+		}
+		return b[:n], b[n:], nil
+	}
+	variable := func(width int) ([]byte, []byte, error) {
+		sizeBytes, rest, err := fixed(width)
+		if err != nil {
+			return nil, nil, err
+		}
+		size := int(sizeBytes[0])
+		if width == 4 {
+			size = int(binary.BigEndian.Uint32(sizeBytes))
+		}
+		if len(rest) < size {
+			return nil, nil, io.ErrUnexpectedEOF
+		}
+		return rest[:size], rest[size:], nil
+	}
+
+	switch code {
+	case 0x40:
+		return nil, b, nil
+	case 0x41:
+		return true, b, nil
+	case 0x42:
+		return false, b, nil
+	case 0x43:
+		return uint32(0), b, nil
+	case 0x44:
+		return uint64(0), b, nil
+	case 0x45:
+		return []interface{}{}, b, nil
+	case 0x56:
+		v, rest, err := fixed(1)
+		if err != nil {
+			return nil, nil, err
+		}
+		return v[0] != 0, rest, nil
+	case 0x50, 0x51, 0x52, 0x53, 0x54, 0x55:
+		v, rest, err := fixed(1)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch code {
+		case 0x50:
+			return v[0], rest, nil
+		case 0x52:
+			return uint32(v[0]), rest, nil
+		case 0x53:
+			return uint64(v[0]), rest, nil
+		case 0x51:
+			return int8(v[0]), rest, nil
+		case 0x54:
+			return int32(int8(v[0])), rest, nil
+		default:
+			return int64(int8(v[0])), rest, nil
+		}
+	case 0x60, 0x61:
+		v, rest, err := fixed(2)
+		if err != nil {
+			return nil, nil, err
+		}
+		if code == 0x61 {
+			return int16(binary.BigEndian.Uint16(v)), rest, nil
+		}
+		return binary.BigEndian.Uint16(v), rest, nil
+	case 0x70, 0x71, 0x72, 0x73:
+		v, rest, err := fixed(4)
+		if err != nil {
+			return nil, nil, err
+		}
+		if code == 0x70 {
+			return binary.BigEndian.Uint32(v), rest, nil
+		}
+		return int32(binary.BigEndian.Uint32(v)), rest, nil
+	case 0x80, 0x81, 0x82, 0x83:
+		v, rest, err := fixed(8)
+		if err != nil {
+			return nil, nil, err
+		}
+		if code == 0x80 {
+			return binary.BigEndian.Uint64(v), rest, nil
+		}
+		return int64(binary.BigEndian.Uint64(v)), rest, nil
+	case 0x98:
+		return fixed(16)
+	case 0xa0, 0xb0:
+		width := 1
+		if code == 0xb0 {
+			width = 4
+		}
+		v, rest, err := variable(width)
+		return append([]byte(nil), v...), rest, err
+	case 0xa1, 0xb1:
+		width := 1
+		if code == 0xb1 {
+			width = 4
+		}
+		v, rest, err := variable(width)
+		return string(v), rest, err
+	case 0xa3, 0xb3:
+		width := 1
+		if code == 0xb3 {
+			width = 4
+		}
+		v, rest, err := variable(width)
+		return symbol(v), rest, err
+	case 0xc0, 0xd0, 0xc1, 0xd1:
+		width := 1
+		if code == 0xd0 || code == 0xd1 {
+			width = 4
+		}
+		v, rest, err := variable(width)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(v) < width {
+			return nil, nil, io.ErrUnexpectedEOF
+		}
+		items := v[width:] // after the count
+		var values []interface{}
+		for len(items) > 0 {
+			var item interface{}
+			if item, items, err = decodeValue(items); err != nil {
+				return nil, nil, err
+			}
+			values = append(values, item)
+		}
+		if code == 0xc1 || code == 0xd1 {
+			m := make(map[interface{}]interface{}, len(values)/2)
+			for i := 0; i+1 < len(values); i += 2 {
+				m[values[i]] = values[i+1]
+			}
+			return m, rest, nil
+		}
+		if values == nil {
+			values = []interface{}{}
+		}
+		return values, rest, nil
+	case 0xe0, 0xf0:
+		width := 1
+		if code == 0xf0 {
+			width = 4
+		}
+		v, rest, err := variable(width)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(v) < width+1 {
+			return nil, nil, io.ErrUnexpectedEOF
+		}
+		count := int(v[0])
+		if width == 4 {
+			count = int(binary.BigEndian.Uint32(v))
+		}
+		elemCode, items := v[width], v[width+1:]
+		values := make([]interface{}, 0, count)
+		for i := 0; i < count; i++ {
+			var item interface{}
+			if item, items, err = decodeConstructor(elemCode, items); err != nil {
+				return nil, nil, err
+			}
+			values = append(values, item)
+		}
+		return values, rest, nil
+	}
+	return nil, nil, fmt.Errorf("amqptest: unsupported format code %#x", code)
+}
@@ -0,0 +1,125 @@
+package amqptest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-amqp"
+)
+
+func TestServer(t *testing.T) {
+	server := NewServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := amqp.Dial(ctx, server.URL(), nil)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+	session, err := conn.NewSession(ctx, nil)
+	if err != nil {
+		t.Fatalf("NewSession() error = %v", err)
+	}
+	sender, err := session.NewSender(ctx, "orders", nil)
+	if err != nil {
+		t.Fatalf("NewSender() error = %v", err)
+	}
+	for _, body := range []string{"first", "second"} {
+		if err := sender.Send(ctx, amqp.NewMessage([]byte(body)), nil); err != nil {
+			t.Fatalf("Send() error = %v", err)
+		}
+	}
+	if n := server.Depth("orders"); n != 2 {
+		t.Fatalf("Depth() = %d, want 2", n)
+	}
+
+	receiver, err := session.NewReceiver(ctx, "orders", nil)
+	if err != nil {
+		t.Fatalf("NewReceiver() error = %v", err)
+	}
+	msg, err := receiver.Receive(ctx, nil)
+	if err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	if string(msg.GetData()) != "first" {
+		t.Errorf("received %q, want first", msg.GetData())
+	}
+
+	// A released message is delivered again
+	receiver.ReleaseMessage(ctx, msg)
+	msg, _ = receiver.Receive(ctx, nil)
+	if string(msg.GetData()) != "first" {
+		t.Errorf("received %q after release, want first", msg.GetData())
+	}
+	receiver.AcceptMessage(ctx, msg)
+	msg, _ = receiver.Receive(ctx, nil)
+	if string(msg.GetData()) != "second" {
+		t.Errorf("received %q, want second", msg.GetData())
+	}
+	receiver.AcceptMessage(ctx, msg)
+
+	if n := server.Attaches("orders"); n != 2 {
+		t.Errorf("Attaches() = %d, want 2", n)
+	}
+	if err := receiver.Close(ctx); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+}
+
+func TestServer_HandleAndDetach(t *testing.T) {
+	server := NewServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	server.Handle("echo", func(payload []byte) [][]byte {
+		var req amqp.Message
+		if err := req.UnmarshalBinary(payload); err != nil {
+			t.Errorf("UnmarshalBinary() error = %v", err)
+			return nil
+		}
+		reply, _ := amqp.NewMessage(append([]byte("re: "), req.GetData()...)).MarshalBinary()
+		return [][]byte{reply}
+	})
+
+	conn, err := amqp.Dial(ctx, server.URL(), nil)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+	session, err := conn.NewSession(ctx, nil)
+	if err != nil {
+		t.Fatalf("NewSession() error = %v", err)
+	}
+	sender, err := session.NewSender(ctx, "echo", nil)
+	if err != nil {
+		t.Fatalf("NewSender() error = %v", err)
+	}
+	receiver, err := session.NewReceiver(ctx, "echo", nil)
+	if err != nil {
+		t.Fatalf("NewReceiver() error = %v", err)
+	}
+
+	if err := sender.Send(ctx, amqp.NewMessage([]byte("ping")), nil); err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	msg, err := receiver.Receive(ctx, nil)
+	if err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	if string(msg.GetData()) != "re: ping" {
+		t.Errorf("received %q, want the handler's reply", msg.GetData())
+	}
+	receiver.AcceptMessage(ctx, msg)
+
+	server.Detach("echo")
+	var linkErr *amqp.LinkError
+	if _, err := receiver.Receive(ctx, nil); !errors.As(err, &linkErr) || linkErr.RemoteErr == nil || linkErr.RemoteErr.Condition != amqp.ErrCondDetachForced {
+		t.Errorf("Receive() after Detach error = %v, want a forced detach", err)
+	}
+	if err := sender.Send(ctx, amqp.NewMessage([]byte("ping")), nil); !errors.As(err, &linkErr) || linkErr.RemoteErr == nil {
+		t.Errorf("Send() after Detach error = %v, want a forced detach", err)
+	}
+}
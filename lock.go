@@ -0,0 +1,21 @@
+package gokyu
+
+import "context"
+
+// Lock is a lease on a named resource shared by the instances of a
+// deployment, used by features where only one instance may act at a time,
+// such as the scheduler's leader election. Implementations in the lock
+// package are backed by Redis, SQL databases and Azure Blob leases.
+//
+// A lock expires unless renewed: holders call Acquire again well within the
+// lease duration, and other instances take over once it lapses, e.g. when
+// the holder dies.
+type Lock interface {
+	// Acquire takes the lock, or renews it if already held, and reports
+	// whether this instance holds it.
+	Acquire(ctx context.Context) (bool, error)
+
+	// Release gives up the lock if held, so another instance can take it
+	// without waiting for the lease to expire.
+	Release(ctx context.Context) error
+}
@@ -0,0 +1,149 @@
+package lock
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+)
+
+// blobAPIVersion is the Blob service REST API version used for leases.
+const blobAPIVersion = "2021-08-06"
+
+// BlobConfig holds the settings of an Azure Blob Storage lease lock.
+type BlobConfig struct {
+	// URL is the blob holding the lease, with a SAS token granting read,
+	// write and create permissions, e.g.
+	// "https://account.blob.core.windows.net/locks/scheduler?sv=...".
+	// The blob is created if it does not exist.
+	URL string
+
+	// HTTPClient sends requests (default: a client with a 30s timeout).
+	HTTPClient *http.Client
+
+	// Owner identifies this instance and is used as the lease ID, so it must
+	// be a UUID (default: a random UUID).
+	Owner string
+}
+
+// NewBlob returns a lock backed by a lease on an Azure blob. Blob leases
+// last between 15 and 60 seconds; ttl is clamped to that range.
+func NewBlob(cfg BlobConfig, ttl time.Duration) gokyu.Lock {
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	if cfg.Owner == "" {
+		cfg.Owner = newOwner()
+	}
+	if ttl < 15*time.Second {
+		ttl = 15 * time.Second
+	}
+	if ttl > 60*time.Second {
+		ttl = 60 * time.Second
+	}
+	return &blobLock{cfg: cfg, ttl: ttl}
+}
+
+type blobLock struct {
+	cfg BlobConfig
+	ttl time.Duration
+}
+
+// Acquire requests the lease with the owner as lease ID, which also renews
+// a lease the owner already holds.
+func (l *blobLock) Acquire(ctx context.Context) (bool, error) {
+	status, err := l.lease(ctx, "acquire")
+	if err != nil {
+		return false, err
+	}
+	if status == http.StatusNotFound {
+		if err := l.create(ctx); err != nil {
+			return false, err
+		}
+		if status, err = l.lease(ctx, "acquire"); err != nil {
+			return false, err
+		}
+	}
+
+	switch status {
+	case http.StatusCreated, http.StatusOK:
+		return true, nil
+	case http.StatusConflict:
+		return false, nil
+	default:
+		return false, fmt.Errorf("lock: blob: acquire lease: unexpected status %d", status)
+	}
+}
+
+// Release releases the lease. A conflict means the lease is not held by
+// the owner, which is not an error.
+func (l *blobLock) Release(ctx context.Context) error {
+	status, err := l.lease(ctx, "release")
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK && status != http.StatusConflict && status != http.StatusNotFound {
+		return fmt.Errorf("lock: blob: release lease: unexpected status %d", status)
+	}
+	return nil
+}
+
+// lease performs a lease action and returns the response status.
+func (l *blobLock) lease(ctx context.Context, action string) (int, error) {
+	u, err := url.Parse(l.cfg.URL)
+	if err != nil {
+		return 0, fmt.Errorf("lock: blob: %w", err)
+	}
+	q := u.Query()
+	q.Set("comp", "lease")
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, u.String(), nil)
+	if err != nil {
+		return 0, fmt.Errorf("lock: blob: %w", err)
+	}
+	req.Header.Set("x-ms-version", blobAPIVersion)
+	req.Header.Set("x-ms-lease-action", action)
+	if action == "acquire" {
+		req.Header.Set("x-ms-lease-duration", strconv.Itoa(int(l.ttl/time.Second)))
+		req.Header.Set("x-ms-proposed-lease-id", l.cfg.Owner)
+	} else {
+		req.Header.Set("x-ms-lease-id", l.cfg.Owner)
+	}
+	return l.do(req)
+}
+
+// create creates the empty blob holding the lease, unless it exists.
+func (l *blobLock) create(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, l.cfg.URL, http.NoBody)
+	if err != nil {
+		return fmt.Errorf("lock: blob: %w", err)
+	}
+	req.Header.Set("x-ms-version", blobAPIVersion)
+	req.Header.Set("x-ms-blob-type", "BlockBlob")
+	req.Header.Set("If-None-Match", "*")
+
+	status, err := l.do(req)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusCreated && status != http.StatusConflict && status != http.StatusPreconditionFailed {
+		return fmt.Errorf("lock: blob: create blob: unexpected status %d", status)
+	}
+	return nil
+}
+
+func (l *blobLock) do(req *http.Request) (int, error) {
+	resp, err := l.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("lock: blob: %w", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,90 @@
+package lock
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeBlobService emulates blob creation and leases for a single blob.
+type fakeBlobService struct {
+	mu      sync.Mutex
+	exists  bool
+	leaseID string
+	queries []string
+}
+
+func (f *fakeBlobService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.queries = append(f.queries, r.URL.RawQuery)
+
+	if r.URL.Query().Get("comp") != "lease" {
+		if f.exists {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.exists = true
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	if !f.exists {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch r.Header.Get("x-ms-lease-action") {
+	case "acquire":
+		id := r.Header.Get("x-ms-proposed-lease-id")
+		if f.leaseID != "" && f.leaseID != id {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.leaseID = id
+		w.WriteHeader(http.StatusCreated)
+	case "release":
+		if f.leaseID != r.Header.Get("x-ms-lease-id") {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.leaseID = ""
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func TestBlob(t *testing.T) {
+	service := &fakeBlobService{}
+	server := httptest.NewServer(service)
+	defer server.Close()
+
+	url := server.URL + "/locks/scheduler?sv=2021-08-06&sig=abc"
+	a := NewBlob(BlobConfig{URL: url, Owner: "0190d6b4-7f00-7000-8000-00000000000a"}, 30*time.Second)
+	b := NewBlob(BlobConfig{URL: url, Owner: "0190d6b4-7f00-7000-8000-00000000000b"}, 30*time.Second)
+	ctx := context.Background()
+
+	if held, err := a.Acquire(ctx); err != nil || !held {
+		t.Fatalf("expected a to create the blob and acquire the lease, got %v, %v", held, err)
+	}
+	if held, err := a.Acquire(ctx); err != nil || !held {
+		t.Fatalf("expected a to renew its lease, got %v, %v", held, err)
+	}
+	if held, _ := b.Acquire(ctx); held {
+		t.Fatal("expected b to be refused while a holds the lease")
+	}
+	if err := b.Release(ctx); err != nil {
+		t.Fatalf("expected release of a lease not held to succeed, got %v", err)
+	}
+
+	if err := a.Release(ctx); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if held, _ := b.Acquire(ctx); !held {
+		t.Fatal("expected b to acquire the released lease")
+	}
+	if service.queries[0] != "comp=lease&sig=abc&sv=2021-08-06" {
+		t.Errorf("expected SAS token kept on lease requests, got %q", service.queries[0])
+	}
+}
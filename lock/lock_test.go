@@ -0,0 +1,43 @@
+package lock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+)
+
+func TestMemory(t *testing.T) {
+	clock := gokyu.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	locks := NewMemory(clock)
+	a := locks.Lock("job", "a", time.Minute)
+	b := locks.Lock("job", "b", time.Minute)
+	ctx := context.Background()
+
+	if held, _ := a.Acquire(ctx); !held {
+		t.Fatal("expected a to acquire the free lock")
+	}
+	if held, _ := b.Acquire(ctx); held {
+		t.Fatal("expected b to be refused while a holds the lock")
+	}
+
+	// Renewal keeps the lease alive past the original TTL
+	clock.Advance(45 * time.Second)
+	a.Acquire(ctx)
+	clock.Advance(45 * time.Second)
+	if held, _ := b.Acquire(ctx); held {
+		t.Fatal("expected renewed lease to be kept")
+	}
+
+	// Expiry lets another owner take over
+	clock.Advance(time.Minute)
+	if held, _ := b.Acquire(ctx); !held {
+		t.Fatal("expected b to take over the expired lock")
+	}
+
+	b.Release(ctx)
+	if held, _ := a.Acquire(ctx); !held {
+		t.Fatal("expected a to acquire the released lock")
+	}
+}
@@ -0,0 +1,203 @@
+package lock
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+)
+
+// RedisConfig holds the connection settings of a Redis lock.
+type RedisConfig struct {
+	// Addr is the host:port of the Redis server.
+	Addr string
+
+	// Username and Password authenticate the connection if set.
+	Username string
+	Password string
+
+	// DB is the database number.
+	DB int
+
+	// TLS enables TLS with the given configuration.
+	TLS *tls.Config
+
+	// DialTimeout bounds connecting to the server (default: 5s).
+	DialTimeout time.Duration
+
+	// Owner identifies this instance (default: a random UUID).
+	Owner string
+}
+
+// acquireScript takes the lock if free, or renews it if held by the owner.
+const acquireScript = `
+local v = redis.call('GET', KEYS[1])
+if v == false then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+	return 1
+end
+if v == ARGV[1] then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return 1
+end
+return 0`
+
+// releaseScript deletes the lock if held by the owner.
+const releaseScript = `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0`
+
+// NewRedis returns the lock called name, stored under the key
+// "gokyu:lock:<name>" with a lease of ttl. Each call opens a short-lived
+// connection, which suits the low rate of lock renewals.
+func NewRedis(cfg RedisConfig, name string, ttl time.Duration) gokyu.Lock {
+	if cfg.DialTimeout <= 0 {
+		cfg.DialTimeout = 5 * time.Second
+	}
+	if cfg.Owner == "" {
+		cfg.Owner = newOwner()
+	}
+	return &redisLock{cfg: cfg, key: "gokyu:lock:" + name, ttl: ttl}
+}
+
+type redisLock struct {
+	cfg RedisConfig
+	key string
+	ttl time.Duration
+}
+
+func (l *redisLock) Acquire(ctx context.Context) (bool, error) {
+	reply, err := l.eval(ctx, acquireScript)
+	if err != nil {
+		return false, err
+	}
+	return reply == 1, nil
+}
+
+func (l *redisLock) Release(ctx context.Context) error {
+	_, err := l.eval(ctx, releaseScript)
+	return err
+}
+
+// eval runs a lock script with the key, owner and TTL in milliseconds.
+func (l *redisLock) eval(ctx context.Context, script string) (int64, error) {
+	conn, err := l.dial(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("lock: redis: %w", err)
+	}
+	defer conn.Close()
+
+	reply, err := conn.do("EVAL", script, "1", l.key, l.cfg.Owner, strconv.FormatInt(l.ttl.Milliseconds(), 10))
+	if err != nil {
+		return 0, fmt.Errorf("lock: redis: %w", err)
+	}
+	n, ok := reply.(int64)
+	if !ok {
+		return 0, fmt.Errorf("lock: redis: unexpected reply %v", reply)
+	}
+	return n, nil
+}
+
+// dial connects, authenticates and selects the database.
+func (l *redisLock) dial(ctx context.Context) (*redisConn, error) {
+	dialer := &net.Dialer{Timeout: l.cfg.DialTimeout}
+	var conn net.Conn
+	var err error
+	if l.cfg.TLS != nil {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: l.cfg.TLS}).DialContext(ctx, "tcp", l.cfg.Addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", l.cfg.Addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	c := &redisConn{conn: conn, r: bufio.NewReader(conn)}
+	if l.cfg.Password != "" {
+		args := []string{"AUTH", l.cfg.Password}
+		if l.cfg.Username != "" {
+			args = []string{"AUTH", l.cfg.Username, l.cfg.Password}
+		}
+		if _, err := c.do(args...); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if l.cfg.DB != 0 {
+		if _, err := c.do("SELECT", strconv.Itoa(l.cfg.DB)); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// redisConn speaks the subset of RESP needed by the lock scripts.
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func (c *redisConn) Close() error {
+	return c.conn.Close()
+}
+
+// do sends a command and reads its reply.
+func (c *redisConn) do(args ...string) (interface{}, error) {
+	buf := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		buf = append(buf, "$"+strconv.Itoa(len(arg))+"\r\n"...)
+		buf = append(buf, arg...)
+		buf = append(buf, "\r\n"...)
+	}
+	if _, err := c.conn.Write(buf); err != nil {
+		return nil, err
+	}
+	return c.reply()
+}
+
+// reply reads a RESP reply. Arrays are not needed by the lock scripts and
+// are rejected.
+func (c *redisConn) reply() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 {
+		return nil, errors.New("malformed reply")
+	}
+	line = line[:len(line)-2]
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, errors.New(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	default:
+		return nil, fmt.Errorf("unsupported reply type %q", line[0])
+	}
+}
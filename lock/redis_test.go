@@ -0,0 +1,128 @@
+package lock
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis serves the lock scripts over RESP, emulating them natively.
+type fakeRedis struct {
+	mu     sync.Mutex
+	values map[string]string
+	auth   []string
+}
+
+func startFakeRedis(t *testing.T) (*fakeRedis, string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	f := &fakeRedis{values: make(map[string]string)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f, ln.Addr().String()
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+		args := make([]string, n)
+		for i := range args {
+			line, _ = r.ReadString('\n')
+			size, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+			data := make([]byte, size+2)
+			io.ReadFull(r, data)
+			args[i] = string(data[:size])
+		}
+		fmt.Fprint(conn, f.handle(args))
+	}
+}
+
+func (f *fakeRedis) handle(args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch args[0] {
+	case "AUTH":
+		f.auth = args[1:]
+		return "+OK\r\n"
+	case "EVAL":
+		key, owner := args[3], args[4]
+		current, ok := f.values[key]
+		switch args[1] {
+		case acquireScript:
+			if ok && current != owner {
+				return ":0\r\n"
+			}
+			f.values[key] = owner
+			return ":1\r\n"
+		case releaseScript:
+			if ok && current == owner {
+				delete(f.values, key)
+				return ":1\r\n"
+			}
+			return ":0\r\n"
+		}
+	}
+	return "-ERR unknown command\r\n"
+}
+
+func TestRedis(t *testing.T) {
+	server, addr := startFakeRedis(t)
+	a := NewRedis(RedisConfig{Addr: addr, Password: "secret", Owner: "a"}, "job", time.Minute)
+	b := NewRedis(RedisConfig{Addr: addr, Owner: "b"}, "job", time.Minute)
+	ctx := context.Background()
+
+	if held, err := a.Acquire(ctx); err != nil || !held {
+		t.Fatalf("expected a to acquire the lock, got %v, %v", held, err)
+	}
+	if held, _ := b.Acquire(ctx); held {
+		t.Fatal("expected b to be refused while a holds the lock")
+	}
+	if server.values["gokyu:lock:job"] != "a" {
+		t.Errorf("expected lock key owned by a, got %v", server.values)
+	}
+	if len(server.auth) != 1 || server.auth[0] != "secret" {
+		t.Errorf("expected AUTH with the password, got %v", server.auth)
+	}
+
+	if err := a.Release(ctx); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if held, _ := b.Acquire(ctx); !held {
+		t.Fatal("expected b to acquire the released lock")
+	}
+}
+
+func TestRedis_Error(t *testing.T) {
+	_, addr := startFakeRedis(t)
+	l := NewRedis(RedisConfig{Addr: addr, DB: 2}, "job", time.Minute)
+
+	if _, err := l.Acquire(context.Background()); err == nil || !strings.Contains(err.Error(), "unknown command") {
+		t.Errorf("expected server error, got %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package lock
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+)
+
+// SQLSchema creates the table used by SQL locks. Adjust the column types to
+// the database if needed.
+const SQLSchema = `CREATE TABLE IF NOT EXISTS gokyu_locks (
+	name       VARCHAR(255) PRIMARY KEY,
+	owner      VARCHAR(64)  NOT NULL,
+	expires_at BIGINT       NOT NULL
+)`
+
+// SQLConfig holds the settings of a SQL lock.
+type SQLConfig struct {
+	// Table is the lock table, created with SQLSchema (default: gokyu_locks).
+	Table string
+
+	// DollarPlaceholders uses $1, $2, ... placeholders (PostgreSQL) instead
+	// of ? (MySQL, SQLite, SQL Server with most drivers).
+	DollarPlaceholders bool
+
+	// Owner identifies this instance (default: a random UUID).
+	Owner string
+
+	// Clock is the time source for lease expiry (default: gokyu.SystemClock).
+	// Instances must have reasonably synchronized clocks.
+	Clock gokyu.Clock
+}
+
+// NewSQL returns the lock called name, stored as a row of the lock table
+// with a lease of ttl.
+func NewSQL(db *sql.DB, cfg SQLConfig, name string, ttl time.Duration) gokyu.Lock {
+	if cfg.Table == "" {
+		cfg.Table = "gokyu_locks"
+	}
+	if cfg.Owner == "" {
+		cfg.Owner = newOwner()
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = gokyu.SystemClock
+	}
+	return &sqlLock{db: db, cfg: cfg, name: name, ttl: ttl}
+}
+
+type sqlLock struct {
+	db   *sql.DB
+	cfg  SQLConfig
+	name string
+	ttl  time.Duration
+}
+
+func (l *sqlLock) Acquire(ctx context.Context) (bool, error) {
+	now := l.cfg.Clock.Now()
+	expires := now.Add(l.ttl).UnixMilli()
+
+	// Renew our lease or take over an expired one
+	res, err := l.db.ExecContext(ctx, l.query("UPDATE %s SET owner = ?, expires_at = ? WHERE name = ? AND (owner = ? OR expires_at < ?)"),
+		l.cfg.Owner, expires, l.name, l.cfg.Owner, now.UnixMilli())
+	if err != nil {
+		return false, fmt.Errorf("lock: sql: %w", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return false, fmt.Errorf("lock: sql: %w", err)
+	} else if n > 0 {
+		return true, nil
+	}
+
+	// Take a lock that does not exist yet. A failing insert means another
+	// instance holds the lock, unless the row is still missing.
+	_, err = l.db.ExecContext(ctx, l.query("INSERT INTO %s (name, owner, expires_at) VALUES (?, ?, ?)"), l.name, l.cfg.Owner, expires)
+	if err == nil {
+		return true, nil
+	}
+	var count int
+	if qerr := l.db.QueryRowContext(ctx, l.query("SELECT COUNT(*) FROM %s WHERE name = ?"), l.name).Scan(&count); qerr != nil || count == 0 {
+		return false, fmt.Errorf("lock: sql: %w", err)
+	}
+	return false, nil
+}
+
+func (l *sqlLock) Release(ctx context.Context) error {
+	_, err := l.db.ExecContext(ctx, l.query("DELETE FROM %s WHERE name = ? AND owner = ?"), l.name, l.cfg.Owner)
+	if err != nil {
+		return fmt.Errorf("lock: sql: %w", err)
+	}
+	return nil
+}
+
+// query inserts the table name and rewrites placeholders for the database.
+func (l *sqlLock) query(format string) string {
+	q := fmt.Sprintf(format, l.cfg.Table)
+	if !l.cfg.DollarPlaceholders {
+		return q
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range q {
+		if r == '?' {
+			n++
+			fmt.Fprintf(&b, "$%d", n)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
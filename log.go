@@ -0,0 +1,132 @@
+package gokyu
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Properties read into log fields.
+const (
+	// PropertyCorrelationID correlates messages that belong to one request
+	// or workflow. The JMSCorrelationID property of Amazon MQ messages is
+	// used if it is not set.
+	PropertyCorrelationID = "gokyu-correlation-id"
+
+	// PropertyDeliveryCount is the delivery attempt of a received message,
+	// starting at 1, on providers and test doubles that report it.
+	PropertyDeliveryCount = "gokyu-delivery-count"
+)
+
+// Keys of the log fields added by LogFieldsHandler.
+const (
+	LogKeyMessageID     = "message_id"
+	LogKeyCorrelationID = "correlation_id"
+	LogKeyTopic         = "topic"
+	LogKeyDeliveryCount = "delivery_count"
+	LogKeyReceiver      = "receiver"
+)
+
+// Handler processes a received message. Returning an error means the
+// message was not handled.
+type Handler func(ctx context.Context, msg *Message) error
+
+// Logger is a structured logger that can derive a logger with additional
+// fields. SlogLogger adapts a *slog.Logger; other loggers need a small
+// adapter, e.g. for zap:
+//
+//	type zapLogger struct{ *zap.SugaredLogger }
+//
+//	func (l zapLogger) With(args ...interface{}) gokyu.Logger {
+//	    return zapLogger{l.SugaredLogger.With(args...)}
+//	}
+type Logger interface {
+	// With returns a logger that adds args, alternating keys and values,
+	// to every entry.
+	With(args ...interface{}) Logger
+}
+
+// SlogLogger adapts a *slog.Logger to Logger.
+func SlogLogger(l *slog.Logger) Logger {
+	return slogLogger{l}
+}
+
+type slogLogger struct {
+	*slog.Logger
+}
+
+func (l slogLogger) With(args ...interface{}) Logger {
+	return slogLogger{l.Logger.With(args...)}
+}
+
+// loggerKey is the context key of the logger set by ContextWithLogger.
+type loggerKey struct{}
+
+// ContextWithLogger returns a context carrying l.
+func ContextWithLogger(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// LoggerFromContext returns the logger of ctx, or nil if it has none.
+func LoggerFromContext(ctx context.Context) Logger {
+	l, _ := ctx.Value(loggerKey{}).(Logger)
+	return l
+}
+
+// SlogFromContext returns the *slog.Logger of ctx, as set by
+// LogFieldsHandler with a SlogLogger, or slog.Default().
+func SlogFromContext(ctx context.Context) *slog.Logger {
+	if l, ok := LoggerFromContext(ctx).(slogLogger); ok {
+		return l.Logger
+	}
+	return slog.Default()
+}
+
+// MessageLogFields returns the log fields of a message, alternating keys and
+// values: its ID, correlation ID, delivery count and receiver (see
+// Receiver.String) if known, and topic if not empty.
+func MessageLogFields(msg *Message, topic string) []interface{} {
+	fields := make([]interface{}, 0, 10)
+	if msg.ID != "" {
+		fields = append(fields, LogKeyMessageID, msg.ID)
+	}
+	if id := correlationID(msg); id != "" {
+		fields = append(fields, LogKeyCorrelationID, id)
+	}
+	if topic != "" {
+		fields = append(fields, LogKeyTopic, topic)
+	}
+	if count, ok := msg.Properties[PropertyDeliveryCount]; ok {
+		fields = append(fields, LogKeyDeliveryCount, count)
+	}
+	if msg.Receiver != nil {
+		fields = append(fields, LogKeyReceiver, msg.Receiver.String())
+	}
+	return fields
+}
+
+// correlationID returns the correlation ID of a message, if any.
+func correlationID(msg *Message) string {
+	if id, ok := msg.Properties[PropertyCorrelationID].(string); ok {
+		return id
+	}
+	id, _ := msg.Properties["JMSCorrelationID"].(string)
+	return id
+}
+
+// LogFieldsHandler wraps a handler so that every message is handled with a
+// context carrying l with the message's log fields (see MessageLogFields).
+// Handlers log through LoggerFromContext or SlogFromContext and every entry
+// is correlated with the message:
+//
+//	handler = gokyu.LogFieldsHandler(gokyu.SlogLogger(logger), cfg.Topic, handler)
+//
+//	func handle(ctx context.Context, msg *gokyu.Message) error {
+//	    gokyu.SlogFromContext(ctx).Info("charging card") // message_id=... topic=orders
+//	    ...
+//	}
+func LogFieldsHandler(l Logger, topic string, next Handler) Handler {
+	return func(ctx context.Context, msg *Message) error {
+		fields := MessageLogFields(msg, topic)
+		return next(ContextWithLogger(ctx, l.With(fields...)), msg)
+	}
+}
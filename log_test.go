@@ -0,0 +1,59 @@
+package gokyu
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+)
+
+func TestLogFieldsHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{}
+			}
+			return a
+		},
+	}))
+
+	handler := LogFieldsHandler(SlogLogger(logger), "orders", func(ctx context.Context, msg *Message) error {
+		SlogFromContext(ctx).Info("charging card")
+		return nil
+	})
+
+	msg := NewMessage(nil)
+	msg.ID = "m-1"
+	msg.Properties["JMSCorrelationID"] = "req-7"
+	msg.Properties[PropertyDeliveryCount] = int64(2)
+	if err := handler(context.Background(), msg); err != nil {
+		t.Fatalf("handler error = %v", err)
+	}
+
+	want := "level=INFO msg=\"charging card\" message_id=m-1 correlation_id=req-7 topic=orders delivery_count=2\n"
+	if got := buf.String(); got != want {
+		t.Errorf("log = %q, want %q", got, want)
+	}
+}
+
+func TestMessageLogFields(t *testing.T) {
+	msg := NewMessage(nil)
+	msg.Properties[PropertyCorrelationID] = "req-1"
+	msg.Properties["JMSCorrelationID"] = "req-2"
+
+	fields := MessageLogFields(msg, "")
+	if len(fields) != 2 || fields[0] != LogKeyCorrelationID || fields[1] != "req-1" {
+		t.Errorf("MessageLogFields() = %v", fields)
+	}
+
+	msg.Receiver = &Receiver{Provider: ProviderFile, Queue: "jobs", ConsumerID: "worker-1"}
+	fields = MessageLogFields(msg, "")
+	if len(fields) != 4 || fields[2] != LogKeyReceiver || fields[3] != msg.Receiver.String() {
+		t.Errorf("MessageLogFields() = %v", fields)
+	}
+
+	if l := SlogFromContext(context.Background()); l != slog.Default() {
+		t.Error("expected the default logger for contexts without one")
+	}
+}
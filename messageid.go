@@ -0,0 +1,129 @@
+package gokyu
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// uuidv7State keeps generated UUIDv7 values monotonic within a millisecond.
+var (
+	uuidv7Mu      sync.Mutex
+	uuidv7LastMs  int64
+	uuidv7Counter uint16
+)
+
+// NewUUIDv7 returns a new RFC 9562 version 7 UUID in its canonical string form.
+// UUIDv7 values embed a millisecond timestamp and sort by creation time; values
+// generated within the same millisecond by this process are also ordered.
+func NewUUIDv7() string {
+	var b [16]byte
+	rand.Read(b[:])
+
+	uuidv7Mu.Lock()
+	ms := time.Now().UnixMilli()
+	if ms <= uuidv7LastMs {
+		// Same millisecond (or clock moved backwards): keep the previous
+		// timestamp and increment the 12-bit counter.
+		ms = uuidv7LastMs
+		uuidv7Counter++
+		if uuidv7Counter > 0x0fff {
+			ms++
+			uuidv7Counter = 0
+		}
+	} else {
+		uuidv7Counter = 0
+	}
+	uuidv7LastMs = ms
+	counter := uuidv7Counter
+	uuidv7Mu.Unlock()
+
+	b[0] = byte(ms >> 40)
+	b[1] = byte(ms >> 32)
+	b[2] = byte(ms >> 24)
+	b[3] = byte(ms >> 16)
+	b[4] = byte(ms >> 8)
+	b[5] = byte(ms)
+	b[6] = 0x70 | byte(counter>>8)
+	b[7] = byte(counter)
+	b[8] = 0x80 | (b[8] & 0x3f)
+
+	var out [36]byte
+	hex.Encode(out[0:8], b[0:4])
+	out[8] = '-'
+	hex.Encode(out[9:13], b[4:6])
+	out[13] = '-'
+	hex.Encode(out[14:18], b[6:8])
+	out[18] = '-'
+	hex.Encode(out[19:23], b[8:10])
+	out[23] = '-'
+	hex.Encode(out[24:], b[10:])
+	return string(out[:])
+}
+
+// MessageIDStrategy derives the ID of an outgoing message that has none,
+// when Config.AutoMessageID is set. Deterministic strategies give retried
+// publishes of the same message the same ID, so brokers with duplicate
+// detection, such as Azure Service Bus, discard the retries.
+type MessageIDStrategy interface {
+	MessageID(msg *Message) (string, error)
+}
+
+// MessageIDFunc adapts a function to a MessageIDStrategy.
+type MessageIDFunc func(msg *Message) (string, error)
+
+// MessageID calls f.
+func (f MessageIDFunc) MessageID(msg *Message) (string, error) {
+	return f(msg)
+}
+
+// BodyHashMessageID returns a strategy deriving IDs from the SHA-256 hash of
+// the content type and body, so that identical payloads get the same ID.
+// BodyValue bodies are hashed in their JSON encoding. Use it only where
+// identical payloads are genuinely the same message; otherwise hash a
+// business key with PropertyHashMessageID.
+func BodyHashMessageID() MessageIDStrategy {
+	return MessageIDFunc(func(msg *Message) (string, error) {
+		h := sha256.New()
+		fmt.Fprintf(h, "%q\n", msg.ContentType)
+		if msg.BodyValue != nil {
+			data, err := json.Marshal(msg.BodyValue)
+			if err != nil {
+				return "", fmt.Errorf("gokyu: hash BodyValue: %w", err)
+			}
+			h.Write(data)
+		} else {
+			h.Write(msg.Body)
+		}
+		return hex.EncodeToString(h.Sum(nil)), nil
+	})
+}
+
+// PropertyHashMessageID returns a strategy deriving IDs from the SHA-256
+// hash of the values of the properties keys, such as an order ID and event
+// type. A message missing one of the properties is not published.
+func PropertyHashMessageID(keys ...string) MessageIDStrategy {
+	return MessageIDFunc(func(msg *Message) (string, error) {
+		if len(keys) == 0 {
+			return "", errors.New("gokyu: no properties to derive the message ID from")
+		}
+		h := sha256.New()
+		for _, key := range keys {
+			v, ok := msg.Properties[key]
+			if !ok {
+				return "", fmt.Errorf("gokyu: message ID property %q is not set", key)
+			}
+			data, err := json.Marshal(v)
+			if err != nil {
+				return "", fmt.Errorf("gokyu: message ID property %q: %w", key, err)
+			}
+			fmt.Fprintf(h, "%q=%s\n", key, data)
+		}
+		return hex.EncodeToString(h.Sum(nil)), nil
+	})
+}
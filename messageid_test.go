@@ -0,0 +1,96 @@
+package gokyu
+
+import (
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestNewUUIDv7(t *testing.T) {
+	pattern := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+	prev := ""
+	seen := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		id := NewUUIDv7()
+		if !pattern.MatchString(id) {
+			t.Fatalf("invalid UUIDv7 %q", id)
+		}
+		if seen[id] {
+			t.Fatalf("duplicate UUIDv7 %q", id)
+		}
+		if id <= prev {
+			t.Fatalf("expected %q to sort after %q", id, prev)
+		}
+		seen[id] = true
+		prev = id
+	}
+}
+
+func TestBodyHashMessageID(t *testing.T) {
+	strategy := BodyHashMessageID()
+	id := func(contentType string, body []byte, value interface{}) string {
+		t.Helper()
+		msg := NewMessage(body)
+		msg.ContentType = contentType
+		msg.BodyValue = value
+		id, err := strategy.MessageID(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+
+	a := id("application/json", []byte(`{"order":1}`), nil)
+	if len(a) != 64 {
+		t.Errorf("expected hex SHA-256, got %q", a)
+	}
+	if b := id("application/json", []byte(`{"order":1}`), nil); a != b {
+		t.Errorf("identical messages got different IDs %q and %q", a, b)
+	}
+	if b := id("application/json", []byte(`{"order":2}`), nil); a == b {
+		t.Error("different bodies got the same ID")
+	}
+	if b := id("text/plain", []byte(`{"order":1}`), nil); a == b {
+		t.Error("different content types got the same ID")
+	}
+	if x, y := id("", nil, map[string]interface{}{"a": 1, "b": 2}), id("", nil, map[string]interface{}{"b": 2, "a": 1}); x != y {
+		t.Error("equal BodyValues got different IDs")
+	}
+}
+
+func TestPropertyHashMessageID(t *testing.T) {
+	strategy := PropertyHashMessageID("order", "event")
+	msg := func(props map[string]interface{}) *Message {
+		m := NewMessage([]byte("body"))
+		for k, v := range props {
+			m.Properties[k] = v
+		}
+		return m
+	}
+
+	a, err := strategy.MessageID(msg(map[string]interface{}{"order": "o-1", "event": "paid", "attempt": 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := strategy.MessageID(msg(map[string]interface{}{"order": "o-1", "event": "paid", "attempt": 2}))
+	if a != b {
+		t.Errorf("unselected properties changed the ID: %q and %q", a, b)
+	}
+	if c, _ := strategy.MessageID(msg(map[string]interface{}{"order": "o-1", "event": "shipped"})); a == c {
+		t.Error("different property values got the same ID")
+	}
+	if c, _ := strategy.MessageID(msg(map[string]interface{}{"order": "o-1paid", "event": ""})); a == c {
+		t.Error("concatenated property values collided")
+	}
+	if _, err := PropertyHashMessageID("at").MessageID(msg(map[string]interface{}{"at": time.Unix(1000, 0)})); err != nil {
+		t.Errorf("time property: %v", err)
+	}
+
+	if _, err := strategy.MessageID(msg(map[string]interface{}{"order": "o-1"})); err == nil {
+		t.Error("expected error for a missing property")
+	}
+	if _, err := PropertyHashMessageID().MessageID(msg(nil)); err == nil {
+		t.Error("expected error without keys")
+	}
+}
@@ -0,0 +1,139 @@
+package gokyu
+
+import "sync"
+
+// Metric names recorded by gokyu components.
+const (
+	// MetricMessagesFiltered counts received messages skipped by a filter.
+	MetricMessagesFiltered = "gokyu_messages_filtered_total"
+)
+
+// Metrics records counters and histograms emitted by gokyu components.
+// Implement it to forward metrics to Prometheus, OpenTelemetry, or another
+// backend.
+type Metrics interface {
+	// IncCounter adds delta to the named counter.
+	IncCounter(name string, labels map[string]string, delta float64)
+
+	// ObserveHistogram records a value in the named histogram.
+	ObserveHistogram(name string, labels map[string]string, value float64)
+}
+
+// NopMetrics discards all metrics.
+type NopMetrics struct{}
+
+// IncCounter does nothing.
+func (NopMetrics) IncCounter(name string, labels map[string]string, delta float64) {}
+
+// ObserveHistogram does nothing.
+func (NopMetrics) ObserveHistogram(name string, labels map[string]string, value float64) {}
+
+// Entity label names set by EntityLabels.
+const (
+	LabelProvider     = "provider"
+	LabelQueue        = "queue"
+	LabelTopic        = "topic"
+	LabelSubscription = "subscription"
+)
+
+// DefaultMaxLabelValues is the number of distinct values per label kept by
+// a cardinality-limited Metrics before further values are folded into
+// LabelValueOverflow.
+const DefaultMaxLabelValues = 100
+
+// LabelValueOverflow replaces label values beyond the cardinality limit.
+const LabelValueOverflow = "other"
+
+// EntityLabels returns the provider, queue, topic and subscription labels for
+// cfg. All four labels are always present, empty if unset, so every series
+// of a metric has the same label names.
+func EntityLabels(cfg *Config) map[string]string {
+	return map[string]string{
+		LabelProvider:     string(cfg.Provider),
+		LabelQueue:        cfg.Queue,
+		LabelTopic:        cfg.Topic,
+		LabelSubscription: cfg.Subscription,
+	}
+}
+
+// NewLabeledMetrics wraps m so that every metric carries the given labels in
+// addition to its own. Labels passed by the caller take precedence.
+func NewLabeledMetrics(m Metrics, labels map[string]string) Metrics {
+	return &labeledMetrics{Metrics: m, labels: labels}
+}
+
+// labeledMetrics adds a fixed set of labels to every metric.
+type labeledMetrics struct {
+	Metrics
+	labels map[string]string
+}
+
+func (m *labeledMetrics) merge(labels map[string]string) map[string]string {
+	merged := make(map[string]string, len(m.labels)+len(labels))
+	for k, v := range m.labels {
+		merged[k] = v
+	}
+	for k, v := range labels {
+		merged[k] = v
+	}
+	return merged
+}
+
+func (m *labeledMetrics) IncCounter(name string, labels map[string]string, delta float64) {
+	m.Metrics.IncCounter(name, m.merge(labels), delta)
+}
+
+func (m *labeledMetrics) ObserveHistogram(name string, labels map[string]string, value float64) {
+	m.Metrics.ObserveHistogram(name, m.merge(labels), value)
+}
+
+// NewCardinalityLimitedMetrics wraps m so that each label takes at most
+// maxValues distinct values (DefaultMaxLabelValues if maxValues <= 0). Values
+// seen after the limit is reached are reported as LabelValueOverflow, which
+// keeps e.g. per-destination labels from exploding the number of series.
+func NewCardinalityLimitedMetrics(m Metrics, maxValues int) Metrics {
+	if maxValues <= 0 {
+		maxValues = DefaultMaxLabelValues
+	}
+	return &limitedMetrics{Metrics: m, max: maxValues, seen: make(map[string]map[string]struct{})}
+}
+
+// limitedMetrics caps the number of distinct values per label.
+type limitedMetrics struct {
+	Metrics
+	max int
+
+	mu   sync.Mutex
+	seen map[string]map[string]struct{}
+}
+
+func (m *limitedMetrics) limit(labels map[string]string) map[string]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	limited := make(map[string]string, len(labels))
+	for k, v := range labels {
+		values, ok := m.seen[k]
+		if !ok {
+			values = make(map[string]struct{})
+			m.seen[k] = values
+		}
+		if _, ok := values[v]; !ok {
+			if len(values) >= m.max {
+				v = LabelValueOverflow
+			} else {
+				values[v] = struct{}{}
+			}
+		}
+		limited[k] = v
+	}
+	return limited
+}
+
+func (m *limitedMetrics) IncCounter(name string, labels map[string]string, delta float64) {
+	m.Metrics.IncCounter(name, m.limit(labels), delta)
+}
+
+func (m *limitedMetrics) ObserveHistogram(name string, labels map[string]string, value float64) {
+	m.Metrics.ObserveHistogram(name, m.limit(labels), value)
+}
@@ -0,0 +1,53 @@
+package gokyu
+
+import "testing"
+
+func TestClientMetrics_EntityLabels(t *testing.T) {
+	RegisterProvider("mock-metrics", &mockFactory{})
+	metrics := newCountingMetrics()
+
+	client, err := NewClient(&Config{
+		Provider:         "mock-metrics",
+		ConnectionString: "amqp://localhost",
+		Topic:            "orders",
+		Subscription:     "billing",
+		Metrics:          metrics,
+	})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	client.Metrics().IncCounter("requests_total", map[string]string{"action": "ack"}, 1)
+
+	want := map[string]string{
+		LabelProvider:     "mock-metrics",
+		LabelQueue:        "",
+		LabelTopic:        "orders",
+		LabelSubscription: "billing",
+		"action":          "ack",
+	}
+	got := metrics.labels["requests_total"]
+	if len(got) != len(want) {
+		t.Fatalf("expected labels %v, got %v", want, got)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("label %s: expected %q, got %q", k, v, got[k])
+		}
+	}
+}
+
+func TestCardinalityLimitedMetrics(t *testing.T) {
+	metrics := newCountingMetrics()
+	limited := NewCardinalityLimitedMetrics(metrics, 2)
+
+	for _, topic := range []string{"a", "b", "c", "a"} {
+		limited.IncCounter("published_total", map[string]string{LabelTopic: topic}, 1)
+		if topic == "c" && metrics.labels["published_total"][LabelTopic] != LabelValueOverflow {
+			t.Errorf("expected third value to be folded into %q, got %q", LabelValueOverflow, metrics.labels["published_total"][LabelTopic])
+		}
+	}
+	if got := metrics.labels["published_total"][LabelTopic]; got != "a" {
+		t.Errorf("expected known value to be kept, got %q", got)
+	}
+}
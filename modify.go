@@ -0,0 +1,65 @@
+package gokyu
+
+import "context"
+
+// Properties set by NackWithFailure.
+const (
+	// PropertyFailureCount is the number of times handlers failed on the
+	// message.
+	PropertyFailureCount = "gokyu-failure-count"
+
+	// PropertyLastError is the error of the last failed attempt.
+	PropertyLastError = "gokyu-last-error"
+)
+
+// Modification describes how a message returned for redelivery is changed,
+// as in the AMQP modified outcome.
+type Modification struct {
+	// Properties are merged into the message, overwriting existing keys.
+	Properties map[string]interface{}
+
+	// DeliveryFailed counts the delivery as a failed attempt, incrementing
+	// the broker's delivery count.
+	DeliveryFailed bool
+
+	// UndeliverableHere asks the broker not to redeliver the message to
+	// the same subscriber.
+	UndeliverableHere bool
+}
+
+// Modifier is implemented by subscribers that can return a message for
+// redelivery with modified properties, so that the next consumer sees the
+// context of earlier failures. Decorators such as NewFilteringSubscriber do
+// not forward it, so check for it before wrapping.
+type Modifier interface {
+	// Modify returns msg to the broker for redelivery, changed by mod.
+	Modify(ctx context.Context, msg *Message, mod Modification) error
+}
+
+// NackWithFailure returns msg for redelivery as a failed delivery carrying
+// PropertyFailureCount, incremented, and PropertyLastError set to err. If
+// sub does not implement Modifier, msg is nacked without them.
+func NackWithFailure(ctx context.Context, sub Subscriber, msg *Message, err error) error {
+	m, ok := sub.(Modifier)
+	if !ok {
+		return sub.Nack(ctx, msg)
+	}
+
+	var count int64
+	switch v := msg.Properties[PropertyFailureCount].(type) {
+	case int64:
+		count = v
+	case int32:
+		count = int64(v)
+	case float64: // decoded from JSON by file-based providers
+		count = int64(v)
+	}
+	mod := Modification{
+		Properties:     map[string]interface{}{PropertyFailureCount: count + 1},
+		DeliveryFailed: true,
+	}
+	if err != nil {
+		mod.Properties[PropertyLastError] = err.Error()
+	}
+	return m.Modify(ctx, msg, mod)
+}
@@ -0,0 +1,42 @@
+package gokyu
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// modifyingSubscriber records modifications.
+type modifyingSubscriber struct {
+	stubSubscriber
+	modified []Modification
+}
+
+func (s *modifyingSubscriber) Modify(ctx context.Context, msg *Message, mod Modification) error {
+	s.modified = append(s.modified, mod)
+	return nil
+}
+
+func TestNackWithFailure(t *testing.T) {
+	ctx := context.Background()
+	msg := NewMessage(nil)
+	msg.Properties[PropertyFailureCount] = int64(2)
+
+	sub := &modifyingSubscriber{}
+	if err := NackWithFailure(ctx, sub, msg, errors.New("timeout")); err != nil {
+		t.Fatalf("NackWithFailure() error = %v", err)
+	}
+	if len(sub.modified) != 1 || len(sub.nacked) != 0 {
+		t.Fatalf("expected one modification, got %v and %d nacks", sub.modified, len(sub.nacked))
+	}
+	mod := sub.modified[0]
+	if !mod.DeliveryFailed || mod.Properties[PropertyFailureCount] != int64(3) || mod.Properties[PropertyLastError] != "timeout" {
+		t.Errorf("modification = %+v", mod)
+	}
+
+	// Subscribers without Modify nack the message
+	stub := &stubSubscriber{}
+	if err := NackWithFailure(ctx, stub, msg, errors.New("timeout")); err != nil || len(stub.nacked) != 1 {
+		t.Errorf("NackWithFailure() error = %v, nacked = %d", err, len(stub.nacked))
+	}
+}
@@ -0,0 +1,166 @@
+package gokyu
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// Stage is a step of the receive pipeline. Stages run in the order of their
+// values, whatever the order in which hooks are registered.
+type Stage int
+
+// Receive pipeline stages, in the order they run.
+const (
+	// StageDecrypt restores the plaintext body of encrypted messages.
+	StageDecrypt Stage = iota + 1
+
+	// StageDecompress inflates compressed bodies.
+	StageDecompress
+
+	// StageDecode converts the body to the current schema and content type,
+	// e.g. with Upcasters.
+	StageDecode
+
+	// StageValidate checks the decoded message before it reaches the handler.
+	StageValidate
+)
+
+// String returns the lowercase name of the stage.
+func (s Stage) String() string {
+	switch s {
+	case StageDecrypt:
+		return "decrypt"
+	case StageDecompress:
+		return "decompress"
+	case StageDecode:
+		return "decode"
+	case StageValidate:
+		return "validate"
+	default:
+		return fmt.Sprintf("stage(%d)", int(s))
+	}
+}
+
+// ReceiveHook transforms or checks a received message in place. Returning an
+// error stops the pipeline.
+type ReceiveHook func(ctx context.Context, msg *Message) error
+
+// StageError reports the receive hook that failed.
+type StageError struct {
+	Stage Stage
+	Name  string
+	Err   error
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("gokyu: %s hook %q: %v", e.Stage, e.Name, e.Err)
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// Pipeline runs receive hooks stage by stage, so that features transforming
+// received messages compose in a fixed order (decrypt, decompress, decode,
+// validate) rather than the order in which they were set up:
+//
+//	pipeline := gokyu.NewPipeline()
+//	pipeline.Register(gokyu.StageValidate, "schema", validateOrder)
+//	pipeline.Register(gokyu.StageDecode, "upcast", func(ctx context.Context, msg *gokyu.Message) error {
+//	    return upcasters.Upcast(msg)
+//	})
+//	cfg.ReceivePipeline = pipeline // upcast runs first
+//
+// Hooks of the same stage run in registration order.
+type Pipeline struct {
+	mu    sync.RWMutex
+	hooks []stageHook
+}
+
+// stageHook is a registered receive hook.
+type stageHook struct {
+	stage Stage
+	name  string
+	hook  ReceiveHook
+}
+
+// NewPipeline creates an empty receive pipeline.
+func NewPipeline() *Pipeline {
+	return &Pipeline{}
+}
+
+// Register adds a hook to a stage. Names identify hooks in errors and must
+// be unique within the pipeline.
+func (p *Pipeline) Register(stage Stage, name string, hook ReceiveHook) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, h := range p.hooks {
+		if h.name == name {
+			return fmt.Errorf("gokyu: receive hook %q already registered", name)
+		}
+	}
+	// Copy, so running Process calls keep the hooks they started with
+	hooks := append(append([]stageHook(nil), p.hooks...), stageHook{stage: stage, name: name, hook: hook})
+	// Stable, so hooks of a stage keep their registration order
+	sort.SliceStable(hooks, func(i, j int) bool { return hooks[i].stage < hooks[j].stage })
+	p.hooks = hooks
+	return nil
+}
+
+// Hooks returns the names of the registered hooks in the order they run,
+// each prefixed with its stage, e.g. "decode/upcast".
+func (p *Pipeline) Hooks() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	names := make([]string, len(p.hooks))
+	for i, h := range p.hooks {
+		names[i] = h.stage.String() + "/" + h.name
+	}
+	return names
+}
+
+// Process runs the hooks on msg. It returns a *StageError from the first
+// hook that fails.
+func (p *Pipeline) Process(ctx context.Context, msg *Message) error {
+	p.mu.RLock()
+	hooks := p.hooks
+	p.mu.RUnlock()
+
+	for _, h := range hooks {
+		if err := h.hook(ctx, msg); err != nil {
+			return &StageError{Stage: h.stage, Name: h.name, Err: err}
+		}
+	}
+	return nil
+}
+
+// NewPipelineSubscriber wraps a subscriber so that every received message
+// passes through the pipeline before being returned. If a hook fails, the
+// received message is returned together with the error so the caller can
+// still settle it.
+func NewPipelineSubscriber(sub Subscriber, pipeline *Pipeline) Subscriber {
+	return &pipelineSubscriber{Subscriber: sub, pipeline: pipeline}
+}
+
+// pipelineSubscriber applies a receive pipeline on Receive.
+type pipelineSubscriber struct {
+	Subscriber
+	pipeline *Pipeline
+}
+
+func (s *pipelineSubscriber) Receive(ctx context.Context) (*Message, error) {
+	msg, err := s.Subscriber.Receive(ctx)
+	if err != nil {
+		return msg, err
+	}
+	if err := s.pipeline.Process(ctx, msg); err != nil {
+		return msg, err
+	}
+	return msg, nil
+}
+
+func (s *pipelineSubscriber) BrokerProperties() map[string]interface{} {
+	return brokerProperties(s.Subscriber)
+}
@@ -0,0 +1,63 @@
+package gokyu
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPipeline_StageOrder(t *testing.T) {
+	p := NewPipeline()
+	appendHook := func(s string) ReceiveHook {
+		return func(ctx context.Context, msg *Message) error {
+			msg.Body = append(msg.Body, s...)
+			return nil
+		}
+	}
+
+	// Registered in the wrong order on purpose
+	p.Register(StageValidate, "schema", appendHook("+validate"))
+	p.Register(StageDecode, "upcast", appendHook("+upcast"))
+	p.Register(StageDecompress, "gzip", appendHook("+gunzip"))
+	p.Register(StageDecrypt, "kms", appendHook("+decrypt"))
+	p.Register(StageDecode, "rename", appendHook("+rename"))
+	if err := p.Register(StageDecode, "upcast", appendHook("")); err == nil {
+		t.Error("expected an error registering a duplicate hook name")
+	}
+
+	want := []string{"decrypt/kms", "decompress/gzip", "decode/upcast", "decode/rename", "validate/schema"}
+	if got := p.Hooks(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Hooks() = %v, want %v", got, want)
+	}
+
+	msg := NewMessage([]byte("m"))
+	if err := p.Process(context.Background(), msg); err != nil {
+		t.Fatalf("Process() error = %v", err)
+	}
+	if got := string(msg.Body); got != "m+decrypt+gunzip+upcast+rename+validate" {
+		t.Errorf("hooks ran as %q", got)
+	}
+}
+
+func TestPipelineSubscriber_Error(t *testing.T) {
+	invalid := errors.New("missing order id")
+	p := NewPipeline()
+	p.Register(StageValidate, "schema", func(ctx context.Context, msg *Message) error { return invalid })
+
+	received := NewMessage([]byte("{}"))
+	sub := NewPipelineSubscriber(&stubSubscriber{msgs: []*Message{received}}, p)
+	msg, err := sub.Receive(context.Background())
+	if msg != received {
+		t.Fatal("expected the message to be returned for settlement")
+	}
+
+	var stageErr *StageError
+	if !errors.As(err, &stageErr) || stageErr.Stage != StageValidate || stageErr.Name != "schema" {
+		t.Fatalf("Receive() error = %v, want a validate StageError", err)
+	}
+	if !errors.Is(err, invalid) || !strings.Contains(err.Error(), `validate hook "schema"`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
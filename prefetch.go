@@ -0,0 +1,128 @@
+package gokyu
+
+import (
+	"sync"
+	"time"
+)
+
+// DefaultPrefetchLatencyTarget is the handler latency above which adaptive
+// prefetch shrinks the prefetch window.
+const DefaultPrefetchLatencyTarget = time.Second
+
+// PrefetchController adjusts the link credit of a receiver with an
+// additive-increase/multiplicative-decrease (AIMD) policy. The window grows
+// by about one message per window's worth of settlements while handlers
+// settle messages within the latency target and are kept busy, and is halved
+// whenever a message takes longer than the target.
+//
+// Providers call Start once the receiver is attached with manual credit, then
+// OnReceive and OnSettle for every message.
+type PrefetchController struct {
+	mu       sync.Mutex
+	min, max int
+	target   time.Duration
+	issue    func(credit uint32) error
+	clock    Clock
+
+	window   float64
+	credit   int // credit issued but not yet used by a delivery
+	inFlight map[interface{}]time.Time
+}
+
+// NewPrefetchController creates a controller that keeps the window between
+// min and max and issues credit through issue.
+func NewPrefetchController(min, max int, target time.Duration, issue func(credit uint32) error) *PrefetchController {
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	if target <= 0 {
+		target = DefaultPrefetchLatencyTarget
+	}
+	return &PrefetchController{
+		min:      min,
+		max:      max,
+		target:   target,
+		issue:    issue,
+		clock:    SystemClock,
+		window:   float64(min),
+		inFlight: make(map[interface{}]time.Time),
+	}
+}
+
+// SetClock replaces the time source used to measure handler latency.
+func (c *PrefetchController) SetClock(clock Clock) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.clock = clock
+}
+
+// Start issues the initial credit.
+func (c *PrefetchController) Start() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.topUp()
+}
+
+// Window returns the current prefetch window.
+func (c *PrefetchController) Window() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return int(c.window)
+}
+
+// OnReceive records that a message identified by key was delivered.
+func (c *PrefetchController) OnReceive(key interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.credit > 0 {
+		c.credit--
+	}
+	c.inFlight[key] = c.clock.Now()
+}
+
+// OnSettle records that the message identified by key was settled, adjusts
+// the window based on how long it was held, and issues more credit.
+func (c *PrefetchController) OnSettle(key interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	received, ok := c.inFlight[key]
+	if !ok {
+		return nil
+	}
+	saturated := len(c.inFlight) >= int(c.window)
+	delete(c.inFlight, key)
+
+	if c.clock.Now().Sub(received) > c.target {
+		c.window /= 2
+	} else if saturated {
+		// Only grow when the window is actually limiting throughput
+		c.window += 1 / c.window
+	}
+	if c.window < float64(c.min) {
+		c.window = float64(c.min)
+	}
+	if c.window > float64(c.max) {
+		c.window = float64(c.max)
+	}
+
+	return c.topUp()
+}
+
+// topUp issues credit so that outstanding credit plus in-flight messages
+// matches the window. The caller must hold c.mu.
+func (c *PrefetchController) topUp() error {
+	want := int(c.window) - c.credit - len(c.inFlight)
+	if want <= 0 {
+		return nil
+	}
+	if err := c.issue(uint32(want)); err != nil {
+		return err
+	}
+	c.credit += want
+	return nil
+}
@@ -0,0 +1,49 @@
+package gokyu
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPrefetchController(t *testing.T) {
+	issued := 0
+	c := NewPrefetchController(1, 8, 50*time.Millisecond, func(credit uint32) error {
+		issued += int(credit)
+		return nil
+	})
+
+	if err := c.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if issued != 1 {
+		t.Fatalf("expected 1 initial credit, got %d", issued)
+	}
+
+	// Fast handlers that keep the window full grow it
+	for i := 0; i < 40; i++ {
+		for j := 0; j < c.Window(); j++ {
+			c.OnReceive([2]int{i, j})
+		}
+		for j := c.Window() - 1; j >= 0; j-- {
+			c.OnSettle([2]int{i, j})
+		}
+	}
+	if got := c.Window(); got != 8 {
+		t.Errorf("expected window to grow to max 8, got %d", got)
+	}
+
+	// A slow handler halves it
+	clock := NewFakeClock(time.Now())
+	c.SetClock(clock)
+	c.OnReceive("slow")
+	clock.Advance(60 * time.Millisecond)
+	c.OnSettle("slow")
+	if got := c.Window(); got != 4 {
+		t.Errorf("expected window to halve to 4, got %d", got)
+	}
+
+	// Outstanding credit never exceeds what the window allows
+	if c.credit+len(c.inFlight) > 8 {
+		t.Errorf("expected outstanding credit within the window, got %d", c.credit+len(c.inFlight))
+	}
+}
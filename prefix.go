@@ -0,0 +1,50 @@
+package gokyu
+
+import "context"
+
+// prefixedNames are the entity names produced by Config.WithEntityPrefix.
+type prefixedNames struct {
+	queue, topic, deadLetterQueue string
+}
+
+// WithEntityPrefix returns the configuration with EntityPrefix prepended to
+// Queue, Topic and DeadLetterQueue. Subscriptions belong to a topic and are
+// not prefixed. The configuration records the names it prefixed, so that
+// the configuration of a client can be passed to NewClient again, with
+// other names set, without prefixing any name twice. NewClient applies it
+// automatically.
+func (c Config) WithEntityPrefix() Config {
+	c.Queue, c.prefixed.queue = prefixOnce(c.EntityPrefix, c.Queue, c.prefixed.queue)
+	c.Topic, c.prefixed.topic = prefixOnce(c.EntityPrefix, c.Topic, c.prefixed.topic)
+	c.DeadLetterQueue, c.prefixed.deadLetterQueue = prefixOnce(c.EntityPrefix, c.DeadLetterQueue, c.prefixed.deadLetterQueue)
+	return c
+}
+
+// prefixOnce prefixes name unless it is done, the name prefixed before, and
+// returns the result as both.
+func prefixOnce(prefix, name, done string) (string, string) {
+	if name == "" || name == done {
+		return name, done
+	}
+	name = prefixEntity(prefix, name)
+	return name, name
+}
+
+// prefixEntity prepends prefix to a non-empty entity name.
+func prefixEntity(prefix, name string) string {
+	if name == "" {
+		return name
+	}
+	return prefix + name
+}
+
+// prefixingRelayPublisher applies Config.EntityPrefix to the destinations of
+// a relay publisher.
+type prefixingRelayPublisher struct {
+	RelayPublisher
+	prefix string
+}
+
+func (p *prefixingRelayPublisher) PublishTo(ctx context.Context, destination string, msg *Message) error {
+	return p.RelayPublisher.PublishTo(ctx, prefixEntity(p.prefix, destination), msg)
+}
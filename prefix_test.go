@@ -0,0 +1,81 @@
+package gokyu
+
+import (
+	"context"
+	"testing"
+)
+
+func TestConfig_WithEntityPrefix(t *testing.T) {
+	cfg := Config{EntityPrefix: "staging-", Queue: "orders", Topic: "events", Subscription: "billing"}.WithEntityPrefix()
+	if cfg.Queue != "staging-orders" || cfg.Topic != "staging-events" || cfg.Subscription != "billing" {
+		t.Errorf("unexpected names: queue %q, topic %q, subscription %q", cfg.Queue, cfg.Topic, cfg.Subscription)
+	}
+	if cfg.DeadLetterQueue != "" {
+		t.Errorf("expected no dead-letter queue, got %q", cfg.DeadLetterQueue)
+	}
+
+	// Applying it again keeps the prefixed names and prefixes new ones
+	cfg.Queue = "payments"
+	cfg = cfg.WithEntityPrefix()
+	if cfg.Queue != "staging-payments" || cfg.Topic != "staging-events" {
+		t.Errorf("unexpected names after reapplying: queue %q, topic %q", cfg.Queue, cfg.Topic)
+	}
+}
+
+func TestConfig_WithEntityPrefix_NameStartingWithPrefix(t *testing.T) {
+	cfg := Config{EntityPrefix: "dev", Queue: "devices", DeadLetterQueue: "devices-dlq"}.WithEntityPrefix()
+	if cfg.Queue != "devdevices" || cfg.DeadLetterQueue != "devdevices-dlq" {
+		t.Errorf("unexpected names: queue %q, dead-letter queue %q", cfg.Queue, cfg.DeadLetterQueue)
+	}
+	if cfg = cfg.WithEntityPrefix(); cfg.Queue != "devdevices" {
+		t.Errorf("Queue after reapplying = %q, want devdevices", cfg.Queue)
+	}
+}
+
+func TestNewClient_EntityPrefix(t *testing.T) {
+	type orderCreated struct{ ID int }
+
+	factory := &topicFactory{published: make(map[string][]*Message)}
+	RegisterProvider("test-prefix-provider", factory)
+	client, err := NewClient(&Config{Provider: "test-prefix-provider", ConnectionString: "amqps://test", EntityPrefix: "staging-", Topic: "events"})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	if got := client.Config().Topic; got != "staging-events" {
+		t.Errorf("Config().Topic = %q", got)
+	}
+
+	ctx := context.Background()
+	pub, err := client.NewPublisher(ctx)
+	if err != nil {
+		t.Fatalf("NewPublisher() error = %v", err)
+	}
+	pub.Publish(ctx, NewMessage([]byte("a")))
+
+	// Clients derived by Router are prefixed exactly once
+	router := NewRouter(client)
+	router.Route(orderCreated{}, "orders.created")
+	if err := router.Publish(ctx, orderCreated{ID: 1}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	if len(factory.published["staging-events"]) != 1 || len(factory.published["staging-orders.created"]) != 1 {
+		t.Errorf("unexpected destinations: %v", factory.published)
+	}
+}
+
+func TestClient_NewRelayPublisher_EntityPrefix(t *testing.T) {
+	client, factory := newRelayClient(t, "test-relay-prefix-provider", Config{EntityPrefix: "staging-"})
+
+	pub, err := client.NewRelayPublisher(context.Background())
+	if err != nil {
+		t.Fatalf("NewRelayPublisher() error = %v", err)
+	}
+	pub.PublishTo(context.Background(), "orders", NewMessage([]byte("a")))
+	pub.PublishTo(context.Background(), "staging-orders", NewMessage([]byte("b")))
+	pub.Publish(context.Background(), NewMessage([]byte("c")))
+
+	if len(factory.published["staging-orders"]) != 1 || len(factory.published["staging-staging-orders"]) != 1 || len(factory.published["staging-default"]) != 1 {
+		t.Errorf("unexpected destinations: %v", factory.published)
+	}
+}
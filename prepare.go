@@ -0,0 +1,110 @@
+package gokyu
+
+import (
+	"context"
+	"time"
+)
+
+// prepareFunc modifies an outgoing message before it is handed to the provider.
+type prepareFunc func(ctx context.Context, msg *Message) error
+
+// chargeFunc charges an outgoing message against a limit before it is
+// handed to the provider. It returns a refund, possibly nil, for when the
+// message is not published after all.
+type chargeFunc func(ctx context.Context, msg *Message) (refund func(), err error)
+
+// charging returns prepare as a chargeFunc without refund.
+func charging(prepare prepareFunc) chargeFunc {
+	return func(ctx context.Context, msg *Message) (func(), error) {
+		return nil, prepare(ctx, msg)
+	}
+}
+
+// wrapPublisher applies prepare to every message sent through pub. The
+// returned publisher implements ScheduledPublisher if pub does.
+func wrapPublisher(pub Publisher, prepare prepareFunc) Publisher {
+	return wrapChargingPublisher(pub, charging(prepare))
+}
+
+// wrapChargingPublisher applies charge to every message sent through pub,
+// and refunds it if pub fails to send the message. The returned publisher
+// implements ScheduledPublisher if pub does.
+func wrapChargingPublisher(pub Publisher, charge chargeFunc) Publisher {
+	p := preparingPublisher{Publisher: pub, charge: charge}
+	if sp, ok := pub.(ScheduledPublisher); ok {
+		return &preparingScheduledPublisher{preparingPublisher: p, scheduled: sp}
+	}
+	return &p
+}
+
+// refund calls the refunds that are not nil.
+func refund(refunds ...func()) {
+	for _, r := range refunds {
+		if r != nil {
+			r()
+		}
+	}
+}
+
+// preparingPublisher prepares messages before publishing them.
+type preparingPublisher struct {
+	Publisher
+	charge chargeFunc
+}
+
+func (p *preparingPublisher) Publish(ctx context.Context, msg *Message) error {
+	r, err := p.charge(ctx, msg)
+	if err != nil {
+		return err
+	}
+	if err := p.Publisher.Publish(ctx, msg); err != nil {
+		refund(r)
+		return err
+	}
+	return nil
+}
+
+func (p *preparingPublisher) BrokerProperties() map[string]interface{} {
+	return brokerProperties(p.Publisher)
+}
+
+// preparingScheduledPublisher prepares messages before publishing or scheduling them.
+type preparingScheduledPublisher struct {
+	preparingPublisher
+	scheduled ScheduledPublisher
+}
+
+func (p *preparingScheduledPublisher) Schedule(ctx context.Context, msg *Message, at time.Time) (string, error) {
+	r, err := p.charge(ctx, msg)
+	if err != nil {
+		return "", err
+	}
+	token, err := p.scheduled.Schedule(ctx, msg, at)
+	if err != nil {
+		refund(r)
+		return "", err
+	}
+	return token, nil
+}
+
+func (p *preparingScheduledPublisher) ScheduleBatch(ctx context.Context, msgs []*Message, at time.Time) ([]string, error) {
+	refunds := make([]func(), 0, len(msgs))
+	for _, msg := range msgs {
+		r, err := p.charge(ctx, msg)
+		if err != nil {
+			refund(refunds...)
+			return nil, err
+		}
+		refunds = append(refunds, r)
+	}
+	tokens, err := ScheduleBatch(ctx, p.scheduled, msgs, at)
+	if err != nil && len(tokens) < len(refunds) {
+		// The messages before the failed one were scheduled
+		refund(refunds[len(tokens):]...)
+	}
+	return tokens, err
+}
+
+func (p *preparingScheduledPublisher) CancelScheduled(ctx context.Context, token string) error {
+	return p.scheduled.CancelScheduled(ctx, token)
+}
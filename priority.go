@@ -0,0 +1,362 @@
+package gokyu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// DefaultPriority is the priority of messages whose Priority is unset, as in
+// JMS.
+const DefaultPriority = 4
+
+// MaxPriority is the highest message priority.
+const MaxPriority = 9
+
+// PriorityLevel returns the emulation level in [0, levels) of a message
+// priority. Unset priorities count as DefaultPriority.
+func PriorityLevel(priority uint8, levels int) int {
+	if levels <= 1 {
+		return 0
+	}
+	p := int(priority)
+	if p == 0 {
+		p = DefaultPriority
+	}
+	if p > MaxPriority {
+		p = MaxPriority
+	}
+	return p * levels / (MaxPriority + 1)
+}
+
+// PriorityDestination returns the queue or topic holding the messages of an
+// emulation level: the destination itself for level 0, and
+// "<name>.priority-<level>" above it.
+func PriorityDestination(name string, level int) string {
+	if level == 0 {
+		return name
+	}
+	return fmt.Sprintf("%s.priority-%d", name, level)
+}
+
+// priorityConfig returns the configuration of an emulation level.
+func priorityConfig(cfg *Config, level int) *Config {
+	c := *cfg
+	c.PriorityLevels = 0
+	if c.Queue != "" {
+		c.Queue = PriorityDestination(c.Queue, level)
+	}
+	if c.Topic != "" {
+		c.Topic = PriorityDestination(c.Topic, level)
+	}
+	return &c
+}
+
+// priorityPublisher publishes each message to the destination of its
+// priority level.
+type priorityPublisher struct {
+	factory ProviderFactory
+	cfg     *Config
+
+	mu         sync.Mutex
+	publishers []Publisher
+	closed     bool
+}
+
+// newPriorityPublisher creates the publisher of an emulated priority queue.
+// The level 0 publisher is created immediately, so connection errors
+// surface here.
+func newPriorityPublisher(ctx context.Context, factory ProviderFactory, cfg *Config) (*priorityPublisher, error) {
+	p := &priorityPublisher{factory: factory, cfg: cfg, publishers: make([]Publisher, cfg.PriorityLevels)}
+	if _, err := p.publisher(ctx, 0); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *priorityPublisher) Publish(ctx context.Context, msg *Message) error {
+	pub, err := p.publisher(ctx, PriorityLevel(msg.Priority, len(p.publishers)))
+	if err != nil {
+		return err
+	}
+	return pub.Publish(ctx, msg)
+}
+
+// publisher returns the publisher of a level, creating it on first use.
+func (p *priorityPublisher) publisher(ctx context.Context, level int) (Publisher, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, ErrClosed
+	}
+	if pub := p.publishers[level]; pub != nil {
+		return pub, nil
+	}
+	pub, err := p.factory.NewPublisher(ctx, priorityConfig(p.cfg, level))
+	if err != nil {
+		return nil, err
+	}
+	p.publishers[level] = pub
+	return pub, nil
+}
+
+// BrokerProperties returns the broker properties of the level 0 publisher.
+func (p *priorityPublisher) BrokerProperties() map[string]interface{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return brokerProperties(p.publishers[0])
+}
+
+func (p *priorityPublisher) Close(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+
+	var firstErr error
+	for i, pub := range p.publishers {
+		if pub == nil {
+			continue
+		}
+		if err := pub.Close(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		p.publishers[i] = nil
+	}
+	return firstErr
+}
+
+// newPrioritySubscriber creates a weighted subscriber over the destinations
+// of all emulation levels, each level weighted twice the one below it.
+func newPrioritySubscriber(ctx context.Context, factory ProviderFactory, cfg *Config) (Subscriber, error) {
+	sources := make([]WeightedSource, cfg.PriorityLevels)
+	for level := range sources {
+		sub, err := factory.NewSubscriber(ctx, priorityConfig(cfg, level))
+		if err != nil {
+			for _, src := range sources[:level] {
+				src.Subscriber.Close(ctx)
+			}
+			return nil, err
+		}
+		sources[level] = WeightedSource{Subscriber: sub, Weight: 1 << level}
+	}
+	return NewWeightedSubscriber(sources), nil
+}
+
+// WeightedSource is a subscriber and its share of a weighted subscriber's
+// messages.
+type WeightedSource struct {
+	Subscriber Subscriber
+
+	// Weight is the share of messages taken from this source while other
+	// sources also have messages waiting (default: 1).
+	Weight int
+}
+
+// NewWeightedSubscriber returns a subscriber that receives from several
+// subscribers at once. When more than one has a message waiting, messages
+// are taken in proportion to their weights using smooth weighted
+// round-robin, so heavier sources are favoured without starving the others:
+//
+//	sub := gokyu.NewWeightedSubscriber([]gokyu.WeightedSource{
+//	    {Subscriber: urgent, Weight: 4},
+//	    {Subscriber: bulk, Weight: 1},
+//	})
+//
+// Each source receives one message ahead of Receive, which stays locked at
+// the broker until it is taken. Closing the weighted subscriber closes the
+// sources.
+func NewWeightedSubscriber(sources []WeightedSource) Subscriber {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &weightedSubscriber{
+		sources: make([]*weightedSource, len(sources)),
+		owners:  make(map[*Message]Subscriber),
+		ready:   make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		cancel:  cancel,
+	}
+	for i, src := range sources {
+		weight := src.Weight
+		if weight < 1 {
+			weight = 1
+		}
+		ws := &weightedSource{sub: src.Subscriber, weight: weight, next: make(chan received, 1)}
+		s.sources[i] = ws
+		s.wg.Add(1)
+		go s.pump(ctx, ws)
+	}
+	return s
+}
+
+// received is the result of a source's Receive.
+type received struct {
+	msg *Message
+	err error
+}
+
+// weightedSource is a source of a weighted subscriber.
+type weightedSource struct {
+	sub     Subscriber
+	weight  int
+	current int // smooth weighted round-robin state
+	next    chan received
+	head    *received // taken from next but not yet returned
+}
+
+// weightedSubscriber receives from several subscribers by weight.
+type weightedSubscriber struct {
+	sources []*weightedSource
+	ready   chan struct{} // signalled when a source has a message
+	done    chan struct{}
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+
+	mu        sync.Mutex
+	owners    map[*Message]Subscriber
+	closeOnce sync.Once
+}
+
+// pump receives from a source ahead of Receive.
+func (s *weightedSubscriber) pump(ctx context.Context, src *weightedSource) {
+	defer s.wg.Done()
+	for {
+		msg, err := src.sub.Receive(ctx)
+		if ctx.Err() != nil {
+			if msg != nil {
+				src.sub.Nack(context.Background(), msg)
+			}
+			return
+		}
+		select {
+		case src.next <- received{msg: msg, err: err}:
+			s.signal()
+		case <-ctx.Done():
+			if msg != nil {
+				src.sub.Nack(context.Background(), msg)
+			}
+			return
+		}
+	}
+}
+
+// signal wakes a waiting Receive.
+func (s *weightedSubscriber) signal() {
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (s *weightedSubscriber) Receive(ctx context.Context) (*Message, error) {
+	for {
+		if r, ok := s.take(); ok {
+			return r.msg, r.err
+		}
+		select {
+		case <-s.ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-s.done:
+			return nil, ErrClosed
+		}
+	}
+}
+
+// take returns the next waiting message by weight, if any.
+func (s *weightedSubscriber) take() (received, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var best *weightedSource
+	total, waiting := 0, 0
+	for _, src := range s.sources {
+		if src.head == nil {
+			select {
+			case r := <-src.next:
+				src.head = &r
+			default:
+				continue
+			}
+		}
+		waiting++
+		src.current += src.weight
+		total += src.weight
+		if best == nil || src.current > best.current {
+			best = src
+		}
+	}
+	if best == nil {
+		return received{}, false
+	}
+
+	best.current -= total
+	r := *best.head
+	best.head = nil
+	if r.msg != nil {
+		s.owners[r.msg] = best.sub
+	}
+	if waiting > 1 {
+		// Another Receive may be waiting for the remaining messages
+		s.signal()
+	}
+	return r, true
+}
+
+// owner returns and forgets the source a message was received from.
+func (s *weightedSubscriber) owner(msg *Message) (Subscriber, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sub, ok := s.owners[msg]
+	if !ok {
+		return nil, errors.New("gokyu: message was not received from this subscriber")
+	}
+	delete(s.owners, msg)
+	return sub, nil
+}
+
+func (s *weightedSubscriber) Ack(ctx context.Context, msg *Message) error {
+	sub, err := s.owner(msg)
+	if err != nil {
+		return WrapError(ErrAckFailed, err)
+	}
+	return sub.Ack(ctx, msg)
+}
+
+func (s *weightedSubscriber) Nack(ctx context.Context, msg *Message) error {
+	sub, err := s.owner(msg)
+	if err != nil {
+		return WrapError(ErrAckFailed, err)
+	}
+	return sub.Nack(ctx, msg)
+}
+
+// Close stops receiving, returns messages received ahead to their sources
+// and closes the sources.
+func (s *weightedSubscriber) Close(ctx context.Context) error {
+	var firstErr error
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.cancel()
+		s.wg.Wait()
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, src := range s.sources {
+			if src.head == nil {
+				select {
+				case r := <-src.next:
+					src.head = &r
+				default:
+				}
+			}
+			if src.head != nil && src.head.msg != nil {
+				src.sub.Nack(ctx, src.head.msg)
+			}
+			src.head = nil
+			if err := src.sub.Close(ctx); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+	})
+	return firstErr
+}
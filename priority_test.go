@@ -0,0 +1,189 @@
+package gokyu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ackRecorder records the messages acknowledged on a chanSubscriber.
+type ackRecorder struct {
+	*chanSubscriber
+	mu    sync.Mutex
+	acked []*Message
+}
+
+func (s *ackRecorder) Ack(ctx context.Context, msg *Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.acked = append(s.acked, msg)
+	return nil
+}
+
+// waitForSources waits until every source of a weighted subscriber has a
+// message waiting, so the next Receive chooses among all of them.
+func waitForSources(t *testing.T, sub Subscriber) {
+	t.Helper()
+	s := sub.(*weightedSubscriber)
+	deadline := time.Now().Add(time.Second)
+	for {
+		s.mu.Lock()
+		ready := true
+		for _, src := range s.sources {
+			if src.head == nil && len(src.next) == 0 {
+				ready = false
+			}
+		}
+		s.mu.Unlock()
+		if ready {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected every source to have a message waiting")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPriorityLevel(t *testing.T) {
+	tests := []struct {
+		priority uint8
+		levels   int
+		want     int
+	}{
+		{0, 1, 0},
+		{9, 1, 0},
+		{0, 2, 0}, // unset counts as 4
+		{4, 2, 0},
+		{5, 2, 1},
+		{9, 2, 1},
+		{1, 3, 0},
+		{4, 3, 1},
+		{7, 3, 2},
+		{200, 3, 2},
+		{9, 10, 9},
+	}
+	for _, tt := range tests {
+		if got := PriorityLevel(tt.priority, tt.levels); got != tt.want {
+			t.Errorf("PriorityLevel(%d, %d) = %d, want %d", tt.priority, tt.levels, got, tt.want)
+		}
+	}
+
+	if got := PriorityDestination("jobs", 0); got != "jobs" {
+		t.Errorf("PriorityDestination(jobs, 0) = %q", got)
+	}
+	if got := PriorityDestination("jobs", 2); got != "jobs.priority-2" {
+		t.Errorf("PriorityDestination(jobs, 2) = %q", got)
+	}
+}
+
+func TestWeightedSubscriber_Weights(t *testing.T) {
+	var sources []WeightedSource
+	for i, weight := range []int{1, 2, 4} {
+		msgs := make(chan *Message, 100)
+		for j := 0; j < 100; j++ {
+			msgs <- NewMessage([]byte(fmt.Sprint(i)))
+		}
+		sources = append(sources, WeightedSource{Subscriber: newChanSubscriber(msgs), Weight: weight})
+	}
+	sub := NewWeightedSubscriber(sources)
+	defer sub.Close(context.Background())
+
+	counts := make(map[string]int)
+	for i := 0; i < 70; i++ {
+		waitForSources(t, sub)
+		msg, err := sub.Receive(context.Background())
+		if err != nil {
+			t.Fatalf("Receive() error = %v", err)
+		}
+		counts[string(msg.Body)]++
+	}
+	if counts["0"] != 10 || counts["1"] != 20 || counts["2"] != 40 {
+		t.Errorf("expected 10/20/40 messages by weight, got %v", counts)
+	}
+}
+
+func TestWeightedSubscriber_Settle(t *testing.T) {
+	low := &ackRecorder{chanSubscriber: newChanSubscriber(make(chan *Message, 1))}
+	high := &ackRecorder{chanSubscriber: newChanSubscriber(make(chan *Message, 1))}
+	sub := NewWeightedSubscriber([]WeightedSource{{Subscriber: low}, {Subscriber: high, Weight: 2}})
+	ctx := context.Background()
+
+	// A lone waiting message is taken whatever its weight
+	low.msgs <- NewMessage([]byte("low"))
+	msg, err := sub.Receive(ctx)
+	if err != nil || string(msg.Body) != "low" {
+		t.Fatalf("Receive() = %v, %v", msg, err)
+	}
+	if err := sub.Ack(ctx, msg); err != nil {
+		t.Fatalf("Ack() error = %v", err)
+	}
+	if len(low.acked) != 1 || len(high.acked) != 0 {
+		t.Errorf("expected the ack to reach the low source, got %d/%d", len(low.acked), len(high.acked))
+	}
+	if err := sub.Ack(ctx, msg); !errors.Is(err, ErrAckFailed) {
+		t.Errorf("second Ack() error = %v", err)
+	}
+
+	if err := sub.Close(ctx); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if _, err := sub.Receive(ctx); !errors.Is(err, ErrClosed) {
+		t.Errorf("Receive() after Close error = %v", err)
+	}
+	select {
+	case <-high.closed:
+	default:
+		t.Error("expected the sources to be closed")
+	}
+}
+
+func TestClient_PriorityEmulation(t *testing.T) {
+	factory := &queueFactory{published: make(map[string][]*Message)}
+	provider := Provider("test-priority-provider")
+	RegisterProvider(provider, factory)
+	client, err := NewClient(&Config{
+		Provider:         provider,
+		ConnectionString: "amqps://test",
+		Queue:            "jobs",
+		PriorityLevels:   2,
+	})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	if caps := client.Capabilities(); caps.Priority != Emulated || caps.Scheduling != Unsupported {
+		t.Errorf("Capabilities() = %+v", caps)
+	}
+
+	ctx := context.Background()
+	pub, err := client.NewPublisher(ctx)
+	if err != nil {
+		t.Fatalf("NewPublisher() error = %v", err)
+	}
+	urgent := NewMessage([]byte("urgent"))
+	urgent.Priority = 9
+	for _, msg := range []*Message{NewMessage([]byte("normal")), urgent} {
+		if err := pub.Publish(ctx, msg); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+	if len(factory.published["jobs"]) != 1 || len(factory.published["jobs.priority-1"]) != 1 {
+		t.Errorf("published = %v", factory.published)
+	}
+
+	sub, err := client.NewSubscriber(ctx)
+	if err != nil {
+		t.Fatalf("NewSubscriber() error = %v", err)
+	}
+	if _, ok := sub.(*weightedSubscriber); !ok {
+		t.Errorf("expected a weighted subscriber, got %T", sub)
+	}
+	sub.Close(ctx)
+
+	if _, err := NewClient(&Config{Provider: provider, ConnectionString: "amqps://test", Queue: "jobs", PriorityLevels: 11}); err == nil {
+		t.Error("expected an error for more than 10 priority levels")
+	}
+}
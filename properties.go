@@ -0,0 +1,135 @@
+package gokyu
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// PropertyConverter converts a property value whose type is not supported
+// (see NormalizeProperties) to a supported one. It returns ok false if it does
+// not handle the value's type.
+type PropertyConverter func(key string, v interface{}) (converted interface{}, ok bool, err error)
+
+// JSONPropertyConverter converts structs, maps, slices and arrays to JSON
+// strings. Set it as Config.PropertyConverter to opt in to structured
+// property values; consumers unmarshal them from the string.
+func JSONPropertyConverter(key string, v interface{}) (interface{}, bool, error) {
+	switch reflect.Indirect(reflect.ValueOf(v)).Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+	default:
+		return nil, false, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, false, err
+	}
+	return string(data), true, nil
+}
+
+var (
+	timeType  = reflect.TypeOf(time.Time{})
+	bytesType = reflect.TypeOf([]byte(nil))
+)
+
+// NormalizeProperties converts the values of props in place to the types
+// every provider can encode: nil, bool, string, []byte, int8 to int64, uint8
+// to uint64, float32, float64 and time.Time. Other values are converted:
+//
+//   - int and uint become int64 and uint64
+//   - types defined on a supported type, such as time.Duration or
+//     json.RawMessage, become that type
+//   - byte arrays, such as UUIDs, become []byte
+//   - time.Time is truncated to milliseconds in UTC, the precision of an
+//     AMQP timestamp
+//   - pointers are dereferenced
+//
+// Remaining values are passed to convert, if not nil. Values that cannot be
+// converted fail with ErrInvalidProperty naming the key and type, rather than
+// with an encoding error of the provider at publish time.
+func NormalizeProperties(props map[string]interface{}, convert PropertyConverter) error {
+	for key, v := range props {
+		converted, err := normalizeProperty(key, v, convert)
+		if err != nil {
+			return err
+		}
+		props[key] = converted
+	}
+	return nil
+}
+
+func normalizeProperty(key string, v interface{}, convert PropertyConverter) (interface{}, error) {
+	switch v := v.(type) {
+	case nil, bool, string, []byte,
+		int8, int16, int32, int64,
+		uint8, uint16, uint32, uint64,
+		float32, float64:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case uint:
+		return uint64(v), nil
+	case time.Time:
+		return v.UTC().Truncate(time.Millisecond), nil
+	}
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return nil, nil
+		}
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Bool:
+		return rv.Bool(), nil
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Int, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Int8:
+		return int8(rv.Int()), nil
+	case reflect.Int16:
+		return int16(rv.Int()), nil
+	case reflect.Int32:
+		return int32(rv.Int()), nil
+	case reflect.Uint, reflect.Uint64:
+		return rv.Uint(), nil
+	case reflect.Uint8:
+		return uint8(rv.Uint()), nil
+	case reflect.Uint16:
+		return uint16(rv.Uint()), nil
+	case reflect.Uint32:
+		return uint32(rv.Uint()), nil
+	case reflect.Float32:
+		return float32(rv.Float()), nil
+	case reflect.Float64:
+		return rv.Float(), nil
+	case reflect.Slice:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			return rv.Convert(bytesType).Interface(), nil
+		}
+	case reflect.Array:
+		if rv.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, rv.Len())
+			reflect.Copy(reflect.ValueOf(b), rv)
+			return b, nil
+		}
+	case reflect.Struct:
+		if rv.Type().ConvertibleTo(timeType) {
+			return normalizeProperty(key, rv.Convert(timeType).Interface(), nil)
+		}
+	}
+
+	if convert != nil {
+		converted, ok, err := convert(key, v)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidProperty, key, err)
+		}
+		if ok {
+			return converted, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s has unsupported type %T", ErrInvalidProperty, key, v)
+}
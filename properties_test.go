@@ -0,0 +1,112 @@
+package gokyu
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type orderStatus string
+
+func TestNormalizeProperties(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 6789012, time.FixedZone("CET", 3600))
+	count := 3
+
+	props := map[string]interface{}{
+		"string":   "a",
+		"int":      42,
+		"uint":     uint(7),
+		"status":   orderStatus("paid"),
+		"timeout":  5 * time.Second,
+		"raw":      json.RawMessage(`{}`),
+		"uuid":     [4]byte{1, 2, 3, 4},
+		"at":       at,
+		"count":    &count,
+		"nil-ptr":  (*int)(nil),
+		"float":    1.5,
+		"nil":      nil,
+		"bytes":    []byte("b"),
+		"small":    int8(-1),
+		"unsigned": uint16(9),
+	}
+	if err := NormalizeProperties(props, nil); err != nil {
+		t.Fatalf("NormalizeProperties() error = %v", err)
+	}
+
+	want := map[string]interface{}{
+		"string":   "a",
+		"int":      int64(42),
+		"uint":     uint64(7),
+		"status":   "paid",
+		"timeout":  int64(5 * time.Second),
+		"raw":      []byte(`{}`),
+		"uuid":     []byte{1, 2, 3, 4},
+		"at":       time.Date(2024, 1, 2, 2, 4, 5, 6000000, time.UTC),
+		"count":    int64(3),
+		"nil-ptr":  nil,
+		"float":    1.5,
+		"nil":      nil,
+		"bytes":    []byte("b"),
+		"small":    int8(-1),
+		"unsigned": uint16(9),
+	}
+	if !reflect.DeepEqual(props, want) {
+		t.Errorf("NormalizeProperties() = %#v, want %#v", props, want)
+	}
+}
+
+func TestNormalizeProperties_Unsupported(t *testing.T) {
+	type address struct {
+		City string `json:"city"`
+	}
+
+	props := map[string]interface{}{"address": address{City: "Lisbon"}}
+	err := NormalizeProperties(props, nil)
+	if !errors.Is(err, ErrInvalidProperty) || err.Error() != "gokyu: invalid property: address has unsupported type gokyu.address" {
+		t.Errorf("NormalizeProperties() error = %v", err)
+	}
+
+	if err := NormalizeProperties(props, JSONPropertyConverter); err != nil {
+		t.Fatalf("NormalizeProperties() error = %v", err)
+	}
+	if props["address"] != `{"city":"Lisbon"}` {
+		t.Errorf("address = %#v", props["address"])
+	}
+
+	props = map[string]interface{}{"callback": func() {}}
+	if err := NormalizeProperties(props, JSONPropertyConverter); !errors.Is(err, ErrInvalidProperty) {
+		t.Errorf("NormalizeProperties() error = %v, want ErrInvalidProperty", err)
+	}
+}
+
+func TestClient_PublishNormalizesProperties(t *testing.T) {
+	factory := &recordingFactory{}
+	RegisterProvider("test-properties-provider", factory)
+	client, _ := NewClient(&Config{
+		Provider:         "test-properties-provider",
+		ConnectionString: "amqps://test",
+		Topic:            "topic",
+	})
+	pub, _ := client.NewPublisher(context.Background())
+
+	msg := NewMessage(nil)
+	msg.Properties["attempt"] = 2
+	if err := pub.Publish(context.Background(), msg); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if got := factory.published[0].Properties["attempt"]; got != int64(2) {
+		t.Errorf("attempt = %#v, want int64(2)", got)
+	}
+
+	msg = NewMessage(nil)
+	msg.Properties["tags"] = []string{"a"}
+	if err := pub.Publish(context.Background(), msg); !errors.Is(err, ErrInvalidProperty) {
+		t.Errorf("Publish() error = %v, want ErrInvalidProperty", err)
+	}
+	if len(factory.published) != 1 {
+		t.Errorf("expected the invalid message not to be published")
+	}
+}
@@ -19,6 +19,67 @@
 // The virtual topic path is automatically constructed by this package
 // when you provide Topic and Subscription in the configuration.
 //
+// # Scheduled Messages
+//
+// Scheduled delivery uses the AMQ_SCHEDULED_DELAY property and requires the
+// broker scheduler to be enabled. Cancellation is emulated with tombstone
+// messages, so consumers must wrap their subscriber with
+// gokyu.NewTombstoneSubscriber for CancelScheduled to take effect, and then
+// only on a best-effort basis.
+//
+// # Browsing
+//
+// Factory.NewBrowser reads a topic through its own non-durable
+// subscription, leaving the configured subscription alone. Queues cannot be
+// browsed.
+//
+// # Priority
+//
+// Message.Priority is sent as the AMQP priority header, which ActiveMQ maps to
+// JMSPriority. Queues deliver higher priorities first only with
+// prioritizedMessages enabled in the broker's destination policy.
+//
+// # JMS Interop
+//
+// With Config.JMSInterop set, text bodies (text/* content types) are sent as
+// JMS TextMessages and other bodies as BytesMessages, and the JMSType,
+// JMSCorrelationID and JMSReplyTo properties map to the JMS headers. Received
+// TextMessages have their text in Body, and the sender's JMS message type in
+// the PropertyJMSMessageType property.
+//
+// # Redelivery
+//
+// ActiveMQ redelivers released messages immediately and without counting
+// them, so a message that always fails is redelivered in a tight loop. With
+// Config.Redelivery set, Nack holds the message for the policy's delay and
+// then releases it as a failed delivery (AMQP modified), which increments
+// the broker's redelivery counter. Once MaxRedeliveries is reached, Nack
+// rejects the message and the broker moves it to its dead-letter queue.
+// Messages are settled individually, so other messages keep flowing while
+// one is held. Held messages keep their link credit.
+//
+// # Endpoint Discovery
+//
+// Discovery looks up the AMQP endpoints of an active/standby broker with the
+// DescribeBroker API. Set it as gokyu.Config.Endpoints so that connections
+// go to whichever instance is active.
+//
+// # WebSockets
+//
+// With gokyu.Config.WebSocket set, connections tunnel AMQP over a WebSocket
+// to port 443, or to Config.Port. The broker must have an amqp+wss transport
+// connector listening there.
+//
+// # Fault Injection
+//
+// Test binaries built with the gokyufaults build tag can force failures at
+// link attach, send and receive to exercise application resilience:
+//
+//	amazonmq.InjectFault(amazonmq.FaultReceive, nil, 2) // next Receive fails despite reattaching
+//	defer amazonmq.ClearFaults()
+//
+// Without the tag the fault points compile to no-ops.
+//
 // # Usage
 //
 // Import this package to register the Amazon MQ provider:
@@ -29,6 +90,8 @@ package amazonmq
 import (
 	"context"
 	"fmt"
+	"net/url"
+	"sync"
 
 	"github.com/Azure/go-amqp"
 	"github.com/venderneutral/gokyu"
@@ -41,9 +104,42 @@ func init() {
 // Factory creates Amazon MQ publishers and subscribers.
 type Factory struct{}
 
+// Capabilities reports native scheduling and priority.
+func (f *Factory) Capabilities() gokyu.Capabilities {
+	return gokyu.Capabilities{Scheduling: gokyu.Native, Priority: gokyu.Native}
+}
+
+// Guarantees describes the delivery guarantees of ActiveMQ on Amazon MQ.
+func (f *Factory) Guarantees() gokyu.Guarantees {
+	return gokyu.Guarantees{
+		Delivery:       gokyu.AtLeastOnce,
+		Ordering:       gokyu.OrderingQueue,
+		Deduplication:  gokyu.Unsupported,
+		MaxMessageSize: 100 << 20,
+		Notes: []string{
+			"ordering holds for one consumer per queue; redelivered and higher-priority messages overtake others",
+		},
+	}
+}
+
+// Ping connects to the broker, authenticates and disconnects.
+func (f *Factory) Ping(ctx context.Context, cfg *gokyu.Config) error {
+	conn, err := dial(ctx, cfg)
+	if err != nil {
+		return gokyu.WrapError(gokyu.ErrConnectionFailed, err)
+	}
+	return conn.Close()
+}
+
 // NewPublisher creates a new Amazon MQ publisher.
 func (f *Factory) NewPublisher(ctx context.Context, cfg *gokyu.Config) (gokyu.Publisher, error) {
-	conn, err := amqp.Dial(ctx, cfg.BuildConnectionString(), nil)
+	// Build destination address for ActiveMQ
+	destination, err := cfg.ExpandAddress(cfg.PublishAddressTemplate, buildDestinationAddress(cfg))
+	if err != nil {
+		return nil, gokyu.ErrInvalidConfig(err.Error())
+	}
+
+	conn, err := dial(ctx, cfg)
 	if err != nil {
 		return nil, gokyu.WrapError(gokyu.ErrConnectionFailed, err)
 	}
@@ -54,8 +150,11 @@ func (f *Factory) NewPublisher(ctx context.Context, cfg *gokyu.Config) (gokyu.Pu
 		return nil, gokyu.WrapError(gokyu.ErrConnectionFailed, err)
 	}
 
-	// Build destination address for ActiveMQ
-	destination := buildDestinationAddress(cfg)
+	if err := injectFault(FaultAttach); err != nil {
+		session.Close(ctx)
+		conn.Close()
+		return nil, gokyu.WrapError(gokyu.ErrConnectionFailed, err)
+	}
 
 	sender, err := session.NewSender(ctx, destination, nil)
 	if err != nil {
@@ -64,16 +163,31 @@ func (f *Factory) NewPublisher(ctx context.Context, cfg *gokyu.Config) (gokyu.Pu
 		return nil, gokyu.WrapError(gokyu.ErrConnectionFailed, err)
 	}
 
-	return &publisher{
-		conn:    conn,
-		session: session,
-		sender:  sender,
-	}, nil
+	pub := &publisher{
+		conn:        conn,
+		session:     session,
+		destination: destination,
+		sender:      sender,
+		jms:         cfg.JMSInterop,
+	}
+	pub.unregister = gokyu.RegisterDiagnostics("amazonmq-publisher", pub.diagnostics)
+
+	return pub, nil
 }
 
 // NewSubscriber creates a new Amazon MQ subscriber.
 func (f *Factory) NewSubscriber(ctx context.Context, cfg *gokyu.Config) (gokyu.Subscriber, error) {
-	conn, err := amqp.Dial(ctx, cfg.BuildConnectionString(), nil)
+	// Build source address for ActiveMQ
+	source, err := cfg.ExpandAddress(cfg.AddressTemplate, buildSourceAddress(cfg))
+	if err != nil {
+		return nil, gokyu.ErrInvalidConfig(err.Error())
+	}
+	return newSubscriber(ctx, cfg, source)
+}
+
+// newSubscriber creates a subscriber receiving from source.
+func newSubscriber(ctx context.Context, cfg *gokyu.Config, source string) (gokyu.Subscriber, error) {
+	conn, err := dial(ctx, cfg)
 	if err != nil {
 		return nil, gokyu.WrapError(gokyu.ErrConnectionFailed, err)
 	}
@@ -84,21 +198,121 @@ func (f *Factory) NewSubscriber(ctx context.Context, cfg *gokyu.Config) (gokyu.S
 		return nil, gokyu.WrapError(gokyu.ErrConnectionFailed, err)
 	}
 
-	// Build source address for ActiveMQ
-	source := buildSourceAddress(cfg)
+	if err := injectFault(FaultAttach); err != nil {
+		session.Close(ctx)
+		conn.Close()
+		return nil, gokyu.WrapError(gokyu.ErrConnectionFailed, err)
+	}
 
-	receiver, err := session.NewReceiver(ctx, source, nil)
+	receiver, err := session.NewReceiver(ctx, source, receiverOptions(cfg))
 	if err != nil {
 		session.Close(ctx)
 		conn.Close()
 		return nil, gokyu.WrapError(gokyu.ErrConnectionFailed, err)
 	}
 
-	return &subscriber{
+	sub := &subscriber{
 		conn:     conn,
 		session:  session,
 		receiver: receiver,
-	}, nil
+		source:   source,
+		cfg:      cfg,
+		identity: gokyu.NewReceiver(cfg),
+		done:     make(chan struct{}),
+	}
+	if cfg.Redelivery != nil {
+		policy := cfg.Redelivery.WithDefaults()
+		sub.redelivery = &policy
+		sub.delayed = make(map[*amqp.Message]gokyu.Timer)
+	}
+
+	if sub.prefetch, err = newPrefetchController(cfg, receiver); err != nil {
+		sub.Close(ctx)
+		return nil, gokyu.WrapError(gokyu.ErrConnectionFailed, err)
+	}
+
+	sub.unregister = gokyu.RegisterDiagnostics("amazonmq-subscriber", sub.diagnostics)
+
+	return sub, nil
+}
+
+// receiverOptions maps the prefetch configuration to link credit. Adaptive
+// prefetch uses manual credit managed by a gokyu.PrefetchController.
+func receiverOptions(cfg *gokyu.Config) *amqp.ReceiverOptions {
+	if cfg.AdaptivePrefetch {
+		return &amqp.ReceiverOptions{Credit: -1}
+	}
+	if cfg.PrefetchCount > 0 {
+		return &amqp.ReceiverOptions{Credit: int32(cfg.PrefetchCount)}
+	}
+	return nil
+}
+
+// connOptions identifies the connection to the broker and applies the
+// connection tuning of the configuration.
+func connOptions(cfg *gokyu.Config) *amqp.ConnOptions {
+	return &amqp.ConnOptions{
+		Properties:   gokyu.ConnectionProperties(cfg),
+		MaxFrameSize: cfg.MaxFrameSize,
+		IdleTimeout:  cfg.IdleTimeout,
+		MaxSessions:  cfg.ChannelMax,
+		WriteTimeout: cfg.WriteTimeout,
+	}
+}
+
+// webSocketPath is the path ActiveMQ's amqp+wss transport connector accepts for AMQP over WebSockets.
+const webSocketPath = "/"
+
+// dial opens the AMQP connection (see gokyu.DialBroker).
+func dial(ctx context.Context, cfg *gokyu.Config) (*amqp.Conn, error) {
+	u, err := url.Parse(cfg.BuildConnectionString())
+	if err != nil {
+		return nil, err
+	}
+	creds, err := gokyu.ResolveCredentials(ctx, cfg, u)
+	if err != nil {
+		return nil, err
+	}
+	netConn, err := gokyu.DialBroker(ctx, cfg, webSocketPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// amqp.Dial takes these from the URL; NewConn needs them explicitly
+	opts := connOptions(cfg)
+	opts.HostName = u.Hostname()
+	if creds != nil {
+		opts.SASLType = amqp.SASLTypePlain(creds.Username, creds.Password)
+	}
+
+	conn, err := amqp.NewConn(ctx, netConn, opts)
+	if err != nil {
+		netConn.Close()
+		return nil, err
+	}
+
+	if cfg.Events != nil {
+		addr := netConn.RemoteAddr().String()
+		gokyu.EmitEvent(cfg, gokyu.Event{Type: gokyu.EventConnected, Detail: addr})
+		go func() {
+			<-conn.Done()
+			gokyu.EmitEvent(cfg, gokyu.Event{Type: gokyu.EventDisconnected, Detail: addr, Err: conn.Err()})
+		}()
+	}
+	return conn, nil
+}
+
+// newPrefetchController starts an adaptive prefetch controller for receiver,
+// or returns nil if adaptive prefetch is disabled.
+func newPrefetchController(cfg *gokyu.Config, receiver *amqp.Receiver) (*gokyu.PrefetchController, error) {
+	if !cfg.AdaptivePrefetch {
+		return nil, nil
+	}
+	prefetch := gokyu.NewPrefetchController(1, cfg.PrefetchCount, cfg.PrefetchLatencyTarget, receiver.IssueCredit)
+	if err := prefetch.Start(); err != nil {
+		return nil, err
+	}
+	return prefetch, nil
 }
 
 // buildDestinationAddress constructs the AMQP address for Amazon MQ (ActiveMQ).
@@ -124,38 +338,54 @@ func buildSourceAddress(cfg *gokyu.Config) string {
 	return fmt.Sprintf("topic://%s", cfg.Topic)
 }
 
-// publisher implements gokyu.Publisher for Amazon MQ.
+// publisher implements gokyu.Publisher and gokyu.ScheduledPublisher for Amazon MQ.
 type publisher struct {
-	conn    *amqp.Conn
-	session *amqp.Session
-	sender  *amqp.Sender
-}
+	conn        *amqp.Conn
+	session     *amqp.Session
+	destination string
 
-func (p *publisher) Publish(ctx context.Context, msg *gokyu.Message) error {
-	amqpMsg := amqp.NewMessage(msg.Body)
+	linkMu sync.Mutex
+	sender *amqp.Sender
 
-	// Set message ID if provided
-	if msg.ID != "" {
-		amqpMsg.Properties = &amqp.MessageProperties{
-			MessageID: msg.ID,
-		}
-	}
+	// jms enables JMS interop mapping (Config.JMSInterop)
+	jms bool
 
-	// Set application properties
-	if len(msg.Properties) > 0 {
-		amqpMsg.ApplicationProperties = msg.Properties
-	}
+	unregister func()
+}
 
-	if err := p.sender.Send(ctx, amqpMsg, nil); err != nil {
+func (p *publisher) Publish(ctx context.Context, msg *gokyu.Message) error {
+	amqpMsg := newAMQPMessage(msg)
+	if p.jms {
+		toJMS(msg, amqpMsg)
+	}
+	if err := p.send(ctx, amqpMsg); err != nil {
 		return gokyu.WrapError(gokyu.ErrPublishFailed, err)
 	}
 	return nil
 }
 
+// BrokerProperties returns the properties the broker sent on connection open.
+func (p *publisher) BrokerProperties() map[string]interface{} {
+	return p.conn.Properties()
+}
+
+// diagnostics reports the sender link state.
+func (p *publisher) diagnostics() map[string]interface{} {
+	sender := p.link()
+	return map[string]interface{}{
+		"address": sender.Address(),
+		"link":    sender.LinkName(),
+	}
+}
+
 func (p *publisher) Close(ctx context.Context) error {
+	if p.unregister != nil {
+		p.unregister()
+	}
+
 	var errs []error
 
-	if err := p.sender.Close(ctx); err != nil {
+	if err := p.link().Close(ctx); err != nil {
 		errs = append(errs, err)
 	}
 	if err := p.session.Close(ctx); err != nil {
@@ -171,38 +401,146 @@ func (p *publisher) Close(ctx context.Context) error {
 	return nil
 }
 
+// newAMQPMessage converts a gokyu message to an AMQP message.
+func newAMQPMessage(msg *gokyu.Message) *amqp.Message {
+	amqpMsg := amqp.NewMessage(msg.Body)
+	switch v := msg.BodyValue.(type) {
+	case nil:
+	case gokyu.BodySequence:
+		amqpMsg = &amqp.Message{Sequence: v}
+	default:
+		amqpMsg = &amqp.Message{Value: v}
+	}
+
+	// Set message ID and content type if provided
+	if msg.ID != "" || msg.ContentType != "" {
+		amqpMsg.Properties = &amqp.MessageProperties{}
+	}
+	if msg.ID != "" {
+		amqpMsg.Properties.MessageID = msg.ID
+	}
+	if msg.ContentType != "" {
+		amqpMsg.Properties.ContentType = &msg.ContentType
+	}
+
+	if msg.Priority != 0 {
+		amqpMsg.Header = &amqp.MessageHeader{Priority: msg.Priority}
+	}
+
+	// Set application properties
+	if len(msg.Properties) > 0 {
+		amqpMsg.ApplicationProperties = msg.Properties
+	}
+
+	return amqpMsg
+}
+
 // subscriber implements gokyu.Subscriber for Amazon MQ.
 type subscriber struct {
 	conn     *amqp.Conn
 	session  *amqp.Session
+	source   string
+	cfg      *gokyu.Config
+	identity *gokyu.Receiver
+
+	linkMu   sync.Mutex
 	receiver *amqp.Receiver
+	prefetch *gokyu.PrefetchController
+
+	// redelivery is set if Config.Redelivery is
+	redelivery *gokyu.RedeliveryPolicy
+	delayMu    sync.Mutex
+	delayed    map[*amqp.Message]gokyu.Timer
+	done       chan struct{}
+	closeOnce  sync.Once
+
+	unregister func()
 }
 
 func (s *subscriber) Receive(ctx context.Context) (*gokyu.Message, error) {
-	amqpMsg, err := s.receiver.Receive(ctx, nil)
+	amqpMsg, err := s.receive(ctx)
 	if err != nil {
 		return nil, gokyu.WrapError(gokyu.ErrReceiveFailed, err)
 	}
 
+	msg := newMessage(amqpMsg)
+	msg.Receiver = s.identity
+	if s.cfg.JMSInterop {
+		fromJMS(amqpMsg, msg)
+	}
+
+	// Store raw message for acknowledgment
+	msg.SetRaw(amqpMsg)
+
+	if _, prefetch := s.link(); prefetch != nil {
+		prefetch.OnReceive(amqpMsg)
+	}
+
+	return msg, nil
+}
+
+// newMessage converts a received AMQP message to a gokyu message.
+func newMessage(amqpMsg *amqp.Message) *gokyu.Message {
+	// Application properties are already decoded by the AMQP client, so the
+	// map is shared rather than copied.
 	msg := &gokyu.Message{
-		Body:       amqpMsg.GetData(),
-		Properties: make(map[string]interface{}),
+		Body:       messageBody(amqpMsg),
+		Properties: amqpMsg.ApplicationProperties,
+	}
+	if msg.Properties == nil {
+		msg.Properties = make(map[string]interface{})
 	}
 
-	// Extract message ID
-	if amqpMsg.Properties != nil && amqpMsg.Properties.MessageID != nil {
-		msg.ID = fmt.Sprintf("%v", amqpMsg.Properties.MessageID)
+	// Bodies sent as amqp-value or amqp-sequence instead of binary data
+	switch {
+	case amqpMsg.Value != nil:
+		msg.BodyValue = amqpMsg.Value
+	case len(amqpMsg.Sequence) > 0:
+		msg.BodyValue = gokyu.BodySequence(amqpMsg.Sequence)
 	}
 
-	// Extract application properties
-	for k, v := range amqpMsg.ApplicationProperties {
-		msg.Properties[k] = v
+	if amqpMsg.Header != nil {
+		msg.Priority = amqpMsg.Header.Priority
 	}
 
-	// Store raw message for acknowledgment
-	msg.SetRaw(amqpMsg)
+	// Extract message ID and content type
+	if amqpMsg.Properties != nil {
+		if amqpMsg.Properties.MessageID != nil {
+			msg.ID = fmt.Sprintf("%v", amqpMsg.Properties.MessageID)
+		}
+		if amqpMsg.Properties.ContentType != nil {
+			msg.ContentType = *amqpMsg.Properties.ContentType
+		}
+		// ActiveMQ maps JMSTimestamp to the creation time. It is set when
+		// the message is sent, or by the broker with timestamping enabled
+		if amqpMsg.Properties.CreationTime != nil {
+			msg.EnqueuedTime = *amqpMsg.Properties.CreationTime
+		}
+	}
 
-	return msg, nil
+	return msg
+}
+
+// messageBody concatenates all data sections of a message. GetData only
+// returns the first section, but JMS BytesMessages can arrive split across
+// several.
+func messageBody(amqpMsg *amqp.Message) []byte {
+	switch len(amqpMsg.Data) {
+	case 0:
+		return nil
+	case 1:
+		return amqpMsg.Data[0]
+	}
+
+	size := 0
+	for _, part := range amqpMsg.Data {
+		size += len(part)
+	}
+	body := make([]byte, 0, size)
+	for _, part := range amqpMsg.Data {
+		body = append(body, part...)
+	}
+	return body
 }
 
 func (s *subscriber) Ack(ctx context.Context, msg *gokyu.Message) error {
@@ -210,9 +548,11 @@ func (s *subscriber) Ack(ctx context.Context, msg *gokyu.Message) error {
 	if !ok {
 		return gokyu.ErrAckFailed
 	}
-	if err := s.receiver.AcceptMessage(ctx, amqpMsg); err != nil {
+	receiver, _ := s.link()
+	if err := receiver.AcceptMessage(ctx, amqpMsg); err != nil {
 		return gokyu.WrapError(gokyu.ErrAckFailed, err)
 	}
+	s.settled(amqpMsg)
 	return nil
 }
 
@@ -221,17 +561,65 @@ func (s *subscriber) Nack(ctx context.Context, msg *gokyu.Message) error {
 	if !ok {
 		return gokyu.ErrAckFailed
 	}
+	if s.redelivery != nil {
+		return s.redeliver(ctx, msg, amqpMsg)
+	}
+
 	// Release the message for redelivery
-	if err := s.receiver.ReleaseMessage(ctx, amqpMsg); err != nil {
+	receiver, _ := s.link()
+	if err := receiver.ReleaseMessage(ctx, amqpMsg); err != nil {
 		return gokyu.WrapError(gokyu.ErrAckFailed, err)
 	}
+	s.settled(amqpMsg)
 	return nil
 }
 
+// BrokerProperties returns the properties the broker sent on connection open.
+func (s *subscriber) BrokerProperties() map[string]interface{} {
+	return s.conn.Properties()
+}
+
+// diagnostics reports the receiver link state.
+func (s *subscriber) diagnostics() map[string]interface{} {
+	receiver, prefetch := s.link()
+	state := map[string]interface{}{
+		"address": receiver.Address(),
+		"link":    receiver.LinkName(),
+	}
+	if prefetch != nil {
+		state["prefetch_window"] = prefetch.Window()
+	}
+	if s.redelivery != nil {
+		s.delayMu.Lock()
+		state["delayed_redeliveries"] = len(s.delayed)
+		s.delayMu.Unlock()
+	}
+	return state
+}
+
+// settled reports a settlement to the adaptive prefetch controller, if any.
+// Failing to issue credit means the link is gone, which the next Receive
+// reports, so the already successful settlement is not failed here.
+func (s *subscriber) settled(amqpMsg *amqp.Message) {
+	if _, prefetch := s.link(); prefetch != nil {
+		_ = prefetch.OnSettle(amqpMsg)
+	}
+}
+
 func (s *subscriber) Close(ctx context.Context) error {
+	if s.unregister != nil {
+		s.unregister()
+	}
+
 	var errs []error
 
-	if err := s.receiver.Close(ctx); err != nil {
+	s.closeOnce.Do(func() { close(s.done) })
+	if s.redelivery != nil {
+		s.releaseDelayed(ctx)
+	}
+
+	receiver, _ := s.link()
+	if err := receiver.Close(ctx); err != nil {
 		errs = append(errs, err)
 	}
 	if err := s.session.Close(ctx); err != nil {
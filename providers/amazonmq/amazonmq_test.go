@@ -0,0 +1,150 @@
+package amazonmq
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-amqp"
+	"github.com/venderneutral/gokyu"
+	"github.com/venderneutral/gokyu/internal/amqptest"
+)
+
+// roundTrip encodes an AMQP message and decodes it as if received.
+func roundTrip(t *testing.T, amqpMsg *amqp.Message) *gokyu.Message {
+	t.Helper()
+	return newMessage(transmit(t, amqpMsg))
+}
+
+// transmit encodes an AMQP message and returns the decoded message.
+func transmit(t *testing.T, amqpMsg *amqp.Message) *amqp.Message {
+	t.Helper()
+	data, err := amqpMsg.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() error = %v", err)
+	}
+	var received amqp.Message
+	if err := received.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary() error = %v", err)
+	}
+	return &received
+}
+
+func TestNewMessage_MultipleDataSections(t *testing.T) {
+	msg := roundTrip(t, &amqp.Message{Data: [][]byte{[]byte("hello, "), []byte("split "), []byte("world")}})
+	if got := string(msg.Body); got != "hello, split world" {
+		t.Errorf("expected all data sections, got %q", got)
+	}
+}
+
+func TestMessageBodies_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		msg       *gokyu.Message
+		wantBody  string
+		wantValue interface{}
+	}{
+		{
+			name:     "data",
+			msg:      gokyu.NewMessage([]byte("payload")),
+			wantBody: "payload",
+		},
+		{
+			name:      "value",
+			msg:       &gokyu.Message{BodyValue: "text body"},
+			wantValue: "text body",
+		},
+		{
+			name:      "sequence",
+			msg:       &gokyu.Message{BodyValue: gokyu.BodySequence{{"a", int64(1)}, {true}}},
+			wantValue: gokyu.BodySequence{{"a", int64(1)}, {true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.msg.ID = "m1"
+			got := roundTrip(t, newAMQPMessage(tt.msg))
+
+			if got.ID != "m1" {
+				t.Errorf("expected ID m1, got %q", got.ID)
+			}
+			if string(got.Body) != tt.wantBody {
+				t.Errorf("expected body %q, got %q", tt.wantBody, got.Body)
+			}
+			if !reflect.DeepEqual(got.BodyValue, tt.wantValue) {
+				t.Errorf("expected body value %#v, got %#v", tt.wantValue, got.BodyValue)
+			}
+			if got.Properties == nil {
+				t.Error("expected non-nil properties")
+			}
+		})
+	}
+}
+
+func TestRedeliveries(t *testing.T) {
+	if got := redeliveries(transmit(t, amqp.NewMessage([]byte("x")))); got != 0 {
+		t.Errorf("expected 0 redeliveries without a header, got %d", got)
+	}
+
+	redelivered := amqp.NewMessage([]byte("x"))
+	redelivered.Header = &amqp.MessageHeader{DeliveryCount: 3}
+	if got := redeliveries(transmit(t, redelivered)); got != 3 {
+		t.Errorf("expected 3 redeliveries, got %d", got)
+	}
+}
+
+func TestMessagePriority_RoundTrip(t *testing.T) {
+	msg := gokyu.NewMessage([]byte("urgent"))
+	msg.Priority = 8
+	if got := roundTrip(t, newAMQPMessage(msg)); got.Priority != 8 {
+		t.Errorf("expected priority 8, got %d", got.Priority)
+	}
+	if sent := newAMQPMessage(gokyu.NewMessage(nil)); sent.Header != nil {
+		t.Errorf("expected no header for an unset priority, got %+v", sent.Header)
+	}
+}
+
+func TestNewBrowser(t *testing.T) {
+	server := amqptest.NewServer(t)
+	factory := &Factory{}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	queue := &gokyu.Config{Provider: gokyu.ProviderAmazonMQ, ConnectionString: server.URL(), Queue: "orders"}
+	if _, err := factory.NewBrowser(ctx, queue); !errors.Is(err, gokyu.ErrUnsupportedProvider) {
+		t.Errorf("NewBrowser() for a queue error = %v, want ErrUnsupportedProvider", err)
+	}
+
+	topic := &gokyu.Config{Provider: gokyu.ProviderAmazonMQ, ConnectionString: server.URL(), Topic: "orders", Subscription: "billing"}
+	browser, err := factory.NewBrowser(ctx, topic)
+	if err != nil {
+		t.Fatalf("NewBrowser() error = %v", err)
+	}
+	pub, err := factory.NewPublisher(ctx, topic)
+	if err != nil {
+		t.Fatalf("NewPublisher() error = %v", err)
+	}
+	defer pub.Close(ctx)
+
+	if err := pub.Publish(ctx, gokyu.NewMessage([]byte("order"))); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	msg, err := browser.Browse(ctx)
+	if err != nil || string(msg.Body) != "order" {
+		t.Fatalf("Browse() = %v, %v", msg, err)
+	}
+	if n := server.Attaches("Consumer.billing.VirtualTopic.orders"); n != 0 {
+		t.Errorf("%d attaches to the billing subscription, want the browser on its own", n)
+	}
+
+	// Unsettled messages would be requeued when the browser detaches
+	if err := browser.Close(ctx); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if n := server.Depth("topic://orders"); n != 0 {
+		t.Errorf("%d messages left at the topic, want the browsed copy settled", n)
+	}
+}
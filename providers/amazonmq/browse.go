@@ -0,0 +1,54 @@
+package amazonmq
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/venderneutral/gokyu"
+)
+
+// NewBrowser creates a browser for the configured topic. It attaches its own
+// non-durable subscription to the topic, so it sees the messages published
+// while it is open and consumes only its own copies of them. ActiveMQ can
+// browse queues only with the AMQP copy distribution mode, which go-amqp
+// cannot request, so queues are not supported.
+func (f *Factory) NewBrowser(ctx context.Context, cfg *gokyu.Config) (gokyu.Browser, error) {
+	if cfg.Queue != "" {
+		return nil, fmt.Errorf("%w: %s cannot browse queues", gokyu.ErrUnsupportedProvider, cfg.Provider)
+	}
+
+	// Without a subscription the source is the topic itself
+	own := *cfg
+	own.Subscription = ""
+	own.Redelivery = nil
+	source, err := own.ExpandAddress(own.AddressTemplate, buildSourceAddress(&own))
+	if err != nil {
+		return nil, gokyu.ErrInvalidConfig(err.Error())
+	}
+	sub, err := newSubscriber(ctx, &own, source)
+	if err != nil {
+		return nil, err
+	}
+	return &browser{sub: sub}, nil
+}
+
+// browser implements gokyu.Browser by acknowledging the messages of a
+// subscription only it receives from.
+type browser struct {
+	sub gokyu.Subscriber
+}
+
+func (b *browser) Browse(ctx context.Context) (*gokyu.Message, error) {
+	msg, err := b.sub.Receive(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.sub.Ack(ctx, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (b *browser) Close(ctx context.Context) error {
+	return b.sub.Close(ctx)
+}
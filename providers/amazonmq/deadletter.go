@@ -0,0 +1,21 @@
+package amazonmq
+
+import (
+	"context"
+
+	"github.com/venderneutral/gokyu"
+)
+
+// DefaultDeadLetterQueue is the shared dead-letter queue of ActiveMQ. Brokers
+// with an individual dead-letter strategy use per-destination queues such as
+// "DLQ.<queue>"; set Config.DeadLetterQueue for those.
+const DefaultDeadLetterQueue = "ActiveMQ.DLQ"
+
+// NewDeadLetterSubscriber creates a subscriber for the dead-letter queue.
+func (f *Factory) NewDeadLetterSubscriber(ctx context.Context, cfg *gokyu.Config) (gokyu.Subscriber, error) {
+	source := cfg.DeadLetterQueue
+	if source == "" {
+		source = DefaultDeadLetterQueue
+	}
+	return newSubscriber(ctx, cfg, source)
+}
@@ -0,0 +1,169 @@
+package amazonmq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+	"github.com/venderneutral/gokyu/internal/awsv4"
+)
+
+// Credentials are AWS credentials used to sign requests to the Amazon MQ API.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// CredentialsFromEnv returns the credentials in the AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables.
+func CredentialsFromEnv() Credentials {
+	return Credentials{
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+}
+
+// Discovery resolves the AMQP endpoints of an Amazon MQ broker with the
+// DescribeBroker API. Active/standby brokers have one endpoint per instance
+// and only the active instance accepts connections, so setting a Discovery
+// as gokyu.Config.Endpoints makes every new connection fail over to
+// whichever instance is active. It implements gokyu.EndpointResolver.
+type Discovery struct {
+	// BrokerID is the ID of the broker, e.g. "b-1234a5b6-78cd-901e-2fgh-3i45j6k178l9".
+	BrokerID string
+
+	// Region is the AWS region of the broker (default: $AWS_REGION).
+	Region string
+
+	// Credentials sign API requests (default: CredentialsFromEnv).
+	Credentials *Credentials
+
+	// Endpoint overrides the API base URL (default: https://mq.<region>.amazonaws.com).
+	Endpoint string
+
+	// RefreshInterval is how long resolved endpoints are reused before the
+	// API is called again (default: 1m).
+	RefreshInterval time.Duration
+
+	// HTTPClient sends API requests (default: a client with a 10s timeout).
+	HTTPClient *http.Client
+
+	// Clock is the time source for signing and caching (default: gokyu.SystemClock).
+	Clock gokyu.Clock
+
+	mu        sync.Mutex
+	endpoints []string
+	fetched   time.Time
+}
+
+// describeBrokerResponse is the part of the DescribeBroker response used
+// for discovery.
+type describeBrokerResponse struct {
+	BrokerState     string `json:"brokerState"`
+	BrokerInstances []struct {
+		Endpoints []string `json:"endpoints"`
+	} `json:"brokerInstances"`
+}
+
+// Endpoints returns the AMQP endpoints of the broker instances. Results are
+// cached for RefreshInterval; if the API cannot be reached, the last known
+// endpoints are returned.
+func (d *Discovery) Endpoints(ctx context.Context) ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	clock := d.Clock
+	if clock == nil {
+		clock = gokyu.SystemClock
+	}
+	refresh := d.RefreshInterval
+	if refresh <= 0 {
+		refresh = time.Minute
+	}
+	if d.endpoints != nil && clock.Now().Sub(d.fetched) < refresh {
+		return d.endpoints, nil
+	}
+
+	endpoints, err := d.describe(ctx, clock.Now())
+	if err != nil {
+		if d.endpoints != nil {
+			return d.endpoints, nil
+		}
+		return nil, err
+	}
+	d.endpoints = endpoints
+	d.fetched = clock.Now()
+	return endpoints, nil
+}
+
+// describe calls DescribeBroker and extracts the AMQP endpoints.
+func (d *Discovery) describe(ctx context.Context, now time.Time) ([]string, error) {
+	if d.BrokerID == "" {
+		return nil, gokyu.ErrInvalidConfig("amazon mq broker id is required")
+	}
+	region := d.Region
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		return nil, gokyu.ErrInvalidConfig("amazon mq region is required")
+	}
+	creds := CredentialsFromEnv()
+	if d.Credentials != nil {
+		creds = *d.Credentials
+	}
+	base := d.Endpoint
+	if base == "" {
+		base = "https://mq." + region + ".amazonaws.com"
+	}
+	client := d.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"/v1/brokers/"+url.PathEscape(d.BrokerID), nil)
+	if err != nil {
+		return nil, err
+	}
+	awsv4.Sign(req, nil, awsv4.Credentials(creds), region, "mq", now)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("amazonmq: describe broker: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("amazonmq: describe broker: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("amazonmq: describe broker: %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var broker describeBrokerResponse
+	if err := json.Unmarshal(body, &broker); err != nil {
+		return nil, fmt.Errorf("amazonmq: describe broker: %w", err)
+	}
+	var endpoints []string
+	for _, instance := range broker.BrokerInstances {
+		for _, endpoint := range instance.Endpoints {
+			if strings.HasPrefix(endpoint, "amqp+ssl://") || strings.HasPrefix(endpoint, "amqps://") {
+				endpoints = append(endpoints, endpoint)
+			}
+		}
+	}
+	if len(endpoints) == 0 {
+		return nil, fmt.Errorf("amazonmq: broker %s (%s) has no AMQP endpoints", d.BrokerID, broker.BrokerState)
+	}
+	return endpoints, nil
+}
@@ -0,0 +1,90 @@
+package amazonmq
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+)
+
+func TestDiscovery_Endpoints(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.URL.Path != "/v1/brokers/b-123" {
+			http.NotFound(w, r)
+			return
+		}
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+			http.Error(w, "unsigned", http.StatusForbidden)
+			return
+		}
+		if r.Header.Get("X-Amz-Security-Token") != "token" {
+			http.Error(w, "missing token", http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(`{"brokerState": "RUNNING", "brokerInstances": [
+			{"endpoints": ["ssl://b-123-1.mq.eu-west-1.amazonaws.com:61617", "amqp+ssl://b-123-1.mq.eu-west-1.amazonaws.com:5671"]},
+			{"endpoints": ["ssl://b-123-2.mq.eu-west-1.amazonaws.com:61617", "amqp+ssl://b-123-2.mq.eu-west-1.amazonaws.com:5671"]}
+		]}`))
+	}))
+	defer srv.Close()
+
+	clock := gokyu.NewFakeClock(time.Now())
+	discovery := &Discovery{
+		BrokerID:    "b-123",
+		Region:      "eu-west-1",
+		Credentials: &Credentials{AccessKeyID: "AKID", SecretAccessKey: "secret", SessionToken: "token"},
+		Endpoint:    srv.URL,
+		Clock:       clock,
+	}
+
+	got, err := discovery.Endpoints(context.Background())
+	if err != nil {
+		t.Fatalf("Endpoints() error = %v", err)
+	}
+	want := []string{
+		"amqp+ssl://b-123-1.mq.eu-west-1.amazonaws.com:5671",
+		"amqp+ssl://b-123-2.mq.eu-west-1.amazonaws.com:5671",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Endpoints() = %v, want %v", got, want)
+	}
+
+	discovery.Endpoints(context.Background())
+	if calls.Load() != 1 {
+		t.Errorf("API called %d times within the refresh interval, want 1", calls.Load())
+	}
+
+	// Stale endpoints are served when the API is unreachable
+	clock.Advance(2 * time.Minute)
+	srv.Close()
+	if got, err := discovery.Endpoints(context.Background()); err != nil || len(got) != 2 {
+		t.Errorf("Endpoints() after API failure = %v, %v, want cached endpoints", got, err)
+	}
+}
+
+func TestDiscovery_Errors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message": "broker not found"}`, http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	discovery := &Discovery{BrokerID: "b-404", Region: "eu-west-1", Credentials: &Credentials{}, Endpoint: srv.URL}
+	if _, err := discovery.Endpoints(context.Background()); err == nil || !strings.Contains(err.Error(), "broker not found") {
+		t.Errorf("Endpoints() error = %v, want the API error", err)
+	}
+
+	discovery = &Discovery{Region: "eu-west-1"}
+	if _, err := discovery.Endpoints(context.Background()); err == nil {
+		t.Error("Endpoints() without a broker id succeeded")
+	}
+}
+
+var _ gokyu.EndpointResolver = (*Discovery)(nil)
@@ -0,0 +1,25 @@
+package amazonmq
+
+// FaultPoint identifies a place in the provider where a failure can be
+// injected for resilience testing. Injection is only available in binaries
+// built with the gokyufaults build tag; otherwise fault points are no-ops.
+type FaultPoint string
+
+// Fault points.
+const (
+	// FaultAttach fails sender and receiver link attach, in NewPublisher
+	// and NewSubscriber and when a detached link is attached again, as when
+	// the broker refuses the link.
+	FaultAttach FaultPoint = "attach"
+
+	// FaultSend fails a send on the sender link, as when a send times out.
+	// Injected link errors are recovered like real ones: the link is
+	// attached again and the send retried once.
+	FaultSend FaultPoint = "send"
+
+	// FaultReceive fails a receive on the receiver link, by default with a
+	// forced detach. The link is attached again and the receive retried
+	// once, so a single fault is recovered within Receive while two in a
+	// row fail it.
+	FaultReceive FaultPoint = "receive"
+)
@@ -0,0 +1,85 @@
+//go:build gokyufaults
+
+package amazonmq
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-amqp"
+	"github.com/venderneutral/gokyu"
+	"github.com/venderneutral/gokyu/internal/amqptest"
+)
+
+func TestInjectFault(t *testing.T) {
+	server := amqptest.NewServer(t)
+	cfg := &gokyu.Config{Provider: gokyu.ProviderAmazonMQ, ConnectionString: server.URL(), Queue: "orders"}
+	factory := &Factory{}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	defer ClearFaults()
+
+	InjectFault(FaultAttach, nil, 1)
+	if _, err := factory.NewSubscriber(ctx, cfg); !errors.Is(err, gokyu.ErrConnectionFailed) {
+		t.Fatalf("NewSubscriber() with an attach fault error = %v, want ErrConnectionFailed", err)
+	}
+	sub, err := factory.NewSubscriber(ctx, cfg)
+	if err != nil {
+		t.Fatalf("NewSubscriber() error = %v", err)
+	}
+	defer sub.Close(ctx)
+	pub, err := factory.NewPublisher(ctx, cfg)
+	if err != nil {
+		t.Fatalf("NewPublisher() error = %v", err)
+	}
+	defer pub.Close(ctx)
+
+	// A send timeout is not recovered
+	InjectFault(FaultSend, nil, 1)
+	if err := pub.Publish(ctx, gokyu.NewMessage([]byte("lost"))); !errors.Is(err, gokyu.ErrPublishFailed) || !strings.Contains(err.Error(), "deadline exceeded") {
+		t.Errorf("Publish() with a send fault error = %v, want a timeout", err)
+	}
+
+	// A detached sender is attached again
+	InjectFault(FaultSend, &amqp.LinkError{RemoteErr: &amqp.Error{Condition: amqp.ErrCondDetachForced}}, 1)
+	msg := gokyu.NewMessage([]byte("order"))
+	msg.ID = "o-1"
+	if err := pub.Publish(ctx, msg); err != nil {
+		t.Fatalf("Publish() after a detach error = %v", err)
+	}
+	if n := server.Attaches("orders"); n != 3 {
+		t.Errorf("%d attaches to orders, want the subscriber, the publisher and its reattach", n)
+	}
+
+	// A forced detach of the receiver is recovered within Receive
+	InjectFault(FaultReceive, nil, 1)
+	got, err := sub.Receive(ctx)
+	if err != nil {
+		t.Fatalf("Receive() after a forced detach error = %v", err)
+	}
+	if got.ID != "o-1" {
+		t.Errorf("received %q, want o-1", got.ID)
+	}
+	if err := sub.Ack(ctx, got); err != nil {
+		t.Errorf("Ack() error = %v", err)
+	}
+	if n := server.Attaches("orders"); n != 4 {
+		t.Errorf("%d attaches to orders, want the receiver attached again", n)
+	}
+
+	// Two detaches in a row fail Receive
+	InjectFault(FaultReceive, nil, 2)
+	if _, err := sub.Receive(ctx); !errors.Is(err, gokyu.ErrReceiveFailed) || !strings.Contains(err.Error(), string(amqp.ErrCondDetachForced)) {
+		t.Errorf("Receive() after two detaches error = %v, want a forced detach", err)
+	}
+
+	// A refused reattach fails Receive with the detach
+	InjectFault(FaultReceive, nil, 1)
+	InjectFault(FaultAttach, nil, 1)
+	if _, err := sub.Receive(ctx); !errors.Is(err, gokyu.ErrReceiveFailed) {
+		t.Errorf("Receive() with a refused reattach error = %v, want ErrReceiveFailed", err)
+	}
+}
@@ -0,0 +1,143 @@
+package amazonmq
+
+import (
+	"mime"
+	"strings"
+
+	"github.com/Azure/go-amqp"
+	"github.com/venderneutral/gokyu"
+)
+
+// Message properties holding JMS headers when Config.JMSInterop is set.
+const (
+	PropertyJMSType          = "JMSType"
+	PropertyJMSCorrelationID = "JMSCorrelationID"
+	PropertyJMSReplyTo       = "JMSReplyTo"
+
+	// PropertyJMSMessageType is set on received messages to the JMS message
+	// type of the sender (JMSTextMessage, JMSBytesMessage, ...).
+	PropertyJMSMessageType = "JMSMessageType"
+)
+
+// JMS message types reported in PropertyJMSMessageType.
+const (
+	JMSMessage       = "message"
+	JMSObjectMessage = "object"
+	JMSMapMessage    = "map"
+	JMSBytesMessage  = "bytes"
+	JMSStreamMessage = "stream"
+	JMSTextMessage   = "text"
+)
+
+// jmsMsgTypeAnnotation is the message annotation ActiveMQ uses to record the
+// JMS message type, as defined by the AMQP JMS mapping.
+const jmsMsgTypeAnnotation = "x-opt-jms-msg-type"
+
+// jmsMessageTypes maps x-opt-jms-msg-type values to JMS message types.
+var jmsMessageTypes = map[int8]string{
+	0: JMSMessage,
+	1: JMSObjectMessage,
+	2: JMSMapMessage,
+	3: JMSBytesMessage,
+	4: JMSStreamMessage,
+	5: JMSTextMessage,
+}
+
+// jmsHeaders are the properties moved to AMQP message properties on publish.
+var jmsHeaders = []string{PropertyJMSType, PropertyJMSCorrelationID, PropertyJMSReplyTo, PropertyJMSMessageType}
+
+// fromJMS maps JMS conventions of a received message to msg: TextMessage
+// bodies become Body, and JMSType, JMSCorrelationID and JMSReplyTo become
+// properties.
+func fromJMS(amqpMsg *amqp.Message, msg *gokyu.Message) {
+	if msgType, ok := amqpMsg.Annotations[jmsMsgTypeAnnotation].(int8); ok {
+		if name, ok := jmsMessageTypes[msgType]; ok {
+			msg.Properties[PropertyJMSMessageType] = name
+		}
+	}
+
+	// TextMessages are sent as an amqp-value holding a string
+	if text, ok := amqpMsg.Value.(string); ok {
+		msg.Body = []byte(text)
+		msg.BodyValue = nil
+		if msg.ContentType == "" {
+			msg.ContentType = "text/plain; charset=utf-8"
+		}
+	}
+
+	props := amqpMsg.Properties
+	if props == nil {
+		return
+	}
+	if props.Subject != nil {
+		msg.Properties[PropertyJMSType] = *props.Subject
+	}
+	if id, ok := props.CorrelationID.(string); ok {
+		msg.Properties[PropertyJMSCorrelationID] = id
+	}
+	if props.ReplyTo != nil {
+		msg.Properties[PropertyJMSReplyTo] = *props.ReplyTo
+	}
+}
+
+// toJMS maps msg to JMS conventions: text bodies are sent as TextMessages,
+// other bodies as BytesMessages, and JMS header properties move to the
+// corresponding AMQP message properties.
+func toJMS(msg *gokyu.Message, amqpMsg *amqp.Message) {
+	if msg.BodyValue == nil {
+		msgType := int8(3)
+		if isText(msg.ContentType) {
+			amqpMsg.Data = nil
+			amqpMsg.Value = string(msg.Body)
+			msgType = 5
+		}
+		if amqpMsg.Annotations == nil {
+			amqpMsg.Annotations = amqp.Annotations{}
+		}
+		amqpMsg.Annotations[jmsMsgTypeAnnotation] = msgType
+	}
+
+	if !hasJMSHeaders(msg) {
+		return
+	}
+
+	// The application properties share msg.Properties, so copy them before
+	// removing the headers
+	appProps := make(map[string]interface{}, len(msg.Properties))
+	for k, v := range msg.Properties {
+		appProps[k] = v
+	}
+	for _, h := range jmsHeaders {
+		delete(appProps, h)
+	}
+	amqpMsg.ApplicationProperties = appProps
+
+	if amqpMsg.Properties == nil {
+		amqpMsg.Properties = &amqp.MessageProperties{}
+	}
+	if v, ok := msg.Properties[PropertyJMSType].(string); ok {
+		amqpMsg.Properties.Subject = &v
+	}
+	if v, ok := msg.Properties[PropertyJMSCorrelationID].(string); ok {
+		amqpMsg.Properties.CorrelationID = v
+	}
+	if v, ok := msg.Properties[PropertyJMSReplyTo].(string); ok {
+		amqpMsg.Properties.ReplyTo = &v
+	}
+}
+
+// hasJMSHeaders reports whether msg carries any JMS header property.
+func hasJMSHeaders(msg *gokyu.Message) bool {
+	for _, h := range jmsHeaders {
+		if _, ok := msg.Properties[h]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isText reports whether contentType denotes a text body.
+func isText(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && strings.HasPrefix(mediaType, "text/")
+}
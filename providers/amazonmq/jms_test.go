@@ -0,0 +1,84 @@
+package amazonmq
+
+import (
+	"testing"
+
+	"github.com/Azure/go-amqp"
+	"github.com/venderneutral/gokyu"
+)
+
+// jmsRoundTrip sends msg with JMS interop and decodes it as if received.
+func jmsRoundTrip(t *testing.T, msg *gokyu.Message) (*amqp.Message, *gokyu.Message) {
+	t.Helper()
+	sent := newAMQPMessage(msg)
+	toJMS(msg, sent)
+	received := transmit(t, sent)
+	got := newMessage(received)
+	fromJMS(received, got)
+	return received, got
+}
+
+func TestJMS_TextMessage(t *testing.T) {
+	msg := gokyu.NewMessage([]byte("hello"))
+	msg.ContentType = "text/plain"
+
+	received, got := jmsRoundTrip(t, msg)
+
+	if v, ok := received.Value.(string); !ok || v != "hello" {
+		t.Errorf("expected amqp-value string body, got %#v", received.Value)
+	}
+	if string(got.Body) != "hello" || got.BodyValue != nil {
+		t.Errorf("expected body hello, got %q (value %#v)", got.Body, got.BodyValue)
+	}
+	if got.Properties[PropertyJMSMessageType] != JMSTextMessage {
+		t.Errorf("expected text message type, got %v", got.Properties[PropertyJMSMessageType])
+	}
+}
+
+func TestJMS_BytesMessage(t *testing.T) {
+	received, got := jmsRoundTrip(t, gokyu.NewMessage([]byte{0x01, 0x02}))
+
+	if len(received.Data) != 1 {
+		t.Errorf("expected data body, got %#v", received)
+	}
+	if string(got.Body) != "\x01\x02" {
+		t.Errorf("expected body preserved, got %q", got.Body)
+	}
+	if got.Properties[PropertyJMSMessageType] != JMSBytesMessage {
+		t.Errorf("expected bytes message type, got %v", got.Properties[PropertyJMSMessageType])
+	}
+}
+
+func TestJMS_Headers(t *testing.T) {
+	msg := gokyu.NewMessage([]byte("x"))
+	msg.Properties[PropertyJMSType] = "OrderCreated"
+	msg.Properties[PropertyJMSCorrelationID] = "corr-1"
+	msg.Properties[PropertyJMSReplyTo] = "queue://replies"
+	msg.Properties["tenant"] = "acme"
+
+	sent := newAMQPMessage(msg)
+	toJMS(msg, sent)
+	if _, ok := sent.ApplicationProperties[PropertyJMSType]; ok {
+		t.Error("expected JMSType moved out of application properties")
+	}
+	if sent.Properties.Subject == nil || *sent.Properties.Subject != "OrderCreated" {
+		t.Errorf("expected subject OrderCreated, got %v", sent.Properties.Subject)
+	}
+	if _, ok := msg.Properties[PropertyJMSType]; !ok {
+		t.Error("expected published message properties unchanged")
+	}
+
+	_, got := jmsRoundTrip(t, msg)
+
+	want := map[string]interface{}{
+		PropertyJMSType:          "OrderCreated",
+		PropertyJMSCorrelationID: "corr-1",
+		PropertyJMSReplyTo:       "queue://replies",
+		"tenant":                 "acme",
+	}
+	for k, v := range want {
+		if got.Properties[k] != v {
+			t.Errorf("expected property %s=%v, got %v", k, v, got.Properties[k])
+		}
+	}
+}
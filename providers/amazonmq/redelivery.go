@@ -0,0 +1,88 @@
+package amazonmq
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/go-amqp"
+	"github.com/venderneutral/gokyu"
+)
+
+// redeliveries returns how often a message has been redelivered. ActiveMQ
+// reports its redelivery counter as the AMQP delivery count.
+func redeliveries(amqpMsg *amqp.Message) int {
+	if amqpMsg.Header == nil {
+		return 0
+	}
+	return int(amqpMsg.Header.DeliveryCount)
+}
+
+// redeliver settles a nacked message according to the redelivery policy.
+// Messages over the redelivery limit are rejected, which makes ActiveMQ
+// dead-letter them. Others are held for the policy's delay and then
+// released as failed deliveries, so the broker counts the redelivery.
+func (s *subscriber) redeliver(ctx context.Context, msg *gokyu.Message, amqpMsg *amqp.Message) error {
+	n := redeliveries(amqpMsg)
+	if s.redelivery.Exhausted(n) {
+		reason := fmt.Errorf("redelivery limit of %d exceeded", s.redelivery.MaxRedeliveries)
+		receiver, _ := s.link()
+		err := receiver.RejectMessage(ctx, amqpMsg, &amqp.Error{
+			Condition:   amqp.ErrCondInternalError,
+			Description: reason.Error(),
+		})
+		if err != nil {
+			return gokyu.WrapError(gokyu.ErrAckFailed, err)
+		}
+		s.settled(amqpMsg)
+		gokyu.ReportDeadLetter(s.cfg, msg, gokyu.NewFailureRecord(msg, reason, "amazonmq", n+1, s.redelivery.Clock.Now()))
+		gokyu.EmitEvent(s.cfg, gokyu.Event{Type: gokyu.EventRetryExhausted, Message: msg, Err: reason})
+		return nil
+	}
+
+	timer := s.redelivery.Clock.NewTimer(s.redelivery.Delay(n))
+	s.delayMu.Lock()
+	s.delayed[amqpMsg] = timer
+	s.delayMu.Unlock()
+
+	go func() {
+		select {
+		case <-timer.C():
+			s.release(context.Background(), amqpMsg)
+		case <-s.done:
+			// Close releases the remaining messages
+		}
+	}()
+	return nil
+}
+
+// release releases a delayed message as a failed delivery. A link that
+// failed in the meantime has already returned the message to the broker,
+// so settlement errors are ignored.
+func (s *subscriber) release(ctx context.Context, amqpMsg *amqp.Message) {
+	s.delayMu.Lock()
+	_, ok := s.delayed[amqpMsg]
+	delete(s.delayed, amqpMsg)
+	s.delayMu.Unlock()
+	if !ok {
+		return
+	}
+
+	receiver, _ := s.link()
+	_ = receiver.ModifyMessage(ctx, amqpMsg, &amqp.ModifyMessageOptions{DeliveryFailed: true})
+	s.settled(amqpMsg)
+}
+
+// releaseDelayed releases all delayed messages immediately.
+func (s *subscriber) releaseDelayed(ctx context.Context) {
+	s.delayMu.Lock()
+	pending := make([]*amqp.Message, 0, len(s.delayed))
+	for amqpMsg, timer := range s.delayed {
+		timer.Stop()
+		pending = append(pending, amqpMsg)
+	}
+	s.delayMu.Unlock()
+
+	for _, amqpMsg := range pending {
+		s.release(ctx, amqpMsg)
+	}
+}
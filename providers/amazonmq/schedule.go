@@ -0,0 +1,59 @@
+package amazonmq
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+)
+
+// scheduledDelayProperty is the ActiveMQ message property that delays
+// delivery by the given number of milliseconds. It requires the broker
+// scheduler to be enabled (schedulerSupport="true").
+const scheduledDelayProperty = "AMQ_SCHEDULED_DELAY"
+
+// Schedule publishes a message with an ActiveMQ scheduled delay and returns a
+// token that can be used to cancel it.
+func (p *publisher) Schedule(ctx context.Context, msg *gokyu.Message, at time.Time) (string, error) {
+	token := randomID()
+
+	scheduled := *msg
+	scheduled.Properties = make(map[string]interface{}, len(msg.Properties)+2)
+	for k, v := range msg.Properties {
+		scheduled.Properties[k] = v
+	}
+	scheduled.Properties[gokyu.PropertyScheduleToken] = token
+	if delay := time.Until(at); delay > 0 {
+		scheduled.Properties[scheduledDelayProperty] = delay.Milliseconds()
+	}
+
+	if err := p.Publish(ctx, &scheduled); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// CancelScheduled publishes a tombstone for the scheduled message. ActiveMQ
+// offers no AMQP operation to remove scheduled messages, so consumers must
+// wrap their subscriber with gokyu.NewTombstoneSubscriber to drop it. The
+// cancellation is best-effort: a consumer that did not receive the
+// tombstone, such as a competing or restarted one, still delivers the
+// message.
+func (p *publisher) CancelScheduled(ctx context.Context, token string) error {
+	tombstone := gokyu.NewMessage(nil)
+	tombstone.Properties[gokyu.PropertyTombstone] = token
+
+	if err := p.Publish(ctx, tombstone); err != nil {
+		return gokyu.WrapError(gokyu.ErrCancelFailed, err)
+	}
+	return nil
+}
+
+// randomID returns a random hex identifier.
+func randomID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -18,6 +18,42 @@
 // The subscription path is automatically constructed by this package
 // when you provide Topic and Subscription in the configuration.
 //
+// # Scheduled Messages
+//
+// The publisher implements gokyu.ScheduledPublisher using the Service Bus
+// management operations. Schedule returns the sequence number assigned by
+// the broker, which CancelScheduled uses to revoke the message.
+//
+// # Browsing
+//
+// Factory.NewBrowser peeks at the queue or subscription with the
+// peek-message management operation, which neither locks messages nor
+// increments their delivery count.
+//
+// # Anonymous Relay
+//
+// Factory.NewRelayPublisher attaches a sender link with a null target and
+// names the entity of each message in its AMQP "to" property, so one link
+// can send to every queue and topic in the namespace. Set
+// gokyu.Config.AnonymousRelay to use it for gokyu.Router and
+// gokyu.TenantPublisher.
+//
+// # WebSockets
+//
+// With gokyu.Config.WebSocket set, connections tunnel AMQP over a WebSocket
+// to wss://<namespace>:443/$servicebus/websocket, for networks that block
+// port 5671.
+//
+// # Fault Injection
+//
+// Test binaries built with the gokyufaults build tag can force failures at
+// link attach, send and receive to exercise application resilience:
+//
+//	azure.InjectFault(azure.FaultReceive, nil, 2) // next Receive fails despite reattaching
+//	defer azure.ClearFaults()
+//
+// Without the tag the fault points compile to no-ops.
+//
 // # Usage
 //
 // Import this package to register the Azure provider:
@@ -28,6 +64,9 @@ package azure
 import (
 	"context"
 	"fmt"
+	"net/url"
+	"sync"
+	"time"
 
 	"github.com/Azure/go-amqp"
 	"github.com/venderneutral/gokyu"
@@ -40,9 +79,54 @@ func init() {
 // Factory creates Azure Service Bus publishers and subscribers.
 type Factory struct{}
 
+// Capabilities reports native scheduling. Service Bus has no message
+// priority.
+func (f *Factory) Capabilities() gokyu.Capabilities {
+	return gokyu.Capabilities{Scheduling: gokyu.Native}
+}
+
+// Guarantees describes the delivery guarantees of Service Bus.
+func (f *Factory) Guarantees() gokyu.Guarantees {
+	return gokyu.Guarantees{
+		Delivery:       gokyu.AtLeastOnce,
+		Ordering:       gokyu.OrderingNone,
+		Deduplication:  gokyu.Native,
+		MaxMessageSize: 256 << 10,
+		Notes: []string{
+			"deduplication requires duplicate detection on the queue or topic",
+			"ordered delivery requires message sessions",
+			"premium namespaces accept messages of up to 100 MiB",
+		},
+	}
+}
+
+// Ping connects to the namespace, authenticates and disconnects.
+func (f *Factory) Ping(ctx context.Context, cfg *gokyu.Config) error {
+	conn, err := dial(ctx, cfg)
+	if err != nil {
+		return gokyu.WrapError(gokyu.ErrConnectionFailed, err)
+	}
+	return conn.Close()
+}
+
 // NewPublisher creates a new Azure Service Bus publisher.
 func (f *Factory) NewPublisher(ctx context.Context, cfg *gokyu.Config) (gokyu.Publisher, error) {
-	conn, err := amqp.Dial(ctx, cfg.BuildConnectionString(), nil)
+	// Determine destination (topic or queue)
+	destination, err := cfg.ExpandAddress(cfg.PublishAddressTemplate, buildDestinationAddress(cfg))
+	if err != nil {
+		return nil, gokyu.ErrInvalidConfig(err.Error())
+	}
+	pub, err := newPublisher(ctx, cfg, destination)
+	if err != nil {
+		return nil, err
+	}
+	return pub, nil
+}
+
+// newPublisher creates a publisher sending to destination, or an anonymous
+// relay sender with a null target if destination is empty.
+func newPublisher(ctx context.Context, cfg *gokyu.Config, destination string) (*publisher, error) {
+	conn, err := dial(ctx, cfg)
 	if err != nil {
 		return nil, gokyu.WrapError(gokyu.ErrConnectionFailed, err)
 	}
@@ -53,10 +137,10 @@ func (f *Factory) NewPublisher(ctx context.Context, cfg *gokyu.Config) (gokyu.Pu
 		return nil, gokyu.WrapError(gokyu.ErrConnectionFailed, err)
 	}
 
-	// Determine destination (topic or queue)
-	destination := cfg.Topic
-	if destination == "" {
-		destination = cfg.Queue
+	if err := injectFault(FaultAttach); err != nil {
+		session.Close(ctx)
+		conn.Close()
+		return nil, gokyu.WrapError(gokyu.ErrConnectionFailed, err)
 	}
 
 	sender, err := session.NewSender(ctx, destination, nil)
@@ -66,16 +150,30 @@ func (f *Factory) NewPublisher(ctx context.Context, cfg *gokyu.Config) (gokyu.Pu
 		return nil, gokyu.WrapError(gokyu.ErrConnectionFailed, err)
 	}
 
-	return &publisher{
-		conn:    conn,
-		session: session,
-		sender:  sender,
-	}, nil
+	pub := &publisher{
+		conn:        conn,
+		session:     session,
+		sender:      sender,
+		destination: destination,
+	}
+	pub.unregister = gokyu.RegisterDiagnostics("azure-publisher", pub.diagnostics)
+
+	return pub, nil
 }
 
 // NewSubscriber creates a new Azure Service Bus subscriber.
 func (f *Factory) NewSubscriber(ctx context.Context, cfg *gokyu.Config) (gokyu.Subscriber, error) {
-	conn, err := amqp.Dial(ctx, cfg.BuildConnectionString(), nil)
+	// Build the source address
+	source, err := cfg.ExpandAddress(cfg.AddressTemplate, buildSourceAddress(cfg))
+	if err != nil {
+		return nil, gokyu.ErrInvalidConfig(err.Error())
+	}
+	return newSubscriber(ctx, cfg, source)
+}
+
+// newSubscriber creates a subscriber receiving from source.
+func newSubscriber(ctx context.Context, cfg *gokyu.Config, source string) (gokyu.Subscriber, error) {
+	conn, err := dial(ctx, cfg)
 	if err != nil {
 		return nil, gokyu.WrapError(gokyu.ErrConnectionFailed, err)
 	}
@@ -86,21 +184,124 @@ func (f *Factory) NewSubscriber(ctx context.Context, cfg *gokyu.Config) (gokyu.S
 		return nil, gokyu.WrapError(gokyu.ErrConnectionFailed, err)
 	}
 
-	// Build the source address
-	source := buildSourceAddress(cfg)
+	if err := injectFault(FaultAttach); err != nil {
+		session.Close(ctx)
+		conn.Close()
+		return nil, gokyu.WrapError(gokyu.ErrConnectionFailed, err)
+	}
 
-	receiver, err := session.NewReceiver(ctx, source, nil)
+	receiver, err := session.NewReceiver(ctx, source, receiverOptions(cfg))
 	if err != nil {
 		session.Close(ctx)
 		conn.Close()
 		return nil, gokyu.WrapError(gokyu.ErrConnectionFailed, err)
 	}
 
-	return &subscriber{
+	sub := &subscriber{
 		conn:     conn,
 		session:  session,
 		receiver: receiver,
-	}, nil
+		source:   source,
+		cfg:      cfg,
+		identity: gokyu.NewReceiver(cfg),
+	}
+
+	if sub.prefetch, err = newPrefetchController(cfg, receiver); err != nil {
+		sub.Close(ctx)
+		return nil, gokyu.WrapError(gokyu.ErrConnectionFailed, err)
+	}
+
+	sub.unregister = gokyu.RegisterDiagnostics("azure-subscriber", sub.diagnostics)
+
+	return sub, nil
+}
+
+// receiverOptions maps the prefetch configuration to link credit. Adaptive
+// prefetch uses manual credit managed by a gokyu.PrefetchController.
+func receiverOptions(cfg *gokyu.Config) *amqp.ReceiverOptions {
+	if cfg.AdaptivePrefetch {
+		return &amqp.ReceiverOptions{Credit: -1}
+	}
+	if cfg.PrefetchCount > 0 {
+		return &amqp.ReceiverOptions{Credit: int32(cfg.PrefetchCount)}
+	}
+	return nil
+}
+
+// connOptions identifies the connection to the broker and applies the
+// connection tuning of the configuration.
+func connOptions(cfg *gokyu.Config) *amqp.ConnOptions {
+	return &amqp.ConnOptions{
+		Properties:   gokyu.ConnectionProperties(cfg),
+		MaxFrameSize: cfg.MaxFrameSize,
+		IdleTimeout:  cfg.IdleTimeout,
+		MaxSessions:  cfg.ChannelMax,
+		WriteTimeout: cfg.WriteTimeout,
+	}
+}
+
+// webSocketPath is the Service Bus endpoint for AMQP over WebSockets.
+const webSocketPath = "/$servicebus/websocket"
+
+// dial opens the AMQP connection (see gokyu.DialBroker).
+func dial(ctx context.Context, cfg *gokyu.Config) (*amqp.Conn, error) {
+	u, err := url.Parse(cfg.BuildConnectionString())
+	if err != nil {
+		return nil, err
+	}
+	creds, err := gokyu.ResolveCredentials(ctx, cfg, u)
+	if err != nil {
+		return nil, err
+	}
+	netConn, err := gokyu.DialBroker(ctx, cfg, webSocketPath)
+	if err != nil {
+		return nil, err
+	}
+
+	// amqp.Dial takes these from the URL; NewConn needs them explicitly
+	opts := connOptions(cfg)
+	opts.HostName = u.Hostname()
+	if creds != nil {
+		opts.SASLType = amqp.SASLTypePlain(creds.Username, creds.Password)
+	}
+
+	conn, err := amqp.NewConn(ctx, netConn, opts)
+	if err != nil {
+		netConn.Close()
+		return nil, err
+	}
+
+	if cfg.Events != nil {
+		addr := netConn.RemoteAddr().String()
+		gokyu.EmitEvent(cfg, gokyu.Event{Type: gokyu.EventConnected, Detail: addr})
+		go func() {
+			<-conn.Done()
+			gokyu.EmitEvent(cfg, gokyu.Event{Type: gokyu.EventDisconnected, Detail: addr, Err: conn.Err()})
+		}()
+	}
+	return conn, nil
+}
+
+// newPrefetchController starts an adaptive prefetch controller for receiver,
+// or returns nil if adaptive prefetch is disabled.
+func newPrefetchController(cfg *gokyu.Config, receiver *amqp.Receiver) (*gokyu.PrefetchController, error) {
+	if !cfg.AdaptivePrefetch {
+		return nil, nil
+	}
+	prefetch := gokyu.NewPrefetchController(1, cfg.PrefetchCount, cfg.PrefetchLatencyTarget, receiver.IssueCredit)
+	if err := prefetch.Start(); err != nil {
+		return nil, err
+	}
+	return prefetch, nil
+}
+
+// buildDestinationAddress constructs the AMQP address for Azure Service Bus:
+// the topic, or the queue if no topic is set.
+func buildDestinationAddress(cfg *gokyu.Config) string {
+	if cfg.Topic != "" {
+		return cfg.Topic
+	}
+	return cfg.Queue
 }
 
 // buildSourceAddress constructs the AMQP source address for Azure Service Bus.
@@ -112,38 +313,58 @@ func buildSourceAddress(cfg *gokyu.Config) string {
 	return fmt.Sprintf("%s/Subscriptions/%s", cfg.Topic, cfg.Subscription)
 }
 
-// publisher implements gokyu.Publisher for Azure Service Bus.
+// publisher implements gokyu.Publisher and gokyu.ScheduledPublisher for Azure Service Bus.
 type publisher struct {
-	conn    *amqp.Conn
-	session *amqp.Session
-	sender  *amqp.Sender
-}
+	conn        *amqp.Conn
+	session     *amqp.Session
+	destination string
 
-func (p *publisher) Publish(ctx context.Context, msg *gokyu.Message) error {
-	amqpMsg := amqp.NewMessage(msg.Body)
+	linkMu sync.Mutex
+	sender *amqp.Sender
 
-	// Set message ID if provided
-	if msg.ID != "" {
-		amqpMsg.Properties = &amqp.MessageProperties{
-			MessageID: msg.ID,
-		}
-	}
+	mgmtMu sync.Mutex
+	mgmt   *management
 
-	// Set application properties
-	if len(msg.Properties) > 0 {
-		amqpMsg.ApplicationProperties = msg.Properties
-	}
+	unregister func()
+}
 
-	if err := p.sender.Send(ctx, amqpMsg, nil); err != nil {
+func (p *publisher) Publish(ctx context.Context, msg *gokyu.Message) error {
+	if err := p.send(ctx, newAMQPMessage(msg)); err != nil {
 		return gokyu.WrapError(gokyu.ErrPublishFailed, err)
 	}
 	return nil
 }
 
+// BrokerProperties returns the properties the broker sent on connection open.
+func (p *publisher) BrokerProperties() map[string]interface{} {
+	return p.conn.Properties()
+}
+
+// diagnostics reports the sender link state.
+func (p *publisher) diagnostics() map[string]interface{} {
+	sender := p.link()
+	return map[string]interface{}{
+		"address": sender.Address(),
+		"link":    sender.LinkName(),
+	}
+}
+
 func (p *publisher) Close(ctx context.Context) error {
+	if p.unregister != nil {
+		p.unregister()
+	}
+
 	var errs []error
 
-	if err := p.sender.Close(ctx); err != nil {
+	p.mgmtMu.Lock()
+	if p.mgmt != nil {
+		if err := p.mgmt.close(ctx); err != nil {
+			errs = append(errs, err)
+		}
+		p.mgmt = nil
+	}
+	p.mgmtMu.Unlock()
+	if err := p.link().Close(ctx); err != nil {
 		errs = append(errs, err)
 	}
 	if err := p.session.Close(ctx); err != nil {
@@ -159,38 +380,139 @@ func (p *publisher) Close(ctx context.Context) error {
 	return nil
 }
 
+// partitionKeyAnnotation carries the Service Bus partition key.
+const partitionKeyAnnotation = "x-opt-partition-key"
+
+// newAMQPMessage converts a gokyu message to an AMQP message.
+func newAMQPMessage(msg *gokyu.Message) *amqp.Message {
+	amqpMsg := amqp.NewMessage(msg.Body)
+	switch v := msg.BodyValue.(type) {
+	case nil:
+	case gokyu.BodySequence:
+		amqpMsg = &amqp.Message{Sequence: v}
+	default:
+		amqpMsg = &amqp.Message{Value: v}
+	}
+
+	// Set message ID and content type if provided
+	if msg.ID != "" || msg.ContentType != "" {
+		amqpMsg.Properties = &amqp.MessageProperties{}
+	}
+	if msg.ID != "" {
+		amqpMsg.Properties.MessageID = msg.ID
+	}
+	if msg.ContentType != "" {
+		amqpMsg.Properties.ContentType = &msg.ContentType
+	}
+
+	// Set application properties
+	if len(msg.Properties) > 0 {
+		amqpMsg.ApplicationProperties = msg.Properties
+	}
+
+	if msg.PartitionKey != "" {
+		amqpMsg.Annotations = amqp.Annotations{partitionKeyAnnotation: msg.PartitionKey}
+	}
+
+	return amqpMsg
+}
+
 // subscriber implements gokyu.Subscriber for Azure Service Bus.
 type subscriber struct {
 	conn     *amqp.Conn
 	session  *amqp.Session
+	source   string
+	cfg      *gokyu.Config
+	identity *gokyu.Receiver
+
+	linkMu   sync.Mutex
 	receiver *amqp.Receiver
+	prefetch *gokyu.PrefetchController
+
+	unregister func()
 }
 
 func (s *subscriber) Receive(ctx context.Context) (*gokyu.Message, error) {
-	amqpMsg, err := s.receiver.Receive(ctx, nil)
+	amqpMsg, err := s.receive(ctx)
 	if err != nil {
 		return nil, gokyu.WrapError(gokyu.ErrReceiveFailed, err)
 	}
 
+	msg := newMessage(amqpMsg)
+	msg.Receiver = s.identity
+
+	// Store raw message for acknowledgment
+	msg.SetRaw(amqpMsg)
+
+	if _, prefetch := s.link(); prefetch != nil {
+		prefetch.OnReceive(amqpMsg)
+	}
+
+	return msg, nil
+}
+
+// newMessage converts a received AMQP message to a gokyu message.
+func newMessage(amqpMsg *amqp.Message) *gokyu.Message {
+	// Application properties are already decoded by the AMQP client, so the
+	// map is shared rather than copied.
 	msg := &gokyu.Message{
-		Body:       amqpMsg.GetData(),
-		Properties: make(map[string]interface{}),
+		Body:       messageBody(amqpMsg),
+		Properties: amqpMsg.ApplicationProperties,
+	}
+	if msg.Properties == nil {
+		msg.Properties = make(map[string]interface{})
 	}
 
-	// Extract message ID
-	if amqpMsg.Properties != nil && amqpMsg.Properties.MessageID != nil {
-		msg.ID = fmt.Sprintf("%v", amqpMsg.Properties.MessageID)
+	// Bodies sent as amqp-value or amqp-sequence instead of binary data
+	switch {
+	case amqpMsg.Value != nil:
+		msg.BodyValue = amqpMsg.Value
+	case len(amqpMsg.Sequence) > 0:
+		msg.BodyValue = gokyu.BodySequence(amqpMsg.Sequence)
 	}
 
-	// Extract application properties
-	for k, v := range amqpMsg.ApplicationProperties {
-		msg.Properties[k] = v
+	// Extract message ID and content type
+	if amqpMsg.Properties != nil {
+		if amqpMsg.Properties.MessageID != nil {
+			msg.ID = fmt.Sprintf("%v", amqpMsg.Properties.MessageID)
+		}
+		if amqpMsg.Properties.ContentType != nil {
+			msg.ContentType = *amqpMsg.Properties.ContentType
+		}
 	}
 
-	// Store raw message for acknowledgment
-	msg.SetRaw(amqpMsg)
+	if key, ok := amqpMsg.Annotations[partitionKeyAnnotation].(string); ok {
+		msg.PartitionKey = key
+	}
 
-	return msg, nil
+	// Service Bus stamps the enqueue time as a message annotation
+	if enqueued, ok := amqpMsg.Annotations["x-opt-enqueued-time"].(time.Time); ok {
+		msg.EnqueuedTime = enqueued
+	}
+
+	return msg
+}
+
+// messageBody concatenates all data sections of a message. GetData only
+// returns the first section, but JMS BytesMessages can arrive split across
+// several.
+func messageBody(amqpMsg *amqp.Message) []byte {
+	switch len(amqpMsg.Data) {
+	case 0:
+		return nil
+	case 1:
+		return amqpMsg.Data[0]
+	}
+
+	size := 0
+	for _, part := range amqpMsg.Data {
+		size += len(part)
+	}
+	body := make([]byte, 0, size)
+	for _, part := range amqpMsg.Data {
+		body = append(body, part...)
+	}
+	return body
 }
 
 func (s *subscriber) Ack(ctx context.Context, msg *gokyu.Message) error {
@@ -198,9 +520,11 @@ func (s *subscriber) Ack(ctx context.Context, msg *gokyu.Message) error {
 	if !ok {
 		return gokyu.ErrAckFailed
 	}
-	if err := s.receiver.AcceptMessage(ctx, amqpMsg); err != nil {
+	receiver, _ := s.link()
+	if err := receiver.AcceptMessage(ctx, amqpMsg); err != nil {
 		return gokyu.WrapError(gokyu.ErrAckFailed, err)
 	}
+	s.settled(amqpMsg)
 	return nil
 }
 
@@ -210,16 +534,91 @@ func (s *subscriber) Nack(ctx context.Context, msg *gokyu.Message) error {
 		return gokyu.ErrAckFailed
 	}
 	// Release the message for redelivery
-	if err := s.receiver.ReleaseMessage(ctx, amqpMsg); err != nil {
+	receiver, _ := s.link()
+	if err := receiver.ReleaseMessage(ctx, amqpMsg); err != nil {
+		return gokyu.WrapError(gokyu.ErrAckFailed, err)
+	}
+	s.settled(amqpMsg)
+	return nil
+}
+
+// Modify abandons the message with the properties of mod, which Service
+// Bus merges into the application properties of the redelivered message.
+func (s *subscriber) Modify(ctx context.Context, msg *gokyu.Message, mod gokyu.Modification) error {
+	amqpMsg, ok := msg.Raw().(*amqp.Message)
+	if !ok {
+		return gokyu.ErrAckFailed
+	}
+	opts, err := modifyOptions(mod)
+	if err != nil {
+		return gokyu.WrapError(gokyu.ErrAckFailed, err)
+	}
+	receiver, _ := s.link()
+	if err := receiver.ModifyMessage(ctx, amqpMsg, opts); err != nil {
 		return gokyu.WrapError(gokyu.ErrAckFailed, err)
 	}
+	s.settled(amqpMsg)
 	return nil
 }
 
+// modifyOptions converts a modification to the AMQP modified outcome.
+func modifyOptions(mod gokyu.Modification) (*amqp.ModifyMessageOptions, error) {
+	props := make(map[string]interface{}, len(mod.Properties))
+	for k, v := range mod.Properties {
+		props[k] = v
+	}
+	if err := gokyu.NormalizeProperties(props, nil); err != nil {
+		return nil, err
+	}
+	opts := &amqp.ModifyMessageOptions{
+		DeliveryFailed:    mod.DeliveryFailed,
+		UndeliverableHere: mod.UndeliverableHere,
+	}
+	if len(props) > 0 {
+		opts.Annotations = make(amqp.Annotations, len(props))
+		for k, v := range props {
+			opts.Annotations[k] = v
+		}
+	}
+	return opts, nil
+}
+
+// BrokerProperties returns the properties the broker sent on connection open.
+func (s *subscriber) BrokerProperties() map[string]interface{} {
+	return s.conn.Properties()
+}
+
+// diagnostics reports the receiver link state.
+func (s *subscriber) diagnostics() map[string]interface{} {
+	receiver, prefetch := s.link()
+	state := map[string]interface{}{
+		"address": receiver.Address(),
+		"link":    receiver.LinkName(),
+	}
+	if prefetch != nil {
+		state["prefetch_window"] = prefetch.Window()
+	}
+	return state
+}
+
+// settled reports a settlement to the adaptive prefetch controller, if any.
+// Failing to issue credit means the link is gone, which the next Receive
+// reports, so the already successful settlement is not failed here.
+func (s *subscriber) settled(amqpMsg *amqp.Message) {
+	if _, prefetch := s.link(); prefetch != nil {
+		_ = prefetch.OnSettle(amqpMsg)
+	}
+}
+
 func (s *subscriber) Close(ctx context.Context) error {
+	if s.unregister != nil {
+		s.unregister()
+	}
+
 	var errs []error
 
-	if err := s.receiver.Close(ctx); err != nil {
+	receiver, _ := s.link()
+	if err := receiver.Close(ctx); err != nil {
 		errs = append(errs, err)
 	}
 	if err := s.session.Close(ctx); err != nil {
@@ -0,0 +1,220 @@
+package azure
+
+import (
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-amqp"
+	"github.com/venderneutral/gokyu"
+)
+
+// roundTrip encodes an AMQP message and decodes it as if received.
+func roundTrip(t *testing.T, amqpMsg *amqp.Message) *gokyu.Message {
+	t.Helper()
+	data, err := amqpMsg.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary() error = %v", err)
+	}
+	var received amqp.Message
+	if err := received.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary() error = %v", err)
+	}
+	return newMessage(&received)
+}
+
+func TestNewMessage_MultipleDataSections(t *testing.T) {
+	msg := roundTrip(t, &amqp.Message{Data: [][]byte{[]byte("hello, "), []byte("split "), []byte("world")}})
+	if got := string(msg.Body); got != "hello, split world" {
+		t.Errorf("expected all data sections, got %q", got)
+	}
+}
+
+func TestMessageBodies_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name      string
+		msg       *gokyu.Message
+		wantBody  string
+		wantValue interface{}
+	}{
+		{
+			name:     "data",
+			msg:      gokyu.NewMessage([]byte("payload")),
+			wantBody: "payload",
+		},
+		{
+			name:      "value",
+			msg:       &gokyu.Message{BodyValue: "text body"},
+			wantValue: "text body",
+		},
+		{
+			name:      "sequence",
+			msg:       &gokyu.Message{BodyValue: gokyu.BodySequence{{"a", int64(1)}, {true}}},
+			wantValue: gokyu.BodySequence{{"a", int64(1)}, {true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.msg.ID = "m1"
+			got := roundTrip(t, newAMQPMessage(tt.msg))
+
+			if got.ID != "m1" {
+				t.Errorf("expected ID m1, got %q", got.ID)
+			}
+			if string(got.Body) != tt.wantBody {
+				t.Errorf("expected body %q, got %q", tt.wantBody, got.Body)
+			}
+			if !reflect.DeepEqual(got.BodyValue, tt.wantValue) {
+				t.Errorf("expected body value %#v, got %#v", tt.wantValue, got.BodyValue)
+			}
+			if got.Properties == nil {
+				t.Error("expected non-nil properties")
+			}
+		})
+	}
+}
+
+func TestPartitionKey_RoundTrip(t *testing.T) {
+	msg := gokyu.NewMessage([]byte("payload"))
+	msg.PartitionKey = "customer-42"
+
+	amqpMsg := newAMQPMessage(msg)
+	if got := amqpMsg.Annotations[partitionKeyAnnotation]; got != "customer-42" {
+		t.Errorf("expected partition key annotation, got %v", got)
+	}
+	if got := roundTrip(t, amqpMsg); got.PartitionKey != "customer-42" {
+		t.Errorf("expected partition key customer-42, got %q", got.PartitionKey)
+	}
+}
+
+func TestNewRelayMessage(t *testing.T) {
+	msg := gokyu.NewMessage([]byte("hello"))
+	msg.ID = "m1"
+
+	amqpMsg := newRelayMessage(msg, "orders")
+	if amqpMsg.Properties == nil || amqpMsg.Properties.To == nil || *amqpMsg.Properties.To != "orders" {
+		t.Fatalf("expected the message to be addressed to orders, got %+v", amqpMsg.Properties)
+	}
+	if amqpMsg.Properties.MessageID != "m1" {
+		t.Errorf("expected the message ID to be kept, got %v", amqpMsg.Properties.MessageID)
+	}
+
+	if got := newRelayMessage(gokyu.NewMessage(nil), "invoices"); got.Properties == nil || *got.Properties.To != "invoices" {
+		t.Error("expected properties to be created for messages without an ID")
+	}
+}
+
+func TestConnOptions_Tuning(t *testing.T) {
+	opts := connOptions(&gokyu.Config{
+		MaxFrameSize: 1 << 20,
+		IdleTimeout:  5 * time.Minute,
+		ChannelMax:   16,
+		WriteTimeout: -1,
+	})
+	if opts.MaxFrameSize != 1<<20 || opts.IdleTimeout != 5*time.Minute || opts.MaxSessions != 16 || opts.WriteTimeout != -1 {
+		t.Errorf("connOptions() = %+v", opts)
+	}
+}
+
+func TestModifyOptions(t *testing.T) {
+	opts, err := modifyOptions(gokyu.Modification{
+		Properties:     map[string]interface{}{gokyu.PropertyFailureCount: 2, gokyu.PropertyLastError: "timeout"},
+		DeliveryFailed: true,
+	})
+	if err != nil {
+		t.Fatalf("modifyOptions() error = %v", err)
+	}
+	if !opts.DeliveryFailed || opts.UndeliverableHere {
+		t.Errorf("modifyOptions() = %+v", opts)
+	}
+	if opts.Annotations[gokyu.PropertyFailureCount] != int64(2) || opts.Annotations[gokyu.PropertyLastError] != "timeout" {
+		t.Errorf("annotations = %v", opts.Annotations)
+	}
+
+	if _, err := modifyOptions(gokyu.Modification{Properties: map[string]interface{}{"f": func() {}}}); !errors.Is(err, gokyu.ErrInvalidProperty) {
+		t.Errorf("modifyOptions() error = %v, want ErrInvalidProperty", err)
+	}
+}
+
+func TestScheduleRequests(t *testing.T) {
+	at := time.Date(2024, 3, 1, 6, 0, 0, 0, time.UTC)
+	var msgs []*gokyu.Message
+	for i := 0; i < 5; i++ {
+		msg := gokyu.NewMessage(make([]byte, 400))
+		if i > 0 {
+			msg.ID = "m-" + strconv.Itoa(i)
+		}
+		msgs = append(msgs, msg)
+	}
+
+	requests, err := scheduleRequests(msgs, at, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sizes []int
+	for _, entries := range requests {
+		sizes = append(sizes, len(entries))
+	}
+	if !reflect.DeepEqual(sizes, []int{2, 2, 1}) {
+		t.Fatalf("request sizes = %v, want [2 2 1]", sizes)
+	}
+
+	first := requests[0][0].(map[string]any)
+	if id, _ := first["message-id"].(string); id == "" {
+		t.Error("message without ID was not assigned one")
+	}
+	second := requests[0][1].(map[string]any)
+	if second["message-id"] != "m-1" {
+		t.Errorf("message-id = %v, want m-1", second["message-id"])
+	}
+
+	var decoded amqp.Message
+	if err := decoded.UnmarshalBinary(second["message"].([]byte)); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := decoded.Annotations[scheduledEnqueueTimeAnnotation].(time.Time); !got.Equal(at) {
+		t.Errorf("scheduled enqueue time = %v, want %v", got, at)
+	}
+	if decoded.Properties.MessageID != "m-1" {
+		t.Errorf("MessageID = %v", decoded.Properties.MessageID)
+	}
+}
+
+func TestPeekedMessages(t *testing.T) {
+	encode := func(id string, seq int64) []byte {
+		amqpMsg := amqp.NewMessage([]byte(id))
+		amqpMsg.Properties = &amqp.MessageProperties{MessageID: id}
+		amqpMsg.Annotations = amqp.Annotations{sequenceNumberAnnotation: seq}
+		b, err := amqpMsg.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	resp := map[string]any{"messages": []map[any]any{
+		{"message": encode("a", 7)},
+		{"message": encode("b", 9)},
+	}}
+	msgs, next, err := peekedMessages(resp, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 2 || msgs[0].ID != "a" || string(msgs[1].Body) != "b" {
+		t.Errorf("messages = %v", msgs)
+	}
+	if next != 10 {
+		t.Errorf("next = %d, want 10", next)
+	}
+
+	// An empty entity answers without a body
+	if msgs, next, err := peekedMessages(nil, 10); err != nil || len(msgs) != 0 || next != 10 {
+		t.Errorf("peekedMessages(nil) = %v, %d, %v", msgs, next, err)
+	}
+	if _, _, err := peekedMessages(map[string]any{"messages": []any{"x"}}, 0); err == nil {
+		t.Error("expected an error for a malformed entry")
+	}
+}
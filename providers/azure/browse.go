@@ -0,0 +1,172 @@
+package azure
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Azure/go-amqp"
+	"github.com/venderneutral/gokyu"
+)
+
+// operationPeekMessage reads messages without locking them.
+const operationPeekMessage = "com.microsoft:peek-message"
+
+// sequenceNumberAnnotation carries the sequence number Service Bus assigns
+// to each message.
+const sequenceNumberAnnotation = "x-opt-sequence-number"
+
+// Browsing peeks at most peekBatchSize messages per request and polls every
+// peekInterval while the entity has no new messages.
+const (
+	peekBatchSize = 32
+	peekInterval  = time.Second
+)
+
+// NewBrowser creates a browser that peeks at the configured queue or
+// subscription through its management node. Peeking does not lock messages
+// or increment their delivery count.
+func (f *Factory) NewBrowser(ctx context.Context, cfg *gokyu.Config) (gokyu.Browser, error) {
+	source, err := cfg.ExpandAddress(cfg.AddressTemplate, buildSourceAddress(cfg))
+	if err != nil {
+		return nil, gokyu.ErrInvalidConfig(err.Error())
+	}
+
+	conn, err := dial(ctx, cfg)
+	if err != nil {
+		return nil, gokyu.WrapError(gokyu.ErrConnectionFailed, err)
+	}
+	session, err := conn.NewSession(ctx, nil)
+	if err != nil {
+		conn.Close()
+		return nil, gokyu.WrapError(gokyu.ErrConnectionFailed, err)
+	}
+	mgmt, err := newManagement(ctx, session, source)
+	if err != nil {
+		session.Close(ctx)
+		conn.Close()
+		return nil, gokyu.WrapError(gokyu.ErrConnectionFailed, err)
+	}
+
+	return &browser{conn: conn, session: session, source: source, mgmt: mgmt}, nil
+}
+
+// browser implements gokyu.Browser with peek-message requests, resuming
+// after the sequence number of the last peeked message.
+type browser struct {
+	conn    *amqp.Conn
+	session *amqp.Session
+	source  string
+	mgmt    *management
+
+	next    int64
+	pending []*gokyu.Message
+}
+
+func (b *browser) Browse(ctx context.Context) (*gokyu.Message, error) {
+	for len(b.pending) == 0 {
+		if err := b.peek(ctx); err != nil {
+			return nil, gokyu.WrapError(gokyu.ErrReceiveFailed, err)
+		}
+		if len(b.pending) > 0 {
+			break
+		}
+
+		timer := time.NewTimer(peekInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, gokyu.WrapError(gokyu.ErrReceiveFailed, ctx.Err())
+		case <-timer.C:
+		}
+	}
+
+	msg := b.pending[0]
+	b.pending = b.pending[1:]
+	return msg, nil
+}
+
+// peek fetches the messages following the last peeked one. Peeking has no
+// side effects, so it is retried on new management links if the broker
+// detached the current ones.
+func (b *browser) peek(ctx context.Context) error {
+	value := map[string]any{
+		"from-sequence-number": b.next,
+		"message-count":        int32(peekBatchSize),
+	}
+	resp, err := b.mgmt.request(ctx, operationPeekMessage, value)
+	if isLinkError(err) {
+		mgmt, aerr := newManagement(ctx, b.session, b.source)
+		if aerr != nil {
+			return err
+		}
+		b.mgmt.close(ctx)
+		b.mgmt = mgmt
+		resp, err = mgmt.request(ctx, operationPeekMessage, value)
+	}
+	if err != nil {
+		return err
+	}
+
+	msgs, next, err := peekedMessages(resp, b.next)
+	if err != nil {
+		return err
+	}
+	b.pending = append(b.pending, msgs...)
+	b.next = next
+	return nil
+}
+
+// peekedMessages decodes a peek-message response and returns the sequence
+// number to peek from next.
+func peekedMessages(resp map[string]any, next int64) ([]*gokyu.Message, int64, error) {
+	// No messages is a 204 response without a body. Service Bus sends the
+	// entries as an array of maps, which decodes to []map[any]any.
+	var entries []any
+	switch v := resp["messages"].(type) {
+	case []any:
+		entries = v
+	case []map[any]any:
+		for _, entry := range v {
+			entries = append(entries, entry)
+		}
+	}
+
+	msgs := make([]*gokyu.Message, 0, len(entries))
+	for _, entry := range entries {
+		var encoded []byte
+		switch fields := entry.(type) {
+		case map[string]any:
+			encoded, _ = fields["message"].([]byte)
+		case map[any]any:
+			encoded, _ = fields["message"].([]byte)
+			if encoded == nil {
+				encoded, _ = fields[amqp.Symbol("message")].([]byte)
+			}
+		}
+		if encoded == nil {
+			return nil, next, fmt.Errorf("%s: unexpected entry %T", operationPeekMessage, entry)
+		}
+
+		var amqpMsg amqp.Message
+		if err := amqpMsg.UnmarshalBinary(encoded); err != nil {
+			return nil, next, err
+		}
+		if seq, ok := amqpMsg.Annotations[sequenceNumberAnnotation].(int64); ok && seq >= next {
+			next = seq + 1
+		}
+		msgs = append(msgs, newMessage(&amqpMsg))
+	}
+	return msgs, next, nil
+}
+
+func (b *browser) Close(ctx context.Context) error {
+	err := b.mgmt.close(ctx)
+	if serr := b.session.Close(ctx); err == nil {
+		err = serr
+	}
+	if cerr := b.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
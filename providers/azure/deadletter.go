@@ -0,0 +1,25 @@
+package azure
+
+import (
+	"context"
+
+	"github.com/venderneutral/gokyu"
+)
+
+// NewDeadLetterSubscriber creates a subscriber for the dead-letter
+// sub-queue of the configured queue or subscription.
+func (f *Factory) NewDeadLetterSubscriber(ctx context.Context, cfg *gokyu.Config) (gokyu.Subscriber, error) {
+	source, err := cfg.ExpandAddress(cfg.AddressTemplate, buildSourceAddress(cfg))
+	if err != nil {
+		return nil, gokyu.ErrInvalidConfig(err.Error())
+	}
+	return newSubscriber(ctx, cfg, deadLetterAddress(cfg, source))
+}
+
+// deadLetterAddress returns the dead-letter sub-queue of source.
+func deadLetterAddress(cfg *gokyu.Config, source string) string {
+	if cfg.DeadLetterQueue != "" {
+		return cfg.DeadLetterQueue
+	}
+	return source + "/$deadletterqueue"
+}
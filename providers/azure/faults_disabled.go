@@ -0,0 +1,6 @@
+//go:build !gokyufaults
+
+package azure
+
+// injectFault is a no-op without the gokyufaults build tag.
+func injectFault(point FaultPoint) error { return nil }
@@ -0,0 +1,72 @@
+//go:build gokyufaults
+
+package azure
+
+import (
+	"context"
+	"sync"
+
+	"github.com/Azure/go-amqp"
+)
+
+var (
+	faultsMu sync.Mutex
+	faults   = make(map[FaultPoint]*fault)
+)
+
+type fault struct {
+	err       error
+	remaining int
+}
+
+// InjectFault makes the next count operations at point fail with err. A count
+// of zero or less fails every operation until ClearFaults is called. If err
+// is nil, an error typical for the fault point is used (a link refusal, a
+// send timeout, or a forced detach).
+//
+// InjectFault is only available with the gokyufaults build tag.
+func InjectFault(point FaultPoint, err error, count int) {
+	if err == nil {
+		err = defaultFault(point)
+	}
+	faultsMu.Lock()
+	defer faultsMu.Unlock()
+	faults[point] = &fault{err: err, remaining: count}
+}
+
+// ClearFaults removes all injected faults.
+func ClearFaults() {
+	faultsMu.Lock()
+	defer faultsMu.Unlock()
+	faults = make(map[FaultPoint]*fault)
+}
+
+// injectFault returns the error injected at point, if any.
+func injectFault(point FaultPoint) error {
+	faultsMu.Lock()
+	defer faultsMu.Unlock()
+
+	f, ok := faults[point]
+	if !ok {
+		return nil
+	}
+	if f.remaining > 0 {
+		f.remaining--
+		if f.remaining == 0 {
+			delete(faults, point)
+		}
+	}
+	return f.err
+}
+
+// defaultFault returns the error injected at point when none is given.
+func defaultFault(point FaultPoint) error {
+	switch point {
+	case FaultAttach:
+		return &amqp.LinkError{RemoteErr: &amqp.Error{Condition: amqp.ErrCondNotAllowed, Description: "injected attach refusal"}}
+	case FaultSend:
+		return context.DeadlineExceeded
+	default:
+		return &amqp.LinkError{RemoteErr: &amqp.Error{Condition: amqp.ErrCondDetachForced, Description: "injected detach"}}
+	}
+}
@@ -0,0 +1,283 @@
+package azure
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Azure/go-amqp"
+	"github.com/venderneutral/gokyu"
+)
+
+// Service Bus management operations.
+const (
+	operationScheduleMessage = "com.microsoft:schedule-message"
+	operationCancelScheduled = "com.microsoft:cancel-scheduled-message"
+)
+
+// scheduledEnqueueTimeAnnotation sets the delivery time of a scheduled message.
+const scheduledEnqueueTimeAnnotation = "x-opt-scheduled-enqueue-time"
+
+// management performs request/response operations against the $management
+// node of a Service Bus entity.
+type management struct {
+	mu       sync.Mutex
+	sender   *amqp.Sender
+	receiver *amqp.Receiver
+	replyTo  string
+}
+
+// newManagement attaches request and response links to the management node
+// of the given entity.
+func newManagement(ctx context.Context, session *amqp.Session, entity string) (*management, error) {
+	address := entity + "/$management"
+	replyTo := "gokyu-mgmt-" + randomID()
+
+	sender, err := session.NewSender(ctx, address, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	receiver, err := session.NewReceiver(ctx, address, &amqp.ReceiverOptions{
+		TargetAddress: replyTo,
+	})
+	if err != nil {
+		sender.Close(ctx)
+		return nil, err
+	}
+
+	return &management{
+		sender:   sender,
+		receiver: receiver,
+		replyTo:  replyTo,
+	}, nil
+}
+
+// errNotSent marks management requests that failed before reaching the
+// broker, which can be retried without repeating the operation.
+var errNotSent = errors.New("request not sent")
+
+// request sends a management operation and returns the response body.
+// Responses are matched to the request by correlation ID: a request
+// abandoned when its context ended leaves its response on the reply link,
+// and the next request discards it.
+func (m *management) request(ctx context.Context, operation string, value map[string]any) (map[string]any, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	messageID := randomID()
+	req := &amqp.Message{
+		Properties: &amqp.MessageProperties{
+			MessageID: messageID,
+			ReplyTo:   &m.replyTo,
+		},
+		ApplicationProperties: map[string]any{
+			"operation": operation,
+		},
+		Value: value,
+	}
+
+	if err := m.sender.Send(ctx, req, nil); err != nil {
+		return nil, fmt.Errorf("%w: %w", errNotSent, err)
+	}
+
+	var resp *amqp.Message
+	for resp == nil {
+		msg, err := m.receiver.Receive(ctx, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := m.receiver.AcceptMessage(ctx, msg); err != nil {
+			return nil, err
+		}
+		if msg.Properties != nil && msg.Properties.CorrelationID == messageID {
+			resp = msg
+		}
+	}
+
+	status, _ := resp.ApplicationProperties["statusCode"].(int32)
+	if status < 200 || status > 299 {
+		desc, _ := resp.ApplicationProperties["statusDescription"].(string)
+		return nil, fmt.Errorf("%s failed with status %d: %s", operation, status, desc)
+	}
+
+	body, _ := resp.Value.(map[string]any)
+	return body, nil
+}
+
+// close detaches the management links.
+func (m *management) close(ctx context.Context) error {
+	err := m.sender.Close(ctx)
+	if rerr := m.receiver.Close(ctx); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// maxScheduleRequestBytes bounds the size of the messages scheduled by one
+// request, leaving room below the 256 KiB message size limit of standard
+// namespaces for the request envelope.
+const maxScheduleRequestBytes = 192 * 1024
+
+// Schedule enqueues a message for delivery at the given time and returns its
+// sequence number as the cancellation token.
+func (p *publisher) Schedule(ctx context.Context, msg *gokyu.Message, at time.Time) (string, error) {
+	tokens, err := p.ScheduleBatch(ctx, []*gokyu.Message{msg}, at)
+	if err != nil {
+		return "", err
+	}
+	return tokens[0], nil
+}
+
+// ScheduleBatch enqueues messages for delivery at the given time with as few
+// schedule-message requests as their size allows, and returns their sequence
+// numbers as cancellation tokens.
+func (p *publisher) ScheduleBatch(ctx context.Context, msgs []*gokyu.Message, at time.Time) ([]string, error) {
+	requests, err := scheduleRequests(msgs, at, maxScheduleRequestBytes)
+	if err != nil {
+		return nil, gokyu.WrapError(gokyu.ErrPublishFailed, err)
+	}
+	if len(requests) == 0 {
+		return nil, nil
+	}
+
+	tokens := make([]string, 0, len(msgs))
+	for _, entries := range requests {
+		resp, err := p.request(ctx, operationScheduleMessage, map[string]any{"messages": entries})
+		if err != nil {
+			return tokens, gokyu.WrapError(gokyu.ErrPublishFailed, err)
+		}
+
+		seqs, _ := resp["sequence-numbers"].([]int64)
+		if len(seqs) != len(entries) {
+			return tokens, gokyu.WrapError(gokyu.ErrPublishFailed, fmt.Errorf("expected %d sequence numbers, got %d", len(entries), len(seqs)))
+		}
+		for _, seq := range seqs {
+			tokens = append(tokens, strconv.FormatInt(seq, 10))
+		}
+	}
+	return tokens, nil
+}
+
+// scheduleRequests encodes messages for delivery at the given time and
+// groups them into the "messages" lists of schedule-message requests of at
+// most maxBytes each. A message larger than maxBytes is sent on its own.
+func scheduleRequests(msgs []*gokyu.Message, at time.Time, maxBytes int) ([][]any, error) {
+	var requests [][]any
+	var entries []any
+	size := 0
+	for _, msg := range msgs {
+		amqpMsg := newAMQPMessage(msg)
+		messageID := msg.ID
+		if messageID == "" {
+			messageID = randomID()
+			if amqpMsg.Properties == nil {
+				amqpMsg.Properties = &amqp.MessageProperties{}
+			}
+			amqpMsg.Properties.MessageID = messageID
+		}
+		if amqpMsg.Annotations == nil {
+			amqpMsg.Annotations = amqp.Annotations{}
+		}
+		amqpMsg.Annotations[scheduledEnqueueTimeAnnotation] = at.UTC()
+
+		encoded, err := amqpMsg.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+
+		if len(entries) > 0 && size+len(encoded) > maxBytes {
+			requests = append(requests, entries)
+			entries, size = nil, 0
+		}
+		entries = append(entries, map[string]any{
+			"message-id": messageID,
+			"message":    encoded,
+		})
+		size += len(encoded)
+	}
+	if len(entries) > 0 {
+		requests = append(requests, entries)
+	}
+	return requests, nil
+}
+
+// CancelScheduled cancels a scheduled message by its sequence number token.
+func (p *publisher) CancelScheduled(ctx context.Context, token string) error {
+	seq, err := strconv.ParseInt(token, 10, 64)
+	if err != nil {
+		return gokyu.WrapError(gokyu.ErrCancelFailed, fmt.Errorf("invalid token %q", token))
+	}
+
+	if _, err := p.request(ctx, operationCancelScheduled, map[string]any{
+		"sequence-numbers": []int64{seq},
+	}); err != nil {
+		return gokyu.WrapError(gokyu.ErrCancelFailed, err)
+	}
+	return nil
+}
+
+// request performs a management operation. Failed management links are
+// dropped so that the next request attaches new ones, as Service Bus
+// detaches idle links. A request is retried only if it was not sent, since
+// a lost response leaves the outcome of the operation unknown.
+func (p *publisher) request(ctx context.Context, operation string, value map[string]any) (map[string]any, error) {
+	mgmt, err := p.management(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := mgmt.request(ctx, operation, value)
+	if !isLinkError(err) {
+		return resp, err
+	}
+
+	p.dropManagement(ctx, mgmt)
+	if !errors.Is(err, errNotSent) || !isLinkDetached(err) {
+		return nil, err
+	}
+	if mgmt, err = p.management(ctx); err != nil {
+		return nil, err
+	}
+	return mgmt.request(ctx, operation, value)
+}
+
+// management returns the publisher's management client, attaching it on first use.
+func (p *publisher) management(ctx context.Context) (*management, error) {
+	p.mgmtMu.Lock()
+	defer p.mgmtMu.Unlock()
+
+	if p.mgmt != nil {
+		return p.mgmt, nil
+	}
+	mgmt, err := newManagement(ctx, p.session, p.destination)
+	if err != nil {
+		return nil, err
+	}
+	p.mgmt = mgmt
+	return mgmt, nil
+}
+
+// dropManagement closes a failed management client. Concurrent callers
+// that saw the same client fail drop it once.
+func (p *publisher) dropManagement(ctx context.Context, failed *management) {
+	p.mgmtMu.Lock()
+	defer p.mgmtMu.Unlock()
+
+	if p.mgmt != failed {
+		return
+	}
+	failed.close(ctx)
+	p.mgmt = nil
+}
+
+// randomID returns a random hex identifier.
+func randomID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,119 @@
+package azure
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-amqp"
+	"github.com/venderneutral/gokyu"
+	"github.com/venderneutral/gokyu/internal/amqptest"
+)
+
+// managementNode answers Service Bus management requests on an amqptest
+// broker. Requests for which respond returns false are answered along with
+// the next request, as if the response arrived late.
+type managementNode struct {
+	t       *testing.T
+	respond func(operation string) bool
+
+	mu      sync.Mutex
+	delayed [][]byte
+}
+
+func (n *managementNode) handle(payload []byte) [][]byte {
+	var req amqp.Message
+	if err := req.UnmarshalBinary(payload); err != nil {
+		n.t.Errorf("UnmarshalBinary() error = %v", err)
+		return nil
+	}
+	operation, _ := req.ApplicationProperties["operation"].(string)
+
+	var value map[string]any
+	if operation == operationScheduleMessage {
+		value = map[string]any{"sequence-numbers": []int64{42}}
+	}
+	reply, err := (&amqp.Message{
+		Properties:            &amqp.MessageProperties{CorrelationID: req.Properties.MessageID},
+		ApplicationProperties: map[string]any{"statusCode": int32(200)},
+		Value:                 value,
+	}).MarshalBinary()
+	if err != nil {
+		n.t.Errorf("MarshalBinary() error = %v", err)
+		return nil
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if !n.respond(operation) {
+		n.delayed = append(n.delayed, reply)
+		return nil
+	}
+	replies := append(n.delayed, reply)
+	n.delayed = nil
+	return replies
+}
+
+func newManagementTest(t *testing.T, respond func(operation string) bool) (*amqptest.Server, *publisher) {
+	t.Helper()
+	server := amqptest.NewServer(t)
+	node := &managementNode{t: t, respond: respond}
+	server.Handle("orders/$management", node.handle)
+
+	cfg := &gokyu.Config{Provider: gokyu.ProviderAzure, ConnectionString: server.URL(), Queue: "orders"}
+	pub, err := newPublisher(context.Background(), cfg, "orders")
+	if err != nil {
+		t.Fatalf("newPublisher() error = %v", err)
+	}
+	t.Cleanup(func() { pub.Close(context.Background()) })
+	return server, pub
+}
+
+func TestManagement_DiscardsStaleResponses(t *testing.T) {
+	_, pub := newManagementTest(t, func(operation string) bool {
+		return operation != operationCancelScheduled
+	})
+	at := time.Now().Add(time.Hour)
+
+	// The cancellation is abandoned before its response arrives
+	cancelCtx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := pub.CancelScheduled(cancelCtx, "7"); err == nil {
+		t.Fatal("CancelScheduled() without a response succeeded")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	token, err := pub.Schedule(ctx, gokyu.NewMessage([]byte("order")), at)
+	if err != nil {
+		t.Fatalf("Schedule() after an abandoned request error = %v", err)
+	}
+	if token != "42" {
+		t.Errorf("Schedule() token = %q, want 42", token)
+	}
+}
+
+func TestManagement_ReattachesDetachedLinks(t *testing.T) {
+	server, pub := newManagementTest(t, func(string) bool { return true })
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	at := time.Now().Add(time.Hour)
+
+	if _, err := pub.Schedule(ctx, gokyu.NewMessage([]byte("first")), at); err != nil {
+		t.Fatalf("Schedule() error = %v", err)
+	}
+
+	// Service Bus detaches idle links; the request was not sent, so it is
+	// retried on new links
+	server.Detach("orders/$management")
+	if _, err := pub.Schedule(ctx, gokyu.NewMessage([]byte("second")), at); err != nil {
+		t.Fatalf("Schedule() after a detach error = %v", err)
+	}
+	if n := server.Attaches("orders/$management"); n != 4 {
+		t.Errorf("%d attaches to the management node, want two pairs of links", n)
+	}
+	if err := pub.CancelScheduled(ctx, "42"); err != nil {
+		t.Errorf("CancelScheduled() error = %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package azure
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Azure/go-amqp"
+	"github.com/venderneutral/gokyu"
+)
+
+// isLinkDetached reports whether err is a detach initiated by the broker, as
+// when idle links are closed. The connection and session are still usable, so
+// the link can be attached again without dialing.
+func isLinkDetached(err error) bool {
+	var linkErr *amqp.LinkError
+	return errors.As(err, &linkErr) && linkErr.RemoteErr != nil
+}
+
+// isLinkError reports whether err means a link can no longer be used, whether
+// the broker detached it or it failed locally.
+func isLinkError(err error) bool {
+	var linkErr *amqp.LinkError
+	return errors.As(err, &linkErr)
+}
+
+// link returns the current sender.
+func (p *publisher) link() *amqp.Sender {
+	p.linkMu.Lock()
+	defer p.linkMu.Unlock()
+	return p.sender
+}
+
+// send sends msg, attaching a new sender and retrying once if the broker
+// detached the current one.
+func (p *publisher) send(ctx context.Context, msg *amqp.Message) error {
+	sender := p.link()
+	err := sendOn(ctx, sender, msg)
+	if err == nil || !isLinkDetached(err) {
+		return err
+	}
+
+	sender, rerr := p.reattach(ctx, sender)
+	if rerr != nil {
+		return err
+	}
+	return sendOn(ctx, sender, msg)
+}
+
+// sendOn sends msg on sender, or fails with the fault injected at FaultSend.
+func sendOn(ctx context.Context, sender *amqp.Sender, msg *amqp.Message) error {
+	if err := injectFault(FaultSend); err != nil {
+		return err
+	}
+	return sender.Send(ctx, msg, nil)
+}
+
+// reattach replaces a detached sender on the existing session. Concurrent
+// callers that saw the same failed link share one replacement.
+func (p *publisher) reattach(ctx context.Context, failed *amqp.Sender) (*amqp.Sender, error) {
+	p.linkMu.Lock()
+	defer p.linkMu.Unlock()
+
+	if p.sender != failed {
+		return p.sender, nil
+	}
+	if err := injectFault(FaultAttach); err != nil {
+		return nil, err
+	}
+	sender, err := p.session.NewSender(ctx, p.destination, nil)
+	if err != nil {
+		return nil, err
+	}
+	failed.Close(ctx)
+	p.sender = sender
+	return sender, nil
+}
+
+// link returns the current receiver and its prefetch controller, if any.
+func (s *subscriber) link() (*amqp.Receiver, *gokyu.PrefetchController) {
+	s.linkMu.Lock()
+	defer s.linkMu.Unlock()
+	return s.receiver, s.prefetch
+}
+
+// receive receives a message, attaching a new receiver and retrying once if
+// the broker detached the current one. Messages received on the old link can
+// still be settled, as long as the broker has not expired their locks.
+func (s *subscriber) receive(ctx context.Context) (*amqp.Message, error) {
+	receiver, _ := s.link()
+	msg, err := receiveOn(ctx, receiver)
+	if err == nil || !isLinkDetached(err) {
+		return msg, err
+	}
+
+	receiver, rerr := s.reattach(ctx, receiver)
+	if rerr != nil {
+		return nil, err
+	}
+	return receiveOn(ctx, receiver)
+}
+
+// receiveOn receives a message on receiver, or fails with the fault injected
+// at FaultReceive.
+func receiveOn(ctx context.Context, receiver *amqp.Receiver) (*amqp.Message, error) {
+	if err := injectFault(FaultReceive); err != nil {
+		return nil, err
+	}
+	return receiver.Receive(ctx, nil)
+}
+
+// reattach replaces a detached receiver on the existing session.
+func (s *subscriber) reattach(ctx context.Context, failed *amqp.Receiver) (*amqp.Receiver, error) {
+	s.linkMu.Lock()
+	defer s.linkMu.Unlock()
+
+	if s.receiver != failed {
+		return s.receiver, nil
+	}
+	if err := injectFault(FaultAttach); err != nil {
+		return nil, err
+	}
+	receiver, err := s.session.NewReceiver(ctx, s.source, receiverOptions(s.cfg))
+	if err != nil {
+		return nil, err
+	}
+	prefetch, err := newPrefetchController(s.cfg, receiver)
+	if err != nil {
+		receiver.Close(ctx)
+		return nil, err
+	}
+	failed.Close(ctx)
+	s.receiver = receiver
+	s.prefetch = prefetch
+	return receiver, nil
+}
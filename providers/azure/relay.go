@@ -0,0 +1,73 @@
+package azure
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Azure/go-amqp"
+	"github.com/venderneutral/gokyu"
+)
+
+// NewRelayPublisher creates a publisher with an anonymous relay sender link.
+// Publish sends to the configured queue or topic; PublishTo sends to any
+// entity in the namespace.
+func (f *Factory) NewRelayPublisher(ctx context.Context, cfg *gokyu.Config) (gokyu.RelayPublisher, error) {
+	pub, err := newPublisher(ctx, cfg, "")
+	if err != nil {
+		return nil, err
+	}
+	return &relayPublisher{pub: pub, cfg: cfg}, nil
+}
+
+// relayPublisher sends through an anonymous relay link. Scheduling is not
+// offered since the management link belongs to a single entity.
+type relayPublisher struct {
+	pub *publisher
+	cfg *gokyu.Config
+}
+
+func (p *relayPublisher) Publish(ctx context.Context, msg *gokyu.Message) error {
+	if buildDestinationAddress(p.cfg) == "" {
+		return gokyu.WrapError(gokyu.ErrPublishFailed, errors.New("no queue or topic configured; use PublishTo"))
+	}
+	return p.send(ctx, p.cfg, msg)
+}
+
+func (p *relayPublisher) PublishTo(ctx context.Context, destination string, msg *gokyu.Message) error {
+	cfg := *p.cfg
+	cfg.Topic = destination
+	cfg.Queue = ""
+	return p.send(ctx, &cfg, msg)
+}
+
+// send sends msg to the destination of cfg.
+func (p *relayPublisher) send(ctx context.Context, cfg *gokyu.Config, msg *gokyu.Message) error {
+	to, err := cfg.ExpandAddress(cfg.PublishAddressTemplate, buildDestinationAddress(cfg))
+	if err != nil {
+		return gokyu.WrapError(gokyu.ErrPublishFailed, err)
+	}
+	if err := p.pub.send(ctx, newRelayMessage(msg, to)); err != nil {
+		return gokyu.WrapError(gokyu.ErrPublishFailed, err)
+	}
+	return nil
+}
+
+// BrokerProperties returns the properties the broker sent on connection open.
+func (p *relayPublisher) BrokerProperties() map[string]interface{} {
+	return p.pub.BrokerProperties()
+}
+
+func (p *relayPublisher) Close(ctx context.Context) error {
+	return p.pub.Close(ctx)
+}
+
+// newRelayMessage converts a gokyu message to an AMQP message addressed to
+// the entity at to.
+func newRelayMessage(msg *gokyu.Message, to string) *amqp.Message {
+	amqpMsg := newAMQPMessage(msg)
+	if amqpMsg.Properties == nil {
+		amqpMsg.Properties = &amqp.MessageProperties{}
+	}
+	amqpMsg.Properties.To = &to
+	return amqpMsg
+}
@@ -0,0 +1,651 @@
+// Package beanstalkd provides a gokyu provider for beanstalkd, a lightweight
+// work queue, for job processing where an AMQP broker is overkill. Handlers
+// written against gokyu run unchanged on a laptop beanstalkd and on Azure
+// Service Bus or Amazon MQ in production.
+//
+// # Connection String Format
+//
+//	beanstalk://localhost:11300
+//
+// Without a connection string, Config.Host and Config.Port (default: 11300)
+// are used.
+//
+// # Tubes
+//
+// A queue is a tube of the same name. Beanstalkd has no topics, so a topic
+// subscription is the tube "<topic>/<subscription>" and publishing to a
+// topic puts a copy of the message in every such tube that exists. A tube
+// exists while a subscriber watches it or it holds jobs, so subscriptions
+// only receive messages published while they exist.
+//
+// Messages are stored as JSON envelopes carrying the ID, content type and
+// properties. Jobs that are not envelopes, e.g. put by other beanstalkd
+// clients, are received with the job data as the body.
+//
+// # Settlement
+//
+// Ack deletes the job and Nack releases it, after the Config.Redelivery delay
+// if set. A job not settled within the time-to-run (Factory.TTR) is released
+// by the server; settling it afterwards returns ErrVisibilityExpired. Jobs
+// reserved MaxDeliveries times, or that exhaust Config.Redelivery, are moved
+// to the tube "DLQ.<tube>" with a gokyu.FailureRecord, where
+// Client.NewDeadLetterSubscriber receives them.
+//
+// # Priority
+//
+// Message.Priority is applied natively: a message of priority p is put
+// DefaultPriority-p below Factory.Priority, so higher priorities are
+// reserved first.
+//
+// # Scheduled Messages
+//
+// Publishers implement gokyu.ScheduledPublisher using the job delay.
+// CancelScheduled deletes the delayed jobs.
+//
+// # Usage
+//
+// Import this package to register the beanstalkd provider:
+//
+//	import _ "github.com/venderneutral/gokyu/providers/beanstalkd"
+package beanstalkd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+)
+
+func init() {
+	gokyu.RegisterProvider(gokyu.ProviderBeanstalkd, &Factory{})
+}
+
+// DefaultPort is the default beanstalkd port.
+const DefaultPort = 11300
+
+// deadLetterPrefix prefixes the tube that holds dead-lettered jobs.
+const deadLetterPrefix = "DLQ."
+
+// ErrVisibilityExpired is returned by Ack and Nack when the time-to-run of a
+// job expired and the server released it.
+var ErrVisibilityExpired = errors.New("beanstalkd: time-to-run expired")
+
+// Factory creates beanstalkd publishers and subscribers.
+type Factory struct {
+	// Priority is the priority of published jobs with the default
+	// Message.Priority; lower values are reserved first (default: 1024).
+	Priority uint32
+
+	// TTR is the time-to-run of published jobs: how long a received message
+	// may stay unsettled before the server releases it (default: 1m).
+	TTR time.Duration
+
+	// ReserveTimeout bounds each reserve command, and so how long Ack and
+	// Nack may wait for a concurrent Receive (default: 1s).
+	ReserveTimeout time.Duration
+
+	// MaxDeliveries is the number of reservations after which a job is
+	// dead-lettered (default: 10).
+	MaxDeliveries int
+
+	// Clock is the time source for scheduled messages (default:
+	// gokyu.SystemClock).
+	Clock gokyu.Clock
+}
+
+// settings are the factory settings with defaults applied.
+type settings struct {
+	priority       uint32
+	ttr            time.Duration
+	reserveTimeout time.Duration
+	maxDeliveries  int
+	clock          gokyu.Clock
+}
+
+func (f *Factory) settings() settings {
+	s := settings{
+		priority:       f.Priority,
+		ttr:            f.TTR,
+		reserveTimeout: f.ReserveTimeout,
+		maxDeliveries:  f.MaxDeliveries,
+		clock:          f.Clock,
+	}
+	if s.priority == 0 {
+		s.priority = 1024
+	}
+	if s.ttr <= 0 {
+		s.ttr = time.Minute
+	}
+	if s.reserveTimeout <= 0 {
+		s.reserveTimeout = time.Second
+	}
+	if s.maxDeliveries <= 0 {
+		s.maxDeliveries = 10
+	}
+	if s.clock == nil {
+		s.clock = gokyu.SystemClock
+	}
+	return s
+}
+
+// jobPriority returns the job priority of a message priority.
+func (s settings) jobPriority(priority uint8) uint32 {
+	p := int64(priority)
+	if p == 0 {
+		p = gokyu.DefaultPriority
+	}
+	if p > gokyu.MaxPriority {
+		p = gokyu.MaxPriority
+	}
+	pri := int64(s.priority) + gokyu.DefaultPriority - p
+	if pri < 0 {
+		return 0
+	}
+	if pri > 1<<32-1 {
+		return 1<<32 - 1
+	}
+	return uint32(pri)
+}
+
+// address returns the server address from the configuration.
+func address(cfg *gokyu.Config) (string, error) {
+	if cfg.ConnectionString != "" {
+		u, err := url.Parse(cfg.ConnectionString)
+		if err != nil || (u.Scheme != "beanstalk" && u.Scheme != "beanstalkd") || u.Host == "" {
+			return "", gokyu.ErrInvalidConfig("beanstalkd connection string must be beanstalk://host:port")
+		}
+		if u.Port() == "" {
+			return net.JoinHostPort(u.Hostname(), strconv.Itoa(DefaultPort)), nil
+		}
+		return u.Host, nil
+	}
+	if cfg.Host == "" {
+		return "", gokyu.ErrInvalidConfig("host or connection_string is required")
+	}
+	port := cfg.Port
+	if port == 0 {
+		port = DefaultPort
+	}
+	return net.JoinHostPort(strings.Trim(cfg.Host, "[]"), strconv.Itoa(port)), nil
+}
+
+// dial connects to the configured server.
+func dial(ctx context.Context, cfg *gokyu.Config) (*conn, error) {
+	addr, err := address(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var dialer gokyu.Dialer
+	if cfg.Dialer != nil {
+		dialer = *cfg.Dialer
+	}
+	nc, err := dialer.WithDefaults().DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, gokyu.WrapError(gokyu.ErrConnectionFailed, err)
+	}
+	return newConn(nc), nil
+}
+
+// envelope is the JSON job format.
+type envelope struct {
+	ID          string                 `json:"id,omitempty"`
+	ContentType string                 `json:"content_type,omitempty"`
+	Properties  map[string]interface{} `json:"properties,omitempty"`
+	Priority    uint8                  `json:"priority,omitempty"`
+	Body        []byte                 `json:"body"`
+}
+
+func encode(msg *gokyu.Message) ([]byte, error) {
+	return json.Marshal(envelope{
+		ID:          msg.ID,
+		ContentType: msg.ContentType,
+		Properties:  msg.Properties,
+		Priority:    msg.Priority,
+		Body:        append([]byte{}, msg.Body...),
+	})
+}
+
+// decode converts job data to a message. Data that is not an envelope
+// becomes the body.
+func decode(data []byte) *gokyu.Message {
+	var env envelope
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.UseNumber()
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&env); err != nil || env.Body == nil {
+		return gokyu.NewMessage(data)
+	}
+
+	msg := gokyu.NewMessage(env.Body)
+	msg.ID = env.ID
+	msg.ContentType = env.ContentType
+	msg.Priority = env.Priority
+	for k, v := range env.Properties {
+		if n, ok := v.(json.Number); ok {
+			if i, err := n.Int64(); err == nil {
+				v = i
+			} else if f, err := n.Float64(); err == nil {
+				v = f
+			}
+		}
+		msg.Properties[k] = v
+	}
+	return msg
+}
+
+// Capabilities reports native scheduling and priority.
+func (f *Factory) Capabilities() gokyu.Capabilities {
+	return gokyu.Capabilities{Scheduling: gokyu.Native, Priority: gokyu.Native}
+}
+
+// Guarantees describes the delivery guarantees of beanstalkd.
+func (f *Factory) Guarantees() gokyu.Guarantees {
+	return gokyu.Guarantees{
+		Delivery:       gokyu.AtLeastOnce,
+		Ordering:       gokyu.OrderingQueue,
+		Deduplication:  gokyu.Unsupported,
+		MaxMessageSize: 65535,
+		Notes: []string{
+			"jobs are ordered by priority, then publish order",
+			"jobs not settled within their time-to-run are redelivered",
+			"the size limit is the server default, set with beanstalkd -z",
+		},
+	}
+}
+
+// Ping connects to the server and disconnects. Beanstalkd has no
+// authentication.
+func (f *Factory) Ping(ctx context.Context, cfg *gokyu.Config) error {
+	c, err := dial(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	return c.close()
+}
+
+// NewPublisher creates a publisher for the configured queue or topic.
+func (f *Factory) NewPublisher(ctx context.Context, cfg *gokyu.Config) (gokyu.Publisher, error) {
+	c, err := dial(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &publisher{settings: f.settings(), conn: c, queue: cfg.Queue, topic: cfg.Topic}, nil
+}
+
+// publisher implements gokyu.ScheduledPublisher.
+type publisher struct {
+	settings settings
+	conn     *conn
+	queue    string
+	topic    string // used when queue is empty
+
+	mu     sync.Mutex
+	using  string
+	closed bool
+}
+
+func (p *publisher) Publish(ctx context.Context, msg *gokyu.Message) error {
+	_, err := p.put(ctx, msg, 0)
+	return err
+}
+
+// Schedule puts the message with a delay. The token lists the job IDs.
+func (p *publisher) Schedule(ctx context.Context, msg *gokyu.Message, at time.Time) (string, error) {
+	ids, err := p.put(ctx, msg, at.Sub(p.settings.clock.Now()))
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(ids, ","), nil
+}
+
+// CancelScheduled deletes the delayed jobs of a Schedule call.
+func (p *publisher) CancelScheduled(ctx context.Context, token string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return gokyu.ErrClosed
+	}
+	for _, id := range strings.Split(token, ",") {
+		if _, err := strconv.ParseUint(id, 10, 64); err != nil {
+			return fmt.Errorf("beanstalkd: invalid schedule token %q", token)
+		}
+		if _, _, err := p.conn.expect(ctx, "DELETED", nil, "delete %s", id); err != nil {
+			return fmt.Errorf("beanstalkd: cancel job %s: %w", id, err)
+		}
+	}
+	return nil
+}
+
+// put puts the message in the destination tubes and returns the job IDs.
+func (p *publisher) put(ctx context.Context, msg *gokyu.Message, delay time.Duration) ([]string, error) {
+	if msg.BodyValue != nil {
+		return nil, gokyu.WrapError(gokyu.ErrPublishFailed, errors.New("beanstalkd: BodyValue is not supported"))
+	}
+	data, err := encode(msg)
+	if err != nil {
+		return nil, gokyu.WrapError(gokyu.ErrPublishFailed, err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil, gokyu.ErrClosed
+	}
+
+	tubes := []string{p.queue}
+	if p.queue == "" {
+		all, err := p.conn.listTubes(ctx)
+		if err != nil {
+			return nil, gokyu.WrapError(gokyu.ErrPublishFailed, err)
+		}
+		tubes = tubes[:0]
+		for _, tube := range all {
+			if strings.HasPrefix(tube, p.topic+"/") {
+				tubes = append(tubes, tube)
+			}
+		}
+	}
+
+	var ids []string
+	for _, tube := range tubes {
+		if tube != p.using {
+			if _, _, err := p.conn.expect(ctx, "USING", nil, "use %s", tube); err != nil {
+				return nil, gokyu.WrapError(gokyu.ErrPublishFailed, err)
+			}
+			p.using = tube
+		}
+		id, err := p.conn.put(ctx, p.settings.jobPriority(msg.Priority), delay, p.settings.ttr, data)
+		if err != nil {
+			return nil, gokyu.WrapError(gokyu.ErrPublishFailed, err)
+		}
+		ids = append(ids, strconv.FormatUint(id, 10))
+	}
+	return ids, nil
+}
+
+func (p *publisher) Close(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	return p.conn.close()
+}
+
+// NewSubscriber creates a subscriber for the configured queue or topic
+// subscription.
+func (f *Factory) NewSubscriber(ctx context.Context, cfg *gokyu.Config) (gokyu.Subscriber, error) {
+	s := f.settings()
+	return newSubscriber(ctx, cfg, s, subscriberTube(cfg), cfg.Redelivery, s.maxDeliveries)
+}
+
+// NewDeadLetterSubscriber creates a subscriber for the dead-letter tube of
+// the configured queue or subscription, or of the queue named by
+// Config.DeadLetterQueue if set.
+func (f *Factory) NewDeadLetterSubscriber(ctx context.Context, cfg *gokyu.Config) (gokyu.Subscriber, error) {
+	tube := subscriberTube(cfg)
+	if cfg.DeadLetterQueue != "" {
+		tube = cfg.DeadLetterQueue
+	}
+	return newSubscriber(ctx, cfg, f.settings(), deadLetterPrefix+tube, nil, 0)
+}
+
+// subscriberTube returns the tube of the configured queue or subscription.
+func subscriberTube(cfg *gokyu.Config) string {
+	if cfg.Queue != "" {
+		return cfg.Queue
+	}
+	return cfg.Topic + "/" + cfg.Subscription
+}
+
+// delivery identifies a reserved job.
+type delivery struct {
+	id       uint64
+	priority string
+	reserves int
+}
+
+// subscriber implements gokyu.Subscriber by reserving jobs from a tube.
+type subscriber struct {
+	settings settings
+	conn     *conn
+	tube     string
+	cfg      *gokyu.Config
+	identity *gokyu.Receiver
+
+	// redelivery is Config.Redelivery with defaults, or nil
+	redelivery *gokyu.RedeliveryPolicy
+
+	// maxDeliveries is the reservation count at which jobs are
+	// dead-lettered, or 0 to never dead-letter
+	maxDeliveries int
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newSubscriber(ctx context.Context, cfg *gokyu.Config, s settings, tube string, redelivery *gokyu.RedeliveryPolicy, maxDeliveries int) (*subscriber, error) {
+	c, err := dial(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	setup := [][2]string{
+		{"WATCHING", "watch " + tube},
+		{"USING", "use " + deadLetterPrefix + tube},
+	}
+	if tube != "default" {
+		setup = append(setup, [2]string{"WATCHING", "ignore default"})
+	}
+	for _, cmd := range setup {
+		if _, _, err := c.expect(ctx, cmd[0], nil, "%s", cmd[1]); err != nil {
+			c.close()
+			return nil, gokyu.WrapError(gokyu.ErrConnectionFailed, err)
+		}
+	}
+
+	sub := &subscriber{
+		settings:      s,
+		conn:          c,
+		tube:          tube,
+		cfg:           cfg,
+		identity:      gokyu.NewReceiver(cfg),
+		maxDeliveries: maxDeliveries,
+		done:          make(chan struct{}),
+	}
+	if redelivery != nil {
+		policy := redelivery.WithDefaults()
+		sub.redelivery = &policy
+	}
+	return sub, nil
+}
+
+func (s *subscriber) Receive(ctx context.Context) (*gokyu.Message, error) {
+	for {
+		select {
+		case <-s.done:
+			return nil, gokyu.ErrClosed
+		case <-ctx.Done():
+			return nil, gokyu.WrapError(gokyu.ErrReceiveFailed, ctx.Err())
+		default:
+		}
+
+		msg, err := s.reserve(ctx)
+		if err != nil {
+			select {
+			case <-s.done:
+				return nil, gokyu.ErrClosed
+			default:
+			}
+			return nil, gokyu.WrapError(gokyu.ErrReceiveFailed, err)
+		}
+		if msg != nil {
+			msg.Receiver = s.identity
+			return msg, nil
+		}
+	}
+}
+
+// reserve reserves a job for up to ReserveTimeout and returns it, or nil if
+// none became ready. Jobs that reached the delivery limit are dead-lettered
+// instead.
+func (s *subscriber) reserve(ctx context.Context) (*gokyu.Message, error) {
+	timeout := s.settings.reserveTimeout
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < timeout {
+		timeout = time.Until(deadline)
+	}
+	line, data, err := s.conn.do(ctx, timeout+5*time.Second, nil, "reserve-with-timeout %d", int64(timeout/time.Second))
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(line)
+	switch {
+	case line == "TIMED_OUT" && timeout < time.Second:
+		// The protocol counts whole seconds, so poll out the remainder
+		timer := s.settings.clock.NewTimer(50 * time.Millisecond)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+		case <-s.done:
+		case <-timer.C():
+		}
+		return nil, nil
+	case line == "TIMED_OUT" || line == "DEADLINE_SOON":
+		return nil, nil
+	case len(fields) != 3 || fields[0] != "RESERVED":
+		return nil, responseError("reserve-with-timeout", line)
+	}
+	id, err := strconv.ParseUint(fields[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("beanstalkd: malformed response %q", line)
+	}
+
+	stats, err := s.conn.stats(ctx, "stats-job %d", id)
+	if err != nil {
+		return nil, err
+	}
+	d := &delivery{id: id, priority: stats["pri"]}
+	d.reserves, _ = strconv.Atoi(stats["reserves"])
+
+	msg := decode(data)
+	if s.maxDeliveries > 0 && d.reserves > s.maxDeliveries {
+		// Jobs that keep outliving their time-to-run were never settled,
+		// e.g. because their handler crashed the process
+		reason := fmt.Errorf("beanstalkd: not settled after %d deliveries", d.reserves-1)
+		if err := s.deadLetter(ctx, d, msg, reason); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	msg.SetRaw(d)
+	return msg, nil
+}
+
+// deadLetter puts the message in the dead-letter tube and deletes the job.
+func (s *subscriber) deadLetter(ctx context.Context, d *delivery, msg *gokyu.Message, reason error) error {
+	failure := gokyu.NewFailureRecord(msg, reason, "beanstalkd", d.reserves, s.settings.clock.Now())
+	dead, err := gokyu.NewDeadLetterMessage(msg, failure)
+	if err != nil {
+		return err
+	}
+	data, err := encode(dead)
+	if err != nil {
+		return err
+	}
+	if _, err := s.conn.put(ctx, s.settings.priority, 0, s.settings.ttr, data); err != nil {
+		return err
+	}
+	if _, _, err := s.conn.expect(ctx, "DELETED", nil, "delete %d", d.id); err != nil {
+		return err
+	}
+	gokyu.ReportDeadLetter(s.cfg, msg, failure)
+	return nil
+}
+
+func (s *subscriber) Ack(ctx context.Context, msg *gokyu.Message) error {
+	d, ok := msg.Raw().(*delivery)
+	if !ok {
+		return gokyu.ErrAckFailed
+	}
+	if err := s.owned(ctx, d); err != nil {
+		return settleError(err)
+	}
+	if _, _, err := s.conn.expect(ctx, "DELETED", nil, "delete %d", d.id); err != nil {
+		return settleError(err)
+	}
+	return nil
+}
+
+// owned returns errNotFound unless the job is still reserved for the
+// delivery d. Beanstalkd lets any client delete a ready job, so a late Ack
+// would otherwise delete a job released after its time-to-run.
+func (s *subscriber) owned(ctx context.Context, d *delivery) error {
+	stats, err := s.conn.stats(ctx, "stats-job %d", d.id)
+	if err != nil {
+		return err
+	}
+	if stats["state"] != "reserved" || stats["reserves"] != strconv.Itoa(d.reserves) {
+		return errNotFound
+	}
+	return nil
+}
+
+// Nack releases the job, after the Config.Redelivery delay if set, or
+// dead-letters it if it has reached the delivery limit.
+func (s *subscriber) Nack(ctx context.Context, msg *gokyu.Message) error {
+	d, ok := msg.Raw().(*delivery)
+	if !ok {
+		return gokyu.ErrAckFailed
+	}
+
+	if err := s.owned(ctx, d); err != nil {
+		return settleError(err)
+	}
+
+	exhausted := s.maxDeliveries > 0 && d.reserves >= s.maxDeliveries
+	if s.redelivery != nil && s.maxDeliveries > 0 && s.redelivery.Exhausted(d.reserves-1) {
+		exhausted = true
+	}
+	if exhausted {
+		reason := fmt.Errorf("beanstalkd: nacked after %d deliveries", d.reserves)
+		if err := s.deadLetter(ctx, d, msg, reason); err != nil {
+			return settleError(err)
+		}
+		gokyu.EmitEvent(s.cfg, gokyu.Event{Type: gokyu.EventRetryExhausted, Message: msg, Err: reason})
+		return nil
+	}
+
+	var delay time.Duration
+	if s.redelivery != nil {
+		delay = s.redelivery.Delay(d.reserves - 1)
+	}
+	if _, _, err := s.conn.expect(ctx, "RELEASED", nil, "release %d %s %d", d.id, d.priority, seconds(delay)); err != nil {
+		return settleError(err)
+	}
+	return nil
+}
+
+// settleError maps a failed settlement to an error.
+func settleError(err error) error {
+	if errors.Is(err, errNotFound) {
+		return fmt.Errorf("%w: %w", gokyu.ErrAckFailed, ErrVisibilityExpired)
+	}
+	return gokyu.WrapError(gokyu.ErrAckFailed, err)
+}
+
+func (s *subscriber) Close(ctx context.Context) error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.done)
+		err = s.conn.close()
+	})
+	return err
+}
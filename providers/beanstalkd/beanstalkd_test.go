@@ -0,0 +1,262 @@
+package beanstalkd
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+	"github.com/venderneutral/gokyu/conformance"
+)
+
+func TestConformance(t *testing.T) {
+	server := newFakeServer(t)
+	cfg := &gokyu.Config{Provider: gokyu.ProviderBeanstalkd, ConnectionString: server.url(), Queue: "orders"}
+
+	conformance.Run(t, &Factory{}, cfg, &conformance.Options{
+		ReceiveTimeout: 3 * time.Second,
+		QuietPeriod:    100 * time.Millisecond,
+	})
+}
+
+// receive receives a message or fails the test.
+func receive(t *testing.T, sub gokyu.Subscriber) *gokyu.Message {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	msg, err := sub.Receive(ctx)
+	if err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	return msg
+}
+
+func TestDeadLetterAfterMaxDeliveries(t *testing.T) {
+	server := newFakeServer(t)
+	factory := &Factory{MaxDeliveries: 2}
+	cfg := &gokyu.Config{Provider: gokyu.ProviderBeanstalkd, ConnectionString: server.url(), Queue: "orders"}
+	ctx := context.Background()
+
+	pub, _ := factory.NewPublisher(ctx, cfg)
+	defer pub.Close(ctx)
+	sub, _ := factory.NewSubscriber(ctx, cfg)
+	defer sub.Close(ctx)
+
+	msg := gokyu.NewMessage([]byte("poison"))
+	msg.ID = "m-1"
+	msg.Properties["tenant"] = "acme"
+	if err := pub.Publish(ctx, msg); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := sub.Nack(ctx, receive(t, sub)); err != nil {
+			t.Fatalf("Nack() error = %v", err)
+		}
+	}
+	if jobs := server.tube("orders"); len(jobs) != 0 {
+		t.Errorf("orders tube has %d jobs, want 0", len(jobs))
+	}
+
+	dlq, err := factory.NewDeadLetterSubscriber(ctx, cfg)
+	if err != nil {
+		t.Fatalf("NewDeadLetterSubscriber() error = %v", err)
+	}
+	defer dlq.Close(ctx)
+
+	dead := receive(t, dlq)
+	if dead.ID != "m-1" || string(dead.Body) != "poison" || dead.Properties["tenant"] != "acme" {
+		t.Errorf("dead letter = %+v", dead)
+	}
+	if reason := gokyu.DeadLetterReason(dead); !strings.Contains(reason, "2 deliveries") {
+		t.Errorf("DeadLetterReason() = %q", reason)
+	}
+	if err := dlq.Ack(ctx, dead); err != nil {
+		t.Errorf("Ack() on dead letter error = %v", err)
+	}
+}
+
+func TestTimeToRun(t *testing.T) {
+	server := newFakeServer(t)
+	factory := &Factory{TTR: time.Minute, MaxDeliveries: 2}
+	cfg := &gokyu.Config{Provider: gokyu.ProviderBeanstalkd, ConnectionString: server.url(), Queue: "orders"}
+	ctx := context.Background()
+
+	pub, _ := factory.NewPublisher(ctx, cfg)
+	defer pub.Close(ctx)
+	sub, _ := factory.NewSubscriber(ctx, cfg)
+	defer sub.Close(ctx)
+	pub.Publish(ctx, gokyu.NewMessage([]byte("slow")))
+
+	first := receive(t, sub)
+	server.advance(time.Minute)
+	if err := sub.Ack(ctx, first); !errors.Is(err, ErrVisibilityExpired) {
+		t.Errorf("Ack() after time-to-run error = %v, want ErrVisibilityExpired", err)
+	}
+
+	second := receive(t, sub)
+	if err := sub.Nack(ctx, first); !errors.Is(err, ErrVisibilityExpired) {
+		t.Errorf("Nack() of an earlier delivery error = %v, want ErrVisibilityExpired", err)
+	}
+	if err := sub.Ack(ctx, second); err != nil {
+		t.Errorf("Ack() error = %v", err)
+	}
+	if jobs := server.tube("orders"); len(jobs) != 0 {
+		t.Errorf("orders tube has %d jobs, want 0", len(jobs))
+	}
+}
+
+func TestRedeliveryDelay(t *testing.T) {
+	server := newFakeServer(t)
+	cfg := &gokyu.Config{
+		Provider:         gokyu.ProviderBeanstalkd,
+		ConnectionString: server.url(),
+		Queue:            "orders",
+		Redelivery:       &gokyu.RedeliveryPolicy{InitialDelay: time.Minute, MaxRedeliveries: 1},
+	}
+	ctx := context.Background()
+
+	pub, _ := (&Factory{}).NewPublisher(ctx, cfg)
+	defer pub.Close(ctx)
+	sub, _ := (&Factory{}).NewSubscriber(ctx, cfg)
+	defer sub.Close(ctx)
+	pub.Publish(ctx, gokyu.NewMessage([]byte("retry")))
+
+	if err := sub.Nack(ctx, receive(t, sub)); err != nil {
+		t.Fatalf("Nack() error = %v", err)
+	}
+	jobs := server.tube("orders")
+	if len(jobs) != 1 || jobs[0].readyAt != time.Unix(1000, 0).Add(time.Minute) {
+		t.Fatalf("jobs = %+v, want one delayed a minute", jobs)
+	}
+
+	server.advance(time.Minute)
+	if err := sub.Nack(ctx, receive(t, sub)); err != nil {
+		t.Fatalf("Nack() error = %v", err)
+	}
+	if jobs := server.tube(deadLetterPrefix + "orders"); len(jobs) != 1 {
+		t.Errorf("dead-letter tube has %d jobs after the policy is exhausted, want 1", len(jobs))
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	server := newFakeServer(t)
+	clock := gokyu.NewFakeClock(time.Unix(1000, 0))
+	cfg := &gokyu.Config{Provider: gokyu.ProviderBeanstalkd, ConnectionString: server.url(), Queue: "orders"}
+	ctx := context.Background()
+
+	pub, _ := (&Factory{Clock: clock}).NewPublisher(ctx, cfg)
+	defer pub.Close(ctx)
+	sp := pub.(gokyu.ScheduledPublisher)
+
+	token, err := sp.Schedule(ctx, gokyu.NewMessage([]byte("later")), clock.Now().Add(90*time.Second))
+	if err != nil {
+		t.Fatalf("Schedule() error = %v", err)
+	}
+	jobs := server.tube("orders")
+	if len(jobs) != 1 || jobs[0].readyAt != clock.Now().Add(90*time.Second) {
+		t.Fatalf("jobs = %+v, want one delayed 90s", jobs)
+	}
+
+	if err := sp.CancelScheduled(ctx, token); err != nil {
+		t.Fatalf("CancelScheduled() error = %v", err)
+	}
+	if jobs := server.tube("orders"); len(jobs) != 0 {
+		t.Errorf("orders tube has %d jobs after cancel, want 0", len(jobs))
+	}
+}
+
+func TestPriority(t *testing.T) {
+	server := newFakeServer(t)
+	cfg := &gokyu.Config{Provider: gokyu.ProviderBeanstalkd, ConnectionString: server.url(), Queue: "orders"}
+	ctx := context.Background()
+
+	pub, _ := (&Factory{}).NewPublisher(ctx, cfg)
+	defer pub.Close(ctx)
+	for _, p := range []uint8{0, 9, 1} {
+		msg := gokyu.NewMessage([]byte{'0' + p})
+		msg.Priority = p
+		if err := pub.Publish(ctx, msg); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+
+	sub, _ := (&Factory{}).NewSubscriber(ctx, cfg)
+	defer sub.Close(ctx)
+	var order []string
+	for i := 0; i < 3; i++ {
+		msg := receive(t, sub)
+		order = append(order, string(msg.Body))
+		if string(msg.Body) == "9" && msg.Priority != 9 {
+			t.Errorf("Priority = %d, want 9", msg.Priority)
+		}
+		sub.Ack(ctx, msg)
+	}
+	if got := strings.Join(order, ","); got != "9,0,1" {
+		t.Errorf("received %s, want 9,0,1", got)
+	}
+}
+
+func TestTopicFanOut(t *testing.T) {
+	server := newFakeServer(t)
+	ctx := context.Background()
+
+	var subs []gokyu.Subscriber
+	for _, name := range []string{"billing", "shipping"} {
+		sub, err := (&Factory{}).NewSubscriber(ctx, &gokyu.Config{Provider: gokyu.ProviderBeanstalkd, ConnectionString: server.url(), Topic: "orders", Subscription: name})
+		if err != nil {
+			t.Fatalf("NewSubscriber() error = %v", err)
+		}
+		defer sub.Close(ctx)
+		subs = append(subs, sub)
+	}
+
+	pub, _ := (&Factory{}).NewPublisher(ctx, &gokyu.Config{Provider: gokyu.ProviderBeanstalkd, ConnectionString: server.url(), Topic: "orders"})
+	defer pub.Close(ctx)
+	if err := pub.Publish(ctx, gokyu.NewMessage([]byte("created"))); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	for _, sub := range subs {
+		msg := receive(t, sub)
+		if string(msg.Body) != "created" {
+			t.Errorf("Body = %q", msg.Body)
+		}
+		sub.Ack(ctx, msg)
+	}
+	if jobs := server.tube(deadLetterPrefix + "orders/billing"); len(jobs) != 0 {
+		t.Errorf("dead-letter tube received the topic message")
+	}
+}
+
+func TestForeignJob(t *testing.T) {
+	msg := decode([]byte(`{"task":"resize"}`))
+	if string(msg.Body) != `{"task":"resize"}` || msg.ID != "" {
+		t.Errorf("decode(foreign JSON) = %+v", msg)
+	}
+	if msg := decode([]byte("plain")); string(msg.Body) != "plain" {
+		t.Errorf("decode(plain) = %q", msg.Body)
+	}
+}
+
+func TestAddress(t *testing.T) {
+	tests := []struct {
+		cfg     gokyu.Config
+		want    string
+		wantErr bool
+	}{
+		{cfg: gokyu.Config{ConnectionString: "beanstalk://localhost"}, want: "localhost:11300"},
+		{cfg: gokyu.Config{ConnectionString: "beanstalk://jobs:11301"}, want: "jobs:11301"},
+		{cfg: gokyu.Config{Host: "::1"}, want: "[::1]:11300"},
+		{cfg: gokyu.Config{ConnectionString: "amqps://broker"}, wantErr: true},
+		{cfg: gokyu.Config{}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := address(&tt.cfg)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("address(%+v) = %q, %v, want %q", tt.cfg, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package beanstalkd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errNotFound is the NOT_FOUND response: the job does not exist or is not
+// reserved by this connection.
+var errNotFound = errors.New("beanstalkd: job not found")
+
+// conn is a connection speaking the beanstalkd text protocol. Commands are
+// serialized; jobs reserved on a connection can only be settled on it.
+type conn struct {
+	mu sync.Mutex
+	nc net.Conn
+	r  *bufio.Reader
+}
+
+func newConn(nc net.Conn) *conn {
+	return &conn{nc: nc, r: bufio.NewReader(nc)}
+}
+
+// do sends a command with an optional job body and returns the response
+// line, and the response body for responses that carry one. extra extends
+// the deadline beyond ctx for commands that block on the server.
+func (c *conn) do(ctx context.Context, extra time.Duration, body []byte, format string, args ...interface{}) (string, []byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(30 * time.Second)
+	}
+	c.nc.SetDeadline(deadline.Add(extra))
+
+	cmd := fmt.Sprintf(format, args...) + "\r\n"
+	if body != nil {
+		cmd += string(body) + "\r\n"
+	}
+	if _, err := c.nc.Write([]byte(cmd)); err != nil {
+		return "", nil, err
+	}
+
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+
+	// RESERVED <id> <bytes>, FOUND <id> <bytes> and OK <bytes> carry a body
+	fields := strings.Fields(line)
+	if len(fields) < 2 || (fields[0] != "RESERVED" && fields[0] != "FOUND" && fields[0] != "OK") {
+		return line, nil, nil
+	}
+	n, err := strconv.Atoi(fields[len(fields)-1])
+	if err != nil || n < 0 {
+		return "", nil, fmt.Errorf("beanstalkd: malformed response %q", line)
+	}
+	data := make([]byte, n+2)
+	if _, err := io.ReadFull(c.r, data); err != nil {
+		return "", nil, err
+	}
+	return line, data[:n], nil
+}
+
+// expect runs a command and checks that the response starts with want,
+// returning the remaining response fields.
+func (c *conn) expect(ctx context.Context, want string, body []byte, format string, args ...interface{}) ([]string, []byte, error) {
+	line, data, err := c.do(ctx, 0, body, format, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 || fields[0] != want {
+		return nil, nil, responseError(strings.Fields(format)[0], line)
+	}
+	return fields[1:], data, nil
+}
+
+// responseError maps an unexpected response to an error.
+func responseError(cmd, line string) error {
+	if line == "NOT_FOUND" {
+		return errNotFound
+	}
+	return fmt.Errorf("beanstalkd: %s: %s", cmd, line)
+}
+
+// put enqueues a job in the used tube and returns its ID.
+func (c *conn) put(ctx context.Context, pri uint32, delay, ttr time.Duration, body []byte) (uint64, error) {
+	fields, _, err := c.expect(ctx, "INSERTED", body, "put %d %d %d %d", pri, seconds(delay), seconds(ttr), len(body))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(fields[0], 10, 64)
+}
+
+// stats runs a stats command and parses its YAML dictionary.
+func (c *conn) stats(ctx context.Context, format string, args ...interface{}) (map[string]string, error) {
+	_, data, err := c.expect(ctx, "OK", nil, format, args...)
+	if err != nil {
+		return nil, err
+	}
+	stats := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		if k, v, ok := strings.Cut(line, ": "); ok {
+			stats[k] = strings.TrimSpace(v)
+		}
+	}
+	return stats, nil
+}
+
+// listTubes returns the names of the existing tubes.
+func (c *conn) listTubes(ctx context.Context) ([]string, error) {
+	_, data, err := c.expect(ctx, "OK", nil, "list-tubes")
+	if err != nil {
+		return nil, err
+	}
+	var tubes []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if name, ok := strings.CutPrefix(line, "- "); ok {
+			tubes = append(tubes, strings.TrimSpace(name))
+		}
+	}
+	return tubes, nil
+}
+
+// close closes the connection, interrupting a blocked command.
+func (c *conn) close() error {
+	return c.nc.Close()
+}
+
+// seconds rounds d up to whole seconds, the protocol's resolution.
+func seconds(d time.Duration) int64 {
+	if d <= 0 {
+		return 0
+	}
+	return int64((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,270 @@
+package beanstalkd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer is an in-memory beanstalkd that understands the commands
+// issued by this package. Its clock only moves with advance, so delays and
+// time-to-run can be tested without sleeping.
+type fakeServer struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	now      time.Time
+	nextID   uint64
+	jobs     map[uint64]*fakeJob
+	sessions map[*fakeSession]bool
+}
+
+type fakeJob struct {
+	id       uint64
+	tube     string
+	pri      uint32
+	ttr      time.Duration
+	data     []byte
+	readyAt  time.Time // delayed until
+	reserver *fakeSession
+	deadline time.Time // time-to-run deadline while reserved
+	reserves int
+}
+
+// fakeSession is the state of a client connection.
+type fakeSession struct {
+	use   string
+	watch map[string]bool
+}
+
+// newFakeServer starts a fake server and returns it.
+func newFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{ln: ln, now: time.Unix(1000, 0), jobs: make(map[uint64]*fakeJob), sessions: make(map[*fakeSession]bool)}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(nc)
+		}
+	}()
+	return s
+}
+
+// url returns the connection string of the server.
+func (s *fakeServer) url() string {
+	return "beanstalk://" + s.ln.Addr().String()
+}
+
+// advance moves the server clock forward.
+func (s *fakeServer) advance(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = s.now.Add(d)
+}
+
+// tube returns the jobs in a tube ordered by ID.
+func (s *fakeServer) tube(name string) []*fakeJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var jobs []*fakeJob
+	for _, job := range s.jobs {
+		if job.tube == name {
+			copy := *job
+			jobs = append(jobs, &copy)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].id < jobs[j].id })
+	return jobs
+}
+
+func (s *fakeServer) serve(nc net.Conn) {
+	defer nc.Close()
+	sess := &fakeSession{use: "default", watch: map[string]bool{"default": true}}
+	s.mu.Lock()
+	s.sessions[sess] = true
+	s.mu.Unlock()
+	defer func() {
+		// Jobs reserved by a closed connection are released
+		s.mu.Lock()
+		delete(s.sessions, sess)
+		for _, job := range s.jobs {
+			if job.reserver == sess {
+				job.reserver = nil
+			}
+		}
+		s.mu.Unlock()
+	}()
+
+	r := bufio.NewReader(nc)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			return
+		}
+		var body []byte
+		if args[0] == "put" {
+			n, _ := strconv.Atoi(args[4])
+			body = make([]byte, n+2)
+			if _, err := io.ReadFull(r, body); err != nil {
+				return
+			}
+			body = body[:n]
+		}
+		if args[0] == "quit" {
+			return
+		}
+		if _, err := nc.Write([]byte(s.handle(sess, args, body) + "\r\n")); err != nil {
+			return
+		}
+	}
+}
+
+// handle executes a command and returns the response.
+func (s *fakeServer) handle(sess *fakeSession, args []string, body []byte) string {
+	num := func(i int) uint64 {
+		n, _ := strconv.ParseUint(args[i], 10, 64)
+		return n
+	}
+
+	if args[0] == "reserve-with-timeout" {
+		timeout := time.Duration(num(1)) * time.Second
+		for start := time.Now(); ; {
+			if resp, ok := s.reserve(sess); ok {
+				return resp
+			}
+			if time.Since(start) >= timeout {
+				return "TIMED_OUT"
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire()
+
+	switch args[0] {
+	case "use":
+		sess.use = args[1]
+		return "USING " + args[1]
+	case "watch":
+		sess.watch[args[1]] = true
+		return fmt.Sprintf("WATCHING %d", len(sess.watch))
+	case "ignore":
+		delete(sess.watch, args[1])
+		return fmt.Sprintf("WATCHING %d", len(sess.watch))
+	case "put":
+		s.nextID++
+		s.jobs[s.nextID] = &fakeJob{
+			id:      s.nextID,
+			tube:    sess.use,
+			pri:     uint32(num(1)),
+			readyAt: s.now.Add(time.Duration(num(2)) * time.Second),
+			ttr:     time.Duration(num(3)) * time.Second,
+			data:    body,
+		}
+		return fmt.Sprintf("INSERTED %d", s.nextID)
+	case "delete":
+		job := s.jobs[num(1)]
+		if job == nil || (job.reserver != nil && job.reserver != sess) {
+			return "NOT_FOUND"
+		}
+		delete(s.jobs, job.id)
+		return "DELETED"
+	case "release":
+		job := s.jobs[num(1)]
+		if job == nil || job.reserver != sess {
+			return "NOT_FOUND"
+		}
+		job.reserver = nil
+		job.pri = uint32(num(2))
+		job.readyAt = s.now.Add(time.Duration(num(3)) * time.Second)
+		return "RELEASED"
+	case "stats-job":
+		job := s.jobs[num(1)]
+		if job == nil {
+			return "NOT_FOUND"
+		}
+		state := "ready"
+		if job.reserver != nil {
+			state = "reserved"
+		} else if job.readyAt.After(s.now) {
+			state = "delayed"
+		}
+		yaml := fmt.Sprintf("---\nid: %d\ntube: %s\nstate: %s\npri: %d\nreserves: %d\n", job.id, job.tube, state, job.pri, job.reserves)
+		return fmt.Sprintf("OK %d\r\n%s", len(yaml), yaml)
+	case "list-tubes":
+		tubes := map[string]bool{"default": true}
+		for _, job := range s.jobs {
+			tubes[job.tube] = true
+		}
+		for sess := range s.sessions {
+			for tube := range sess.watch {
+				tubes[tube] = true
+			}
+		}
+		var names []string
+		for tube := range tubes {
+			names = append(names, tube)
+		}
+		sort.Strings(names)
+		yaml := "---\n"
+		for _, name := range names {
+			yaml += "- " + name + "\n"
+		}
+		return fmt.Sprintf("OK %d\r\n%s", len(yaml), yaml)
+	}
+	return "UNKNOWN_COMMAND"
+}
+
+// expire releases reserved jobs whose time-to-run has passed.
+func (s *fakeServer) expire() {
+	for _, job := range s.jobs {
+		if job.reserver != nil && !s.now.Before(job.deadline) {
+			job.reserver = nil
+		}
+	}
+}
+
+// reserve reserves the most urgent ready job in a watched tube.
+func (s *fakeServer) reserve(sess *fakeSession) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expire()
+
+	var best *fakeJob
+	for _, job := range s.jobs {
+		if !sess.watch[job.tube] || job.reserver != nil || job.readyAt.After(s.now) {
+			continue
+		}
+		if best == nil || job.pri < best.pri || (job.pri == best.pri && job.id < best.id) {
+			best = job
+		}
+	}
+	if best == nil {
+		return "", false
+	}
+	best.reserver = sess
+	best.reserves++
+	best.deadline = s.now.Add(best.ttr)
+	return fmt.Sprintf("RESERVED %d %d\r\n%s", best.id, len(best.data), best.data), true
+}
@@ -0,0 +1,660 @@
+// Package file provides a gokyu provider that stores messages as files in a
+// directory, for local development and air-gapped demo environments. It
+// needs no broker, survives restarts, and can be shared by processes on the
+// same machine.
+//
+// # Connection String Format
+//
+// The connection string names the root directory:
+//
+//	file:///var/lib/gokyu
+//	file://./data
+//
+// # Layout
+//
+// Each queue and topic subscription is a directory holding one JSON file
+// per message:
+//
+//	<root>/queues/<queue>/ready/          messages waiting to be received
+//	<root>/queues/<queue>/inflight/       received and not yet settled
+//	<root>/queues/<queue>/deadletter/     a queue of dead-lettered messages
+//	<root>/topics/<topic>/<subscription>/ the same, per subscription
+//
+// Files are named so that they sort in publish order and are moved between
+// directories with atomic renames, so concurrent subscribers never receive
+// the same message twice. A received message that is not settled within the
+// visibility timeout, e.g. because its process crashed, is returned to
+// ready/ and delivered again.
+//
+// Subscribers create their directory, and publishing to a topic writes a
+// copy of the message to every subscription directory that exists.
+//
+// # Dead Letters
+//
+// A message is moved to the deadletter queue, with a gokyu.FailureRecord,
+// when it is nacked or times out after MaxDeliveries deliveries.
+// Client.NewDeadLetterSubscriber receives from it.
+//
+// # Usage
+//
+// Import this package to register the file provider:
+//
+//	import _ "github.com/venderneutral/gokyu/providers/file"
+package file
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/venderneutral/gokyu"
+)
+
+func init() {
+	gokyu.RegisterProvider(gokyu.ProviderFile, &Factory{})
+}
+
+// ErrVisibilityExpired is returned by Ack and Nack when the visibility
+// timeout of a message expired and it was returned to the queue.
+var ErrVisibilityExpired = errors.New("file: visibility timeout expired")
+
+// Factory creates file publishers and subscribers.
+type Factory struct {
+	// Dir is the root directory. If empty, it is taken from
+	// gokyu.Config.ConnectionString.
+	Dir string
+
+	// PollInterval is how long Receive waits before checking an empty queue
+	// again (default: 100ms).
+	PollInterval time.Duration
+
+	// VisibilityTimeout is how long a received message may stay unsettled
+	// before it is delivered again (default: 1m).
+	VisibilityTimeout time.Duration
+
+	// MaxDeliveries is the number of deliveries after which a message is
+	// dead-lettered (default: 10).
+	MaxDeliveries int
+
+	// Clock is the time source for file names and visibility (default:
+	// gokyu.SystemClock).
+	Clock gokyu.Clock
+}
+
+// settings are the factory settings with defaults applied.
+type settings struct {
+	root          string
+	pollInterval  time.Duration
+	visibility    time.Duration
+	maxDeliveries int
+	clock         gokyu.Clock
+}
+
+func (f *Factory) settings(cfg *gokyu.Config) (settings, error) {
+	s := settings{
+		root:          f.Dir,
+		pollInterval:  f.PollInterval,
+		visibility:    f.VisibilityTimeout,
+		maxDeliveries: f.MaxDeliveries,
+		clock:         f.Clock,
+	}
+	if s.root == "" {
+		if !strings.HasPrefix(cfg.ConnectionString, "file://") {
+			return s, gokyu.ErrInvalidConfig("file connection string must start with file://")
+		}
+		s.root = strings.TrimPrefix(cfg.ConnectionString, "file://")
+	}
+	if s.pollInterval <= 0 {
+		s.pollInterval = 100 * time.Millisecond
+	}
+	if s.visibility <= 0 {
+		s.visibility = time.Minute
+	}
+	if s.maxDeliveries <= 0 {
+		s.maxDeliveries = 10
+	}
+	if s.clock == nil {
+		s.clock = gokyu.SystemClock
+	}
+	return s, nil
+}
+
+// Guarantees describes the delivery guarantees of the file provider.
+func (f *Factory) Guarantees() gokyu.Guarantees {
+	return gokyu.Guarantees{
+		Delivery:      gokyu.AtLeastOnce,
+		Ordering:      gokyu.OrderingQueue,
+		Deduplication: gokyu.Unsupported,
+		Notes: []string{
+			"messages not settled within the visibility timeout are redelivered",
+		},
+	}
+}
+
+// Ping checks that the root directory exists.
+func (f *Factory) Ping(ctx context.Context, cfg *gokyu.Config) error {
+	s, err := f.settings(cfg)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(s.root)
+	if err == nil && !info.IsDir() {
+		err = fmt.Errorf("file: %s is not a directory", s.root)
+	}
+	if err != nil {
+		return gokyu.WrapError(gokyu.ErrConnectionFailed, err)
+	}
+	return nil
+}
+
+// queueDir is the directory of a queue or topic subscription.
+type queueDir string
+
+func (q queueDir) ready() string        { return filepath.Join(string(q), "ready") }
+func (q queueDir) inflight() string     { return filepath.Join(string(q), "inflight") }
+func (q queueDir) tmp() string          { return filepath.Join(string(q), "tmp") }
+func (q queueDir) deadLetter() queueDir { return queueDir(filepath.Join(string(q), "deadletter")) }
+
+// create creates the directories of the queue.
+func (q queueDir) create() error {
+	for _, dir := range []string{q.ready(), q.inflight(), q.tmp()} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// entityPath joins entity names below root, rejecting names that would
+// escape it.
+func entityPath(root string, elem ...string) (string, error) {
+	for _, name := range elem {
+		if name == "" || !filepath.IsLocal(name) {
+			return "", gokyu.ErrInvalidConfig(fmt.Sprintf("invalid entity name %q", name))
+		}
+	}
+	return filepath.Join(append([]string{root}, elem...)...), nil
+}
+
+// record is the JSON representation of a message file. Bodies that are
+// valid UTF-8 are stored as text so the files can be read and edited.
+type record struct {
+	ID           string                 `json:"id,omitempty"`
+	ContentType  string                 `json:"content_type,omitempty"`
+	Properties   map[string]interface{} `json:"properties,omitempty"`
+	Body         string                 `json:"body,omitempty"`
+	BodyBase64   []byte                 `json:"body_base64,omitempty"`
+	EnqueuedTime time.Time              `json:"enqueued_time"`
+	Deliveries   int                    `json:"deliveries"`
+}
+
+func newRecord(msg *gokyu.Message, now time.Time) *record {
+	rec := &record{
+		ID:           msg.ID,
+		ContentType:  msg.ContentType,
+		Properties:   msg.Properties,
+		EnqueuedTime: now.UTC(),
+	}
+	if utf8.Valid(msg.Body) {
+		rec.Body = string(msg.Body)
+	} else {
+		rec.BodyBase64 = msg.Body
+	}
+	return rec
+}
+
+// message converts the record to a gokyu message.
+func (r *record) message() *gokyu.Message {
+	msg := gokyu.NewMessage([]byte(r.Body))
+	if r.BodyBase64 != nil {
+		msg.Body = r.BodyBase64
+	}
+	msg.ID = r.ID
+	msg.ContentType = r.ContentType
+	msg.EnqueuedTime = r.EnqueuedTime
+	for k, v := range r.Properties {
+		if n, ok := v.(json.Number); ok {
+			if i, err := n.Int64(); err == nil {
+				v = i
+			} else if f, err := n.Float64(); err == nil {
+				v = f
+			}
+		}
+		msg.Properties[k] = v
+	}
+	return msg
+}
+
+// readRecord reads a message file.
+func readRecord(path string) (*record, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var rec record
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&rec); err != nil {
+		return nil, fmt.Errorf("file: decode %s: %w", filepath.Base(path), err)
+	}
+	return &rec, nil
+}
+
+// writeRecord writes a message file to dir/name atomically, via the tmp
+// directory of q.
+func writeRecord(q queueDir, dir, name string, rec *record) error {
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return fmt.Errorf("file: encode message: %w", err)
+	}
+	tmp, err := os.CreateTemp(q.tmp(), name+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, name)); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// sequence orders files published within the same clock tick.
+var sequence atomic.Uint64
+
+// fileName returns a new message file name that sorts after earlier ones.
+func fileName(now time.Time) string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%020d-%012d-%s.json", now.UnixNano(), sequence.Add(1), hex.EncodeToString(suffix))
+}
+
+// NewPublisher creates a publisher for the configured topic or queue.
+func (f *Factory) NewPublisher(ctx context.Context, cfg *gokyu.Config) (gokyu.Publisher, error) {
+	s, err := f.settings(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	pub := &publisher{settings: s}
+	if cfg.Topic != "" {
+		pub.topicDir, err = entityPath(s.root, "topics", cfg.Topic)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(pub.topicDir, 0o755); err != nil {
+			return nil, gokyu.WrapError(gokyu.ErrConnectionFailed, err)
+		}
+	} else {
+		dir, err := entityPath(s.root, "queues", cfg.Queue)
+		if err != nil {
+			return nil, err
+		}
+		pub.queue = queueDir(dir)
+		if err := pub.queue.create(); err != nil {
+			return nil, gokyu.WrapError(gokyu.ErrConnectionFailed, err)
+		}
+	}
+	return pub, nil
+}
+
+// publisher implements gokyu.Publisher by writing message files.
+type publisher struct {
+	settings settings
+	queue    queueDir // destination queue, or empty to publish to topicDir
+	topicDir string
+	closed   atomic.Bool
+}
+
+func (p *publisher) Publish(ctx context.Context, msg *gokyu.Message) error {
+	if p.closed.Load() {
+		return gokyu.ErrClosed
+	}
+	if msg.BodyValue != nil {
+		return gokyu.WrapError(gokyu.ErrPublishFailed, errors.New("file: BodyValue is not supported"))
+	}
+
+	now := p.settings.clock.Now()
+	rec := newRecord(msg, now)
+	name := fileName(now)
+
+	targets := []queueDir{p.queue}
+	if p.queue == "" {
+		entries, err := os.ReadDir(p.topicDir)
+		if err != nil {
+			return gokyu.WrapError(gokyu.ErrPublishFailed, err)
+		}
+		targets = targets[:0]
+		for _, e := range entries {
+			if e.IsDir() {
+				targets = append(targets, queueDir(filepath.Join(p.topicDir, e.Name())))
+			}
+		}
+	}
+	for _, q := range targets {
+		if err := writeRecord(q, q.ready(), name, rec); err != nil {
+			return gokyu.WrapError(gokyu.ErrPublishFailed, err)
+		}
+	}
+	return nil
+}
+
+func (p *publisher) Close(ctx context.Context) error {
+	p.closed.Store(true)
+	return nil
+}
+
+// NewSubscriber creates a subscriber for the configured queue or topic
+// subscription, creating its directories.
+func (f *Factory) NewSubscriber(ctx context.Context, cfg *gokyu.Config) (gokyu.Subscriber, error) {
+	s, err := f.settings(cfg)
+	if err != nil {
+		return nil, err
+	}
+	q, err := subscriberDir(s.root, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return newSubscriber(s, q, cfg, s.maxDeliveries)
+}
+
+// subscriberDir returns the directory of the configured queue or topic
+// subscription.
+func subscriberDir(root string, cfg *gokyu.Config) (queueDir, error) {
+	var (
+		dir string
+		err error
+	)
+	if cfg.Queue != "" {
+		dir, err = entityPath(root, "queues", cfg.Queue)
+	} else {
+		dir, err = entityPath(root, "topics", cfg.Topic, cfg.Subscription)
+	}
+	return queueDir(dir), err
+}
+
+// delivery identifies a received message file.
+type delivery struct {
+	name string
+	rec  *record
+}
+
+// subscriber implements gokyu.Subscriber over a queue directory.
+type subscriber struct {
+	settings settings
+	queue    queueDir
+	cfg      *gokyu.Config
+	identity *gokyu.Receiver
+
+	// maxDeliveries is the delivery count at which messages are
+	// dead-lettered, or 0 to never dead-letter
+	maxDeliveries int
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newSubscriber(s settings, q queueDir, cfg *gokyu.Config, maxDeliveries int) (*subscriber, error) {
+	if err := q.create(); err != nil {
+		return nil, gokyu.WrapError(gokyu.ErrConnectionFailed, err)
+	}
+	return &subscriber{
+		settings:      s,
+		queue:         q,
+		cfg:           cfg,
+		identity:      gokyu.NewReceiver(cfg),
+		maxDeliveries: maxDeliveries,
+		done:          make(chan struct{}),
+	}, nil
+}
+
+func (s *subscriber) Receive(ctx context.Context) (*gokyu.Message, error) {
+	for {
+		select {
+		case <-s.done:
+			return nil, gokyu.ErrClosed
+		default:
+		}
+
+		msg, err := s.claim()
+		if err != nil {
+			return nil, gokyu.WrapError(gokyu.ErrReceiveFailed, err)
+		}
+		if msg != nil {
+			msg.Receiver = s.identity
+			return msg, nil
+		}
+
+		timer := s.settings.clock.NewTimer(s.settings.pollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, gokyu.WrapError(gokyu.ErrReceiveFailed, ctx.Err())
+		case <-s.done:
+			timer.Stop()
+			return nil, gokyu.ErrClosed
+		case <-timer.C():
+		}
+	}
+}
+
+// messageFiles returns the names of the message files in dir in publish
+// order.
+func messageFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".json") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// claim moves the oldest ready message to inflight and returns it, or nil
+// if none is ready. Messages that have reached the delivery limit are
+// dead-lettered instead.
+func (s *subscriber) claim() (*gokyu.Message, error) {
+	if err := s.requeueExpired(); err != nil {
+		return nil, err
+	}
+	names, err := messageFiles(s.queue.ready())
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		path := filepath.Join(s.queue.inflight(), name)
+		if err := os.Rename(filepath.Join(s.queue.ready(), name), path); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue // claimed by another subscriber
+			}
+			return nil, err
+		}
+		now := s.settings.clock.Now()
+		os.Chtimes(path, now, now)
+
+		rec, err := readRecord(path)
+		if err != nil {
+			// Set the file aside so it is not delivered again
+			os.Rename(path, path+".corrupt")
+			return nil, err
+		}
+
+		// Messages whose visibility timeout expired too often were never
+		// settled, e.g. because their handler crashed the process
+		d := &delivery{name: name, rec: rec}
+		if s.maxDeliveries > 0 && rec.Deliveries >= s.maxDeliveries {
+			if err := s.deadLetter(d, fmt.Errorf("file: not settled after %d deliveries", rec.Deliveries)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		rec.Deliveries++
+		if err := writeRecord(s.queue, s.queue.inflight(), name, rec); err != nil {
+			return nil, err
+		}
+		os.Chtimes(path, now, now)
+
+		msg := rec.message()
+		msg.SetRaw(d)
+		return msg, nil
+	}
+	return nil, nil
+}
+
+// requeueExpired returns inflight messages whose visibility timeout expired
+// to ready.
+func (s *subscriber) requeueExpired() error {
+	names, err := messageFiles(s.queue.inflight())
+	if err != nil {
+		return err
+	}
+	deadline := s.settings.clock.Now().Add(-s.settings.visibility)
+	for _, name := range names {
+		path := filepath.Join(s.queue.inflight(), name)
+		info, err := os.Stat(path)
+		if err != nil || !info.ModTime().Before(deadline) {
+			continue
+		}
+		if err := os.Rename(path, filepath.Join(s.queue.ready(), name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// deadLetter moves an inflight message to the dead-letter queue.
+func (s *subscriber) deadLetter(d *delivery, reason error) error {
+	msg := d.rec.message()
+	failure := gokyu.NewFailureRecord(msg, reason, "file", d.rec.Deliveries, s.settings.clock.Now())
+	dead, err := gokyu.NewDeadLetterMessage(msg, failure)
+	if err != nil {
+		return err
+	}
+	rec := newRecord(dead, d.rec.EnqueuedTime)
+	rec.Deliveries = d.rec.Deliveries
+
+	dlq := s.queue.deadLetter()
+	if err := dlq.create(); err != nil {
+		return err
+	}
+	if err := writeRecord(dlq, dlq.ready(), d.name, rec); err != nil {
+		return err
+	}
+	if err := os.Remove(filepath.Join(s.queue.inflight(), d.name)); err != nil {
+		return err
+	}
+	gokyu.ReportDeadLetter(s.cfg, msg, failure)
+	return nil
+}
+
+func (s *subscriber) Ack(ctx context.Context, msg *gokyu.Message) error {
+	d, ok := msg.Raw().(*delivery)
+	if !ok {
+		return gokyu.ErrAckFailed
+	}
+	if err := s.owned(d); err != nil {
+		return settleError(err)
+	}
+	if err := os.Remove(filepath.Join(s.queue.inflight(), d.name)); err != nil {
+		return settleError(err)
+	}
+	return nil
+}
+
+// Nack returns the message to the queue, or dead-letters it if it has
+// reached the delivery limit.
+func (s *subscriber) Nack(ctx context.Context, msg *gokyu.Message) error {
+	d, ok := msg.Raw().(*delivery)
+	if !ok {
+		return gokyu.ErrAckFailed
+	}
+	if err := s.owned(d); err != nil {
+		return settleError(err)
+	}
+
+	if s.maxDeliveries > 0 && d.rec.Deliveries >= s.maxDeliveries {
+		if err := s.deadLetter(d, fmt.Errorf("file: nacked after %d deliveries", d.rec.Deliveries)); err != nil {
+			return gokyu.WrapError(gokyu.ErrAckFailed, err)
+		}
+		return nil
+	}
+	if err := os.Rename(filepath.Join(s.queue.inflight(), d.name), filepath.Join(s.queue.ready(), d.name)); err != nil {
+		return settleError(err)
+	}
+	return nil
+}
+
+// owned reports fs.ErrNotExist if the inflight file of d is gone or belongs
+// to a later delivery of the message.
+func (s *subscriber) owned(d *delivery) error {
+	rec, err := readRecord(filepath.Join(s.queue.inflight(), d.name))
+	if err != nil {
+		return err
+	}
+	if rec.Deliveries != d.rec.Deliveries {
+		return fs.ErrNotExist
+	}
+	return nil
+}
+
+// settleError maps a failed settlement to an error.
+func settleError(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %w", gokyu.ErrAckFailed, ErrVisibilityExpired)
+	}
+	return gokyu.WrapError(gokyu.ErrAckFailed, err)
+}
+
+func (s *subscriber) Close(ctx context.Context) error {
+	s.closeOnce.Do(func() { close(s.done) })
+	return nil
+}
+
+// NewDeadLetterSubscriber creates a subscriber for the dead-letter queue of
+// the configured queue or subscription, or of the queue named by
+// Config.DeadLetterQueue if set.
+func (f *Factory) NewDeadLetterSubscriber(ctx context.Context, cfg *gokyu.Config) (gokyu.Subscriber, error) {
+	s, err := f.settings(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var q queueDir
+	if cfg.DeadLetterQueue != "" {
+		dir, err := entityPath(s.root, "queues", cfg.DeadLetterQueue)
+		if err != nil {
+			return nil, err
+		}
+		q = queueDir(dir)
+	} else if q, err = subscriberDir(s.root, cfg); err != nil {
+		return nil, err
+	}
+	return newSubscriber(s, q.deadLetter(), cfg, 0)
+}
@@ -0,0 +1,259 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+	"github.com/venderneutral/gokyu/conformance"
+)
+
+func TestConformance(t *testing.T) {
+	factory := &Factory{Dir: t.TempDir(), PollInterval: 10 * time.Millisecond}
+	cfg := &gokyu.Config{Provider: gokyu.ProviderFile, Queue: "orders"}
+
+	conformance.Run(t, factory, cfg, &conformance.Options{
+		ReceiveTimeout: 2 * time.Second,
+		QuietPeriod:    100 * time.Millisecond,
+	})
+}
+
+// receive receives a message or fails the test.
+func receive(t *testing.T, sub gokyu.Subscriber) *gokyu.Message {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	msg, err := sub.Receive(ctx)
+	if err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	return msg
+}
+
+func TestSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &gokyu.Config{Provider: gokyu.ProviderFile, ConnectionString: "file://" + dir, Queue: "orders", ConsumerID: "worker-1"}
+	ctx := context.Background()
+
+	pub, err := (&Factory{}).NewPublisher(ctx, cfg)
+	if err != nil {
+		t.Fatalf("NewPublisher() error = %v", err)
+	}
+	for _, body := range []string{"first", "second"} {
+		msg := gokyu.NewMessage([]byte(body))
+		msg.Properties["attempt"] = int64(1)
+		if err := pub.Publish(ctx, msg); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+	pub.Close(ctx)
+
+	sub, err := (&Factory{PollInterval: 10 * time.Millisecond}).NewSubscriber(ctx, cfg)
+	if err != nil {
+		t.Fatalf("NewSubscriber() error = %v", err)
+	}
+	defer sub.Close(ctx)
+	for _, want := range []string{"first", "second"} {
+		msg := receive(t, sub)
+		if string(msg.Body) != want || msg.Properties["attempt"] != int64(1) {
+			t.Errorf("message = %q %v, want %q", msg.Body, msg.Properties, want)
+		}
+		if msg.Receiver == nil || msg.Receiver.String() != "file:orders@worker-1" {
+			t.Errorf("Receiver = %v", msg.Receiver)
+		}
+		if err := sub.Ack(ctx, msg); err != nil {
+			t.Errorf("Ack() error = %v", err)
+		}
+	}
+	if names, _ := messageFiles(filepath.Join(dir, "queues", "orders", "inflight")); len(names) != 0 {
+		t.Errorf("inflight files after Ack = %v", names)
+	}
+}
+
+func TestBinaryBody(t *testing.T) {
+	factory := &Factory{Dir: t.TempDir(), PollInterval: 10 * time.Millisecond}
+	cfg := &gokyu.Config{Provider: gokyu.ProviderFile, Queue: "blobs"}
+	ctx := context.Background()
+
+	pub, _ := factory.NewPublisher(ctx, cfg)
+	sub, _ := factory.NewSubscriber(ctx, cfg)
+	defer sub.Close(ctx)
+
+	body := []byte{0xff, 0x00, 0xfe}
+	pub.Publish(ctx, gokyu.NewMessage(body))
+	if got := receive(t, sub).Body; string(got) != string(body) {
+		t.Errorf("Body = %x, want %x", got, body)
+	}
+}
+
+func TestVisibilityTimeout(t *testing.T) {
+	clock := gokyu.NewFakeClock(time.Unix(1000, 0))
+	factory := &Factory{Dir: t.TempDir(), VisibilityTimeout: time.Minute, MaxDeliveries: 2, Clock: clock}
+	cfg := &gokyu.Config{Provider: gokyu.ProviderFile, Queue: "orders"}
+	ctx := context.Background()
+
+	pub, _ := factory.NewPublisher(ctx, cfg)
+	sub, _ := factory.NewSubscriber(ctx, cfg)
+	defer sub.Close(ctx)
+	pub.Publish(ctx, gokyu.NewMessage([]byte("slow")))
+
+	first := receive(t, sub)
+	clock.Advance(2 * time.Minute)
+	second := receive(t, sub)
+	if string(second.Body) != "slow" {
+		t.Fatalf("redelivered Body = %q", second.Body)
+	}
+	if err := sub.Ack(ctx, first); !errors.Is(err, ErrVisibilityExpired) {
+		t.Errorf("Ack() of expired delivery error = %v, want ErrVisibilityExpired", err)
+	}
+	if err := sub.Ack(ctx, second); err != nil {
+		t.Errorf("Ack() error = %v", err)
+	}
+
+	// A message that keeps timing out is dead-lettered on the next receive
+	pub.Publish(ctx, gokyu.NewMessage([]byte("stuck")))
+	receive(t, sub)
+	clock.Advance(2 * time.Minute)
+	receive(t, sub)
+	clock.Advance(2 * time.Minute)
+	s := sub.(*subscriber)
+	if msg, err := s.claim(); err != nil || msg != nil {
+		t.Errorf("claim() = %v, %v, want the message dead-lettered", msg, err)
+	}
+	if names, _ := messageFiles(s.queue.deadLetter().ready()); len(names) != 1 {
+		t.Errorf("dead-letter files = %v, want 1", names)
+	}
+}
+
+func TestAckAfterVisibilityExpired(t *testing.T) {
+	clock := gokyu.NewFakeClock(time.Unix(1000, 0))
+	factory := &Factory{Dir: t.TempDir(), VisibilityTimeout: time.Minute, Clock: clock}
+	cfg := &gokyu.Config{Provider: gokyu.ProviderFile, Queue: "orders"}
+	ctx := context.Background()
+
+	pub, _ := factory.NewPublisher(ctx, cfg)
+	sub, _ := factory.NewSubscriber(ctx, cfg)
+	defer sub.Close(ctx)
+	pub.Publish(ctx, gokyu.NewMessage([]byte("slow")))
+
+	msg := receive(t, sub)
+	clock.Advance(2 * time.Minute)
+	if err := sub.(*subscriber).requeueExpired(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sub.Ack(ctx, msg); !errors.Is(err, ErrVisibilityExpired) {
+		t.Errorf("Ack() error = %v, want ErrVisibilityExpired", err)
+	}
+}
+
+func TestDeadLetterAfterMaxDeliveries(t *testing.T) {
+	factory := &Factory{Dir: t.TempDir(), PollInterval: 10 * time.Millisecond, MaxDeliveries: 2}
+	var events []gokyu.DeadLetterEvent
+	cfg := &gokyu.Config{
+		Provider:     gokyu.ProviderFile,
+		Queue:        "orders",
+		OnDeadLetter: func(e gokyu.DeadLetterEvent) { events = append(events, e) },
+	}
+	ctx := context.Background()
+
+	pub, _ := factory.NewPublisher(ctx, cfg)
+	sub, _ := factory.NewSubscriber(ctx, cfg)
+	defer sub.Close(ctx)
+
+	msg := gokyu.NewMessage([]byte("poison"))
+	msg.ID = "m-1"
+	msg.Properties["tenant"] = "acme"
+	if err := pub.Publish(ctx, msg); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := sub.Nack(ctx, receive(t, sub)); err != nil {
+			t.Fatalf("Nack() error = %v", err)
+		}
+	}
+
+	if len(events) != 1 || events[0].Message.ID != "m-1" || events[0].Record.Attempts != 2 {
+		t.Errorf("OnDeadLetter events = %+v", events)
+	}
+
+	dlq, err := factory.NewDeadLetterSubscriber(ctx, cfg)
+	if err != nil {
+		t.Fatalf("NewDeadLetterSubscriber() error = %v", err)
+	}
+	defer dlq.Close(ctx)
+
+	dead := receive(t, dlq)
+	if dead.ID != "m-1" || string(dead.Body) != "poison" || dead.Properties["tenant"] != "acme" {
+		t.Errorf("dead letter = %+v", dead)
+	}
+	if reason := gokyu.DeadLetterReason(dead); !strings.Contains(reason, "2 deliveries") {
+		t.Errorf("DeadLetterReason() = %q", reason)
+	}
+	if err := dlq.Ack(ctx, dead); err != nil {
+		t.Errorf("Ack() on dead letter error = %v", err)
+	}
+}
+
+func TestTopicFanOut(t *testing.T) {
+	dir := t.TempDir()
+	factory := &Factory{Dir: dir, PollInterval: 10 * time.Millisecond}
+	ctx := context.Background()
+
+	var subs []gokyu.Subscriber
+	for _, name := range []string{"billing", "shipping"} {
+		sub, err := factory.NewSubscriber(ctx, &gokyu.Config{Provider: gokyu.ProviderFile, Topic: "orders", Subscription: name})
+		if err != nil {
+			t.Fatalf("NewSubscriber() error = %v", err)
+		}
+		defer sub.Close(ctx)
+		subs = append(subs, sub)
+	}
+
+	pub, _ := factory.NewPublisher(ctx, &gokyu.Config{Provider: gokyu.ProviderFile, Topic: "orders"})
+	if err := pub.Publish(ctx, gokyu.NewMessage([]byte("created"))); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	for _, sub := range subs {
+		msg := receive(t, sub)
+		if string(msg.Body) != "created" {
+			t.Errorf("Body = %q", msg.Body)
+		}
+		sub.Ack(ctx, msg)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "topics", "orders", "billing", "ready")); err != nil {
+		t.Errorf("subscription directory: %v", err)
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	ctx := context.Background()
+	tests := []*gokyu.Config{
+		{Provider: gokyu.ProviderFile, ConnectionString: "amqps://broker", Queue: "orders"},
+		{Provider: gokyu.ProviderFile, ConnectionString: "file://" + t.TempDir(), Queue: "../escape"},
+	}
+	for _, cfg := range tests {
+		if _, err := (&Factory{}).NewPublisher(ctx, cfg); err == nil {
+			t.Errorf("NewPublisher(%q, %q) succeeded", cfg.ConnectionString, cfg.Queue)
+		}
+	}
+}
+
+func TestFactory_Ping(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &gokyu.Config{Provider: gokyu.ProviderFile, Queue: "orders"}
+
+	if err := (&Factory{Dir: dir}).Ping(context.Background(), cfg); err != nil {
+		t.Errorf("Ping() error = %v", err)
+	}
+	err := (&Factory{Dir: filepath.Join(dir, "missing")}).Ping(context.Background(), cfg)
+	if !errors.Is(err, gokyu.ErrConnectionFailed) {
+		t.Errorf("Ping() of a missing directory error = %v", err)
+	}
+}
@@ -10,4 +10,8 @@ package providers
 import (
 	_ "github.com/venderneutral/gokyu/providers/amazonmq"
 	_ "github.com/venderneutral/gokyu/providers/azure"
+	_ "github.com/venderneutral/gokyu/providers/beanstalkd"
+	_ "github.com/venderneutral/gokyu/providers/file"
+	_ "github.com/venderneutral/gokyu/providers/rabbitmq"
+	_ "github.com/venderneutral/gokyu/providers/sqlqueue"
 )
@@ -0,0 +1,191 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/venderneutral/gokyu"
+)
+
+// handshakeTimeout limits the connection handshake when the context has no
+// deadline.
+const handshakeTimeout = 30 * time.Second
+
+// conn is an AMQP 0-9-1 connection with one channel. Publishers and
+// subscribers have a connection of their own, so one channel suffices.
+type conn struct {
+	conn    *amqp.Connection
+	channel *amqp.Channel
+
+	done chan struct{}
+	err  error // set before done is closed
+}
+
+// dial connects to the configured broker, opens the connection and its
+// channel.
+func dial(ctx context.Context, cfg *gokyu.Config) (*conn, error) {
+	if cfg.WebSocket {
+		return nil, gokyu.ErrInvalidConfig("rabbitmq does not support AMQP 0-9-1 over WebSocket")
+	}
+	u, err := url.Parse(cfg.BuildConnectionString())
+	if err != nil {
+		return nil, gokyu.ErrInvalidConfig("invalid connection string")
+	}
+	creds, err := gokyu.ResolveCredentials(ctx, cfg, u)
+	if err != nil {
+		return nil, err
+	}
+	if creds == nil {
+		creds = &gokyu.Credentials{Username: "guest", Password: "guest"}
+	}
+	nc, err := gokyu.DialBroker(ctx, cfg, "")
+	if err != nil {
+		return nil, err
+	}
+
+	// amqp.Open clears the deadline once the handshake completes
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(handshakeTimeout)
+	}
+	nc.SetDeadline(deadline)
+	properties := amqp.NewConnectionProperties()
+	for k, v := range gokyu.ConnectionProperties(cfg) {
+		properties[k] = v
+	}
+	ac, err := amqp.Open(nc, amqp.Config{
+		SASL:       []amqp.Authentication{&amqp.PlainAuth{Username: creds.Username, Password: creds.Password}},
+		Vhost:      virtualHost(u),
+		ChannelMax: cfg.ChannelMax,
+		FrameSize:  int(min(cfg.MaxFrameSize, math.MaxInt32)),
+		Heartbeat:  heartbeat(cfg),
+		Properties: properties,
+		Locale:     "en_US",
+	})
+	if err != nil {
+		nc.Close()
+		if errors.Is(err, amqp.ErrCredentials) || errors.Is(err, amqp.ErrVhost) {
+			return nil, errors.New("rabbitmq: connection refused, check the credentials and virtual host")
+		}
+		return nil, fmt.Errorf("rabbitmq: %w", err)
+	}
+	ch, err := ac.Channel()
+	if err != nil {
+		ac.Close()
+		return nil, fmt.Errorf("rabbitmq: %w", err)
+	}
+
+	c := &conn{conn: ac, channel: ch, done: make(chan struct{})}
+	go c.watch(ch.NotifyClose(make(chan *amqp.Error, 1)))
+
+	if cfg.Events != nil {
+		addr := nc.RemoteAddr().String()
+		gokyu.EmitEvent(cfg, gokyu.Event{Type: gokyu.EventConnected, Detail: addr})
+		go func() {
+			<-c.done
+			var err error
+			if !errors.Is(c.err, gokyu.ErrClosed) {
+				err = c.err
+			}
+			gokyu.EmitEvent(cfg, gokyu.Event{Type: gokyu.EventDisconnected, Detail: addr, Err: err})
+		}()
+	}
+	return c, nil
+}
+
+// heartbeat returns the heartbeat interval to propose. The broker closes
+// connections silent for two intervals, so it is half of
+// Config.IdleTimeout. Zero accepts the interval the broker proposes.
+func heartbeat(cfg *gokyu.Config) time.Duration {
+	if cfg.IdleTimeout <= 0 {
+		return 0
+	}
+	return max(cfg.IdleTimeout/2, time.Second)
+}
+
+// prefetch returns Config.PrefetchCount with its default.
+func prefetch(cfg *gokyu.Config) int {
+	if cfg.PrefetchCount > 0 {
+		return cfg.PrefetchCount
+	}
+	return 1
+}
+
+// virtualHost returns the virtual host named by the URL path, "/" if none.
+// A vhost named "/" is written as %2F, as in other RabbitMQ clients.
+func virtualHost(u *url.URL) string {
+	vhost := strings.TrimPrefix(u.Path, "/")
+	if vhost == "" {
+		return "/"
+	}
+	return vhost
+}
+
+// watch records why the channel closed: the close method of the broker,
+// e.g. 404 NOT_FOUND for a missing exchange, a connection failure, or
+// gokyu.ErrClosed for a close of our own.
+func (c *conn) watch(closes <-chan *amqp.Error) {
+	if err, ok := <-closes; ok && err != nil {
+		c.err = fmt.Errorf("rabbitmq: %w", err)
+	} else {
+		c.err = gokyu.ErrClosed
+	}
+	close(c.done)
+}
+
+// closed returns the error the connection closed with once it has closed,
+// and nil before.
+func (c *conn) closed() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+// close closes the connection, waiting for the broker to confirm so that it
+// requeues unacknowledged deliveries without logging an error.
+func (c *conn) close() error {
+	if c.closed() != nil {
+		return nil
+	}
+	c.conn.CloseDeadline(time.Now().Add(time.Second))
+	timer := time.NewTimer(time.Second)
+	defer timer.Stop()
+	select {
+	case <-c.done:
+	case <-timer.C:
+	}
+	return nil
+}
+
+// brokerProperties returns the server properties of the connection.
+func (c *conn) brokerProperties() map[string]interface{} {
+	return c.conn.Properties
+}
+
+// closedError returns the error of an operation on the closed connection,
+// gokyu.ErrClosed after a close of our own.
+func (c *conn) closedError(sentinel error) error {
+	if errors.Is(c.err, gokyu.ErrClosed) {
+		return gokyu.ErrClosed
+	}
+	return gokyu.WrapError(sentinel, c.err)
+}
+
+// failed returns the error of a failed operation: that of the connection if
+// the channel has closed, otherwise err.
+func (c *conn) failed(sentinel, err error) error {
+	if c.channel.IsClosed() {
+		<-c.done
+		return c.closedError(sentinel)
+	}
+	return gokyu.WrapError(sentinel, err)
+}
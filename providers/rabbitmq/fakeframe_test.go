@@ -0,0 +1,519 @@
+package rabbitmq
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// The fake server speaks AMQP 0-9-1 with the framing below, written
+// against the specification so that the provider is tested against an
+// independent implementation of the protocol.
+
+// protocolHeader starts every AMQP 0-9-1 connection.
+var protocolHeader = []byte("AMQP\x00\x00\x09\x01")
+
+// Frame types.
+const (
+	frameMethod    = 1
+	frameHeader    = 2
+	frameBody      = 3
+	frameHeartbeat = 8
+	frameEnd       = 0xCE
+)
+
+// channelID is the channel the fake server answers on. The provider opens
+// one channel per connection, which is channel 1.
+const channelID = 1
+
+// Method classes and IDs used by the provider.
+const (
+	classConnection = 10
+	classChannel    = 20
+	classExchange   = 40
+	classQueue      = 50
+	classBasic      = 60
+	classConfirm    = 85
+
+	methodConnectionStart   = 10
+	methodConnectionStartOk = 11
+	methodConnectionTune    = 30
+	methodConnectionTuneOk  = 31
+	methodConnectionOpen    = 40
+	methodConnectionOpenOk  = 41
+	methodConnectionClose   = 50
+	methodConnectionCloseOk = 51
+
+	methodChannelOpen    = 10
+	methodChannelOpenOk  = 11
+	methodChannelClose   = 40
+	methodChannelCloseOk = 41
+
+	methodExchangeDeclare   = 10
+	methodExchangeDeclareOk = 11
+
+	methodQueueDeclare   = 10
+	methodQueueDeclareOk = 11
+	methodQueueBind      = 20
+	methodQueueBindOk    = 21
+
+	methodBasicQos       = 10
+	methodBasicQosOk     = 11
+	methodBasicConsume   = 20
+	methodBasicConsumeOk = 21
+	methodBasicCancel    = 30
+	methodBasicPublish   = 40
+	methodBasicReturn    = 50
+	methodBasicDeliver   = 60
+	methodBasicAck       = 80
+	methodBasicReject    = 90
+	methodBasicNack      = 120
+
+	methodConfirmSelect   = 10
+	methodConfirmSelectOk = 11
+)
+
+// Flags of the basic content properties, in property list order.
+const (
+	flagContentType     = 1 << 15
+	flagContentEncoding = 1 << 14
+	flagHeaders         = 1 << 13
+	flagDeliveryMode    = 1 << 12
+	flagPriority        = 1 << 11
+	flagCorrelationID   = 1 << 10
+	flagReplyTo         = 1 << 9
+	flagExpiration      = 1 << 8
+	flagMessageID       = 1 << 7
+	flagTimestamp       = 1 << 6
+	flagType            = 1 << 5
+	flagUserID          = 1 << 4
+	flagAppID           = 1 << 3
+)
+
+// frame is one AMQP frame.
+type frame struct {
+	typ     byte
+	channel uint16
+	payload []byte
+}
+
+// readFrame reads a frame.
+func readFrame(r *bufio.Reader) (frame, error) {
+	var head [7]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return frame{}, err
+	}
+	f := frame{typ: head[0], channel: binary.BigEndian.Uint16(head[1:3])}
+	size := binary.BigEndian.Uint32(head[3:7])
+	if size > 1<<28 {
+		return frame{}, fmt.Errorf("rabbitmq: frame of %d bytes", size)
+	}
+	f.payload = make([]byte, size+1)
+	if _, err := io.ReadFull(r, f.payload); err != nil {
+		return frame{}, err
+	}
+	if f.payload[size] != frameEnd {
+		return frame{}, errors.New("rabbitmq: malformed frame")
+	}
+	f.payload = f.payload[:size]
+	return f, nil
+}
+
+// appendFrame appends a frame to buf.
+func appendFrame(buf []byte, typ byte, channel uint16, payload []byte) []byte {
+	buf = append(buf, typ)
+	buf = binary.BigEndian.AppendUint16(buf, channel)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(payload)))
+	buf = append(buf, payload...)
+	return append(buf, frameEnd)
+}
+
+// encoder writes method arguments and content headers.
+type encoder struct {
+	buf  bytes.Buffer
+	bits byte
+	nbit int
+	err  error
+}
+
+// newMethod starts the payload of a method frame.
+func newMethod(class, method uint16) *encoder {
+	e := &encoder{}
+	e.short(class)
+	e.short(method)
+	return e
+}
+
+// flush writes pending bits.
+func (e *encoder) flush() {
+	if e.nbit > 0 {
+		e.buf.WriteByte(e.bits)
+		e.bits, e.nbit = 0, 0
+	}
+}
+
+// bit packs consecutive bits into octets.
+func (e *encoder) bit(b bool) {
+	if e.nbit == 8 {
+		e.flush()
+	}
+	if b {
+		e.bits |= 1 << e.nbit
+	}
+	e.nbit++
+}
+
+func (e *encoder) octet(v byte) {
+	e.flush()
+	e.buf.WriteByte(v)
+}
+
+func (e *encoder) short(v uint16) {
+	e.flush()
+	binary.Write(&e.buf, binary.BigEndian, v)
+}
+
+func (e *encoder) long(v uint32) {
+	e.flush()
+	binary.Write(&e.buf, binary.BigEndian, v)
+}
+
+func (e *encoder) longlong(v uint64) {
+	e.flush()
+	binary.Write(&e.buf, binary.BigEndian, v)
+}
+
+func (e *encoder) shortstr(s string) {
+	e.flush()
+	if len(s) > 255 {
+		e.fail(fmt.Errorf("rabbitmq: %q exceeds 255 bytes", s))
+		s = s[:255]
+	}
+	e.buf.WriteByte(byte(len(s)))
+	e.buf.WriteString(s)
+}
+
+func (e *encoder) longstr(s []byte) {
+	e.long(uint32(len(s)))
+	e.buf.Write(s)
+}
+
+// table writes a field table.
+func (e *encoder) table(t map[string]interface{}) {
+	var fields encoder
+	for k, v := range t {
+		fields.shortstr(k)
+		fields.value(v)
+	}
+	e.fail(fields.err)
+	e.longstr(fields.buf.Bytes())
+}
+
+// value writes a typed field value. Values are those of message properties
+// (see gokyu.NormalizeProperties) and nested tables and arrays.
+func (e *encoder) value(v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		e.octet('V')
+	case bool:
+		e.octet('t')
+		if v {
+			e.octet(1)
+		} else {
+			e.octet(0)
+		}
+	case int8:
+		e.octet('b')
+		e.octet(byte(v))
+	case uint8:
+		e.octet('B')
+		e.octet(v)
+	case int16:
+		e.octet('s')
+		e.short(uint16(v))
+	case uint16:
+		e.octet('u')
+		e.short(v)
+	case int32:
+		e.octet('I')
+		e.long(uint32(v))
+	case uint32:
+		e.octet('i')
+		e.long(v)
+	case int64:
+		e.octet('l')
+		e.longlong(uint64(v))
+	case int:
+		e.octet('l')
+		e.longlong(uint64(v))
+	case uint64:
+		if v > math.MaxInt64 {
+			e.fail(fmt.Errorf("rabbitmq: %d exceeds the signed 64-bit field range", v))
+		}
+		e.octet('l')
+		e.longlong(v)
+	case float32:
+		e.octet('f')
+		e.long(math.Float32bits(v))
+	case float64:
+		e.octet('d')
+		e.longlong(math.Float64bits(v))
+	case string:
+		e.octet('S')
+		e.longstr([]byte(v))
+	case []byte:
+		e.octet('x')
+		e.longstr(v)
+	case time.Time:
+		e.octet('T')
+		e.longlong(uint64(v.Unix()))
+	case map[string]interface{}:
+		e.octet('F')
+		e.table(v)
+	case []interface{}:
+		e.octet('A')
+		var items encoder
+		for _, item := range v {
+			items.value(item)
+		}
+		e.fail(items.err)
+		e.longstr(items.buf.Bytes())
+	default:
+		e.fail(fmt.Errorf("rabbitmq: unsupported field value %T", v))
+		e.octet('V')
+	}
+}
+
+// fail records the first error.
+func (e *encoder) fail(err error) {
+	if e.err == nil {
+		e.err = err
+	}
+}
+
+// bytes returns the encoded payload.
+func (e *encoder) bytes() ([]byte, error) {
+	e.flush()
+	return e.buf.Bytes(), e.err
+}
+
+// decoder reads method arguments and content headers. Reads past the end
+// leave zero values and record an error.
+type decoder struct {
+	buf  []byte
+	bits byte
+	nbit int
+	err  error
+}
+
+func newDecoder(payload []byte) *decoder {
+	return &decoder{buf: payload}
+}
+
+// take returns the next n bytes.
+func (d *decoder) take(n int) []byte {
+	d.nbit = 0
+	if n > len(d.buf) {
+		if d.err == nil {
+			d.err = errors.New("rabbitmq: truncated frame")
+		}
+		d.buf = nil
+		return make([]byte, n)
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) bit() bool {
+	if d.nbit == 0 || d.nbit == 8 {
+		d.bits = d.take(1)[0]
+		d.nbit = 0
+	}
+	b := d.bits&(1<<d.nbit) != 0
+	d.nbit++
+	return b
+}
+
+func (d *decoder) octet() byte      { return d.take(1)[0] }
+func (d *decoder) short() uint16    { return binary.BigEndian.Uint16(d.take(2)) }
+func (d *decoder) long() uint32     { return binary.BigEndian.Uint32(d.take(4)) }
+func (d *decoder) longlong() uint64 { return binary.BigEndian.Uint64(d.take(8)) }
+func (d *decoder) shortstr() string { return string(d.take(int(d.octet()))) }
+func (d *decoder) longstr() []byte  { return append([]byte(nil), d.take(int(d.long()))...) }
+func (d *decoder) table() map[string]interface{} {
+	fields := newDecoder(d.longstr())
+	t := make(map[string]interface{})
+	for len(fields.buf) > 0 && fields.err == nil {
+		k := fields.shortstr()
+		t[k] = fields.value()
+	}
+	if fields.err != nil && d.err == nil {
+		d.err = fields.err
+	}
+	return t
+}
+
+// value reads a typed field value.
+func (d *decoder) value() interface{} {
+	switch typ := d.octet(); typ {
+	case 'V':
+		return nil
+	case 't':
+		return d.octet() != 0
+	case 'b':
+		return int8(d.octet())
+	case 'B':
+		return d.octet()
+	case 's':
+		return int16(d.short())
+	case 'u':
+		return d.short()
+	case 'I':
+		return int32(d.long())
+	case 'i':
+		return d.long()
+	case 'l', 'L':
+		return int64(d.longlong())
+	case 'f':
+		return math.Float32frombits(d.long())
+	case 'd':
+		return math.Float64frombits(d.longlong())
+	case 'D':
+		scale := d.octet()
+		return float64(int32(d.long())) / math.Pow10(int(scale))
+	case 'S':
+		return string(d.longstr())
+	case 'x':
+		return d.longstr()
+	case 'T':
+		return time.Unix(int64(d.longlong()), 0).UTC()
+	case 'F':
+		return d.table()
+	case 'A':
+		items := newDecoder(d.longstr())
+		var list []interface{}
+		for len(items.buf) > 0 && items.err == nil {
+			list = append(list, items.value())
+		}
+		return list
+	default:
+		if d.err == nil {
+			d.err = fmt.Errorf("rabbitmq: unknown field type %q", typ)
+		}
+		d.buf = nil
+		return nil
+	}
+}
+
+// properties are the basic content properties used by the provider.
+type properties struct {
+	contentType   string
+	headers       map[string]interface{}
+	deliveryMode  byte
+	priority      byte
+	correlationID string
+	messageID     string
+}
+
+// contentHeader encodes the content header of a basic message.
+func contentHeader(size uint64, p properties) ([]byte, error) {
+	var flags uint16
+	var props encoder
+	if p.contentType != "" {
+		flags |= flagContentType
+		props.shortstr(p.contentType)
+	}
+	if len(p.headers) > 0 {
+		flags |= flagHeaders
+		props.table(p.headers)
+	}
+	if p.deliveryMode != 0 {
+		flags |= flagDeliveryMode
+		props.octet(p.deliveryMode)
+	}
+	if p.priority != 0 {
+		flags |= flagPriority
+		props.octet(p.priority)
+	}
+	if p.correlationID != "" {
+		flags |= flagCorrelationID
+		props.shortstr(p.correlationID)
+	}
+	if p.messageID != "" {
+		flags |= flagMessageID
+		props.shortstr(p.messageID)
+	}
+	body, err := props.bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	e := &encoder{}
+	e.short(classBasic)
+	e.short(0)
+	e.longlong(size)
+	e.short(flags)
+	e.buf.Write(body)
+	return e.bytes()
+}
+
+// parseContentHeader decodes a content header, skipping the properties the
+// provider does not use.
+func parseContentHeader(payload []byte) (uint64, properties, error) {
+	d := newDecoder(payload)
+	d.short() // class
+	d.short() // weight
+	size := d.longlong()
+	flags := d.short()
+
+	var p properties
+	if flags&flagContentType != 0 {
+		p.contentType = d.shortstr()
+	}
+	if flags&flagContentEncoding != 0 {
+		d.shortstr()
+	}
+	if flags&flagHeaders != 0 {
+		p.headers = d.table()
+	}
+	if flags&flagDeliveryMode != 0 {
+		p.deliveryMode = d.octet()
+	}
+	if flags&flagPriority != 0 {
+		p.priority = d.octet()
+	}
+	if flags&flagCorrelationID != 0 {
+		p.correlationID = d.shortstr()
+	}
+	if flags&flagReplyTo != 0 {
+		d.shortstr()
+	}
+	if flags&flagExpiration != 0 {
+		d.shortstr()
+	}
+	if flags&flagMessageID != 0 {
+		p.messageID = d.shortstr()
+	}
+	return size, p, d.err
+}
+
+// method is a decoded method frame.
+type method struct {
+	class, id uint16
+	args      *decoder
+}
+
+func (m method) is(class, id uint16) bool {
+	return m.class == class && m.id == id
+}
+
+func parseMethod(payload []byte) method {
+	d := newDecoder(payload)
+	return method{class: d.short(), id: d.short(), args: d}
+}
@@ -0,0 +1,405 @@
+package rabbitmq
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"sync"
+	"testing"
+)
+
+// fakeServer is an in-memory AMQP 0-9-1 broker that understands the
+// methods issued by this package: durable queues, fanout exchanges,
+// consumers with prefetch, and publisher confirms.
+type fakeServer struct {
+	ln net.Listener
+
+	// frameMax is the frame size the server proposes.
+	frameMax uint32
+
+	mu        sync.Mutex
+	queues    map[string]*fakeQueue
+	exchanges map[string][]string // bound queues
+	sessions  map[*fakeSession]bool
+	vhosts    []string
+	clients   []map[string]interface{}
+
+	// largestFrame is the largest frame payload received.
+	largestFrame int
+
+	// rejectPublishes makes the server nack published messages.
+	rejectPublishes bool
+}
+
+type fakeQueue struct {
+	args map[string]interface{}
+	msgs []*fakeMessage
+}
+
+type fakeMessage struct {
+	props       properties
+	body        []byte
+	redelivered bool
+	deliveries  int
+}
+
+// fakeSession is the state of a client connection.
+type fakeSession struct {
+	nc      net.Conn
+	writeMu sync.Mutex
+
+	confirming bool
+	published  uint64
+	prefetch   int
+	consuming  string // queue
+	consumer   string // consumer tag
+	nextTag    uint64
+	unacked    map[uint64]*fakeMessage
+}
+
+// newFakeServer starts a fake server and returns it.
+func newFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{
+		ln:        ln,
+		frameMax:  4096,
+		queues:    make(map[string]*fakeQueue),
+		exchanges: make(map[string][]string),
+		sessions:  make(map[*fakeSession]bool),
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			nc, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(nc)
+		}
+	}()
+	return s
+}
+
+// url returns the connection string of the server.
+func (s *fakeServer) url() string {
+	return "amqp://guest:guest@" + s.ln.Addr().String()
+}
+
+// queue returns the ready messages of a queue.
+func (s *fakeServer) queue(name string) []*fakeMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if q, ok := s.queues[name]; ok {
+		return append([]*fakeMessage(nil), q.msgs...)
+	}
+	return nil
+}
+
+func (s *fakeServer) serve(nc net.Conn) {
+	defer nc.Close()
+	r := bufio.NewReader(nc)
+	session := &fakeSession{nc: nc, unacked: make(map[uint64]*fakeMessage)}
+	defer s.disconnect(session)
+
+	header := make([]byte, len(protocolHeader))
+	if _, err := io.ReadFull(r, header); err != nil || !bytes.Equal(header, protocolHeader) {
+		return
+	}
+	if !s.handshake(session, r) {
+		return
+	}
+
+	var publish *fakeMessage
+	var exchange, routingKey string
+	var remaining uint64
+	for {
+		f, err := readFrame(r)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.largestFrame = max(s.largestFrame, len(f.payload))
+		s.mu.Unlock()
+		switch f.typ {
+		case frameHeader:
+			size, props, _ := parseContentHeader(f.payload)
+			publish.props, remaining = props, size
+			publish.body = []byte{}
+		case frameBody:
+			publish.body = append(publish.body, f.payload...)
+			remaining -= uint64(len(f.payload))
+		case frameMethod:
+			m := parseMethod(f.payload)
+			if m.is(classBasic, methodBasicPublish) {
+				m.args.short()
+				exchange, routingKey = m.args.shortstr(), m.args.shortstr()
+				publish = &fakeMessage{}
+				continue
+			}
+			if !s.handle(session, m) {
+				return
+			}
+		}
+		if publish != nil && publish.body != nil && remaining == 0 {
+			s.route(session, exchange, routingKey, publish)
+			publish = nil
+		}
+	}
+}
+
+// handshake opens the connection, refusing the password "wrong".
+func (s *fakeServer) handshake(session *fakeSession, r *bufio.Reader) bool {
+	start := newMethod(classConnection, methodConnectionStart)
+	start.octet(0)
+	start.octet(9)
+	start.table(map[string]interface{}{"product": "RabbitMQ", "version": "4.1.0"})
+	start.longstr([]byte("AMQPLAIN PLAIN"))
+	start.longstr([]byte("en_US"))
+	session.send(0, start)
+
+	startOk, ok := readMethod(r)
+	if !ok {
+		return false
+	}
+	client := startOk.args.table()
+	startOk.args.shortstr()
+	response := startOk.args.longstr()
+	if bytes.HasSuffix(response, []byte("\x00wrong")) {
+		return false
+	}
+
+	tune := newMethod(classConnection, methodConnectionTune)
+	tune.short(2047)
+	tune.long(s.frameMax)
+	tune.short(60)
+	session.send(0, tune)
+	if _, ok := readMethod(r); !ok {
+		return false
+	}
+
+	open, ok := readMethod(r)
+	if !ok {
+		return false
+	}
+	s.mu.Lock()
+	s.vhosts = append(s.vhosts, open.args.shortstr())
+	s.clients = append(s.clients, client)
+	s.sessions[session] = true
+	s.mu.Unlock()
+	openOk := newMethod(classConnection, methodConnectionOpenOk)
+	openOk.shortstr("")
+	session.send(0, openOk)
+	return true
+}
+
+func readMethod(r *bufio.Reader) (method, bool) {
+	f, err := readFrame(r)
+	if err != nil || f.typ != frameMethod {
+		return method{}, false
+	}
+	return parseMethod(f.payload), true
+}
+
+// handle answers a method and returns false once the connection closes.
+func (s *fakeServer) handle(session *fakeSession, m method) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case m.is(classConnection, methodConnectionClose):
+		session.send(0, newMethod(classConnection, methodConnectionCloseOk))
+		return false
+	case m.is(classChannel, methodChannelClose):
+		session.send(channelID, newMethod(classChannel, methodChannelCloseOk))
+	case m.is(classChannel, methodChannelOpen):
+		openOk := newMethod(classChannel, methodChannelOpenOk)
+		openOk.longstr(nil)
+		session.send(channelID, openOk)
+	case m.is(classConfirm, methodConfirmSelect):
+		session.confirming = true
+		session.send(channelID, newMethod(classConfirm, methodConfirmSelectOk))
+	case m.is(classExchange, methodExchangeDeclare):
+		m.args.short()
+		name := m.args.shortstr()
+		if _, ok := s.exchanges[name]; !ok {
+			s.exchanges[name] = nil
+		}
+		session.send(channelID, newMethod(classExchange, methodExchangeDeclareOk))
+	case m.is(classQueue, methodQueueDeclare):
+		m.args.short()
+		name := m.args.shortstr()
+		for i := 0; i < 5; i++ {
+			m.args.bit()
+		}
+		args := m.args.table()
+		if q, ok := s.queues[name]; !ok {
+			s.queues[name] = &fakeQueue{args: args}
+		} else if q.args["x-queue-type"] != args["x-queue-type"] {
+			closeMethod := newMethod(classChannel, methodChannelClose)
+			closeMethod.short(406)
+			closeMethod.shortstr("PRECONDITION_FAILED - inequivalent arg 'x-queue-type'")
+			closeMethod.short(classQueue)
+			closeMethod.short(methodQueueDeclare)
+			session.send(channelID, closeMethod)
+			return true
+		}
+		declareOk := newMethod(classQueue, methodQueueDeclareOk)
+		declareOk.shortstr(name)
+		declareOk.long(uint32(len(s.queues[name].msgs)))
+		declareOk.long(0)
+		session.send(channelID, declareOk)
+	case m.is(classQueue, methodQueueBind):
+		m.args.short()
+		queue, exchange := m.args.shortstr(), m.args.shortstr()
+		bound := false
+		for _, q := range s.exchanges[exchange] {
+			bound = bound || q == queue
+		}
+		if !bound {
+			s.exchanges[exchange] = append(s.exchanges[exchange], queue)
+		}
+		session.send(channelID, newMethod(classQueue, methodQueueBindOk))
+	case m.is(classBasic, methodBasicQos):
+		m.args.long()
+		session.prefetch = int(m.args.short())
+		session.send(channelID, newMethod(classBasic, methodBasicQosOk))
+	case m.is(classBasic, methodBasicConsume):
+		m.args.short()
+		session.consuming = m.args.shortstr()
+		session.consumer = m.args.shortstr()
+		consumeOk := newMethod(classBasic, methodBasicConsumeOk)
+		consumeOk.shortstr(session.consumer)
+		session.send(channelID, consumeOk)
+		s.dispatch()
+	case m.is(classBasic, methodBasicAck):
+		delete(session.unacked, m.args.longlong())
+		s.dispatch()
+	case m.is(classBasic, methodBasicNack):
+		tag := m.args.longlong()
+		m.args.bit()
+		requeue := m.args.bit()
+		if msg, ok := session.unacked[tag]; ok && requeue {
+			s.requeue(session.consuming, msg)
+		}
+		delete(session.unacked, tag)
+		s.dispatch()
+	}
+	return true
+}
+
+// route puts a published message in the queues it is addressed to and
+// confirms it.
+func (s *fakeServer) route(session *fakeSession, exchange, routingKey string, msg *fakeMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.rejectPublishes {
+		queues := []string{routingKey}
+		if exchange != "" {
+			queues = s.exchanges[exchange]
+		}
+		for _, name := range queues {
+			if q, ok := s.queues[name]; ok {
+				copied := *msg
+				q.msgs = append(q.msgs, &copied)
+			}
+		}
+	}
+	if session.confirming {
+		session.published++
+		id := uint16(methodBasicAck)
+		if s.rejectPublishes {
+			id = methodBasicNack
+		}
+		confirmMethod := newMethod(classBasic, id)
+		confirmMethod.longlong(session.published)
+		confirmMethod.bit(false)
+		if id == methodBasicNack {
+			confirmMethod.bit(false)
+		}
+		session.send(channelID, confirmMethod)
+	}
+	s.dispatch()
+}
+
+// requeue returns a message to the head of its queue. Quorum queues count
+// the failed delivery in x-delivery-count.
+func (s *fakeServer) requeue(queue string, msg *fakeMessage) {
+	q := s.queues[queue]
+	msg.redelivered = true
+	if q.args["x-queue-type"] == QueueTypeQuorum {
+		headers := make(map[string]interface{})
+		for k, v := range msg.props.headers {
+			headers[k] = v
+		}
+		headers[headerDeliveryCount] = int64(msg.deliveries)
+		msg.props.headers = headers
+	}
+	q.msgs = append([]*fakeMessage{msg}, q.msgs...)
+}
+
+// dispatch delivers ready messages to consumers with prefetch to spare.
+// The caller holds s.mu.
+func (s *fakeServer) dispatch() {
+	for session := range s.sessions {
+		q, ok := s.queues[session.consuming]
+		for ok && len(q.msgs) > 0 && len(session.unacked) < session.prefetch {
+			msg := q.msgs[0]
+			q.msgs = q.msgs[1:]
+			msg.deliveries++
+			session.nextTag++
+			session.unacked[session.nextTag] = msg
+			session.deliver(session.nextTag, msg, s.frameMax)
+		}
+	}
+}
+
+// disconnect requeues the unacknowledged messages of a session.
+func (s *fakeServer) disconnect(session *fakeSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, session)
+	for _, msg := range session.unacked {
+		s.requeue(session.consuming, msg)
+	}
+	s.dispatch()
+}
+
+// send writes a method frame.
+func (session *fakeSession) send(channel uint16, e *encoder) {
+	payload, _ := e.bytes()
+	session.write(appendFrame(nil, frameMethod, channel, payload))
+}
+
+func (session *fakeSession) write(frames []byte) {
+	session.writeMu.Lock()
+	defer session.writeMu.Unlock()
+	session.nc.Write(frames)
+}
+
+// deliver writes a basic.deliver with its content in frames of at most
+// frameMax bytes.
+func (session *fakeSession) deliver(tag uint64, msg *fakeMessage, frameMax uint32) {
+	m := newMethod(classBasic, methodBasicDeliver)
+	m.shortstr(session.consumer)
+	m.longlong(tag)
+	m.bit(msg.redelivered)
+	m.shortstr("")
+	m.shortstr(session.consuming)
+	payload, _ := m.bytes()
+	header, _ := contentHeader(uint64(len(msg.body)), msg.props)
+
+	frames := appendFrame(nil, frameMethod, channelID, payload)
+	frames = appendFrame(frames, frameHeader, channelID, header)
+	for body := msg.body; len(body) > 0; {
+		n := min(int(frameMax)-8, len(body))
+		frames = appendFrame(frames, frameBody, channelID, body[:n])
+		body = body[n:]
+	}
+	session.write(frames)
+}
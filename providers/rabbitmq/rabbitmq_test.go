@@ -0,0 +1,274 @@
+package rabbitmq
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/venderneutral/gokyu"
+	"github.com/venderneutral/gokyu/conformance"
+)
+
+func TestConformance(t *testing.T) {
+	server := newFakeServer(t)
+	cfg := &gokyu.Config{Provider: gokyu.ProviderRabbitMQ, ConnectionString: server.url(), Queue: "orders"}
+
+	conformance.Run(t, &Factory{}, cfg, &conformance.Options{
+		ReceiveTimeout: 3 * time.Second,
+		QuietPeriod:    100 * time.Millisecond,
+	})
+}
+
+// receive receives a message or fails the test.
+func receive(t *testing.T, sub gokyu.Subscriber) *gokyu.Message {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	msg, err := sub.Receive(ctx)
+	if err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	return msg
+}
+
+func TestTopicSubscriptions(t *testing.T) {
+	server := newFakeServer(t)
+	factory := &Factory{}
+	ctx := context.Background()
+	cfg := func(subscription string) *gokyu.Config {
+		return &gokyu.Config{Provider: gokyu.ProviderRabbitMQ, ConnectionString: server.url(), Topic: "events", Subscription: subscription}
+	}
+
+	billing, err := factory.NewSubscriber(ctx, cfg("billing"))
+	if err != nil {
+		t.Fatalf("NewSubscriber() error = %v", err)
+	}
+	defer billing.Close(ctx)
+	audit, _ := factory.NewSubscriber(ctx, cfg("audit"))
+	defer audit.Close(ctx)
+	pub, err := factory.NewPublisher(ctx, cfg(""))
+	if err != nil {
+		t.Fatalf("NewPublisher() error = %v", err)
+	}
+	defer pub.Close(ctx)
+
+	msg := gokyu.NewMessage([]byte("created"))
+	msg.ID = "e-1"
+	if err := pub.Publish(ctx, msg); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	for _, sub := range []gokyu.Subscriber{billing, audit} {
+		got := receive(t, sub)
+		if got.ID != "e-1" || string(got.Body) != "created" {
+			t.Errorf("received %+v", got)
+		}
+		if got.Receiver == nil || !strings.HasPrefix(got.Receiver.Entity(), "events") {
+			t.Errorf("Receiver = %v", got.Receiver)
+		}
+		sub.Ack(ctx, got)
+	}
+	if msgs := server.queue("events.billing"); len(msgs) != 0 {
+		t.Errorf("events.billing holds %d messages after Ack, want 0", len(msgs))
+	}
+}
+
+func TestMessageMapping(t *testing.T) {
+	server := newFakeServer(t)
+	cfg := &gokyu.Config{Provider: gokyu.ProviderRabbitMQ, ConnectionString: server.url(), Queue: "orders"}
+	ctx := context.Background()
+
+	pub, _ := (&Factory{}).NewPublisher(ctx, cfg)
+	defer pub.Close(ctx)
+
+	body := bytes.Repeat([]byte("x"), 10000) // several frames of 4 KiB
+	msg := gokyu.NewMessage(body)
+	msg.ID = "m-1"
+	msg.ContentType = gokyu.ContentTypeJSON
+	msg.Priority = 7
+	msg.Properties[gokyu.PropertyCorrelationID] = "req-9"
+	msg.Properties["at"] = time.Unix(1700000000, 0).UTC()
+	msg.Properties["tags"] = []interface{}{"a", int64(2)}
+	if err := pub.Publish(ctx, msg); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	msgs := server.queue("orders")
+	if len(msgs) != 1 {
+		t.Fatalf("orders holds %d messages, want 1", len(msgs))
+	}
+	stored := msgs[0]
+	if stored.props.deliveryMode != amqp.Persistent || stored.props.correlationID != "req-9" {
+		t.Errorf("properties = %+v", stored.props)
+	}
+	server.mu.Lock()
+	largest := server.largestFrame
+	server.mu.Unlock()
+	if largest > 4096-8 {
+		t.Errorf("largest frame = %d bytes, want at most the negotiated frame_max", largest)
+	}
+
+	sub, _ := (&Factory{}).NewSubscriber(ctx, cfg)
+	defer sub.Close(ctx)
+	got := receive(t, sub)
+	if !bytes.Equal(got.Body, body) || got.ID != "m-1" || got.ContentType != gokyu.ContentTypeJSON || got.Priority != 7 {
+		t.Errorf("received ID=%q ContentType=%q Priority=%d len(Body)=%d", got.ID, got.ContentType, got.Priority, len(got.Body))
+	}
+	if at, _ := got.Properties["at"].(time.Time); !at.Equal(time.Unix(1700000000, 0)) {
+		t.Errorf("Properties[at] = %v", got.Properties["at"])
+	}
+	if tags, _ := got.Properties["tags"].([]interface{}); len(tags) != 2 || tags[0] != "a" || tags[1] != int64(2) {
+		t.Errorf("Properties[tags] = %#v", got.Properties["tags"])
+	}
+}
+
+func TestQuorumDeliveryCount(t *testing.T) {
+	server := newFakeServer(t)
+	factory := &Factory{}
+	cfg := &gokyu.Config{Provider: gokyu.ProviderRabbitMQ, ConnectionString: server.url(), Queue: "orders", QueueType: QueueTypeQuorum}
+	ctx := context.Background()
+
+	pub, _ := factory.NewPublisher(ctx, cfg)
+	defer pub.Close(ctx)
+	sub, _ := factory.NewSubscriber(ctx, cfg)
+	defer sub.Close(ctx)
+	pub.Publish(ctx, gokyu.NewMessage([]byte("retry")))
+
+	first := receive(t, sub)
+	if _, ok := first.Properties[gokyu.PropertyDeliveryCount]; ok {
+		t.Errorf("first delivery has %s = %v, want none", gokyu.PropertyDeliveryCount, first.Properties[gokyu.PropertyDeliveryCount])
+	}
+	if err := sub.Nack(ctx, first); err != nil {
+		t.Fatalf("Nack() error = %v", err)
+	}
+	second := receive(t, sub)
+	if count := second.Properties[gokyu.PropertyDeliveryCount]; count != int64(2) {
+		t.Errorf("%s = %v, want 2", gokyu.PropertyDeliveryCount, count)
+	}
+	sub.Ack(ctx, second)
+
+	// Declaring the queue with another type fails
+	classic := *cfg
+	classic.QueueType = QueueTypeClassic
+	_, err := factory.NewSubscriber(ctx, &classic)
+	if !errors.Is(err, gokyu.ErrConnectionFailed) || !strings.Contains(err.Error(), "(406)") {
+		t.Errorf("NewSubscriber() with another queue type error = %v", err)
+	}
+}
+
+func TestPublishNacked(t *testing.T) {
+	server := newFakeServer(t)
+	server.rejectPublishes = true
+	cfg := &gokyu.Config{Provider: gokyu.ProviderRabbitMQ, ConnectionString: server.url(), Queue: "orders"}
+	ctx := context.Background()
+
+	pub, _ := (&Factory{}).NewPublisher(ctx, cfg)
+	defer pub.Close(ctx)
+	err := pub.Publish(ctx, gokyu.NewMessage([]byte("full")))
+	if !errors.Is(err, ErrPublishNacked) || !errors.Is(err, gokyu.ErrPublishFailed) {
+		t.Errorf("Publish() error = %v, want ErrPublishNacked", err)
+	}
+}
+
+func TestConnection(t *testing.T) {
+	server := newFakeServer(t)
+	ctx := context.Background()
+
+	cfg := &gokyu.Config{
+		Provider:             gokyu.ProviderRabbitMQ,
+		ConnectionString:     server.url() + "/billing",
+		Queue:                "orders",
+		ConnectionProperties: map[string]string{"team": "payments"},
+	}
+	if err := (&Factory{}).Ping(ctx, cfg); err != nil {
+		t.Fatalf("Ping() error = %v", err)
+	}
+	cfg.ConnectionString = server.url() + "/%2F"
+	pub, err := (&Factory{}).NewPublisher(ctx, cfg)
+	if err != nil {
+		t.Fatalf("NewPublisher() error = %v", err)
+	}
+	defer pub.Close(ctx)
+
+	server.mu.Lock()
+	vhosts, clients := server.vhosts, server.clients
+	server.mu.Unlock()
+	if len(vhosts) != 2 || vhosts[0] != "billing" || vhosts[1] != "/" {
+		t.Errorf("virtual hosts = %q, want [billing /]", vhosts)
+	}
+	if clients[0][gokyu.ConnPropertyProduct] != "gokyu" || clients[0]["team"] != "payments" {
+		t.Errorf("client properties = %v", clients[0])
+	}
+	if info, ok := pub.(gokyu.BrokerInfo); !ok || info.BrokerProperties()["product"] != "RabbitMQ" {
+		t.Errorf("BrokerProperties() = %v", info.BrokerProperties())
+	}
+
+	cfg.ConnectionString = strings.Replace(server.url(), "guest@", "wrong@", 1)
+	if err := (&Factory{}).Ping(ctx, cfg); !errors.Is(err, gokyu.ErrConnectionFailed) || !strings.Contains(err.Error(), "credentials") {
+		t.Errorf("Ping() with a wrong password error = %v", err)
+	}
+}
+
+func TestHeaderTable(t *testing.T) {
+	headers, err := headerTable(map[string]interface{}{
+		"count":  uint64(7),
+		"nested": map[string]interface{}{"k": "v"},
+		"list":   []interface{}{map[string]interface{}{"n": 1}},
+	})
+	if err != nil {
+		t.Fatalf("headerTable() error = %v", err)
+	}
+	if headers["count"] != int64(7) {
+		t.Errorf("count = %#v, want int64(7)", headers["count"])
+	}
+	if _, ok := headers["nested"].(amqp.Table); !ok {
+		t.Errorf("nested = %#v, want a table", headers["nested"])
+	}
+
+	// Received tables are maps again
+	if nested, _ := propertyValue(headers["nested"]).(map[string]interface{}); nested["k"] != "v" {
+		t.Errorf("propertyValue() = %#v", propertyValue(headers["nested"]))
+	}
+	if list, _ := propertyValue(headers["list"]).([]interface{}); len(list) != 1 {
+		t.Errorf("propertyValue() = %#v", propertyValue(headers["list"]))
+	} else if _, ok := list[0].(map[string]interface{}); !ok {
+		t.Errorf("list[0] = %#v, want a map", list[0])
+	}
+
+	if _, err := headerTable(map[string]interface{}{"u": uint64(1) << 63}); err == nil {
+		t.Error("headerTable() with an out-of-range uint64 succeeded, want error")
+	}
+}
+
+func TestMaxPriority(t *testing.T) {
+	server := newFakeServer(t)
+	cfg := &gokyu.Config{Provider: gokyu.ProviderRabbitMQ, ConnectionString: server.url(), Queue: "orders", MaxPriority: 9}
+	client, err := gokyu.NewClient(cfg)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	if caps := client.Capabilities(); caps.Priority != gokyu.Native {
+		t.Errorf("Capabilities().Priority = %v, want Native", caps.Priority)
+	}
+
+	ctx := context.Background()
+	pub, err := client.NewPublisher(ctx)
+	if err != nil {
+		t.Fatalf("NewPublisher() error = %v", err)
+	}
+	defer pub.Close(ctx)
+	server.mu.Lock()
+	args := server.queues["orders"].args
+	server.mu.Unlock()
+	if args["x-max-priority"] != uint8(9) {
+		t.Errorf("queue arguments = %v, want x-max-priority 9", args)
+	}
+
+	cfg.MaxPriority = 0
+	if caps := (&Factory{}).ConfigCapabilities(cfg); caps.Priority != gokyu.Unsupported {
+		t.Errorf("ConfigCapabilities().Priority without MaxPriority = %v", caps.Priority)
+	}
+}
@@ -0,0 +1,26 @@
+package sqlqueue
+
+import (
+	"context"
+
+	"github.com/venderneutral/gokyu"
+)
+
+// NewDeadLetterSubscriber creates a subscriber for the messages dead-lettered
+// from the configured queue or subscription, or from Config.DeadLetterQueue
+// if set. Nacked dead letters stay in the dead-letter table.
+func (f *Factory) NewDeadLetterSubscriber(ctx context.Context, cfg *gokyu.Config) (gokyu.Subscriber, error) {
+	queue := cfg.DeadLetterQueue
+	if queue == "" {
+		queue = cfg.Queue
+	}
+	if queue == "" {
+		queue = subscriptionQueue(cfg.Topic, cfg.Subscription)
+	}
+
+	s, err := f.open(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return newSubscriber(s, s.tables.deadLetters, queue, cfg, nil, 0), nil
+}
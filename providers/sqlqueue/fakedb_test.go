@@ -0,0 +1,244 @@
+package sqlqueue
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// fakeDB is an in-memory database that understands the statements issued
+// by this package (PostgreSQL dialect). Row locks taken with FOR UPDATE are
+// held until the transaction ends, so SKIP LOCKED behaves as in PostgreSQL;
+// rolled back changes are not undone.
+type fakeDB struct {
+	mu            sync.Mutex
+	nextID        int64
+	tables        map[string]map[int64]*fakeRow
+	subscriptions map[string][]string
+	locks         map[int64]*fakeConn
+}
+
+type fakeRow struct {
+	id          int64
+	queue       string
+	messageID   string
+	contentType string
+	properties  string
+	body        []byte
+	enqueuedAt  int64
+	visibleAt   int64
+	deliveries  int64
+}
+
+// newFakeDB returns a *sql.DB backed by a new fakeDB.
+func newFakeDB() (*sql.DB, *fakeDB) {
+	f := &fakeDB{
+		tables:        make(map[string]map[int64]*fakeRow),
+		subscriptions: make(map[string][]string),
+		locks:         make(map[int64]*fakeConn),
+	}
+	return sql.OpenDB(fakeConnector{f}), f
+}
+
+// rows returns the rows of table ordered by id.
+func (f *fakeDB) rows(table string) []*fakeRow {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var rows []*fakeRow
+	for _, row := range f.tables[table] {
+		copy := *row
+		rows = append(rows, &copy)
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i].id < rows[j].id })
+	return rows
+}
+
+type fakeConnector struct{ db *fakeDB }
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	return &fakeConn{db: c.db}, nil
+}
+
+func (c fakeConnector) Driver() driver.Driver { return fakeDriver{} }
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, fmt.Errorf("fakedb: use sql.OpenDB")
+}
+
+type fakeConn struct{ db *fakeDB }
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return &fakeStmt{conn: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error { return nil }
+
+func (c *fakeConn) Begin() (driver.Tx, error) { return c, nil }
+
+// Commit and Rollback release the row locks of the transaction.
+func (c *fakeConn) Commit() error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	for id, holder := range c.db.locks {
+		if holder == c {
+			delete(c.db.locks, id)
+		}
+	}
+	return nil
+}
+
+func (c *fakeConn) Rollback() error { return c.Commit() }
+
+type fakeStmt struct {
+	conn  *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	n, _, err := s.run(args)
+	return driver.RowsAffected(n), err
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	_, rows, err := s.run(args)
+	return rows, err
+}
+
+// run executes the statement, returning the number of affected rows or the
+// result rows.
+func (s *fakeStmt) run(args []driver.Value) (int64, *fakeRows, error) {
+	db := s.conn.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	q := s.query
+	words := strings.Fields(q)
+	tableAfter := func(keyword string) map[int64]*fakeRow {
+		for i, w := range words {
+			if w == keyword {
+				name := words[i+1]
+				if db.tables[name] == nil {
+					db.tables[name] = make(map[int64]*fakeRow)
+				}
+				return db.tables[name]
+			}
+		}
+		panic("fakedb: no table in " + q)
+	}
+	locked := func(id int64) bool {
+		holder, ok := db.locks[id]
+		return ok && holder != s.conn
+	}
+
+	switch {
+	case strings.HasPrefix(q, "CREATE"):
+		return 0, nil, nil
+
+	case strings.HasPrefix(q, "INSERT INTO") && strings.Contains(q, "(topic, subscription)"):
+		topic, sub := args[0].(string), args[1].(string)
+		for _, existing := range db.subscriptions[topic] {
+			if existing == sub {
+				return 0, nil, nil
+			}
+		}
+		db.subscriptions[topic] = append(db.subscriptions[topic], sub)
+		return 1, nil, nil
+
+	case strings.HasPrefix(q, "INSERT INTO"):
+		db.nextID++
+		tableAfter("INTO")[db.nextID] = &fakeRow{
+			id:          db.nextID,
+			queue:       args[0].(string),
+			messageID:   args[1].(string),
+			contentType: args[2].(string),
+			properties:  args[3].(string),
+			body:        append([]byte(nil), args[4].([]byte)...),
+			enqueuedAt:  args[5].(int64),
+			visibleAt:   args[6].(int64),
+			deliveries:  args[7].(int64),
+		}
+		return 1, nil, nil
+
+	case strings.HasPrefix(q, "SELECT subscription FROM"):
+		rows := &fakeRows{cols: []string{"subscription"}}
+		for _, sub := range db.subscriptions[args[0].(string)] {
+			rows.data = append(rows.data, []driver.Value{sub})
+		}
+		return 0, rows, nil
+
+	case strings.HasPrefix(q, "SELECT id, message_id"):
+		rows := &fakeRows{cols: []string{"id", "message_id", "content_type", "properties", "body", "enqueued_at", "delivery_count"}}
+		var best *fakeRow
+		for _, row := range tableAfter("FROM") {
+			if row.queue != args[0].(string) || row.visibleAt > args[1].(int64) || locked(row.id) {
+				continue
+			}
+			if best == nil || row.id < best.id {
+				best = row
+			}
+		}
+		if best != nil {
+			db.locks[best.id] = s.conn
+			rows.data = append(rows.data, []driver.Value{best.id, best.messageID, best.contentType, best.properties, best.body, best.enqueuedAt, best.deliveries})
+		}
+		return 0, rows, nil
+
+	case strings.HasPrefix(q, "SELECT id FROM"):
+		rows := &fakeRows{cols: []string{"id"}}
+		if row := tableAfter("FROM")[args[0].(int64)]; row != nil && row.deliveries == args[1].(int64) && !locked(row.id) {
+			db.locks[row.id] = s.conn
+			rows.data = append(rows.data, []driver.Value{row.id})
+		}
+		return 0, rows, nil
+
+	case strings.HasPrefix(q, "UPDATE") && strings.Contains(q, "delivery_count = $2"):
+		row := tableAfter("UPDATE")[args[2].(int64)]
+		row.visibleAt, row.deliveries = args[0].(int64), args[1].(int64)
+		return 1, nil, nil
+
+	case strings.HasPrefix(q, "UPDATE"):
+		row := tableAfter("UPDATE")[args[1].(int64)]
+		if row == nil || row.deliveries != args[2].(int64) || locked(row.id) {
+			return 0, nil, nil
+		}
+		row.visibleAt = args[0].(int64)
+		return 1, nil, nil
+
+	case strings.HasPrefix(q, "DELETE FROM"):
+		table := tableAfter("FROM")
+		row := table[args[0].(int64)]
+		if row == nil || locked(row.id) || (len(args) > 1 && row.deliveries != args[1].(int64)) {
+			return 0, nil, nil
+		}
+		delete(table, row.id)
+		return 1, nil, nil
+	}
+	return 0, nil, fmt.Errorf("fakedb: unsupported statement %q", q)
+}
+
+type fakeRows struct {
+	cols []string
+	data [][]driver.Value
+}
+
+func (r *fakeRows) Columns() []string { return r.cols }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if len(r.data) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.data[0])
+	r.data = r.data[1:]
+	return nil
+}
@@ -0,0 +1,234 @@
+package sqlqueue
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+	"github.com/venderneutral/gokyu/conformance"
+)
+
+func TestConformance(t *testing.T) {
+	db, _ := newFakeDB()
+	factory := &Factory{DB: db, PollInterval: 10 * time.Millisecond}
+	cfg := &gokyu.Config{Provider: gokyu.ProviderSQL, Queue: "orders"}
+
+	conformance.Run(t, factory, cfg, &conformance.Options{
+		ReceiveTimeout: 2 * time.Second,
+		QuietPeriod:    100 * time.Millisecond,
+	})
+}
+
+// receive receives a message or fails the test.
+func receive(t *testing.T, sub gokyu.Subscriber) *gokyu.Message {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	msg, err := sub.Receive(ctx)
+	if err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	return msg
+}
+
+func TestDeadLetterAfterMaxDeliveries(t *testing.T) {
+	db, _ := newFakeDB()
+	factory := &Factory{DB: db, PollInterval: 10 * time.Millisecond, MaxDeliveries: 2}
+	cfg := &gokyu.Config{Provider: gokyu.ProviderSQL, Queue: "orders", Events: gokyu.NewEventBus()}
+	events := cfg.Events.Subscribe(0)
+	ctx := context.Background()
+
+	pub, _ := factory.NewPublisher(ctx, cfg)
+	sub, _ := factory.NewSubscriber(ctx, cfg)
+	defer sub.Close(ctx)
+
+	msg := gokyu.NewMessage([]byte("poison"))
+	msg.ID = "m-1"
+	msg.Properties["tenant"] = "acme"
+	if err := pub.Publish(ctx, msg); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := sub.Nack(ctx, receive(t, sub)); err != nil {
+			t.Fatalf("Nack() error = %v", err)
+		}
+	}
+	for _, want := range []gokyu.EventType{gokyu.EventMessageDeadLettered, gokyu.EventRetryExhausted} {
+		select {
+		case ev := <-events:
+			if ev.Type != want || ev.Message.ID != "m-1" {
+				t.Errorf("event = %s for %s, want %s", ev.Type, ev.Message.ID, want)
+			}
+		default:
+			t.Fatalf("expected %s event", want)
+		}
+	}
+
+	dlq, err := factory.NewDeadLetterSubscriber(ctx, cfg)
+	if err != nil {
+		t.Fatalf("NewDeadLetterSubscriber() error = %v", err)
+	}
+	defer dlq.Close(ctx)
+
+	dead := receive(t, dlq)
+	if dead.ID != "m-1" || string(dead.Body) != "poison" || dead.Properties["tenant"] != "acme" {
+		t.Errorf("dead letter = %+v", dead)
+	}
+	if reason := gokyu.DeadLetterReason(dead); !strings.Contains(reason, "2 deliveries") {
+		t.Errorf("DeadLetterReason() = %q", reason)
+	}
+	if err := dlq.Ack(ctx, dead); err != nil {
+		t.Errorf("Ack() on dead letter error = %v", err)
+	}
+}
+
+func TestVisibilityTimeout(t *testing.T) {
+	db, fake := newFakeDB()
+	factory := &Factory{DB: db, PollInterval: 10 * time.Millisecond, VisibilityTimeout: 50 * time.Millisecond, MaxDeliveries: 2}
+	cfg := &gokyu.Config{Provider: gokyu.ProviderSQL, Queue: "orders"}
+	ctx := context.Background()
+
+	pub, _ := factory.NewPublisher(ctx, cfg)
+	sub, _ := factory.NewSubscriber(ctx, cfg)
+	defer sub.Close(ctx)
+	pub.Publish(ctx, gokyu.NewMessage([]byte("slow")))
+
+	first := receive(t, sub)
+	second := receive(t, sub) // after the visibility timeout
+	if string(second.Body) != "slow" {
+		t.Fatalf("redelivered Body = %q", second.Body)
+	}
+
+	if err := sub.Ack(ctx, first); !errors.Is(err, ErrVisibilityExpired) {
+		t.Errorf("Ack() of expired delivery error = %v, want ErrVisibilityExpired", err)
+	}
+
+	// A message that keeps timing out is dead-lettered on the next receive
+	time.Sleep(60 * time.Millisecond)
+	short, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if msg, err := sub.Receive(short); err == nil {
+		t.Errorf("Receive() = %q, want the message dead-lettered", msg.Body)
+	}
+	if rows := fake.rows("gokyu_dead_letters"); len(rows) != 1 {
+		t.Errorf("dead-letter table has %d rows, want 1", len(rows))
+	}
+}
+
+func TestRedeliveryDelay(t *testing.T) {
+	db, fake := newFakeDB()
+	clock := gokyu.NewFakeClock(time.Unix(1000, 0))
+	factory := &Factory{DB: db, Clock: clock}
+	cfg := &gokyu.Config{
+		Provider:   gokyu.ProviderSQL,
+		Queue:      "orders",
+		Redelivery: &gokyu.RedeliveryPolicy{InitialDelay: time.Minute, MaxRedeliveries: 1},
+	}
+	ctx := context.Background()
+
+	pub, _ := factory.NewPublisher(ctx, cfg)
+	sub, _ := factory.NewSubscriber(ctx, cfg)
+	defer sub.Close(ctx)
+	pub.Publish(ctx, gokyu.NewMessage([]byte("retry")))
+
+	if err := sub.Nack(ctx, receive(t, sub)); err != nil {
+		t.Fatalf("Nack() error = %v", err)
+	}
+	rows := fake.rows("gokyu_messages")
+	if len(rows) != 1 || rows[0].visibleAt != clock.Now().Add(time.Minute).UnixMilli() {
+		t.Fatalf("message rows = %+v, want visible in a minute", rows)
+	}
+
+	clock.Advance(time.Minute)
+	if err := sub.Nack(ctx, receive(t, sub)); err != nil {
+		t.Fatalf("Nack() error = %v", err)
+	}
+	if rows := fake.rows("gokyu_dead_letters"); len(rows) != 1 {
+		t.Errorf("dead-letter table has %d rows after the policy is exhausted, want 1", len(rows))
+	}
+}
+
+func TestTopicFanOut(t *testing.T) {
+	db, _ := newFakeDB()
+	factory := &Factory{DB: db, PollInterval: 10 * time.Millisecond}
+	ctx := context.Background()
+
+	var subs []gokyu.Subscriber
+	for _, name := range []string{"billing", "shipping"} {
+		sub, err := factory.NewSubscriber(ctx, &gokyu.Config{Provider: gokyu.ProviderSQL, Topic: "orders", Subscription: name})
+		if err != nil {
+			t.Fatalf("NewSubscriber() error = %v", err)
+		}
+		defer sub.Close(ctx)
+		subs = append(subs, sub)
+	}
+
+	pub, _ := factory.NewPublisher(ctx, &gokyu.Config{Provider: gokyu.ProviderSQL, Topic: "orders"})
+	if err := pub.Publish(ctx, gokyu.NewMessage([]byte("created"))); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	for _, sub := range subs {
+		msg := receive(t, sub)
+		if string(msg.Body) != "created" {
+			t.Errorf("Body = %q", msg.Body)
+		}
+		sub.Ack(ctx, msg)
+	}
+}
+
+func TestQueryPlaceholders(t *testing.T) {
+	s := &store{dialect: Postgres}
+	if got := s.query("DELETE FROM %s WHERE id = ? AND delivery_count = ?", "t"); got != "DELETE FROM t WHERE id = $1 AND delivery_count = $2" {
+		t.Errorf("query() = %q", got)
+	}
+	s.dialect = MySQL
+	if got := s.query("DELETE FROM %s WHERE id = ?", "t"); got != "DELETE FROM t WHERE id = ?" {
+		t.Errorf("query() = %q", got)
+	}
+}
+
+func TestParseConnectionString(t *testing.T) {
+	tests := []struct {
+		in      string
+		dialect Dialect
+		dsn     string
+		wantErr bool
+	}{
+		{in: "postgres://u:p@db:5432/app", dialect: Postgres, dsn: "postgres://u:p@db:5432/app"},
+		{in: "postgresql://db/app", dialect: Postgres, dsn: "postgresql://db/app"},
+		{in: "mysql://u:p@tcp(db:3306)/app", dialect: MySQL, dsn: "u:p@tcp(db:3306)/app"},
+		{in: "amqps://broker", wantErr: true},
+		{in: "db/app", wantErr: true},
+	}
+	for _, tt := range tests {
+		dialect, dsn, err := parseConnectionString(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseConnectionString(%q) error = %v", tt.in, err)
+			continue
+		}
+		if !tt.wantErr && (dialect != tt.dialect || dsn != tt.dsn) {
+			t.Errorf("parseConnectionString(%q) = %v, %q", tt.in, dialect, dsn)
+		}
+	}
+}
+
+func TestDecodeProperties(t *testing.T) {
+	data, err := encodeProperties(map[string]interface{}{"count": int64(3), "ratio": 0.5, "name": "x", "ok": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := decodeProperties(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{"count": int64(3), "ratio": 0.5, "name": "x", "ok": true}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decodeProperties() = %#v, want %#v", got, want)
+	}
+}
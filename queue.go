@@ -39,6 +39,7 @@ package gokyu
 
 import (
 	"context"
+	"time"
 )
 
 // Provider represents a supported queue provider.
@@ -50,6 +51,18 @@ const (
 
 	// ProviderAmazonMQ selects Amazon MQ (ActiveMQ) as the message broker.
 	ProviderAmazonMQ Provider = "amazonmq"
+
+	// ProviderSQL selects a PostgreSQL or MySQL database as the message store.
+	ProviderSQL Provider = "sql"
+
+	// ProviderFile selects a local directory as the message store.
+	ProviderFile Provider = "file"
+
+	// ProviderBeanstalkd selects a beanstalkd work queue.
+	ProviderBeanstalkd Provider = "beanstalkd"
+
+	// ProviderRabbitMQ selects RabbitMQ over AMQP 0-9-1.
+	ProviderRabbitMQ Provider = "rabbitmq"
 )
 
 // Message represents a queue message with provider-agnostic fields.
@@ -60,13 +73,54 @@ type Message struct {
 	// Body is the message payload.
 	Body []byte
 
+	// ContentType is the MIME type of the body (e.g. "application/json").
+	// It selects the codec used by Decode.
+	ContentType string
+
 	// Properties contains optional message properties/headers.
 	Properties map[string]interface{}
 
+	// BodyValue carries an AMQP value or sequence body instead of binary
+	// data. Received amqp-value bodies are decoded here, with Body left empty;
+	// amqp-sequence bodies arrive as a BodySequence. When publishing, a
+	// non-nil BodyValue is sent instead of Body.
+	BodyValue interface{}
+
+	// To names the queue or topic to publish to instead of the publisher's
+	// configured destination, e.g. the ReplyTo of a request. Publishers of a
+	// client send such messages through a relay publisher, so the provider
+	// must support anonymous relay (see Capabilities.Addressing). Scheduled
+	// messages cannot be addressed.
+	To string
+
+	// PartitionKey groups related messages. ShardedPublisher hashes it to
+	// choose a destination, and the Azure provider sends it as the Service
+	// Bus partition key.
+	PartitionKey string
+
+	// Priority ranks the message from 1 to MaxPriority, higher first. Zero
+	// leaves it unset, which counts as DefaultPriority. Providers with native
+	// priority pass it to the broker; on others it takes effect only with
+	// Config.PriorityLevels.
+	Priority uint8
+
+	// EnqueuedTime is when the broker accepted the message, if the provider
+	// reports it. It is ignored when publishing.
+	EnqueuedTime time.Time
+
+	// Receiver identifies the subscriber the message was received through:
+	// provider, entity and consumer instance. Providers set it on received
+	// messages; it is ignored when publishing.
+	Receiver *Receiver
+
 	// raw holds the provider-specific message for acknowledgment operations.
 	raw interface{}
 }
 
+// BodySequence is an AMQP sequence body: one or more amqp-sequence sections,
+// each a list of values.
+type BodySequence [][]interface{}
+
 // NewMessage creates a new message with the given body.
 func NewMessage(body []byte) *Message {
 	return &Message{
@@ -109,6 +163,17 @@ type Subscriber interface {
 	Close(ctx context.Context) error
 }
 
+// RangeConsumer processes the messages of a past time window, e.g. to
+// reprocess a day of events for an audit, without receiving from live
+// subscriptions or moving their checkpoints. Log-based brokers can implement
+// it by reading their log; for queue-based ones, archive.Reader reads the
+// window back from the message archive.
+type RangeConsumer interface {
+	// ConsumeRange passes the messages of [from, to) to handler in order,
+	// stopping at the first error.
+	ConsumeRange(ctx context.Context, from, to time.Time, handler Handler) error
+}
+
 // ProviderFactory creates publishers and subscribers for a specific provider.
 type ProviderFactory interface {
 	// NewPublisher creates a new publisher for the given configuration.
@@ -0,0 +1,248 @@
+package gokyu
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MetricQuotaRejected counts publishes rejected by a quota, labelled with the
+// quota kind.
+const MetricQuotaRejected = "gokyu_quota_rejected_total"
+
+// QuotaKind identifies a publisher quota.
+type QuotaKind string
+
+// Quota kinds.
+const (
+	QuotaRate       QuotaKind = "rate"
+	QuotaDailyBytes QuotaKind = "daily_bytes"
+)
+
+// DefaultQuotaWarnFraction is the share of the daily byte quota at which a
+// warning is emitted.
+const DefaultQuotaWarnFraction = 0.8
+
+// Quota limits the traffic of a publisher, guarding against runaway publish
+// loops and the broker bill that comes with them.
+type Quota struct {
+	// MaxMessagesPerSecond limits the publish rate. Zero means no limit.
+	MaxMessagesPerSecond float64
+
+	// Burst is the number of messages that may be published at once above
+	// the rate (default: MaxMessagesPerSecond, at least 1).
+	Burst int
+
+	// Wait delays publishes beyond the rate limit until capacity is
+	// available, instead of rejecting them with ErrQuotaExceeded.
+	Wait bool
+
+	// MaxBytesPerDay limits the body bytes published per UTC day. Publishes
+	// beyond it are always rejected. Zero means no limit.
+	MaxBytesPerDay int64
+
+	// WarnFraction is the share of MaxBytesPerDay at which OnWarning is
+	// called (default: DefaultQuotaWarnFraction).
+	WarnFraction float64
+
+	// OnWarning is called once a day when WarnFraction of the daily byte
+	// quota is used, and whenever a publish is rejected or delayed, at most
+	// once per WarningInterval per quota kind.
+	OnWarning func(QuotaWarning)
+
+	// WarningInterval rate-limits rejection warnings (default: one minute).
+	WarningInterval time.Duration
+
+	// Metrics records MetricQuotaRejected.
+	Metrics Metrics
+
+	// Clock is the time source (default: SystemClock).
+	Clock Clock
+}
+
+// QuotaWarning describes a quota that is close to or over its limit.
+type QuotaWarning struct {
+	Kind QuotaKind
+
+	// Limit is the quota in messages per second for QuotaRate and in bytes
+	// for QuotaDailyBytes. Used is the bytes published today for
+	// QuotaDailyBytes, and equals Limit for QuotaRate.
+	Used  float64
+	Limit float64
+
+	// Rejected is true if a publish was rejected, false if it was only
+	// delayed or the quota is nearly used up.
+	Rejected bool
+}
+
+func (w QuotaWarning) String() string {
+	state := "near limit"
+	if w.Rejected {
+		state = "exceeded"
+	}
+	return fmt.Sprintf("%s quota %s: %.0f of %.0f", w.Kind, state, w.Used, w.Limit)
+}
+
+// NewQuotaPublisher wraps pub to enforce quota on Publish and Schedule.
+// Rejected publishes return an error wrapping ErrQuotaExceeded, and
+// publishes that pub fails are refunded. The quota is
+// also applied to publishers created by a client with Config.Quota set.
+func NewQuotaPublisher(pub Publisher, quota Quota) Publisher {
+	q := newQuotaLimiter(quota)
+	return wrapChargingPublisher(pub, q.admit)
+}
+
+// quotaLimiter tracks quota usage of a publisher.
+type quotaLimiter struct {
+	quota Quota
+
+	mu         sync.Mutex
+	tokens     float64
+	last       time.Time
+	day        time.Time
+	dayBytes   int64
+	dayWarned  bool
+	lastWarned map[QuotaKind]time.Time
+}
+
+func newQuotaLimiter(quota Quota) *quotaLimiter {
+	if quota.Burst <= 0 {
+		quota.Burst = int(quota.MaxMessagesPerSecond)
+		if quota.Burst < 1 {
+			quota.Burst = 1
+		}
+	}
+	if quota.WarnFraction <= 0 {
+		quota.WarnFraction = DefaultQuotaWarnFraction
+	}
+	if quota.WarningInterval <= 0 {
+		quota.WarningInterval = time.Minute
+	}
+	if quota.Metrics == nil {
+		quota.Metrics = NopMetrics{}
+	}
+	if quota.Clock == nil {
+		quota.Clock = SystemClock
+	}
+	return &quotaLimiter{
+		quota:      quota,
+		tokens:     float64(quota.Burst),
+		last:       quota.Clock.Now(),
+		lastWarned: make(map[QuotaKind]time.Time),
+	}
+}
+
+// admit charges msg against the quota, waiting for rate capacity if
+// configured. It is a chargeFunc: publishes that fail are refunded.
+func (q *quotaLimiter) admit(ctx context.Context, msg *Message) (func(), error) {
+	size := int64(len(msg.Body))
+
+	q.mu.Lock()
+	now := q.quota.Clock.Now()
+	var warnings []QuotaWarning
+	var day time.Time
+
+	if limit := q.quota.MaxBytesPerDay; limit > 0 {
+		if day = utcDay(now); !day.Equal(q.day) {
+			q.day, q.dayBytes, q.dayWarned = day, 0, false
+		}
+		if q.dayBytes+size > limit {
+			w := q.warnRejected(now, QuotaWarning{Kind: QuotaDailyBytes, Used: float64(q.dayBytes), Limit: float64(limit), Rejected: true})
+			q.mu.Unlock()
+			return nil, q.reject(w, QuotaDailyBytes)
+		}
+	}
+
+	var wait time.Duration
+	if rate := q.quota.MaxMessagesPerSecond; rate > 0 {
+		q.tokens += now.Sub(q.last).Seconds() * rate
+		if max := float64(q.quota.Burst); q.tokens > max {
+			q.tokens = max
+		}
+		q.last = now
+
+		if q.tokens < 1 {
+			w := q.warnRejected(now, QuotaWarning{Kind: QuotaRate, Used: rate, Limit: rate, Rejected: !q.quota.Wait})
+			if !q.quota.Wait {
+				q.mu.Unlock()
+				return nil, q.reject(w, QuotaRate)
+			}
+			if w != nil {
+				warnings = append(warnings, *w)
+			}
+			wait = time.Duration((1 - q.tokens) / rate * float64(time.Second))
+		}
+		// Reserve the token now so concurrent publishers queue behind it
+		q.tokens--
+	}
+
+	if limit := q.quota.MaxBytesPerDay; limit > 0 {
+		q.dayBytes += size
+		if !q.dayWarned && float64(q.dayBytes) >= q.quota.WarnFraction*float64(limit) {
+			q.dayWarned = true
+			warnings = append(warnings, QuotaWarning{Kind: QuotaDailyBytes, Used: float64(q.dayBytes), Limit: float64(limit)})
+		}
+	}
+	q.mu.Unlock()
+
+	for _, w := range warnings {
+		q.warn(w)
+	}
+
+	if wait > 0 {
+		timer := q.quota.Clock.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			q.refund(size, day)
+			return nil, WrapError(ErrPublishFailed, ctx.Err())
+		}
+	}
+	return func() { q.refund(size, day) }, nil
+}
+
+// refund returns the quota charged on day for a publish that did not
+// happen or failed.
+func (q *quotaLimiter) refund(size int64, day time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.quota.MaxMessagesPerSecond > 0 {
+		q.tokens = min(q.tokens+1, float64(q.quota.Burst))
+	}
+	if q.quota.MaxBytesPerDay > 0 && day.Equal(q.day) {
+		q.dayBytes -= size
+	}
+}
+
+// warnRejected returns w if a warning of its kind is due. It must be called
+// with q.mu held.
+func (q *quotaLimiter) warnRejected(now time.Time, w QuotaWarning) *QuotaWarning {
+	if last, ok := q.lastWarned[w.Kind]; ok && now.Sub(last) < q.quota.WarningInterval {
+		return nil
+	}
+	q.lastWarned[w.Kind] = now
+	return &w
+}
+
+// reject reports a rejected publish and returns its error.
+func (q *quotaLimiter) reject(w *QuotaWarning, kind QuotaKind) error {
+	q.quota.Metrics.IncCounter(MetricQuotaRejected, map[string]string{"quota": string(kind)}, 1)
+	if w != nil {
+		q.warn(*w)
+	}
+	return fmt.Errorf("%w: %s", ErrQuotaExceeded, kind)
+}
+
+func (q *quotaLimiter) warn(w QuotaWarning) {
+	if q.quota.OnWarning != nil {
+		q.quota.OnWarning(w)
+	}
+}
+
+// utcDay returns the start of the UTC day containing t.
+func utcDay(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,142 @@
+package gokyu
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestQuotaPublisher_RateReject(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	metrics := newCountingMetrics()
+	var warnings []QuotaWarning
+	factory := &recordingFactory{}
+	pub := NewQuotaPublisher(&recordingPublisher{factory: factory}, Quota{
+		MaxMessagesPerSecond: 2,
+		Metrics:              metrics,
+		Clock:                clock,
+		OnWarning:            func(w QuotaWarning) { warnings = append(warnings, w) },
+	})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		err := pub.Publish(ctx, NewMessage(nil))
+		if i < 2 && err != nil {
+			t.Fatalf("Publish(%d) error = %v", i, err)
+		}
+		if i == 2 && !errors.Is(err, ErrQuotaExceeded) {
+			t.Fatalf("expected ErrQuotaExceeded, got %v", err)
+		}
+	}
+	pub.Publish(ctx, NewMessage(nil))
+
+	if metrics.counters[MetricQuotaRejected] != 2 {
+		t.Errorf("expected 2 rejections, got %v", metrics.counters[MetricQuotaRejected])
+	}
+	if len(warnings) != 1 || warnings[0].Kind != QuotaRate || !warnings[0].Rejected {
+		t.Errorf("expected one rate warning within the warning interval, got %v", warnings)
+	}
+
+	clock.Advance(500 * time.Millisecond)
+	if err := pub.Publish(ctx, NewMessage(nil)); err != nil {
+		t.Errorf("expected capacity after refill, got %v", err)
+	}
+	if len(factory.published) != 3 {
+		t.Errorf("expected 3 messages published, got %d", len(factory.published))
+	}
+}
+
+func TestQuotaPublisher_RateWait(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	factory := &recordingFactory{}
+	pub := NewQuotaPublisher(&recordingPublisher{factory: factory}, Quota{
+		MaxMessagesPerSecond: 1,
+		Wait:                 true,
+		Clock:                clock,
+	})
+	ctx := context.Background()
+
+	if err := pub.Publish(ctx, NewMessage(nil)); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- pub.Publish(ctx, NewMessage(nil)) }()
+
+	for clock.Timers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("expected publish to wait, returned %v", err)
+	default:
+	}
+
+	clock.Advance(time.Second)
+	if err := <-done; err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+}
+
+func TestQuotaPublisher_DailyBytes(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC))
+	var warnings []QuotaWarning
+	pub := NewQuotaPublisher(&recordingPublisher{factory: &recordingFactory{}}, Quota{
+		MaxBytesPerDay: 10,
+		Clock:          clock,
+		OnWarning:      func(w QuotaWarning) { warnings = append(warnings, w) },
+	})
+	ctx := context.Background()
+
+	if err := pub.Publish(ctx, NewMessage(make([]byte, 8))); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if len(warnings) != 1 || warnings[0].Rejected {
+		t.Errorf("expected near-limit warning at 80%%, got %v", warnings)
+	}
+	if err := pub.Publish(ctx, NewMessage(make([]byte, 3))); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("expected ErrQuotaExceeded, got %v", err)
+	}
+
+	clock.Advance(time.Hour)
+	if err := pub.Publish(ctx, NewMessage(make([]byte, 3))); err != nil {
+		t.Errorf("expected quota reset on the next day, got %v", err)
+	}
+}
+
+func TestQuotaPublisher_RefundsFailedPublishes(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	gated := newGatedPublisher()
+	pub := NewQuotaPublisher(gated, Quota{MaxMessagesPerSecond: 1, MaxBytesPerDay: 10, Clock: clock})
+	ctx := context.Background()
+
+	gated.results <- ErrPublishFailed
+	if err := pub.Publish(ctx, NewMessage(make([]byte, 8))); !errors.Is(err, ErrPublishFailed) {
+		t.Fatalf("Publish() error = %v, want ErrPublishFailed", err)
+	}
+
+	// The failed publish used neither the rate token nor the bytes
+	gated.results <- nil
+	if err := pub.Publish(ctx, NewMessage(make([]byte, 8))); err != nil {
+		t.Errorf("Publish() after a failed publish error = %v", err)
+	}
+}
+
+func TestClient_Quota(t *testing.T) {
+	provider := Provider("test-quota-provider")
+	factory := &recordingFactory{}
+	RegisterProvider(provider, factory)
+
+	client, _ := NewClient(&Config{
+		Provider:         provider,
+		ConnectionString: "amqps://test",
+		Topic:            "topic",
+		Quota:            &Quota{MaxBytesPerDay: 1},
+	})
+	pub, _ := client.NewPublisher(context.Background())
+
+	if err := pub.Publish(context.Background(), NewMessage([]byte("too big"))); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("expected ErrQuotaExceeded, got %v", err)
+	}
+}
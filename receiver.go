@@ -0,0 +1,62 @@
+package gokyu
+
+import (
+	"fmt"
+	"os"
+)
+
+// Receiver identifies the subscriber a message was received through, so that
+// consumers of several sources and audit logs know which pipe a message came
+// from. Providers set it on received messages (see Message.Receiver).
+type Receiver struct {
+	// Provider, Queue, Topic and Subscription identify the entity the
+	// message was received from.
+	Provider     Provider `json:"provider"`
+	Queue        string   `json:"queue,omitempty"`
+	Topic        string   `json:"topic,omitempty"`
+	Subscription string   `json:"subscription,omitempty"`
+
+	// ConsumerID identifies the consuming process (see Config.ConsumerID).
+	ConsumerID string `json:"consumer_id"`
+}
+
+// NewReceiver returns the receiver identity of subscribers created for cfg.
+// Providers create it once per subscriber and set it on every message they
+// return from Receive. Messages of one subscriber share the Receiver, so it
+// must not be modified.
+func NewReceiver(cfg *Config) *Receiver {
+	return &Receiver{
+		Provider:     cfg.Provider,
+		Queue:        cfg.Queue,
+		Topic:        cfg.Topic,
+		Subscription: cfg.Subscription,
+		ConsumerID:   consumerID(cfg),
+	}
+}
+
+// Entity returns the name of the entity the message was received from: the
+// queue, or the topic and subscription.
+func (r *Receiver) Entity() string {
+	if r.Queue != "" {
+		return r.Queue
+	}
+	return r.Topic + "/" + r.Subscription
+}
+
+// String formats the receiver as provider:entity@consumer, for logs.
+func (r *Receiver) String() string {
+	return fmt.Sprintf("%s:%s@%s", r.Provider, r.Entity(), r.ConsumerID)
+}
+
+// consumerID returns cfg.ConsumerID, or else the host name (see
+// Config.ConnectionHostname) and process ID.
+func consumerID(cfg *Config) string {
+	if cfg.ConsumerID != "" {
+		return cfg.ConsumerID
+	}
+	host := cfg.ConnectionHostname
+	if host == "" {
+		host, _ = os.Hostname()
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
@@ -0,0 +1,25 @@
+package gokyu
+
+import (
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestNewReceiver(t *testing.T) {
+	r := NewReceiver(&Config{Provider: ProviderAzure, Topic: "orders", Subscription: "billing", ConsumerID: "worker-1"})
+	if r.Entity() != "orders/billing" {
+		t.Errorf("Entity() = %q", r.Entity())
+	}
+	if got, want := r.String(), string(ProviderAzure)+":orders/billing@worker-1"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+
+	r = NewReceiver(&Config{Provider: ProviderFile, Queue: "jobs", ConnectionHostname: "host-a"})
+	if r.Entity() != "jobs" {
+		t.Errorf("Entity() = %q", r.Entity())
+	}
+	if want := "host-a-" + strconv.Itoa(os.Getpid()); r.ConsumerID != want {
+		t.Errorf("ConsumerID = %q, want %q", r.ConsumerID, want)
+	}
+}
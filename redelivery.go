@@ -0,0 +1,64 @@
+package gokyu
+
+import (
+	"math"
+	"time"
+)
+
+// RedeliveryPolicy delays and limits the redelivery of messages released
+// with Nack, for brokers that would otherwise redeliver them immediately and
+// spin on poison messages. It is set with Config.Redelivery and honoured by
+// the Amazon MQ provider.
+type RedeliveryPolicy struct {
+	// InitialDelay is the delay before the first redelivery (default: 1s).
+	InitialDelay time.Duration
+
+	// Multiplier scales the delay after every redelivery (default: 2).
+	// Use 1 for a constant delay.
+	Multiplier float64
+
+	// MaxDelay caps the delay between redeliveries (default: 1m).
+	MaxDelay time.Duration
+
+	// MaxRedeliveries is the number of redeliveries after which Nack rejects
+	// a message so the broker dead-letters it. Zero leaves the limit to the
+	// broker.
+	MaxRedeliveries int
+
+	// Clock is the time source for delays (default: SystemClock).
+	Clock Clock
+}
+
+// WithDefaults returns the policy with defaults applied.
+func (p RedeliveryPolicy) WithDefaults() RedeliveryPolicy {
+	if p.InitialDelay <= 0 {
+		p.InitialDelay = time.Second
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = 2
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = time.Minute
+	}
+	if p.Clock == nil {
+		p.Clock = SystemClock
+	}
+	return p
+}
+
+// Delay returns how long to hold a message that has already been
+// redelivered the given number of times before releasing it again.
+func (p RedeliveryPolicy) Delay(redeliveries int) time.Duration {
+	p = p.WithDefaults()
+	delay := float64(p.InitialDelay) * math.Pow(p.Multiplier, float64(redeliveries))
+	if delay > float64(p.MaxDelay) {
+		return p.MaxDelay
+	}
+	return time.Duration(delay)
+}
+
+// Exhausted reports whether a message redelivered the given number of times
+// should be dead-lettered instead of released.
+func (p RedeliveryPolicy) Exhausted(redeliveries int) bool {
+	return p.MaxRedeliveries > 0 && redeliveries >= p.MaxRedeliveries
+}
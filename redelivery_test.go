@@ -0,0 +1,40 @@
+package gokyu
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRedeliveryPolicy_Delay(t *testing.T) {
+	tests := []struct {
+		name         string
+		policy       RedeliveryPolicy
+		redeliveries int
+		want         time.Duration
+	}{
+		{name: "defaults first", redeliveries: 0, want: time.Second},
+		{name: "defaults doubled", redeliveries: 3, want: 8 * time.Second},
+		{name: "defaults capped", redeliveries: 10, want: time.Minute},
+		{name: "constant", policy: RedeliveryPolicy{InitialDelay: 5 * time.Second, Multiplier: 1}, redeliveries: 4, want: 5 * time.Second},
+		{name: "custom", policy: RedeliveryPolicy{InitialDelay: 100 * time.Millisecond, Multiplier: 5, MaxDelay: 10 * time.Second}, redeliveries: 2, want: 2500 * time.Millisecond},
+		{name: "custom capped", policy: RedeliveryPolicy{InitialDelay: 100 * time.Millisecond, Multiplier: 5, MaxDelay: 10 * time.Second}, redeliveries: 4, want: 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Delay(tt.redeliveries); got != tt.want {
+				t.Errorf("Delay(%d) = %v, want %v", tt.redeliveries, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedeliveryPolicy_Exhausted(t *testing.T) {
+	if (RedeliveryPolicy{}).Exhausted(100) {
+		t.Error("a policy without MaxRedeliveries should leave the limit to the broker")
+	}
+	policy := RedeliveryPolicy{MaxRedeliveries: 3}
+	if policy.Exhausted(2) || !policy.Exhausted(3) {
+		t.Error("expected the policy to be exhausted after 3 redeliveries")
+	}
+}
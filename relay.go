@@ -0,0 +1,125 @@
+package gokyu
+
+import (
+	"context"
+	"fmt"
+)
+
+// RelayPublisher is a publisher whose link is not bound to one entity, such
+// as an AMQP anonymous relay sender. One relay publisher can address every
+// queue and topic of a namespace.
+type RelayPublisher interface {
+	Publisher
+
+	// PublishTo publishes msg to a queue or topic instead of the configured
+	// destination. The name is mapped to an address the way the provider
+	// maps Config.Topic, including PublishAddressTemplate.
+	PublishTo(ctx context.Context, destination string, msg *Message) error
+}
+
+// RelayProvider is implemented by provider factories that can create relay
+// publishers.
+type RelayProvider interface {
+	// NewRelayPublisher creates a relay publisher. Publish sends to the
+	// configured destination, if any.
+	NewRelayPublisher(ctx context.Context, cfg *Config) (RelayPublisher, error)
+}
+
+// NewRelayPublisher creates a relay publisher using the configured provider.
+// Client settings such as AutoMessageID, PublishHooks and Quota apply as for
+// NewPublisher, with one quota shared by all destinations.
+//
+// Messages published with Message.To set are sent to that destination.
+func (c *Client) NewRelayPublisher(ctx context.Context) (RelayPublisher, error) {
+	pub, err := c.newRelay(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var prepare []chargeFunc
+	if c.config.Quota != nil {
+		quota := *c.config.Quota
+		if quota.Metrics == nil {
+			quota.Metrics = c.metrics
+		}
+		prepare = append(prepare, newQuotaLimiter(quota).admit)
+	}
+	prepare = append(prepare, charging(c.prepareMessage))
+	return &preparingRelayPublisher{RelayPublisher: pub, prepare: prepare}, nil
+}
+
+// newRelay creates a relay publisher of the provider, applying the entity
+// prefix to destinations and rejecting those not allowed.
+func (c *Client) newRelay(ctx context.Context) (RelayPublisher, error) {
+	rp, ok := c.factory.(RelayProvider)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s has no anonymous relay support", ErrUnsupportedProvider, c.config.Provider)
+	}
+	pub, err := rp.NewRelayPublisher(ctx, c.config)
+	if err != nil {
+		return nil, err
+	}
+	if c.config.EntityPrefix != "" {
+		pub = &prefixingRelayPublisher{RelayPublisher: pub, prefix: c.config.EntityPrefix}
+	}
+	if len(c.config.AllowedDestinations) > 0 {
+		pub = &guardedRelayPublisher{RelayPublisher: pub, config: c.config}
+	}
+	return pub, nil
+}
+
+// preparingRelayPublisher prepares messages before relaying them, and
+// refunds their charges if relaying fails.
+type preparingRelayPublisher struct {
+	RelayPublisher
+	prepare []chargeFunc
+}
+
+func (p *preparingRelayPublisher) Publish(ctx context.Context, msg *Message) error {
+	return p.run(ctx, msg, func() error {
+		if msg.To != "" {
+			return p.RelayPublisher.PublishTo(ctx, msg.To, msg)
+		}
+		return p.RelayPublisher.Publish(ctx, msg)
+	})
+}
+
+func (p *preparingRelayPublisher) PublishTo(ctx context.Context, destination string, msg *Message) error {
+	return p.run(ctx, msg, func() error {
+		return p.RelayPublisher.PublishTo(ctx, destination, msg)
+	})
+}
+
+// run prepares msg and publishes it, refunding the charges of the prepare
+// funcs if a later one or publish fails.
+func (p *preparingRelayPublisher) run(ctx context.Context, msg *Message, publish func() error) error {
+	refunds := make([]func(), 0, len(p.prepare))
+	for _, prepare := range p.prepare {
+		r, err := prepare(ctx, msg)
+		if err != nil {
+			refund(refunds...)
+			return err
+		}
+		refunds = append(refunds, r)
+	}
+	if err := publish(); err != nil {
+		refund(refunds...)
+		return err
+	}
+	return nil
+}
+
+// relayDestination publishes to one destination through a shared relay
+// publisher, which it does not own.
+type relayDestination struct {
+	relay       RelayPublisher
+	destination string
+}
+
+func (p *relayDestination) Publish(ctx context.Context, msg *Message) error {
+	return p.relay.PublishTo(ctx, p.destination, msg)
+}
+
+func (p *relayDestination) Close(ctx context.Context) error {
+	return nil
+}
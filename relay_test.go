@@ -0,0 +1,141 @@
+package gokyu
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// relayFactory is a topicFactory that also creates relay publishers.
+type relayFactory struct {
+	topicFactory
+	relays int
+	closed int
+}
+
+func (f *relayFactory) NewRelayPublisher(ctx context.Context, cfg *Config) (RelayPublisher, error) {
+	f.relays++
+	return &relayTestPublisher{factory: f, topic: cfg.Topic}, nil
+}
+
+type relayTestPublisher struct {
+	mockPublisher
+	factory *relayFactory
+	topic   string
+}
+
+func (p *relayTestPublisher) Publish(ctx context.Context, msg *Message) error {
+	return p.PublishTo(ctx, p.topic, msg)
+}
+
+func (p *relayTestPublisher) PublishTo(ctx context.Context, destination string, msg *Message) error {
+	p.factory.published[destination] = append(p.factory.published[destination], msg)
+	return nil
+}
+
+func (p *relayTestPublisher) Close(ctx context.Context) error {
+	p.factory.closed++
+	return nil
+}
+
+func newRelayClient(t *testing.T, provider Provider, cfg Config) (*Client, *relayFactory) {
+	t.Helper()
+	factory := &relayFactory{topicFactory: topicFactory{published: make(map[string][]*Message)}}
+	RegisterProvider(provider, factory)
+
+	cfg.Provider = provider
+	cfg.ConnectionString = "amqps://test"
+	cfg.Topic = "default"
+	client, err := NewClient(&cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, factory
+}
+
+func TestClient_NewRelayPublisher(t *testing.T) {
+	client, factory := newRelayClient(t, "test-relay-provider", Config{
+		AutoMessageID: true,
+		Quota:         &Quota{MaxMessagesPerSecond: 1, Clock: NewFakeClock(time.Unix(0, 0))},
+	})
+
+	pub, err := client.NewRelayPublisher(context.Background())
+	if err != nil {
+		t.Fatalf("NewRelayPublisher() error = %v", err)
+	}
+	if err := pub.PublishTo(context.Background(), "orders", NewMessage([]byte("a"))); err != nil {
+		t.Fatalf("PublishTo() error = %v", err)
+	}
+	if msgs := factory.published["orders"]; len(msgs) != 1 || msgs[0].ID == "" {
+		t.Fatalf("expected one message with an ID on orders, got %v", msgs)
+	}
+
+	// The quota is shared by all destinations
+	if err := pub.PublishTo(context.Background(), "invoices", NewMessage([]byte("b"))); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("expected ErrQuotaExceeded, got %v", err)
+	}
+}
+
+func TestClient_NewRelayPublisher_Unsupported(t *testing.T) {
+	RegisterProvider("test-no-relay-provider", &mockFactory{})
+	client, _ := NewClient(&Config{Provider: "test-no-relay-provider", ConnectionString: "amqps://test", Topic: "t"})
+
+	if _, err := client.NewRelayPublisher(context.Background()); !errors.Is(err, ErrUnsupportedProvider) {
+		t.Errorf("expected ErrUnsupportedProvider, got %v", err)
+	}
+}
+
+func TestRouter_AnonymousRelay(t *testing.T) {
+	type orderCreated struct{ ID int }
+	type orderShipped struct{ ID int }
+
+	client, factory := newRelayClient(t, "test-relay-router-provider", Config{AnonymousRelay: true})
+	router := NewRouter(client)
+	router.Route(orderCreated{}, "orders.created")
+	router.Route(orderShipped{}, "orders.shipped")
+
+	ctx := context.Background()
+	router.Publish(ctx, orderCreated{ID: 1})
+	router.Publish(ctx, orderShipped{ID: 1})
+	router.Publish(ctx, orderCreated{ID: 2})
+
+	if factory.relays != 1 || factory.created != 0 {
+		t.Errorf("expected one relay and no per-destination publishers, got %d relays and %d publishers", factory.relays, factory.created)
+	}
+	if len(factory.published["orders.created"]) != 2 || len(factory.published["orders.shipped"]) != 1 {
+		t.Errorf("unexpected routing: %v", factory.published)
+	}
+
+	router.Close(ctx)
+	if factory.closed != 1 {
+		t.Errorf("expected the relay to be closed once, got %d", factory.closed)
+	}
+}
+
+func TestTenantPublisher_AnonymousRelay(t *testing.T) {
+	client, factory := newRelayClient(t, "test-relay-tenant-provider", Config{AnonymousRelay: true})
+	tenants := NewTenantPublisher(client, TenantOptions{Naming: TenantPrefix("orders-"), MaxPublishers: 1})
+
+	ctx := context.Background()
+	for _, tenant := range []string{"acme", "globex", "acme"} {
+		if err := tenants.Publish(ctx, tenant, NewMessage([]byte("x"))); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+
+	if factory.relays != 1 || factory.created != 0 {
+		t.Errorf("expected one relay and no per-queue publishers, got %d relays and %d publishers", factory.relays, factory.created)
+	}
+	if len(factory.published["orders-acme"]) != 2 || len(factory.published["orders-globex"]) != 1 {
+		t.Errorf("unexpected routing: %v", factory.published)
+	}
+	if got := factory.published["orders-globex"][0].Properties[PropertyTenant]; got != "globex" {
+		t.Errorf("expected the tenant property, got %v", got)
+	}
+
+	tenants.Close(ctx)
+	if factory.closed != 1 {
+		t.Errorf("expected the relay to be closed once, got %d", factory.closed)
+	}
+}
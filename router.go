@@ -0,0 +1,154 @@
+package gokyu
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Router publishes typed values to destinations chosen by their Go type, so
+// topic names are defined in one place:
+//
+//	router := gokyu.NewRouter(client)
+//	router.Route(OrderCreated{}, "orders.created")
+//	router.Route(OrderShipped{}, "orders.shipped")
+//
+//	err := router.Publish(ctx, OrderCreated{ID: 42})
+type Router struct {
+	client      *Client
+	contentType string
+
+	mu         sync.Mutex
+	routes     map[reflect.Type]string
+	publishers map[string]Publisher
+	relay      RelayPublisher
+}
+
+// NewRouter creates a router that publishes through publishers created from
+// the client's configuration with the topic replaced by the routed destination,
+// or through one relay publisher if Config.AnonymousRelay is set.
+// Values are encoded as JSON.
+func NewRouter(client *Client) *Router {
+	return NewRouterWithContentType(client, ContentTypeJSON)
+}
+
+// NewRouterWithContentType creates a router that encodes values with the
+// codec registered for contentType.
+func NewRouterWithContentType(client *Client, contentType string) *Router {
+	return &Router{
+		client:      client,
+		contentType: contentType,
+		routes:      make(map[reflect.Type]string),
+		publishers:  make(map[string]Publisher),
+	}
+}
+
+// Route maps the type of v to a destination topic. Values and pointers of the
+// same type share a route.
+func (r *Router) Route(v interface{}, destination string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.routes[routeType(v)] = destination
+}
+
+// Destination returns the destination routed for the type of v.
+func (r *Router) Destination(v interface{}) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t := routeType(v)
+	dest, ok := r.routes[t]
+	if !ok {
+		return "", fmt.Errorf("%w: %v", ErrNoRoute, t)
+	}
+	return dest, nil
+}
+
+// Publish encodes v and publishes it to the destination routed for its type.
+func (r *Router) Publish(ctx context.Context, v interface{}) error {
+	dest, err := r.Destination(v)
+	if err != nil {
+		return err
+	}
+
+	msg, err := Encode(r.contentType, v)
+	if err != nil {
+		return err
+	}
+
+	pub, err := r.publisher(ctx, dest)
+	if err != nil {
+		return err
+	}
+	return pub.Publish(ctx, msg)
+}
+
+// Close closes all publishers created by the router.
+func (r *Router) Close(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var firstErr error
+	for dest, pub := range r.publishers {
+		if err := pub.Close(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(r.publishers, dest)
+	}
+	if r.relay != nil {
+		if err := r.relay.Close(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		r.relay = nil
+	}
+	return firstErr
+}
+
+// publisher returns the cached publisher for a destination, creating it on first use.
+func (r *Router) publisher(ctx context.Context, dest string) (Publisher, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if pub, ok := r.publishers[dest]; ok {
+		return pub, nil
+	}
+
+	if r.client.config.AnonymousRelay {
+		if r.relay == nil {
+			relay, err := r.client.NewRelayPublisher(ctx)
+			if err != nil {
+				return nil, err
+			}
+			r.relay = relay
+		}
+		pub := &relayDestination{relay: r.relay, destination: dest}
+		r.publishers[dest] = pub
+		return pub, nil
+	}
+
+	cfg := r.client.Config()
+	cfg.Topic = dest
+	cfg.Queue = ""
+	cfg.Metrics = r.client.limited
+
+	client, err := NewClient(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := client.NewPublisher(ctx)
+	if err != nil {
+		return nil, err
+	}
+	r.publishers[dest] = pub
+	return pub, nil
+}
+
+// routeType returns the routing key for v, dereferencing pointer types.
+func routeType(v interface{}) reflect.Type {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
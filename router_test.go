@@ -0,0 +1,87 @@
+package gokyu
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// topicFactory creates publishers that record messages per configured topic.
+type topicFactory struct {
+	mockFactory
+	created   int
+	published map[string][]*Message
+}
+
+func (f *topicFactory) NewPublisher(ctx context.Context, cfg *Config) (Publisher, error) {
+	f.created++
+	return &topicPublisher{factory: f, topic: cfg.Topic}, nil
+}
+
+type topicPublisher struct {
+	mockPublisher
+	factory *topicFactory
+	topic   string
+}
+
+func (p *topicPublisher) Publish(ctx context.Context, msg *Message) error {
+	p.factory.published[p.topic] = append(p.factory.published[p.topic], msg)
+	return nil
+}
+
+func TestRouter_Publish(t *testing.T) {
+	type orderCreated struct {
+		ID int `json:"id"`
+	}
+	type orderShipped struct {
+		ID int `json:"id"`
+	}
+
+	provider := Provider("test-router-provider")
+	factory := &topicFactory{published: make(map[string][]*Message)}
+	RegisterProvider(provider, factory)
+
+	client, _ := NewClient(&Config{
+		Provider:         provider,
+		ConnectionString: "amqps://test",
+		Queue:            "default-queue",
+	})
+
+	router := NewRouter(client)
+	router.Route(orderCreated{}, "orders.created")
+	router.Route(&orderShipped{}, "orders.shipped")
+
+	ctx := context.Background()
+	if err := router.Publish(ctx, orderCreated{ID: 1}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if err := router.Publish(ctx, &orderCreated{ID: 2}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if err := router.Publish(ctx, orderShipped{ID: 3}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	if got := len(factory.published["orders.created"]); got != 2 {
+		t.Errorf("expected 2 messages on orders.created, got %d", got)
+	}
+	if got := len(factory.published["orders.shipped"]); got != 1 {
+		t.Errorf("expected 1 message on orders.shipped, got %d", got)
+	}
+	if factory.created != 2 {
+		t.Errorf("expected 2 publishers to be created, got %d", factory.created)
+	}
+
+	msg := factory.published["orders.shipped"][0]
+	if string(msg.Body) != `{"id":3}` || msg.ContentType != ContentTypeJSON {
+		t.Errorf("unexpected message: body=%s contentType=%s", msg.Body, msg.ContentType)
+	}
+
+	if err := router.Publish(ctx, "unrouted"); !errors.Is(err, ErrNoRoute) {
+		t.Errorf("expected ErrNoRoute, got %v", err)
+	}
+
+	if err := router.Close(ctx); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+}
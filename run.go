@@ -0,0 +1,142 @@
+package gokyu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultGracePeriod is how long RunUntilSignal waits for consumers to drain.
+const DefaultGracePeriod = 30 * time.Second
+
+// ErrGracePeriodExceeded is returned by RunUntilSignal when consumers are
+// still running once the grace period has passed.
+var ErrGracePeriodExceeded = errors.New("gokyu: grace period exceeded")
+
+// Runner is a long-running component, such as a consumer loop, that runs
+// until its context is cancelled, finishing the message it is handling
+// before it returns. DelayRelay, archive.Archiver, scheduler.Scheduler and
+// webhook.Bridge are runners.
+type Runner interface {
+	Run(ctx context.Context) error
+}
+
+// RunnerFunc adapts a function to Runner.
+type RunnerFunc func(ctx context.Context) error
+
+// Run calls f(ctx).
+func (f RunnerFunc) Run(ctx context.Context) error {
+	return f(ctx)
+}
+
+// RunOptions configures RunUntilSignal.
+type RunOptions struct {
+	// GracePeriod bounds how long consumers may take to drain after a
+	// signal, and then how long Shutdown may take (default:
+	// DefaultGracePeriod).
+	GracePeriod time.Duration
+
+	// Signals start the drain (default: SIGINT and SIGTERM). A second
+	// signal stops waiting immediately.
+	Signals []os.Signal
+
+	// Shutdown, if set, runs once the consumers have stopped, e.g. to flush
+	// publishers and close connections.
+	Shutdown *Shutdown
+
+	// Clock times the grace period (default: SystemClock).
+	Clock Clock
+}
+
+// RunUntilSignal runs consumers until SIGINT or SIGTERM arrives or ctx is
+// done, then cancels them and waits for them to drain, with the defaults of
+// RunOptions:
+//
+//	err := gokyu.RunUntilSignal(ctx, consumer, gokyu.RunnerFunc(relay.Run))
+//
+// If a consumer fails, the others are stopped as if a signal had arrived.
+func RunUntilSignal(ctx context.Context, consumers ...Runner) error {
+	return RunOptions{}.RunUntilSignal(ctx, consumers...)
+}
+
+// RunUntilSignal runs consumers as RunUntilSignal does, with the options of o.
+// It returns the errors of failed consumers and of Shutdown joined, and
+// ErrGracePeriodExceeded if consumers did not drain in time. Consumers
+// returning the context's error after the drain started have not failed.
+func (o RunOptions) RunUntilSignal(ctx context.Context, consumers ...Runner) error {
+	if o.GracePeriod <= 0 {
+		o.GracePeriod = DefaultGracePeriod
+	}
+	if len(o.Signals) == 0 {
+		o.Signals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+	}
+	if o.Clock == nil {
+		o.Clock = SystemClock
+	}
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, o.Signals...)
+	defer signal.Stop(signals)
+
+	runCtx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for _, consumer := range consumers {
+		wg.Add(1)
+		go func(consumer Runner) {
+			defer wg.Done()
+			err := consumer.Run(runCtx)
+			if err != nil && !(runCtx.Err() != nil && errors.Is(err, runCtx.Err())) {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+				// One failed consumer takes the others down with it
+				stop()
+			}
+		}(consumer)
+	}
+	drained := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-signals:
+	case <-runCtx.Done():
+	case <-drained:
+	}
+	stop()
+
+	var drainErr error
+	grace := o.Clock.NewTimer(o.GracePeriod)
+	defer grace.Stop()
+	select {
+	case <-drained:
+	case <-grace.C():
+		drainErr = fmt.Errorf("%w: consumers still running after %v", ErrGracePeriodExceeded, o.GracePeriod)
+	case sig := <-signals:
+		drainErr = fmt.Errorf("%w: %v received while draining", ErrGracePeriodExceeded, sig)
+	}
+
+	var shutdownErr error
+	if o.Shutdown != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), o.GracePeriod)
+		defer cancel()
+		shutdownErr = o.Shutdown.Run(shutdownCtx)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	return errors.Join(append(errs, drainErr, shutdownErr)...)
+}
@@ -0,0 +1,108 @@
+package gokyu
+
+import (
+	"context"
+	"errors"
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// drainingRunner runs until its context is cancelled, then takes drain to
+// finish the message in hand.
+func drainingRunner(drained *bool) Runner {
+	return RunnerFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		*drained = true
+		return ctx.Err()
+	})
+}
+
+func TestRunUntilSignal_ContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var drained, closed bool
+	shutdown := NewShutdown()
+	shutdown.Register(PhaseCloseConnections, "client", func(ctx context.Context) error {
+		closed = drained
+		return nil
+	})
+
+	cancel()
+	err := RunOptions{Shutdown: shutdown}.RunUntilSignal(ctx, drainingRunner(&drained))
+	if err != nil {
+		t.Fatalf("RunUntilSignal() error = %v", err)
+	}
+	if !closed {
+		t.Error("expected the shutdown to run after the consumer drained")
+	}
+}
+
+func TestRunUntilSignal_ConsumerFailure(t *testing.T) {
+	failed := errors.New("receive failed")
+	var drained bool
+
+	err := RunUntilSignal(context.Background(),
+		drainingRunner(&drained),
+		RunnerFunc(func(ctx context.Context) error { return failed }),
+	)
+	if !errors.Is(err, failed) {
+		t.Errorf("RunUntilSignal() error = %v, want %v", err, failed)
+	}
+	if !drained {
+		t.Error("expected the other consumer to be stopped")
+	}
+}
+
+func TestRunUntilSignal_GracePeriod(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	stuck := make(chan struct{})
+	defer close(stuck)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- RunOptions{GracePeriod: time.Second, Clock: clock}.RunUntilSignal(ctx, RunnerFunc(func(ctx context.Context) error {
+			<-stuck
+			return nil
+		}))
+	}()
+
+	cancel()
+	waitForTimers(t, clock, 1)
+	clock.Advance(time.Second)
+	if err := <-done; !errors.Is(err, ErrGracePeriodExceeded) {
+		t.Errorf("RunUntilSignal() error = %v, want ErrGracePeriodExceeded", err)
+	}
+}
+
+func TestRunUntilSignal_SIGTERM(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals cannot be sent to the own process on windows")
+	}
+
+	started := make(chan struct{})
+	var drained bool
+	done := make(chan error, 1)
+	go func() {
+		done <- RunUntilSignal(context.Background(), RunnerFunc(func(ctx context.Context) error {
+			close(started)
+			return drainingRunner(&drained).Run(ctx)
+		}))
+	}()
+
+	<-started
+	p, _ := os.FindProcess(os.Getpid())
+	if err := p.Signal(syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-done:
+		if err != nil || !drained {
+			t.Errorf("RunUntilSignal() error = %v, drained = %v", err, drained)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the drain")
+	}
+}
@@ -0,0 +1,19 @@
+package gokyu
+
+import "math/rand"
+
+// NewSamplingSubscriber wraps a subscriber so that Receive returns only a
+// random sample of messages, where rate is the fraction to keep (0 to 1).
+// Messages outside the sample are settled according to skip. SkipRelease
+// counts as a failed delivery on both Service Bus and ActiveMQ: the message
+// is redelivered at once and moves toward the dead-letter queue, so use
+// Client.NewBrowser to inspect a subscription other consumers depend on.
+func NewSamplingSubscriber(sub Subscriber, rate float64, skip SkipAction, metrics Metrics) Subscriber {
+	return NewFilteringSubscriber(sub, FilterOptions{
+		Filter: func(*Message) bool {
+			return rate >= 1 || rand.Float64() < rate
+		},
+		Skip:    skip,
+		Metrics: metrics,
+	})
+}
@@ -0,0 +1,31 @@
+package gokyu
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSamplingSubscriber_Receive(t *testing.T) {
+	t.Run("rate 1 keeps all", func(t *testing.T) {
+		msg := NewMessage(nil)
+		stub := &stubSubscriber{msgs: []*Message{msg}}
+		sub := NewSamplingSubscriber(stub, 1, SkipRelease, nil)
+
+		got, err := sub.Receive(context.Background())
+		if err != nil || got != msg {
+			t.Errorf("expected message to be sampled, got %v, %v", got, err)
+		}
+	})
+
+	t.Run("rate 0 releases all", func(t *testing.T) {
+		stub := &stubSubscriber{msgs: []*Message{NewMessage(nil), NewMessage(nil)}}
+		sub := NewSamplingSubscriber(stub, 0, SkipRelease, nil)
+
+		if _, err := sub.Receive(context.Background()); err == nil {
+			t.Error("expected receive error once the stub is drained")
+		}
+		if len(stub.nacked) != 2 || len(stub.acked) != 0 {
+			t.Errorf("expected 2 released messages, got %d nacks and %d acks", len(stub.nacked), len(stub.acked))
+		}
+	})
+}
@@ -0,0 +1,212 @@
+package gokyu
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// ScalingOptions configures a ScalingAdvisor.
+type ScalingOptions struct {
+	// Window is the period over which rates are measured (default: 1m).
+	Window time.Duration
+
+	// TargetUtilization is the fraction of time consumers should be busy
+	// (default: 0.8). The headroom absorbs bursts, and makes a saturated
+	// consumer pool, which is busy all the time, scale up.
+	TargetUtilization float64
+
+	// MinConsumers and MaxConsumers bound the recommendation (default: 1
+	// and unbounded).
+	MinConsumers int
+	MaxConsumers int
+
+	// Clock is the time source (default: SystemClock).
+	Clock Clock
+}
+
+// WithDefaults returns the options with defaults applied.
+func (o ScalingOptions) WithDefaults() ScalingOptions {
+	if o.Window <= 0 {
+		o.Window = time.Minute
+	}
+	if o.TargetUtilization <= 0 || o.TargetUtilization > 1 {
+		o.TargetUtilization = 0.8
+	}
+	if o.MinConsumers < 1 {
+		o.MinConsumers = 1
+	}
+	if o.Clock == nil {
+		o.Clock = SystemClock
+	}
+	return o
+}
+
+// ScalingRecommendation is the concurrency recommended by a ScalingAdvisor
+// and the measurements it is based on.
+type ScalingRecommendation struct {
+	// ArrivalRate is the number of messages received per second.
+	ArrivalRate float64 `json:"arrival_rate"`
+
+	// ProcessingTime is the mean time from receiving a message to settling
+	// it.
+	ProcessingTime time.Duration `json:"processing_time"`
+
+	// Concurrency is the mean number of messages being processed at once,
+	// ArrivalRate × ProcessingTime by Little's law.
+	Concurrency float64 `json:"concurrency"`
+
+	// Consumers is the recommended number of concurrent consumers:
+	// Concurrency over the target utilization, rounded up and bounded.
+	Consumers int `json:"consumers"`
+}
+
+// ScalingAdvisor recommends consumer concurrency from the observed arrival
+// rate and processing time, so that an orchestration layer can adjust
+// worker counts. Wrap the subscribers of the consumers it advises with
+// Subscriber, or report observations directly.
+//
+// The advisor sees the messages of this process only; with several
+// instances, sum the recommended consumers.
+type ScalingAdvisor struct {
+	opts    ScalingOptions
+	started time.Time
+
+	mu      sync.Mutex
+	buckets []scalingBucket
+}
+
+// scalingBucket holds the observations of one second.
+type scalingBucket struct {
+	second    int64
+	arrivals  int
+	processed int
+	busy      time.Duration
+}
+
+// NewScalingAdvisor creates a scaling advisor.
+func NewScalingAdvisor(opts ScalingOptions) *ScalingAdvisor {
+	opts = opts.WithDefaults()
+	return &ScalingAdvisor{
+		opts:    opts,
+		started: opts.Clock.Now(),
+		buckets: make([]scalingBucket, int(opts.Window/time.Second)+1),
+	}
+}
+
+// ObserveArrival records that a message was received.
+func (a *ScalingAdvisor) ObserveArrival() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.bucket().arrivals++
+}
+
+// ObserveProcessed records that a message was settled after d of processing.
+func (a *ScalingAdvisor) ObserveProcessed(d time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	b := a.bucket()
+	b.processed++
+	b.busy += d
+}
+
+// bucket returns the bucket of the current second, resetting it if it holds
+// an older second. The caller holds a.mu.
+func (a *ScalingAdvisor) bucket() *scalingBucket {
+	second := a.opts.Clock.Now().Unix()
+	b := &a.buckets[int(second%int64(len(a.buckets)))]
+	if b.second != second {
+		*b = scalingBucket{second: second}
+	}
+	return b
+}
+
+// Recommendation returns the recommended concurrency for the observations
+// of the last Window. Until a message has been processed, it recommends
+// MinConsumers.
+func (a *ScalingAdvisor) Recommendation() ScalingRecommendation {
+	now := a.opts.Clock.Now()
+	window := a.opts.Window
+	if elapsed := now.Sub(a.started); elapsed < window {
+		window = elapsed
+	}
+	if window < time.Second {
+		window = time.Second
+	}
+
+	var arrivals, processed int
+	var busy time.Duration
+	a.mu.Lock()
+	oldest := now.Add(-window).Unix()
+	for _, b := range a.buckets {
+		if b.second >= oldest && b.second <= now.Unix() {
+			arrivals += b.arrivals
+			processed += b.processed
+			busy += b.busy
+		}
+	}
+	a.mu.Unlock()
+
+	rec := ScalingRecommendation{ArrivalRate: float64(arrivals) / window.Seconds()}
+	if processed > 0 {
+		rec.ProcessingTime = busy / time.Duration(processed)
+	}
+	rec.Concurrency = rec.ArrivalRate * rec.ProcessingTime.Seconds()
+	rec.Consumers = int(math.Ceil(rec.Concurrency / a.opts.TargetUtilization))
+	if rec.Consumers < a.opts.MinConsumers {
+		rec.Consumers = a.opts.MinConsumers
+	}
+	if a.opts.MaxConsumers > 0 && rec.Consumers > a.opts.MaxConsumers {
+		rec.Consumers = a.opts.MaxConsumers
+	}
+	return rec
+}
+
+// Subscriber wraps sub to report every received message as an arrival, and
+// the time until it is acked or nacked as its processing time.
+func (a *ScalingAdvisor) Subscriber(sub Subscriber) Subscriber {
+	return &scalingSubscriber{Subscriber: sub, advisor: a, received: make(map[*Message]time.Time)}
+}
+
+// scalingSubscriber reports observations to a ScalingAdvisor.
+type scalingSubscriber struct {
+	Subscriber
+	advisor *ScalingAdvisor
+
+	mu       sync.Mutex
+	received map[*Message]time.Time
+}
+
+func (s *scalingSubscriber) Receive(ctx context.Context) (*Message, error) {
+	msg, err := s.Subscriber.Receive(ctx)
+	if err != nil {
+		return msg, err
+	}
+	s.advisor.ObserveArrival()
+	s.mu.Lock()
+	s.received[msg] = s.advisor.opts.Clock.Now()
+	s.mu.Unlock()
+	return msg, nil
+}
+
+// settled reports the processing time of msg.
+func (s *scalingSubscriber) settled(msg *Message) {
+	s.mu.Lock()
+	received, ok := s.received[msg]
+	delete(s.received, msg)
+	s.mu.Unlock()
+	if ok {
+		s.advisor.ObserveProcessed(s.advisor.opts.Clock.Now().Sub(received))
+	}
+}
+
+func (s *scalingSubscriber) Ack(ctx context.Context, msg *Message) error {
+	s.settled(msg)
+	return s.Subscriber.Ack(ctx, msg)
+}
+
+func (s *scalingSubscriber) Nack(ctx context.Context, msg *Message) error {
+	s.settled(msg)
+	return s.Subscriber.Nack(ctx, msg)
+}
@@ -0,0 +1,49 @@
+package gokyu
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestScalingAdvisor_Recommendation(t *testing.T) {
+	clock := NewFakeClock(time.Unix(1000, 0))
+	advisor := NewScalingAdvisor(ScalingOptions{Window: 10 * time.Second, MaxConsumers: 8, Clock: clock})
+	if rec := advisor.Recommendation(); rec.Consumers != 1 {
+		t.Errorf("Recommendation() before any message = %+v, want 1 consumer", rec)
+	}
+
+	// 4 messages per second taking 250ms each keep one consumer busy
+	stub := &stubSubscriber{}
+	for i := 0; i < 40; i++ {
+		stub.msgs = append(stub.msgs, NewMessage(nil))
+	}
+	sub := advisor.Subscriber(stub)
+	ctx := context.Background()
+	for i := 0; i < 40; i++ {
+		msg, _ := sub.Receive(ctx)
+		clock.Advance(250 * time.Millisecond)
+		sub.Ack(ctx, msg)
+	}
+
+	rec := advisor.Recommendation()
+	want := ScalingRecommendation{ArrivalRate: 4, ProcessingTime: 250 * time.Millisecond, Concurrency: 1, Consumers: 2}
+	if rec != want {
+		t.Errorf("Recommendation() = %+v, want %+v", rec, want)
+	}
+
+	// A burst of slow messages is bounded by MaxConsumers
+	for i := 0; i < 100; i++ {
+		advisor.ObserveArrival()
+		advisor.ObserveProcessed(2 * time.Second)
+	}
+	if rec := advisor.Recommendation(); rec.Consumers != 8 {
+		t.Errorf("Recommendation() = %+v, want 8 consumers", rec)
+	}
+
+	// Observations age out of the window
+	clock.Advance(20 * time.Second)
+	if rec := advisor.Recommendation(); rec.ArrivalRate != 0 || rec.Consumers != 1 {
+		t.Errorf("Recommendation() after the window = %+v", rec)
+	}
+}
@@ -0,0 +1,157 @@
+package gokyu
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Properties used to emulate cancellable scheduled messages on providers
+// without native support.
+const (
+	// PropertyScheduleToken carries the cancellation token of a scheduled message.
+	PropertyScheduleToken = "gokyu-schedule-token"
+
+	// PropertyTombstone marks a message that cancels the scheduled message
+	// with the same token.
+	PropertyTombstone = "gokyu-tombstone"
+)
+
+// ScheduledPublisher is implemented by publishers that can deliver messages
+// at a future time. Use a type assertion to check for support:
+//
+//	if sp, ok := publisher.(gokyu.ScheduledPublisher); ok {
+//	    token, err := sp.Schedule(ctx, msg, time.Now().Add(time.Hour))
+//	}
+type ScheduledPublisher interface {
+	Publisher
+
+	// Schedule enqueues a message for delivery at the given time and returns
+	// a token that can be used to cancel it.
+	Schedule(ctx context.Context, msg *Message, at time.Time) (string, error)
+
+	// CancelScheduled revokes a scheduled message before it is delivered.
+	// Publishers emulating it with tombstones (see NewTombstoneSubscriber)
+	// cancel on a best-effort basis only.
+	CancelScheduled(ctx context.Context, token string) error
+}
+
+// BatchScheduler is implemented by scheduled publishers that can schedule
+// many messages in few broker operations, such as Azure Service Bus. Use
+// ScheduleBatch, which falls back to Schedule for other publishers.
+type BatchScheduler interface {
+	// ScheduleBatch enqueues msgs for delivery at the given time and returns
+	// their cancellation tokens in order.
+	ScheduleBatch(ctx context.Context, msgs []*Message, at time.Time) ([]string, error)
+}
+
+// ScheduleBatch enqueues msgs for delivery at the given time through sp and
+// returns their cancellation tokens in order. Publishers implementing
+// BatchScheduler schedule them in batches; others one at a time. On error,
+// the returned tokens are those of the messages scheduled before the
+// failure, which are not cancelled.
+func ScheduleBatch(ctx context.Context, sp ScheduledPublisher, msgs []*Message, at time.Time) ([]string, error) {
+	if bs, ok := sp.(BatchScheduler); ok {
+		return bs.ScheduleBatch(ctx, msgs, at)
+	}
+
+	tokens := make([]string, 0, len(msgs))
+	for _, msg := range msgs {
+		token, err := sp.Schedule(ctx, msg, at)
+		if err != nil {
+			return tokens, err
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+// maxTombstones bounds the number of pending tombstones remembered by a
+// tombstone subscriber.
+const maxTombstones = 10000
+
+// NewTombstoneSubscriber wraps a subscriber to honour emulated cancellations.
+// Tombstone messages are acknowledged and remembered, and scheduled messages
+// whose token has been tombstoned are acknowledged without being returned.
+//
+// Providers that emulate CancelScheduled with tombstones (such as Amazon MQ)
+// require consumers to use this wrapper for cancellation to take effect.
+// The emulation is best-effort: tombstones are remembered only in the
+// memory of the subscriber that received them, so competing consumers,
+// restarted consumers and subscribers that received the scheduled message
+// before its tombstone still deliver cancelled messages.
+func NewTombstoneSubscriber(sub Subscriber) Subscriber {
+	return &tombstoneSubscriber{
+		Subscriber: sub,
+		tombstones: make(map[string]struct{}),
+	}
+}
+
+// tombstoneSubscriber drops cancelled scheduled messages.
+type tombstoneSubscriber struct {
+	Subscriber
+
+	mu         sync.Mutex
+	tombstones map[string]struct{}
+	order      []string
+}
+
+func (s *tombstoneSubscriber) Receive(ctx context.Context) (*Message, error) {
+	for {
+		msg, err := s.Subscriber.Receive(ctx)
+		if err != nil {
+			return msg, err
+		}
+
+		if token, ok := msg.Properties[PropertyTombstone].(string); ok {
+			s.remember(token)
+			if err := s.Subscriber.Ack(ctx, msg); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if token, ok := msg.Properties[PropertyScheduleToken].(string); ok && s.forget(token) {
+			if err := s.Subscriber.Ack(ctx, msg); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		return msg, nil
+	}
+}
+
+// remember records a tombstoned token, evicting the oldest when full.
+func (s *tombstoneSubscriber) remember(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tombstones[token]; ok {
+		return
+	}
+	if len(s.order) >= maxTombstones {
+		delete(s.tombstones, s.order[0])
+		s.order = s.order[1:]
+	}
+	s.tombstones[token] = struct{}{}
+	s.order = append(s.order, token)
+}
+
+// forget removes a token and reports whether it was tombstoned.
+func (s *tombstoneSubscriber) forget(token string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tombstones[token]; !ok {
+		return false
+	}
+	delete(s.tombstones, token)
+	for i, t := range s.order {
+		if t == token {
+			s.order = append(s.order[:i], s.order[i+1:]...)
+			break
+		}
+	}
+	return true
+}
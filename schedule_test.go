@@ -0,0 +1,165 @@
+package gokyu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// countingScheduler schedules messages one at a time, failing on failAt.
+type countingScheduler struct {
+	mockPublisher
+	scheduled []string
+	failAt    int
+}
+
+func (p *countingScheduler) Schedule(ctx context.Context, msg *Message, at time.Time) (string, error) {
+	if p.failAt > 0 && len(p.scheduled)+1 == p.failAt {
+		return "", errors.New("broker unavailable")
+	}
+	p.scheduled = append(p.scheduled, msg.ID)
+	return fmt.Sprintf("token-%d", len(p.scheduled)), nil
+}
+
+func (p *countingScheduler) CancelScheduled(ctx context.Context, token string) error { return nil }
+
+// batchingScheduler also schedules messages in batches.
+type batchingScheduler struct {
+	countingScheduler
+	batches [][]*Message
+}
+
+func (p *batchingScheduler) ScheduleBatch(ctx context.Context, msgs []*Message, at time.Time) ([]string, error) {
+	p.batches = append(p.batches, msgs)
+	tokens := make([]string, len(msgs))
+	for i, msg := range msgs {
+		tokens[i] = "batch-" + msg.ID
+	}
+	return tokens, nil
+}
+
+// schedulingFactory creates publishers that schedule through pub.
+type schedulingFactory struct {
+	mockFactory
+	pub Publisher
+}
+
+func (f *schedulingFactory) NewPublisher(ctx context.Context, cfg *Config) (Publisher, error) {
+	return f.pub, nil
+}
+
+func scheduleMessages(ids ...string) []*Message {
+	msgs := make([]*Message, len(ids))
+	for i, id := range ids {
+		msgs[i] = NewMessage(nil)
+		msgs[i].ID = id
+	}
+	return msgs
+}
+
+func TestScheduleBatch_Fallback(t *testing.T) {
+	ctx := context.Background()
+	at := time.Unix(2000, 0)
+
+	sp := &countingScheduler{}
+	tokens, err := ScheduleBatch(ctx, sp, scheduleMessages("a", "b", "c"), at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"token-1", "token-2", "token-3"}; !reflect.DeepEqual(tokens, want) {
+		t.Errorf("tokens = %v, want %v", tokens, want)
+	}
+
+	failing := &countingScheduler{failAt: 2}
+	tokens, err = ScheduleBatch(ctx, failing, scheduleMessages("a", "b", "c"), at)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if want := []string{"token-1"}; !reflect.DeepEqual(tokens, want) {
+		t.Errorf("tokens on error = %v, want %v", tokens, want)
+	}
+}
+
+func TestScheduleBatch_ThroughClient(t *testing.T) {
+	sp := &batchingScheduler{}
+	RegisterProvider("test-schedule-batch-provider", &schedulingFactory{pub: sp})
+	client, err := NewClient(&Config{
+		Provider:         "test-schedule-batch-provider",
+		ConnectionString: "amqps://test",
+		Queue:            "reminders",
+		AutoMessageID:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := client.NewPublisher(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pub.Close(context.Background())
+
+	scheduled, ok := pub.(ScheduledPublisher)
+	if !ok {
+		t.Fatalf("publisher %T does not schedule", pub)
+	}
+	msgs := scheduleMessages("", "")
+	tokens, err := ScheduleBatch(context.Background(), scheduled, msgs, time.Unix(2000, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sp.batches) != 1 || len(sp.batches[0]) != 2 || len(sp.scheduled) != 0 {
+		t.Fatalf("batches = %v, scheduled one by one = %v", sp.batches, sp.scheduled)
+	}
+	for i, msg := range msgs {
+		if msg.ID == "" || tokens[i] != "batch-"+msg.ID {
+			t.Errorf("message %d: ID %q, token %q; want prepared message", i, msg.ID, tokens[i])
+		}
+	}
+
+	addressed := scheduleMessages("x")
+	addressed[0].To = "audit"
+	if _, err := ScheduleBatch(context.Background(), scheduled, addressed, time.Unix(2000, 0)); err == nil {
+		t.Error("expected addressed messages to be rejected")
+	}
+}
+
+func TestTombstoneSubscriber_Receive(t *testing.T) {
+	scheduled := NewMessage([]byte("reminder"))
+	scheduled.Properties[PropertyScheduleToken] = "token-1"
+
+	tombstone := NewMessage(nil)
+	tombstone.Properties[PropertyTombstone] = "token-1"
+
+	other := NewMessage([]byte("other"))
+	other.Properties[PropertyScheduleToken] = "token-2"
+
+	stub := &stubSubscriber{msgs: []*Message{tombstone, scheduled, other}}
+	sub := NewTombstoneSubscriber(stub)
+
+	got, err := sub.Receive(context.Background())
+	if err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	if got != other {
+		t.Errorf("expected the non-cancelled message, got %q", got.Body)
+	}
+	if len(stub.acked) != 2 || stub.acked[0] != tombstone || stub.acked[1] != scheduled {
+		t.Errorf("expected tombstone and cancelled message to be acked, got %d acks", len(stub.acked))
+	}
+}
+
+func TestTombstoneSubscriber_ReturnsFailedMessages(t *testing.T) {
+	u := NewUpcasters("version")
+	u.Register(1, func(msg *Message) error { return errors.New("bad payload") })
+
+	msg := NewMessage([]byte("body"))
+	sub := NewTombstoneSubscriber(NewUpcastingSubscriber(&stubSubscriber{msgs: []*Message{msg}}, u))
+
+	got, err := sub.Receive(context.Background())
+	if !errors.Is(err, ErrUpcastFailed) || got != msg {
+		t.Errorf("Receive() = %v, %v, want the message that failed to upcast so it can be settled", got, err)
+	}
+}
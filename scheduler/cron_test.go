@@ -0,0 +1,70 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule_Next(t *testing.T) {
+	// Wednesday
+	base := time.Date(2024, 1, 10, 10, 30, 15, 0, time.UTC)
+
+	tests := []struct {
+		spec string
+		want time.Time
+	}{
+		{spec: "* * * * *", want: time.Date(2024, 1, 10, 10, 31, 0, 0, time.UTC)},
+		{spec: "*/15 * * * *", want: time.Date(2024, 1, 10, 10, 45, 0, 0, time.UTC)},
+		{spec: "0 9-17 * * mon-fri", want: time.Date(2024, 1, 10, 11, 0, 0, 0, time.UTC)},
+		{spec: "0 0 * * sun", want: time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 * * 7", want: time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC)},
+		{spec: "30 2 1 feb *", want: time.Date(2024, 2, 1, 2, 30, 0, 0, time.UTC)},
+		{spec: "0 0 1,15 * *", want: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)},
+		{spec: "0 0 13 * fri", want: time.Date(2024, 1, 12, 0, 0, 0, 0, time.UTC)},
+		{spec: "@hourly", want: time.Date(2024, 1, 10, 11, 0, 0, 0, time.UTC)},
+		{spec: "@daily", want: time.Date(2024, 1, 11, 0, 0, 0, 0, time.UTC)},
+		{spec: "@every 90s", want: base.Add(90 * time.Second)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			s, err := ParseSchedule(tt.spec)
+			if err != nil {
+				t.Fatalf("ParseSchedule() error = %v", err)
+			}
+			if got := s.Next(base); !got.Equal(tt.want) {
+				t.Errorf("Next() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSchedule_Invalid(t *testing.T) {
+	specs := []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"* * * foo *",
+		"@every",
+		"@every -1s",
+	}
+
+	for _, spec := range specs {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("ParseSchedule(%q) expected error", spec)
+		}
+	}
+}
+
+func TestCronSchedule_Impossible(t *testing.T) {
+	s, err := ParseSchedule("0 0 30 2 *")
+	if err != nil {
+		t.Fatalf("ParseSchedule() error = %v", err)
+	}
+	if got := s.Next(time.Now()); !got.IsZero() {
+		t.Errorf("expected zero time for impossible schedule, got %v", got)
+	}
+}
@@ -0,0 +1,245 @@
+// Package scheduler publishes messages on cron schedules using any gokyu
+// publisher, for tick events, heartbeats, and other periodic emissions.
+//
+// When the scheduler runs in several instances of a deployment, configure an
+// Elector so that only the current leader publishes, e.g. LockElector with a
+// lock from the lock package.
+//
+// # Usage
+//
+//	s := scheduler.New(publisher, &scheduler.Config{Elector: elector})
+//	s.Add("heartbeat", "@every 30s", func(t time.Time) *gokyu.Message {
+//	    return gokyu.NewMessage([]byte(t.Format(time.RFC3339)))
+//	})
+//	s.Add("nightly-report", "0 2 * * *", buildReport)
+//	err := s.Run(ctx)
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"runtime/pprof"
+	"sync"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+)
+
+// Elector decides whether this instance may publish scheduled messages.
+type Elector interface {
+	// IsLeader reports whether this instance is currently the leader.
+	IsLeader(ctx context.Context) (bool, error)
+}
+
+// LockElector returns an Elector that holds lock while this instance is the
+// leader. The lease is renewed whenever due jobs are checked, so its TTL
+// must exceed the longest interval between job activations; otherwise
+// leadership may move between instances between runs.
+func LockElector(lock gokyu.Lock) Elector {
+	return lockElector{lock: lock}
+}
+
+// lockElector elects the holder of a lock.
+type lockElector struct {
+	lock gokyu.Lock
+}
+
+func (e lockElector) IsLeader(ctx context.Context) (bool, error) {
+	return e.lock.Acquire(ctx)
+}
+
+// Config holds the configuration of a scheduler.
+type Config struct {
+	// Elector restricts publishing to the elected leader. If nil, every
+	// instance publishes.
+	Elector Elector
+
+	// Location is the time zone used to evaluate cron expressions (default: time.Local).
+	Location *time.Location
+
+	// OnError is called when a scheduled message cannot be published or
+	// leadership cannot be determined. Errors are otherwise ignored.
+	OnError func(job string, err error)
+
+	// Clock is the time source (default: gokyu.SystemClock).
+	Clock gokyu.Clock
+}
+
+// job is a scheduled emission.
+type job struct {
+	name     string
+	schedule Schedule
+	build    func(t time.Time) *gokyu.Message
+	next     time.Time
+}
+
+// Scheduler publishes messages according to job schedules.
+type Scheduler struct {
+	publisher gokyu.Publisher
+	cfg       Config
+
+	mu      sync.Mutex
+	jobs    []*job
+	running bool
+
+	// wake interrupts the run loop's wait when a job is added
+	wake chan struct{}
+}
+
+// New creates a scheduler that publishes through pub.
+func New(pub gokyu.Publisher, cfg *Config) *Scheduler {
+	s := &Scheduler{publisher: pub, wake: make(chan struct{}, 1)}
+	if cfg != nil {
+		s.cfg = *cfg
+	}
+	if s.cfg.Location == nil {
+		s.cfg.Location = time.Local
+	}
+	if s.cfg.Clock == nil {
+		s.cfg.Clock = gokyu.SystemClock
+	}
+	return s
+}
+
+// Add registers a job that publishes the message returned by build on the
+// given cron schedule (see ParseSchedule). Jobs may be added while Run is
+// running.
+func (s *Scheduler) Add(name, spec string, build func(t time.Time) *gokyu.Message) error {
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		return err
+	}
+
+	j := &job{name: name, schedule: schedule, build: build}
+	s.mu.Lock()
+	if s.running {
+		j.next = schedule.Next(s.cfg.Clock.Now().In(s.cfg.Location))
+	}
+	s.jobs = append(s.jobs, j)
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run publishes scheduled messages until the context is cancelled.
+func (s *Scheduler) Run(ctx context.Context) error {
+	unregister := gokyu.RegisterDiagnostics("scheduler", s.diagnostics)
+	defer unregister()
+
+	var err error
+	pprof.Do(ctx, pprof.Labels("gokyu", "scheduler"), func(ctx context.Context) {
+		err = s.run(ctx)
+	})
+	return err
+}
+
+// diagnostics reports the next activation time of every job.
+func (s *Scheduler) diagnostics() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next := make(map[string]interface{}, len(s.jobs))
+	for _, job := range s.jobs {
+		next[job.name] = job.next
+	}
+	return map[string]interface{}{"next": next}
+}
+
+// run is the scheduling loop.
+func (s *Scheduler) run(ctx context.Context) error {
+	now := s.cfg.Clock.Now().In(s.cfg.Location)
+
+	s.mu.Lock()
+	s.running = true
+	for _, job := range s.jobs {
+		job.next = job.schedule.Next(now)
+	}
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.running = false
+		s.mu.Unlock()
+	}()
+
+	for {
+		s.mu.Lock()
+		var wake time.Time
+		for _, job := range s.jobs {
+			if !job.next.IsZero() && (wake.IsZero() || job.next.Before(wake)) {
+				wake = job.next
+			}
+		}
+		s.mu.Unlock()
+
+		if wake.IsZero() {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-s.wake:
+			}
+			continue
+		}
+
+		timer := s.cfg.Clock.NewTimer(wake.Sub(s.cfg.Clock.Now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-s.wake:
+			// A job was added and may be due before the timer
+			timer.Stop()
+			continue
+		case <-timer.C():
+		}
+
+		s.runDue(ctx, s.cfg.Clock.Now().In(s.cfg.Location))
+	}
+}
+
+// runDue publishes all jobs whose activation time has passed and advances
+// their schedules.
+func (s *Scheduler) runDue(ctx context.Context, now time.Time) {
+	s.mu.Lock()
+	var due []*job
+	for _, job := range s.jobs {
+		if !job.next.IsZero() && !job.next.After(now) {
+			due = append(due, job)
+			job.next = job.schedule.Next(now)
+		}
+	}
+	s.mu.Unlock()
+
+	if len(due) == 0 {
+		return
+	}
+
+	if s.cfg.Elector != nil {
+		leader, err := s.cfg.Elector.IsLeader(ctx)
+		if err != nil {
+			s.reportError("", fmt.Errorf("scheduler: leader election: %w", err))
+			return
+		}
+		if !leader {
+			return
+		}
+	}
+
+	for _, job := range due {
+		msg := job.build(now)
+		if err := s.publisher.Publish(ctx, msg); err != nil {
+			s.reportError(job.name, err)
+		}
+	}
+}
+
+// reportError forwards an error to the OnError callback, if any.
+func (s *Scheduler) reportError(job string, err error) {
+	if s.cfg.OnError != nil {
+		s.cfg.OnError(job, err)
+	}
+}
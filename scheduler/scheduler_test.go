@@ -0,0 +1,187 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+	"github.com/venderneutral/gokyu/lock"
+)
+
+type recordingPublisher struct {
+	mu        sync.Mutex
+	published []*gokyu.Message
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, msg *gokyu.Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.published = append(p.published, msg)
+	return nil
+}
+
+func (p *recordingPublisher) Close(ctx context.Context) error { return nil }
+
+func (p *recordingPublisher) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.published)
+}
+
+type staticElector bool
+
+func (e staticElector) IsLeader(ctx context.Context) (bool, error) { return bool(e), nil }
+
+func TestScheduler_Run(t *testing.T) {
+	tests := []struct {
+		name    string
+		elector Elector
+		wantAny bool
+	}{
+		{name: "no elector", elector: nil, wantAny: true},
+		{name: "leader", elector: staticElector(true), wantAny: true},
+		{name: "follower", elector: staticElector(false), wantAny: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pub := &recordingPublisher{}
+			s := New(pub, &Config{Elector: tt.elector})
+			err := s.Add("tick", "@every 10ms", func(t time.Time) *gokyu.Message {
+				return gokyu.NewMessage([]byte("tick"))
+			})
+			if err != nil {
+				t.Fatalf("Add() error = %v", err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 55*time.Millisecond)
+			defer cancel()
+			if err := s.Run(ctx); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+
+			if got := pub.count() > 0; got != tt.wantAny {
+				t.Errorf("expected published=%v, got %d messages", tt.wantAny, pub.count())
+			}
+		})
+	}
+}
+
+func TestLockElector(t *testing.T) {
+	locks := lock.NewMemory(nil)
+	first := LockElector(locks.Lock("scheduler", "first", time.Minute))
+	second := LockElector(locks.Lock("scheduler", "second", time.Minute))
+	ctx := context.Background()
+
+	if leader, _ := first.IsLeader(ctx); !leader {
+		t.Error("expected first instance elected")
+	}
+	if leader, _ := second.IsLeader(ctx); leader {
+		t.Error("expected second instance not elected while the lock is held")
+	}
+}
+
+func TestScheduler_FakeClock(t *testing.T) {
+	clock := gokyu.NewFakeClock(time.Date(2024, 1, 1, 0, 30, 0, 0, time.UTC))
+	pub := &recordingPublisher{}
+	s := New(pub, &Config{Location: time.UTC, Clock: clock})
+	if err := s.Add("hourly", "0 * * * *", func(t time.Time) *gokyu.Message {
+		return gokyu.NewMessage([]byte(t.Format(time.RFC3339)))
+	}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+
+	for i := 1; i <= 3; i++ {
+		waitForTimer(t, clock)
+		clock.Advance(time.Hour)
+		for pub.count() < i {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	want := []string{"2024-01-01T01:30:00Z", "2024-01-01T02:30:00Z", "2024-01-01T03:30:00Z"}
+	for i, msg := range pub.published {
+		if string(msg.Body) != want[i] {
+			t.Errorf("message %d: expected %s, got %s", i, want[i], msg.Body)
+		}
+	}
+}
+
+func TestScheduler_AddWhileRunning(t *testing.T) {
+	clock := gokyu.NewFakeClock(time.Date(2024, 1, 1, 0, 30, 0, 0, time.UTC))
+	pub := &recordingPublisher{}
+	s := New(pub, &Config{Location: time.UTC, Clock: clock})
+
+	// Run starts with no jobs, so it waits for one to be added
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+	for {
+		s.mu.Lock()
+		running := s.running
+		s.mu.Unlock()
+		if running {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := s.Add("hourly", "0 * * * *", func(t time.Time) *gokyu.Message {
+		return gokyu.NewMessage([]byte(t.Format(time.RFC3339)))
+	}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	waitForTimer(t, clock)
+	clock.Advance(time.Hour)
+	for pub.count() < 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// A job added later that is due sooner interrupts the hourly wait
+	if err := s.Add("minutely", "* * * * *", func(t time.Time) *gokyu.Message {
+		return gokyu.NewMessage([]byte("minutely"))
+	}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	clock.Advance(time.Minute)
+	for pub.count() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if got := string(pub.published[1].Body); got != "minutely" {
+		t.Errorf("expected the minutely job to publish second, got %q", got)
+	}
+}
+
+// waitForTimer waits until the code under test is blocked on the fake clock.
+func waitForTimer(t *testing.T, clock *gokyu.FakeClock) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for clock.Timers() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for a timer")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestScheduler_AddInvalidSpec(t *testing.T) {
+	s := New(&recordingPublisher{}, nil)
+	if err := s.Add("bad", "not a cron", nil); err == nil {
+		t.Error("expected error for invalid spec")
+	}
+}
@@ -0,0 +1,180 @@
+// Package secrets provides gokyu.CredentialsProvider implementations that
+// read broker credentials from secret stores, so that they never land in the
+// configuration, environment variables or process listings:
+//   - Vault reads static (KV) or dynamic credentials from HashiCorp Vault and
+//     renews their lease.
+//   - SecretsManager reads a secret from AWS Secrets Manager and re-reads it
+//     to pick up rotations.
+//
+// Providers read the credentials on first use and keep them while Run
+// renews them in the background:
+//
+//	creds, err := secrets.NewVault(secrets.VaultConfig{
+//	    Path:      "rabbitmq/creds/billing",
+//	    TokenFile: "/vault/token", // written by Vault Agent
+//	})
+//	cfg.Credentials = creds
+//
+//	err = gokyu.RunUntilSignal(ctx, creds, consumer)
+//
+// New connections, including reconnects, use the current credentials;
+// established connections keep those they authenticated with.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+)
+
+// Defaults of the providers.
+const (
+	// DefaultRefreshInterval is how often credentials without a lease are
+	// read again.
+	DefaultRefreshInterval = 5 * time.Minute
+
+	// DefaultRetryInterval is how long Run waits after a failed renewal.
+	DefaultRetryInterval = 30 * time.Second
+)
+
+// lease is credentials read from a secret store.
+type lease struct {
+	creds gokyu.Credentials
+
+	// id, renewable and duration describe the Vault lease; a zero duration
+	// means the credentials do not expire.
+	id        string
+	renewable bool
+	duration  time.Duration
+
+	obtained time.Time
+}
+
+// expired reports whether the lease has run out at now.
+func (l *lease) expired(now time.Time) bool {
+	return l.duration > 0 && !now.Before(l.obtained.Add(l.duration))
+}
+
+// store caches the credentials of a provider and keeps them fresh.
+type store struct {
+	clock   gokyu.Clock
+	refresh time.Duration
+	retry   time.Duration
+	onError func(error)
+
+	// read reads new credentials; renew, if set, extends a renewable lease.
+	read  func(ctx context.Context) (*lease, error)
+	renew func(ctx context.Context, l *lease) (*lease, error)
+
+	mu      sync.Mutex
+	current *lease
+}
+
+// credentials returns the current credentials, reading them if there are
+// none or they have expired.
+func (s *store) credentials(ctx context.Context) (gokyu.Credentials, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.current == nil || s.current.expired(s.clock.Now()) {
+		l, err := s.read(ctx)
+		if err != nil {
+			return gokyu.Credentials{}, err
+		}
+		s.current = l
+	}
+	return s.current.creds, nil
+}
+
+// run renews the lease at two thirds of its duration, or reads the
+// credentials again every refresh interval if they have none, until ctx is
+// done. Failures are reported to onError and retried.
+func (s *store) run(ctx context.Context) error {
+	wait := s.next()
+	for {
+		timer := s.clock.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C():
+		}
+
+		wait = s.retry
+		if err := s.update(ctx); err == nil {
+			wait = s.next()
+		} else if ctx.Err() == nil && s.onError != nil {
+			s.onError(err)
+		}
+	}
+}
+
+// next returns the time until the next update.
+func (s *store) next() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.current == nil {
+		return 0
+	}
+	due := s.current.obtained.Add(s.refresh)
+	if s.current.duration > 0 {
+		due = s.current.obtained.Add(s.current.duration * 2 / 3)
+	}
+	if wait := due.Sub(s.clock.Now()); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// update renews the lease, or reads new credentials if it cannot be renewed
+// or has reached its maximum TTL.
+func (s *store) update(ctx context.Context) error {
+	s.mu.Lock()
+	current := s.current
+	s.mu.Unlock()
+
+	if current != nil && current.renewable && s.renew != nil {
+		renewed, err := s.renew(ctx, current)
+		if err == nil && renewed.duration >= current.duration {
+			s.set(renewed)
+			return nil
+		}
+	}
+	l, err := s.read(ctx)
+	if err != nil {
+		return err
+	}
+	s.set(l)
+	return nil
+}
+
+// set replaces the current lease.
+func (s *store) set(l *lease) {
+	s.mu.Lock()
+	s.current = l
+	s.mu.Unlock()
+}
+
+// secretCredentials extracts the credentials from the fields of a secret.
+func secretCredentials(fields map[string]interface{}, usernameKey, passwordKey string) (gokyu.Credentials, error) {
+	username, _ := fields[usernameKey].(string)
+	password, _ := fields[passwordKey].(string)
+	if username == "" || password == "" {
+		return gokyu.Credentials{}, fmt.Errorf("secret has no %q and %q fields", usernameKey, passwordKey)
+	}
+	return gokyu.Credentials{Username: username, Password: password}, nil
+}
+
+// decodeFields decodes a JSON object of secret fields.
+func decodeFields(data []byte) (map[string]interface{}, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("secret is not a JSON object: %w", err)
+	}
+	return fields, nil
+}
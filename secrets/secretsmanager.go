@@ -0,0 +1,191 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+	"github.com/venderneutral/gokyu/internal/awsv4"
+)
+
+// AWSCredentials are AWS credentials used to sign requests to Secrets Manager.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// SecretsManagerConfig configures an AWS Secrets Manager credentials provider.
+type SecretsManagerConfig struct {
+	// SecretID is the name or ARN of the secret, a JSON object holding the
+	// credentials.
+	SecretID string
+
+	// VersionStage is the version of the secret to read (default: AWSCURRENT).
+	VersionStage string
+
+	// Region is the AWS region of the secret (default: $AWS_REGION).
+	Region string
+
+	// Credentials sign API requests (default: $AWS_ACCESS_KEY_ID,
+	// $AWS_SECRET_ACCESS_KEY and $AWS_SESSION_TOKEN).
+	Credentials *AWSCredentials
+
+	// Endpoint overrides the API URL (default:
+	// https://secretsmanager.<region>.amazonaws.com).
+	Endpoint string
+
+	// UsernameKey and PasswordKey are the fields of the secret holding the
+	// credentials (default: "username" and "password").
+	UsernameKey string
+	PasswordKey string
+
+	// RefreshInterval is how often the secret is read again to pick up
+	// rotations (default: DefaultRefreshInterval).
+	RefreshInterval time.Duration
+
+	// RetryInterval is how long Run waits after a failed read (default:
+	// DefaultRetryInterval).
+	RetryInterval time.Duration
+
+	// OnError is called when Run fails to read the secret.
+	OnError func(error)
+
+	// HTTPClient sends API requests (default: a client with a 10s timeout).
+	HTTPClient *http.Client
+
+	// Clock is the time source for signing and refreshing (default:
+	// gokyu.SystemClock).
+	Clock gokyu.Clock
+}
+
+// WithDefaults returns a copy of the configuration with defaults applied.
+func (c SecretsManagerConfig) WithDefaults() SecretsManagerConfig {
+	if c.VersionStage == "" {
+		c.VersionStage = "AWSCURRENT"
+	}
+	if c.Region == "" {
+		c.Region = os.Getenv("AWS_REGION")
+	}
+	if c.Credentials == nil {
+		c.Credentials = &AWSCredentials{
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}
+	}
+	if c.Endpoint == "" && c.Region != "" {
+		c.Endpoint = "https://secretsmanager." + c.Region + ".amazonaws.com"
+	}
+	if c.UsernameKey == "" {
+		c.UsernameKey = "username"
+	}
+	if c.PasswordKey == "" {
+		c.PasswordKey = "password"
+	}
+	if c.RefreshInterval <= 0 {
+		c.RefreshInterval = DefaultRefreshInterval
+	}
+	if c.RetryInterval <= 0 {
+		c.RetryInterval = DefaultRetryInterval
+	}
+	if c.HTTPClient == nil {
+		c.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if c.Clock == nil {
+		c.Clock = gokyu.SystemClock
+	}
+	return c
+}
+
+// SecretsManager reads broker credentials from AWS Secrets Manager. Secrets
+// have no lease, so Run reads the secret again every RefreshInterval to
+// pick up rotations. It implements gokyu.CredentialsProvider and
+// gokyu.Runner.
+type SecretsManager struct {
+	cfg   SecretsManagerConfig
+	store store
+}
+
+// NewSecretsManager creates an AWS Secrets Manager credentials provider.
+func NewSecretsManager(cfg SecretsManagerConfig) (*SecretsManager, error) {
+	cfg = cfg.WithDefaults()
+	if cfg.SecretID == "" {
+		return nil, gokyu.ErrInvalidConfig("secrets manager secret id is required")
+	}
+	if cfg.Region == "" {
+		return nil, gokyu.ErrInvalidConfig("secrets manager region is required")
+	}
+	m := &SecretsManager{cfg: cfg}
+	m.store = store{
+		clock:   cfg.Clock,
+		refresh: cfg.RefreshInterval,
+		retry:   cfg.RetryInterval,
+		onError: cfg.OnError,
+		read:    m.read,
+	}
+	return m, nil
+}
+
+// Credentials returns the current credentials, reading the secret on first
+// use.
+func (m *SecretsManager) Credentials(ctx context.Context) (gokyu.Credentials, error) {
+	return m.store.credentials(ctx)
+}
+
+// Run reads the secret every RefreshInterval until ctx is done.
+func (m *SecretsManager) Run(ctx context.Context) error {
+	return m.store.run(ctx)
+}
+
+// read calls GetSecretValue and extracts the credentials.
+func (m *SecretsManager) read(ctx context.Context) (*lease, error) {
+	now := m.cfg.Clock.Now()
+	body, _ := json.Marshal(map[string]string{
+		"SecretId":     m.cfg.SecretID,
+		"VersionStage": m.cfg.VersionStage,
+	})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(m.cfg.Endpoint, "/")+"/", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	awsv4.Sign(req, body, awsv4.Credentials(*m.cfg.Credentials), m.cfg.Region, "secretsmanager", now)
+
+	resp, err := m.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("secrets: get secret value: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("secrets: get secret value: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("secrets: get secret value: %s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	var secret struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.Unmarshal(data, &secret); err != nil {
+		return nil, fmt.Errorf("secrets: get secret value: %w", err)
+	}
+	fields, err := decodeFields([]byte(secret.SecretString))
+	if err != nil {
+		return nil, fmt.Errorf("secrets: secret %s: %w", m.cfg.SecretID, err)
+	}
+	creds, err := secretCredentials(fields, m.cfg.UsernameKey, m.cfg.PasswordKey)
+	if err != nil {
+		return nil, fmt.Errorf("secrets: secret %s: %w", m.cfg.SecretID, err)
+	}
+	return &lease{creds: creds, obtained: now}, nil
+}
@@ -0,0 +1,68 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+)
+
+func TestSecretsManager(t *testing.T) {
+	var version atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" ||
+			!strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") {
+			http.Error(w, "unsigned", http.StatusForbidden)
+			return
+		}
+		var req struct{ SecretId string }
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.SecretId != "mq/billing" {
+			http.Error(w, `{"__type":"ResourceNotFoundException"}`, http.StatusBadRequest)
+			return
+		}
+		secret := `{"username":"billing","password":"pw-` + string(rune('0'+version.Add(1))) + `"}`
+		json.NewEncoder(w).Encode(map[string]string{"SecretString": secret})
+	}))
+	defer srv.Close()
+
+	clock := gokyu.NewFakeClock(time.Unix(1000, 0))
+	m, err := NewSecretsManager(SecretsManagerConfig{
+		SecretID:    "mq/billing",
+		Region:      "eu-west-1",
+		Endpoint:    srv.URL,
+		Credentials: &AWSCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret"},
+		Clock:       clock,
+	})
+	if err != nil {
+		t.Fatalf("NewSecretsManager() error = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	creds, err := m.Credentials(ctx)
+	if err != nil || creds != (gokyu.Credentials{Username: "billing", Password: "pw-1"}) {
+		t.Fatalf("Credentials() = %+v, %v", creds, err)
+	}
+
+	// A rotated secret is picked up after the refresh interval
+	go m.Run(ctx)
+	advance(t, clock, DefaultRefreshInterval)
+	waitFor(t, func() bool { creds, _ := m.Credentials(ctx); return creds.Password == "pw-2" })
+
+	m, _ = NewSecretsManager(SecretsManagerConfig{
+		SecretID:    "mq/other",
+		Region:      "eu-west-1",
+		Endpoint:    srv.URL,
+		Credentials: &AWSCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret"},
+	})
+	if _, err := m.Credentials(ctx); err == nil || !strings.Contains(err.Error(), "ResourceNotFoundException") {
+		t.Errorf("Credentials() error = %v", err)
+	}
+}
@@ -0,0 +1,237 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+)
+
+// VaultConfig configures a Vault credentials provider.
+type VaultConfig struct {
+	// Address is the Vault server URL (default: $VAULT_ADDR).
+	Address string
+
+	// Path is the secret to read, e.g. "rabbitmq/creds/billing" for dynamic
+	// credentials or "secret/data/billing" for a KV version 2 secret.
+	Path string
+
+	// Token authenticates to Vault. If empty, it is read from TokenFile on
+	// every request, so that tokens renewed by Vault Agent are picked up, or
+	// else from $VAULT_TOKEN.
+	Token     string
+	TokenFile string
+
+	// Namespace is the Vault Enterprise namespace, if any.
+	Namespace string
+
+	// UsernameKey and PasswordKey are the fields of the secret holding the
+	// credentials (default: "username" and "password").
+	UsernameKey string
+	PasswordKey string
+
+	// RefreshInterval is how often credentials without a lease, such as KV
+	// secrets, are read again (default: DefaultRefreshInterval).
+	RefreshInterval time.Duration
+
+	// RetryInterval is how long Run waits after a failed renewal (default:
+	// DefaultRetryInterval).
+	RetryInterval time.Duration
+
+	// OnError is called when Run fails to renew the credentials.
+	OnError func(error)
+
+	// HTTPClient sends requests to Vault (default: a client with a 10s timeout).
+	HTTPClient *http.Client
+
+	// Clock is the time source for leases (default: gokyu.SystemClock).
+	Clock gokyu.Clock
+}
+
+// WithDefaults returns a copy of the configuration with defaults applied.
+func (c VaultConfig) WithDefaults() VaultConfig {
+	if c.Address == "" {
+		c.Address = os.Getenv("VAULT_ADDR")
+	}
+	if c.UsernameKey == "" {
+		c.UsernameKey = "username"
+	}
+	if c.PasswordKey == "" {
+		c.PasswordKey = "password"
+	}
+	if c.RefreshInterval <= 0 {
+		c.RefreshInterval = DefaultRefreshInterval
+	}
+	if c.RetryInterval <= 0 {
+		c.RetryInterval = DefaultRetryInterval
+	}
+	if c.HTTPClient == nil {
+		c.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if c.Clock == nil {
+		c.Clock = gokyu.SystemClock
+	}
+	return c
+}
+
+// Vault reads broker credentials from HashiCorp Vault. Dynamic credentials,
+// e.g. from the RabbitMQ secrets engine, are renewed by Run at two thirds of
+// their lease, and read again once the lease reaches its maximum TTL. It
+// implements gokyu.CredentialsProvider and gokyu.Runner.
+type Vault struct {
+	cfg   VaultConfig
+	store store
+}
+
+// vaultSecret is the part of a Vault secret or lease response used.
+type vaultSecret struct {
+	LeaseID       string                 `json:"lease_id"`
+	LeaseDuration int64                  `json:"lease_duration"`
+	Renewable     bool                   `json:"renewable"`
+	Data          map[string]interface{} `json:"data"`
+	Errors        []string               `json:"errors"`
+}
+
+// NewVault creates a Vault credentials provider.
+func NewVault(cfg VaultConfig) (*Vault, error) {
+	cfg = cfg.WithDefaults()
+	if cfg.Address == "" {
+		return nil, gokyu.ErrInvalidConfig("vault address is required")
+	}
+	if cfg.Path == "" {
+		return nil, gokyu.ErrInvalidConfig("vault secret path is required")
+	}
+	v := &Vault{cfg: cfg}
+	v.store = store{
+		clock:   cfg.Clock,
+		refresh: cfg.RefreshInterval,
+		retry:   cfg.RetryInterval,
+		onError: cfg.OnError,
+		read:    v.read,
+		renew:   v.renew,
+	}
+	return v, nil
+}
+
+// Credentials returns the current credentials, reading them from Vault on
+// first use or once their lease has expired.
+func (v *Vault) Credentials(ctx context.Context) (gokyu.Credentials, error) {
+	return v.store.credentials(ctx)
+}
+
+// Run renews the credentials until ctx is done.
+func (v *Vault) Run(ctx context.Context) error {
+	return v.store.run(ctx)
+}
+
+// read reads the secret.
+func (v *Vault) read(ctx context.Context) (*lease, error) {
+	now := v.cfg.Clock.Now()
+	secret, err := v.do(ctx, http.MethodGet, strings.TrimPrefix(v.cfg.Path, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := secret.Data
+	if nested, ok := fields["data"].(map[string]interface{}); ok {
+		fields = nested // KV version 2
+	}
+	creds, err := secretCredentials(fields, v.cfg.UsernameKey, v.cfg.PasswordKey)
+	if err != nil {
+		return nil, fmt.Errorf("secrets: vault %s: %w", v.cfg.Path, err)
+	}
+	return &lease{
+		creds:     creds,
+		id:        secret.LeaseID,
+		renewable: secret.Renewable && secret.LeaseID != "",
+		duration:  time.Duration(secret.LeaseDuration) * time.Second,
+		obtained:  now,
+	}, nil
+}
+
+// renew extends the lease of l by its duration.
+func (v *Vault) renew(ctx context.Context, l *lease) (*lease, error) {
+	now := v.cfg.Clock.Now()
+	body, _ := json.Marshal(map[string]interface{}{
+		"lease_id":  l.id,
+		"increment": int64(l.duration / time.Second),
+	})
+	secret, err := v.do(ctx, http.MethodPut, "sys/leases/renew", body)
+	if err != nil {
+		return nil, err
+	}
+	return &lease{
+		creds:     l.creds,
+		id:        l.id,
+		renewable: secret.Renewable,
+		duration:  time.Duration(secret.LeaseDuration) * time.Second,
+		obtained:  now,
+	}, nil
+}
+
+// do sends a request to the Vault API.
+func (v *Vault) do(ctx context.Context, method, path string, body []byte) (*vaultSecret, error) {
+	token, err := v.token()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(v.cfg.Address, "/")+"/v1/"+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if v.cfg.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.cfg.Namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := v.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("secrets: vault %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("secrets: vault %s: %w", path, err)
+	}
+
+	var secret vaultSecret
+	jsonErr := json.Unmarshal(data, &secret)
+	if resp.StatusCode != http.StatusOK {
+		if len(secret.Errors) > 0 {
+			return nil, fmt.Errorf("secrets: vault %s: %s: %s", path, resp.Status, strings.Join(secret.Errors, "; "))
+		}
+		return nil, fmt.Errorf("secrets: vault %s: %s", path, resp.Status)
+	}
+	if jsonErr != nil {
+		return nil, fmt.Errorf("secrets: vault %s: %w", path, jsonErr)
+	}
+	return &secret, nil
+}
+
+// token returns the Vault token.
+func (v *Vault) token() (string, error) {
+	if v.cfg.Token != "" {
+		return v.cfg.Token, nil
+	}
+	if v.cfg.TokenFile != "" {
+		data, err := os.ReadFile(v.cfg.TokenFile)
+		if err != nil {
+			return "", fmt.Errorf("secrets: vault token: %w", err)
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		return token, nil
+	}
+	return "", gokyu.ErrInvalidConfig("vault token is required")
+}
@@ -0,0 +1,161 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+)
+
+// fakeVault serves dynamic credentials whose lease can be renewed up to
+// maxRenewals times.
+type fakeVault struct {
+	mu          sync.Mutex
+	reads       int
+	renewals    int
+	maxRenewals int
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Header.Get("X-Vault-Token") != "s.token" {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`{"errors":["permission denied"]}`))
+		return
+	}
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/rabbitmq/creds/billing":
+		f.reads++
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"lease_id":       "rabbitmq/creds/billing/1",
+			"lease_duration": 60,
+			"renewable":      true,
+			"data":           map[string]string{"username": "user-" + string(rune('0'+f.reads)), "password": "pw"},
+		})
+	case r.Method == http.MethodPut && r.URL.Path == "/v1/sys/leases/renew":
+		f.renewals++
+		duration := 60
+		if f.renewals > f.maxRenewals {
+			duration = 10 // capped by the maximum TTL
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"lease_id":       "rabbitmq/creds/billing/1",
+			"lease_duration": duration,
+			"renewable":      true,
+		})
+	case r.URL.Path == "/v1/secret/data/billing":
+		w.Write([]byte(`{"data":{"data":{"user":"kv-user","pass":"kv-pw"},"metadata":{"version":3}}}`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeVault) counts() (int, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.reads, f.renewals
+}
+
+// advance waits for the provider to wait for its next update, then moves
+// the clock past it.
+func advance(t *testing.T, clock *gokyu.FakeClock, d time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for clock.Timers() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the provider to wait")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(d)
+}
+
+// waitFor polls cond until it holds.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestVault_Renewal(t *testing.T) {
+	fake := &fakeVault{maxRenewals: 1}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	clock := gokyu.NewFakeClock(time.Unix(1000, 0))
+	v, err := NewVault(VaultConfig{Address: srv.URL, Path: "rabbitmq/creds/billing", Token: "s.token", Clock: clock})
+	if err != nil {
+		t.Fatalf("NewVault() error = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	creds, err := v.Credentials(ctx)
+	if err != nil || creds != (gokyu.Credentials{Username: "user-1", Password: "pw"}) {
+		t.Fatalf("Credentials() = %+v, %v", creds, err)
+	}
+
+	done := make(chan error)
+	go func() { done <- v.Run(ctx) }()
+
+	// Renewed at two thirds of the lease
+	advance(t, clock, 40*time.Second)
+	waitFor(t, func() bool { _, renewals := fake.counts(); return renewals == 1 })
+	if creds, _ := v.Credentials(ctx); creds.Username != "user-1" {
+		t.Errorf("Credentials() after renewal = %+v", creds)
+	}
+
+	// Read again once renewals no longer extend the lease
+	advance(t, clock, 40*time.Second)
+	waitFor(t, func() bool { reads, _ := fake.counts(); return reads == 2 })
+	waitFor(t, func() bool { creds, _ := v.Credentials(ctx); return creds.Username == "user-2" })
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("Run() error = %v", err)
+	}
+}
+
+func TestVault_KV(t *testing.T) {
+	srv := httptest.NewServer(&fakeVault{})
+	defer srv.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(tokenFile, []byte("s.token\n"), 0o600)
+	v, _ := NewVault(VaultConfig{
+		Address:     srv.URL,
+		Path:        "secret/data/billing",
+		TokenFile:   tokenFile,
+		UsernameKey: "user",
+		PasswordKey: "pass",
+	})
+	creds, err := v.Credentials(context.Background())
+	if err != nil || creds != (gokyu.Credentials{Username: "kv-user", Password: "kv-pw"}) {
+		t.Errorf("Credentials() = %+v, %v", creds, err)
+	}
+
+	v, _ = NewVault(VaultConfig{Address: srv.URL, Path: "secret/data/billing", Token: "wrong"})
+	if _, err := v.Credentials(context.Background()); err == nil {
+		t.Error("expected an error for a rejected token")
+	}
+
+	var cfgErr *gokyu.ConfigError
+	if _, err := NewVault(VaultConfig{Address: srv.URL}); !errors.As(err, &cfgErr) {
+		t.Errorf("NewVault() without path error = %v", err)
+	}
+}
@@ -0,0 +1,275 @@
+package gokyu
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ShardHash maps a partition key to a shard number in [0, shards).
+type ShardHash func(key string, shards int) int
+
+// JumpHash is the jump consistent hash of Lamping and Veach over the FNV-1a
+// hash of the key. When the number of shards grows from n to n+1, only 1/(n+1)
+// of the keys move, all of them to the new shard.
+func JumpHash(key string, shards int) int {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	k := h.Sum64()
+
+	b, j := int64(-1), int64(0)
+	for j < int64(shards) {
+		b = j
+		k = k*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((k>>33)+1)))
+	}
+	return int(b)
+}
+
+// ModuloHash is the FNV-1a hash of the key modulo the number of shards, as
+// used by TenantShards. Resharding moves most keys.
+func ModuloHash(key string, shards int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(shards))
+}
+
+// ShardOptions configures a ShardedPublisher.
+type ShardOptions struct {
+	// Format is the destination name with a verb for the shard number,
+	// e.g. "orders-%d".
+	Format string
+
+	// Shards is the number of destinations.
+	Shards int
+
+	// Hash maps partition keys to shards (default: JumpHash).
+	Hash ShardHash
+
+	// Topics publishes to topics instead of queues.
+	Topics bool
+
+	// Fence stamps keyed messages with fence tokens (PropertyShardKey,
+	// PropertyShard and PropertyShardEpoch) for a ShardVerifier.
+	Fence bool
+
+	// Epoch is the initial fence epoch, incremented by every Reshard.
+	// Publishers of the same destinations should start from, and reshard
+	// to, the same epoch.
+	Epoch int64
+}
+
+// ShardedPublisher spreads messages over several queues or topics by their
+// PartitionKey, for throughput beyond the limit of a single broker entity:
+//
+//	orders, err := gokyu.NewShardedPublisher(client, gokyu.ShardOptions{
+//	    Format: "orders-%d",
+//	    Shards: 8,
+//	})
+//	defer orders.Close(ctx)
+//
+//	msg.PartitionKey = customerID // orders-0 .. orders-7
+//	err = orders.Publish(ctx, msg)
+//
+// Messages with the same partition key go to the same shard and keep their
+// order; messages without one are spread round-robin. Consumers subscribe to
+// every destination returned by Destinations.
+type ShardedPublisher struct {
+	client *Client
+	opts   ShardOptions
+	next   atomic.Uint64
+
+	mu         sync.Mutex
+	shards     int
+	epoch      int64
+	publishers map[string]Publisher
+	relay      RelayPublisher
+}
+
+// NewShardedPublisher creates a sharded publisher that publishes through
+// publishers created from the client's configuration with the destination
+// replaced by the shard, or through one relay publisher if
+// Config.AnonymousRelay is set.
+func NewShardedPublisher(client *Client, opts ShardOptions) (*ShardedPublisher, error) {
+	if opts.Shards < 1 {
+		return nil, ErrInvalidConfig("shards must be at least 1")
+	}
+	if !strings.Contains(opts.Format, "%") {
+		return nil, ErrInvalidConfig("shard format must contain a verb for the shard number")
+	}
+	if opts.Hash == nil {
+		opts.Hash = JumpHash
+	}
+	return &ShardedPublisher{
+		client:     client,
+		opts:       opts,
+		shards:     opts.Shards,
+		epoch:      opts.Epoch,
+		publishers: make(map[string]Publisher),
+	}, nil
+}
+
+// Destination returns the destination of a partition key.
+func (p *ShardedPublisher) Destination(key string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.destination(key)
+}
+
+// destination returns the destination of a partition key, or the next
+// destination round-robin for an empty key. The caller holds p.mu.
+func (p *ShardedPublisher) destination(key string) string {
+	return fmt.Sprintf(p.opts.Format, p.shard(key))
+}
+
+// shard returns the shard number of a partition key, or the next shard
+// round-robin for an empty key. The caller holds p.mu.
+func (p *ShardedPublisher) shard(key string) int {
+	if key == "" {
+		return int(p.next.Add(1) % uint64(p.shards))
+	}
+	return p.opts.Hash(key, p.shards)
+}
+
+// Epoch returns the current fence epoch (see ShardOptions.Fence).
+func (p *ShardedPublisher) Epoch() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.epoch
+}
+
+// Destinations returns the names of all current shards.
+func (p *ShardedPublisher) Destinations() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	names := make([]string, p.shards)
+	for i := range names {
+		names[i] = fmt.Sprintf(p.opts.Format, i)
+	}
+	return names
+}
+
+// Publish publishes msg to the shard of its partition key, with fence tokens
+// if ShardOptions.Fence is set and msg has a partition key.
+func (p *ShardedPublisher) Publish(ctx context.Context, msg *Message) error {
+	pub, err := p.publisher(ctx, msg)
+	if err != nil {
+		return err
+	}
+	return pub.Publish(ctx, msg)
+}
+
+// Reshard changes the number of shards. Keys that move to another shard
+// may be consumed out of order while the old shard drains, so consumers of
+// new shards should be running before growing, and removed shards should be
+// drained after shrinking. Publishers of removed shards are closed, and the
+// fence epoch is incremented; a ShardVerifier on the consumers reports keys
+// consumed out of order across the move.
+func (p *ShardedPublisher) Reshard(ctx context.Context, shards int) error {
+	if shards < 1 {
+		return ErrInvalidConfig("shards must be at least 1")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.shards = shards
+	p.epoch++
+	current := make(map[string]bool, shards)
+	for i := 0; i < shards; i++ {
+		current[fmt.Sprintf(p.opts.Format, i)] = true
+	}
+
+	var firstErr error
+	for dest, pub := range p.publishers {
+		if current[dest] {
+			continue
+		}
+		if err := pub.Close(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(p.publishers, dest)
+	}
+	return firstErr
+}
+
+// Close closes all publishers created by the sharded publisher.
+func (p *ShardedPublisher) Close(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var firstErr error
+	for dest, pub := range p.publishers {
+		if err := pub.Close(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(p.publishers, dest)
+	}
+	if p.relay != nil {
+		if err := p.relay.Close(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		p.relay = nil
+	}
+	return firstErr
+}
+
+// publisher returns the cached publisher for the shard of msg's partition
+// key, creating it on first use, and stamps msg with its fence tokens.
+func (p *ShardedPublisher) publisher(ctx context.Context, msg *Message) (Publisher, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	shard := p.shard(msg.PartitionKey)
+	if p.opts.Fence && msg.PartitionKey != "" {
+		if msg.Properties == nil {
+			msg.Properties = make(map[string]interface{})
+		}
+		msg.Properties[PropertyShardKey] = msg.PartitionKey
+		msg.Properties[PropertyShard] = int64(shard)
+		msg.Properties[PropertyShardEpoch] = p.epoch
+	}
+
+	dest := fmt.Sprintf(p.opts.Format, shard)
+	if pub, ok := p.publishers[dest]; ok {
+		return pub, nil
+	}
+
+	if p.client.config.AnonymousRelay {
+		if p.relay == nil {
+			relay, err := p.client.NewRelayPublisher(ctx)
+			if err != nil {
+				return nil, err
+			}
+			p.relay = relay
+		}
+		pub := &relayDestination{relay: p.relay, destination: dest}
+		p.publishers[dest] = pub
+		return pub, nil
+	}
+
+	cfg := p.client.Config()
+	if p.opts.Topics {
+		cfg.Topic = dest
+		cfg.Queue = ""
+	} else {
+		cfg.Queue = dest
+		cfg.Topic = ""
+	}
+	cfg.Subscription = ""
+	cfg.Metrics = p.client.limited
+
+	client, err := NewClient(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := client.NewPublisher(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.publishers[dest] = pub
+	return pub, nil
+}
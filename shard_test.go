@@ -0,0 +1,113 @@
+package gokyu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestJumpHash_Resharding(t *testing.T) {
+	const keys = 10000
+	moved := 0
+	for i := 0; i < keys; i++ {
+		key := fmt.Sprintf("customer-%d", i)
+		before, after := JumpHash(key, 8), JumpHash(key, 9)
+		if before < 0 || before >= 8 {
+			t.Fatalf("JumpHash(%q, 8) = %d", key, before)
+		}
+		if before != after {
+			if after != 8 {
+				t.Fatalf("key %q moved from shard %d to %d, want the new shard", key, before, after)
+			}
+			moved++
+		}
+	}
+	// About 1/9 of the keys move to the new shard
+	if moved < keys/12 || moved > keys/7 {
+		t.Errorf("moved %d of %d keys, want about %d", moved, keys, keys/9)
+	}
+}
+
+func TestShardedPublisher_Publish(t *testing.T) {
+	factory := &queueFactory{published: make(map[string][]*Message)}
+	orders, err := NewShardedPublisher(newTenantTestClient(t, factory), ShardOptions{Format: "orders-%d", Shards: 4})
+	if err != nil {
+		t.Fatalf("NewShardedPublisher() error = %v", err)
+	}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		msg := NewMessage([]byte("keyed"))
+		msg.PartitionKey = "acme"
+		if err := orders.Publish(ctx, msg); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+	dest := orders.Destination("acme")
+	if n := len(factory.published[dest]); n != 3 {
+		t.Errorf("expected 3 messages on %s, got %d", dest, n)
+	}
+
+	// Messages without a partition key are spread round-robin
+	for i := 0; i < 4; i++ {
+		orders.Publish(ctx, NewMessage([]byte("unkeyed")))
+	}
+	for _, dest := range orders.Destinations() {
+		unkeyed := 0
+		for _, msg := range factory.published[dest] {
+			if string(msg.Body) == "unkeyed" {
+				unkeyed++
+			}
+		}
+		if unkeyed != 1 {
+			t.Errorf("expected 1 unkeyed message on %s, got %d", dest, unkeyed)
+		}
+	}
+
+	if err := orders.Close(ctx); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	if len(factory.closed) != 4 {
+		t.Errorf("expected 4 publishers closed, got %v", factory.closed)
+	}
+}
+
+func TestShardedPublisher_Reshard(t *testing.T) {
+	factory := &queueFactory{published: make(map[string][]*Message)}
+	orders, _ := NewShardedPublisher(newTenantTestClient(t, factory), ShardOptions{Format: "orders-%d", Shards: 2, Hash: ModuloHash})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		orders.Publish(ctx, NewMessage(nil))
+	}
+	if err := orders.Reshard(ctx, 1); err != nil {
+		t.Fatalf("Reshard() error = %v", err)
+	}
+	if len(factory.closed) != 1 || factory.closed[0] != "orders-1" {
+		t.Errorf("expected orders-1 closed, got %v", factory.closed)
+	}
+	if got := orders.Destinations(); len(got) != 1 || got[0] != "orders-0" {
+		t.Errorf("Destinations() = %v", got)
+	}
+	if got := orders.Destination("anything"); got != "orders-0" {
+		t.Errorf("Destination() = %q after resharding to one shard", got)
+	}
+
+	var cfgErr *ConfigError
+	if err := orders.Reshard(ctx, 0); !errors.As(err, &cfgErr) {
+		t.Errorf("Reshard(0) error = %v", err)
+	}
+}
+
+func TestNewShardedPublisher_Invalid(t *testing.T) {
+	client := newTenantTestClient(t, &queueFactory{})
+	for _, opts := range []ShardOptions{
+		{Format: "orders-%d"},
+		{Format: "orders", Shards: 2},
+	} {
+		if _, err := NewShardedPublisher(client, opts); err == nil {
+			t.Errorf("NewShardedPublisher(%+v) succeeded", opts)
+		}
+	}
+}
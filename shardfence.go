@@ -0,0 +1,144 @@
+package gokyu
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Fence token properties set by a ShardedPublisher with ShardOptions.Fence.
+const (
+	// PropertyShardKey is the partition key of the message.
+	PropertyShardKey = "gokyu-shard-key"
+
+	// PropertyShard is the shard number the message was published to.
+	PropertyShard = "gokyu-shard"
+
+	// PropertyShardEpoch is the fence epoch of the sharding the message was
+	// published under, incremented by every Reshard.
+	PropertyShardEpoch = "gokyu-shard-epoch"
+)
+
+// ShardViolation is a key found active on two shards: a message consumed
+// from one shard after a message of the same or a later epoch was consumed
+// from another, so the key's messages may have been handled out of order.
+type ShardViolation struct {
+	// Key is the partition key.
+	Key string
+
+	// Shard and Epoch are the fence tokens of the offending message.
+	Shard int64
+	Epoch int64
+
+	// LatestShard and LatestEpoch are those of the latest message of the
+	// key consumed before it.
+	LatestShard int64
+	LatestEpoch int64
+
+	// Message is the offending message.
+	Message *Message
+}
+
+func (v ShardViolation) String() string {
+	return fmt.Sprintf("key %q consumed from shard %d (epoch %d) after shard %d (epoch %d)",
+		v.Key, v.Shard, v.Epoch, v.LatestShard, v.LatestEpoch)
+}
+
+// ShardVerifier checks the fence tokens of messages consumed from the shards
+// of a ShardedPublisher with ShardOptions.Fence set, to verify that no key
+// was active on two shards at once while resharding. Pass it the messages
+// of all shards, in the order they are handled:
+//
+//	verifier := gokyu.NewShardVerifier()
+//	handler = verifier.Handler(handler)
+//	...
+//	for _, v := range verifier.Violations() {
+//	    log.Printf("ordering violation: %v", v)
+//	}
+//
+// It remembers the latest shard and epoch of every key it has seen.
+type ShardVerifier struct {
+	mu         sync.Mutex
+	keys       map[string]shardFence
+	violations []ShardViolation
+}
+
+// shardFence is the fence tokens of a message.
+type shardFence struct {
+	shard, epoch int64
+}
+
+// NewShardVerifier creates a shard verifier.
+func NewShardVerifier() *ShardVerifier {
+	return &ShardVerifier{keys: make(map[string]shardFence)}
+}
+
+// Observe records the fence tokens of msg and returns the violation it
+// causes, if any. Messages without fence tokens are ignored.
+func (v *ShardVerifier) Observe(msg *Message) *ShardViolation {
+	key, ok := msg.Properties[PropertyShardKey].(string)
+	if !ok {
+		return nil
+	}
+	shard, ok := fenceToken(msg.Properties[PropertyShard])
+	if !ok {
+		return nil
+	}
+	epoch, ok := fenceToken(msg.Properties[PropertyShardEpoch])
+	if !ok {
+		return nil
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	latest, seen := v.keys[key]
+	if !seen || epoch > latest.epoch {
+		v.keys[key] = shardFence{shard: shard, epoch: epoch}
+		return nil
+	}
+	if shard == latest.shard {
+		return nil
+	}
+	violation := ShardViolation{
+		Key:         key,
+		Shard:       shard,
+		Epoch:       epoch,
+		LatestShard: latest.shard,
+		LatestEpoch: latest.epoch,
+		Message:     msg,
+	}
+	v.violations = append(v.violations, violation)
+	return &violation
+}
+
+// Violations returns the violations observed so far.
+func (v *ShardVerifier) Violations() []ShardViolation {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return append([]ShardViolation(nil), v.violations...)
+}
+
+// Handler returns a handler that observes every message before passing it
+// to next. Violations do not fail the message.
+func (v *ShardVerifier) Handler(next Handler) Handler {
+	return func(ctx context.Context, msg *Message) error {
+		v.Observe(msg)
+		return next(ctx, msg)
+	}
+}
+
+// fenceToken converts a fence token property to int64.
+func fenceToken(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case int32:
+		return int64(n), true
+	case int:
+		return int64(n), true
+	case float64: // decoded from JSON by file-based providers
+		return int64(n), true
+	}
+	return 0, false
+}
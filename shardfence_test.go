@@ -0,0 +1,72 @@
+package gokyu
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestShardVerifier(t *testing.T) {
+	factory := &queueFactory{published: make(map[string][]*Message)}
+	orders, _ := NewShardedPublisher(newTenantTestClient(t, factory), ShardOptions{
+		Format: "orders-%d",
+		Shards: 2,
+		Hash:   ModuloHash,
+		Fence:  true,
+	})
+	ctx := context.Background()
+
+	// A key that moves when growing to three shards
+	key := ""
+	for i := 0; key == ""; i++ {
+		if k := fmt.Sprintf("customer-%d", i); ModuloHash(k, 2) != ModuloHash(k, 3) {
+			key = k
+		}
+	}
+
+	before := NewMessage([]byte("before"))
+	before.PartitionKey = key
+	orders.Publish(ctx, before)
+	if err := orders.Reshard(ctx, 3); err != nil {
+		t.Fatalf("Reshard() error = %v", err)
+	}
+	after := NewMessage([]byte("after"))
+	after.PartitionKey = key
+	orders.Publish(ctx, after)
+
+	if orders.Epoch() != 1 || before.Properties[PropertyShardEpoch] != int64(0) || after.Properties[PropertyShardEpoch] != int64(1) {
+		t.Fatalf("epochs = %v, %v", before.Properties, after.Properties)
+	}
+	if before.Properties[PropertyShardKey] != key || after.Properties[PropertyShard] != int64(ModuloHash(key, 3)) {
+		t.Errorf("fence tokens = %v", after.Properties)
+	}
+	unkeyed := NewMessage(nil)
+	orders.Publish(ctx, unkeyed)
+	if _, ok := unkeyed.Properties[PropertyShardEpoch]; ok {
+		t.Errorf("unkeyed message fenced: %v", unkeyed.Properties)
+	}
+
+	inOrder := NewShardVerifier()
+	for _, msg := range []*Message{before, after, after, unkeyed} {
+		if v := inOrder.Observe(msg); v != nil {
+			t.Errorf("unexpected violation: %v", v)
+		}
+	}
+
+	// The new shard was consumed before the old one drained
+	var handled int
+	outOfOrder := NewShardVerifier()
+	handler := outOfOrder.Handler(func(ctx context.Context, msg *Message) error {
+		handled++
+		return nil
+	})
+	handler(ctx, after)
+	handler(ctx, before)
+	violations := outOfOrder.Violations()
+	if handled != 2 || len(violations) != 1 {
+		t.Fatalf("handled %d, violations = %v", handled, violations)
+	}
+	if v := violations[0]; v.Key != key || v.Message != before || v.Epoch != 0 || v.LatestEpoch != 1 {
+		t.Errorf("violation = %v", v)
+	}
+}
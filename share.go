@@ -0,0 +1,254 @@
+package gokyu
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// connectionKey identifies the configurations whose publishers connect to
+// the same entity the same way, as the same identity, with the same
+// connection tuning and message encoding. Credentials providers, endpoint
+// resolvers and dialers are compared by identity.
+type connectionKey struct {
+	provider         Provider
+	connectionString string
+	host             string
+	port             int
+	username         string
+	password         string
+	credentials      CredentialsProvider
+	endpoints        EndpointResolver
+	dialer           *Dialer
+	useTLS           bool
+	tlsServerName    string
+	tlsSkipVerify    bool
+	webSocket        bool
+	maxFrameSize     uint32
+	idleTimeout      time.Duration
+	channelMax       uint16
+	writeTimeout     time.Duration
+	connProperties   string
+	connHostname     string
+	jmsInterop       bool
+	queueType        string
+	maxPriority      uint8
+	queue            string
+	topic            string
+	addressTemplate  string
+	priorityLevels   int
+}
+
+// newConnectionKey returns the connection key of cfg. It returns false if
+// cfg.Credentials or cfg.Endpoints cannot be compared, e.g. a func type, in
+// which case the publishers of cfg are neither shared nor tracked.
+func newConnectionKey(cfg *Config) (connectionKey, bool) {
+	if !hashable(cfg.Credentials) || !hashable(cfg.Endpoints) {
+		return connectionKey{}, false
+	}
+	return connectionKey{
+		provider:         cfg.Provider,
+		connectionString: cfg.ConnectionString,
+		host:             cfg.Host,
+		port:             cfg.Port,
+		username:         cfg.Username,
+		password:         cfg.Password,
+		credentials:      cfg.Credentials,
+		endpoints:        cfg.Endpoints,
+		dialer:           cfg.Dialer,
+		useTLS:           cfg.UseTLS,
+		tlsServerName:    cfg.TLSServerName,
+		tlsSkipVerify:    cfg.TLSInsecureSkipVerify,
+		webSocket:        cfg.WebSocket,
+		maxFrameSize:     cfg.MaxFrameSize,
+		idleTimeout:      cfg.IdleTimeout,
+		channelMax:       cfg.ChannelMax,
+		writeTimeout:     cfg.WriteTimeout,
+		connProperties:   canonicalProperties(cfg.ConnectionProperties),
+		connHostname:     cfg.ConnectionHostname,
+		jmsInterop:       cfg.JMSInterop,
+		queueType:        cfg.QueueType,
+		maxPriority:      cfg.MaxPriority,
+		queue:            cfg.Queue,
+		topic:            cfg.Topic,
+		addressTemplate:  cfg.PublishAddressTemplate,
+		priorityLevels:   cfg.PriorityLevels,
+	}, true
+}
+
+// canonicalProperties encodes connection properties in key order, so that
+// equal maps have equal encodings.
+func canonicalProperties(props map[string]string) string {
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(strconv.Quote(k))
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(props[k]))
+		b.WriteByte(',')
+	}
+	return b.String()
+}
+
+// hashable reports whether v can be used in a map key.
+func hashable(v interface{}) bool {
+	return v == nil || reflect.TypeOf(v).Comparable()
+}
+
+// openPublishers tracks the publishers created by clients, by connection
+// key, to detect duplicates and to share them if Config.ShareConnections is
+// set.
+var openPublishers = struct {
+	sync.Mutex
+	entries map[connectionKey]*openPublisher
+}{entries: make(map[connectionKey]*openPublisher)}
+
+// openPublisher is the state of one connection key.
+type openPublisher struct {
+	open   int       // open publishers, or handles of the shared publisher
+	shared Publisher // set if the publisher is shared
+	warned bool
+}
+
+// trackPublisher registers a publisher of client created with open, so that
+// a second publisher for the same configuration is logged as a duplicate.
+// With Config.ShareConnections, the publisher is created once and shared
+// until all handles are closed.
+func (c *Client) trackPublisher(ctx context.Context, open func(ctx context.Context) (Publisher, error)) (Publisher, error) {
+	key, ok := newConnectionKey(c.config)
+	if !ok {
+		return open(ctx)
+	}
+	share := c.config.ShareConnections
+
+	if share {
+		openPublishers.Lock()
+		if entry := openPublishers.entries[key]; entry != nil && entry.shared != nil {
+			entry.open++
+			pub := entry.shared
+			openPublishers.Unlock()
+			return newReleasingPublisher(pub, func(ctx context.Context) error { return releasePublisher(ctx, key, nil) }), nil
+		}
+		openPublishers.Unlock()
+	}
+
+	pub, err := open(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	openPublishers.Lock()
+	entry := openPublishers.entries[key]
+	if entry == nil {
+		entry = &openPublisher{}
+		openPublishers.entries[key] = entry
+	}
+	entry.open++
+	if !share {
+		n := entry.open
+		duplicate := n > 1 && !entry.warned
+		if duplicate {
+			entry.warned = true
+		}
+		openPublishers.Unlock()
+
+		if duplicate {
+			EmitEvent(c.config, Event{
+				Type:   EventDuplicatePublisher,
+				Detail: fmt.Sprintf("%d publishers are open with the same configuration, each with its own connection; reuse one publisher or set Config.ShareConnections", n),
+			})
+		}
+		return newReleasingPublisher(pub, func(ctx context.Context) error { return releasePublisher(ctx, key, pub) }), nil
+	}
+
+	shared := entry.shared
+	if shared == nil {
+		entry.shared = pub
+		shared = pub
+	}
+	openPublishers.Unlock()
+
+	if shared != pub {
+		// Another caller created the shared publisher meanwhile
+		pub.Close(ctx)
+	}
+	return newReleasingPublisher(shared, func(ctx context.Context) error { return releasePublisher(ctx, key, nil) }), nil
+}
+
+// releasePublisher closes a handle of the publishers of key: own, if it is
+// not shared, or else the shared publisher once its last handle is closed.
+func releasePublisher(ctx context.Context, key connectionKey, own Publisher) error {
+	openPublishers.Lock()
+	entry := openPublishers.entries[key]
+	entry.open--
+	pub := own
+	if own == nil && entry.open == 0 {
+		pub = entry.shared
+		entry.shared = nil
+	}
+	if entry.open == 0 && entry.shared == nil {
+		delete(openPublishers.entries, key)
+	}
+	openPublishers.Unlock()
+
+	if pub == nil {
+		return nil
+	}
+	return pub.Close(ctx)
+}
+
+// newReleasingPublisher wraps pub so that Close calls release once. The
+// returned publisher implements ScheduledPublisher if pub does.
+func newReleasingPublisher(pub Publisher, release func(ctx context.Context) error) Publisher {
+	p := &releasingPublisher{Publisher: pub, release: release}
+	if sp, ok := pub.(ScheduledPublisher); ok {
+		return &releasingScheduledPublisher{releasingPublisher: p, scheduled: sp}
+	}
+	return p
+}
+
+// releasingPublisher is a handle of a tracked publisher.
+type releasingPublisher struct {
+	Publisher
+	release func(ctx context.Context) error
+	once    sync.Once
+}
+
+func (p *releasingPublisher) Close(ctx context.Context) error {
+	var err error
+	p.once.Do(func() { err = p.release(ctx) })
+	return err
+}
+
+func (p *releasingPublisher) BrokerProperties() map[string]interface{} {
+	return brokerProperties(p.Publisher)
+}
+
+// releasingScheduledPublisher is a releasingPublisher whose publisher can
+// schedule messages.
+type releasingScheduledPublisher struct {
+	*releasingPublisher
+	scheduled ScheduledPublisher
+}
+
+func (p *releasingScheduledPublisher) Schedule(ctx context.Context, msg *Message, at time.Time) (string, error) {
+	return p.scheduled.Schedule(ctx, msg, at)
+}
+
+func (p *releasingScheduledPublisher) ScheduleBatch(ctx context.Context, msgs []*Message, at time.Time) ([]string, error) {
+	return ScheduleBatch(ctx, p.scheduled, msgs, at)
+}
+
+func (p *releasingScheduledPublisher) CancelScheduled(ctx context.Context, token string) error {
+	return p.scheduled.CancelScheduled(ctx, token)
+}
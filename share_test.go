@@ -0,0 +1,182 @@
+package gokyu
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// connectionFactory counts created and closed publishers.
+type connectionFactory struct {
+	mockFactory
+	created int
+	closed  int
+}
+
+func (f *connectionFactory) NewPublisher(ctx context.Context, cfg *Config) (Publisher, error) {
+	f.created++
+	return &connectionPublisher{factory: f}, nil
+}
+
+type connectionPublisher struct {
+	mockPublisher
+	factory *connectionFactory
+}
+
+func (p *connectionPublisher) Close(ctx context.Context) error {
+	p.factory.closed++
+	return nil
+}
+
+// duplicateEvents returns the EventDuplicatePublisher events received on
+// events so far.
+func duplicateEvents(events <-chan Event) []Event {
+	var got []Event
+	for {
+		select {
+		case ev := <-events:
+			if ev.Type == EventDuplicatePublisher {
+				got = append(got, ev)
+			}
+		default:
+			return got
+		}
+	}
+}
+
+func TestClient_NewPublisher_DuplicateWarning(t *testing.T) {
+	factory := &connectionFactory{}
+	RegisterProvider("test-duplicate-provider", factory)
+	cfg := Config{Provider: "test-duplicate-provider", ConnectionString: "amqps://test", Topic: "orders", Events: NewEventBus()}
+	events := cfg.Events.Subscribe(0)
+
+	ctx := context.Background()
+	var pubs []Publisher
+	for i := 0; i < 3; i++ {
+		client, _ := NewClient(&cfg)
+		pub, err := client.NewPublisher(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pubs = append(pubs, pub)
+	}
+
+	if factory.created != 3 {
+		t.Errorf("expected 3 publishers, got %d", factory.created)
+	}
+	if got := duplicateEvents(events); len(got) != 1 || got[0].Topic != "orders" || !strings.Contains(got[0].Detail, "2 publishers are open") {
+		t.Errorf("expected one duplicate publisher event, got %+v", got)
+	}
+	for _, pub := range pubs {
+		pub.Close(ctx)
+	}
+	if factory.closed != 3 {
+		t.Errorf("expected 3 closed publishers, got %d", factory.closed)
+	}
+}
+
+func TestClient_NewPublisher_ShareConnections(t *testing.T) {
+	factory := &connectionFactory{}
+	RegisterProvider("test-share-provider", factory)
+	cfg := Config{Provider: "test-share-provider", ConnectionString: "amqps://test", Topic: "orders", ShareConnections: true, Events: NewEventBus()}
+	events := cfg.Events.Subscribe(0)
+
+	ctx := context.Background()
+	a, _ := NewClient(&cfg)
+	b, _ := NewClient(&cfg)
+	pubA, _ := a.NewPublisher(ctx)
+	pubB, _ := b.NewPublisher(ctx)
+	if got := duplicateEvents(events); factory.created != 1 || len(got) != 0 {
+		t.Fatalf("expected one shared publisher without warnings, got %d, events %+v", factory.created, got)
+	}
+
+	pubA.Close(ctx)
+	pubA.Close(ctx)
+	if factory.closed != 0 {
+		t.Fatal("expected the shared publisher to stay open while a handle is open")
+	}
+	if err := pubB.Publish(ctx, NewMessage(nil)); err != nil {
+		t.Errorf("Publish() error = %v", err)
+	}
+	pubB.Close(ctx)
+	if factory.closed != 1 {
+		t.Errorf("expected the shared publisher to be closed with the last handle, closed = %d", factory.closed)
+	}
+
+	// A new publisher after all handles are closed connects again
+	pubA, _ = a.NewPublisher(ctx)
+	pubA.Close(ctx)
+	if factory.created != 2 || factory.closed != 2 {
+		t.Errorf("created = %d, closed = %d", factory.created, factory.closed)
+	}
+}
+
+func TestClient_NewPublisher_ShareConnectionsPerIdentity(t *testing.T) {
+	factory := &connectionFactory{}
+	RegisterProvider("test-share-identity-provider", factory)
+	ctx := context.Background()
+	cfg := func(password string) *Config {
+		return &Config{Provider: "test-share-identity-provider", Host: "broker", Username: "app", Password: password, Topic: "orders", ShareConnections: true}
+	}
+
+	a, _ := NewClient(cfg("tenant-a-secret"))
+	b, _ := NewClient(cfg("tenant-b-secret"))
+	pubA, _ := a.NewPublisher(ctx)
+	defer pubA.Close(ctx)
+	pubB, _ := b.NewPublisher(ctx)
+	defer pubB.Close(ctx)
+	if factory.created != 2 {
+		t.Errorf("created = %d, want a connection per password", factory.created)
+	}
+
+	// Credentials providers that cannot be compared are never shared
+	withCredentials := cfg("")
+	withCredentials.Credentials = CredentialsFunc(func(ctx context.Context) (Credentials, error) {
+		return Credentials{Username: "app", Password: "rotated"}, nil
+	})
+	c, _ := NewClient(withCredentials)
+	d, _ := NewClient(withCredentials)
+	pubC, _ := c.NewPublisher(ctx)
+	defer pubC.Close(ctx)
+	pubD, _ := d.NewPublisher(ctx)
+	defer pubD.Close(ctx)
+	if factory.created != 4 {
+		t.Errorf("created = %d, want a connection per client with a credentials func", factory.created)
+	}
+}
+
+func TestClient_NewPublisher_ShareConnectionsPerTuning(t *testing.T) {
+	factory := &connectionFactory{}
+	RegisterProvider("test-share-tuning-provider", factory)
+	ctx := context.Background()
+	base := Config{Provider: "test-share-tuning-provider", ConnectionString: "amqps://test", Topic: "orders", ShareConnections: true,
+		ConnectionProperties: map[string]string{"team": "payments", "service": "billing"}}
+
+	configs := []func(cfg *Config){
+		func(cfg *Config) {},
+		// Equal connection properties share the connection
+		func(cfg *Config) {
+			cfg.ConnectionProperties = map[string]string{"service": "billing", "team": "payments"}
+		},
+		func(cfg *Config) { cfg.ConnectionProperties = map[string]string{"team": "search"} },
+		func(cfg *Config) { cfg.JMSInterop = true },
+		func(cfg *Config) { cfg.MaxFrameSize = 1 << 20 },
+		func(cfg *Config) { cfg.IdleTimeout = -1 },
+	}
+	for _, apply := range configs {
+		cfg := base
+		apply(&cfg)
+		client, err := NewClient(&cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub, err := client.NewPublisher(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer pub.Close(ctx)
+	}
+	if factory.created != len(configs)-1 {
+		t.Errorf("created = %d, want a connection per distinct tuning", factory.created)
+	}
+}
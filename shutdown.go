@@ -0,0 +1,111 @@
+package gokyu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ShutdownPhase orders the steps of a graceful shutdown. Phases run in
+// ascending order; applications can interleave their own steps by registering
+// them at a built-in phase or at any value in between (e.g. PhaseDrainHandlers+1).
+type ShutdownPhase int
+
+// Built-in shutdown phases.
+const (
+	// PhaseStopReceiving stops subscribers from taking new messages.
+	PhaseStopReceiving ShutdownPhase = 100
+
+	// PhaseDrainHandlers waits for in-progress handlers to finish.
+	PhaseDrainHandlers ShutdownPhase = 200
+
+	// PhaseFlushPublishers flushes buffered or asynchronous publishes.
+	PhaseFlushPublishers ShutdownPhase = 300
+
+	// PhaseFlushOutbox publishes whatever remains in an outbox.
+	PhaseFlushOutbox ShutdownPhase = 400
+
+	// PhaseCloseConnections closes publishers, subscribers and connections.
+	PhaseCloseConnections ShutdownPhase = 500
+)
+
+// String returns the name of a built-in phase, or its number otherwise.
+func (p ShutdownPhase) String() string {
+	switch p {
+	case PhaseStopReceiving:
+		return "stop-receiving"
+	case PhaseDrainHandlers:
+		return "drain-handlers"
+	case PhaseFlushPublishers:
+		return "flush-publishers"
+	case PhaseFlushOutbox:
+		return "flush-outbox"
+	case PhaseCloseConnections:
+		return "close-connections"
+	default:
+		return fmt.Sprintf("phase-%d", int(p))
+	}
+}
+
+// ShutdownStep is a single named step of a graceful shutdown.
+type ShutdownStep func(ctx context.Context) error
+
+// Shutdown coordinates an ordered graceful shutdown. Steps run phase by phase;
+// steps within a phase run in registration order. A failing step does not
+// stop later steps, so connections are still closed if a flush fails.
+type Shutdown struct {
+	mu    sync.Mutex
+	steps []shutdownStep
+	once  sync.Once
+	err   error
+}
+
+type shutdownStep struct {
+	phase ShutdownPhase
+	name  string
+	fn    ShutdownStep
+}
+
+// NewShutdown creates an empty shutdown coordinator.
+func NewShutdown() *Shutdown {
+	return &Shutdown{}
+}
+
+// Register adds a step to run during the given phase.
+func (s *Shutdown) Register(phase ShutdownPhase, name string, fn ShutdownStep) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.steps = append(s.steps, shutdownStep{phase: phase, name: name, fn: fn})
+}
+
+// RegisterCloser registers c.Close at PhaseCloseConnections.
+func (s *Shutdown) RegisterCloser(name string, c interface{ Close(context.Context) error }) {
+	s.Register(PhaseCloseConnections, name, c.Close)
+}
+
+// Run executes all registered steps in phase order. It runs only once;
+// subsequent calls return the result of the first. Errors from individual
+// steps are joined and returned.
+func (s *Shutdown) Run(ctx context.Context) error {
+	s.once.Do(func() {
+		s.mu.Lock()
+		steps := make([]shutdownStep, len(s.steps))
+		copy(steps, s.steps)
+		s.mu.Unlock()
+
+		sort.SliceStable(steps, func(i, j int) bool {
+			return steps[i].phase < steps[j].phase
+		})
+
+		var errs []error
+		for _, step := range steps {
+			if err := step.fn(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("%s/%s: %w", step.phase, step.name, err))
+			}
+		}
+		s.err = errors.Join(errs...)
+	})
+	return s.err
+}
@@ -0,0 +1,62 @@
+package gokyu
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestShutdownOrdering(t *testing.T) {
+	s := NewShutdown()
+	var order []string
+	step := func(name string) ShutdownStep {
+		return func(ctx context.Context) error {
+			order = append(order, name)
+			return nil
+		}
+	}
+
+	s.Register(PhaseCloseConnections, "conn", step("conn"))
+	s.Register(PhaseFlushPublishers, "publisher", step("publisher"))
+	s.Register(PhaseStopReceiving, "subscriber", step("subscriber"))
+	s.Register(PhaseDrainHandlers+1, "app", step("app"))
+	s.Register(PhaseDrainHandlers, "handlers", step("handlers"))
+	s.Register(PhaseFlushOutbox, "outbox", step("outbox"))
+	s.Register(PhaseCloseConnections, "conn2", step("conn2"))
+
+	if err := s.Run(context.Background()); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	want := []string{"subscriber", "handlers", "app", "publisher", "outbox", "conn", "conn2"}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("expected order %v, got %v", want, order)
+	}
+
+	// Run is idempotent
+	s.Run(context.Background())
+	if len(order) != len(want) {
+		t.Errorf("expected steps to run once, got %v", order)
+	}
+}
+
+func TestShutdownContinuesAfterError(t *testing.T) {
+	s := NewShutdown()
+	flushErr := errors.New("flush failed")
+	closed := false
+
+	s.Register(PhaseFlushPublishers, "publisher", func(ctx context.Context) error { return flushErr })
+	s.Register(PhaseCloseConnections, "conn", func(ctx context.Context) error {
+		closed = true
+		return nil
+	})
+
+	err := s.Run(context.Background())
+	if !errors.Is(err, flushErr) {
+		t.Errorf("expected flush error, got %v", err)
+	}
+	if !closed {
+		t.Error("expected connections to be closed after a failed step")
+	}
+}
@@ -0,0 +1,289 @@
+// Package sidecar exposes gokyu publishers and subscribers over HTTP so that
+// non-Go services can use the same vendor-neutral abstraction.
+//
+// The server speaks JSON over plain HTTP and is intended to be bound to a
+// local socket next to the application (see cmd/gokyu-sidecar).
+//
+// # Endpoints
+//
+//	POST /v1/publish              publish a Message
+//	GET  /v1/receive?timeout=30s  receive a Message (204 if none arrived in time)
+//	POST /v1/ack?delivery=<id>    acknowledge a received message
+//	POST /v1/nack?delivery=<id>   release a received message for redelivery
+//
+// Messages are encoded as:
+//
+//	{
+//	  "id": "order-1",
+//	  "content_type": "application/json",
+//	  "body": "<base64>",
+//	  "properties": {"key": "value"},
+//	  "delivery_id": "17"
+//	}
+//
+// delivery_id is only set on received messages and identifies the message
+// for a subsequent ack or nack. Deliveries not settled within the server's
+// LockDuration are nacked, and settling them afterwards responds with 404.
+//
+// # Web UI
+//
+// NewUI serves a small web admin UI for peeking at the configured entity and
+// its dead-letter queue, requeueing dead-lettered messages and viewing
+// diagnostics. cmd/gokyu-sidecar and gokyu serve mount it under /ui/ when
+// started with -ui.
+package sidecar
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+)
+
+// DefaultReceiveTimeout is used when a receive request does not specify a timeout.
+const DefaultReceiveTimeout = 30 * time.Second
+
+// DefaultLockDuration is how long a received message may go unsettled
+// before the server nacks it, the default lock duration of Service Bus.
+const DefaultLockDuration = time.Minute
+
+// Message is the JSON representation of a gokyu.Message.
+type Message struct {
+	ID          string                 `json:"id,omitempty"`
+	ContentType string                 `json:"content_type,omitempty"`
+	Body        []byte                 `json:"body"`
+	Properties  map[string]interface{} `json:"properties,omitempty"`
+	DeliveryID  string                 `json:"delivery_id,omitempty"`
+}
+
+// Server serves the sidecar HTTP API.
+type Server struct {
+	// LockDuration is how long a received message may go unsettled before
+	// it is nacked on the next receive, so that clients which never settle
+	// do not hold messages forever (default: DefaultLockDuration). Set it
+	// before serving.
+	LockDuration time.Duration
+
+	// Clock is the time source (default: gokyu.SystemClock). Set it before
+	// serving.
+	Clock gokyu.Clock
+
+	publisher  gokyu.Publisher
+	subscriber gokyu.Subscriber
+	mux        *http.ServeMux
+
+	mu       sync.Mutex
+	nextID   uint64
+	inFlight map[string]delivery
+}
+
+// delivery is a received message awaiting ack or nack.
+type delivery struct {
+	msg     *gokyu.Message
+	expires time.Time
+}
+
+// NewServer creates a server backed by the given publisher and subscriber.
+// Either may be nil, in which case the corresponding endpoints respond with
+// 501 Not Implemented.
+func NewServer(pub gokyu.Publisher, sub gokyu.Subscriber) *Server {
+	s := &Server{
+		publisher:  pub,
+		subscriber: sub,
+		mux:        http.NewServeMux(),
+		inFlight:   make(map[string]delivery),
+	}
+	s.mux.HandleFunc("/v1/publish", s.handlePublish)
+	s.mux.HandleFunc("/v1/receive", s.handleReceive)
+	s.mux.HandleFunc("/v1/ack", s.handleSettle(gokyu.Subscriber.Ack))
+	s.mux.HandleFunc("/v1/nack", s.handleSettle(gokyu.Subscriber.Nack))
+	return s
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Close releases all messages that were received but never settled.
+func (s *Server) Close(ctx context.Context) error {
+	s.mu.Lock()
+	pending := s.inFlight
+	s.inFlight = make(map[string]delivery)
+	s.mu.Unlock()
+
+	var firstErr error
+	for _, d := range pending {
+		if err := s.subscriber.Nack(ctx, d.msg); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// expire nacks the deliveries whose lock duration has passed.
+func (s *Server) expire(ctx context.Context) {
+	now := s.clock().Now()
+	var expired []*gokyu.Message
+	s.mu.Lock()
+	for id, d := range s.inFlight {
+		if !now.Before(d.expires) {
+			expired = append(expired, d.msg)
+			delete(s.inFlight, id)
+		}
+	}
+	s.mu.Unlock()
+
+	// The broker may have released the message already, so errors are
+	// ignored
+	for _, msg := range expired {
+		s.subscriber.Nack(ctx, msg)
+	}
+}
+
+func (s *Server) clock() gokyu.Clock {
+	if s.Clock == nil {
+		return gokyu.SystemClock
+	}
+	return s.Clock
+}
+
+func (s *Server) lockDuration() time.Duration {
+	if s.LockDuration <= 0 {
+		return DefaultLockDuration
+	}
+	return s.LockDuration
+}
+
+func (s *Server) handlePublish(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if s.publisher == nil {
+		writeError(w, http.StatusNotImplemented, "publishing is not enabled")
+		return
+	}
+
+	var in Message
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid message: "+err.Error())
+		return
+	}
+
+	msg := gokyu.NewMessage(in.Body)
+	msg.ID = in.ID
+	msg.ContentType = in.ContentType
+	for k, v := range in.Properties {
+		msg.Properties[k] = v
+	}
+
+	if err := s.publisher.Publish(r.Context(), msg); err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleReceive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	if s.subscriber == nil {
+		writeError(w, http.StatusNotImplemented, "subscribing is not enabled")
+		return
+	}
+
+	timeout := DefaultReceiveTimeout
+	if v := r.URL.Query().Get("timeout"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid timeout")
+			return
+		}
+		timeout = d
+	}
+
+	s.expire(r.Context())
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	msg, err := s.subscriber.Receive(ctx)
+	if msg != nil && err != nil {
+		// Received but not prepared, e.g. by a failing receive hook
+		s.subscriber.Nack(r.Context(), msg)
+	}
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	s.nextID++
+	deliveryID := strconv.FormatUint(s.nextID, 10)
+	s.inFlight[deliveryID] = delivery{msg: msg, expires: s.clock().Now().Add(s.lockDuration())}
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(Message{
+		ID:          msg.ID,
+		ContentType: msg.ContentType,
+		Body:        msg.Body,
+		Properties:  msg.Properties,
+		DeliveryID:  deliveryID,
+	})
+}
+
+func (s *Server) handleSettle(settle func(gokyu.Subscriber, context.Context, *gokyu.Message) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if s.subscriber == nil {
+			writeError(w, http.StatusNotImplemented, "subscribing is not enabled")
+			return
+		}
+
+		deliveryID := r.URL.Query().Get("delivery")
+
+		s.mu.Lock()
+		d, ok := s.inFlight[deliveryID]
+		delete(s.inFlight, deliveryID)
+		s.mu.Unlock()
+
+		if !ok {
+			writeError(w, http.StatusNotFound, "unknown delivery")
+			return
+		}
+		if !s.clock().Now().Before(d.expires) {
+			s.subscriber.Nack(r.Context(), d.msg)
+			writeError(w, http.StatusNotFound, "delivery expired")
+			return
+		}
+
+		if err := settle(s.subscriber, r.Context(), d.msg); err != nil {
+			writeError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// writeError writes a JSON error response.
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
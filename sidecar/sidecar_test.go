@@ -0,0 +1,166 @@
+package sidecar
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+)
+
+type recordingPublisher struct {
+	published []*gokyu.Message
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, msg *gokyu.Message) error {
+	p.published = append(p.published, msg)
+	return nil
+}
+
+func (p *recordingPublisher) Close(ctx context.Context) error { return nil }
+
+type queueSubscriber struct {
+	msgs   []*gokyu.Message
+	acked  []*gokyu.Message
+	nacked []*gokyu.Message
+}
+
+func (s *queueSubscriber) Receive(ctx context.Context) (*gokyu.Message, error) {
+	if len(s.msgs) == 0 {
+		<-ctx.Done()
+		return nil, gokyu.WrapError(gokyu.ErrReceiveFailed, ctx.Err())
+	}
+	msg := s.msgs[0]
+	s.msgs = s.msgs[1:]
+	return msg, nil
+}
+
+func (s *queueSubscriber) Ack(ctx context.Context, msg *gokyu.Message) error {
+	s.acked = append(s.acked, msg)
+	return nil
+}
+
+func (s *queueSubscriber) Nack(ctx context.Context, msg *gokyu.Message) error {
+	s.nacked = append(s.nacked, msg)
+	return nil
+}
+
+func (s *queueSubscriber) Close(ctx context.Context) error { return nil }
+
+func TestServer_Publish(t *testing.T) {
+	pub := &recordingPublisher{}
+	srv := NewServer(pub, nil)
+
+	body, _ := json.Marshal(Message{ID: "m1", Body: []byte("hello"), Properties: map[string]interface{}{"k": "v"}})
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/publish", bytes.NewReader(body)))
+
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d: %s", rec.Code, rec.Body)
+	}
+	if len(pub.published) != 1 {
+		t.Fatalf("expected 1 published message, got %d", len(pub.published))
+	}
+	got := pub.published[0]
+	if got.ID != "m1" || string(got.Body) != "hello" || got.Properties["k"] != "v" {
+		t.Errorf("unexpected published message: %+v", got)
+	}
+}
+
+func TestServer_ReceiveAndAck(t *testing.T) {
+	msg := gokyu.NewMessage([]byte("hello"))
+	sub := &queueSubscriber{msgs: []*gokyu.Message{msg}}
+	srv := NewServer(nil, sub)
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/receive", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body)
+	}
+
+	var got Message
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if string(got.Body) != "hello" || got.DeliveryID == "" {
+		t.Fatalf("unexpected received message: %+v", got)
+	}
+
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/ack?delivery="+got.DeliveryID, nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d", rec.Code)
+	}
+	if len(sub.acked) != 1 || sub.acked[0] != msg {
+		t.Error("expected message to be acknowledged")
+	}
+
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/ack?delivery="+got.DeliveryID, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected status 404 for settled delivery, got %d", rec.Code)
+	}
+}
+
+func TestServer_ReceiveTimeout(t *testing.T) {
+	srv := NewServer(nil, &queueSubscriber{})
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/receive?timeout=10ms", nil))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("expected status 204, got %d", rec.Code)
+	}
+}
+
+func TestServer_DisabledEndpoints(t *testing.T) {
+	srv := NewServer(nil, nil)
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/publish", bytes.NewReader([]byte("{}"))))
+	if rec.Code != http.StatusNotImplemented {
+		t.Errorf("expected status 501, got %d", rec.Code)
+	}
+}
+
+func TestServer_ExpiresUnsettledDeliveries(t *testing.T) {
+	first, second := gokyu.NewMessage([]byte("first")), gokyu.NewMessage([]byte("second"))
+	sub := &queueSubscriber{msgs: []*gokyu.Message{first, second}}
+	clock := gokyu.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	srv := NewServer(nil, sub)
+	srv.LockDuration = time.Minute
+	srv.Clock = clock
+
+	receive := func() Message {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/receive?timeout=10ms", nil))
+		var got Message
+		json.NewDecoder(rec.Body).Decode(&got)
+		return got
+	}
+
+	abandoned := receive()
+	clock.Advance(time.Minute)
+	settled := receive()
+	if len(sub.nacked) != 1 || sub.nacked[0] != first {
+		t.Fatalf("nacked %v, want the delivery past its lock duration", sub.nacked)
+	}
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/ack?delivery="+abandoned.DeliveryID, nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("ack of an expired delivery: status %d, want 404", rec.Code)
+	}
+
+	// Expired deliveries are rejected even before the next receive
+	clock.Advance(time.Minute)
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/v1/ack?delivery="+settled.DeliveryID, nil))
+	if rec.Code != http.StatusNotFound || len(sub.acked) != 0 || len(sub.nacked) != 2 {
+		t.Errorf("ack after the lock duration: status %d, acked %d, nacked %d", rec.Code, len(sub.acked), len(sub.nacked))
+	}
+}
@@ -0,0 +1,255 @@
+package sidecar
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+)
+
+//go:embed ui.html
+var uiPage []byte
+
+// UIOptions configures the web admin UI.
+type UIOptions struct {
+	// MaxPeek caps the number of messages returned by one peek (default: 100).
+	MaxPeek int
+
+	// IdleTimeout ends a peek or requeue scan when no message arrives for
+	// this long (default: 2s).
+	IdleTimeout time.Duration
+}
+
+// PeekedMessage is a message shown by the UI.
+type PeekedMessage struct {
+	Message
+	EnqueuedTime time.Time `json:"enqueued_time,omitempty"`
+	Reason       string    `json:"reason,omitempty"`
+}
+
+// UI serves a small web admin UI for the client's configured entity under
+// /ui/. It lets teams without access to the broker console peek at the
+// queue and its dead-letter queue, requeue dead-lettered messages and view
+// the library's diagnostics.
+//
+// The UI opens its own links, so peeking never takes messages from the
+// sidecar's subscriber. Peeked messages are released once the peek ends and
+// their delivery count is incremented.
+//
+// # Endpoints
+//
+//	GET  /ui/                         the UI page
+//	GET  /ui/api/entity               the configured provider and entity
+//	GET  /ui/api/messages?n=20&dlq=1  peek at up to n messages
+//	POST /ui/api/requeue              requeue dead-lettered messages: {"ids": ["m1"]}
+//	GET  /ui/api/diagnostics          gokyu.Snapshot()
+type UI struct {
+	client *gokyu.Client
+	opts   UIOptions
+	mux    *http.ServeMux
+}
+
+// NewUI creates the UI for a client.
+func NewUI(client *gokyu.Client, opts UIOptions) *UI {
+	if opts.MaxPeek <= 0 {
+		opts.MaxPeek = 100
+	}
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = 2 * time.Second
+	}
+
+	u := &UI{client: client, opts: opts, mux: http.NewServeMux()}
+	u.mux.HandleFunc("/ui/", u.handlePage)
+	u.mux.HandleFunc("/ui/api/entity", u.handleEntity)
+	u.mux.HandleFunc("/ui/api/messages", u.handleMessages)
+	u.mux.HandleFunc("/ui/api/requeue", u.handleRequeue)
+	u.mux.HandleFunc("/ui/api/diagnostics", u.handleDiagnostics)
+	return u
+}
+
+// ServeHTTP implements http.Handler.
+func (u *UI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	u.mux.ServeHTTP(w, r)
+}
+
+func (u *UI) handlePage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/ui/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(uiPage)
+}
+
+func (u *UI) handleEntity(w http.ResponseWriter, r *http.Request) {
+	cfg := u.client.Config()
+	writeJSON(w, map[string]string{
+		"provider":          string(cfg.Provider),
+		"queue":             cfg.Queue,
+		"topic":             cfg.Topic,
+		"subscription":      cfg.Subscription,
+		"dead_letter_queue": cfg.DeadLetterQueue,
+	})
+}
+
+func (u *UI) handleMessages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	n := 20
+	if v := r.URL.Query().Get("n"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid n")
+			return
+		}
+	}
+	if n > u.opts.MaxPeek {
+		n = u.opts.MaxPeek
+	}
+
+	sub, err := u.open(r.Context(), r.URL.Query().Get("dlq") != "")
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	defer sub.Close(context.Background())
+
+	// Hold the messages until the peek ends so none is seen twice
+	var held []*gokyu.Message
+	defer func() {
+		for _, msg := range held {
+			sub.Nack(context.Background(), msg)
+		}
+	}()
+
+	peeked := []PeekedMessage{}
+	err = u.scan(r.Context(), sub, func(msg *gokyu.Message) bool {
+		held = append(held, msg)
+		peeked = append(peeked, PeekedMessage{
+			Message: Message{
+				ID:          msg.ID,
+				ContentType: msg.ContentType,
+				Body:        msg.Body,
+				Properties:  msg.Properties,
+			},
+			EnqueuedTime: msg.EnqueuedTime,
+			Reason:       gokyu.DeadLetterReason(msg),
+		})
+		return len(peeked) < n
+	})
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, peeked)
+}
+
+func (u *UI) handleRequeue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req struct {
+		IDs []string `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.IDs) == 0 {
+		writeError(w, http.StatusBadRequest, "expected {\"ids\": [...]}")
+		return
+	}
+	wanted := make(map[string]bool, len(req.IDs))
+	for _, id := range req.IDs {
+		wanted[id] = true
+	}
+
+	sub, err := u.open(r.Context(), true)
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	defer sub.Close(context.Background())
+
+	pub, err := u.client.NewPublisher(r.Context())
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	defer pub.Close(context.Background())
+
+	requeued := 0
+	var settleErr error
+	err = u.scan(r.Context(), sub, func(msg *gokyu.Message) bool {
+		if !wanted[msg.ID] {
+			settleErr = sub.Nack(r.Context(), msg)
+			return settleErr == nil
+		}
+		if settleErr = pub.Publish(r.Context(), gokyu.NewRequeueMessage(msg)); settleErr != nil {
+			sub.Nack(r.Context(), msg)
+			return false
+		}
+		if settleErr = sub.Ack(r.Context(), msg); settleErr != nil {
+			return false
+		}
+		delete(wanted, msg.ID)
+		requeued++
+		return len(wanted) > 0
+	})
+	if err == nil {
+		err = settleErr
+	}
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	writeJSON(w, map[string]int{"requeued": requeued})
+}
+
+func (u *UI) handleDiagnostics(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, gokyu.Snapshot())
+}
+
+// open opens a subscriber on the entity or its dead-letter queue.
+func (u *UI) open(ctx context.Context, deadLetter bool) (gokyu.Subscriber, error) {
+	if deadLetter {
+		return u.client.NewDeadLetterSubscriber(ctx)
+	}
+	return u.client.NewSubscriber(ctx)
+}
+
+// scan passes messages to fn until it returns false, the idle timeout
+// expires or a released message comes around again.
+func (u *UI) scan(ctx context.Context, sub gokyu.Subscriber, fn func(*gokyu.Message) bool) error {
+	seen := make(map[string]bool)
+	for {
+		recvCtx, cancel := context.WithTimeout(ctx, u.opts.IdleTimeout)
+		msg, err := sub.Receive(recvCtx)
+		cancel()
+		if err != nil {
+			if ctx.Err() == nil && errors.Is(recvCtx.Err(), context.DeadlineExceeded) {
+				return nil
+			}
+			return err
+		}
+		if msg.ID != "" && seen[msg.ID] {
+			return sub.Nack(ctx, msg)
+		}
+		seen[msg.ID] = true
+		if !fn(msg) {
+			return nil
+		}
+	}
+}
+
+// writeJSON writes a JSON response.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
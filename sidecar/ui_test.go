@@ -0,0 +1,168 @@
+package sidecar
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+)
+
+// brokerFactory is a provider with one queue and its dead-letter queue.
+type brokerFactory struct {
+	mu        sync.Mutex
+	queue     []*gokyu.Message
+	dlq       []*gokyu.Message
+	published *recordingPublisher
+}
+
+func (f *brokerFactory) NewPublisher(ctx context.Context, cfg *gokyu.Config) (gokyu.Publisher, error) {
+	return f.published, nil
+}
+
+func (f *brokerFactory) NewSubscriber(ctx context.Context, cfg *gokyu.Config) (gokyu.Subscriber, error) {
+	return &brokerSubscriber{f: f, backlog: &f.queue}, nil
+}
+
+func (f *brokerFactory) NewDeadLetterSubscriber(ctx context.Context, cfg *gokyu.Config) (gokyu.Subscriber, error) {
+	return &brokerSubscriber{f: f, backlog: &f.dlq}, nil
+}
+
+// brokerSubscriber receives from a backlog and appends released messages
+// to its end.
+type brokerSubscriber struct {
+	f       *brokerFactory
+	backlog *[]*gokyu.Message
+}
+
+func (s *brokerSubscriber) Receive(ctx context.Context) (*gokyu.Message, error) {
+	s.f.mu.Lock()
+	if len(*s.backlog) == 0 {
+		s.f.mu.Unlock()
+		<-ctx.Done()
+		return nil, gokyu.WrapError(gokyu.ErrReceiveFailed, ctx.Err())
+	}
+	msg := (*s.backlog)[0]
+	*s.backlog = (*s.backlog)[1:]
+	s.f.mu.Unlock()
+	return msg, nil
+}
+
+func (s *brokerSubscriber) Ack(ctx context.Context, msg *gokyu.Message) error { return nil }
+
+func (s *brokerSubscriber) Nack(ctx context.Context, msg *gokyu.Message) error {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	*s.backlog = append(*s.backlog, msg)
+	return nil
+}
+
+func (s *brokerSubscriber) Close(ctx context.Context) error { return nil }
+
+func newTestUI(t *testing.T, f *brokerFactory) *UI {
+	t.Helper()
+	gokyu.RegisterProvider("ui-test", f)
+	client, err := gokyu.NewClient(&gokyu.Config{
+		Provider:         "ui-test",
+		ConnectionString: "amqps://test@host",
+		Queue:            "orders",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewUI(client, UIOptions{IdleTimeout: 20 * time.Millisecond})
+}
+
+func testMessage(id string, props map[string]interface{}) *gokyu.Message {
+	msg := gokyu.NewMessage([]byte(`{"id":"` + id + `"}`))
+	msg.ID = id
+	for k, v := range props {
+		msg.Properties[k] = v
+	}
+	return msg
+}
+
+func TestUI_Page(t *testing.T) {
+	u := newTestUI(t, &brokerFactory{})
+
+	rec := httptest.NewRecorder()
+	u.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ui/", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "<title>gokyu</title>") {
+		t.Errorf("expected the UI page, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	u.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ui/api/entity", nil))
+	var entity map[string]string
+	json.NewDecoder(rec.Body).Decode(&entity)
+	if entity["provider"] != "ui-test" || entity["queue"] != "orders" {
+		t.Errorf("unexpected entity: %v", entity)
+	}
+}
+
+func TestUI_PeekReleasesMessages(t *testing.T) {
+	f := &brokerFactory{queue: []*gokyu.Message{testMessage("m1", nil), testMessage("m2", nil), testMessage("m3", nil)}}
+	u := newTestUI(t, f)
+
+	rec := httptest.NewRecorder()
+	u.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ui/api/messages?n=2", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var peeked []PeekedMessage
+	json.NewDecoder(rec.Body).Decode(&peeked)
+	if len(peeked) != 2 || peeked[0].ID != "m1" || peeked[1].ID != "m2" {
+		t.Fatalf("unexpected peek: %+v", peeked)
+	}
+	if len(f.queue) != 3 {
+		t.Errorf("expected all messages to be released, %d left", len(f.queue))
+	}
+}
+
+func TestUI_RequeueDeadLetters(t *testing.T) {
+	f := &brokerFactory{
+		published: &recordingPublisher{},
+		dlq: []*gokyu.Message{
+			testMessage("m1", map[string]interface{}{gokyu.PropertyDeadLetterReason: "MaxDeliveryCountExceeded"}),
+			testMessage("m2", map[string]interface{}{gokyu.PropertyDeadLetterReason: "TTLExpiredException"}),
+			testMessage("m3", map[string]interface{}{gokyu.PropertyDeadLetterReason: "MaxDeliveryCountExceeded"}),
+		},
+	}
+	u := newTestUI(t, f)
+
+	rec := httptest.NewRecorder()
+	u.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/ui/api/messages?dlq=1", nil))
+	var peeked []PeekedMessage
+	json.NewDecoder(rec.Body).Decode(&peeked)
+	if len(peeked) != 3 || peeked[1].Reason != "TTLExpiredException" {
+		t.Fatalf("unexpected dead letters: %+v", peeked)
+	}
+
+	body, _ := json.Marshal(map[string][]string{"ids": {"m1", "m3"}})
+	rec = httptest.NewRecorder()
+	u.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/ui/api/requeue", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body)
+	}
+	var res map[string]int
+	json.NewDecoder(rec.Body).Decode(&res)
+	if res["requeued"] != 2 {
+		t.Errorf("requeued = %d, want 2", res["requeued"])
+	}
+
+	if len(f.published.published) != 2 || f.published.published[0].ID != "m1" || f.published.published[1].ID != "m3" {
+		t.Fatalf("unexpected published messages: %+v", f.published.published)
+	}
+	if _, ok := f.published.published[0].Properties[gokyu.PropertyDeadLetterReason]; ok {
+		t.Error("expected the dead-letter reason to be removed")
+	}
+	if len(f.dlq) != 1 || f.dlq[0].ID != "m2" {
+		t.Errorf("expected only m2 to remain dead-lettered, got %d", len(f.dlq))
+	}
+}
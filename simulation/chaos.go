@@ -0,0 +1,249 @@
+package simulation
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+)
+
+// ChaosConfig configures a ChaosSubscriber. Rates are probabilities between
+// 0 and 1 drawn from a random source seeded with Seed.
+type ChaosConfig struct {
+	// Seed seeds the random source.
+	Seed int64
+
+	// DuplicateRate is the probability that a message is delivered a second
+	// time, after the original, as a broker does when an ack is lost.
+	DuplicateRate float64
+
+	// DelayRate is the probability that a delivery is delayed by up to
+	// MaxDelay before Receive returns it.
+	DelayRate float64
+
+	// MaxDelay bounds injected delays (default: 1s).
+	MaxDelay time.Duration
+
+	// ReorderRate is the probability that a message is held back and the
+	// next one delivered first.
+	ReorderRate float64
+
+	// ReorderWait is how long a held-back message waits for a next message
+	// before it is delivered anyway (default: 100ms).
+	ReorderWait time.Duration
+
+	// Clock times delays and reorder waits (default: gokyu.SystemClock).
+	Clock gokyu.Clock
+}
+
+// WithDefaults returns the config with default values applied.
+func (c ChaosConfig) WithDefaults() ChaosConfig {
+	if c.MaxDelay <= 0 {
+		c.MaxDelay = time.Second
+	}
+	if c.ReorderWait <= 0 {
+		c.ReorderWait = 100 * time.Millisecond
+	}
+	if c.Clock == nil {
+		c.Clock = gokyu.SystemClock
+	}
+	return c
+}
+
+// ChaosStats counts the disruptions injected by a ChaosSubscriber.
+type ChaosStats struct {
+	Duplicated int
+	Delayed    int
+	Reordered  int
+}
+
+// ChaosSubscriber wraps a real subscriber and duplicates, delays and
+// reorders its deliveries, to check that a handler is idempotent and
+// tolerates out-of-order messages before production proves it is not:
+//
+//	sub = simulation.NewChaosSubscriber(sub, simulation.ChaosConfig{
+//	    Seed:          1,
+//	    DuplicateRate: 0.1,
+//	    ReorderRate:   0.1,
+//	})
+//
+// Settling a duplicate does nothing; the original's settlement reaches the
+// wrapped subscriber.
+type ChaosSubscriber struct {
+	sub gokyu.Subscriber
+	cfg ChaosConfig
+
+	mu         sync.Mutex
+	rand       *rand.Rand
+	pending    []*gokyu.Message // delivered before receiving from sub
+	held       *gokyu.Message   // held back for reordering
+	duplicates map[*gokyu.Message]bool
+	stats      ChaosStats
+}
+
+// NewChaosSubscriber wraps sub with the disruptions configured in cfg.
+func NewChaosSubscriber(sub gokyu.Subscriber, cfg ChaosConfig) *ChaosSubscriber {
+	return &ChaosSubscriber{
+		sub:        sub,
+		cfg:        cfg.WithDefaults(),
+		rand:       rand.New(rand.NewSource(cfg.Seed)),
+		duplicates: make(map[*gokyu.Message]bool),
+	}
+}
+
+// Stats returns the disruptions injected so far.
+func (c *ChaosSubscriber) Stats() ChaosStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// Receive returns the next message, possibly a duplicate, out of order, or
+// late.
+func (c *ChaosSubscriber) Receive(ctx context.Context) (*gokyu.Message, error) {
+	msg, err := c.next(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	var delay time.Duration
+	if c.chance(c.cfg.DelayRate) {
+		delay = time.Duration(c.rand.Int63n(int64(c.cfg.MaxDelay))) + 1
+		c.stats.Delayed++
+	}
+	if !c.duplicates[msg] && c.chance(c.cfg.DuplicateRate) {
+		dup := *msg
+		dup.Properties = make(map[string]interface{}, len(msg.Properties))
+		for k, v := range msg.Properties {
+			dup.Properties[k] = v
+		}
+		dup.Body = append([]byte(nil), msg.Body...)
+		c.duplicates[&dup] = true
+		c.pending = append(c.pending, &dup)
+		c.stats.Duplicated++
+	}
+	c.mu.Unlock()
+
+	if delay > 0 {
+		timer := c.cfg.Clock.NewTimer(delay)
+		select {
+		case <-timer.C():
+		case <-ctx.Done():
+			timer.Stop()
+			// The message was taken from the broker; keep it for the next call
+			c.mu.Lock()
+			c.pending = append([]*gokyu.Message{msg}, c.pending...)
+			c.mu.Unlock()
+			return nil, ctx.Err()
+		}
+	}
+	return msg, nil
+}
+
+// next returns a pending message or receives one from the wrapped
+// subscriber, holding it back behind the following message if chosen for
+// reordering.
+func (c *ChaosSubscriber) next(ctx context.Context) (*gokyu.Message, error) {
+	c.mu.Lock()
+	if len(c.pending) > 0 {
+		msg := c.pending[0]
+		c.pending = c.pending[1:]
+		c.mu.Unlock()
+		return msg, nil
+	}
+	held := c.held
+	c.held = nil
+	c.mu.Unlock()
+
+	if held == nil {
+		msg, err := c.sub.Receive(ctx)
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		reorder := c.chance(c.cfg.ReorderRate)
+		c.mu.Unlock()
+		if !reorder {
+			return msg, nil
+		}
+		held = msg
+	}
+
+	msg, err := c.receiveWithin(ctx, c.cfg.ReorderWait)
+	if err != nil {
+		if ctx.Err() != nil {
+			c.mu.Lock()
+			c.held = held
+			c.mu.Unlock()
+			return nil, err
+		}
+		// Nothing to overtake it; deliver the held message after all
+		return held, nil
+	}
+
+	c.mu.Lock()
+	c.pending = append(c.pending, held)
+	c.stats.Reordered++
+	c.mu.Unlock()
+	return msg, nil
+}
+
+// receiveWithin receives from the wrapped subscriber, giving up after d on
+// the configured clock.
+func (c *ChaosSubscriber) receiveWithin(ctx context.Context, d time.Duration) (*gokyu.Message, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	timer := c.cfg.Clock.NewTimer(d)
+	defer timer.Stop()
+	go func() {
+		select {
+		case <-timer.C():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return c.sub.Receive(ctx)
+}
+
+// chance reports whether an event of the given probability happens. The
+// caller must hold c.mu.
+func (c *ChaosSubscriber) chance(rate float64) bool {
+	return rate > 0 && c.rand.Float64() < rate
+}
+
+// Ack acknowledges msg, unless it is an injected duplicate.
+func (c *ChaosSubscriber) Ack(ctx context.Context, msg *gokyu.Message) error {
+	if c.settleDuplicate(msg) {
+		return nil
+	}
+	return c.sub.Ack(ctx, msg)
+}
+
+// Nack rejects msg, unless it is an injected duplicate.
+func (c *ChaosSubscriber) Nack(ctx context.Context, msg *gokyu.Message) error {
+	if c.settleDuplicate(msg) {
+		return nil
+	}
+	return c.sub.Nack(ctx, msg)
+}
+
+// settleDuplicate forgets msg and reports whether it was a duplicate.
+func (c *ChaosSubscriber) settleDuplicate(msg *gokyu.Message) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.duplicates[msg] {
+		return false
+	}
+	delete(c.duplicates, msg)
+	return true
+}
+
+// Close closes the wrapped subscriber. Pending duplicates are dropped, and a
+// held-back message is left to be redelivered by the broker.
+func (c *ChaosSubscriber) Close(ctx context.Context) error {
+	return c.sub.Close(ctx)
+}
@@ -0,0 +1,82 @@
+package simulation
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+)
+
+func TestChaosSubscriber_DuplicateAndReorder(t *testing.T) {
+	sim := New(Config{})
+	sim.Enqueue(gokyu.NewMessage([]byte("a")), gokyu.NewMessage([]byte("b")))
+	chaos := NewChaosSubscriber(sim.Subscriber(), ChaosConfig{DuplicateRate: 1, ReorderRate: 1})
+
+	ctx := context.Background()
+	var got []string
+	for {
+		msg, err := chaos.Receive(ctx)
+		if errors.Is(err, ErrDrained) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Receive() error = %v", err)
+		}
+		got = append(got, msg.ID)
+		if err := chaos.Ack(ctx, msg); err != nil {
+			t.Fatalf("Ack() error = %v", err)
+		}
+	}
+
+	if want := "m2 m1 m2 m1"; strings.Join(got, " ") != want {
+		t.Errorf("deliveries = %q, want %q", strings.Join(got, " "), want)
+	}
+	if stats := chaos.Stats(); stats.Duplicated != 2 || stats.Reordered != 1 {
+		t.Errorf("Stats() = %+v", stats)
+	}
+
+	// Only the originals are settled with the broker
+	acks := 0
+	for _, e := range sim.Trace() {
+		if e.Kind == EventAck {
+			acks++
+		}
+	}
+	if acks != 2 {
+		t.Errorf("expected 2 broker acks, got %d", acks)
+	}
+}
+
+func TestChaosSubscriber_Delay(t *testing.T) {
+	sim := New(Config{})
+	sim.Enqueue(gokyu.NewMessage([]byte("a")))
+	clock := gokyu.NewFakeClock(time.Unix(1000, 0))
+	chaos := NewChaosSubscriber(sim.Subscriber(), ChaosConfig{DelayRate: 1, MaxDelay: time.Minute, Clock: clock})
+
+	received := make(chan *gokyu.Message, 1)
+	go func() {
+		msg, _ := chaos.Receive(context.Background())
+		received <- msg
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for clock.Timers() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the delay timer")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-received:
+		t.Fatal("expected the delivery to be delayed")
+	default:
+	}
+
+	clock.Advance(time.Minute)
+	if msg := <-received; msg == nil || msg.ID != "m1" {
+		t.Errorf("expected m1 after the delay, got %v", msg)
+	}
+}
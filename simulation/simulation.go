@@ -0,0 +1,384 @@
+// Package simulation drives message handlers with scripted message sequences,
+// virtual time, and injected failures, and records a deterministic trace of
+// everything that happened. It is intended for property-based tests of a
+// handler's retry and ordering behaviour.
+//
+// A simulation is single-threaded: messages are delivered one at a time and
+// virtual time only moves when the simulation advances it, so the same seed
+// and script always produce the same trace.
+//
+// # Usage
+//
+//	sim := simulation.New(simulation.Config{
+//	    Seed:            42,
+//	    MaxDeliveries:   5,
+//	    RedeliveryDelay: 10 * time.Second,
+//	    Faults:          simulation.Faults{AckErrorRate: 0.1},
+//	})
+//	sim.Enqueue(gokyu.NewMessage([]byte("order-1")))
+//	sim.EnqueueAt(sim.Now().Add(time.Minute), gokyu.NewMessage([]byte("order-2")))
+//
+//	trace, err := sim.Run(ctx, handler)
+//	fmt.Print(trace)
+//
+// Code with its own receive loop can use Subscriber and Publisher instead of
+// Run; receiving returns ErrDrained once no message is pending.
+package simulation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+)
+
+// PropertyDeliveryCount is set on delivered messages to the delivery attempt
+// number, starting at 1.
+const PropertyDeliveryCount = gokyu.PropertyDeliveryCount
+
+// ErrDrained is returned by Receive when no message is pending.
+var ErrDrained = errors.New("simulation: no pending messages")
+
+// EventKind identifies what happened in a trace event.
+type EventKind string
+
+// Trace event kinds.
+const (
+	EventReceive      EventKind = "receive"
+	EventReceiveError EventKind = "receive-error"
+	EventAck          EventKind = "ack"
+	EventAckError     EventKind = "ack-error"
+	EventNack         EventKind = "nack"
+	EventDeadLetter   EventKind = "dead-letter"
+	EventPublish      EventKind = "publish"
+	EventPublishError EventKind = "publish-error"
+)
+
+// Event is a single entry in a simulation trace.
+type Event struct {
+	Time      time.Time
+	Kind      EventKind
+	MessageID string
+	Delivery  int
+	Err       string
+}
+
+// String formats the event as a single trace line.
+func (e Event) String() string {
+	line := fmt.Sprintf("%s %-13s %s", e.Time.Format("15:04:05.000"), e.Kind, e.MessageID)
+	if e.Delivery > 0 {
+		line += fmt.Sprintf("#%d", e.Delivery)
+	}
+	if e.Err != "" {
+		line += " err=" + e.Err
+	}
+	return line
+}
+
+// Trace is the ordered list of events recorded by a simulation.
+type Trace []Event
+
+// String formats the trace with one event per line, suitable for golden files.
+func (t Trace) String() string {
+	var b strings.Builder
+	for _, e := range t {
+		b.WriteString(e.String())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// Faults configures randomly injected failures. Rates are probabilities
+// between 0 and 1 drawn from the simulation's seeded random source.
+type Faults struct {
+	ReceiveErrorRate float64
+	AckErrorRate     float64
+	PublishErrorRate float64
+}
+
+// Config holds the configuration of a simulation.
+type Config struct {
+	// Seed seeds the random source used for fault injection.
+	Seed int64
+
+	// Start is the initial virtual time (default: 2000-01-01T00:00:00Z).
+	Start time.Time
+
+	// MaxDeliveries dead-letters a message after this many deliveries
+	// (default: 10).
+	MaxDeliveries int
+
+	// RedeliveryDelay is how long a nacked message waits before it is
+	// delivered again (default: 0).
+	RedeliveryDelay time.Duration
+
+	// LockDuration is how long a message whose ack failed stays invisible
+	// before being redelivered (default: 30s).
+	LockDuration time.Duration
+
+	// HandlerDuration returns how much virtual time handling a message takes
+	// (default: none).
+	HandlerDuration func(msg *gokyu.Message) time.Duration
+
+	// Faults configures randomly injected failures.
+	Faults Faults
+}
+
+// Simulation is a scripted, deterministic message broker and consumer.
+type Simulation struct {
+	cfg    Config
+	clock  *gokyu.FakeClock
+	rand   *rand.Rand
+	seq    int
+	queue  []*delivery
+	forced map[EventKind][]error
+	trace  Trace
+
+	published  []*gokyu.Message
+	deadLetter []*gokyu.Message
+}
+
+// delivery is a message waiting in or taken from the simulated queue.
+type delivery struct {
+	msg       *gokyu.Message
+	id        string
+	count     int
+	seq       int
+	visibleAt time.Time
+}
+
+// New creates a simulation.
+func New(cfg Config) *Simulation {
+	if cfg.Start.IsZero() {
+		cfg.Start = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	if cfg.MaxDeliveries <= 0 {
+		cfg.MaxDeliveries = 10
+	}
+	if cfg.LockDuration <= 0 {
+		cfg.LockDuration = 30 * time.Second
+	}
+	return &Simulation{
+		cfg:    cfg,
+		clock:  gokyu.NewFakeClock(cfg.Start),
+		rand:   rand.New(rand.NewSource(cfg.Seed)),
+		forced: make(map[EventKind][]error),
+	}
+}
+
+// Clock returns the simulation's virtual clock, for handlers that need time.
+func (s *Simulation) Clock() gokyu.Clock { return s.clock }
+
+// Now returns the current virtual time.
+func (s *Simulation) Now() time.Time { return s.clock.Now() }
+
+// Enqueue adds a message that is available immediately.
+func (s *Simulation) Enqueue(msgs ...*gokyu.Message) {
+	for _, msg := range msgs {
+		s.EnqueueAt(s.Now(), msg)
+	}
+}
+
+// EnqueueAt adds a message that becomes available at the given virtual time.
+// Messages without an ID are assigned "m<n>" in enqueue order.
+func (s *Simulation) EnqueueAt(at time.Time, msg *gokyu.Message) {
+	s.seq++
+	id := msg.ID
+	if id == "" {
+		id = fmt.Sprintf("m%d", s.seq)
+	}
+	s.queue = append(s.queue, &delivery{msg: msg, id: id, seq: s.seq, visibleAt: at})
+}
+
+// FailNext forces the next operation of the given kind to fail with err.
+// Supported kinds are EventReceiveError, EventAckError and EventPublishError.
+// Forced failures queue up and take precedence over random faults.
+func (s *Simulation) FailNext(kind EventKind, err error) {
+	s.forced[kind] = append(s.forced[kind], err)
+}
+
+// Trace returns the events recorded so far.
+func (s *Simulation) Trace() Trace { return s.trace }
+
+// Published returns the messages published through Publisher.
+func (s *Simulation) Published() []*gokyu.Message { return s.published }
+
+// DeadLettered returns the messages that exceeded MaxDeliveries.
+func (s *Simulation) DeadLettered() []*gokyu.Message { return s.deadLetter }
+
+// Run delivers messages to handler until no message is pending, acking on
+// success and nacking on error, and returns the trace. The handler is the
+// one the application passes to gokyu.Subscribe.
+func (s *Simulation) Run(ctx context.Context, handler gokyu.Handler) (Trace, error) {
+	sub := s.Subscriber()
+	for {
+		if err := ctx.Err(); err != nil {
+			return s.trace, err
+		}
+
+		msg, err := sub.Receive(ctx)
+		if errors.Is(err, ErrDrained) {
+			return s.trace, nil
+		}
+		if err != nil {
+			continue
+		}
+
+		if s.cfg.HandlerDuration != nil {
+			s.clock.Advance(s.cfg.HandlerDuration(msg))
+		}
+
+		if err := handler(ctx, msg); err != nil {
+			sub.Nack(ctx, msg)
+			continue
+		}
+		sub.Ack(ctx, msg)
+	}
+}
+
+// fault reports whether an operation of the given kind should fail and with
+// which error.
+func (s *Simulation) fault(kind EventKind, rate float64) error {
+	if forced := s.forced[kind]; len(forced) > 0 {
+		s.forced[kind] = forced[1:]
+		return forced[0]
+	}
+	if rate > 0 && s.rand.Float64() < rate {
+		return fmt.Errorf("injected %s", kind)
+	}
+	return nil
+}
+
+// record appends an event to the trace.
+func (s *Simulation) record(kind EventKind, d *delivery, err error) {
+	e := Event{Time: s.Now(), Kind: kind}
+	if d != nil {
+		e.MessageID = d.id
+		e.Delivery = d.count
+	}
+	if err != nil {
+		e.Err = err.Error()
+	}
+	s.trace = append(s.trace, e)
+}
+
+// next removes the earliest visible delivery from the queue, advancing
+// virtual time if nothing is visible yet.
+func (s *Simulation) next() *delivery {
+	if len(s.queue) == 0 {
+		return nil
+	}
+	sort.SliceStable(s.queue, func(i, j int) bool {
+		a, b := s.queue[i], s.queue[j]
+		if !a.visibleAt.Equal(b.visibleAt) {
+			return a.visibleAt.Before(b.visibleAt)
+		}
+		return a.seq < b.seq
+	})
+
+	d := s.queue[0]
+	s.queue = s.queue[1:]
+	if d.visibleAt.After(s.Now()) {
+		s.clock.Set(d.visibleAt)
+	}
+	return d
+}
+
+// requeue makes a delivery visible again after delay, or dead-letters it if
+// it has reached MaxDeliveries.
+func (s *Simulation) requeue(d *delivery, delay time.Duration) {
+	if d.count >= s.cfg.MaxDeliveries {
+		s.deadLetter = append(s.deadLetter, d.msg)
+		s.record(EventDeadLetter, d, nil)
+		return
+	}
+	d.visibleAt = s.Now().Add(delay)
+	s.queue = append(s.queue, d)
+}
+
+// Subscriber returns a gokyu.Subscriber backed by the simulated queue.
+func (s *Simulation) Subscriber() gokyu.Subscriber { return &subscriber{sim: s} }
+
+// Publisher returns a gokyu.Publisher that records published messages.
+func (s *Simulation) Publisher() gokyu.Publisher { return &publisher{sim: s} }
+
+type subscriber struct {
+	sim *Simulation
+}
+
+func (sub *subscriber) Receive(ctx context.Context) (*gokyu.Message, error) {
+	s := sub.sim
+	if err := s.fault(EventReceiveError, s.cfg.Faults.ReceiveErrorRate); err != nil {
+		s.record(EventReceiveError, nil, err)
+		return nil, gokyu.WrapError(gokyu.ErrReceiveFailed, err)
+	}
+
+	d := s.next()
+	if d == nil {
+		return nil, ErrDrained
+	}
+	d.count++
+	s.record(EventReceive, d, nil)
+
+	msg := gokyu.NewMessage(append([]byte(nil), d.msg.Body...))
+	msg.ID = d.id
+	msg.ContentType = d.msg.ContentType
+	for k, v := range d.msg.Properties {
+		msg.Properties[k] = v
+	}
+	msg.Properties[PropertyDeliveryCount] = int64(d.count)
+	msg.SetRaw(d)
+	return msg, nil
+}
+
+func (sub *subscriber) Ack(ctx context.Context, msg *gokyu.Message) error {
+	s := sub.sim
+	d, ok := msg.Raw().(*delivery)
+	if !ok {
+		return gokyu.ErrAckFailed
+	}
+	if err := s.fault(EventAckError, s.cfg.Faults.AckErrorRate); err != nil {
+		// The broker never saw the ack, so the message reappears once its lock expires
+		s.record(EventAckError, d, err)
+		s.requeue(d, s.cfg.LockDuration)
+		return gokyu.WrapError(gokyu.ErrAckFailed, err)
+	}
+	s.record(EventAck, d, nil)
+	return nil
+}
+
+func (sub *subscriber) Nack(ctx context.Context, msg *gokyu.Message) error {
+	s := sub.sim
+	d, ok := msg.Raw().(*delivery)
+	if !ok {
+		return gokyu.ErrAckFailed
+	}
+	s.record(EventNack, d, nil)
+	s.requeue(d, s.cfg.RedeliveryDelay)
+	return nil
+}
+
+func (sub *subscriber) Close(ctx context.Context) error { return nil }
+
+type publisher struct {
+	sim *Simulation
+}
+
+func (p *publisher) Publish(ctx context.Context, msg *gokyu.Message) error {
+	s := p.sim
+	d := &delivery{id: msg.ID}
+	if err := s.fault(EventPublishError, s.cfg.Faults.PublishErrorRate); err != nil {
+		s.record(EventPublishError, d, err)
+		return gokyu.WrapError(gokyu.ErrPublishFailed, err)
+	}
+	s.published = append(s.published, msg)
+	s.record(EventPublish, d, nil)
+	return nil
+}
+
+func (p *publisher) Close(ctx context.Context) error { return nil }
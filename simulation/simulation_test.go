@@ -0,0 +1,111 @@
+package simulation
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+)
+
+func TestSimulation_RetriesUntilSuccess(t *testing.T) {
+	sim := New(Config{RedeliveryDelay: 5 * time.Second})
+	sim.Enqueue(gokyu.NewMessage([]byte("a")))
+	sim.EnqueueAt(sim.Now().Add(time.Second), gokyu.NewMessage([]byte("b")))
+
+	failures := map[string]int{"m1": 2}
+	trace, err := sim.Run(context.Background(), func(ctx context.Context, msg *gokyu.Message) error {
+		if failures[msg.ID] > 0 {
+			failures[msg.ID]--
+			return errors.New("boom")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	want := "" +
+		"00:00:00.000 receive       m1#1\n" +
+		"00:00:00.000 nack          m1#1\n" +
+		"00:00:01.000 receive       m2#1\n" +
+		"00:00:01.000 ack           m2#1\n" +
+		"00:00:05.000 receive       m1#2\n" +
+		"00:00:05.000 nack          m1#2\n" +
+		"00:00:10.000 receive       m1#3\n" +
+		"00:00:10.000 ack           m1#3\n"
+	if got := trace.String(); got != want {
+		t.Errorf("unexpected trace:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestSimulation_DeadLettersAfterMaxDeliveries(t *testing.T) {
+	sim := New(Config{MaxDeliveries: 3})
+	sim.Enqueue(gokyu.NewMessage([]byte("poison")))
+
+	var counts []int64
+	_, err := sim.Run(context.Background(), func(ctx context.Context, msg *gokyu.Message) error {
+		counts = append(counts, msg.Properties[PropertyDeliveryCount].(int64))
+		return errors.New("cannot handle")
+	})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if len(counts) != 3 || counts[2] != 3 {
+		t.Errorf("expected deliveries 1..3, got %v", counts)
+	}
+	if len(sim.DeadLettered()) != 1 {
+		t.Errorf("expected 1 dead-lettered message, got %d", len(sim.DeadLettered()))
+	}
+}
+
+func TestSimulation_DeterministicFaults(t *testing.T) {
+	run := func(seed int64) string {
+		sim := New(Config{
+			Seed:            seed,
+			HandlerDuration: func(*gokyu.Message) time.Duration { return 100 * time.Millisecond },
+			Faults:          Faults{ReceiveErrorRate: 0.2, AckErrorRate: 0.3, PublishErrorRate: 0.2},
+		})
+		for i := 0; i < 20; i++ {
+			sim.Enqueue(gokyu.NewMessage([]byte("x")))
+		}
+		pub := sim.Publisher()
+		trace, err := sim.Run(context.Background(), func(ctx context.Context, msg *gokyu.Message) error {
+			return pub.Publish(ctx, gokyu.NewMessage(msg.Body))
+		})
+		if err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		return trace.String()
+	}
+
+	first := run(7)
+	if second := run(7); second != first {
+		t.Errorf("expected identical traces for the same seed:\n%s\nvs\n%s", first, second)
+	}
+	if other := run(8); other == first {
+		t.Error("expected different traces for different seeds")
+	}
+}
+
+func TestSimulation_FailNext(t *testing.T) {
+	sim := New(Config{LockDuration: time.Minute})
+	sim.Enqueue(gokyu.NewMessage([]byte("a")))
+	sim.FailNext(EventAckError, errors.New("link detached"))
+
+	trace, err := sim.Run(context.Background(), func(ctx context.Context, msg *gokyu.Message) error { return nil })
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	want := "" +
+		"00:00:00.000 receive       m1#1\n" +
+		"00:00:00.000 ack-error     m1#1 err=link detached\n" +
+		"00:01:00.000 receive       m1#2\n" +
+		"00:01:00.000 ack           m1#2\n"
+	if got := trace.String(); got != want {
+		t.Errorf("unexpected trace:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,225 @@
+package gokyu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrNotLeader indicates a message was settled by a singleton subscriber
+// that is not the leader.
+var ErrNotLeader = errors.New("gokyu: not the leader")
+
+// SingletonOptions configures a singleton subscriber.
+type SingletonOptions struct {
+	// RenewInterval is how often the lock is renewed by the leader and
+	// retried by followers (default: 10s). Keep it at most a third of the
+	// lock's lease duration.
+	RenewInterval time.Duration
+
+	// OnLeadership is called when this instance becomes the leader (true)
+	// or loses leadership (false).
+	OnLeadership func(leader bool)
+
+	// Clock is the time source (default: SystemClock).
+	Clock Clock
+}
+
+// NewSingletonSubscriber returns a subscriber that consumes on at most one
+// instance of a deployment at a time: the holder of lock. Receive blocks
+// until this instance acquires the lock, then opens a subscriber with open
+// and receives from it while renewing the lock in the background. If a
+// renewal fails, the inner subscriber is closed, which releases its
+// unsettled messages, and Receive waits for leadership again; another
+// instance takes over once the lease expires, e.g. when the leader dies.
+//
+// This provides strict ordering on providers without exclusive consumers.
+// A leader that stalls longer than the lease can still overlap with its
+// successor for up to RenewInterval; size the lease accordingly.
+//
+//	sub := gokyu.NewSingletonSubscriber(lock, client.NewSubscriber, gokyu.SingletonOptions{})
+//	defer sub.Close(ctx)
+func NewSingletonSubscriber(lock Lock, open func(ctx context.Context) (Subscriber, error), opts SingletonOptions) Subscriber {
+	if opts.RenewInterval <= 0 {
+		opts.RenewInterval = 10 * time.Second
+	}
+	if opts.Clock == nil {
+		opts.Clock = SystemClock
+	}
+	return &singletonSubscriber{lock: lock, open: open, opts: opts}
+}
+
+// singletonSubscriber receives only while holding a lock.
+type singletonSubscriber struct {
+	lock Lock
+	open func(ctx context.Context) (Subscriber, error)
+	opts SingletonOptions
+
+	mu     sync.Mutex
+	sub    Subscriber
+	stop   context.CancelFunc
+	done   chan struct{}
+	closed bool
+}
+
+func (s *singletonSubscriber) Receive(ctx context.Context) (*Message, error) {
+	for {
+		sub, err := s.leader(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		msg, err := sub.Receive(ctx)
+		if err == nil {
+			return msg, nil
+		}
+		s.mu.Lock()
+		lost := s.sub != sub && !s.closed
+		s.mu.Unlock()
+		if !lost || ctx.Err() != nil {
+			return nil, err
+		}
+		// Leadership was lost while receiving; wait to be elected again
+	}
+}
+
+// leader waits until this instance holds the lock and returns the inner
+// subscriber.
+func (s *singletonSubscriber) leader(ctx context.Context) (Subscriber, error) {
+	for {
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return nil, ErrClosed
+		}
+		if s.sub != nil {
+			sub := s.sub
+			s.mu.Unlock()
+			return sub, nil
+		}
+		s.mu.Unlock()
+
+		held, err := s.lock.Acquire(ctx)
+		if err == nil && held {
+			sub, err := s.open(ctx)
+			if err != nil {
+				s.lock.Release(context.Background())
+				return nil, err
+			}
+			s.elect(sub)
+			continue
+		}
+
+		timer := s.opts.Clock.NewTimer(s.opts.RenewInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C():
+		}
+	}
+}
+
+// elect installs sub as the leader's subscriber and starts renewing the lock.
+func (s *singletonSubscriber) elect(sub Subscriber) {
+	renewCtx, stop := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	s.mu.Lock()
+	s.sub, s.stop, s.done = sub, stop, done
+	s.mu.Unlock()
+
+	if s.opts.OnLeadership != nil {
+		s.opts.OnLeadership(true)
+	}
+	go s.renew(renewCtx, sub, done)
+}
+
+// renew keeps the lock until a renewal fails or renewCtx is cancelled.
+func (s *singletonSubscriber) renew(renewCtx context.Context, sub Subscriber, done chan struct{}) {
+	defer close(done)
+	for {
+		timer := s.opts.Clock.NewTimer(s.opts.RenewInterval)
+		select {
+		case <-renewCtx.Done():
+			timer.Stop()
+			return
+		case <-timer.C():
+		}
+
+		held, err := s.lock.Acquire(renewCtx)
+		if renewCtx.Err() != nil {
+			return
+		}
+		if err == nil && held {
+			continue
+		}
+
+		// Step down: without a confirmed lease another instance may lead
+		s.mu.Lock()
+		if s.sub == sub {
+			s.sub = nil
+		}
+		s.mu.Unlock()
+		sub.Close(context.Background())
+		if s.opts.OnLeadership != nil {
+			s.opts.OnLeadership(false)
+		}
+		return
+	}
+}
+
+// current returns the inner subscriber for settling a message.
+func (s *singletonSubscriber) current() (Subscriber, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.sub == nil {
+		return nil, fmt.Errorf("%w: %w", ErrAckFailed, ErrNotLeader)
+	}
+	return s.sub, nil
+}
+
+func (s *singletonSubscriber) Ack(ctx context.Context, msg *Message) error {
+	sub, err := s.current()
+	if err != nil {
+		return err
+	}
+	return sub.Ack(ctx, msg)
+}
+
+func (s *singletonSubscriber) Nack(ctx context.Context, msg *Message) error {
+	sub, err := s.current()
+	if err != nil {
+		return err
+	}
+	return sub.Nack(ctx, msg)
+}
+
+// Close stops consuming and releases the lock, so another instance can take
+// over immediately.
+func (s *singletonSubscriber) Close(ctx context.Context) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	sub, stop, done := s.sub, s.stop, s.done
+	s.sub = nil
+	s.mu.Unlock()
+
+	if stop != nil {
+		stop()
+		<-done
+	}
+	if sub == nil {
+		return nil
+	}
+	err := sub.Close(ctx)
+	if rerr := s.lock.Release(ctx); err == nil {
+		err = rerr
+	}
+	return err
+}
@@ -0,0 +1,196 @@
+package gokyu
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sharedLock is an in-memory lock shared by the owners of a test.
+type sharedLock struct {
+	mu    *sync.Mutex
+	owner *string
+	me    string
+}
+
+func newSharedLocks(owners ...string) []*sharedLock {
+	mu, owner := &sync.Mutex{}, new(string)
+	locks := make([]*sharedLock, len(owners))
+	for i, me := range owners {
+		locks[i] = &sharedLock{mu: mu, owner: owner, me: me}
+	}
+	return locks
+}
+
+func (l *sharedLock) Acquire(ctx context.Context) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if *l.owner == "" {
+		*l.owner = l.me
+	}
+	return *l.owner == l.me, nil
+}
+
+func (l *sharedLock) Release(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if *l.owner == l.me {
+		*l.owner = ""
+	}
+	return nil
+}
+
+// steal hands the lock to another owner, as if our lease had expired.
+func (l *sharedLock) steal(owner string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	*l.owner = owner
+}
+
+// chanSubscriber receives from a channel until closed.
+type chanSubscriber struct {
+	msgs   chan *Message
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newChanSubscriber(msgs chan *Message) *chanSubscriber {
+	return &chanSubscriber{msgs: msgs, closed: make(chan struct{})}
+}
+
+func (s *chanSubscriber) Receive(ctx context.Context) (*Message, error) {
+	select {
+	case msg := <-s.msgs:
+		return msg, nil
+	case <-s.closed:
+		return nil, ErrClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (s *chanSubscriber) Ack(ctx context.Context, msg *Message) error  { return nil }
+func (s *chanSubscriber) Nack(ctx context.Context, msg *Message) error { return nil }
+func (s *chanSubscriber) Close(ctx context.Context) error {
+	s.once.Do(func() { close(s.closed) })
+	return nil
+}
+
+// waitForTimers waits until n timers are pending on clock.
+func waitForTimers(t *testing.T, clock *FakeClock, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for clock.Timers() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d pending timers, got %d", n, clock.Timers())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSingletonSubscriber_Failover(t *testing.T) {
+	clock := NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	locks := newSharedLocks("a", "b")
+	aMsgs, bMsgs := make(chan *Message, 1), make(chan *Message, 1)
+
+	var mu sync.Mutex
+	var changes []bool
+	opts := SingletonOptions{RenewInterval: time.Second, Clock: clock}
+	a := NewSingletonSubscriber(locks[0], func(ctx context.Context) (Subscriber, error) {
+		return newChanSubscriber(aMsgs), nil
+	}, SingletonOptions{
+		RenewInterval: time.Second,
+		Clock:         clock,
+		OnLeadership: func(leader bool) {
+			mu.Lock()
+			defer mu.Unlock()
+			changes = append(changes, leader)
+		},
+	})
+	b := NewSingletonSubscriber(locks[1], func(ctx context.Context) (Subscriber, error) {
+		return newChanSubscriber(bMsgs), nil
+	}, opts)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	aMsgs <- NewMessage([]byte("first"))
+	if msg, err := a.Receive(ctx); err != nil || string(msg.Body) != "first" {
+		t.Fatalf("expected leader a to receive, got %v, %v", msg, err)
+	}
+
+	bDone := make(chan *Message, 1)
+	go func() {
+		msg, _ := b.Receive(ctx)
+		bDone <- msg
+	}()
+	waitForTimers(t, clock, 2) // a renewing, b waiting for the lock
+
+	aDone := make(chan error, 1)
+	go func() {
+		_, err := a.Receive(ctx)
+		aDone <- err
+	}()
+
+	// a loses its lease to b; both notice on their next attempt
+	locks[0].steal("b")
+	clock.Advance(time.Second)
+
+	bMsgs <- NewMessage([]byte("second"))
+	select {
+	case msg := <-bDone:
+		if string(msg.Body) != "second" {
+			t.Errorf("expected b to receive after failover, got %q", msg.Body)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected b to receive after failover")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		mu.Lock()
+		n := len(changes)
+		mu.Unlock()
+		if n == 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	mu.Lock()
+	if len(changes) != 2 || !changes[0] || changes[1] {
+		t.Errorf("expected leadership gained then lost, got %v", changes)
+	}
+	mu.Unlock()
+	if err := a.Ack(ctx, NewMessage(nil)); !errors.Is(err, ErrNotLeader) {
+		t.Errorf("expected ErrNotLeader from the former leader, got %v", err)
+	}
+
+	cancel()
+	<-aDone
+	b.Close(context.Background())
+	a.Close(context.Background())
+}
+
+func TestSingletonSubscriber_CloseReleasesLock(t *testing.T) {
+	locks := newSharedLocks("a", "b")
+	msgs := make(chan *Message, 1)
+	a := NewSingletonSubscriber(locks[0], func(ctx context.Context) (Subscriber, error) {
+		return newChanSubscriber(msgs), nil
+	}, SingletonOptions{})
+
+	msgs <- NewMessage(nil)
+	if _, err := a.Receive(context.Background()); err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	if err := a.Close(context.Background()); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if held, _ := locks[1].Acquire(context.Background()); !held {
+		t.Error("expected lock released on Close")
+	}
+	if _, err := a.Receive(context.Background()); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed after Close, got %v", err)
+	}
+}
@@ -0,0 +1,211 @@
+package gokyu
+
+import (
+	"bytes"
+	"context"
+	"runtime/pprof"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Metric names recorded by the slow-handler subscriber.
+const (
+	// MetricHandlerDuration is the histogram of time from Receive to Ack or
+	// Nack, in seconds.
+	MetricHandlerDuration = "gokyu_handler_duration_seconds"
+
+	// MetricSlowHandlers counts messages whose handling exceeded the threshold.
+	MetricSlowHandlers = "gokyu_slow_handlers_total"
+)
+
+// labelMessageID is the goroutine label set on the goroutine that received a
+// message, used to find the slow handler in a goroutine dump.
+const labelMessageID = "gokyu_message_id"
+
+// SlowHandler describes a message whose handling exceeded the threshold.
+type SlowHandler struct {
+	// Message is the message still being handled.
+	Message *Message
+
+	// Elapsed is the time since the message was received.
+	Elapsed time.Duration
+
+	// Stack is the goroutine dump of the handler, if CaptureStack is set.
+	// If the handler goroutine cannot be identified, it holds all goroutines.
+	Stack []byte
+}
+
+// SlowHandlerOptions configures a slow-handler detecting subscriber.
+type SlowHandlerOptions struct {
+	// Threshold is the handling time after which a message is reported as
+	// slow. Set it well below the broker's lock duration.
+	Threshold time.Duration
+
+	// OnSlow is called once per slow message, while it is still being handled.
+	OnSlow func(SlowHandler)
+
+	// CaptureStack captures the goroutine dump of the slow handler for OnSlow.
+	CaptureStack bool
+
+	// Metrics records MetricHandlerDuration and MetricSlowHandlers.
+	Metrics Metrics
+
+	// Clock is the time source (default: SystemClock).
+	Clock Clock
+}
+
+// NewSlowHandlerSubscriber wraps a subscriber to measure how long each
+// message is handled, from Receive until Ack or Nack, and to report handlers
+// that exceed opts.Threshold while they are still running.
+//
+// Receive labels the calling goroutine with the message ID, in addition to
+// the labels of its context, so the handler should run on the goroutine that
+// called Receive, or one started by it, for stack capture to find it. Ack,
+// Nack and the next Receive restore the labels of the goroutine to those of
+// the context passed to Receive, as pprof.Do does on return.
+func NewSlowHandlerSubscriber(sub Subscriber, opts SlowHandlerOptions) Subscriber {
+	if opts.Metrics == nil {
+		opts.Metrics = NopMetrics{}
+	}
+	if opts.Clock == nil {
+		opts.Clock = SystemClock
+	}
+	return &slowHandlerSubscriber{
+		Subscriber: sub,
+		opts:       opts,
+		inFlight:   make(map[*Message]*handling),
+	}
+}
+
+// slowHandlerSubscriber tracks in-flight messages.
+type slowHandlerSubscriber struct {
+	Subscriber
+	opts SlowHandlerOptions
+
+	mu       sync.Mutex
+	inFlight map[*Message]*handling
+}
+
+// handling is a message being handled.
+type handling struct {
+	received time.Time
+	labels   context.Context // the labels to restore on settle
+	done     chan struct{}
+}
+
+func (s *slowHandlerSubscriber) Receive(ctx context.Context) (*Message, error) {
+	// Drop the label of the message received last on this goroutine
+	pprof.SetGoroutineLabels(ctx)
+
+	msg, err := s.Subscriber.Receive(ctx)
+	if err != nil {
+		return msg, err
+	}
+
+	h := &handling{received: s.opts.Clock.Now(), labels: ctx, done: make(chan struct{})}
+	s.mu.Lock()
+	s.inFlight[msg] = h
+	s.mu.Unlock()
+
+	if s.opts.Threshold > 0 {
+		go s.watch(msg, h)
+	}
+	// Labelled after starting the watcher, which would inherit the label
+	pprof.SetGoroutineLabels(pprof.WithLabels(ctx, pprof.Labels(labelMessageID, msg.ID)))
+	return msg, nil
+}
+
+// watch reports msg as slow if it is not settled within the threshold.
+func (s *slowHandlerSubscriber) watch(msg *Message, h *handling) {
+	timer := s.opts.Clock.NewTimer(s.opts.Threshold)
+	defer timer.Stop()
+
+	select {
+	case <-h.done:
+		return
+	case <-timer.C():
+	}
+
+	s.opts.Metrics.IncCounter(MetricSlowHandlers, nil, 1)
+	if s.opts.OnSlow == nil {
+		return
+	}
+
+	report := SlowHandler{Message: msg, Elapsed: s.opts.Clock.Now().Sub(h.received)}
+	if s.opts.CaptureStack {
+		report.Stack = handlerStack(msg.ID)
+	}
+	s.opts.OnSlow(report)
+}
+
+// settled records the handling duration of msg.
+func (s *slowHandlerSubscriber) settled(msg *Message) {
+	s.mu.Lock()
+	h, ok := s.inFlight[msg]
+	delete(s.inFlight, msg)
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	close(h.done)
+	pprof.SetGoroutineLabels(h.labels)
+	elapsed := s.opts.Clock.Now().Sub(h.received)
+	s.opts.Metrics.ObserveHistogram(MetricHandlerDuration, nil, elapsed.Seconds())
+}
+
+func (s *slowHandlerSubscriber) Ack(ctx context.Context, msg *Message) error {
+	s.settled(msg)
+	return s.Subscriber.Ack(ctx, msg)
+}
+
+func (s *slowHandlerSubscriber) Nack(ctx context.Context, msg *Message) error {
+	s.settled(msg)
+	return s.Subscriber.Nack(ctx, msg)
+}
+
+// Close stops watching the messages still in flight and closes the
+// subscriber.
+func (s *slowHandlerSubscriber) Close(ctx context.Context) error {
+	s.mu.Lock()
+	pending := s.inFlight
+	s.inFlight = make(map[*Message]*handling)
+	s.mu.Unlock()
+
+	for _, h := range pending {
+		close(h.done)
+	}
+	return s.Subscriber.Close(ctx)
+}
+
+// handlerStack returns the goroutine dump entries labelled with the message
+// ID, among any other labels, or the full dump if none match.
+func handlerStack(id string) []byte {
+	var buf bytes.Buffer
+	pprof.Lookup("goroutine").WriteTo(&buf, 1)
+
+	label := []byte(strconv.Quote(labelMessageID) + ":" + strconv.Quote(id))
+
+	var matched [][]byte
+	for _, entry := range bytes.Split(buf.Bytes(), []byte("\n\n")) {
+		if labelled(entry, label) {
+			matched = append(matched, entry)
+		}
+	}
+	if len(matched) == 0 {
+		return buf.Bytes()
+	}
+	return append(bytes.Join(matched, []byte("\n\n")), '\n')
+}
+
+// labelled reports whether the labels line of a goroutine dump entry
+// contains label, a quoted key and value.
+func labelled(entry, label []byte) bool {
+	for _, line := range bytes.Split(entry, []byte("\n")) {
+		if rest, ok := bytes.CutPrefix(line, []byte("# labels: ")); ok {
+			return bytes.Contains(rest, label)
+		}
+	}
+	return false
+}
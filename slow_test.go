@@ -0,0 +1,111 @@
+package gokyu
+
+import (
+	"bytes"
+	"context"
+	"runtime/pprof"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSlowHandlerSubscriber(t *testing.T) {
+	metrics := newCountingMetrics()
+	reports := make(chan SlowHandler, 1)
+
+	slow := NewMessage([]byte("slow"))
+	slow.ID = "slow-1"
+	fast := NewMessage([]byte("fast"))
+	fast.ID = "fast-1"
+
+	sub := NewSlowHandlerSubscriber(&stubSubscriber{msgs: []*Message{fast, slow}}, SlowHandlerOptions{
+		Threshold:    20 * time.Millisecond,
+		OnSlow:       func(r SlowHandler) { reports <- r },
+		CaptureStack: true,
+		Metrics:      metrics,
+	})
+
+	msg, _ := sub.Receive(context.Background())
+	sub.Ack(context.Background(), msg)
+
+	msg, _ = sub.Receive(context.Background())
+	var report SlowHandler
+	select {
+	case report = <-reports:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for slow handler report")
+	}
+	sub.Nack(context.Background(), msg)
+
+	if report.Message.ID != "slow-1" || report.Elapsed < 20*time.Millisecond {
+		t.Errorf("unexpected report for %s after %v", report.Message.ID, report.Elapsed)
+	}
+	if !bytes.Contains(report.Stack, []byte("TestSlowHandlerSubscriber")) {
+		t.Errorf("expected stack of the handler goroutine, got:\n%s", report.Stack)
+	}
+	if !bytes.Contains(report.Stack, []byte(`"gokyu_message_id":"slow-1"`)) {
+		t.Errorf("expected only the labelled goroutine, got:\n%s", report.Stack)
+	}
+	if metrics.counters[MetricSlowHandlers] != 1 {
+		t.Errorf("expected 1 slow handler, got %v", metrics.counters[MetricSlowHandlers])
+	}
+	if len(metrics.histograms[MetricHandlerDuration]) != 2 {
+		t.Errorf("expected 2 handler durations, got %v", metrics.histograms[MetricHandlerDuration])
+	}
+}
+
+// labelledGoroutines returns the number of goroutines labelled with the ID.
+func labelledGoroutines(id string) int {
+	var buf bytes.Buffer
+	pprof.Lookup("goroutine").WriteTo(&buf, 1)
+	label := []byte(strconv.Quote(labelMessageID) + ":" + strconv.Quote(id))
+	n := 0
+	for _, entry := range bytes.Split(buf.Bytes(), []byte("\n\n")) {
+		if labelled(entry, label) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestSlowHandlerSubscriber_Labels(t *testing.T) {
+	reports := make(chan SlowHandler, 1)
+	msg := NewMessage(nil)
+	msg.ID = "labelled-1"
+	sub := NewSlowHandlerSubscriber(&stubSubscriber{msgs: []*Message{msg}}, SlowHandlerOptions{
+		Threshold:    10 * time.Millisecond,
+		OnSlow:       func(r SlowHandler) { reports <- r },
+		CaptureStack: true,
+	})
+
+	pprof.Do(context.Background(), pprof.Labels("worker", "billing"), func(ctx context.Context) {
+		got, _ := sub.Receive(ctx)
+		report := <-reports
+		if !bytes.Contains(report.Stack, []byte(`"worker":"billing"`)) || labelledGoroutines("labelled-1") != 1 {
+			t.Errorf("expected the handler goroutine with both labels, got:\n%s", report.Stack)
+		}
+		if bytes.Contains(report.Stack, []byte("\n\n")) {
+			t.Errorf("expected only the labelled goroutine, got several:\n%s", report.Stack)
+		}
+
+		sub.Ack(ctx, got)
+		if n := labelledGoroutines("labelled-1"); n != 0 {
+			t.Errorf("%d goroutines still labelled after Ack", n)
+		}
+		if v, _ := pprof.Label(ctx, "worker"); v != "billing" {
+			t.Errorf("worker label = %q after Ack", v)
+		}
+	})
+}
+
+func TestSlowHandlerSubscriber_Close(t *testing.T) {
+	msg := NewMessage(nil)
+	msg.ID = "unsettled-1"
+	sub := NewSlowHandlerSubscriber(&stubSubscriber{msgs: []*Message{msg}}, SlowHandlerOptions{Threshold: time.Hour})
+	sub.Receive(context.Background())
+	sub.Close(context.Background())
+
+	if n := len(sub.(*slowHandlerSubscriber).inFlight); n != 0 {
+		t.Errorf("%d messages in flight after Close", n)
+	}
+}
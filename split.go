@@ -0,0 +1,252 @@
+package gokyu
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// Properties set on the messages handed out by a splitter.
+const (
+	// PropertyPartIndex is the zero-based position of the message in the
+	// broker message it was split from.
+	PropertyPartIndex = "gokyu-part-index"
+
+	// PropertyPartCount is the number of messages in that broker message.
+	PropertyPartCount = "gokyu-part-count"
+
+	// PropertyPartOf is the ID of that broker message, if it has one.
+	PropertyPartOf = "gokyu-part-of"
+)
+
+// SplitterOptions configures NewSplitter.
+type SplitterOptions struct {
+	// JSONArrays also splits application/json messages whose body is an
+	// array, handing out each element as an application/json message with
+	// the properties of the array message.
+	JSONArrays bool
+
+	// DeadLetter receives the parts that are nacked, with a FailureRecord
+	// and the part properties, so the rest of the broker message can still
+	// be acknowledged. If nil, a nacked part skips the rest of its broker
+	// message and the broker message is nacked.
+	DeadLetter Publisher
+
+	// Clock is the time source for failure records (default: SystemClock).
+	Clock Clock
+}
+
+// NewBatchSplitter wraps a subscriber to unpack batch envelopes published
+// by a BatchingPublisher. It is NewSplitter with default options.
+func NewBatchSplitter(sub Subscriber) Subscriber {
+	return NewSplitter(sub, SplitterOptions{})
+}
+
+// NewSplitter wraps a subscriber to split broker messages holding several
+// logical messages, batch envelopes and optionally JSON arrays, into
+// individual messages for the handler:
+//
+//	sub = gokyu.NewSplitter(sub, gokyu.SplitterOptions{
+//	    JSONArrays: true,
+//	    DeadLetter: dlqPublisher,
+//	})
+//
+// Receive returns the parts of a broker message one at a time, with
+// PropertyPartIndex and PropertyPartCount set, and the broker message is
+// acknowledged only once all of its parts have been settled. A nacked part
+// is published to opts.DeadLetter if set; otherwise the remaining parts are
+// skipped and the broker message is nacked, so the whole batch is
+// redelivered. Other messages pass through unchanged.
+func NewSplitter(sub Subscriber, opts SplitterOptions) Subscriber {
+	if opts.Clock == nil {
+		opts.Clock = SystemClock
+	}
+	return &splitter{Subscriber: sub, opts: opts}
+}
+
+// splitter hands out the parts of broker messages.
+type splitter struct {
+	Subscriber
+	opts SplitterOptions
+
+	mu      sync.Mutex
+	pending []*Message
+}
+
+// receivedBatch tracks the settlement of a broker message's parts.
+type receivedBatch struct {
+	envelope    *Message
+	unsettled   int // parts handed out and not yet settled
+	undelivered int // parts not yet handed out
+	failed      bool
+}
+
+// batchPart is the raw value of a message split from a broker message.
+type batchPart struct {
+	batch *receivedBatch
+}
+
+func (s *splitter) Receive(ctx context.Context) (*Message, error) {
+	for {
+		if msg := s.next(); msg != nil {
+			return msg, nil
+		}
+
+		msg, err := s.Subscriber.Receive(ctx)
+		if err != nil {
+			return msg, err
+		}
+		parts, ok := s.split(msg)
+		if !ok {
+			// Not splittable, or malformed: the handler's failure
+			// dead-letters it like any other message
+			return msg, nil
+		}
+		if len(parts) == 0 {
+			if err := s.Subscriber.Ack(ctx, msg); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		batch := &receivedBatch{envelope: msg, undelivered: len(parts)}
+		for i, part := range parts {
+			part.Properties[PropertyPartIndex] = int64(i)
+			part.Properties[PropertyPartCount] = int64(len(parts))
+			if msg.ID != "" {
+				part.Properties[PropertyPartOf] = msg.ID
+			}
+			part.SetRaw(&batchPart{batch: batch})
+		}
+		s.mu.Lock()
+		s.pending = append(s.pending, parts...)
+		s.mu.Unlock()
+	}
+}
+
+// split returns the parts of msg, or false if it is not split.
+func (s *splitter) split(msg *Message) ([]*Message, bool) {
+	switch {
+	case msg.ContentType == ContentTypeBatch:
+		parts, err := DecodeBatch(msg)
+		return parts, err == nil
+	case s.opts.JSONArrays && msg.ContentType == ContentTypeJSON && bytes.HasPrefix(bytes.TrimSpace(msg.Body), []byte("[")):
+		var elems []json.RawMessage
+		if err := json.Unmarshal(msg.Body, &elems); err != nil {
+			return nil, false
+		}
+		parts := make([]*Message, len(elems))
+		for i, elem := range elems {
+			part := NewMessage(elem)
+			part.ContentType = ContentTypeJSON
+			part.PartitionKey = msg.PartitionKey
+			part.Priority = msg.Priority
+			part.EnqueuedTime = msg.EnqueuedTime
+			part.Receiver = msg.Receiver
+			for k, v := range msg.Properties {
+				part.Properties[k] = v
+			}
+			parts[i] = part
+		}
+		return parts, true
+	}
+	return nil, false
+}
+
+// next returns the next pending part, skipping parts of failed batches.
+func (s *splitter) next() *Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.pending) > 0 {
+		msg := s.pending[0]
+		s.pending = s.pending[1:]
+		batch := msg.Raw().(*batchPart).batch
+		batch.undelivered--
+		if !batch.failed {
+			batch.unsettled++
+			return msg
+		}
+	}
+	return nil
+}
+
+func (s *splitter) Ack(ctx context.Context, msg *Message) error {
+	return s.settle(ctx, msg, false)
+}
+
+// Nack dead-letters a part if opts.DeadLetter is set, and otherwise fails
+// its broker message.
+func (s *splitter) Nack(ctx context.Context, msg *Message) error {
+	return s.settle(ctx, msg, true)
+}
+
+// settle records the outcome of a part and settles its broker message once
+// the outcome of all parts is known.
+func (s *splitter) settle(ctx context.Context, msg *Message, failed bool) error {
+	part, ok := msg.Raw().(*batchPart)
+	if !ok {
+		if failed {
+			return s.Subscriber.Nack(ctx, msg)
+		}
+		return s.Subscriber.Ack(ctx, msg)
+	}
+
+	var deadLetterErr error
+	if failed && s.opts.DeadLetter != nil {
+		if deadLetterErr = s.deadLetter(ctx, msg); deadLetterErr == nil {
+			failed = false
+		}
+	}
+
+	s.mu.Lock()
+	batch := part.batch
+	msg.SetRaw(nil) // settle each part once
+	batch.unsettled--
+	if failed && !batch.failed {
+		batch.failed = true
+		s.dropPending(batch)
+	}
+	done := batch.unsettled == 0 && batch.undelivered == 0
+	s.mu.Unlock()
+
+	if !done {
+		return deadLetterErr
+	}
+	var err error
+	if batch.failed {
+		err = s.Subscriber.Nack(ctx, batch.envelope)
+	} else {
+		err = s.Subscriber.Ack(ctx, batch.envelope)
+	}
+	if deadLetterErr != nil {
+		return deadLetterErr
+	}
+	return err
+}
+
+// deadLetter publishes a nacked part to opts.DeadLetter.
+func (s *splitter) deadLetter(ctx context.Context, msg *Message) error {
+	reason := fmt.Errorf("gokyu: part %v of %v nacked", msg.Properties[PropertyPartIndex], msg.Properties[PropertyPartCount])
+	record := NewFailureRecord(msg, reason, "splitter", 1, s.opts.Clock.Now())
+	dead, err := NewDeadLetterMessage(msg, record)
+	if err != nil {
+		return err
+	}
+	return s.opts.DeadLetter.Publish(ctx, dead)
+}
+
+// dropPending removes the undelivered parts of a failed batch. The caller
+// holds s.mu.
+func (s *splitter) dropPending(batch *receivedBatch) {
+	kept := s.pending[:0]
+	for _, msg := range s.pending {
+		if msg.Raw().(*batchPart).batch == batch {
+			batch.undelivered--
+			continue
+		}
+		kept = append(kept, msg)
+	}
+	s.pending = kept
+}
@@ -0,0 +1,144 @@
+package gokyu
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestBatchSplitter(t *testing.T) {
+	ok, _ := EncodeBatch([]*Message{NewMessage([]byte("a")), NewMessage([]byte("b"))})
+	failing, _ := EncodeBatch([]*Message{NewMessage([]byte("c")), NewMessage([]byte("d")), NewMessage([]byte("e"))})
+	plain := NewMessage([]byte("plain"))
+	inner := &stubSubscriber{msgs: []*Message{ok, failing, plain}}
+	sub := NewBatchSplitter(inner)
+	ctx := context.Background()
+
+	receive := func() *Message {
+		t.Helper()
+		msg, err := sub.Receive(ctx)
+		if err != nil {
+			t.Fatalf("Receive() error = %v", err)
+		}
+		return msg
+	}
+
+	a, b := receive(), receive()
+	if string(a.Body) != "a" || string(b.Body) != "b" {
+		t.Fatalf("unexpected parts %q %q", a.Body, b.Body)
+	}
+	sub.Ack(ctx, a)
+	if len(inner.acked) != 0 {
+		t.Error("envelope acked before all parts were settled")
+	}
+	sub.Ack(ctx, b)
+	if len(inner.acked) != 1 || inner.acked[0] != ok {
+		t.Errorf("expected the envelope to be acked, got %v", inner.acked)
+	}
+
+	// A failed part skips the rest of its batch and nacks the envelope
+	c := receive()
+	sub.Nack(ctx, c)
+	if len(inner.nacked) != 1 || inner.nacked[0] != failing {
+		t.Errorf("expected the failing envelope to be nacked, got %v", inner.nacked)
+	}
+
+	if msg := receive(); msg != plain {
+		t.Errorf("expected the plain message to pass through, got %q", msg.Body)
+	}
+	sub.Ack(ctx, plain)
+	if len(inner.acked) != 2 || inner.acked[1] != plain {
+		t.Errorf("expected the plain message to be acked, got %v", inner.acked)
+	}
+}
+
+func TestSplitter_JSONArrays(t *testing.T) {
+	array := NewMessage([]byte(`[{"id":1}, {"id":2}]`))
+	array.ID = "orders-export"
+	array.ContentType = ContentTypeJSON
+	array.Properties["source"] = "export"
+	object := NewMessage([]byte(`{"id":3}`))
+	object.ContentType = ContentTypeJSON
+	inner := &stubSubscriber{msgs: []*Message{array, object}}
+	sub := NewSplitter(inner, SplitterOptions{JSONArrays: true})
+	ctx := context.Background()
+
+	for i, want := range []string{`{"id":1}`, `{"id":2}`} {
+		msg, err := sub.Receive(ctx)
+		if err != nil {
+			t.Fatalf("Receive() error = %v", err)
+		}
+		if string(msg.Body) != want || msg.ContentType != ContentTypeJSON {
+			t.Errorf("part %d = %s %q, want %s", i, msg.ContentType, msg.Body, want)
+		}
+		if msg.Properties[PropertyPartIndex] != int64(i) || msg.Properties[PropertyPartCount] != int64(2) {
+			t.Errorf("part %d properties = %v", i, msg.Properties)
+		}
+		if msg.Properties[PropertyPartOf] != "orders-export" || msg.Properties["source"] != "export" {
+			t.Errorf("part %d properties = %v", i, msg.Properties)
+		}
+		sub.Ack(ctx, msg)
+	}
+	if len(inner.acked) != 1 || inner.acked[0] != array {
+		t.Errorf("expected the array message to be acked, got %v", inner.acked)
+	}
+
+	if msg, _ := sub.Receive(ctx); msg != object {
+		t.Errorf("expected a JSON object to pass through, got %q", msg.Body)
+	}
+}
+
+func TestSplitter_DeadLetter(t *testing.T) {
+	envelope, _ := EncodeBatch([]*Message{NewMessage([]byte("a")), NewMessage([]byte("b")), NewMessage([]byte("c"))})
+	envelope.ID = "env-1"
+	inner := &stubSubscriber{msgs: []*Message{envelope}}
+	dlq := &envelopePublisher{}
+	sub := NewSplitter(inner, SplitterOptions{DeadLetter: dlq})
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		msg, err := sub.Receive(ctx)
+		if err != nil {
+			t.Fatalf("Receive() error = %v", err)
+		}
+		if string(msg.Body) == "b" {
+			if err := sub.Nack(ctx, msg); err != nil {
+				t.Errorf("Nack() error = %v", err)
+			}
+			continue
+		}
+		sub.Ack(ctx, msg)
+	}
+
+	if len(inner.acked) != 1 || len(inner.nacked) != 0 {
+		t.Errorf("expected the envelope to be acked, got acked=%d nacked=%d", len(inner.acked), len(inner.nacked))
+	}
+	dead := dlq.published()
+	if len(dead) != 1 || string(dead[0].Body) != "b" {
+		t.Fatalf("expected part b dead-lettered, got %v", dead)
+	}
+	if dead[0].Properties[PropertyPartIndex] != int64(1) || dead[0].Properties[PropertyPartOf] != "env-1" {
+		t.Errorf("dead letter properties = %v", dead[0].Properties)
+	}
+	record, ok, err := ReadFailureRecord(dead[0])
+	if !ok || err != nil || record.Reason != "gokyu: part 1 of 3 nacked" {
+		t.Errorf("ReadFailureRecord() = %+v, %v, %v", record, ok, err)
+	}
+}
+
+func TestSplitter_DeadLetterFails(t *testing.T) {
+	envelope, _ := EncodeBatch([]*Message{NewMessage([]byte("a")), NewMessage([]byte("b"))})
+	inner := &stubSubscriber{msgs: []*Message{envelope}}
+	dlq := &envelopePublisher{err: errors.New("dlq down")}
+	sub := NewSplitter(inner, SplitterOptions{DeadLetter: dlq})
+	ctx := context.Background()
+
+	msg, _ := sub.Receive(ctx)
+	if err := sub.Nack(ctx, msg); err == nil {
+		t.Error("expected the dead-letter error")
+	}
+	// The rest of the batch is skipped and the envelope redelivered
+	if len(inner.nacked) != 1 || inner.nacked[0] != envelope {
+		t.Errorf("expected the envelope to be nacked, got %v", inner.nacked)
+	}
+}
@@ -0,0 +1,194 @@
+package gokyu
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// MetricStuckMessages counts messages abandoned by the stuck-message janitor
+// because they were held in flight longer than the maximum.
+const MetricStuckMessages = "gokyu_stuck_messages_total"
+
+// ErrMessageAbandoned is returned by Ack and Nack of a message the
+// stuck-message janitor has already abandoned.
+var ErrMessageAbandoned = errors.New("gokyu: message abandoned")
+
+// StuckMessage describes a message abandoned by the stuck-message janitor.
+type StuckMessage struct {
+	// Message is the abandoned message.
+	Message *Message
+
+	// Held is the time since the message was received.
+	Held time.Duration
+
+	// Err is the error of the Nack that abandoned it, if any.
+	Err error
+}
+
+// JanitorOptions configures a stuck-message janitor.
+type JanitorOptions struct {
+	// MaxInFlight is how long a message may be held between Receive and Ack
+	// or Nack before it is abandoned. Required.
+	MaxInFlight time.Duration
+
+	// Interval is how often in-flight messages are checked (default: a
+	// quarter of MaxInFlight).
+	Interval time.Duration
+
+	// OnAbandon is called for every abandoned message, after the Nack.
+	OnAbandon func(StuckMessage)
+
+	// Metrics records MetricStuckMessages.
+	Metrics Metrics
+
+	// Clock is the time source (default: SystemClock).
+	Clock Clock
+}
+
+// WithDefaults returns a copy of the options with defaults applied.
+func (o JanitorOptions) WithDefaults() JanitorOptions {
+	if o.Interval <= 0 {
+		o.Interval = o.MaxInFlight / 4
+	}
+	if o.Metrics == nil {
+		o.Metrics = NopMetrics{}
+	}
+	if o.Clock == nil {
+		o.Clock = SystemClock
+	}
+	return o
+}
+
+// NewJanitorSubscriber wraps a subscriber with a janitor that abandons
+// messages held in flight longer than opts.MaxInFlight by nacking them, so
+// that handlers which never settle a message, e.g. after a swallowed panic
+// or a forgotten Ack on an error path, do not hold prefetch slots and broker
+// locks forever. The janitor runs until Close.
+//
+// The handler's late Ack or Nack of an abandoned message, within another
+// MaxInFlight, returns ErrMessageAbandoned without reaching the broker. Set
+// MaxInFlight above the longest legitimate handling time: unlike
+// NewSlowHandlerSubscriber, which only reports, the janitor makes the message
+// available for redelivery while its handler may still be running.
+func NewJanitorSubscriber(sub Subscriber, opts JanitorOptions) (Subscriber, error) {
+	if opts.MaxInFlight <= 0 {
+		return nil, ErrInvalidConfig("janitor MaxInFlight must be positive")
+	}
+	s := &janitorSubscriber{
+		Subscriber: sub,
+		opts:       opts.WithDefaults(),
+		inFlight:   make(map[*Message]time.Time),
+		abandoned:  make(map[*Message]time.Time),
+		stop:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+	go s.sweep()
+	return s, nil
+}
+
+// janitorSubscriber tracks when in-flight messages were received.
+type janitorSubscriber struct {
+	Subscriber
+	opts JanitorOptions
+
+	mu        sync.Mutex
+	inFlight  map[*Message]time.Time
+	abandoned map[*Message]time.Time
+
+	closeOnce sync.Once
+	stop      chan struct{}
+	stopped   chan struct{}
+}
+
+func (s *janitorSubscriber) Receive(ctx context.Context) (*Message, error) {
+	msg, err := s.Subscriber.Receive(ctx)
+	if err != nil {
+		return msg, err
+	}
+	s.mu.Lock()
+	s.inFlight[msg] = s.opts.Clock.Now()
+	s.mu.Unlock()
+	return msg, nil
+}
+
+// sweep abandons stuck messages every interval until Close.
+func (s *janitorSubscriber) sweep() {
+	defer close(s.stopped)
+	for {
+		timer := s.opts.Clock.NewTimer(s.opts.Interval)
+		select {
+		case <-s.stop:
+			timer.Stop()
+			return
+		case <-timer.C():
+		}
+		s.abandonStuck()
+	}
+}
+
+// abandonStuck nacks the messages held longer than MaxInFlight, and forgets
+// those abandoned more than MaxInFlight ago, whose handlers never returned.
+func (s *janitorSubscriber) abandonStuck() {
+	now := s.opts.Clock.Now()
+	var stuck []StuckMessage
+
+	s.mu.Lock()
+	for msg, at := range s.abandoned {
+		if now.Sub(at) >= s.opts.MaxInFlight {
+			delete(s.abandoned, msg)
+		}
+	}
+	for msg, received := range s.inFlight {
+		if held := now.Sub(received); held >= s.opts.MaxInFlight {
+			delete(s.inFlight, msg)
+			s.abandoned[msg] = now
+			stuck = append(stuck, StuckMessage{Message: msg, Held: held})
+		}
+	}
+	s.mu.Unlock()
+
+	for _, m := range stuck {
+		ctx, cancel := context.WithTimeout(context.Background(), s.opts.Interval)
+		m.Err = s.Subscriber.Nack(ctx, m.Message)
+		cancel()
+		s.opts.Metrics.IncCounter(MetricStuckMessages, nil, 1)
+		if s.opts.OnAbandon != nil {
+			s.opts.OnAbandon(m)
+		}
+	}
+}
+
+// settle stops tracking msg. It returns false if msg was abandoned.
+func (s *janitorSubscriber) settle(msg *Message) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.abandoned[msg]; ok {
+		delete(s.abandoned, msg)
+		return false
+	}
+	delete(s.inFlight, msg)
+	return true
+}
+
+func (s *janitorSubscriber) Ack(ctx context.Context, msg *Message) error {
+	if !s.settle(msg) {
+		return ErrMessageAbandoned
+	}
+	return s.Subscriber.Ack(ctx, msg)
+}
+
+func (s *janitorSubscriber) Nack(ctx context.Context, msg *Message) error {
+	if !s.settle(msg) {
+		return ErrMessageAbandoned
+	}
+	return s.Subscriber.Nack(ctx, msg)
+}
+
+// Close stops the janitor and closes the wrapped subscriber.
+func (s *janitorSubscriber) Close(ctx context.Context) error {
+	s.closeOnce.Do(func() { close(s.stop) })
+	<-s.stopped
+	return s.Subscriber.Close(ctx)
+}
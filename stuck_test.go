@@ -0,0 +1,68 @@
+package gokyu
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestJanitorSubscriber(t *testing.T) {
+	ctx := context.Background()
+	clock := NewFakeClock(time.Unix(1000, 0))
+	metrics := newCountingMetrics()
+	abandoned := make(chan StuckMessage, 1)
+
+	done, stuck := NewMessage([]byte("done")), NewMessage([]byte("stuck"))
+	stub := &stubSubscriber{msgs: []*Message{done, stuck}}
+	sub, err := NewJanitorSubscriber(stub, JanitorOptions{
+		MaxInFlight: time.Minute,
+		OnAbandon:   func(m StuckMessage) { abandoned <- m },
+		Metrics:     metrics,
+		Clock:       clock,
+	})
+	if err != nil {
+		t.Fatalf("NewJanitorSubscriber() error = %v", err)
+	}
+
+	sub.Receive(ctx)
+	sub.Receive(ctx)
+	if err := sub.Ack(ctx, done); err != nil {
+		t.Fatalf("Ack() error = %v", err)
+	}
+
+	for clock.Timers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(time.Minute)
+
+	select {
+	case m := <-abandoned:
+		if m.Message != stuck || m.Held != time.Minute || m.Err != nil {
+			t.Errorf("abandoned %q after %v (err %v)", m.Message.Body, m.Held, m.Err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the stuck message to be abandoned")
+	}
+	if len(stub.nacked) != 1 || stub.nacked[0] != stuck {
+		t.Errorf("nacked %v, want the stuck message", stub.nacked)
+	}
+	if metrics.counters[MetricStuckMessages] != 1 {
+		t.Errorf("expected 1 stuck message, got %v", metrics.counters[MetricStuckMessages])
+	}
+
+	if err := sub.Ack(ctx, stuck); !errors.Is(err, ErrMessageAbandoned) {
+		t.Errorf("late Ack() error = %v, want ErrMessageAbandoned", err)
+	}
+	if len(stub.acked) != 1 {
+		t.Errorf("late Ack reached the broker: acked %v", stub.acked)
+	}
+	if err := sub.Close(ctx); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+
+	var cfgErr *ConfigError
+	if _, err := NewJanitorSubscriber(stub, JanitorOptions{}); !errors.As(err, &cfgErr) {
+		t.Errorf("NewJanitorSubscriber() without MaxInFlight error = %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package gokyu
+
+import (
+	"context"
+	"time"
+)
+
+// RestartPolicy controls how Supervise restarts a failing loop.
+type RestartPolicy struct {
+	// InitialBackoff is the delay before the first restart (default: 1s).
+	// The delay doubles after every consecutive failure up to MaxBackoff.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the delay between restarts (default: 1m).
+	MaxBackoff time.Duration
+
+	// MaxRestarts is the number of consecutive restarts after which
+	// Supervise gives up. Zero means restart forever.
+	MaxRestarts int
+
+	// ResetAfter resets the backoff and restart count once the loop has run
+	// this long without failing (default: 1m).
+	ResetAfter time.Duration
+
+	// Permanent reports whether an error cannot be fixed by restarting,
+	// e.g. revoked credentials or a deleted entity. Supervise gives up
+	// immediately on such errors.
+	Permanent func(err error) bool
+
+	// OnRestart is called before each restart with the restart number, the
+	// error that stopped the loop and the delay before restarting.
+	OnRestart func(restart int, err error, delay time.Duration)
+
+	// OnFatal is called with the last error when Supervise gives up.
+	OnFatal func(err error)
+
+	// Clock is the time source (default: SystemClock).
+	Clock Clock
+}
+
+// Supervise runs fn and restarts it with exponential backoff whenever it
+// returns an error, instead of retrying in a hot loop. It returns nil when fn
+// returns nil or ctx is cancelled, and the last error once the policy gives up.
+//
+// fn should set up whatever it needs, typically a subscriber, and run until
+// it fails:
+//
+//	err := gokyu.Supervise(ctx, gokyu.RestartPolicy{MaxRestarts: 10}, func(ctx context.Context) error {
+//	    sub, err := client.NewSubscriber(ctx)
+//	    if err != nil {
+//	        return err
+//	    }
+//	    defer sub.Close(context.Background())
+//	    for {
+//	        msg, err := sub.Receive(ctx)
+//	        if err != nil {
+//	            return err
+//	        }
+//	        handle(ctx, sub, msg)
+//	    }
+//	})
+func Supervise(ctx context.Context, policy RestartPolicy, fn func(ctx context.Context) error) error {
+	if policy.InitialBackoff <= 0 {
+		policy.InitialBackoff = time.Second
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = time.Minute
+	}
+	if policy.ResetAfter <= 0 {
+		policy.ResetAfter = time.Minute
+	}
+	if policy.Clock == nil {
+		policy.Clock = SystemClock
+	}
+
+	backoff := policy.InitialBackoff
+	restarts := 0
+	for {
+		started := policy.Clock.Now()
+		err := fn(ctx)
+		if err == nil || ctx.Err() != nil {
+			return nil
+		}
+
+		if policy.Clock.Now().Sub(started) >= policy.ResetAfter {
+			backoff = policy.InitialBackoff
+			restarts = 0
+		}
+
+		if (policy.Permanent != nil && policy.Permanent(err)) ||
+			(policy.MaxRestarts > 0 && restarts >= policy.MaxRestarts) {
+			if policy.OnFatal != nil {
+				policy.OnFatal(err)
+			}
+			return err
+		}
+
+		restarts++
+		if policy.OnRestart != nil {
+			policy.OnRestart(restarts, err, backoff)
+		}
+
+		timer := policy.Clock.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil
+		case <-timer.C():
+		}
+
+		backoff *= 2
+		if backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package gokyu
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestSupervise_GivesUpAfterMaxRestarts(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	boom := errors.New("receive failed")
+
+	var (
+		runs   int
+		delays []time.Duration
+		fatal  error
+	)
+	done := make(chan error, 1)
+	go func() {
+		done <- Supervise(context.Background(), RestartPolicy{
+			InitialBackoff: time.Second,
+			MaxBackoff:     3 * time.Second,
+			MaxRestarts:    3,
+			OnRestart:      func(restart int, err error, delay time.Duration) { delays = append(delays, delay) },
+			OnFatal:        func(err error) { fatal = err },
+			Clock:          clock,
+		}, func(ctx context.Context) error {
+			runs++
+			return boom
+		})
+	}()
+
+	for {
+		select {
+		case err := <-done:
+			if !errors.Is(err, boom) || fatal != boom {
+				t.Fatalf("expected fatal %v, got %v (OnFatal %v)", boom, err, fatal)
+			}
+			if runs != 4 {
+				t.Errorf("expected 4 runs, got %d", runs)
+			}
+			want := []time.Duration{time.Second, 2 * time.Second, 3 * time.Second}
+			if len(delays) != len(want) {
+				t.Fatalf("expected delays %v, got %v", want, delays)
+			}
+			for i := range want {
+				if delays[i] != want[i] {
+					t.Errorf("restart %d: expected delay %v, got %v", i+1, want[i], delays[i])
+				}
+			}
+			return
+		default:
+			if clock.Timers() > 0 {
+				clock.Advance(time.Minute)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+func TestSupervise_PermanentError(t *testing.T) {
+	denied := errors.New("unauthorized")
+	runs := 0
+	err := Supervise(context.Background(), RestartPolicy{
+		Permanent: func(err error) bool { return errors.Is(err, denied) },
+	}, func(ctx context.Context) error {
+		runs++
+		return denied
+	})
+	if !errors.Is(err, denied) || runs != 1 {
+		t.Errorf("expected immediate give-up, got %v after %d runs", err, runs)
+	}
+}
+
+func TestSupervise_StopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	err := Supervise(ctx, RestartPolicy{InitialBackoff: time.Hour}, func(ctx context.Context) error {
+		cancel()
+		return errors.New("link detached")
+	})
+	if err != nil {
+		t.Errorf("expected nil after cancellation, got %v", err)
+	}
+}
@@ -0,0 +1,249 @@
+package gokyu
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sync"
+)
+
+// PropertyTenant is the message property set to the tenant ID by
+// TenantPublisher, so consumers of queues shared by several tenants can tell
+// them apart.
+const PropertyTenant = "tenant"
+
+// TenantNaming maps a tenant ID to the queue holding its messages.
+type TenantNaming func(tenant string) string
+
+// TenantPrefix returns a naming strategy with one queue per tenant, named
+// prefix followed by the tenant ID.
+func TenantPrefix(prefix string) TenantNaming {
+	return func(tenant string) string {
+		return prefix + tenant
+	}
+}
+
+// TenantShards returns a naming strategy that hashes tenants onto a fixed
+// number of shared queues. The queue name is format with the shard number,
+// e.g. TenantShards("tenants-%02d", 16).
+func TenantShards(format string, shards int) TenantNaming {
+	return func(tenant string) string {
+		h := fnv.New32a()
+		h.Write([]byte(tenant))
+		return fmt.Sprintf(format, h.Sum32()%uint32(shards))
+	}
+}
+
+// TenantOptions configures a TenantPublisher.
+type TenantOptions struct {
+	// Naming maps tenants to queues (default: the tenant ID is the queue name).
+	Naming TenantNaming
+
+	// MaxInFlight limits concurrent publishes per tenant, so one busy tenant
+	// cannot monopolize the publisher. Publishes beyond the limit wait.
+	// Zero means no limit.
+	MaxInFlight int
+
+	// MaxPublishers limits the number of cached queue publishers. The least
+	// recently used idle publisher is closed when the limit is reached.
+	// Zero means no limit.
+	MaxPublishers int
+}
+
+// TenantPublisher publishes messages to per-tenant queues, creating and
+// caching a publisher per queue:
+//
+//	tenants := gokyu.NewTenantPublisher(client, gokyu.TenantOptions{
+//	    Naming:      gokyu.TenantPrefix("orders-"),
+//	    MaxInFlight: 10,
+//	})
+//	defer tenants.Close(ctx)
+//
+//	err := tenants.Publish(ctx, "acme", msg) // published to orders-acme
+type TenantPublisher struct {
+	client *Client
+	opts   TenantOptions
+
+	mu         sync.Mutex
+	tick       uint64
+	publishers map[string]*tenantQueue
+	limits     map[string]chan struct{}
+	relay      RelayPublisher
+}
+
+// tenantQueue is a cached queue publisher.
+type tenantQueue struct {
+	pub      Publisher
+	active   int
+	lastUsed uint64
+}
+
+// NewTenantPublisher creates a tenant publisher that publishes through
+// publishers created from the client's configuration with the queue replaced
+// by the tenant's queue, or through one relay publisher if
+// Config.AnonymousRelay is set.
+func NewTenantPublisher(client *Client, opts TenantOptions) *TenantPublisher {
+	if opts.Naming == nil {
+		opts.Naming = TenantPrefix("")
+	}
+	return &TenantPublisher{
+		client:     client,
+		opts:       opts,
+		publishers: make(map[string]*tenantQueue),
+		limits:     make(map[string]chan struct{}),
+	}
+}
+
+// Queue returns the queue of a tenant.
+func (p *TenantPublisher) Queue(tenant string) string {
+	return p.opts.Naming(tenant)
+}
+
+// Publish publishes msg to the tenant's queue and sets PropertyTenant.
+func (p *TenantPublisher) Publish(ctx context.Context, tenant string, msg *Message) error {
+	if p.opts.MaxInFlight > 0 {
+		limit := p.limit(tenant)
+		select {
+		case limit <- struct{}{}:
+			defer func() { <-limit }()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	queue, err := p.acquire(ctx, p.opts.Naming(tenant))
+	if err != nil {
+		return err
+	}
+	defer p.release(queue)
+
+	if msg.Properties == nil {
+		msg.Properties = make(map[string]interface{})
+	}
+	msg.Properties[PropertyTenant] = tenant
+	return queue.pub.Publish(ctx, msg)
+}
+
+// Close closes all publishers created by the tenant publisher.
+func (p *TenantPublisher) Close(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var firstErr error
+	for name, queue := range p.publishers {
+		if err := queue.pub.Close(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(p.publishers, name)
+	}
+	if p.relay != nil {
+		if err := p.relay.Close(ctx); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		p.relay = nil
+	}
+	return firstErr
+}
+
+// limit returns the in-flight semaphore of a tenant.
+func (p *TenantPublisher) limit(tenant string) chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	limit, ok := p.limits[tenant]
+	if !ok {
+		limit = make(chan struct{}, p.opts.MaxInFlight)
+		p.limits[tenant] = limit
+	}
+	return limit
+}
+
+// acquire returns the cached publisher for a queue, creating it on first use,
+// and marks it in use until release.
+func (p *TenantPublisher) acquire(ctx context.Context, name string) (*tenantQueue, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.tick++
+	if queue, ok := p.publishers[name]; ok {
+		queue.active++
+		queue.lastUsed = p.tick
+		return queue, nil
+	}
+
+	if p.client.config.AnonymousRelay {
+		if p.relay == nil {
+			relay, err := p.client.NewRelayPublisher(ctx)
+			if err != nil {
+				return nil, err
+			}
+			p.relay = relay
+		}
+		// Relayed queues cost no link, so there is nothing to cache
+		return &tenantQueue{pub: &relayDestination{relay: p.relay, destination: name}, active: 1}, nil
+	}
+
+	if p.opts.MaxPublishers > 0 && len(p.publishers) >= p.opts.MaxPublishers {
+		p.evict(ctx)
+	}
+
+	cfg := p.client.Config()
+	cfg.Queue = name
+	cfg.Topic = ""
+	cfg.Subscription = ""
+	cfg.Metrics = p.client.limited
+
+	client, err := NewClient(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := client.NewPublisher(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	queue := &tenantQueue{pub: pub, active: 1, lastUsed: p.tick}
+	p.publishers[name] = queue
+	return queue, nil
+}
+
+// release marks a publisher returned by acquire as no longer in use.
+func (p *TenantPublisher) release(queue *tenantQueue) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	queue.active--
+}
+
+// evict closes the least recently used idle publisher. Publishers in use are
+// kept, so the cache may temporarily exceed MaxPublishers.
+func (p *TenantPublisher) evict(ctx context.Context) {
+	var oldest string
+	var found *tenantQueue
+	for name, queue := range p.publishers {
+		if queue.active == 0 && (found == nil || queue.lastUsed < found.lastUsed) {
+			oldest, found = name, queue
+		}
+	}
+	if found == nil {
+		return
+	}
+	delete(p.publishers, oldest)
+	found.pub.Close(ctx)
+}
+
+// NewTenantSubscriber creates a subscriber for the queue that naming assigns
+// to tenant. With a sharing strategy such as TenantShards, the queue also
+// holds other tenants' messages; use PropertyTenant to tell them apart.
+func NewTenantSubscriber(ctx context.Context, client *Client, naming TenantNaming, tenant string) (Subscriber, error) {
+	cfg := client.Config()
+	cfg.Queue = naming(tenant)
+	cfg.Topic = ""
+	cfg.Subscription = ""
+	cfg.Metrics = client.limited
+
+	tenantClient, err := NewClient(&cfg)
+	if err != nil {
+		return nil, err
+	}
+	return tenantClient.NewSubscriber(ctx)
+}
@@ -0,0 +1,139 @@
+package gokyu
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// queueFactory creates publishers that record messages per configured queue.
+type queueFactory struct {
+	mockFactory
+	mu        sync.Mutex
+	closed    []string
+	published map[string][]*Message
+	block     chan struct{}
+}
+
+func (f *queueFactory) NewPublisher(ctx context.Context, cfg *Config) (Publisher, error) {
+	return &queuePublisher{factory: f, queue: cfg.Queue}, nil
+}
+
+type queuePublisher struct {
+	factory *queueFactory
+	queue   string
+}
+
+func (p *queuePublisher) Publish(ctx context.Context, msg *Message) error {
+	if p.factory.block != nil {
+		<-p.factory.block
+	}
+	p.factory.mu.Lock()
+	defer p.factory.mu.Unlock()
+	p.factory.published[p.queue] = append(p.factory.published[p.queue], msg)
+	return nil
+}
+
+func (p *queuePublisher) Close(ctx context.Context) error {
+	p.factory.mu.Lock()
+	defer p.factory.mu.Unlock()
+	p.factory.closed = append(p.factory.closed, p.queue)
+	return nil
+}
+
+func newTenantTestClient(t *testing.T, factory *queueFactory) *Client {
+	t.Helper()
+	provider := Provider("test-tenant-provider-" + t.Name())
+	RegisterProvider(provider, factory)
+	client, err := NewClient(&Config{
+		Provider:         provider,
+		ConnectionString: "amqps://test",
+		Topic:            "default-topic",
+	})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	return client
+}
+
+func TestTenantPublisher_Publish(t *testing.T) {
+	factory := &queueFactory{published: make(map[string][]*Message)}
+	tenants := NewTenantPublisher(newTenantTestClient(t, factory), TenantOptions{Naming: TenantPrefix("orders-")})
+	ctx := context.Background()
+
+	for _, tenant := range []string{"acme", "globex", "acme"} {
+		if err := tenants.Publish(ctx, tenant, NewMessage([]byte(tenant))); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+
+	if n := len(factory.published["orders-acme"]); n != 2 {
+		t.Errorf("expected 2 messages for acme, got %d", n)
+	}
+	if n := len(factory.published["orders-globex"]); n != 1 {
+		t.Errorf("expected 1 message for globex, got %d", n)
+	}
+	if got := factory.published["orders-globex"][0].Properties[PropertyTenant]; got != "globex" {
+		t.Errorf("expected tenant property globex, got %v", got)
+	}
+
+	if err := tenants.Close(ctx); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if len(factory.closed) != 2 {
+		t.Errorf("expected 2 publishers closed, got %v", factory.closed)
+	}
+}
+
+func TestTenantPublisher_EvictsLeastRecentlyUsed(t *testing.T) {
+	factory := &queueFactory{published: make(map[string][]*Message)}
+	tenants := NewTenantPublisher(newTenantTestClient(t, factory), TenantOptions{MaxPublishers: 2})
+	ctx := context.Background()
+
+	for _, tenant := range []string{"a", "b", "a", "c"} {
+		tenants.Publish(ctx, tenant, NewMessage(nil))
+	}
+
+	if len(factory.closed) != 1 || factory.closed[0] != "b" {
+		t.Errorf("expected b evicted, got %v", factory.closed)
+	}
+}
+
+func TestTenantPublisher_MaxInFlight(t *testing.T) {
+	factory := &queueFactory{published: make(map[string][]*Message), block: make(chan struct{})}
+	tenants := NewTenantPublisher(newTenantTestClient(t, factory), TenantOptions{MaxInFlight: 1})
+
+	done := make(chan error, 1)
+	go func() { done <- tenants.Publish(context.Background(), "busy", NewMessage(nil)) }()
+
+	// Wait for the first publish to take the tenant's only slot
+	for len(tenants.limit("busy")) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := tenants.Publish(ctx, "busy", NewMessage(nil)); err != context.DeadlineExceeded {
+		t.Errorf("expected second publish to wait for the limit, got %v", err)
+	}
+
+	close(factory.block)
+	if err := <-done; err != nil {
+		t.Errorf("Publish() error = %v", err)
+	}
+}
+
+func TestTenantShards(t *testing.T) {
+	naming := TenantShards("tenants-%02d", 4)
+	if naming("acme") != naming("acme") {
+		t.Error("expected stable shard assignment")
+	}
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		seen[naming(string(rune('a'+i%26))+string(rune('a'+i/26)))] = true
+	}
+	if len(seen) > 4 {
+		t.Errorf("expected at most 4 queues, got %d", len(seen))
+	}
+}
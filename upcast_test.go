@@ -0,0 +1,131 @@
+package gokyu
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// stubSubscriber returns queued messages and records settlements.
+type stubSubscriber struct {
+	msgs   []*Message
+	acked  []*Message
+	nacked []*Message
+}
+
+func (s *stubSubscriber) Receive(ctx context.Context) (*Message, error) {
+	if len(s.msgs) == 0 {
+		return nil, ErrReceiveFailed
+	}
+	msg := s.msgs[0]
+	s.msgs = s.msgs[1:]
+	return msg, nil
+}
+
+func (s *stubSubscriber) Ack(ctx context.Context, msg *Message) error {
+	s.acked = append(s.acked, msg)
+	return nil
+}
+
+func (s *stubSubscriber) Nack(ctx context.Context, msg *Message) error {
+	s.nacked = append(s.nacked, msg)
+	return nil
+}
+
+func (s *stubSubscriber) Close(ctx context.Context) error { return nil }
+
+func TestUpcasters_Upcast(t *testing.T) {
+	u := NewUpcasters("")
+	u.Register(1, func(msg *Message) error {
+		msg.Body = append(msg.Body, "+v2"...)
+		return nil
+	})
+	u.Register(2, func(msg *Message) error {
+		msg.Body = append(msg.Body, "+v3"...)
+		return nil
+	})
+
+	tests := []struct {
+		name        string
+		version     interface{}
+		wantBody    string
+		wantVersion int64
+	}{
+		{name: "missing version treated as v1", version: nil, wantBody: "body+v2+v3", wantVersion: 3},
+		{name: "int version", version: int32(2), wantBody: "body+v3", wantVersion: 3},
+		{name: "string version", version: "2", wantBody: "body+v3", wantVersion: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := NewMessage([]byte("body"))
+			if tt.version != nil {
+				msg.Properties[DefaultVersionProperty] = tt.version
+			}
+			if err := u.Upcast(msg); err != nil {
+				t.Fatalf("Upcast() error = %v", err)
+			}
+			if string(msg.Body) != tt.wantBody {
+				t.Errorf("expected body %q, got %q", tt.wantBody, msg.Body)
+			}
+			if msg.Properties[DefaultVersionProperty] != tt.wantVersion {
+				t.Errorf("expected version %d, got %v", tt.wantVersion, msg.Properties[DefaultVersionProperty])
+			}
+		})
+	}
+
+	t.Run("current version untouched", func(t *testing.T) {
+		msg := NewMessage([]byte("body"))
+		msg.Properties[DefaultVersionProperty] = 3
+		if err := u.Upcast(msg); err != nil {
+			t.Fatalf("Upcast() error = %v", err)
+		}
+		if string(msg.Body) != "body" {
+			t.Errorf("expected body unchanged, got %q", msg.Body)
+		}
+	})
+
+	t.Run("invalid version", func(t *testing.T) {
+		msg := NewMessage([]byte("body"))
+		msg.Properties[DefaultVersionProperty] = "v1"
+		if err := u.Upcast(msg); !errors.Is(err, ErrUpcastFailed) {
+			t.Errorf("expected ErrUpcastFailed, got %v", err)
+		}
+	})
+}
+
+func TestUpcastingSubscriber_Receive(t *testing.T) {
+	u := NewUpcasters("version")
+	badPayload := errors.New("bad payload")
+	u.Register(1, func(msg *Message) error { return badPayload })
+
+	msg := NewMessage([]byte("body"))
+	sub := NewUpcastingSubscriber(&stubSubscriber{msgs: []*Message{msg}}, u)
+
+	got, err := sub.Receive(context.Background())
+	if !errors.Is(err, ErrUpcastFailed) || !errors.Is(err, badPayload) {
+		t.Errorf("expected ErrUpcastFailed wrapping the upcaster error, got %v", err)
+	}
+	if got != msg {
+		t.Error("expected the received message to be returned with the error")
+	}
+}
+
+func TestUpcastingSubscriber_ConsumerNacksFailures(t *testing.T) {
+	u := NewUpcasters("version")
+	u.Register(1, func(msg *Message) error { return errors.New("bad payload") })
+
+	msg := NewMessage([]byte("body"))
+	stub := &stubSubscriber{msgs: []*Message{msg}}
+	consumer := NewConsumer(NewUpcastingSubscriber(stub, u), func(ctx context.Context, msg *Message) error {
+		t.Errorf("handler called with a message that failed to upcast")
+		return nil
+	}, ConsumerOptions{})
+
+	if err := consumer.Run(context.Background()); !errors.Is(err, ErrReceiveFailed) {
+		t.Errorf("Run() error = %v", err)
+	}
+	if len(stub.nacked) != 1 || stub.nacked[0] != msg {
+		t.Errorf("nacked %v, want the message that failed to upcast", stub.nacked)
+	}
+}
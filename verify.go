@@ -0,0 +1,212 @@
+package gokyu
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Pinger is implemented by provider factories that can check connectivity
+// and authentication without creating links.
+type Pinger interface {
+	// Ping connects to the broker, authenticates and disconnects.
+	Ping(ctx context.Context, cfg *Config) error
+}
+
+// CheckStatus is the outcome of a verification check.
+type CheckStatus string
+
+// Check outcomes.
+const (
+	CheckPassed  CheckStatus = "pass"
+	CheckFailed  CheckStatus = "fail"
+	CheckSkipped CheckStatus = "skip"
+)
+
+// Names of the checks run by Client.Verify.
+const (
+	CheckConfig       = "config"
+	CheckConnect      = "connect"
+	CheckPublish      = "publish"
+	CheckReceive      = "receive"
+	CheckCapabilities = "capabilities"
+)
+
+// CheckResult is the result of one verification check.
+type CheckResult struct {
+	Name     string        `json:"name"`
+	Status   CheckStatus   `json:"status"`
+	Detail   string        `json:"detail,omitempty"`
+	Duration time.Duration `json:"duration"`
+
+	err error
+}
+
+// VerifyReport is the result of Client.Verify. It marshals to JSON for
+// health endpoints.
+type VerifyReport struct {
+	Provider Provider      `json:"provider"`
+	Checks   []CheckResult `json:"checks"`
+
+	progress func(CheckResult)
+}
+
+// OK reports whether no check failed.
+func (r *VerifyReport) OK() bool {
+	return r.Err() == nil
+}
+
+// Err returns the errors of the failed checks joined, or nil.
+func (r *VerifyReport) Err() error {
+	var errs []error
+	for _, check := range r.Checks {
+		if check.Status == CheckFailed {
+			errs = append(errs, fmt.Errorf("%s: %w", check.Name, check.err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// String formats the report with one check per line, for startup logs.
+func (r *VerifyReport) String() string {
+	var b strings.Builder
+	for _, check := range r.Checks {
+		fmt.Fprintf(&b, "%-12s %s", check.Name, check.Status)
+		if check.Detail != "" {
+			fmt.Fprintf(&b, " (%s)", check.Detail)
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// Verify checks that the client can work with its configuration, so that
+// services can fail fast at startup:
+//
+//   - config: the configuration is valid
+//   - connect: the broker is reachable and accepts the credentials, on
+//     providers implementing Pinger
+//   - publish: a publisher can be created for Queue or Topic, i.e. the
+//     entity exists and may be sent to
+//   - receive: a subscriber can be created for Queue or Subscription
+//   - capabilities: Config.RequiredCapabilities are offered
+//
+// Checks that depend on a failed check are skipped. Creating the subscriber
+// may make the broker deliver messages ahead, which are released when it is
+// closed; set Config.PrefetchCount low if that matters.
+func (c *Client) Verify(ctx context.Context) *VerifyReport {
+	report := &VerifyReport{Provider: c.config.Provider}
+
+	ok := report.run(CheckConfig, func() (CheckStatus, string, error) {
+		return CheckPassed, "", c.config.Validate()
+	}) && report.run(CheckConnect, func() (CheckStatus, string, error) {
+		pinger, ok := c.factory.(Pinger)
+		if !ok {
+			return CheckSkipped, "not supported by the provider", nil
+		}
+		return CheckPassed, "", pinger.Ping(ctx, c.config)
+	})
+
+	c.attach(ctx, report, ok)
+
+	report.run(CheckCapabilities, func() (CheckStatus, string, error) {
+		return CheckPassed, "", c.Capabilities().satisfies(c.config.RequiredCapabilities)
+	})
+	return report
+}
+
+// run runs check and appends its result to the report. It reports whether
+// the check did not fail.
+func (r *VerifyReport) run(name string, check func() (CheckStatus, string, error)) bool {
+	start := time.Now()
+	status, detail, err := check()
+	if err != nil {
+		status, detail = CheckFailed, err.Error()
+	}
+	r.add(CheckResult{
+		Name:     name,
+		Status:   status,
+		Detail:   detail,
+		Duration: time.Since(start),
+		err:      err,
+	})
+	return status != CheckFailed
+}
+
+// skip appends a skipped check to the report.
+func (r *VerifyReport) skip(name, reason string) {
+	r.add(CheckResult{Name: name, Status: CheckSkipped, Detail: reason})
+}
+
+// add appends result to the report and passes it to the progress callback.
+func (r *VerifyReport) add(result CheckResult) {
+	r.Checks = append(r.Checks, result)
+	if r.progress != nil {
+		r.progress(result)
+	}
+}
+
+// attach runs the publish and receive checks, which create a publisher and
+// a subscriber for the configured entities, or skips them unless ok.
+func (c *Client) attach(ctx context.Context, report *VerifyReport, ok bool) {
+	entities := []struct {
+		name, entity string
+		open         func() (interface{ Close(context.Context) error }, error)
+	}{
+		{CheckPublish, firstNonEmpty(c.config.Queue, c.config.Topic), func() (interface{ Close(context.Context) error }, error) {
+			return c.factory.NewPublisher(ctx, c.config)
+		}},
+		{CheckReceive, firstNonEmpty(c.config.Queue, c.config.Subscription), func() (interface{ Close(context.Context) error }, error) {
+			return c.factory.NewSubscriber(ctx, c.config)
+		}},
+	}
+	for _, e := range entities {
+		switch {
+		case !ok:
+			report.skip(e.name, "connection failed")
+		case e.entity == "":
+			report.skip(e.name, "no entity configured")
+		default:
+			report.run(e.name, func() (CheckStatus, string, error) {
+				link, err := e.open()
+				if err != nil {
+					return CheckFailed, "", err
+				}
+				link.Close(ctx)
+				return CheckPassed, e.entity, nil
+			})
+		}
+	}
+}
+
+// satisfies returns an error naming the features of required that caps do
+// not offer. A required Native feature must be native; a required Emulated
+// feature may be native or emulated.
+func (caps Capabilities) satisfies(required Capabilities) error {
+	var missing []string
+	check := func(name string, have, want Support) {
+		if want == Unsupported || have == want || (want == Emulated && have == Native) {
+			return
+		}
+		missing = append(missing, fmt.Sprintf("%s is %s, %s required", name, have, want))
+	}
+	check("scheduling", caps.Scheduling, required.Scheduling)
+	check("priority", caps.Priority, required.Priority)
+	check("addressing", caps.Addressing, required.Addressing)
+	if len(missing) > 0 {
+		return errors.New(strings.Join(missing, "; "))
+	}
+	return nil
+}
+
+// firstNonEmpty returns the first non-empty string.
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,86 @@
+package gokyu
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// pingFactory is a mockFactory that also implements Pinger.
+type pingFactory struct {
+	mockFactory
+	pingErr error
+}
+
+func (f *pingFactory) Ping(ctx context.Context, cfg *Config) error { return f.pingErr }
+
+func (f *pingFactory) Capabilities() Capabilities {
+	return Capabilities{Scheduling: Native}
+}
+
+func verifyStatuses(report *VerifyReport) string {
+	var statuses []string
+	for _, check := range report.Checks {
+		statuses = append(statuses, check.Name+"="+string(check.Status))
+	}
+	return strings.Join(statuses, " ")
+}
+
+func TestClient_Verify(t *testing.T) {
+	factory := &pingFactory{}
+	RegisterProvider("test-verify-provider", factory)
+	client, err := NewClient(&Config{
+		Provider:             "test-verify-provider",
+		ConnectionString:     "amqps://test",
+		Topic:                "orders",
+		RequiredCapabilities: Capabilities{Scheduling: Emulated},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := client.Verify(context.Background())
+	if !report.OK() {
+		t.Fatalf("Verify() failed: %v", report.Err())
+	}
+	want := "config=pass connect=pass publish=pass receive=skip capabilities=pass"
+	if got := verifyStatuses(report); got != want {
+		t.Errorf("checks = %s, want %s", got, want)
+	}
+	if _, err := json.Marshal(report); err != nil {
+		t.Errorf("Marshal() error = %v", err)
+	}
+
+	// Connection failures skip the entity checks
+	factory.pingErr = WrapError(ErrConnectionFailed, errors.New("SASL PLAIN auth failed"))
+	report = client.Verify(context.Background())
+	want = "config=pass connect=fail publish=skip receive=skip capabilities=pass"
+	if got := verifyStatuses(report); got != want {
+		t.Errorf("checks = %s, want %s", got, want)
+	}
+	if !errors.Is(report.Err(), ErrConnectionFailed) || !strings.Contains(report.String(), "connect      fail (gokyu: connection failed: SASL PLAIN auth failed)") {
+		t.Errorf("unexpected report:\n%s", report)
+	}
+}
+
+func TestClient_Verify_EntityAndCapabilities(t *testing.T) {
+	missing := errors.New("amqp: not-found")
+	RegisterProvider("test-verify-entity-provider", &mockFactory{subscriberErr: missing})
+	client, _ := NewClient(&Config{
+		Provider:             "test-verify-entity-provider",
+		ConnectionString:     "amqps://test",
+		Queue:                "orders",
+		RequiredCapabilities: Capabilities{Priority: Native},
+	})
+
+	report := client.Verify(context.Background())
+	want := "config=pass connect=skip publish=pass receive=fail capabilities=fail"
+	if got := verifyStatuses(report); got != want {
+		t.Errorf("checks = %s, want %s", got, want)
+	}
+	if err := report.Err(); !errors.Is(err, missing) || !strings.Contains(err.Error(), "priority is unsupported, native required") {
+		t.Errorf("Err() = %v", err)
+	}
+}
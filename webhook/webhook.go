@@ -0,0 +1,306 @@
+// Package webhook delivers messages from any gokyu subscriber to an HTTP endpoint.
+//
+// Each received message is POSTed to the configured URL with its body as the
+// request body. Delivery is retried with exponential backoff on network
+// errors and retryable responses (5xx, 408, 429). When delivery fails
+// permanently, the message is published to the dead-letter publisher if one
+// is configured, or released for redelivery otherwise.
+//
+// # Signatures
+//
+// When a Secret is configured, every request carries a Gokyu-Signature header
+// of the form "sha256=<hex>", an HMAC-SHA256 of "<timestamp>.<body>" where
+// timestamp is the value of the Gokyu-Timestamp header (Unix seconds).
+// Receivers should recompute the signature and reject stale timestamps.
+//
+// # Usage
+//
+//	bridge, err := webhook.NewBridge(subscriber, &webhook.Config{
+//	    URL:        "https://example.com/hooks/orders",
+//	    Secret:     []byte(os.Getenv("WEBHOOK_SECRET")),
+//	    DeadLetter: dlqPublisher,
+//	})
+//	err = bridge.Run(ctx)
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime/pprof"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+)
+
+// Request headers set on every delivery.
+const (
+	HeaderMessageID  = "Gokyu-Message-Id"
+	HeaderTimestamp  = "Gokyu-Timestamp"
+	HeaderSignature  = "Gokyu-Signature"
+	HeaderAttempt    = "Gokyu-Attempt"
+	HeaderProperties = "Gokyu-Property-"
+)
+
+// Properties set on messages published to the dead-letter publisher, in
+// addition to a gokyu.FailureRecord in gokyu.PropertyFailure.
+const (
+	PropertyError      = "gokyu-webhook-error"
+	PropertyStatusCode = "gokyu-webhook-status"
+	PropertyAttempts   = "gokyu-webhook-attempts"
+)
+
+// Config holds the configuration of a webhook bridge.
+type Config struct {
+	// URL is the endpoint messages are POSTed to.
+	URL string
+
+	// Secret is the HMAC key used to sign requests. Requests are unsigned if empty.
+	Secret []byte
+
+	// HTTPClient is used to send requests (default: a client with a 30s timeout).
+	HTTPClient *http.Client
+
+	// MaxAttempts is the maximum number of delivery attempts per message (default: 5).
+	MaxAttempts int
+
+	// InitialBackoff is the delay before the first retry (default: 1s).
+	// The delay doubles after every attempt up to MaxBackoff.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the delay between retries (default: 1m).
+	MaxBackoff time.Duration
+
+	// Concurrency is the number of messages delivered in parallel (default: 1).
+	Concurrency int
+
+	// DeadLetter receives messages that could not be delivered. If nil,
+	// undeliverable messages are released for redelivery instead.
+	DeadLetter gokyu.Publisher
+
+	// OnDeadLetter is called for every message published to DeadLetter,
+	// e.g. to page on undeliverable webhooks. It must not block.
+	OnDeadLetter func(gokyu.DeadLetterEvent)
+
+	// Clock is the time source for backoff and timestamps (default: gokyu.SystemClock).
+	Clock gokyu.Clock
+}
+
+// Bridge consumes messages from a subscriber and POSTs them to a webhook.
+type Bridge struct {
+	sub gokyu.Subscriber
+	cfg Config
+}
+
+// NewBridge creates a bridge that delivers messages from sub to the
+// configured URL.
+func NewBridge(sub gokyu.Subscriber, cfg *Config) (*Bridge, error) {
+	if cfg.URL == "" {
+		return nil, gokyu.ErrInvalidConfig("webhook url is required")
+	}
+
+	c := *cfg
+	if c.HTTPClient == nil {
+		c.HTTPClient = &http.Client{Timeout: 30 * time.Second}
+	}
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 5
+	}
+	if c.InitialBackoff <= 0 {
+		c.InitialBackoff = time.Second
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = time.Minute
+	}
+	if c.Concurrency <= 0 {
+		c.Concurrency = 1
+	}
+	if c.Clock == nil {
+		c.Clock = gokyu.SystemClock
+	}
+
+	return &Bridge{sub: sub, cfg: c}, nil
+}
+
+// Run delivers messages until the context is cancelled or receiving fails.
+// It returns nil when stopped by the context.
+func (b *Bridge) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+
+	for i := 0; i < b.cfg.Concurrency; i++ {
+		wg.Add(1)
+		go pprof.Do(ctx, pprof.Labels("gokyu", "webhook-bridge"), func(ctx context.Context) {
+			defer wg.Done()
+			if err := b.loop(ctx); err != nil {
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		})
+	}
+
+	wg.Wait()
+	return firstErr
+}
+
+// loop receives and delivers messages one at a time.
+func (b *Bridge) loop(ctx context.Context) error {
+	for {
+		msg, err := b.sub.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		if err := b.handle(ctx, msg); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// handle delivers a message and settles it according to the outcome.
+func (b *Bridge) handle(ctx context.Context, msg *gokyu.Message) error {
+	status, attempts, err := b.deliver(ctx, msg)
+	if err == nil {
+		return b.sub.Ack(ctx, msg)
+	}
+	if ctx.Err() != nil {
+		return b.sub.Nack(context.Background(), msg)
+	}
+
+	if b.cfg.DeadLetter == nil {
+		return b.sub.Nack(ctx, msg)
+	}
+
+	record := gokyu.NewFailureRecord(msg, err, "webhook", attempts, b.cfg.Clock.Now())
+	dead, encErr := gokyu.NewDeadLetterMessage(msg, record)
+	if encErr != nil {
+		b.sub.Nack(ctx, msg)
+		return encErr
+	}
+	dead.Properties[PropertyError] = err.Error()
+	dead.Properties[PropertyStatusCode] = int64(status)
+	dead.Properties[PropertyAttempts] = int64(attempts)
+
+	if err := b.cfg.DeadLetter.Publish(ctx, dead); err != nil {
+		b.sub.Nack(ctx, msg)
+		return err
+	}
+	if b.cfg.OnDeadLetter != nil {
+		b.cfg.OnDeadLetter(gokyu.DeadLetterEvent{Message: msg, Record: record})
+	}
+	return b.sub.Ack(ctx, msg)
+}
+
+// deliver POSTs the message, retrying retryable failures. It returns the last
+// HTTP status code (0 if none), the number of attempts made, and a non-nil
+// error if the message could not be delivered.
+func (b *Bridge) deliver(ctx context.Context, msg *gokyu.Message) (int, int, error) {
+	backoff := b.cfg.InitialBackoff
+
+	var (
+		status  int
+		lastErr error
+	)
+	for attempt := 1; attempt <= b.cfg.MaxAttempts; attempt++ {
+		var retryable bool
+		status, retryable, lastErr = b.post(ctx, msg, attempt)
+		if lastErr == nil {
+			return status, attempt, nil
+		}
+		if !retryable || attempt == b.cfg.MaxAttempts {
+			return status, attempt, lastErr
+		}
+
+		timer := b.cfg.Clock.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return status, attempt, ctx.Err()
+		case <-timer.C():
+		}
+
+		backoff *= 2
+		if backoff > b.cfg.MaxBackoff {
+			backoff = b.cfg.MaxBackoff
+		}
+	}
+	return status, b.cfg.MaxAttempts, lastErr
+}
+
+// post performs a single delivery attempt.
+func (b *Bridge) post(ctx context.Context, msg *gokyu.Message, attempt int) (status int, retryable bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.cfg.URL, bytes.NewReader(msg.Body))
+	if err != nil {
+		return 0, false, err
+	}
+
+	contentType := msg.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set(HeaderAttempt, strconv.Itoa(attempt))
+	if msg.ID != "" {
+		req.Header.Set(HeaderMessageID, msg.ID)
+	}
+	for k, v := range msg.Properties {
+		req.Header.Set(HeaderProperties+k, fmt.Sprintf("%v", v))
+	}
+
+	timestamp := strconv.FormatInt(b.cfg.Clock.Now().Unix(), 10)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	if len(b.cfg.Secret) > 0 {
+		req.Header.Set(HeaderSignature, Sign(b.cfg.Secret, timestamp, msg.Body))
+	}
+
+	resp, err := b.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return 0, true, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return resp.StatusCode, false, nil
+	case resp.StatusCode >= 500, resp.StatusCode == http.StatusRequestTimeout, resp.StatusCode == http.StatusTooManyRequests:
+		return resp.StatusCode, true, fmt.Errorf("webhook returned %s", resp.Status)
+	default:
+		return resp.StatusCode, false, fmt.Errorf("webhook returned %s", resp.Status)
+	}
+}
+
+// Sign computes the signature header value for a request body.
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is a valid signature of body.
+func Verify(secret []byte, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
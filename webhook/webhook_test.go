@@ -0,0 +1,213 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/venderneutral/gokyu"
+)
+
+type queueSubscriber struct {
+	msgs   chan *gokyu.Message
+	acked  chan *gokyu.Message
+	nacked chan *gokyu.Message
+}
+
+func newQueueSubscriber(msgs ...*gokyu.Message) *queueSubscriber {
+	s := &queueSubscriber{
+		msgs:   make(chan *gokyu.Message, len(msgs)),
+		acked:  make(chan *gokyu.Message, len(msgs)),
+		nacked: make(chan *gokyu.Message, len(msgs)),
+	}
+	for _, m := range msgs {
+		s.msgs <- m
+	}
+	return s
+}
+
+func (s *queueSubscriber) Receive(ctx context.Context) (*gokyu.Message, error) {
+	select {
+	case m := <-s.msgs:
+		return m, nil
+	case <-ctx.Done():
+		return nil, gokyu.WrapError(gokyu.ErrReceiveFailed, ctx.Err())
+	}
+}
+
+func (s *queueSubscriber) Ack(ctx context.Context, msg *gokyu.Message) error {
+	s.acked <- msg
+	return nil
+}
+
+func (s *queueSubscriber) Nack(ctx context.Context, msg *gokyu.Message) error {
+	s.nacked <- msg
+	return nil
+}
+
+func (s *queueSubscriber) Close(ctx context.Context) error { return nil }
+
+type recordingPublisher struct {
+	published chan *gokyu.Message
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, msg *gokyu.Message) error {
+	p.published <- msg
+	return nil
+}
+
+func (p *recordingPublisher) Close(ctx context.Context) error { return nil }
+
+// runBridge runs the bridge until wait returns, then stops it.
+func runBridge(t *testing.T, b *Bridge, wait func()) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- b.Run(ctx) }()
+	wait()
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Run() error = %v", err)
+	}
+}
+
+func TestBridge_DeliversSignedMessages(t *testing.T) {
+	secret := []byte("secret")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !Verify(secret, r.Header.Get(HeaderTimestamp), body, r.Header.Get(HeaderSignature)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get(HeaderMessageID) != "m1" || r.Header.Get(HeaderProperties+"Tenant") != "acme" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	msg := gokyu.NewMessage([]byte("hello"))
+	msg.ID = "m1"
+	msg.Properties["tenant"] = "acme"
+	sub := newQueueSubscriber(msg)
+
+	b, err := NewBridge(sub, &Config{URL: server.URL, Secret: secret})
+	if err != nil {
+		t.Fatalf("NewBridge() error = %v", err)
+	}
+
+	runBridge(t, b, func() {
+		select {
+		case <-sub.acked:
+		case <-sub.nacked:
+			t.Error("expected message to be acked, got nacked")
+		case <-time.After(time.Second):
+			t.Error("timed out waiting for delivery")
+		}
+	})
+}
+
+func TestBridge_RetriesThenSucceeds(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sub := newQueueSubscriber(gokyu.NewMessage([]byte("hello")))
+	b, _ := NewBridge(sub, &Config{URL: server.URL, InitialBackoff: time.Millisecond})
+
+	runBridge(t, b, func() {
+		select {
+		case <-sub.acked:
+		case <-time.After(time.Second):
+			t.Error("timed out waiting for delivery")
+		}
+	})
+
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("expected 3 attempts, got %d", got)
+	}
+}
+
+func TestBridge_RetryBackoffUsesClock(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	clock := gokyu.NewFakeClock(time.Now())
+	sub := newQueueSubscriber(gokyu.NewMessage([]byte("hello")))
+	b, _ := NewBridge(sub, &Config{URL: server.URL, InitialBackoff: time.Hour, Clock: clock})
+
+	runBridge(t, b, func() {
+		deadline := time.Now().Add(time.Second)
+		for clock.Timers() == 0 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		clock.Advance(time.Hour)
+
+		select {
+		case <-sub.acked:
+		case <-time.After(time.Second):
+			t.Error("timed out waiting for delivery")
+		}
+	})
+
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		t.Errorf("expected 2 attempts, got %d", got)
+	}
+}
+
+func TestBridge_DeadLettersPermanentFailures(t *testing.T) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	sub := newQueueSubscriber(gokyu.NewMessage([]byte("hello")))
+	dlq := &recordingPublisher{published: make(chan *gokyu.Message, 1)}
+	b, _ := NewBridge(sub, &Config{URL: server.URL, DeadLetter: dlq, InitialBackoff: time.Millisecond})
+
+	runBridge(t, b, func() {
+		select {
+		case dead := <-dlq.published:
+			if dead.Properties[PropertyStatusCode] != int64(http.StatusBadRequest) {
+				t.Errorf("expected status property 400, got %v", dead.Properties[PropertyStatusCode])
+			}
+			record, ok, err := gokyu.ReadFailureRecord(dead)
+			if !ok || err != nil || record.Handler != "webhook" || record.Attempts != 1 {
+				t.Errorf("expected webhook failure record, got %+v, %v, %v", record, ok, err)
+			}
+		case <-time.After(time.Second):
+			t.Error("timed out waiting for dead-letter")
+		}
+		<-sub.acked
+	})
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("expected 1 attempt for permanent failure, got %d", got)
+	}
+}
+
+func TestNewBridge_RequiresURL(t *testing.T) {
+	if _, err := NewBridge(newQueueSubscriber(), &Config{}); err == nil {
+		t.Error("expected error for missing URL")
+	}
+}
@@ -0,0 +1,382 @@
+package gokyu
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebSocketSubprotocol is the WebSocket subprotocol of the AMQP WebSocket
+// binding.
+const WebSocketSubprotocol = "amqp"
+
+// webSocketGUID is appended to the handshake key to compute the accept key
+// (RFC 6455, section 1.3).
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket opcodes.
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+// ErrWebSocketHandshake is returned when the server rejects the WebSocket
+// upgrade.
+var ErrWebSocketHandshake = errors.New("gokyu: websocket handshake failed")
+
+// WebSocketURL returns the URL providers dial when Config.WebSocket is set:
+// the broker host on port 443 (80 without TLS) with the given path. An
+// explicit Port overrides the default when no ConnectionString is set.
+func (c *Config) WebSocketURL(path string) (string, error) {
+	return c.webSocketURL(c.BuildConnectionString(), path)
+}
+
+// webSocketURL returns the WebSocket URL for the broker at amqpURL.
+func (c *Config) webSocketURL(amqpURL, path string) (string, error) {
+	u, err := url.Parse(amqpURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid connection string: %w", err)
+	}
+
+	scheme, port := "wss", "443"
+	if u.Scheme == "amqp" || u.Scheme == "" {
+		scheme, port = "ws", "80"
+	}
+	if c.ConnectionString == "" && c.Port != 0 {
+		port = strconv.Itoa(c.Port)
+	}
+
+	ws := url.URL{Scheme: scheme, Host: net.JoinHostPort(u.Hostname(), port), Path: path}
+	return ws.String(), nil
+}
+
+// DialWebSocket opens a WebSocket connection to a ws:// or wss:// URL,
+// negotiating the AMQP subprotocol, and returns it as a net.Conn that sends
+// each Write as one binary message. Connections go through the proxy named
+// by the HTTPS_PROXY or HTTP_PROXY environment variables, if any. tlsConfig
+// may be nil.
+func DialWebSocket(ctx context.Context, rawURL string, tlsConfig *tls.Config) (net.Conn, error) {
+	return dialWebSocket(ctx, Dialer{}.WithDefaults(), rawURL, tlsConfig)
+}
+
+// dialWebSocket is DialWebSocket connecting with dialer.
+func dialWebSocket(ctx context.Context, dialer Dialer, rawURL string, tlsConfig *tls.Config) (net.Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "ws" && u.Scheme != "wss" {
+		return nil, fmt.Errorf("gokyu: unsupported websocket scheme %q", u.Scheme)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "wss" {
+			port = "443"
+		}
+	}
+	addr := net.JoinHostPort(u.Hostname(), port)
+
+	conn, err := dialThroughProxy(ctx, dialer, u, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if u.Scheme == "wss" {
+		var cfg *tls.Config
+		if tlsConfig != nil {
+			cfg = tlsConfig.Clone()
+		} else {
+			cfg = &tls.Config{}
+		}
+		if cfg.ServerName == "" {
+			cfg.ServerName = u.Hostname()
+		}
+		tlsConn := tls.Client(conn, cfg)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	ws, err := webSocketHandshake(conn, u)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Time{})
+	return ws, nil
+}
+
+// dialThroughProxy connects to addr, tunnelling through an HTTP CONNECT
+// proxy if the environment configures one for u.
+func dialThroughProxy(ctx context.Context, dialer Dialer, u *url.URL, addr string) (net.Conn, error) {
+	// ProxyFromEnvironment only understands http and https URLs
+	probe := *u
+	probe.Scheme = strings.Replace(u.Scheme, "ws", "http", 1)
+	proxy, err := http.ProxyFromEnvironment(&http.Request{URL: &probe})
+	if err != nil {
+		return nil, err
+	}
+
+	if proxy == nil {
+		return dialer.DialContext(ctx, "tcp", addr)
+	}
+
+	proxyAddr := proxy.Host
+	if proxy.Port() == "" {
+		proxyAddr = net.JoinHostPort(proxy.Hostname(), "80")
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if proxy.User != nil {
+		password, _ := proxy.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxy.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("gokyu: proxy CONNECT to %s: %s", addr, resp.Status)
+	}
+	return conn, nil
+}
+
+// webSocketHandshake performs the opening handshake over conn.
+func webSocketHandshake(conn net.Conn, u *url.URL) (*wsConn, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	path := u.RequestURI()
+	req := &http.Request{
+		Method: http.MethodGet,
+		URL:    &url.URL{Opaque: path},
+		Host:   u.Host,
+		Header: http.Header{
+			"Upgrade":                {"websocket"},
+			"Connection":             {"Upgrade"},
+			"Sec-Websocket-Key":      {key},
+			"Sec-Websocket-Version":  {"13"},
+			"Sec-Websocket-Protocol": {WebSocketSubprotocol},
+		},
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrWebSocketHandshake, resp.Status)
+	}
+	if !strings.EqualFold(resp.Header.Get("Upgrade"), "websocket") {
+		return nil, fmt.Errorf("%w: missing upgrade header", ErrWebSocketHandshake)
+	}
+	if resp.Header.Get("Sec-Websocket-Accept") != webSocketAccept(key) {
+		return nil, fmt.Errorf("%w: invalid accept key", ErrWebSocketHandshake)
+	}
+	if protocol := resp.Header.Get("Sec-Websocket-Protocol"); protocol != WebSocketSubprotocol {
+		return nil, fmt.Errorf("%w: server selected subprotocol %q", ErrWebSocketHandshake, protocol)
+	}
+
+	return &wsConn{Conn: conn, br: br}, nil
+}
+
+// webSocketAccept returns the Sec-WebSocket-Accept value for key.
+func webSocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + webSocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// wsConn is the client side of a WebSocket connection, exposing the payload
+// of binary messages as a byte stream.
+type wsConn struct {
+	net.Conn
+	br *bufio.Reader
+
+	readMu    sync.Mutex
+	remaining int64 // unread payload bytes of the current frame
+
+	writeMu sync.Mutex
+	closed  bool
+}
+
+// Read reads message payload, answering pings and ending with io.EOF when
+// the server closes the connection.
+func (c *wsConn) Read(p []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	for c.remaining == 0 {
+		if err := c.nextFrame(); err != nil {
+			return 0, err
+		}
+	}
+	if int64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.br.Read(p)
+	c.remaining -= int64(n)
+	return n, err
+}
+
+// nextFrame reads frame headers until a data frame starts, handling control
+// frames on the way.
+func (c *wsConn) nextFrame() error {
+	var header [2]byte
+	if _, err := io.ReadFull(c.br, header[:]); err != nil {
+		return err
+	}
+	opcode := header[0] & 0x0F
+	if header[1]&0x80 != 0 {
+		return errors.New("gokyu: websocket server sent a masked frame")
+	}
+
+	length := int64(header[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return err
+		}
+		length = int64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.br, ext[:]); err != nil {
+			return err
+		}
+		length = int64(binary.BigEndian.Uint64(ext[:]) &^ (1 << 63))
+	}
+
+	switch opcode {
+	case wsBinary, wsContinuation:
+		c.remaining = length
+		return nil
+	case wsClose, wsPing, wsPong:
+		if length > 125 {
+			return errors.New("gokyu: websocket control frame too long")
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(c.br, payload); err != nil {
+			return err
+		}
+		switch opcode {
+		case wsPing:
+			return c.writeFrame(wsPong, payload)
+		case wsClose:
+			c.writeFrame(wsClose, payload)
+			return io.EOF
+		}
+		return nil
+	case wsText:
+		return errors.New("gokyu: websocket server sent a text frame")
+	default:
+		return fmt.Errorf("gokyu: unknown websocket opcode %d", opcode)
+	}
+}
+
+// Write sends p as one binary message.
+func (c *wsConn) Write(p []byte) (int, error) {
+	if err := c.writeFrame(wsBinary, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writeFrame sends a single masked frame.
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.closed {
+		return net.ErrClosed
+	}
+
+	frame := make([]byte, 2, 14+len(payload))
+	frame[0] = 0x80 | opcode
+	switch n := len(payload); {
+	case n < 126:
+		frame[1] = 0x80 | byte(n)
+	case n <= 0xFFFF:
+		frame[1] = 0x80 | 126
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame[1] = 0x80 | 127
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+
+	var mask [4]byte
+	if _, err := rand.Read(mask[:]); err != nil {
+		return err
+	}
+	frame = append(frame, mask[:]...)
+	start := len(frame)
+	frame = append(frame, payload...)
+	for i := range frame[start:] {
+		frame[start+i] ^= mask[i%4]
+	}
+
+	_, err := c.Conn.Write(frame)
+	if opcode == wsClose {
+		c.closed = true
+	}
+	return err
+}
+
+// Close sends a close frame and closes the underlying connection.
+func (c *wsConn) Close() error {
+	c.writeFrame(wsClose, []byte{0x03, 0xE8}) // 1000: normal closure
+	return c.Conn.Close()
+}
@@ -0,0 +1,196 @@
+package gokyu
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfig_WebSocketURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   string
+	}{
+		{
+			name:   "TLS defaults to 443",
+			config: Config{Host: "ns.servicebus.windows.net", Username: "u", Password: "p", UseTLS: true},
+			want:   "wss://ns.servicebus.windows.net:443/$servicebus/websocket",
+		},
+		{
+			name:   "plain defaults to 80",
+			config: Config{Host: "localhost", Username: "u", Password: "p"},
+			want:   "ws://localhost:80/$servicebus/websocket",
+		},
+		{
+			name:   "explicit port",
+			config: Config{Host: "broker", Port: 8443, Username: "u", Password: "p", UseTLS: true},
+			want:   "wss://broker:8443/$servicebus/websocket",
+		},
+		{
+			name:   "connection string port is the AMQP port",
+			config: Config{ConnectionString: "amqps://u:p@broker:5671"},
+			want:   "wss://broker:443/$servicebus/websocket",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.config.WebSocketURL("/$servicebus/websocket")
+			if err != nil {
+				t.Fatalf("WebSocketURL() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("WebSocketURL() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// wsEchoServer accepts WebSocket connections and echoes each binary message
+// back in two fragments, preceded by a ping.
+func wsEchoServer(t *testing.T, pongs chan<- []byte) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Sec-Websocket-Protocol") != WebSocketSubprotocol {
+			http.Error(w, "subprotocol", http.StatusBadRequest)
+			return
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n")
+		rw.WriteString("Sec-WebSocket-Accept: " + webSocketAccept(r.Header.Get("Sec-Websocket-Key")) + "\r\n")
+		rw.WriteString("Sec-WebSocket-Protocol: amqp\r\n\r\n")
+		rw.Flush()
+
+		for {
+			opcode, payload, err := readClientFrame(rw.Reader)
+			if err != nil {
+				return
+			}
+			switch opcode {
+			case wsPong:
+				pongs <- payload
+			case wsClose:
+				return
+			case wsBinary:
+				conn.Write([]byte{0x80 | wsPing, 4, 'p', 'i', 'n', 'g'})
+				half := len(payload) / 2
+				conn.Write(append([]byte{wsBinary, byte(half)}, payload[:half]...))
+				conn.Write(append([]byte{0x80 | wsContinuation, byte(len(payload) - half)}, payload[half:]...))
+			}
+		}
+	}))
+}
+
+// readClientFrame reads a short masked frame from a client.
+func readClientFrame(r *bufio.Reader) (byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	if header[1]&0x80 == 0 {
+		return 0, nil, errors.New("unmasked client frame")
+	}
+	length := int(header[1] & 0x7F)
+	if length == 126 {
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	var mask [4]byte
+	if _, err := io.ReadFull(r, mask[:]); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return header[0] & 0x0F, payload, nil
+}
+
+func TestDialWebSocket(t *testing.T) {
+	pongs := make(chan []byte, 2)
+	srv := wsEchoServer(t, pongs)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := DialWebSocket(ctx, "ws"+strings.TrimPrefix(srv.URL, "http")+"/$servicebus/websocket", nil)
+	if err != nil {
+		t.Fatalf("DialWebSocket() error = %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := conn.Write([]byte("AMQP\x00\x01\x00\x00")); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	got := make([]byte, 8)
+	if _, err := io.ReadFull(conn, got); err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if string(got) != "AMQP\x00\x01\x00\x00" {
+		t.Errorf("Read() = %q", got)
+	}
+
+	select {
+	case pong := <-pongs:
+		if string(pong) != "ping" {
+			t.Errorf("pong payload = %q, want ping", pong)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("no pong received")
+	}
+
+	// A payload above 125 bytes uses the 16-bit length encoding
+	long := []byte(strings.Repeat("x", 200))
+	if _, err := conn.Write(long); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	got = make([]byte, len(long))
+	if _, err := io.ReadFull(conn, got); err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if string(got) != string(long) {
+		t.Errorf("Read() returned %d bytes that differ from the message", len(got))
+	}
+}
+
+func TestDialWebSocket_Rejected(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	_, err := DialWebSocket(context.Background(), "ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if !errors.Is(err, ErrWebSocketHandshake) {
+		t.Errorf("DialWebSocket() error = %v, want ErrWebSocketHandshake", err)
+	}
+}
+
+func TestDialWebSocket_Scheme(t *testing.T) {
+	if _, err := DialWebSocket(context.Background(), "amqps://broker", nil); err == nil {
+		t.Error("DialWebSocket() accepted a non-websocket URL")
+	}
+}
+
+var _ net.Conn = (*wsConn)(nil)